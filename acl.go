@@ -0,0 +1,181 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ACLUser is a named server user, who authenticates with AUTH name
+// password and may then run only the commands it is granted, on only the
+// keys it is granted. The default user, which clients are until they
+// authenticate as someone else, keeps full access under
+// ServerConfig.Password.
+type ACLUser struct {
+	Name     string
+	Password string // The server keeps only a hash of it.
+
+	// Commands lists what the user may run: command names such as "get",
+	// and categories prefixed with @: @read, @write, @pubsub, @scripting,
+	// @transaction, @connection and @admin. @all allows every command.
+	// @connection commands such as PING and QUIT are always allowed.
+	Commands []string
+
+	// Keys lists glob patterns, with the syntax of Keys, of the keys the
+	// user's commands may read or write; "*" allows every key.
+	Keys []string
+}
+
+// commandCategories assigns each server command to an ACL category.
+// Commands missing from it count as @admin, so a new command is denied to
+// restricted users until it is categorized.
+var commandCategories = map[string]string{
+	"PING": "connection", "ECHO": "connection", "QUIT": "connection",
+	"AUTH": "connection", "HELLO": "connection", "SELECT": "connection",
+
+	"GET": "read", "MGET": "read", "EXISTS": "read", "KEYS": "read",
+	"HGETALL": "read", "ZSCORE": "read", "XRANGE": "read", "XREAD": "read",
+	"PFCOUNT": "read", "DUMP": "read", "TTL": "read", "PTTL": "read",
+
+	"SET": "write", "SETNX": "write", "GETSET": "write", "MSET": "write",
+	"DEL": "write", "INCR": "write", "DECR": "write", "INCRBY": "write",
+	"DECRBY": "write", "HSET": "write", "XADD": "write", "XREADGROUP": "write",
+	"XGROUP": "write", "XACK": "write", "PFADD": "write", "PFMERGE": "write",
+	"RENAME": "write", "COPY": "write", "RESTORE": "write", "EXPIRE": "write",
+	"PEXPIRE": "write", "PERSIST": "write",
+
+	"PUBLISH": "pubsub", "SUBSCRIBE": "pubsub", "UNSUBSCRIBE": "pubsub",
+
+	"FCALL": "scripting", "EVAL": "scripting", "EVALSHA": "scripting", "SCRIPT": "scripting",
+
+	"MULTI": "transaction", "EXEC": "transaction", "DISCARD": "transaction",
+	"WATCH": "transaction", "UNWATCH": "transaction",
+
+	"CONFIG": "admin", "INFO": "admin", "DEBUG": "admin", "REPLICAOF": "admin",
+	"CHECKSYNC": "admin", "SYNC": "admin",
+}
+
+// aclUser is an ACLUser compiled for checking. A nil *aclUser is the
+// default user, allowed everything.
+type aclUser struct {
+	name       string
+	passHash   []byte          // SHA-256 of the password.
+	all        bool            // Granted @all.
+	categories map[string]bool // Granted categories, without the @.
+	commands   map[string]bool // Granted commands, upper case.
+	keys       []string        // Glob patterns of accessible keys.
+}
+
+// errNoPermKey is the reply to a command touching a key the user may not.
+var errNoPermKey = errors.New("NOPERM No permissions to access a key")
+
+// compileUsers hashes and indexes the users of a ServerConfig.
+func compileUsers(users []ACLUser) map[string]*aclUser {
+	compiled := make(map[string]*aclUser, len(users))
+	for _, u := range users {
+		sum := sha256.Sum256([]byte(u.Password))
+		cu := &aclUser{
+			name:       u.Name,
+			passHash:   sum[:],
+			categories: make(map[string]bool),
+			commands:   make(map[string]bool),
+			keys:       append([]string(nil), u.Keys...),
+		}
+		for _, c := range u.Commands {
+			switch category, isCategory := strings.CutPrefix(strings.ToLower(c), "@"); {
+			case category == "all":
+				cu.all = true
+			case isCategory:
+				cu.categories[category] = true
+			default:
+				cu.commands[strings.ToUpper(c)] = true
+			}
+		}
+		compiled[u.Name] = cu
+	}
+	return compiled
+}
+
+// passwordMatches compares password with the user's hash in constant time.
+func (u *aclUser) passwordMatches(password string) bool {
+	sum := sha256.Sum256([]byte(password))
+	return subtle.ConstantTimeCompare(sum[:], u.passHash) == 1
+}
+
+// check returns a NOPERM error unless the user may run the command name,
+// upper case, with args, on every key it touches.
+func (u *aclUser) check(name string, args []string) error {
+	if u == nil {
+		return nil // The default user.
+	}
+	category, ok := commandCategories[name]
+	if !ok {
+		category = "admin"
+	}
+	if !u.all && category != "connection" && !u.categories[category] && !u.commands[name] {
+		return fmt.Errorf("NOPERM User %s has no permissions to run the '%s' command", u.name, strings.ToLower(name))
+	}
+	for _, key := range commandKeys(name, args) {
+		if !u.mayAccess(key) {
+			return errNoPermKey
+		}
+	}
+	return nil
+}
+
+// mayAccess reports whether one of the user's key patterns matches key.
+func (u *aclUser) mayAccess(key string) bool {
+	for _, pattern := range u.keys {
+		if matchGlob(pattern, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// commandKeys returns the keys a command's arguments name.
+func commandKeys(name string, args []string) []string {
+	switch name {
+	case "DEL", "EXISTS", "MGET", "WATCH", "PFCOUNT", "PFMERGE":
+		return args
+	case "EXPIRE", "PEXPIRE", "TTL", "PTTL", "PERSIST": // Only scripts run these.
+		return args[:min(len(args), 1)]
+	case "RENAME", "COPY": // RENAME src dst
+		return args[:min(len(args), 2)]
+	case "MSET":
+		keys := make([]string, 0, (len(args)+1)/2)
+		for i := 0; i < len(args); i += 2 {
+			keys = append(keys, args[i])
+		}
+		return keys
+	case "XREAD", "XREADGROUP": // ... STREAMS key [key ...] id [id ...]
+		for i, arg := range args {
+			if strings.EqualFold(arg, "STREAMS") {
+				streams := args[i+1:]
+				return streams[:len(streams)/2]
+			}
+		}
+		return nil
+	case "XGROUP": // XGROUP CREATE key ...
+		if len(args) < 2 {
+			return nil
+		}
+		return args[1:2]
+	case "FCALL", "EVAL", "EVALSHA": // FCALL function numkeys key [key ...] arg [arg ...]
+		if len(args) < 2 {
+			return nil
+		}
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 0 || n > len(args)-2 {
+			return nil // The command itself rejects this.
+		}
+		return args[2 : 2+n]
+	}
+	if cmd, ok := commands[name]; ok && cmd.keyed && len(args) > 0 {
+		return args[:1]
+	}
+	return nil
+}
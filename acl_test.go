@@ -0,0 +1,133 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCommandKeys(t *testing.T) {
+	for _, tc := range []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"GET", "k"}, []string{"k"}},
+		{[]string{"SET", "k", "v", "EX", "10"}, []string{"k"}},
+		{[]string{"HSET", "h", "f", "v"}, []string{"h"}},
+		{[]string{"DEL", "a", "b", "c"}, []string{"a", "b", "c"}},
+		{[]string{"MGET", "a", "b"}, []string{"a", "b"}},
+		{[]string{"MSET", "a", "1", "b", "2"}, []string{"a", "b"}},
+		{[]string{"PFMERGE", "dst", "s1", "s2"}, []string{"dst", "s1", "s2"}},
+		{[]string{"RENAME", "src", "dst"}, []string{"src", "dst"}},
+		{[]string{"COPY", "src", "dst", "REPLACE"}, []string{"src", "dst"}},
+		{[]string{"EXPIRE", "k", "10"}, []string{"k"}},
+		{[]string{"XREAD", "COUNT", "1", "STREAMS", "s1", "s2", "0", "0"}, []string{"s1", "s2"}},
+		{[]string{"XREADGROUP", "GROUP", "g", "c", "streams", "s", ">"}, []string{"s"}},
+		{[]string{"XREAD", "COUNT", "1"}, nil},
+		{[]string{"XGROUP", "CREATE", "s", "g", "$"}, []string{"s"}},
+		{[]string{"EVAL", "return 1", "2", "k1", "k2", "arg"}, []string{"k1", "k2"}},
+		{[]string{"FCALL", "f", "0", "arg"}, []string{}},
+		{[]string{"EVALSHA", "abc", "5", "k"}, nil}, // More keys than arguments.
+		{[]string{"EVAL", "return 1", "x"}, nil},
+		{[]string{"PING"}, nil},
+		{[]string{"PUBLISH", "channel", "message"}, nil},
+		{[]string{"INFO"}, nil},
+	} {
+		if got := commandKeys(tc.args[0], tc.args[1:]); !slices.Equal(got, tc.want) {
+			t.Errorf("commandKeys(%q) = %q, want %q", tc.args, got, tc.want)
+		}
+	}
+}
+
+func TestACLCheck(t *testing.T) {
+	users := compileUsers([]ACLUser{
+		{Name: "reader", Commands: []string{"@read"}, Keys: []string{"public:*", "shared"}},
+		{Name: "mixed", Commands: []string{"@READ", "set", "PUBLISH"}, Keys: []string{"*"}},
+		{Name: "root", Commands: []string{"@all"}, Keys: []string{"*"}},
+		{Name: "nokeys", Commands: []string{"@all"}},
+	})
+	for _, tc := range []struct {
+		user string
+		args []string
+		want string // The start of the error; empty for allowed.
+	}{
+		{"reader", []string{"GET", "public:1"}, ""},
+		{"reader", []string{"GET", "shared"}, ""},
+		{"reader", []string{"GET", "private"}, "NOPERM No permissions to access a key"},
+		{"reader", []string{"MGET", "public:1", "private"}, "NOPERM No permissions to access a key"},
+		{"reader", []string{"SET", "public:1", "v"}, "NOPERM User reader has no permissions to run the 'set' command"},
+		{"reader", []string{"PING"}, ""}, // @connection is always allowed.
+		{"reader", []string{"CONFIG", "GET", "x"}, "NOPERM"},
+		{"reader", []string{"NOSUCHCOMMAND"}, "NOPERM"}, // Uncategorized counts as @admin.
+		{"mixed", []string{"SET", "k", "v"}, ""},
+		{"mixed", []string{"PUBLISH", "c", "m"}, ""},
+		{"mixed", []string{"DEL", "k"}, "NOPERM User mixed"},
+		{"mixed", []string{"SUBSCRIBE", "c"}, "NOPERM User mixed"},
+		{"root", []string{"FLUSHALL"}, ""},
+		{"root", []string{"RENAME", "a", "b"}, ""},
+		{"nokeys", []string{"PING"}, ""},
+		{"nokeys", []string{"GET", "k"}, "NOPERM No permissions to access a key"},
+	} {
+		err := users[tc.user].check(tc.args[0], tc.args[1:])
+		switch {
+		case tc.want == "" && err != nil:
+			t.Errorf("%s: %q = %v, want it allowed", tc.user, tc.args, err)
+		case tc.want != "" && (err == nil || !strings.HasPrefix(err.Error(), tc.want)):
+			t.Errorf("%s: %q = %v, want %q", tc.user, tc.args, err, tc.want)
+		}
+	}
+	var defaultUser *aclUser
+	if err := defaultUser.check("FLUSHALL", nil); err != nil {
+		t.Errorf("the default user: %v, want everything allowed", err)
+	}
+}
+
+func TestServerAuthUsers(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	addr := startServer(t, db, ServerConfig{Password: "admin", Users: []ACLUser{
+		{Name: "app", Password: "pw", Commands: []string{"@read", "@write"}, Keys: []string{"app:*"}},
+	}})
+	c := dial(t, addr)
+	if reply, ok := c.do(t, "GET", "app:1").(error); !ok || !strings.HasPrefix(reply.Error(), "NOAUTH") {
+		t.Errorf("GET before AUTH = %v, want NOAUTH", reply)
+	}
+	for _, args := range [][]string{
+		{"AUTH", "app", "wrong"},
+		{"AUTH", "nobody", "pw"},
+		{"AUTH", "wrong"},
+		{"AUTH", "default", "pw"},
+	} {
+		if reply, ok := c.do(t, args...).(error); !ok || reply.Error() != errWrongPass.Error() {
+			t.Errorf("%q = %v, want WRONGPASS", args, reply)
+		}
+	}
+	if reply, ok := c.do(t, "GET", "app:1").(error); !ok || !strings.HasPrefix(reply.Error(), "NOAUTH") {
+		t.Errorf("GET after failed AUTHs = %v, want NOAUTH still", reply)
+	}
+
+	if reply := c.do(t, "AUTH", "app", "pw"); reply != "OK" {
+		t.Fatalf("AUTH app = %v, want OK", reply)
+	}
+	if reply := c.do(t, "SET", "app:1", "v"); reply != "OK" {
+		t.Errorf("SET app:1 = %v, want OK", reply)
+	}
+	if reply, ok := c.do(t, "SET", "other", "v").(error); !ok || reply.Error() != errNoPermKey.Error() {
+		t.Errorf("SET other = %v, want %v", reply, errNoPermKey)
+	}
+	if reply, ok := c.do(t, "INFO").(error); !ok || !strings.HasPrefix(reply.Error(), "NOPERM User app") {
+		t.Errorf("INFO = %v, want NOPERM", reply)
+	}
+	if reply := c.do(t, "AUTH", "app", "wrong"); reply == "OK" {
+		t.Fatal("AUTH with a wrong password succeeded")
+	}
+	if reply := c.do(t, "GET", "app:1"); reply != "v" {
+		t.Errorf("GET app:1 after a failed re-AUTH = %v, want v: the client stays app", reply)
+	}
+	if reply := c.do(t, "AUTH", "admin"); reply != "OK" {
+		t.Fatalf("AUTH as the default user = %v, want OK", reply)
+	}
+	if reply := c.do(t, "GET", "other"); reply != nil {
+		t.Errorf("GET other as the default user = %v, want nil", reply)
+	}
+}
@@ -0,0 +1,604 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// aofMagic starts every append-only file, followed by the format version:
+// 1, or 2 for the at-rest format of WithAtRest (see aofCodec).
+const (
+	aofMagic   = "REDISAOF"
+	aofVersion = 1
+)
+
+// AOF record tags.
+const (
+	aofSet    = 'S' // A key's whole state: deadline, field TTLs and value.
+	aofDelete = 'D' // A key that no longer exists.
+)
+
+// aofRewriteMinSize is the smallest file that is rewritten automatically,
+// like Redis auto-aof-rewrite-min-size; a file is also only rewritten once
+// it has doubled since the last rewrite.
+const aofRewriteMinSize = 64 << 20
+
+// maxAOFRecord caps the length of a record body, so a corrupted length, on
+// disk or from a primary, is reported rather than allocated.
+const maxAOFRecord = maxSnapshotRecord
+
+// aofBatch is how many records LoadAOF applies per write lock.
+const aofBatch = 1024
+
+// errAOFCorrupt reports an append-only file that cannot be parsed.
+var errAOFCorrupt = errors.New("aof: corrupt file")
+
+// ErrAOFEnabled is returned by EnableAOF if the database already has an
+// append-only file.
+var ErrAOFEnabled = errors.New("aof: already enabled")
+
+// FsyncPolicy chooses when the append-only file is flushed to stable
+// storage, like the Redis appendfsync setting. Every policy hands each write
+// to the operating system before the operation returns; they differ in how
+// much a power loss or kernel crash can lose.
+type FsyncPolicy int
+
+const (
+	FsyncEverySec FsyncPolicy = iota // Sync once a second; lose up to a second.
+	FsyncAlways                      // Sync before every write returns; lose nothing.
+	FsyncNo                          // Leave syncing to the operating system.
+)
+
+// aofLog is the append-only file configured by EnableAOF.
+type aofLog struct {
+	mu       sync.Mutex // Serializes writes, syncs and rewrites of the file.
+	path     string
+	file     *os.File
+	policy   FsyncPolicy
+	codec    *aofCodec     // How records are stored; nil for version 1.
+	size     int64         // Bytes in the file.
+	baseSize int64         // Bytes after the last rewrite, for automatic rewrites.
+	rewrite  chan struct{} // Wakes the rewriter once the file has grown.
+	err      error         // First failed write or sync since the last rewrite.
+}
+
+// EnableAOF makes the database log every change to the append-only file
+// fileName, so that writes made after the last snapshot survive a restart.
+// If the file exists it is replayed first, as LoadAOF does, bringing the
+// store up to date; otherwise it is created. From then on each change is
+// appended before the write lock is released, and synced to disk as policy
+// says.
+//
+// The log records the resulting state of each changed key, its value, TTL
+// and hash field TTLs, rather than the command that changed it, so every
+// write method is covered and replaying a record is idempotent. This costs
+// encoding the whole value on every change, so updates to very large
+// collections get slower. Values that cannot be encoded are logged as
+// deleted, with an error in the log. Once the file has doubled in size since
+// it was last rewritten, and is at least 64 MB, it is rewritten in the
+// background (see RewriteAOF). Close flushes and closes the file.
+//
+// A write or sync that fails is logged, the file is cut back to its last
+// complete record, and the error sticks: AOFError and SetDurable return
+// it, so under FsyncAlways a caller can tell a write that is not on disk. Changes made
+// meanwhile skip the file, which is rewritten from memory in the
+// background to catch up; once a rewrite succeeds the error clears.
+//
+// With WithAtRest, records are compressed and encrypted as it says. An
+// existing file in another format is replayed as it is and then rewritten
+// in the configured one; if that rewrite fails its error is returned and
+// the file, still enabled, keeps its format until it is next rewritten.
+func (db *DataBase) EnableAOF(fileName string, policy FsyncPolicy) error {
+	db.lock.RLock()
+	enabled := db.aof != nil
+	db.lock.RUnlock()
+	if enabled {
+		return ErrAOFEnabled
+	}
+	if err := db.LoadAOF(fileName); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	file, size, codec, err := db.openAOF(fileName)
+	if err != nil {
+		return err
+	}
+	log := &aofLog{
+		path: fileName, file: file, codec: codec, policy: policy, size: size, baseSize: size,
+		rewrite: make(chan struct{}, 1),
+	}
+	db.lock.Lock()
+	if db.aof != nil {
+		db.lock.Unlock()
+		file.Close()
+		return ErrAOFEnabled // Lost a race with another EnableAOF.
+	}
+	db.aof = log
+	db.lock.Unlock()
+
+	db.spawn(func() { db.runAOF(log) })
+	if !codec.matches(db.atRest) {
+		if err := db.RewriteAOF(); err != nil {
+			return fmt.Errorf("aof %s: rewriting in the at-rest format: %w", fileName, err)
+		}
+	}
+	return nil
+}
+
+// openAOF opens fileName for appending, writing the header if it is new,
+// and returns the file, its size and the codec of its records, read from
+// the header of an existing file.
+func (db *DataBase) openAOF(fileName string) (*os.File, int64, *aofCodec, error) {
+	file, err := os.OpenFile(fileName, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, nil, err
+	}
+	size := info.Size()
+	var codec *aofCodec
+	if size == 0 {
+		codec, err = db.atRest.newAOFCodec()
+		if err == nil {
+			var n int
+			n, err = file.Write(codec.header())
+			size = int64(n)
+		}
+		if err == nil {
+			err = file.Sync()
+		}
+	} else if codec, err = readAOFHeader(io.NewSectionReader(file, 0, size), db.atRest); err != nil {
+		err = fmt.Errorf("aof %s: %w", fileName, err)
+	}
+	if err != nil {
+		file.Close()
+		return nil, 0, nil, err
+	}
+	return file, size, codec, nil
+}
+
+// runAOF syncs the file every second under FsyncEverySec and performs the
+// automatic rewrites, until Close.
+func (db *DataBase) runAOF(log *aofLog) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if log.policy == FsyncEverySec {
+				log.mu.Lock()
+				if err := log.file.Sync(); err != nil {
+					db.logger.Error("aof sync failed", "file", log.path, "err", err)
+					log.fail(err)
+				}
+				log.mu.Unlock()
+			}
+		case <-log.rewrite:
+			if err := db.RewriteAOF(); err != nil {
+				db.logger.Error("aof rewrite failed", "file", log.path, "err", err)
+			}
+		case <-db.stop:
+			return // Close was called; it closes the file.
+		}
+	}
+}
+
+// logChange marks key as changed for the append-only file and the
+// replicas. The caller must hold the write lock.
+func (db *DataBase) logChange(key string) {
+	if db.aof == nil && db.feeds.count.Load() == 0 {
+		return // Nobody needs the change.
+	}
+	if db.unflushed == nil {
+		db.unflushed = make(map[string]struct{})
+	}
+	db.unflushed[key] = struct{}{}
+}
+
+// flushChanges records the state of every key changed under the write lock
+// in the append-only file and sends it to the replicas. unlock calls it
+// before releasing the lock, so both see changes in the order they were
+// made.
+func (db *DataBase) flushChanges() {
+	if len(db.unflushed) == 0 {
+		return
+	}
+	var buf []byte
+	for key := range db.unflushed {
+		buf = db.appendAOFRecord(buf, key)
+	}
+	clear(db.unflushed)
+	db.feeds.send(buf)
+	if db.aof != nil {
+		db.writeAOF(buf)
+	}
+}
+
+// writeAOF appends records to the append-only file and syncs it if the
+// policy says so. A failure leaves the file as it was before the write and
+// sets the sticky error. The caller must hold the write lock.
+func (db *DataBase) writeAOF(buf []byte) {
+	log := db.aof
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	if log.err != nil {
+		log.requestRewrite() // The file is behind; only a rewrite catches it up.
+		return
+	}
+	if log.codec != nil {
+		buf = log.codec.reframe(buf) // The replicas got the plain records.
+	}
+	n, err := log.file.Write(buf)
+	if err == nil && log.policy == FsyncAlways {
+		err = log.file.Sync()
+	}
+	if err != nil {
+		db.logger.Error("aof write failed", "file", log.path, "err", err)
+		if n > 0 {
+			if err := log.file.Truncate(log.size); err != nil { // Drop the partial record.
+				db.logger.Error("aof truncate failed", "file", log.path, "err", err)
+			}
+		}
+		log.fail(err)
+		log.requestRewrite()
+		return
+	}
+	log.size += int64(n)
+	if log.size >= aofRewriteMinSize && log.size >= 2*log.baseSize {
+		log.requestRewrite()
+	}
+}
+
+// fail records err as the log's sticky error, unless one is already set.
+// The caller must hold log.mu.
+func (log *aofLog) fail(err error) {
+	if log.err == nil {
+		log.err = fmt.Errorf("aof %s: %w", log.path, err)
+	}
+}
+
+// requestRewrite wakes the background rewriter.
+func (log *aofLog) requestRewrite() {
+	select {
+	case log.rewrite <- struct{}{}:
+	default: // A rewrite is already pending.
+	}
+}
+
+// AOFError returns the error of the first write or sync of the append-only
+// file that failed since it was last rewritten, or nil. While it is set,
+// changes are in memory only.
+func (db *DataBase) AOFError() error {
+	db.lock.RLock()
+	log := db.aof
+	db.lock.RUnlock()
+	if log == nil {
+		return nil
+	}
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	return log.err
+}
+
+// appendAOFRecord appends a record of key's current state. The caller must
+// hold the lock.
+func (db *DataBase) appendAOFRecord(buf []byte, key string) []byte {
+	body := []byte{aofDelete}
+	if value, exists := db.data.get(key); exists {
+		blob, err := encodeValue(value)
+		if err != nil {
+			db.logger.Error("aof: value cannot be encoded; logged as deleted", "key", key, "err", err)
+		} else {
+			body = db.appendAOFState([]byte{aofSet}, key, blob)
+		}
+	}
+	if body[0] == aofDelete {
+		body = appendString(body, key)
+	}
+	return appendAOFFrame(buf, body)
+}
+
+// appendAOFFrame appends a record body with its length and checksum.
+func appendAOFFrame(buf, body []byte) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(body)))
+	buf = append(buf, body...)
+	return binary.BigEndian.AppendUint32(buf, crc32.Checksum(body, checksumTable))
+}
+
+// appendAOFState appends the body of a set record after its tag.
+func (db *DataBase) appendAOFState(b []byte, key string, blob []byte) []byte {
+	b = appendString(b, key)
+	var deadline int64 // Zero means no TTL.
+	if t, ok := db.expires.get(key); ok {
+		deadline = t.UnixNano()
+	}
+	b = binary.AppendVarint(b, deadline)
+	fields := db.fieldExpires[key]
+	b = binary.AppendUvarint(b, uint64(len(fields)))
+	for field, t := range fields {
+		b = appendString(b, field)
+		b = binary.AppendVarint(b, t.UnixNano())
+	}
+	b = binary.AppendUvarint(b, uint64(len(blob)))
+	return append(b, blob...)
+}
+
+// aofRecord is one parsed record of an append-only file.
+type aofRecord struct {
+	key      string
+	deleted  bool
+	value    any
+	deadline time.Time
+	fields   map[string]time.Time
+}
+
+// LoadAOF replays the append-only file fileName, as written with
+// EnableAOF, into the database: keys it records replace existing ones and
+// keys it records as deleted are removed, and keys whose deadline has passed
+// are not loaded. A last record cut short, as a crash mid-write leaves it, is
+// ignored with a warning in the log, as Redis does by default. A record that
+// fails its checksum stops the replay with ErrChecksumMismatch, keeping the
+// records before it. Files in the at-rest format of WithAtRest are decoded
+// as their header says; encrypted ones need its key. A read-only database
+// loads nothing and returns ErrReadOnly.
+func (db *DataBase) LoadAOF(fileName string) error {
+	if db.ReadOnly() {
+		return ErrReadOnly // Replicas replay their primary's stream instead.
+	}
+	file, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	r := bufio.NewReader(file)
+	codec, err := readAOFHeader(r, db.atRest)
+	if err != nil {
+		return fmt.Errorf("aof %s: %w", fileName, err)
+	}
+
+	var batch []aofRecord
+	replayed := 0
+	for {
+		rec, err := readAOFRecord(r, codec)
+		if err == io.EOF {
+			break
+		}
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			db.logger.Warn("aof ends with a truncated record; ignoring it", "file", fileName, "records", replayed+len(batch))
+			break
+		}
+		if err != nil {
+			db.replayAOF(batch)
+			return fmt.Errorf("aof %s: %w", fileName, err)
+		}
+		batch = append(batch, rec)
+		if len(batch) == aofBatch {
+			db.replayAOF(batch)
+			replayed += len(batch)
+			batch = batch[:0]
+		}
+	}
+	db.replayAOF(batch)
+	return nil
+}
+
+// readAOFRecord reads and decodes the next record, stored by codec unless
+// it is nil. It returns io.EOF at a clean end of file and
+// io.ErrUnexpectedEOF for a record cut short.
+func readAOFRecord(r *bufio.Reader, codec *aofCodec) (aofRecord, error) {
+	body, err := readAOFFrame(r)
+	if err != nil {
+		return aofRecord{}, err
+	}
+	if codec != nil {
+		if body, err = codec.decode(body); err != nil {
+			return aofRecord{}, err
+		}
+	}
+	return parseAOFRecord(body)
+}
+
+// readAOFFrame reads the next record body and checks its checksum.
+func readAOFFrame(r *bufio.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err // io.EOF only if nothing at all was read.
+	}
+	if n == 0 || n > maxAOFRecord {
+		return nil, errAOFCorrupt // Every body has at least its tag.
+	}
+	var body []byte
+	if n <= snapshotPrealloc {
+		body = make([]byte, n+4)
+		_, err = io.ReadFull(r, body)
+	} else {
+		// Grow with the data actually read, so a corrupted length cannot
+		// allocate more than the file or connection delivers.
+		body, err = io.ReadAll(io.LimitReader(r, int64(n)+4))
+		if err == nil && len(body) < int(n)+4 {
+			err = io.ErrUnexpectedEOF
+		}
+	}
+	if err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	body, sum := body[:n], body[n:]
+	if crc32.Checksum(body, checksumTable) != binary.BigEndian.Uint32(sum) {
+		return nil, ErrChecksumMismatch
+	}
+	return body, nil
+}
+
+// parseAOFRecord decodes a set or delete record body.
+func parseAOFRecord(body []byte) (aofRecord, error) {
+	d := &archiveDecoder{b: body}
+	tag := d.bytes(1)
+	if d.err != nil {
+		return aofRecord{}, errAOFCorrupt
+	}
+	rec := aofRecord{key: d.string(), deleted: tag[0] == aofDelete}
+	if tag[0] != aofSet {
+		if tag[0] != aofDelete || d.err != nil {
+			return aofRecord{}, errAOFCorrupt
+		}
+		return rec, nil
+	}
+	if nanos := d.varint(); nanos != 0 {
+		rec.deadline = time.Unix(0, nanos)
+	}
+	if count := d.count(); count > 0 {
+		rec.fields = make(map[string]time.Time, count)
+		for range count {
+			field := d.string()
+			rec.fields[field] = time.Unix(0, d.varint())
+		}
+	}
+	blob := d.bytes(d.count())
+	if d.err != nil {
+		return aofRecord{}, errAOFCorrupt
+	}
+	var err error
+	if rec.value, err = decodeValue(blob); err != nil {
+		return aofRecord{}, fmt.Errorf("key %q: %w", rec.key, err)
+	}
+	return rec, nil
+}
+
+// replayAOF applies replayed records under one write lock.
+func (db *DataBase) replayAOF(records []aofRecord) {
+	if len(records) == 0 {
+		return
+	}
+	db.lock.Lock()    // Acquire a write lock to modify the database.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	now := db.clock.Now()
+	for _, rec := range records {
+		expired := !rec.deadline.IsZero() && !rec.deadline.After(now)
+		if rec.deleted || expired {
+			if db.data.has(rec.key) {
+				db.removeKey(rec.key)
+			}
+			continue
+		}
+		db.place(rec.key, rec.value, true, rec.deadline, !rec.deadline.IsZero(), rec.fields)
+	}
+}
+
+// RewriteAOF replaces the append-only file with a compact one holding a
+// single record per live key, like Redis BGREWRITEAOF, so the file stops
+// growing with every overwrite. The new file is written next to the old one,
+// synced and renamed over it, so a crash leaves one or the other intact.
+// Writers wait while it runs; readers do not. It is called automatically as
+// the file grows (see EnableAOF) and does nothing if no file is enabled.
+// The new file is in the at-rest format of WithAtRest, if set, with a new
+// salt.
+func (db *DataBase) RewriteAOF() error {
+	db.lock.RLock()         // Hold off writers so the new file is of one instant.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+	log := db.aof
+	if log == nil {
+		return nil
+	}
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	codec, err := db.atRest.newAOFCodec()
+	if err != nil {
+		return err
+	}
+
+	tmp := log.path + ".rewrite"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp) // Fails harmlessly once renamed.
+	w := bufio.NewWriter(file)
+	header := codec.header()
+	w.Write(header)
+	size := int64(len(header))
+	now := db.clock.Now()
+	var buf []byte
+	for key := range db.data.all() {
+		if db.isExpired(key, now) {
+			continue // Dead keys awaiting removal are not kept.
+		}
+		buf = db.appendAOFRecord(buf[:0], key)
+		if codec != nil {
+			buf = codec.reframe(buf)
+		}
+		w.Write(buf) // Errors stick to w and surface on Flush.
+		size += int64(len(buf))
+	}
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, log.path); err != nil {
+		return err
+	}
+	next, _, nextCodec, err := db.openAOF(log.path)
+	if err != nil {
+		return err
+	}
+	log.file.Close() // Renamed over; nothing more goes to it.
+	log.file, log.codec, log.size, log.baseSize = next, nextCodec, size, size
+	log.err = nil // The new file holds every change, including any the old one missed.
+	db.logger.Info("aof rewritten", "file", log.path, "bytes", size)
+	return nil
+}
+
+// syncAOF flushes the append-only file to stable storage, reporting false if
+// none is enabled. It returns the sticky error of a failed write instead,
+// if there is one.
+func (db *DataBase) syncAOF() (bool, error) {
+	db.lock.RLock()
+	log := db.aof
+	db.lock.RUnlock()
+	if log == nil {
+		return false, nil
+	}
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	if log.err != nil {
+		return true, log.err // The file may be missing changes; a sync cannot fix that.
+	}
+	if err := log.file.Sync(); err != nil {
+		log.fail(err)
+		return true, log.err
+	}
+	return true, nil
+}
+
+// closeAOF syncs and closes the append-only file. Close calls it once the
+// background goroutines have stopped.
+func (db *DataBase) closeAOF() {
+	db.lock.Lock()
+	log := db.aof
+	db.aof = nil
+	db.lock.Unlock()
+	if log == nil {
+		return
+	}
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	if err := log.file.Sync(); err != nil {
+		db.logger.Error("aof sync failed", "file", log.path, "err", err)
+	}
+	log.file.Close()
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeAOF records a few writes to an append-only file in a temporary
+// directory and returns its name.
+func writeAOF(t *testing.T) string {
+	t.Helper()
+	fileName := filepath.Join(t.TempDir(), "appendonly.aof")
+	db := NewDataBase()
+	if err := db.EnableAOF(fileName, FsyncAlways); err != nil {
+		t.Fatalf("EnableAOF: %v", err)
+	}
+	db.Set("a", "1")
+	db.Set("b", "2")
+	db.SetWithTTL("c", "3", time.Hour)
+	db.Delete("a")
+	db.Set("d", "4")
+	db.Close()
+	return fileName
+}
+
+func TestLoadAOFReplays(t *testing.T) {
+	fileName := writeAOF(t)
+	db := NewDataBase()
+	defer db.Close()
+	if err := db.LoadAOF(fileName); err != nil {
+		t.Fatalf("LoadAOF: %v", err)
+	}
+	if _, ok := db.Get("a"); ok {
+		t.Error("deleted key a was replayed")
+	}
+	for key, want := range map[string]string{"b": "2", "c": "3", "d": "4"} {
+		if got, ok := db.Get(key); !ok || got != want {
+			t.Errorf("Get(%s) = %v, %v; want %s", key, got, ok, want)
+		}
+	}
+	if ttl := db.TTL("c"); ttl <= 0 || ttl > time.Hour {
+		t.Errorf("TTL(c) = %v, want up to an hour", ttl)
+	}
+}
+
+func TestLoadAOFTruncatedTail(t *testing.T) {
+	fileName := writeAOF(t)
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(fileName, data[:len(data)-2], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	db := NewDataBase()
+	defer db.Close()
+	if err := db.LoadAOF(fileName); err != nil {
+		t.Fatalf("LoadAOF: %v", err)
+	}
+	if _, ok := db.Get("d"); ok {
+		t.Error("the truncated last record was replayed")
+	}
+	if got, _ := db.Get("b"); got != "2" {
+		t.Errorf("Get(b) = %v, want the records before the damage", got)
+	}
+}
+
+func TestReadAOFFrameCorruptLength(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		n    uint64
+		want error
+	}{
+		{"empty body", 0, errAOFCorrupt},
+		{"huge", 1 << 62, errAOFCorrupt},
+		{"wraps with the checksum", ^uint64(0) - 1, errAOFCorrupt},
+		{"past the end", 1 << 30, io.ErrUnexpectedEOF},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			frame := append(binary.AppendUvarint(nil, tc.n), "Sbody"...)
+			_, err := readAOFFrame(bufio.NewReader(bytes.NewReader(frame)))
+			if !errors.Is(err, tc.want) {
+				t.Errorf("readAOFFrame error = %v, want %v", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestReadAOFFrameChecksum(t *testing.T) {
+	frame := appendAOFFrame(nil, []byte("Sbody"))
+	body, err := readAOFFrame(bufio.NewReader(bytes.NewReader(frame)))
+	if err != nil || string(body) != "Sbody" {
+		t.Fatalf("readAOFFrame = %q, %v", body, err)
+	}
+	frame[2] ^= 1
+	if _, err := readAOFFrame(bufio.NewReader(bytes.NewReader(frame))); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("readAOFFrame of a damaged frame: %v, want ErrChecksumMismatch", err)
+	}
+}
+
+func TestAOFWriteFailureSticks(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "appendonly.aof")
+	db := NewDataBase()
+	defer db.Close()
+	if err := db.EnableAOF(fileName, FsyncAlways); err != nil {
+		t.Fatalf("EnableAOF: %v", err)
+	}
+	db.Set("a", "1")
+	good, err := os.Stat(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log := db.aof
+	log.mu.Lock()
+	writable := log.file
+	readOnly, err := os.Open(fileName) // Every write to it fails.
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.file = readOnly
+	log.mu.Unlock()
+	if err := os.Mkdir(fileName+".rewrite", 0o755); err != nil { // Background rewrites fail too.
+		t.Fatal(err)
+	}
+	db.Set("b", "2")
+	if err := db.AOFError(); err == nil {
+		t.Fatal("AOFError = nil after a failed write")
+	}
+	db.Set("c", "3")
+	if info, _ := os.Stat(fileName); info.Size() != good.Size() {
+		t.Errorf("file is %d bytes after the failure, want the %d of its last good write", info.Size(), good.Size())
+	}
+	log.mu.Lock()
+	if log.size != good.Size() {
+		t.Errorf("log size = %d, want %d: a failed write counts no bytes", log.size, good.Size())
+	}
+	log.file = writable
+	readOnly.Close()
+	log.mu.Unlock()
+	db.Set("d", "4")
+	if info, _ := os.Stat(fileName); info.Size() != good.Size() {
+		t.Error("a write after the failure went to the file, behind the changes it missed")
+	}
+	if err := os.Remove(fileName + ".rewrite"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.RewriteAOF(); err != nil {
+		t.Fatalf("RewriteAOF: %v", err)
+	}
+	if err := db.AOFError(); err != nil {
+		t.Errorf("AOFError = %v after a rewrite, want nil", err)
+	}
+	db.Close()
+
+	replayed := NewDataBase()
+	defer replayed.Close()
+	if err := replayed.LoadAOF(fileName); err != nil {
+		t.Fatalf("LoadAOF: %v", err)
+	}
+	for _, key := range []string{"a", "b", "c", "d"} {
+		if _, ok := replayed.Get(key); !ok {
+			t.Errorf("%s is missing after the rewrite caught the file up", key)
+		}
+	}
+}
@@ -0,0 +1,674 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"maps"
+	"math"
+	"reflect"
+	"slices"
+	"sort"
+	"time"
+)
+
+// archiveMagic starts every archive, followed by the format version.
+const (
+	archiveMagic   = "REDISARC"
+	archiveVersion = 1
+)
+
+// Archive record tags.
+const (
+	archiveKey    = 'K' // One key: its name, deadline and value.
+	archiveSelect = 'D' // The index of the database the keys after it belong to.
+	archiveEnd    = 'E' // End of the archive, followed by the checksum.
+)
+
+// Archive value tags. Each value starts with one, naming how the rest of
+// it is encoded.
+const (
+	tagNil        = '0' // No payload.
+	tagScalar     = 'v' // Go type name, then the value.
+	tagList       = 'l' // Count, then each element.
+	tagSlice      = 'a' // As tagList, for []any.
+	tagHash       = 'h' // Count, then each field and value.
+	tagMap        = 'm' // As tagHash, for map[string]any.
+	tagSet        = 'S' // Count, then each member.
+	tagZSet       = 'z' // Count, then each member and score.
+	tagStream     = 'x' // Last ID, count, then each entry's ID and fields.
+	tagGroups     = 'X' // As tagStream, then its consumer groups (see appendStreamGroups).
+	tagHLL        = 'p' // The registers of a HyperLogLog, as a string.
+	tagSerializer = 'c' // Serializer name, then its bytes (see RegisterSerializer).
+	tagRegistered = 'r' // Registered name, then the value as JSON (see RegisterType).
+)
+
+// errArchiveCorrupt reports an archive that ends early or cannot be parsed.
+var errArchiveCorrupt = errors.New("archive: corrupt or truncated")
+
+// Archive writes the whole keyspace to w in a portable, self-describing
+// format, for moving data between machines and builds. Unlike the gob
+// snapshots of Persist, it does not depend on Go's type encoding: every
+// value carries an explicit type tag, the store's lists, hashes, sets, sorted
+// sets and streams are written element by element, built-in scalars by
+// their type name, and other values under the name given by
+// RegisterSerializer (with its bytes) or RegisterType (as JSON, so fields
+// may be added or removed between builds). Unlike Persist, this applies to
+// values nested in collections too.
+//
+// The archive is the magic "REDISARC" and a version byte, then one record
+// per key, then an end record and a CRC-32C of everything before it. Each
+// record is a tag byte and a length-prefixed body, the key's name, its
+// deadline in Unix nanoseconds (0 for none) and its value. Lengths and
+// integers are varints. Values of other types are skipped and reported in
+// an *UnencodableError, as in Persist, after the rest is written.
+func (db *DataBase) Archive(w io.Writer) error {
+	return writeArchive(w, []*DataBase{db}, false)
+}
+
+// writeArchive implements Archive for one database, and Databases.Archive
+// for several, whose keys are each preceded by a select record naming
+// their database, its index as a varint, if numbered is set. Unnumbered,
+// the keys of every database are written as one keyspace, as
+// Sharded.Archive writes its shards.
+func writeArchive(w io.Writer, dbs []*DataBase, numbered bool) error {
+	bw := bufio.NewWriter(w)
+	sum := crc32.New(checksumTable)
+	out := io.MultiWriter(bw, sum)
+	if _, err := io.WriteString(out, archiveMagic+string(rune(archiveVersion))); err != nil {
+		return err
+	}
+	var skipped []string
+	for i, db := range dbs {
+		if numbered {
+			if err := writeArchiveRecord(out, archiveSelect, binary.AppendUvarint(nil, uint64(i))); err != nil {
+				return err
+			}
+		}
+		dbSkipped, err := db.archiveKeys(out)
+		if err != nil {
+			return err
+		}
+		skipped = append(skipped, dbSkipped...)
+	}
+
+	if _, err := out.Write([]byte{archiveEnd}); err != nil {
+		return err
+	}
+	if _, err := bw.Write(sum.Sum(nil)); err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	if len(skipped) > 0 {
+		return &UnencodableError{Keys: skipped}
+	}
+	return nil
+}
+
+// archiveKeys writes a record for every live key and returns the keys
+// whose values could not be encoded.
+func (db *DataBase) archiveKeys(out io.Writer) ([]string, error) {
+	db.lock.RLock()         // Hold writers off while the values are encoded.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+	keys := make([]string, 0, db.data.len())
+	now := db.clock.Now()
+	for key := range db.data.all() {
+		if !db.isExpired(key, now) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys) // A stable order makes archives comparable.
+	var skipped []string
+	var body []byte
+	for _, key := range keys {
+		body = appendString(body[:0], key)
+		var deadline int64
+		if t, ok := db.expires.get(key); ok {
+			deadline = t.UnixNano()
+		}
+		body = binary.AppendVarint(body, deadline)
+		var err error
+		if body, err = appendArchiveValue(body, db.data.value(key)); err != nil {
+			skipped = append(skipped, key)
+			continue
+		}
+		if err := writeArchiveRecord(out, archiveKey, body); err != nil {
+			return nil, err
+		}
+	}
+	return skipped, nil
+}
+
+// Restore merges the keys of an archive written by Archive into the
+// database, replacing existing keys of the same names. Keys whose deadline
+// has passed are dropped. Nothing is restored if the archive is corrupt,
+// fails its checksum (ErrChecksumMismatch) or holds a value whose type name
+// is not known to this build. Of an archive written by Databases.Archive,
+// only database 0 is restored.
+func (db *DataBase) Restore(r io.Reader) error {
+	loaded, err := readArchive(r)
+	if err != nil {
+		return err
+	}
+	if err := db.merge(loaded[0]); err != nil {
+		return err
+	}
+	db.logger.Info("archive restored", "keys", len(loaded[0]))
+	return nil
+}
+
+// readArchive reads and checks an archive, returning its keys by the index
+// of their database: 0 for all of them unless it has select records.
+func readArchive(r io.Reader) (map[int]map[string]snapshotEntry, error) {
+	ar := &archiveReader{r: bufio.NewReader(r), sum: crc32.New(checksumTable)}
+	header := make([]byte, len(archiveMagic)+1)
+	if err := ar.read(header); err != nil || string(header[:len(archiveMagic)]) != archiveMagic {
+		return nil, errors.New("archive: not an archive")
+	}
+	if v := header[len(archiveMagic)]; v < 1 || v > archiveVersion {
+		return nil, fmt.Errorf("archive: unsupported version %d", v)
+	}
+
+	type keyBody struct {
+		db   int
+		body []byte
+	}
+	var bodies []keyBody // Decoded once the checksum has vouched for them.
+	current := 0
+	for {
+		tag, body, err := ar.record()
+		if err != nil {
+			return nil, err
+		}
+		if tag == archiveEnd {
+			break
+		}
+		switch tag {
+		case archiveKey:
+			bodies = append(bodies, keyBody{current, body})
+		case archiveSelect:
+			d := &archiveDecoder{b: body}
+			if current = int(d.uvarint()); d.err != nil {
+				return nil, d.err
+			}
+		} // Records this version does not know are skipped by their length.
+	}
+	want := ar.sum.Sum32()
+	trailer := make([]byte, 4)
+	if _, err := io.ReadFull(ar.r, trailer); err != nil {
+		return nil, errArchiveCorrupt
+	}
+	if binary.BigEndian.Uint32(trailer) != want {
+		return nil, ErrChecksumMismatch
+	}
+
+	loaded := map[int]map[string]snapshotEntry{0: {}}
+	for _, kb := range bodies {
+		d := &archiveDecoder{b: kb.body}
+		key := d.string()
+		deadline := d.varint()
+		value, err := d.value()
+		if err != nil {
+			return nil, fmt.Errorf("archive: key %q: %w", key, err)
+		}
+		if d.err != nil {
+			return nil, d.err
+		}
+		entry := snapshotEntry{value: value}
+		if deadline != 0 {
+			entry.deadline = time.Unix(0, deadline)
+		}
+		if loaded[kb.db] == nil {
+			loaded[kb.db] = make(map[string]snapshotEntry)
+		}
+		loaded[kb.db][key] = entry
+	}
+	return loaded, nil
+}
+
+// writeArchiveRecord writes a tag and a length-prefixed body.
+func writeArchiveRecord(w io.Writer, tag byte, body []byte) error {
+	head := binary.AppendUvarint([]byte{tag}, uint64(len(body)))
+	if _, err := w.Write(head); err != nil {
+		return err
+	}
+	_, err := w.Write(body)
+	return err
+}
+
+// appendString appends a length-prefixed string.
+func appendString(b []byte, s string) []byte {
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+// appendArchiveValue appends a tagged value, recursing into collections.
+func appendArchiveValue(b []byte, value any) ([]byte, error) {
+	var err error
+	switch v := value.(type) {
+	case nil:
+		return append(b, tagNil), nil
+	case List:
+		return appendArchiveValues(append(b, tagList), v)
+	case []any:
+		return appendArchiveValues(append(b, tagSlice), v)
+	case Hash:
+		return appendArchiveFields(append(b, tagHash), v)
+	case map[string]any:
+		return appendArchiveFields(append(b, tagMap), v)
+	case Set:
+		b = binary.AppendUvarint(append(b, tagSet), uint64(len(v)))
+		for _, member := range sortedMembers(v) {
+			b = appendString(b, member)
+		}
+		return b, nil
+	case *ZSet:
+		b = binary.AppendUvarint(append(b, tagZSet), uint64(v.Len()))
+		for m := range v.all() {
+			b = appendString(b, m.Member)
+			b = binary.BigEndian.AppendUint64(b, math.Float64bits(m.Score))
+		}
+		return b, nil
+	case *Stream:
+		if len(v.Groups) > 0 {
+			b = append(b, tagGroups)
+		} else {
+			b = append(b, tagStream) // As before consumer groups, for older readers.
+		}
+		b = binary.AppendUvarint(binary.AppendUvarint(b, v.LastID.Ms), v.LastID.Seq)
+		b = binary.AppendUvarint(b, uint64(len(v.Entries)))
+		for _, e := range v.Entries {
+			b = binary.AppendUvarint(binary.AppendUvarint(b, e.ID.Ms), e.ID.Seq)
+			if b, err = appendArchiveFields(b, e.Fields); err != nil {
+				return nil, err
+			}
+		}
+		if len(v.Groups) > 0 {
+			b = appendStreamGroups(b, v.Groups)
+		}
+		return b, nil
+	case *HyperLogLog:
+		return appendString(append(b, tagHLL), string(v.Registers)), nil
+	}
+	if s, ok := serializerFor(value); ok {
+		data, err := s.marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		return appendString(appendString(append(b, tagSerializer), s.name), string(data)), nil
+	}
+	if name, ok := registeredName(value); ok {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		return appendString(appendString(append(b, tagRegistered), name), string(data)), nil
+	}
+	return appendArchiveScalar(b, value)
+}
+
+// appendArchiveValues appends a count and each element.
+func appendArchiveValues(b []byte, items []any) ([]byte, error) {
+	b = binary.AppendUvarint(b, uint64(len(items)))
+	var err error
+	for _, item := range items {
+		if b, err = appendArchiveValue(b, item); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// appendStreamGroups appends a stream's consumer groups: their count, then,
+// in name order, each group's name, last delivered ID and pending count, and
+// each pending entry's ID, consumer and delivery time in Unix nanoseconds.
+func appendStreamGroups(b []byte, groups map[string]*StreamGroup) []byte {
+	b = binary.AppendUvarint(b, uint64(len(groups)))
+	for _, name := range slices.Sorted(maps.Keys(groups)) {
+		g := groups[name]
+		b = appendString(b, name)
+		b = binary.AppendUvarint(binary.AppendUvarint(b, g.LastDelivered.Ms), g.LastDelivered.Seq)
+		b = binary.AppendUvarint(b, uint64(len(g.Pending)))
+		for _, p := range g.Pending {
+			b = binary.AppendUvarint(binary.AppendUvarint(b, p.ID.Ms), p.ID.Seq)
+			b = binary.AppendVarint(appendString(b, p.Consumer), p.Delivered.UnixNano())
+		}
+	}
+	return b
+}
+
+// appendArchiveFields appends a count and each field and value, sorted by
+// field.
+func appendArchiveFields(b []byte, m map[string]any) ([]byte, error) {
+	fields := make([]string, 0, len(m))
+	for field := range m {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	b = binary.AppendUvarint(b, uint64(len(fields)))
+	var err error
+	for _, field := range fields {
+		if b, err = appendArchiveValue(appendString(b, field), m[field]); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// appendArchiveScalar appends a built-in scalar under its type name.
+func appendArchiveScalar(b []byte, value any) ([]byte, error) {
+	typ := reflect.TypeOf(value)
+	if _, ok := jsonScalars[typ.String()]; !ok {
+		return nil, errUnencodable
+	}
+	b = appendString(append(b, tagScalar), typ.String())
+	v := reflect.ValueOf(value)
+	switch typ.Kind() {
+	case reflect.String:
+		return appendString(b, v.String()), nil
+	case reflect.Slice: // []byte
+		return appendString(b, string(v.Bytes())), nil
+	case reflect.Bool:
+		if v.Bool() {
+			return append(b, 1), nil
+		}
+		return append(b, 0), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return binary.AppendVarint(b, v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return binary.AppendUvarint(b, v.Uint()), nil
+	}
+	return binary.BigEndian.AppendUint64(b, math.Float64bits(v.Float())), nil
+}
+
+// archiveReader reads records, checksumming everything it reads.
+type archiveReader struct {
+	r   *bufio.Reader
+	sum hash.Hash32
+}
+
+// read fills p.
+func (ar *archiveReader) read(p []byte) error {
+	if _, err := io.ReadFull(ar.r, p); err != nil {
+		return errArchiveCorrupt
+	}
+	ar.sum.Write(p)
+	return nil
+}
+
+// ReadByte reads one byte, for binary.ReadUvarint.
+func (ar *archiveReader) ReadByte() (byte, error) {
+	c, err := ar.r.ReadByte()
+	if err == nil {
+		ar.sum.Write([]byte{c})
+	}
+	return c, err
+}
+
+// record reads the next record's tag and, except for the end record, its
+// body.
+func (ar *archiveReader) record() (byte, []byte, error) {
+	tag := make([]byte, 1)
+	if err := ar.read(tag); err != nil {
+		return 0, nil, err
+	}
+	if tag[0] == archiveEnd {
+		return archiveEnd, nil, nil
+	}
+	n, err := binary.ReadUvarint(ar)
+	if err != nil || n > math.MaxInt32 {
+		return 0, nil, errArchiveCorrupt
+	}
+	body := make([]byte, n)
+	if err := ar.read(body); err != nil {
+		return 0, nil, err
+	}
+	return tag[0], body, nil
+}
+
+// archiveDecoder parses one record body. The first malformed read sets err
+// and makes every later read return zero values.
+type archiveDecoder struct {
+	b   []byte
+	err error
+}
+
+// fail records a parse error.
+func (d *archiveDecoder) fail() {
+	d.err, d.b = errArchiveCorrupt, nil
+}
+
+// uvarint reads an unsigned varint.
+func (d *archiveDecoder) uvarint() uint64 {
+	v, n := binary.Uvarint(d.b)
+	if n <= 0 {
+		d.fail()
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+// varint reads a signed varint.
+func (d *archiveDecoder) varint() int64 {
+	v, n := binary.Varint(d.b)
+	if n <= 0 {
+		d.fail()
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+// count reads an element count, refusing counts the body cannot hold.
+func (d *archiveDecoder) count() int {
+	n := d.uvarint()
+	if n > uint64(len(d.b)) {
+		d.fail() // Every element takes at least one byte.
+		return 0
+	}
+	return int(n)
+}
+
+// bytes reads n raw bytes.
+func (d *archiveDecoder) bytes(n int) []byte {
+	if n > len(d.b) {
+		d.fail()
+		return nil
+	}
+	p := d.b[:n]
+	d.b = d.b[n:]
+	return p
+}
+
+// string reads a length-prefixed string.
+func (d *archiveDecoder) string() string {
+	return string(d.bytes(d.count()))
+}
+
+// float reads a float64.
+func (d *archiveDecoder) float() float64 {
+	p := d.bytes(8)
+	if p == nil {
+		return 0
+	}
+	return math.Float64frombits(binary.BigEndian.Uint64(p))
+}
+
+// value reads a tagged value.
+func (d *archiveDecoder) value() (any, error) {
+	tag := d.bytes(1)
+	if tag == nil {
+		return nil, d.err
+	}
+	switch tag[0] {
+	case tagNil:
+		return nil, nil
+	case tagList:
+		items, err := d.values()
+		return List(items), err
+	case tagSlice:
+		return d.values()
+	case tagHash:
+		fields, err := d.fields()
+		return Hash(fields), err
+	case tagMap:
+		return d.fields()
+	case tagSet:
+		n := d.count()
+		set := make(Set, n)
+		for range n {
+			set[d.string()] = struct{}{}
+		}
+		return set, d.err
+	case tagZSet:
+		n := d.count()
+		z := newZSet()
+		for range n {
+			member := d.string()
+			z.add(member, d.float())
+		}
+		return z, d.err
+	case tagStream, tagGroups:
+		s := &Stream{LastID: StreamID{Ms: d.uvarint(), Seq: d.uvarint()}}
+		n := d.count()
+		s.Entries = make([]StreamEntry, 0, n)
+		for range n {
+			id := StreamID{Ms: d.uvarint(), Seq: d.uvarint()}
+			fields, err := d.fields()
+			if err != nil {
+				return nil, err
+			}
+			s.Entries = append(s.Entries, StreamEntry{ID: id, Fields: fields})
+		}
+		if tag[0] == tagGroups {
+			s.Groups = d.streamGroups()
+		}
+		return s, d.err
+	case tagHLL:
+		h := &HyperLogLog{Registers: []uint8(d.string())}
+		if d.err == nil && !h.valid() {
+			d.fail()
+		}
+		return h, d.err
+	case tagSerializer:
+		name, data := d.string(), d.string()
+		if d.err != nil {
+			return nil, d.err
+		}
+		s, ok := serializerNamed(name)
+		if !ok {
+			return nil, fmt.Errorf("value of unregistered serializer %q", name)
+		}
+		return s.unmarshal([]byte(data))
+	case tagRegistered:
+		name, data := d.string(), d.string()
+		if d.err != nil {
+			return nil, d.err
+		}
+		typ, ok := registeredType(name)
+		if !ok {
+			return nil, fmt.Errorf("value of unregistered type %q", name)
+		}
+		ptr := reflect.New(typ)
+		if err := json.Unmarshal([]byte(data), ptr.Interface()); err != nil {
+			return nil, fmt.Errorf("type %q: %w", name, err)
+		}
+		return ptr.Elem().Interface(), nil
+	case tagScalar:
+		return d.scalar()
+	}
+	return nil, fmt.Errorf("unknown value tag %q", tag[0])
+}
+
+// streamGroups reads consumer groups written by appendStreamGroups.
+func (d *archiveDecoder) streamGroups() map[string]*StreamGroup {
+	n := d.count()
+	groups := make(map[string]*StreamGroup, n)
+	for range n {
+		name := d.string()
+		g := &StreamGroup{LastDelivered: StreamID{Ms: d.uvarint(), Seq: d.uvarint()}}
+		pending := d.count()
+		g.Pending = make([]StreamPending, 0, pending)
+		for range pending {
+			id := StreamID{Ms: d.uvarint(), Seq: d.uvarint()}
+			consumer := d.string()
+			g.Pending = append(g.Pending, StreamPending{id, consumer, time.Unix(0, d.varint())})
+		}
+		groups[name] = g
+	}
+	return groups
+}
+
+// values reads a count and that many values.
+func (d *archiveDecoder) values() ([]any, error) {
+	n := d.count()
+	items := make([]any, n)
+	for i := range items {
+		v, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+		items[i] = v
+	}
+	return items, d.err
+}
+
+// fields reads a count and that many fields and values.
+func (d *archiveDecoder) fields() (map[string]any, error) {
+	n := d.count()
+	m := make(map[string]any, n)
+	for range n {
+		field := d.string()
+		v, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+		m[field] = v
+	}
+	return m, d.err
+}
+
+// scalar reads a built-in scalar written under its type name.
+func (d *archiveDecoder) scalar() (any, error) {
+	name := d.string()
+	typ, ok := jsonScalars[name]
+	if !ok {
+		if d.err != nil {
+			return nil, d.err
+		}
+		return nil, fmt.Errorf("unknown scalar type %q", name)
+	}
+	v := reflect.New(typ).Elem()
+	switch typ.Kind() {
+	case reflect.String:
+		v.SetString(d.string())
+	case reflect.Slice: // []byte
+		v.SetBytes([]byte(d.string()))
+	case reflect.Bool:
+		p := d.bytes(1)
+		v.SetBool(p != nil && p[0] == 1)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n := d.varint()
+		if v.OverflowInt(n) {
+			return nil, fmt.Errorf("%s value %d out of range", name, n)
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n := d.uvarint()
+		if v.OverflowUint(n) {
+			return nil, fmt.Errorf("%s value %d out of range", name, n)
+		}
+		v.SetUint(n)
+	default:
+		v.SetFloat(d.float())
+	}
+	return v.Interface(), d.err
+}
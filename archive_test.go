@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestArchiveRoundTrip(t *testing.T) {
+	const name = "test.ArchiveProfile"
+	t.Cleanup(func() { forgetType(name) })
+	RegisterType(name, oldProfile{})
+	var marshals, unmarshals int
+	registerPoint(t, &marshals, &unmarshals)
+
+	clock := NewFakeClock(time.Unix(1_000_000, 0))
+	src := NewDataBase(WithClock(clock))
+	defer src.Close()
+	zset := newZSet()
+	zset.add("ada", 1.5)
+	zset.add("bob", -2)
+	want := map[string]any{
+		"string":  "v",
+		"bytes":   []byte{0, 1, 2},
+		"int":     42,
+		"uint16":  uint16(7),
+		"float32": float32(0.25),
+		"bool":    true,
+		"profile": oldProfile{"ada", 36},
+		"point":   point{-3, 1 << 20},
+		"list":    List{"a", int64(2), oldProfile{"bob", 7}, point{1, 2}}, // Nested registered values too.
+		"hash":    Hash{"name": "ada", "age": int64(36)},
+		"set":     Set{"red": {}, "blue": {}},
+		"zset":    zset,
+		"nested":  []any{map[string]any{"k": []any{uint8(1), nil}}},
+	}
+	for key, value := range want {
+		src.Set(key, value)
+	}
+	src.XAdd("stream", map[string]any{"f": "v"})
+	src.SetWithTTL("ttl", "soon", time.Hour)
+	src.Set("func", func() {}) // No archive form.
+
+	var buf bytes.Buffer
+	var unencodable *UnencodableError
+	if err := src.Archive(&buf); !errors.As(err, &unencodable) || !slices.Equal(unencodable.Keys, []string{"func"}) {
+		t.Fatalf("Archive = %v, want an *UnencodableError naming func", err)
+	}
+	if marshals != 2 {
+		t.Errorf("the point serializer ran %d times, want once per point", marshals)
+	}
+	archive := buf.Bytes()
+
+	forgetType(name) // The next build renamed the type and added a field.
+	RegisterType(name, newProfile{})
+	want["profile"] = newProfile{Name: "ada", Age: 36}
+	want["list"] = List{"a", int64(2), newProfile{Name: "bob", Age: 7}, point{1, 2}}
+
+	db := NewDataBase(WithClock(clock))
+	defer db.Close()
+	if err := db.Restore(bytes.NewReader(archive)); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	for key, value := range want {
+		if got, _ := db.Get(key); !reflect.DeepEqual(got, value) {
+			t.Errorf("%s = %#v, want %#v", key, got, value)
+		}
+	}
+	stream, _ := db.Get("stream")
+	if s, ok := stream.(*Stream); !ok || len(s.Entries) != 1 || s.Entries[0].Fields["f"] != "v" {
+		t.Errorf("stream = %#v, want its one entry", stream)
+	}
+	if ttl := db.TTL("ttl"); ttl != time.Hour {
+		t.Errorf("TTL(ttl) = %v, want the hour kept", ttl)
+	}
+	if _, ok := db.Get("func"); ok {
+		t.Error("the unencodable key was restored")
+	}
+
+	fresh := NewDataBase()
+	defer fresh.Close()
+	damaged := bytes.Clone(archive)
+	damaged[len(damaged)/2] ^= 0xFF
+	if err := fresh.Restore(bytes.NewReader(damaged)); err == nil {
+		t.Error("Restore of a damaged archive succeeded")
+	}
+	if keys := fresh.Keys("*"); len(keys) != 0 {
+		t.Errorf("a damaged archive restored %q, want nothing", keys)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrQueueFull is returned by SetAsync and DeleteAsync when the write queue
+// has no room, so callers can back off instead of piling up writes.
+var ErrQueueFull = errors.New("async write queue is full")
+
+// asyncOp is one write waiting in the async queue.
+type asyncOp struct {
+	key    string
+	value  any
+	delete bool // Delete the key rather than set it.
+}
+
+// WithAsyncWrites enables SetAsync and DeleteAsync with a queue holding up
+// to size pending writes, drained by a single background goroutine. Without
+// it the async methods apply their writes synchronously.
+func WithAsyncWrites(size int) Option {
+	return func(db *DataBase) {
+		if size > 0 {
+			db.asyncQueue = make(chan asyncOp, size)
+		}
+	}
+}
+
+// SetAsync queues a Set of value at key and returns without waiting for it,
+// or returns ErrQueueFull if the queue (see WithAsyncWrites) is full. This
+// trades read-your-writes for throughput: until the background applier gets
+// to the write, reads, including the caller's own, still see the previous
+// value. Queued writes are applied in the order they were accepted, but a
+// synchronous Set of the same key may be overtaken by an earlier SetAsync
+// that is applied after it. Errors such as a *PolicyError or ErrOOM happen
+// when the write is applied, so they are logged rather than returned.
+func (db *DataBase) SetAsync(key string, value any) error {
+	return db.enqueue(asyncOp{key: key, value: value})
+}
+
+// DeleteAsync queues a Delete of key like SetAsync, with the same
+// visibility and ordering caveats.
+func (db *DataBase) DeleteAsync(key string) error {
+	return db.enqueue(asyncOp{key: key, delete: true})
+}
+
+// QueueDepth returns how many async writes are waiting to be applied.
+func (db *DataBase) QueueDepth() int {
+	return len(db.asyncQueue)
+}
+
+// enqueue hands op to the applier without blocking, or applies it directly
+// when async writes are not enabled. Once the database is read-only, new
+// writes are refused with ErrReadOnly.
+func (db *DataBase) enqueue(op asyncOp) error {
+	if db.asyncQueue == nil {
+		if op.delete {
+			db.Delete(op.key)
+			return nil
+		}
+		return db.Set(op.key, op.value)
+	}
+	db.lock.RLock() // Drain turns read-only under the write lock.
+	defer db.lock.RUnlock()
+	if db.readOnly {
+		return ErrReadOnly
+	}
+	select {
+	case db.asyncQueue <- op:
+		db.asyncPending.Add(1)
+		return nil
+	default:
+		return ErrQueueFull // Backpressure: the applier is behind.
+	}
+}
+
+// apply performs a queued write, even if the database has since turned
+// read-only, since the caller was told it was accepted.
+func (db *DataBase) apply(op asyncOp) error {
+	defer db.asyncPending.Add(-1)
+	if op.delete {
+		deleted := db.del(op.key, true)
+		db.audit.Load().record("del", op.key, nil, &deleted, nil)
+		return nil
+	}
+	err := db.set(op.key, op.value, true)
+	db.runSetHooks(context.Background(), op.key, op.value, err)
+	return err
+}
+
+// startApplier launches the goroutine that drains the async write queue.
+// On Close it applies whatever is still queued before returning; writes
+// queued after Close are never applied.
+func (db *DataBase) startApplier() {
+	db.spawn(func() {
+		for {
+			select {
+			case op := <-db.asyncQueue:
+				db.applyLogged(op)
+			case <-db.stop:
+				for {
+					select {
+					case op := <-db.asyncQueue:
+						db.applyLogged(op) // Don't lose accepted writes.
+					default:
+						return
+					}
+				}
+			}
+		}
+	})
+}
+
+// applyLogged applies op and logs a failure, as there is no caller left to
+// report it to.
+func (db *DataBase) applyLogged(op asyncOp) {
+	if err := db.apply(op); err != nil {
+		db.logger.Warn("async write failed", "key", op.key, "err", err)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+)
+
+func TestSetAsyncBackpressure(t *testing.T) {
+	db := NewDataBase(WithAsyncWrites(4))
+	defer db.Close()
+	applying, release := make(chan struct{}), make(chan struct{})
+	db.OnSet(func(_ context.Context, key string, _ any, _ error) {
+		if key == "block" {
+			close(applying)
+			<-release // Stall the applier so the queue fills.
+		}
+	})
+	if err := db.SetAsync("block", 0); err != nil {
+		t.Fatal(err)
+	}
+	<-applying
+
+	for i := range 4 {
+		if err := db.SetAsync("k"+strconv.Itoa(i), i); err != nil {
+			t.Fatalf("SetAsync %d of a queue of 4: %v", i, err)
+		}
+	}
+	if depth := db.QueueDepth(); depth != 4 {
+		t.Errorf("QueueDepth = %d, want 4", depth)
+	}
+	if err := db.SetAsync("over", 1); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("SetAsync on a full queue: %v, want ErrQueueFull", err)
+	}
+	if err := db.DeleteAsync("k0"); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("DeleteAsync on a full queue: %v, want ErrQueueFull", err)
+	}
+	if _, ok := db.Get("k0"); ok {
+		t.Error("a queued write was visible before it was applied")
+	}
+
+	close(release)
+	waitFor(t, "the queue to drain", func() bool { return db.QueueDepth() == 0 && db.asyncPending.Load() == 0 })
+	if n := db.Exists("block", "k0", "k1", "k2", "k3", "over"); n != 5 {
+		t.Errorf("%d of the keys exist after the drain, want the 5 accepted", n)
+	}
+	if err := db.SetAsync("over", 1); err != nil {
+		t.Errorf("SetAsync once the queue drained: %v", err)
+	}
+}
@@ -0,0 +1,603 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// At-rest file layout
+//
+// With WithAtRest, snapshots and append-only files are compressed and
+// encrypted on their way to storage, and decoded by what their headers
+// say on the way back, so one database reads every combination:
+//
+//	compressed: a gzip stream (RFC 1952), recognized by its magic 1f 8b
+//	encrypted:  "GOSEALED" version(1 byte) salt(16 bytes) chunk...
+//
+// A file that is both is compressed first, since ciphertext does not
+// compress: the plaintext of the encrypted file is the gzip stream. The
+// chunks of an encrypted file each seal up to 64 KiB with AES-GCM, under a
+// key derived for the file with HKDF-SHA256 from the configured key and the
+// file's random salt. A chunk's nonce is its index followed by a byte that
+// is 1 for the last chunk only, and the header is authenticated with every
+// chunk, so truncating, reordering or splicing chunks fails like any other
+// damage.
+//
+// Append-only files are written a record at a time and survive a crash
+// mid-record, which neither stream allows, so there the records are sealed
+// one by one instead (see aofCodec).
+const (
+	sealMagic   = "GOSEALED"
+	sealVersion = 1
+	sealSalt    = 16       // Bytes of salt in the header.
+	sealChunk   = 64 << 10 // Plaintext bytes per chunk.
+	sealInfo    = "goredis at-rest v1"
+)
+
+// gzipMagic starts every gzip stream.
+const gzipMagic = "\x1f\x8b"
+
+// ErrDecrypt is returned when loading an encrypted file whose contents do
+// not authenticate under the configured key: the key is wrong, or the file
+// was damaged or truncated after it was written.
+var ErrDecrypt = errors.New("at rest: wrong key or damaged file")
+
+// errNoKey reports an encrypted file read without a key.
+var errNoKey = errors.New("at rest: file is encrypted and no key is configured (see WithAtRest)")
+
+// Compression chooses how WithAtRest compresses files.
+type Compression int
+
+const (
+	NoCompression Compression = iota // Store files as they are.
+	Gzip                             // Compress snapshots with gzip and AOF records with DEFLATE.
+)
+
+// AtRestConfig holds the settings of WithAtRest.
+type AtRestConfig struct {
+	// Compression compresses snapshots and append-only files. zstd is not
+	// offered: it has no implementation in the standard library, which
+	// this module sticks to.
+	Compression Compression
+
+	// Key encrypts snapshots and append-only files with AES-GCM; it must
+	// be 16, 24 or 32 bytes, for AES-128, AES-192 or AES-256. Nil leaves
+	// files unencrypted. Files written with one key can only be read with
+	// it, so keep it somewhere safer than next to the files.
+	Key []byte
+}
+
+// enabled reports whether cfg changes how files are written.
+func (cfg AtRestConfig) enabled() bool {
+	return cfg.Compression != NoCompression || cfg.Key != nil
+}
+
+// Validate reports whether cfg can be used: a known compression and a key
+// of a valid length, if any.
+func (cfg AtRestConfig) Validate() error {
+	if cfg.Compression < NoCompression || cfg.Compression > Gzip {
+		return fmt.Errorf("%w: unknown compression %d", ErrInvalidConfig, int(cfg.Compression))
+	}
+	if cfg.Key != nil {
+		if _, err := aes.NewCipher(cfg.Key); err != nil {
+			return fmt.Errorf("%w: encryption key of %d bytes; need 16, 24 or 32", ErrInvalidConfig, len(cfg.Key))
+		}
+	}
+	return nil
+}
+
+// WithAtRest protects the files the database writes: snapshots saved
+// through its Backend, by Persist, BGSave, PersistJSON and the rest, and
+// the append-only file of EnableAOF, are compressed and encrypted as cfg
+// says. Loading detects how each file was written from its header, so
+// files written before the option was set, or with other settings, still
+// load, with or without the option, except that encrypted files need the
+// key. An existing append-only file in another format is rewritten in the
+// configured one when it is enabled. A cfg that Validate rejects makes
+// every save and load fail with its error, rather than write plaintext.
+// Memory-mapped snapshots (see OpenMMapped) need plain files, and
+// encrypted snapshots are compared with DataBase.DiffSnapshots.
+func WithAtRest(cfg AtRestConfig) Option {
+	return func(db *DataBase) {
+		if !cfg.enabled() {
+			db.atRest = nil
+			return
+		}
+		cfg.Key = bytes.Clone(cfg.Key) // The caller may reuse its slice.
+		db.atRest = &atRest{cfg: cfg, err: cfg.Validate()}
+	}
+}
+
+// atRest is the configuration set by WithAtRest.
+type atRest struct {
+	cfg AtRestConfig
+	err error // Why cfg is unusable, if it is.
+}
+
+// fileKey derives the AES-GCM cipher of one file from its salt.
+func fileKey(key, salt []byte) (cipher.AEAD, error) {
+	derived, err := hkdf.Key(sha256.New, key, salt, sealInfo, len(key))
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(derived)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// newSalt returns a random salt for a new file.
+func newSalt() []byte {
+	salt := make([]byte, sealSalt)
+	rand.Read(salt) // Never fails.
+	return salt
+}
+
+// atRestBackend applies an at-rest configuration to the snapshots of the
+// backend it wraps. NewDataBase installs it around every backend, so
+// compressed snapshots load without WithAtRest too, and encrypted ones fail
+// clearly rather than as garbage.
+type atRestBackend struct {
+	Backend
+	rest *atRest // Nil saves snapshots as they are.
+}
+
+// Save returns a writer that compresses and encrypts into the snapshot.
+// Sync finishes the streams before syncing, so a snapshot that was synced
+// is complete; Close commits it and Abort discards it, as for the wrapped
+// writer.
+func (b atRestBackend) Save(name string) (io.WriteCloser, error) {
+	if b.rest == nil {
+		return b.Backend.Save(name)
+	}
+	if b.rest.err != nil {
+		return nil, b.rest.err
+	}
+	file, err := b.Backend.Save(name)
+	if err != nil {
+		return nil, err
+	}
+	w := &atRestWriter{file: file, w: file}
+	if key := b.rest.cfg.Key; key != nil {
+		if w.seal, err = newSealWriter(w.w, key); err != nil {
+			abortSave(file)
+			return nil, err
+		}
+		w.w = w.seal
+	}
+	if b.rest.cfg.Compression == Gzip {
+		w.gz = gzip.NewWriter(w.w)
+		w.w = w.gz
+	}
+	return w, nil
+}
+
+// Load returns a reader that decodes the snapshot as its header says.
+func (b atRestBackend) Load(name string) (io.ReadCloser, error) {
+	var key []byte
+	if b.rest != nil {
+		if b.rest.err != nil {
+			return nil, b.rest.err
+		}
+		key = b.rest.cfg.Key
+	}
+	file, err := b.Backend.Load(name)
+	if err != nil {
+		return nil, err
+	}
+	r, err := openAtRest(file, key)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{r, file}, nil
+}
+
+// atRestWriter is a snapshot being written by atRestBackend.
+type atRestWriter struct {
+	file     io.WriteCloser // The wrapped backend's writer.
+	w        io.Writer      // Where Write goes: the top of the chain.
+	gz       *gzip.Writer   // Nil without compression.
+	seal     *sealWriter    // Nil without a key.
+	finished bool
+	err      error // From finishing the streams.
+}
+
+// Write implements io.Writer.
+func (w *atRestWriter) Write(p []byte) (int, error) {
+	return w.w.Write(p)
+}
+
+// finish writes the ends of the streams, once.
+func (w *atRestWriter) finish() error {
+	if w.finished {
+		return w.err
+	}
+	w.finished = true
+	if w.gz != nil {
+		w.err = w.gz.Close() // Does not close what it writes to.
+	}
+	if w.seal != nil && w.err == nil {
+		w.err = w.seal.close()
+	}
+	return w.err
+}
+
+// Sync finishes the streams and syncs the snapshot.
+func (w *atRestWriter) Sync() error {
+	if err := w.finish(); err != nil {
+		return err
+	}
+	return syncFile(w.file)
+}
+
+// Close finishes the streams and commits the snapshot, or discards it if
+// they could not be finished.
+func (w *atRestWriter) Close() error {
+	if err := w.finish(); err != nil {
+		abortSave(w.file)
+		return err
+	}
+	return w.file.Close()
+}
+
+// Abort discards the snapshot.
+func (w *atRestWriter) Abort() error {
+	w.finished = true // Nothing more is written.
+	abortSave(w.file)
+	return nil
+}
+
+// openAtRest returns a reader of the plain contents of a file, undoing the
+// encryption and compression its headers announce. Plain files are read as
+// they are.
+func openAtRest(r io.Reader, key []byte) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	if header, err := br.Peek(len(sealMagic)); err == nil && string(header) == sealMagic {
+		if key == nil {
+			return nil, errNoKey
+		}
+		sr, err := newSealReader(br, key)
+		if err != nil {
+			return nil, err
+		}
+		br = bufio.NewReader(sr)
+	}
+	header, err := br.Peek(len(gzipMagic))
+	if err == nil && string(header) == gzipMagic {
+		return gzip.NewReader(br)
+	}
+	if err != nil && err != io.EOF {
+		return nil, err // Such as ErrDecrypt for the first chunk.
+	}
+	return br, nil
+}
+
+// sealWriter encrypts a stream into chunks. Close must be called to write
+// the last chunk.
+type sealWriter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	header  []byte // Authenticated with every chunk.
+	pending []byte // Plaintext of the next chunk.
+	sealed  []byte // Reused for the ciphertext.
+	index   uint64 // Of the next chunk.
+}
+
+// newSealWriter writes the header of an encrypted file, with a new salt,
+// and returns a writer for its contents.
+func newSealWriter(w io.Writer, key []byte) (*sealWriter, error) {
+	salt := newSalt()
+	aead, err := fileKey(key, salt)
+	if err != nil {
+		return nil, err
+	}
+	header := append(append([]byte(sealMagic), sealVersion), salt...)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return &sealWriter{w: w, aead: aead, header: header, pending: make([]byte, 0, sealChunk)}, nil
+}
+
+// Write implements io.Writer. A full chunk is only sealed once more data
+// follows, since the last chunk is sealed differently.
+func (s *sealWriter) Write(p []byte) (int, error) {
+	written := len(p)
+	for len(p) > 0 {
+		if len(s.pending) == sealChunk {
+			if err := s.flush(false); err != nil {
+				return written - len(p), err
+			}
+		}
+		n := min(len(p), sealChunk-len(s.pending))
+		s.pending = append(s.pending, p[:n]...)
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// flush seals and writes the pending chunk.
+func (s *sealWriter) flush(last bool) error {
+	s.sealed = s.aead.Seal(s.sealed[:0], chunkNonce(s.index, last), s.pending, s.header)
+	s.index++
+	s.pending = s.pending[:0]
+	_, err := s.w.Write(s.sealed)
+	return err
+}
+
+// close writes the last chunk, which may be empty.
+func (s *sealWriter) close() error {
+	return s.flush(true)
+}
+
+// chunkNonce returns the nonce of a chunk: its index, then 1 for the last
+// chunk and 0 for the others.
+func chunkNonce(index uint64, last bool) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce[3:11], index)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+// sealReader decrypts a stream written by sealWriter.
+type sealReader struct {
+	r      *bufio.Reader
+	aead   cipher.AEAD
+	header []byte
+	chunk  []byte // Reused for the ciphertext.
+	plain  []byte // Decrypted and not yet read.
+	index  uint64 // Of the next chunk.
+	done   bool   // The last chunk has been read.
+	err    error  // Sticky, so a failed chunk is never skipped.
+}
+
+// newSealReader reads the header of an encrypted file and returns a reader
+// of its contents.
+func newSealReader(r *bufio.Reader, key []byte) (*sealReader, error) {
+	header := make([]byte, len(sealMagic)+1+sealSalt)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, ErrDecrypt
+	}
+	if v := header[len(sealMagic)]; v != sealVersion {
+		return nil, fmt.Errorf("at rest: unsupported version %d", v)
+	}
+	aead, err := fileKey(key, header[len(sealMagic)+1:])
+	if err != nil {
+		return nil, err
+	}
+	return &sealReader{r: r, aead: aead, header: header, chunk: make([]byte, sealChunk+aead.Overhead())}, nil
+}
+
+// Read implements io.Reader.
+func (s *sealReader) Read(p []byte) (int, error) {
+	for len(s.plain) == 0 {
+		if s.err != nil {
+			return 0, s.err
+		}
+		if s.done {
+			return 0, io.EOF
+		}
+		s.err = s.next()
+	}
+	n := copy(p, s.plain)
+	s.plain = s.plain[n:]
+	return n, nil
+}
+
+// next decrypts the following chunk. A chunk is the last one if it is
+// short or nothing follows it; a stream that stops before its last chunk
+// fails to authenticate.
+func (s *sealReader) next() error {
+	n, err := io.ReadFull(s.r, s.chunk)
+	switch {
+	case err == io.ErrUnexpectedEOF:
+		s.done = true // A short chunk.
+	case err == io.EOF:
+		return ErrDecrypt // The last chunk is missing.
+	case err != nil:
+		return err
+	default:
+		if _, err := s.r.Peek(1); err == io.EOF {
+			s.done = true
+		}
+	}
+	plain, err := s.aead.Open(s.chunk[:0], chunkNonce(s.index, s.done), s.chunk[:n], s.header)
+	if err != nil {
+		return ErrDecrypt
+	}
+	s.index++
+	s.plain = plain
+	return nil
+}
+
+// aofCodec seals the records of an append-only file written in the
+// at-rest format, which is version 2 of the AOF header:
+//
+//	header: "REDISAOF" 2 flags(1 byte) [salt(16 bytes)]
+//	record: frame(stored)
+//
+// The salt is present if flags has bit 1 set, for an encrypted file. Each
+// record's body, as written to the frame of version 1, is first prefixed
+// with 1 and DEFLATE-compressed if flags has bit 0 set and that makes it
+// smaller, or prefixed with 0 otherwise; then, if encrypted, it is sealed
+// with AES-GCM under a random nonce written before it. The frame's
+// checksum covers the stored bytes, so a torn last record is found and
+// dropped before anything is decrypted. Random nonces stay safe for
+// billions of records per file, and a file is rewritten with a new salt
+// long before that (see RewriteAOF).
+type aofCodec struct {
+	compress bool
+	aead     cipher.AEAD // Nil for an unencrypted file.
+	salt     []byte
+}
+
+// AOF header flags of version 2.
+const (
+	aofFlagCompressed = 1 << 0
+	aofFlagEncrypted  = 1 << 1
+)
+
+// aofCodecVersion is the AOF header version of files with a codec.
+const aofCodecVersion = 2
+
+// newAOFCodec returns the codec of a new append-only file, or nil if the
+// configuration leaves its records as they are.
+func (r *atRest) newAOFCodec() (*aofCodec, error) {
+	if r == nil {
+		return nil, nil
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	c := &aofCodec{compress: r.cfg.Compression == Gzip}
+	if r.cfg.Key != nil {
+		c.salt = newSalt()
+		var err error
+		if c.aead, err = fileKey(r.cfg.Key, c.salt); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// matches reports whether records written with c are in the format the
+// configuration asks for. A nil codec is the plain format.
+func (c *aofCodec) matches(r *atRest) bool {
+	if r == nil {
+		return c == nil
+	}
+	return c != nil && c.compress == (r.cfg.Compression == Gzip) && (c.aead != nil) == (r.cfg.Key != nil)
+}
+
+// header returns the file header for records written with c.
+func (c *aofCodec) header() []byte {
+	if c == nil {
+		return append([]byte(aofMagic), aofVersion)
+	}
+	var flags byte
+	if c.compress {
+		flags |= aofFlagCompressed
+	}
+	if c.aead != nil {
+		flags |= aofFlagEncrypted
+	}
+	return append(append([]byte(aofMagic), aofCodecVersion, flags), c.salt...)
+}
+
+// readAOFHeader reads the header of an append-only file and returns the
+// codec of its records, nil for version 1.
+func readAOFHeader(r io.Reader, rest *atRest) (*aofCodec, error) {
+	header := make([]byte, len(aofMagic)+1)
+	if _, err := io.ReadFull(r, header); err != nil || string(header[:len(aofMagic)]) != aofMagic {
+		return nil, errors.New("not an append-only file")
+	}
+	switch v := header[len(aofMagic)]; v {
+	case aofVersion:
+		return nil, nil
+	case aofCodecVersion:
+	default:
+		return nil, fmt.Errorf("unsupported version %d", v)
+	}
+	var flags [1]byte
+	if _, err := io.ReadFull(r, flags[:]); err != nil {
+		return nil, errAOFCorrupt
+	}
+	c := &aofCodec{compress: flags[0]&aofFlagCompressed != 0}
+	if flags[0]&aofFlagEncrypted == 0 {
+		return c, nil
+	}
+	if rest == nil || rest.cfg.Key == nil {
+		return nil, errNoKey
+	}
+	if rest.err != nil {
+		return nil, rest.err
+	}
+	c.salt = make([]byte, sealSalt)
+	if _, err := io.ReadFull(r, c.salt); err != nil {
+		return nil, errAOFCorrupt
+	}
+	var err error
+	c.aead, err = fileKey(rest.cfg.Key, c.salt)
+	return c, err
+}
+
+// encode returns the stored form of a record body.
+func (c *aofCodec) encode(body []byte) []byte {
+	stored := append([]byte{0}, body...)
+	if c.compress {
+		buf := getBuffer()
+		w := flateWriters.Get().(*flate.Writer)
+		w.Reset(buf)
+		w.Write(body) // Writes to a bytes.Buffer do not fail.
+		w.Close()
+		flateWriters.Put(w)
+		if buf.Len()+1 < len(stored) {
+			stored = append([]byte{1}, buf.Bytes()...)
+		}
+		putBuffer(buf)
+	}
+	if c.aead == nil {
+		return stored
+	}
+	nonce := make([]byte, c.aead.NonceSize(), c.aead.NonceSize()+len(stored)+c.aead.Overhead())
+	rand.Read(nonce) // Never fails.
+	return c.aead.Seal(nonce, nonce, stored, nil)
+}
+
+// decode reverses encode.
+func (c *aofCodec) decode(stored []byte) ([]byte, error) {
+	if c.aead != nil {
+		size := c.aead.NonceSize()
+		if len(stored) < size {
+			return nil, ErrDecrypt
+		}
+		var err error
+		if stored, err = c.aead.Open(nil, stored[:size], stored[size:], nil); err != nil {
+			return nil, ErrDecrypt
+		}
+	}
+	if len(stored) == 0 {
+		return nil, errAOFCorrupt
+	}
+	switch stored[0] {
+	case 0:
+		return stored[1:], nil
+	case 1:
+		body, err := io.ReadAll(flate.NewReader(bytes.NewReader(stored[1:])))
+		if err != nil {
+			return nil, errAOFCorrupt
+		}
+		return body, nil
+	}
+	return nil, errAOFCorrupt
+}
+
+// reframe returns the frames of buf, as appendAOFRecord writes them, with
+// each body encoded by c.
+func (c *aofCodec) reframe(buf []byte) []byte {
+	out := make([]byte, 0, len(buf))
+	for len(buf) > 0 {
+		n, size := binary.Uvarint(buf)
+		body := buf[size : size+int(n)]
+		out = appendAOFFrame(out, c.encode(body))
+		buf = buf[size+int(n)+4:] // Past the body and its checksum.
+	}
+	return out
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// auditBacklog is how many audit records may wait for the writer before
+// the operations producing them wait too.
+const auditBacklog = 1024
+
+// auditRecord is one line of the audit log.
+type auditRecord struct {
+	Time  time.Time       `json:"time"`
+	Op    string          `json:"op"` // "get", "set" or "del".
+	Key   string          `json:"key"`
+	Found *bool           `json:"found,omitempty"` // Whether a get hit or a del removed the key.
+	Value json.RawMessage `json:"value,omitempty"` // Only with includeValues.
+	Error string          `json:"error,omitempty"` // A failed set's error.
+}
+
+// auditLog queues records for the goroutine started by EnableAuditLog.
+type auditLog struct {
+	records       chan auditRecord
+	includeValues bool
+	stop          <-chan struct{} // The database's; closed by Close.
+}
+
+// EnableAuditLog writes a JSON line to w for every Get, GetCtx, Set, SetCtx,
+// SetAsync, Delete and DeleteAsync, recording the time, the operation, the
+// key, whether a read found its key or a delete removed one, and with
+// includeValues the value read or written. Unlike snapshots, which exist for
+// recovery, the log records reads too and is meant to be read by people.
+// Other methods are not logged. Calling it again switches to the new
+// writer.
+//
+// Records are written by a background goroutine through a buffer that is
+// flushed whenever no more records are waiting and when Close is called, so
+// operations never wait for w while holding the database lock; they wait
+// only if the writer falls more than auditBacklog records behind. Values that
+// cannot be encoded as JSON are logged with their fmt representation, and
+// write errors are logged and otherwise ignored.
+func (db *DataBase) EnableAuditLog(w io.Writer, includeValues bool) {
+	log := &auditLog{records: make(chan auditRecord, auditBacklog), includeValues: includeValues, stop: db.stop}
+	db.spawn(func() { db.writeAudit(bufio.NewWriter(w), log.records) })
+	db.audit.Store(log)
+}
+
+// record queues a record, unless the log is nil. value is logged only with
+// includeValues.
+func (log *auditLog) record(op, key string, value any, found *bool, err error) {
+	if log == nil {
+		return
+	}
+	r := auditRecord{Time: time.Now(), Op: op, Key: key, Found: found}
+	if log.includeValues && value != nil {
+		r.Value = encodeAuditValue(value) // Now, before the value can change.
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	select {
+	case log.records <- r:
+		return
+	default: // The writer is behind.
+	}
+	select {
+	case log.records <- r:
+	case <-log.stop: // Closed: the writer may be gone.
+	}
+}
+
+// encodeAuditValue encodes a value for the audit log, falling back to its
+// fmt representation if it is not JSON-encodable.
+func encodeAuditValue(value any) json.RawMessage {
+	if b, err := json.Marshal(value); err == nil {
+		return b
+	}
+	b, _ := json.Marshal(fmt.Sprint(value))
+	return b
+}
+
+// writeAudit writes records to bw until Close, then drains the ones still
+// waiting and flushes.
+func (db *DataBase) writeAudit(bw *bufio.Writer, records <-chan auditRecord) {
+	flush := func() {
+		if err := bw.Flush(); err != nil {
+			db.logger.Error("audit log write failed", "err", err)
+		}
+	}
+	write := func(r auditRecord) {
+		line, _ := json.Marshal(r)   // Every field is already encodable.
+		bw.Write(append(line, '\n')) // Errors stick to bw and surface on flush.
+	}
+	for {
+		select {
+		case r := <-records:
+			write(r)
+			if len(records) == 0 {
+				flush()
+			}
+		case <-db.stop:
+			for {
+				select {
+				case r := <-records:
+					write(r)
+				default:
+					flush()
+					return // Drained.
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// readAudit decodes the lines of an audit log.
+func readAudit(t *testing.T, log string) []auditRecord {
+	t.Helper()
+	var records []auditRecord
+	sc := bufio.NewScanner(strings.NewReader(log))
+	for sc.Scan() {
+		var r auditRecord
+		if err := json.Unmarshal(sc.Bytes(), &r); err != nil {
+			t.Fatalf("audit line %q: %v", sc.Text(), err)
+		}
+		records = append(records, r)
+	}
+	return records
+}
+
+func TestAuditLogRecordsOperations(t *testing.T) {
+	var log lockedBuffer
+	db := NewDataBase()
+	db.SetPrefixPolicy("num:", Policy{Types: []string{"int"}})
+	db.EnableAuditLog(&log, true)
+	db.Set("user:1", "ada")
+	db.Get("user:1")
+	db.Get("missing")
+	db.Set("num:1", "not a number")
+	db.Delete("user:1")
+	db.Delete("user:1")
+	db.Keys("*") // Not logged.
+	db.Close()   // Flushes the log.
+
+	yes, no := true, false
+	want := []auditRecord{
+		{Op: "set", Key: "user:1", Value: json.RawMessage(`"ada"`)},
+		{Op: "get", Key: "user:1", Found: &yes, Value: json.RawMessage(`"ada"`)},
+		{Op: "get", Key: "missing", Found: &no},
+		{Op: "set", Key: "num:1", Value: json.RawMessage(`"not a number"`)},
+		{Op: "del", Key: "user:1", Found: &yes},
+		{Op: "del", Key: "user:1", Found: &no},
+	}
+	records := readAudit(t, log.String())
+	if len(records) != len(want) {
+		t.Fatalf("audit log has %d records, want %d:\n%s", len(records), len(want), log.String())
+	}
+	for i, r := range records {
+		w := want[i]
+		if r.Op != w.Op || r.Key != w.Key || string(r.Value) != string(w.Value) ||
+			(r.Found == nil) != (w.Found == nil) || (r.Found != nil && *r.Found != *w.Found) {
+			t.Errorf("record %d = %+v, want %+v", i, r, w)
+		}
+		if r.Time.IsZero() || (i > 0 && r.Time.Before(records[i-1].Time)) {
+			t.Errorf("record %d at %v, want timestamps in order", i, r.Time)
+		}
+	}
+	if records[3].Error == "" {
+		t.Error("the refused set logged no error")
+	}
+
+	var quiet lockedBuffer
+	db = NewDataBase()
+	db.EnableAuditLog(&quiet, false)
+	db.Set("secret", "hunter2")
+	db.Close()
+	if records := readAudit(t, quiet.String()); len(records) != 1 || records[0].Value != nil {
+		t.Errorf("audit log without values = %+v, want one record and no value", records)
+	}
+}
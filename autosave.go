@@ -0,0 +1,189 @@
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+// defaultSaveInterval is how often SaveEvery saves a store that has changes
+// but has not reached its change threshold.
+const defaultSaveInterval = 5 * time.Minute
+
+// maxSavePoll is the longest the saver waits between checks of its rules.
+const maxSavePoll = time.Second
+
+// SaveRule is one condition for automatic saving, like a Redis save
+// directive: save once at least Changes writes have been made and After
+// has passed since the last save. "save 900 1" is SaveRule{900 * time.Second, 1}.
+type SaveRule struct {
+	After   time.Duration // Time since the last save, or since NewDataBase if there has been none.
+	Changes int           // Writes since the last save.
+}
+
+// saveSchedule is what SaveRules and SaveEvery configure.
+type saveSchedule struct {
+	rules    []SaveRule
+	fileName string // Snapshot to write.
+	kickAt   int64  // Fewest changes of a rule without a wait; 0 if there is none.
+}
+
+// WithSaveInterval sets how often SaveEvery saves a store with pending
+// changes below the threshold. The default is five minutes.
+func WithSaveInterval(interval time.Duration) Option {
+	return func(db *DataBase) {
+		if interval > 0 {
+			db.saveInterval = interval
+		}
+	}
+}
+
+// SaveEvery makes the database save itself to fileName in the background,
+// with BGSave, once changes writes have accumulated since the last save, like
+// the Redis save directive. So that a quiet store is not left unsaved, it
+// also saves once the save interval (see WithSaveInterval) has passed since
+// the last save with at least one unsaved change. Every successful save,
+// including an explicit Persist or BGSave, resets the count. SaveEvery is
+// shorthand for those two SaveRules; calling either again replaces the
+// rules, and changes of zero or less turns automatic saving off.
+//
+// If saves keep failing, a breaker pauses automatic saving for a while
+// instead of retrying on every write (see WithSaveBreaker and
+// PersistenceState).
+func (db *DataBase) SaveEvery(changes int, fileName string) {
+	if changes <= 0 {
+		db.SaveRules(fileName)
+		return
+	}
+	db.SaveRules(fileName, SaveRule{Changes: changes}, SaveRule{After: db.saveInterval, Changes: 1})
+}
+
+// SaveRules makes the database save itself to fileName in the background,
+// with BGSave, as soon as any one of rules holds, like a list of Redis save
+// directives. The Redis defaults, for example, are
+//
+//	db.SaveRules("dump.gob",
+//		SaveRule{After: time.Hour, Changes: 1},
+//		SaveRule{After: 5 * time.Minute, Changes: 100},
+//		SaveRule{After: time.Minute, Changes: 10000})
+//
+// The rules are checked at least once a second, and at once on the write
+// that completes a rule without an After. Every successful save, including
+// an explicit Persist or BGSave, resets both the change count and the time
+// since the last save. Calling SaveRules again replaces the rules, and no
+// rules turn automatic saving off. Rules with Changes of zero or less are
+// ignored. Failing saves are paused by a breaker as described at SaveEvery.
+func (db *DataBase) SaveRules(fileName string, rules ...SaveRule) {
+	sched := &saveSchedule{fileName: fileName}
+	for _, rule := range rules {
+		if rule.Changes <= 0 {
+			continue
+		}
+		sched.rules = append(sched.rules, rule)
+		if rule.After <= 0 && (sched.kickAt == 0 || int64(rule.Changes) < sched.kickAt) {
+			sched.kickAt = int64(rule.Changes)
+		}
+	}
+	db.lock.Lock()         // Acquire a write lock.
+	defer db.lock.Unlock() // Release the lock when the function exits.
+	if len(sched.rules) == 0 {
+		db.saveSchedule = nil
+		return
+	}
+	db.saveSchedule = sched
+	if !db.saverStarted {
+		db.saverStarted = true
+		db.startSaver()
+	}
+}
+
+// due reports whether one of the rules holds with dirty unsaved changes
+// and since passed since the last save.
+func (s *saveSchedule) due(dirty int64, since time.Duration) bool {
+	for _, rule := range s.rules {
+		if dirty >= int64(rule.Changes) && since >= rule.After {
+			return true
+		}
+	}
+	return false
+}
+
+// poll returns how long the saver waits before checking s again: the
+// shortest After among its rules, capped at maxSavePoll.
+func (s *saveSchedule) poll() time.Duration {
+	wait := maxSavePoll
+	for _, rule := range s.rules {
+		if rule.After > 0 && rule.After < wait {
+			wait = rule.After
+		}
+	}
+	return wait
+}
+
+// sinceSave returns the time since the last successful save, or since the
+// database was created if there has been none.
+func (db *DataBase) sinceSave() time.Duration {
+	last := db.started
+	if saved := db.lastSave.Load(); saved != 0 {
+		last = time.Unix(0, saved)
+	}
+	return db.clock.Now().Sub(last)
+}
+
+// changed counts a write towards the save rules and wakes the saver once
+// one without a wait holds. The caller must hold the write lock.
+func (db *DataBase) changed() {
+	dirty := db.dirty.Add(1)
+	db.writes.Add(1)
+	if db.saveSchedule != nil && db.saveSchedule.kickAt > 0 && dirty >= db.saveSchedule.kickAt {
+		select {
+		case db.saveKick <- struct{}{}:
+		default: // A save is already pending.
+		}
+	}
+}
+
+// saveFailed reports whether a save error means no snapshot was written. A
+// snapshot that merely skipped unencodable values still counts as a save.
+func saveFailed(err error) bool {
+	var unencodable *UnencodableError
+	return err != nil && !errors.As(err, &unencodable)
+}
+
+// startSaver launches the goroutine that performs SaveRules saves.
+// It stops when Close is called.
+func (db *DataBase) startSaver() {
+	db.spawn(func() {
+		timer := time.NewTimer(maxSavePoll)
+		defer timer.Stop()
+		for {
+			db.lock.RLock()
+			sched := db.saveSchedule
+			db.lock.RUnlock()
+			wait := maxSavePoll
+			if sched != nil {
+				wait = sched.poll()
+			}
+			timer.Reset(wait)
+			select {
+			case <-db.saveKick: // A rule without a wait was reached.
+			case <-timer.C:
+			case <-db.stop:
+				return // Close was called.
+			}
+			db.lock.RLock()
+			sched = db.saveSchedule
+			db.lock.RUnlock()
+			if sched == nil || !sched.due(db.dirty.Load(), db.sinceSave()) || !db.breaker.allow() {
+				continue // Off, not yet due, or paused after repeated failures.
+			}
+			err := <-db.BGSave(sched.fileName) // BGSave logs the outcome.
+			if errors.Is(err, ErrSaveInProgress) {
+				continue // Says nothing about the disk.
+			}
+			if db.breaker.record(saveFailed(err)) {
+				db.logger.Error("automatic saves paused after repeated failures", "file", sched.fileName,
+					"failures", db.breaker.limit, "cooldown", db.breaker.cooldown, "err", err)
+			}
+		}
+	})
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSaveEveryThreshold(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1_000_000, 0))
+	db := NewDataBase(WithClock(clock), WithSaveInterval(time.Minute))
+	defer db.Close()
+	fileName := filepath.Join(t.TempDir(), "database.gob")
+	db.SaveEvery(5, fileName)
+
+	for i := range 4 {
+		db.Set("key", i)
+	}
+	time.Sleep(50 * time.Millisecond) // No rule holds, so nothing is saved.
+	if _, err := os.Stat(fileName); !os.IsNotExist(err) {
+		t.Fatalf("saved after 4 of 5 changes: %v", err)
+	}
+	db.Set("key", 4)
+	waitFor(t, "the save on the fifth change", func() bool {
+		return db.lastSave.Load() == clock.Now().UnixNano()
+	})
+	if dirty := db.dirty.Load(); dirty != 0 {
+		t.Errorf("%d changes count towards the next save, want 0", dirty)
+	}
+	saved := NewDataBase()
+	defer saved.Close()
+	if err := saved.Load(fileName); err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := saved.Get("key"); value != 4 {
+		t.Errorf("saved key = %v, want the fifth change's 4", value)
+	}
+
+	db.Set("quiet", 1) // One change, well below the threshold...
+	clock.Advance(time.Minute)
+	waitFor(t, "the save once the interval passed", func() bool { // ...saved by the checks each second.
+		return db.lastSave.Load() == clock.Now().UnixNano()
+	})
+}
+
+func TestSaveScheduleDue(t *testing.T) {
+	sched := &saveSchedule{rules: []SaveRule{{900 * time.Second, 1}, {300 * time.Second, 10}, {60 * time.Second, 10000}}}
+	for _, tc := range []struct {
+		dirty int64
+		since time.Duration
+		want  bool
+	}{
+		{0, time.Hour, false}, // Nothing to save.
+		{1, 899 * time.Second, false},
+		{1, 900 * time.Second, true},
+		{9, 600 * time.Second, false},
+		{10, 300 * time.Second, true},
+		{10000, time.Minute, true},
+		{9999, 299 * time.Second, false},
+	} {
+		if got := sched.due(tc.dirty, tc.since); got != tc.want {
+			t.Errorf("due(%d changes, %v) = %v, want %v", tc.dirty, tc.since, got, tc.want)
+		}
+	}
+	if wait := sched.poll(); wait != maxSavePoll {
+		t.Errorf("poll = %v, want the cap %v", wait, maxSavePoll)
+	}
+	if wait := (&saveSchedule{rules: []SaveRule{{After: 100 * time.Millisecond, Changes: 1}}}).poll(); wait != 100*time.Millisecond {
+		t.Errorf("poll = %v, want the shortest After", wait)
+	}
+}
+
+func TestSaveRules(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1_000_000, 0))
+	db := NewDataBase(WithClock(clock))
+	defer db.Close()
+	fileName := filepath.Join(t.TempDir(), "database.gob")
+	db.SaveRules(fileName, SaveRule{15 * time.Minute, 1}, SaveRule{time.Minute, 100}, SaveRule{0, 0})
+	saved := func() bool { return db.lastSave.Load() == clock.Now().UnixNano() }
+
+	db.Set("k", 0)
+	clock.Advance(time.Minute)
+	time.Sleep(maxSavePoll + 200*time.Millisecond) // One check: neither rule holds yet.
+	if _, err := os.Stat(fileName); !os.IsNotExist(err) {
+		t.Fatalf("saved with 1 change after a minute: %v", err)
+	}
+	for i := range 99 {
+		db.Set("k", i+1)
+	}
+	waitFor(t, "the save once 100 changes were made in a minute", saved)
+
+	db.Set("k", "quiet")
+	clock.Advance(15 * time.Minute)
+	waitFor(t, "the save of 1 change after 15 minutes", saved)
+
+	db.SaveRules(fileName) // No rules: automatic saving stops.
+	db.Set("k", "unsaved")
+	clock.Advance(time.Hour)
+	time.Sleep(maxSavePoll + 200*time.Millisecond)
+	if saved() {
+		t.Error("saved after the rules were removed")
+	}
+	if dirty := db.dirty.Load(); dirty != 1 {
+		t.Errorf("%d unsaved changes, want 1", dirty)
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Backend abstracts where snapshots are stored, decoupling the storage
+// location from the serialization format. Persist writes to the writer
+// returned by Save and treats a successful Close as the commit point; Load
+// reads from the reader returned by Load. A writer may also have an
+// Abort() error method, which Persist calls instead of Close when a save
+// fails so that the previous snapshot is kept.
+type Backend interface {
+	Save(name string) (io.WriteCloser, error)
+	Load(name string) (io.ReadCloser, error)
+}
+
+// syncFile flushes a snapshot to stable storage if its writer supports it,
+// as the *os.File returned by FileBackend does, so that a save that returned
+// survives a crash.
+func syncFile(w io.Writer) error {
+	if s, ok := w.(interface{ Sync() error }); ok {
+		return s.Sync()
+	}
+	return nil
+}
+
+// abortSave discards a snapshot whose save failed, through Abort if the
+// writer has one and otherwise by closing it. It does nothing once the
+// snapshot has been committed.
+func abortSave(w io.WriteCloser) {
+	if a, ok := w.(interface{ Abort() error }); ok {
+		a.Abort()
+		return
+	}
+	w.Close()
+}
+
+// FileBackend stores snapshots as files on the local filesystem.
+// Names are used as file paths. It is the default backend.
+type FileBackend struct{}
+
+// Save creates a temporary file next to the named one. Closing it renames
+// it over the named file, so a crash or failure during a save leaves the
+// previous snapshot intact, and a reader never sees a partial one. The
+// snapshot is created with mode 0600, readable by its owner alone.
+func (FileBackend) Save(name string) (io.WriteCloser, error) {
+	file, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".tmp-*")
+	if err != nil {
+		return nil, err
+	}
+	return &atomicFile{File: file, name: name}, nil
+}
+
+// atomicFile is a snapshot being written by FileBackend.
+type atomicFile struct {
+	*os.File
+	name string // The snapshot the file replaces on Close.
+	done bool   // Committed or aborted; later calls are no-ops.
+}
+
+// Close closes the temporary file and renames it over the snapshot.
+func (f *atomicFile) Close() error {
+	if f.done {
+		return nil
+	}
+	f.done = true
+	if err := f.File.Close(); err != nil {
+		os.Remove(f.File.Name())
+		return err
+	}
+	if err := os.Rename(f.File.Name(), f.name); err != nil {
+		os.Remove(f.File.Name())
+		return err
+	}
+	return nil
+}
+
+// Abort closes and removes the temporary file, leaving the snapshot as it
+// was.
+func (f *atomicFile) Abort() error {
+	if f.done {
+		return nil
+	}
+	f.done = true
+	f.File.Close()
+	return os.Remove(f.File.Name())
+}
+
+// Load opens the named file for reading.
+func (FileBackend) Load(name string) (io.ReadCloser, error) {
+	return os.Open(name)
+}
+
+// MemoryBackend keeps snapshots in memory, which is handy for tests and for
+// short-lived copies of a database. It is safe for concurrent use.
+type MemoryBackend struct {
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+// NewMemoryBackend returns an empty in-memory backend.
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{files: make(map[string][]byte)}
+}
+
+// Save returns a writer whose contents replace the named snapshot on Close.
+// Until then, readers keep seeing the previous version.
+func (m *MemoryBackend) Save(name string) (io.WriteCloser, error) {
+	return &memoryFile{backend: m, name: name}, nil
+}
+
+// Load returns a reader over the named snapshot, or os.ErrNotExist.
+func (m *MemoryBackend) Load(name string) (io.ReadCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.files[name]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil // Stored slices are never mutated.
+}
+
+// Bytes returns a copy of the named snapshot's contents.
+func (m *MemoryBackend) Bytes(name string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.files[name]
+	return bytes.Clone(data), ok
+}
+
+// memoryFile buffers a snapshot being written to a MemoryBackend.
+type memoryFile struct {
+	bytes.Buffer
+	backend *MemoryBackend
+	name    string
+	closed  bool // Later calls to Close are no-ops.
+}
+
+// Abort drops the buffered contents, keeping the previous version.
+func (f *memoryFile) Abort() error {
+	f.closed = true
+	return nil
+}
+
+// Close publishes the buffered contents under the file's name.
+func (f *memoryFile) Close() error {
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+	f.backend.mu.Lock()
+	defer f.backend.mu.Unlock()
+	f.backend.files[f.name] = bytes.Clone(f.Bytes())
+	return nil
+}
+
+// WithBackend sets where Persist and Load store snapshots.
+// The default is FileBackend, the local filesystem.
+func WithBackend(backend Backend) Option {
+	return func(db *DataBase) {
+		if backend != nil {
+			db.backend = backend
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// saveBytes writes data to name through b and then commits or aborts it.
+func saveBytes(t *testing.T, b Backend, name, data string, commit bool) {
+	t.Helper()
+	w, err := b.Save(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(w, data); err != nil {
+		t.Fatal(err)
+	}
+	if commit {
+		err = w.Close()
+	} else {
+		abortSave(w)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// loadBytes returns the contents of name read through b.
+func loadBytes(t *testing.T, b Backend, name string) string {
+	t.Helper()
+	r, err := b.Load(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestBackends(t *testing.T) {
+	dir := t.TempDir()
+	for name, b := range map[string]Backend{"file": FileBackend{}, "memory": NewMemoryBackend()} {
+		t.Run(name, func(t *testing.T) {
+			snapshot := filepath.Join(dir, name+".gob")
+			if _, err := b.Load(snapshot); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("Load of a missing snapshot: %v, want os.ErrNotExist", err)
+			}
+			saveBytes(t, b, snapshot, "first", true)
+			saveBytes(t, b, snapshot, "aborted", false)
+			if got := loadBytes(t, b, snapshot); got != "first" {
+				t.Errorf("after an aborted save: %q, want the previous first", got)
+			}
+			saveBytes(t, b, snapshot, "second", true)
+			if got := loadBytes(t, b, snapshot); got != "second" {
+				t.Errorf("after a second save: %q, want second", got)
+			}
+		})
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("FileBackend left %d files behind, want the snapshot alone", len(entries))
+	}
+	if info, err := os.Stat(filepath.Join(dir, "file.gob")); err != nil {
+		t.Error(err)
+	} else if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("FileBackend snapshot mode = %v, want 0600", perm)
+	}
+}
+
+func TestPersistWithMemoryBackend(t *testing.T) {
+	backend := NewMemoryBackend()
+	db := NewDataBase(WithBackend(backend))
+	defer db.Close()
+	db.Set("k", "v")
+	if err := db.Persist("snap"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := backend.Bytes("snap"); !ok {
+		t.Fatal("Persist wrote nothing to the backend")
+	}
+	if _, err := os.Stat("snap"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Persist touched the filesystem: %v", err)
+	}
+
+	other := NewDataBase(WithBackend(backend))
+	defer other.Close()
+	if err := other.Load("snap"); err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := other.Get("k"); value != "v" {
+		t.Errorf("loaded k = %v, want v", value)
+	}
+}
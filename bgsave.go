@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+// bgSnapshot is the frozen view of the keyspace being written by BGSave.
+type bgSnapshot struct {
+	mu      sync.Mutex                // Serializes the encoder with copy-on-write.
+	keys    []string                  // Every captured key, in write order.
+	entries map[string]*snapshotEntry // Captured entries not yet written.
+	copied  map[string]bool           // Entries already replaced by a private copy.
+}
+
+// BGSave writes a snapshot of the database to fileName in the background, in
+// the manner of Redis BGSAVE, and returns a channel that receives the result
+// once the file is complete: nil, an *UnencodableError as from Persist, or
+// the error that stopped the save.
+//
+// Unlike Persist, which holds the read lock while it encodes, BGSave holds
+// the write lock only while it captures a reference to every value, then
+// encodes that frozen view while readers and writers carry on. Writers that
+// replace a captured value leave the captured reference intact, and writers
+// that update a collection in place, such as HSet or SAdd, first copy it into
+// the snapshot, so every collection is copied at most once per save and only
+// if it is modified while the save runs, much like the pages of a forked
+// process. The file therefore reflects the instant BGSave was called. With
+// FileBackend it is written to a temporary file that replaces fileName only
+// once complete, so a failed save leaves the previous snapshot in place.
+//
+// Only one background save runs at a time; another BGSave meanwhile reports
+// ErrSaveInProgress. Close waits for a running save to finish.
+func (db *DataBase) BGSave(fileName string) <-chan error {
+	done := make(chan error, 1)
+	db.lock.Lock() // Acquire a write lock to claim the background save.
+	if db.bgsave != nil {
+		db.lock.Unlock()
+		done <- ErrSaveInProgress
+		return done
+	}
+	snap := &bgSnapshot{}
+	snap.capture(db) // Writers wait only while the references are captured.
+	saved := db.dirty.Swap(0)
+	db.bgsave = snap
+	db.lock.Unlock()
+
+	db.spawn(func() {
+		err := db.bgSave(fileName, snap)
+		db.lock.Lock() // Stop copy-on-write for this snapshot.
+		db.bgsave = nil
+		if saveFailed(err) {
+			db.dirty.Add(saved) // The captured changes are still unsaved.
+		}
+		db.lock.Unlock()
+		db.logSave(fileName, err)
+		done <- err
+	})
+	return done
+}
+
+// bgSave writes the frozen view to fileName.
+func (db *DataBase) bgSave(fileName string, snap *bgSnapshot) error {
+	release, err := db.acquireSave(fileName) // One writer per file at a time.
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	file, err := db.backend.Save(fileName) // Create or overwrite the snapshot.
+	if err != nil {
+		return err
+	}
+	defer abortSave(file) // Keep the previous snapshot if writing fails.
+
+	sw, err := newSnapshotWriter(file) // Write the header.
+	if err != nil {
+		return err
+	}
+	var skipped []string // Keys whose values cannot be encoded.
+	for _, key := range snap.keys {
+		if err := snap.write(sw, key); errors.Is(err, errUnencodable) {
+			skipped = append(skipped, key)
+		} else if err != nil {
+			return err
+		}
+	}
+	if err := sw.close(); err != nil {
+		return err
+	}
+	if err := syncFile(file); err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err // Closing commits the snapshot, so its error matters.
+	}
+	if len(skipped) > 0 {
+		sort.Strings(skipped)
+		return &UnencodableError{Keys: skipped}
+	}
+	return nil
+}
+
+// capture records a reference to every live value and its deadline.
+// The caller must hold the write lock.
+func (snap *bgSnapshot) capture(db *DataBase) {
+	now := db.clock.Now()
+	snap.mu.Lock()
+	defer snap.mu.Unlock()
+	snap.entries = make(map[string]*snapshotEntry, db.data.len())
+	snap.copied = make(map[string]bool)
+	for key, value := range db.data.all() {
+		if db.isExpired(key, now) {
+			continue // Dead keys awaiting removal are not saved.
+		}
+		deadline, _ := db.expires.get(key)
+		snap.entries[key] = &snapshotEntry{value, deadline}
+		snap.keys = append(snap.keys, key)
+	}
+}
+
+// write encodes one captured entry and then forgets it, so later writers
+// need not copy it.
+func (snap *bgSnapshot) write(sw *snapshotWriter, key string) error {
+	snap.mu.Lock()
+	defer snap.mu.Unlock()
+	entry := snap.entries[key]
+	delete(snap.entries, key)
+	return sw.writeEntry(key, entry.value, entry.deadline)
+}
+
+// cow must be called by every write path before it modifies the value at
+// key in place. While a background save is encoding a captured value that
+// is the live one, it gives the snapshot a private copy first, so the save
+// never sees the change, and it does the same for every open View. The
+// caller must hold the write lock.
+func (db *DataBase) cow(key string) {
+	for view := range db.views {
+		view.preserve(key)
+	}
+	snap := db.bgsave
+	if snap == nil {
+		return // No save running; the common case.
+	}
+	snap.mu.Lock()
+	defer snap.mu.Unlock()
+	entry, ok := snap.entries[key]
+	if !ok || snap.copied[key] {
+		return // Already written, copied, or never captured.
+	}
+	entry.value = deepCopy(entry.value)
+	snap.copied[key] = true
+}
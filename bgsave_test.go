@@ -0,0 +1,180 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestBGSaveFreezesView(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	for i := range 10_000 {
+		db.Set("key:"+strconv.Itoa(i), i)
+	}
+	db.HSet("user", "name", "ada")
+	db.Set("gone", "v")
+	fileName := filepath.Join(t.TempDir(), "database.gob")
+
+	done := db.BGSave(fileName)
+	db.HSet("user", "name", "grace") // Changes made while the save runs...
+	db.Set("key:0", "changed")
+	db.Set("new", "v")
+	db.Delete("gone")
+	if err := <-db.BGSave(fileName); !errors.Is(err, ErrSaveInProgress) {
+		t.Errorf("a second BGSave meanwhile: %v, want ErrSaveInProgress", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	saved := NewDataBase()
+	defer saved.Close()
+	if err := saved.Load(fileName); err != nil {
+		t.Fatal(err)
+	}
+	if value, _, _ := saved.HGet("user", "name"); value != "ada" { // ...are not in the file.
+		t.Errorf("saved user.name = %v, want ada", value)
+	}
+	if value, _ := saved.Get("key:0"); value != 0 {
+		t.Errorf("saved key:0 = %v, want 0", value)
+	}
+	if saved.Exists("new") != 0 || saved.Exists("gone") != 1 {
+		t.Error("the snapshot is not of the instant BGSave was called")
+	}
+	if value, _, _ := db.HGet("user", "name"); value != "grace" {
+		t.Errorf("live user.name = %v, want grace", value)
+	}
+}
+
+// benchmarkWritesDuringSave measures Set on a store of 20,000 keys while
+// save runs over and over in the background, reporting the slowest Set
+// too: Persist holds the read lock while it encodes, so a writer can wait
+// out a whole save, while BGSave stops writers only to capture references.
+func benchmarkWritesDuringSave(b *testing.B, save func(db *DataBase, fileName string) error) {
+	db := NewDataBase()
+	defer db.Close()
+	for i := range 20_000 {
+		db.Set("key:"+strconv.Itoa(i), "value")
+	}
+	fileName := filepath.Join(b.TempDir(), "database.gob")
+	saved, stop, stopped := make(chan struct{}), make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		save(db, fileName)
+		close(saved)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				save(db, fileName)
+			}
+		}
+	}()
+	<-saved // Measure the steady state, once the first save is done.
+	var slowest time.Duration
+	b.ResetTimer()
+	for i := range b.N {
+		start := time.Now()
+		db.Set("key:"+strconv.Itoa(i%20_000), i)
+		slowest = max(slowest, time.Since(start))
+	}
+	b.StopTimer()
+	close(stop)
+	<-stopped
+	b.ReportMetric(float64(slowest.Microseconds()), "max-µs")
+}
+
+func BenchmarkWritesDuringSave(b *testing.B) {
+	b.Run("Persist", func(b *testing.B) {
+		benchmarkWritesDuringSave(b, func(db *DataBase, fileName string) error {
+			return db.Persist(fileName)
+		})
+	})
+	b.Run("BGSave", func(b *testing.B) {
+		benchmarkWritesDuringSave(b, func(db *DataBase, fileName string) error {
+			return <-db.BGSave(fileName)
+		})
+	})
+}
+
+// failingBackend is a FileBackend whose snapshots fail to write while fail
+// is set, after the header, as a full disk would.
+type failingBackend struct {
+	FileBackend
+	fail bool
+}
+
+// Save creates the snapshot through FileBackend.
+func (b *failingBackend) Save(name string) (io.WriteCloser, error) {
+	w, err := b.FileBackend.Save(name)
+	if err != nil || !b.fail {
+		return w, err
+	}
+	return &failingFile{w.(*atomicFile)}, nil
+}
+
+// failingFile accepts the first write, which holds the header, and fails
+// the rest.
+type failingFile struct{ *atomicFile }
+
+// Write fails once the file holds anything.
+func (f *failingFile) Write(p []byte) (int, error) {
+	if info, err := f.Stat(); err != nil || info.Size() > 0 {
+		return 0, errors.New("no space left on device")
+	}
+	return f.atomicFile.Write(p)
+}
+
+func TestBGSaveFailureKeepsSnapshot(t *testing.T) {
+	backend := &failingBackend{}
+	db := NewDataBase(WithBackend(backend))
+	defer db.Close()
+	for i := range 1000 {
+		db.Set("key:"+strconv.Itoa(i), "first")
+	}
+	dir := t.TempDir()
+	fileName := filepath.Join(dir, "database.gob")
+	if err := <-db.BGSave(fileName); err != nil {
+		t.Fatal(err)
+	}
+
+	db.Set("key:0", "second")
+	backend.fail = true
+	if err := <-db.BGSave(fileName); err == nil {
+		t.Fatal("BGSave onto a full disk succeeded")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("the failed save left %d files behind, want the snapshot alone", len(entries))
+	}
+	saved := NewDataBase()
+	defer saved.Close()
+	if err := saved.Load(fileName); err != nil {
+		t.Fatalf("Load after a failed save: %v", err)
+	}
+	if value, _ := saved.Get("key:0"); value != "first" {
+		t.Errorf("saved key:0 = %v, want the previous snapshot's first", value)
+	}
+
+	backend.fail = false
+	db.Set("bad", make(chan int)) // Skipped, but the rest is still saved.
+	var unencodable *UnencodableError
+	if err := <-db.BGSave(fileName); !errors.As(err, &unencodable) || !slices.Equal(unencodable.Keys, []string{"bad"}) {
+		t.Fatalf("BGSave with an unencodable value: %v, want an UnencodableError for bad", err)
+	}
+	if err := saved.Load(fileName); err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := saved.Get("key:0"); value != "second" {
+		t.Errorf("saved key:0 = %v, want second", value)
+	}
+	if _, ok := saved.Get("bad"); ok {
+		t.Error("the unencodable key was saved")
+	}
+}
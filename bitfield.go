@@ -0,0 +1,246 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// maxBitfieldBits caps how far into a value a bitfield may reach, matching
+// the 512 MB limit Redis puts on strings.
+const maxBitfieldBits = 1 << 32
+
+// Errors returned by BitField for malformed operations.
+var (
+	ErrBitFieldType = errors.New("ERR Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is.")
+	ErrBitOffset    = errors.New("ERR bit offset is not an integer or out of range")
+)
+
+// BitFieldCommand selects what a BitFieldOp does.
+type BitFieldCommand int
+
+const (
+	BitFieldGet    BitFieldCommand = iota // Read the field.
+	BitFieldSet                           // Write Value, returning the old value.
+	BitFieldIncrBy                        // Add Value, returning the new value.
+)
+
+// Overflow selects how BitFieldSet and BitFieldIncrBy handle a result that
+// does not fit in the field, as the Redis BITFIELD OVERFLOW subcommand does.
+type Overflow int
+
+const (
+	OverflowWrap Overflow = iota // Keep the low bits, wrapping around.
+	OverflowSat                  // Clamp to the field's minimum or maximum.
+	OverflowFail                 // Leave the field unchanged; see BitFieldOverflowError.
+)
+
+// BitFieldOp is one operation of a BitField call on an integer field of
+// Width bits starting at bit Offset, where bit 0 is the most significant bit
+// of the first byte. Signed fields may be 1 to 64 bits wide and unsigned
+// fields 1 to 63, as in Redis.
+type BitFieldOp struct {
+	Command  BitFieldCommand
+	Signed   bool
+	Width    int
+	Offset   int64
+	Value    int64    // Value to store for Set, increment for IncrBy.
+	Overflow Overflow // How Set and IncrBy treat results out of range.
+}
+
+// BitFieldOverflowError reports the operations of a BitField call that were
+// skipped because they overflowed under OverflowFail. The other operations
+// were applied.
+type BitFieldOverflowError struct {
+	Ops []int // Indexes of the skipped operations.
+}
+
+// Error implements the error interface, listing the skipped operations.
+func (e *BitFieldOverflowError) Error() string {
+	ops := make([]string, len(e.Ops))
+	for i, op := range e.Ops {
+		ops[i] = fmt.Sprint(op)
+	}
+	return fmt.Sprintf("bitfield: %d operation(s) overflowed: %s", len(e.Ops), strings.Join(ops, ", "))
+}
+
+// BitField runs ops in order on the bitmap at key, like Redis BITFIELD, so
+// several small counters can be packed into one value. Each operation gives
+// one result: the field's value for Get, its old value for Set and its new
+// value for IncrBy. Bits beyond the end of the value read as zero, and
+// writes grow the value with zero bytes as needed, creating it as a []byte
+// if the key is missing. The value may be a []byte or a string, and keeps
+// its type and TTL. Other value types return ErrWrongType.
+//
+// Every operation is validated before any runs. An operation that overflows
+// under OverflowFail is skipped, its result being the field's unchanged
+// value, and a *BitFieldOverflowError listing it is returned along with the
+// results.
+func (db *DataBase) BitField(key string, ops []BitFieldOp) ([]int64, error) {
+	writes := false
+	for _, op := range ops {
+		if err := op.validate(); err != nil {
+			return nil, err
+		}
+		writes = writes || op.Command != BitFieldGet
+	}
+
+	db.lock.Lock()    // One lock for every operation.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	if writes && db.readOnly {
+		return nil, ErrReadOnly
+	}
+	db.expireIfNeeded(key)
+
+	var buf []byte
+	isString := false
+	if value, exists := db.data.get(key); exists {
+		switch v := value.(type) {
+		case []byte:
+			buf = v
+		case string:
+			buf, isString = []byte(v), true
+		default:
+			return nil, ErrWrongType
+		}
+	}
+	if writes {
+		if err := db.checkGrowth(); err != nil {
+			return nil, err
+		}
+	}
+
+	results := make([]int64, len(ops))
+	var failed []int
+	copied, written := isString, false // A string was already copied into buf.
+	for i, op := range ops {
+		current := op.wrap(getBits(buf, op.Offset, op.Width))
+		if op.Command == BitFieldGet {
+			results[i] = current
+			continue
+		}
+		var next int64
+		var ok bool
+		if op.Command == BitFieldSet {
+			next, ok = op.fit(op.Value, uint64(op.Value), 0)
+		} else {
+			sum := current + op.Value
+			dir := 0 // Whether the int64 sum itself overflowed, and which way.
+			if op.Value > 0 && sum < current {
+				dir = 1
+			} else if op.Value < 0 && sum > current {
+				dir = -1
+			}
+			next, ok = op.fit(sum, uint64(current)+uint64(op.Value), dir)
+		}
+		if !ok {
+			results[i] = current
+			failed = append(failed, i)
+			continue
+		}
+		if need := int((op.Offset + int64(op.Width) + 7) / 8); !copied || need > len(buf) {
+			grown := make([]byte, max(need, len(buf))) // Readers may hold the old slice.
+			copy(grown, buf)
+			buf, copied = grown, true
+		}
+		setBits(buf, op.Offset, op.Width, uint64(next))
+		written = true
+		if op.Command == BitFieldSet {
+			results[i] = current
+		} else {
+			results[i] = next
+		}
+	}
+
+	if written {
+		if isString {
+			db.data.set(key, string(buf))
+		} else {
+			db.data.set(key, buf)
+		}
+		db.touch(key) // Keeps any TTL, as Redis does.
+	}
+	if len(failed) > 0 {
+		return results, &BitFieldOverflowError{Ops: failed}
+	}
+	return results, nil
+}
+
+// validate checks an operation's field type and offset.
+func (op BitFieldOp) validate() error {
+	if op.Width < 1 || op.Width > 64 || (!op.Signed && op.Width == 64) {
+		return ErrBitFieldType
+	}
+	if op.Offset < 0 || op.Offset > maxBitfieldBits-int64(op.Width) {
+		return ErrBitOffset
+	}
+	return nil
+}
+
+// bounds returns the smallest and largest values the field can hold.
+func (op BitFieldOp) bounds() (lo, hi int64) {
+	if op.Signed {
+		return -1 << (op.Width - 1), 1<<(op.Width-1) - 1
+	}
+	return 0, 1<<op.Width - 1
+}
+
+// wrap keeps the low Width bits of v, sign-extending them for signed fields.
+func (op BitFieldOp) wrap(v uint64) int64 {
+	if op.Width < 64 {
+		v &= 1<<op.Width - 1
+		if op.Signed && v&(1<<(op.Width-1)) != 0 {
+			v |= ^uint64(0) << op.Width
+		}
+	}
+	return int64(v)
+}
+
+// fit brings v into the field's range according to the overflow mode,
+// reporting false if the operation must fail. raw is v computed with
+// wrap-around, and dir is 1 or -1 if computing v overflowed an int64
+// upwards or downwards.
+func (op BitFieldOp) fit(v int64, raw uint64, dir int) (int64, bool) {
+	lo, hi := op.bounds()
+	if dir == 0 && v >= lo && v <= hi {
+		return v, true
+	}
+	switch op.Overflow {
+	case OverflowSat:
+		if dir > 0 || (dir == 0 && v > hi) {
+			return hi, true
+		}
+		return lo, true
+	case OverflowFail:
+		return 0, false
+	}
+	return op.wrap(raw), true
+}
+
+// getBits reads width bits of buf starting at bit offset, most significant
+// bit first. Bits past the end of buf read as zero.
+func getBits(buf []byte, offset int64, width int) uint64 {
+	var v uint64
+	for pos := offset; pos < offset+int64(width); pos++ {
+		var bit byte
+		if i := pos >> 3; i < int64(len(buf)) {
+			bit = buf[i] >> (7 - pos&7) & 1
+		}
+		v = v<<1 | uint64(bit)
+	}
+	return v
+}
+
+// setBits writes the low width bits of v into buf starting at bit offset,
+// most significant bit first. buf must be long enough.
+func setBits(buf []byte, offset int64, width int, v uint64) {
+	for i := 0; i < width; i++ {
+		pos := offset + int64(i)
+		mask := byte(1) << (7 - pos&7)
+		if v>>(width-1-i)&1 == 1 {
+			buf[pos>>3] |= mask
+		} else {
+			buf[pos>>3] &^= mask
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestBitFieldOverflow(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	for _, tc := range []struct {
+		name     string
+		signed   bool
+		width    int
+		offset   int64 // Each offset but 8 and 0 puts the field across a byte boundary.
+		init     int64
+		incr     int64
+		overflow Overflow
+		want     int64
+		fails    bool
+	}{
+		{"u4 in range", false, 4, 6, 14, 1, OverflowWrap, 15, false},
+		{"u4 wrap up", false, 4, 6, 14, 2, OverflowWrap, 0, false},
+		{"u4 sat up", false, 4, 6, 14, 2, OverflowSat, 15, false},
+		{"u4 fail up", false, 4, 6, 14, 2, OverflowFail, 14, true},
+		{"u4 wrap down", false, 4, 6, 14, -15, OverflowWrap, 15, false},
+		{"u4 sat down", false, 4, 6, 14, -15, OverflowSat, 0, false},
+		{"u4 fail down", false, 4, 6, 14, -15, OverflowFail, 14, true},
+		{"u8 wrap", false, 8, 8, 255, 1, OverflowWrap, 0, false},
+		{"u63 wrap", false, 63, 3, math.MaxInt64, 1, OverflowWrap, 0, false},
+		{"i8 wrap up", true, 8, 4, 127, 1, OverflowWrap, -128, false},
+		{"i8 sat up", true, 8, 4, 127, 1, OverflowSat, 127, false},
+		{"i8 fail up", true, 8, 4, 127, 1, OverflowFail, 127, true},
+		{"i8 wrap down", true, 8, 4, -128, -1, OverflowWrap, 127, false},
+		{"i8 sat down", true, 8, 4, -128, -1, OverflowSat, -128, false},
+		{"i8 fail down", true, 8, 4, -128, -1, OverflowFail, -128, true},
+		{"i4 sat", true, 4, 14, 0, 100, OverflowSat, 7, false},
+		{"i64 wrap", true, 64, 0, math.MaxInt64, 1, OverflowWrap, math.MinInt64, false},
+		{"i64 sat", true, 64, 0, math.MaxInt64, 1, OverflowSat, math.MaxInt64, false},
+		{"i64 sat down", true, 64, 5, math.MinInt64, -1, OverflowSat, math.MinInt64, false},
+		{"i64 fail", true, 64, 5, math.MaxInt64, math.MaxInt64, OverflowFail, math.MaxInt64, true},
+	} {
+		field := BitFieldOp{Signed: tc.signed, Width: tc.width, Offset: tc.offset}
+		set, incr, get := field, field, field
+		set.Command, set.Value = BitFieldSet, tc.init
+		incr.Command, incr.Value, incr.Overflow = BitFieldIncrBy, tc.incr, tc.overflow
+		results, err := db.BitField(tc.name, []BitFieldOp{set, incr, get})
+		var overflow *BitFieldOverflowError
+		if failed := errors.As(err, &overflow); failed != tc.fails || (failed && !slices.Equal(overflow.Ops, []int{1})) {
+			t.Errorf("%s: err = %v, want overflow %v", tc.name, err, tc.fails)
+		}
+		if len(results) != 3 || results[1] != tc.want || results[2] != tc.want {
+			t.Errorf("%s: results = %v, want %d after the increment", tc.name, results, tc.want)
+		}
+	}
+}
+
+func TestBitFieldSetAndLayout(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1_000_000, 0))
+	db := NewDataBase(WithClock(clock))
+	defer db.Close()
+	u4 := BitFieldOp{Command: BitFieldSet, Width: 4, Offset: 6, Value: 15}
+	if results, err := db.BitField("bits", []BitFieldOp{u4}); err != nil || results[0] != 0 {
+		t.Fatalf("BitField SET on a missing key = %v, %v; want the old value 0", results, err)
+	}
+	if value, _ := db.Get("bits"); !bytes.Equal(value.([]byte), []byte{0x03, 0xC0}) {
+		t.Errorf("bits = %x, want 03c0: bit 0 is the top bit of the first byte", value)
+	}
+
+	u8 := BitFieldOp{Command: BitFieldSet, Width: 8, Offset: 16}
+	for _, tc := range []struct {
+		overflow Overflow
+		want     int64
+	}{{OverflowWrap, 44}, {OverflowSat, 255}, {OverflowFail, 255}} {
+		u8.Value, u8.Overflow = 300, tc.overflow
+		get := BitFieldOp{Command: BitFieldGet, Width: 8, Offset: 16}
+		if results, _ := db.BitField("bits", []BitFieldOp{u8, get}); results[1] != tc.want {
+			t.Errorf("SET u8 300 with overflow %d stored %d, want %d", tc.overflow, results[1], tc.want)
+		}
+	}
+	past := BitFieldOp{Command: BitFieldGet, Signed: true, Width: 16, Offset: 1000}
+	if results, _ := db.BitField("bits", []BitFieldOp{past}); results[0] != 0 {
+		t.Errorf("GET past the end = %d, want 0", results[0])
+	}
+
+	db.SetWithTTL("str", "\x00", time.Minute)
+	db.BitField("str", []BitFieldOp{{Command: BitFieldIncrBy, Width: 8, Value: 'A'}})
+	if value, _ := db.Get("str"); value != "A" {
+		t.Errorf("str = %#v, want the string A", value)
+	}
+	if ttl := db.TTL("str"); ttl != time.Minute {
+		t.Errorf("TTL(str) = %v, want the minute kept", ttl)
+	}
+
+	db.RPush("list", "a")
+	if _, err := db.BitField("list", []BitFieldOp{{Width: 8}}); !errors.Is(err, ErrWrongType) {
+		t.Errorf("BitField of a list: %v, want ErrWrongType", err)
+	}
+	for _, op := range []BitFieldOp{{Width: 64}, {Width: 0}, {Signed: true, Width: 65}} {
+		if _, err := db.BitField("bits", []BitFieldOp{op}); !errors.Is(err, ErrBitFieldType) {
+			t.Errorf("BitField with signed %v width %d: %v, want ErrBitFieldType", op.Signed, op.Width, err)
+		}
+	}
+	if _, err := db.BitField("bits", []BitFieldOp{{Width: 8, Offset: -1}}); !errors.Is(err, ErrBitOffset) {
+		t.Errorf("BitField at a negative offset: %v, want ErrBitOffset", err)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrClosed is returned by BLPop and BRPop to callers still blocked when the
+// database is closed.
+var ErrClosed = errors.New("database closed")
+
+// keyWaiters holds the wake-up channels of blocked calls, such as BLPop and
+// XRead, by key, in the order the calls blocked. Every write to a key
+// signals its channels, and the callers then check whether what they wait
+// for has arrived.
+type keyWaiters struct {
+	mu      sync.Mutex
+	waiting map[string][]chan struct{} // Oldest first.
+	count   atomic.Int32               // Calls waiting, read without mu.
+}
+
+// add registers a wake-up channel for keys and returns it.
+func (w *keyWaiters) add(keys []string) chan struct{} {
+	ch := make(chan struct{}, 1) // A pending wake-up is enough; later ones are dropped.
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.waiting == nil {
+		w.waiting = make(map[string][]chan struct{})
+	}
+	for _, key := range keys {
+		w.waiting[key] = append(w.waiting[key], ch)
+	}
+	w.count.Add(1)
+	return ch
+}
+
+// remove unregisters a channel returned by add, and signals the calls that
+// become the oldest waiting on its keys, which may now take what it was
+// first in line for.
+func (w *keyWaiters) remove(ch chan struct{}, keys []string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, key := range keys {
+		w.waiting[key] = slices.DeleteFunc(w.waiting[key], func(c chan struct{}) bool { return c == ch })
+		if len(w.waiting[key]) == 0 {
+			delete(w.waiting, key)
+			continue
+		}
+		signal(w.waiting[key][0])
+	}
+	w.count.Add(-1)
+}
+
+// first reports whether ch is the oldest channel waiting on key.
+func (w *keyWaiters) first(key string, ch chan struct{}) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	waiting := w.waiting[key]
+	return len(waiting) > 0 && waiting[0] == ch
+}
+
+// wake signals the calls waiting on key.
+func (w *keyWaiters) wake(key string) {
+	if w.count.Load() == 0 {
+		return // Nobody is blocked; the common case.
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, ch := range w.waiting[key] {
+		signal(ch)
+	}
+}
+
+// signal wakes the call waiting on ch.
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default: // Already signalled.
+	}
+}
+
+// BLPop removes and returns the head of the first non-empty list among
+// keys, together with its key, waiting for one of them to be pushed to if
+// all are empty. It reports false if timeout passes first; a timeout of 0
+// waits with no limit, as in Redis. Lists are tried in the order given, and
+// a key holding another type returns ErrWrongType. Callers blocked on the
+// same key are served one element each, in the order they blocked, as in
+// Redis; a caller is not served from a key while an older caller waits on
+// it. Close wakes blocked callers with ErrClosed.
+func (db *DataBase) BLPop(timeout time.Duration, keys ...string) (string, any, bool, error) {
+	return db.blockingPop(timeout, true, keys)
+}
+
+// BRPop is BLPop for the tails of the lists.
+func (db *DataBase) BRPop(timeout time.Duration, keys ...string) (string, any, bool, error) {
+	return db.blockingPop(timeout, false, keys)
+}
+
+// blockingPop implements BLPop and BRPop. It registers for wake-ups before
+// its first attempt, so a push in between is not missed, and so joins the
+// line for each key before it may take from it.
+func (db *DataBase) blockingPop(timeout time.Duration, left bool, keys []string) (string, any, bool, error) {
+	wake := db.waits.add(keys)
+	defer db.waits.remove(wake, keys)
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	for {
+		key, elem, ok, err := db.popFirst(keys, left, wake)
+		if ok || err != nil {
+			return key, elem, ok, err
+		}
+		select {
+		case <-wake:
+		case <-expired:
+			return "", nil, false, nil
+		case <-db.stop:
+			return "", nil, false, ErrClosed
+		}
+	}
+}
+
+// popFirst pops from the first non-empty list among keys for which wake is
+// the oldest waiter, under a single write lock.
+func (db *DataBase) popFirst(keys []string, left bool, wake chan struct{}) (string, any, bool, error) {
+	db.lock.Lock()    // Acquire a write lock.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	if db.readOnly {
+		return "", nil, false, ErrReadOnly
+	}
+	for _, key := range keys {
+		if !db.waits.first(key, wake) {
+			continue // An older caller is in line for it.
+		}
+		elem, ok, err := db.popLocked(key, left)
+		if err != nil {
+			return "", nil, false, err
+		}
+		if ok {
+			return key, elem, true, nil
+		}
+	}
+	return "", nil, false, nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// popResult is what a BLPop call returned.
+type popResult struct {
+	key  string
+	elem any
+	ok   bool
+	err  error
+}
+
+// blpop runs BLPop in the background and returns where its result will go,
+// once the call is blocked: n is the number of calls blocked before it.
+func blpop(t *testing.T, db *DataBase, n int, timeout time.Duration, keys ...string) <-chan popResult {
+	t.Helper()
+	out := make(chan popResult, 1)
+	go func() {
+		key, elem, ok, err := db.BLPop(timeout, keys...)
+		out <- popResult{key, elem, ok, err}
+	}()
+	waitFor(t, "BLPop to block", func() bool { return int(db.waits.count.Load()) == n+1 })
+	return out
+}
+
+// result waits for a background BLPop to return.
+func result(t *testing.T, ch <-chan popResult) popResult {
+	t.Helper()
+	select {
+	case r := <-ch:
+		return r
+	case <-time.After(5 * time.Second):
+		t.Fatal("BLPop did not return")
+		return popResult{}
+	}
+}
+
+func TestBLPopReturnsAtOnce(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	db.RPush("b", "b1", "b2")
+	if key, elem, ok, err := db.BLPop(time.Second, "a", "b"); key != "b" || elem != "b1" || !ok || err != nil {
+		t.Errorf("BLPop = %q, %v, %v, %v; want b1 from b", key, elem, ok, err)
+	}
+	if key, elem, ok, err := db.BRPop(time.Second, "a", "b"); key != "b" || elem != "b2" || !ok || err != nil {
+		t.Errorf("BRPop = %q, %v, %v, %v; want b2 from b", key, elem, ok, err)
+	}
+	db.Set("str", "v")
+	if _, _, _, err := db.BLPop(time.Second, "str"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("BLPop of a string: %v, want ErrWrongType", err)
+	}
+}
+
+func TestBLPopTimeout(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	start := time.Now()
+	key, elem, ok, err := db.BLPop(30*time.Millisecond, "empty")
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf("BLPop returned after %v, before its timeout", elapsed)
+	}
+	if key != "" || elem != nil || ok || err != nil {
+		t.Errorf("BLPop past its timeout = %q, %v, %v, %v; want nothing", key, elem, ok, err)
+	}
+	if n := db.waits.count.Load(); n != 0 {
+		t.Errorf("%d waiters left registered after the timeout", n)
+	}
+}
+
+func TestBLPopWakesOnPush(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	done := blpop(t, db, 0, 0, "a", "b")
+	db.Set("unrelated", "v") // Wakes no one.
+	db.RPush("b", "x")
+	if r := result(t, done); r.key != "b" || r.elem != "x" || !r.ok || r.err != nil {
+		t.Errorf("BLPop woken by a push = %+v, want x from b", r)
+	}
+	if n, _ := db.LLen("b"); n != 0 {
+		t.Errorf("LLen(b) = %d, want the element taken", n)
+	}
+}
+
+func TestBLPopFIFO(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	const waiters = 5
+	var done []<-chan popResult
+	for i := range waiters {
+		done = append(done, blpop(t, db, i, 0, "q"))
+	}
+	for i := range waiters {
+		db.RPush("q", fmt.Sprint("job", i))
+	}
+	for i, ch := range done {
+		if r := result(t, ch); r.elem != fmt.Sprint("job", i) {
+			t.Errorf("waiter %d got %v, want job%d: waiters are served in the order they blocked", i, r.elem, i)
+		}
+	}
+
+	// A waiter first in line on one key does not hold up the line on another.
+	first := blpop(t, db, 0, 0, "x", "y")
+	second := blpop(t, db, 1, 0, "y")
+	db.RPush("x", "for first")
+	db.RPush("y", "for second")
+	if r := result(t, first); r.elem != "for first" {
+		t.Errorf("first waiter got %v, want the element on x", r.elem)
+	}
+	if r := result(t, second); r.elem != "for second" {
+		t.Errorf("second waiter got %v, want the element on y", r.elem)
+	}
+}
+
+func TestBLPopWokenByClose(t *testing.T) {
+	db := NewDataBase()
+	done := blpop(t, db, 0, 0, "never")
+	db.Close()
+	if r := result(t, done); !errors.Is(r.err, ErrClosed) || r.ok {
+		t.Errorf("BLPop blocked across Close = %+v, want ErrClosed", r)
+	}
+	if _, _, _, err := db.BLPop(0, "never"); !errors.Is(err, ErrClosed) {
+		t.Errorf("BLPop on a closed database: %v, want ErrClosed", err)
+	}
+}
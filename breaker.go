@@ -0,0 +1,86 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Defaults for the breaker around SaveEvery saves.
+const (
+	defaultBreakerFailures = 5           // Consecutive failures that open the breaker.
+	defaultBreakerCooldown = time.Minute // How long it stays open before a probe.
+)
+
+// saveBreaker stops the SaveEvery saver from retrying a save that keeps
+// failing, for example because the disk is full. It is closed while saves
+// succeed, opens after enough consecutive failures and, once its cooldown
+// has passed, half-opens to let a single probe save through: success closes
+// it again and failure reopens it for another cooldown.
+type saveBreaker struct {
+	mu       sync.Mutex
+	failures int           // Consecutive failed saves while closed.
+	limit    int           // Failures that open the breaker.
+	cooldown time.Duration // Time spent open before probing.
+	open     bool          // Saves are held off.
+	openedAt time.Time     // When the breaker last opened.
+}
+
+// WithSaveBreaker sets how many consecutive SaveEvery saves must fail before
+// automatic saving pauses, and for how long it pauses before a single probe
+// save is tried. The defaults are five failures and one minute.
+func WithSaveBreaker(failures int, cooldown time.Duration) Option {
+	return func(db *DataBase) {
+		if failures > 0 {
+			db.breaker.limit = failures
+		}
+		if cooldown > 0 {
+			db.breaker.cooldown = cooldown
+		}
+	}
+}
+
+// PersistenceState reports the state of the breaker around SaveEvery saves:
+// "closed" while saves run normally, "open" while they are paused after
+// repeated failures, and "half-open" once the cooldown has passed and the
+// next save is a probe. Explicit Persist and BGSave calls are never held
+// off by the breaker.
+func (db *DataBase) PersistenceState() string {
+	b := &db.breaker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch {
+	case !b.open:
+		return "closed"
+	case time.Since(b.openedAt) < b.cooldown:
+		return "open"
+	}
+	return "half-open"
+}
+
+// allow reports whether the saver may attempt a save now.
+func (b *saveBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !b.open || time.Since(b.openedAt) >= b.cooldown
+}
+
+// record updates the breaker with a save's outcome and reports whether it
+// just opened from closed, so the caller can emit its single error.
+func (b *saveBreaker) record(failed bool) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !failed {
+		b.open, b.failures = false, 0
+		return false
+	}
+	if b.open { // The half-open probe failed: stay open for another cooldown.
+		b.openedAt = time.Now()
+		return false
+	}
+	b.failures++
+	if b.failures < b.limit {
+		return false
+	}
+	b.open, b.openedAt, b.failures = true, time.Now(), 0
+	return true
+}
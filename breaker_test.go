@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// errDiskFull is what flakyBackend fails saves with.
+var errDiskFull = errors.New("no space left on device")
+
+// flakyBackend is a MemoryBackend whose saves fail while failing is set,
+// counting every attempt.
+type flakyBackend struct {
+	*MemoryBackend
+	failing  atomic.Bool
+	attempts atomic.Int32
+}
+
+func (b *flakyBackend) Save(name string) (io.WriteCloser, error) {
+	b.attempts.Add(1)
+	if b.failing.Load() {
+		return nil, errDiskFull
+	}
+	return b.MemoryBackend.Save(name)
+}
+
+func TestSaveBreakerOpens(t *testing.T) {
+	backend := &flakyBackend{MemoryBackend: NewMemoryBackend()}
+	backend.failing.Store(true)
+	var log lockedBuffer
+	const cooldown = 200 * time.Millisecond
+	db := NewDataBase(WithBackend(backend), WithSaveBreaker(3, cooldown),
+		WithLogger(slog.New(slog.NewTextHandler(&log, nil))))
+	defer db.Close()
+	db.SaveEvery(1, "dump.gob")
+
+	for i := range int32(3) {
+		if state := db.PersistenceState(); state != "closed" {
+			t.Fatalf("PersistenceState after %d failures = %s, want closed", i, state)
+		}
+		db.Set("k", i)
+		waitFor(t, "the save attempt", func() bool { return backend.attempts.Load() == i+1 })
+	}
+	waitFor(t, "the breaker to open", func() bool { return db.PersistenceState() == "open" })
+
+	for i := range 20 {
+		db.Set("k", i) // Each would kick a save with the breaker closed.
+	}
+	time.Sleep(cooldown / 4)
+	if n := backend.attempts.Load(); n != 3 {
+		t.Errorf("%d save attempts with the breaker open, want it to stop at 3", n)
+	}
+	if n := strings.Count(log.String(), "automatic saves paused"); n != 1 {
+		t.Errorf("logged the pause %d times, want once", n)
+	}
+
+	waitFor(t, "the cooldown to pass", func() bool { return db.PersistenceState() == "half-open" })
+	db.Set("k", "probe")
+	waitFor(t, "the failed probe to reopen the breaker", func() bool {
+		return backend.attempts.Load() == 4 && db.PersistenceState() == "open"
+	})
+
+	backend.failing.Store(false) // The disk has room again.
+	waitFor(t, "the cooldown to pass", func() bool { return db.PersistenceState() == "half-open" })
+	db.Set("k", "saved")
+	waitFor(t, "the probe to close the breaker", func() bool { return db.PersistenceState() == "closed" })
+	if _, ok := backend.Bytes("dump.gob"); !ok {
+		t.Error("the successful probe wrote no snapshot")
+	}
+	if n := strings.Count(log.String(), "automatic saves paused"); n != 1 {
+		t.Errorf("logged the pause %d times, want once: a failed probe reopens quietly", n)
+	}
+}
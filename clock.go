@@ -0,0 +1,66 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock supplies the current time for expiration. Injecting a fake clock
+// with WithClock makes TTL behaviour testable without sleeping.
+type Clock interface {
+	Now() time.Time
+}
+
+// realClock reads the system clock. It is the default Clock.
+type realClock struct{}
+
+// Now returns time.Now().
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// FakeClock is a manually driven Clock for tests. Its time only moves when
+// Advance or Set is called. It is safe for concurrent use.
+type FakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewFakeClock returns a FakeClock reading start.
+func NewFakeClock(start time.Time) *FakeClock {
+	return &FakeClock{now: start}
+}
+
+// Now returns the fake current time.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves the fake time forward by d.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// Set moves the fake time to t.
+func (c *FakeClock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = t
+}
+
+// WithClock sets the clock used for every expiry decision: TTL deadlines,
+// lazy expiration on access and the background sweeper's checks. The
+// sweeper still wakes on its real-time interval, so after advancing a fake
+// clock, expired keys are hidden from reads at once and removed by the next
+// sweep. Latency measurements keep using the monotonic system clock.
+func WithClock(clock Clock) Option {
+	return func(db *DataBase) {
+		if clock != nil {
+			db.clock = clock
+		}
+	}
+}
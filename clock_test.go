@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Unix(1_000_000, 0)
+	clock := NewFakeClock(start)
+	if !clock.Now().Equal(start) {
+		t.Errorf("Now = %v, want %v", clock.Now(), start)
+	}
+	clock.Advance(90 * time.Second)
+	if want := start.Add(90 * time.Second); !clock.Now().Equal(want) {
+		t.Errorf("after Advance: %v, want %v", clock.Now(), want)
+	}
+	clock.Set(start)
+	if !clock.Now().Equal(start) {
+		t.Errorf("after Set: %v, want %v", clock.Now(), start)
+	}
+}
+
+func TestFakeClockDrivesExpiry(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1_000_000, 0))
+	db := NewDataBase(WithClock(clock))
+	defer db.Close()
+	expired := make(chan string, 1)
+	db.OnExpire(func(key string, _ any) { expired <- key })
+	db.SetWithTTL("session", "tok", 24*time.Hour)
+
+	clock.Advance(24*time.Hour - time.Second)
+	if _, ok := db.Get("session"); !ok {
+		t.Fatal("the key expired early")
+	}
+	clock.Advance(time.Second) // A day passes at once.
+	if _, ok := db.Get("session"); ok {
+		t.Error("the key is readable past its TTL")
+	}
+	select {
+	case key := <-expired: // Removed by the sweeper's next real-time run.
+		if key != "session" {
+			t.Errorf("OnExpire(%s), want session", key)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the sweeper did not remove the key")
+	}
+}
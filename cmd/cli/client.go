@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// client is a connection to the server, sending one command at a time.
+type client struct {
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+}
+
+// Reply types other than the plain Go values readReply returns for bulk
+// strings (string), integers (int64), arrays ([]any), doubles (float64),
+// booleans (bool) and nulls (nil).
+type (
+	status     string // A simple string such as OK.
+	replyError string // An error reply, printed as (error).
+	replyMap   []any  // A RESP3 map, as alternating keys and values.
+)
+
+// errBadReply reports a reply the client cannot parse.
+var errBadReply = errors.New("protocol error: malformed reply")
+
+// newClient wraps a connection to the server.
+func newClient(conn net.Conn) *client {
+	return &client{conn: conn, r: bufio.NewReader(conn), w: bufio.NewWriter(conn)}
+}
+
+// Close closes the connection.
+func (c *client) Close() error {
+	return c.conn.Close()
+}
+
+// do sends a command as a RESP array of bulk strings and reads its reply.
+func (c *client) do(args ...string) (any, error) {
+	fmt.Fprintf(c.w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(c.w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if err := c.w.Flush(); err != nil {
+		return nil, err
+	}
+	return c.read()
+}
+
+// read reads one reply, in RESP2 or RESP3.
+func (c *client) read() (any, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errBadReply
+	}
+	kind, body := line[0], line[1:]
+	switch kind {
+	case '+':
+		return status(body), nil
+	case '-':
+		return replyError(body), nil
+	case ':':
+		n, err := strconv.ParseInt(body, 10, 64)
+		if err != nil {
+			return nil, errBadReply
+		}
+		return n, nil
+	case '_':
+		return nil, nil
+	case ',':
+		f, err := strconv.ParseFloat(body, 64)
+		if err != nil {
+			return nil, errBadReply
+		}
+		return f, nil
+	case '#':
+		return body == "t", nil
+	case '$', '=': // Bulk and verbatim strings.
+		n, err := strconv.Atoi(body)
+		if err != nil || n < -1 {
+			return nil, errBadReply
+		}
+		if n == -1 {
+			return nil, nil // RESP2's null.
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		if kind == '=' && n >= 4 {
+			buf = buf[4:] // Drop the "txt:" format.
+		}
+		return string(buf[:len(buf)-2]), nil
+	case '*', '~', '>', '%': // Arrays, sets, pushes and maps.
+		n, err := strconv.Atoi(body)
+		if err != nil || n < -1 {
+			return nil, errBadReply
+		}
+		if n == -1 {
+			return nil, nil // RESP2's null array.
+		}
+		if kind == '%' {
+			n *= 2
+		}
+		items := make([]any, 0, min(n, 1024))
+		for range n {
+			item, err := c.read()
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		if kind == '%' {
+			return replyMap(items), nil
+		}
+		return items, nil
+	}
+	return nil, errBadReply
+}
+
+// isError reports whether reply is an error reply.
+func isError(reply any) bool {
+	_, ok := reply.(replyError)
+	return ok
+}
+
+// formatReply pretty-prints a reply the way redis-cli does: strings quoted,
+// integers and errors labelled, and arrays numbered, nested ones indented
+// under their index.
+func formatReply(reply any) string {
+	switch reply := reply.(type) {
+	case nil:
+		return "(nil)"
+	case status:
+		return string(reply)
+	case replyError:
+		return "(error) " + string(reply)
+	case int64:
+		return "(integer) " + strconv.FormatInt(reply, 10)
+	case float64:
+		return "(double) " + strconv.FormatFloat(reply, 'g', -1, 64)
+	case bool:
+		return "(" + strconv.FormatBool(reply) + ")"
+	case string:
+		return strconv.Quote(reply)
+	case []any:
+		if len(reply) == 0 {
+			return "(empty array)"
+		}
+		lines := make([]string, len(reply))
+		for i, item := range reply {
+			lines[i] = formatReply(item)
+		}
+		return numbered(lines, ")")
+	case replyMap:
+		if len(reply) == 0 {
+			return "(empty hash)"
+		}
+		lines := make([]string, len(reply)/2)
+		for i := range lines {
+			lines[i] = formatReply(reply[2*i]) + " => " + formatReply(reply[2*i+1])
+		}
+		return numbered(lines, "#")
+	}
+	return fmt.Sprint(reply)
+}
+
+// numbered lists items one per line as "1) item", aligning the indexes and
+// indenting the continuation lines of multi-line items under their first.
+func numbered(items []string, mark string) string {
+	width := len(strconv.Itoa(len(items)))
+	var b strings.Builder
+	for i, item := range items {
+		prefix := fmt.Sprintf("%*d%s ", width, i+1, mark)
+		for j, line := range strings.Split(item, "\n") {
+			if i > 0 || j > 0 {
+				b.WriteByte('\n')
+			}
+			if j == 0 {
+				b.WriteString(prefix)
+			} else {
+				b.WriteString(strings.Repeat(" ", len(prefix)))
+			}
+			b.WriteString(line)
+		}
+	}
+	return b.String()
+}
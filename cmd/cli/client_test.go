@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// replyClient returns a client that reads its replies from raw.
+func replyClient(raw string) *client {
+	return &client{r: bufio.NewReader(strings.NewReader(raw))}
+}
+
+func TestClientRead(t *testing.T) {
+	for _, tc := range []struct {
+		raw  string
+		want any
+	}{
+		{"+OK\r\n", status("OK")},
+		{"-ERR wrong\r\n", replyError("ERR wrong")},
+		{":42\r\n", int64(42)},
+		{"$5\r\nhello\r\n", "hello"},
+		{"$0\r\n\r\n", ""},
+		{"$-1\r\n", nil},
+		{"*-1\r\n", nil},
+		{"_\r\n", nil},
+		{",2.5\r\n", 2.5},
+		{"#t\r\n", true},
+		{"=9\r\ntxt:hello\r\n", "hello"},
+		{"*2\r\n$1\r\na\r\n*1\r\n:1\r\n", []any{"a", []any{int64(1)}}},
+		{"~1\r\n$1\r\nx\r\n", []any{"x"}},
+		{">2\r\n$7\r\nmessage\r\n$2\r\nhi\r\n", []any{"message", "hi"}},
+		{"%1\r\n$1\r\nk\r\n:1\r\n", replyMap{"k", int64(1)}},
+	} {
+		got, err := replyClient(tc.raw).read()
+		if err != nil || !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("read(%q) = %#v, %v; want %#v", tc.raw, got, err, tc.want)
+		}
+	}
+	for _, raw := range []string{"\r\n", "?what\r\n", ":nan\r\n", "$-2\r\n", "*x\r\n", ",many\r\n"} {
+		if _, err := replyClient(raw).read(); !errors.Is(err, errBadReply) {
+			t.Errorf("read(%q) error = %v, want errBadReply", raw, err)
+		}
+	}
+	if _, err := replyClient("$5\r\nhe").read(); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("read of a cut-off bulk string: %v, want io.ErrUnexpectedEOF", err)
+	}
+}
+
+func TestClientDo(t *testing.T) {
+	conn, server := net.Pipe()
+	c := newClient(conn)
+	defer c.Close()
+	sent := make(chan string, 1)
+	go func() {
+		buf := make([]byte, 64)
+		n, _ := server.Read(buf)
+		sent <- string(buf[:n])
+		io.WriteString(server, "+OK\r\n")
+	}()
+	reply, err := c.do("SET", "k", "two words")
+	if err != nil || reply != status("OK") {
+		t.Errorf("do = %v, %v; want OK", reply, err)
+	}
+	if got, want := <-sent, "*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$9\r\ntwo words\r\n"; got != want {
+		t.Errorf("sent %q, want %q", got, want)
+	}
+}
+
+func TestFormatReply(t *testing.T) {
+	for _, tc := range []struct {
+		reply any
+		want  string
+	}{
+		{nil, "(nil)"},
+		{status("OK"), "OK"},
+		{replyError("ERR no"), "(error) ERR no"},
+		{int64(-3), "(integer) -3"},
+		{1.5, "(double) 1.5"},
+		{false, "(false)"},
+		{"say \"hi\"\n", `"say \"hi\"\n"`},
+		{[]any{}, "(empty array)"},
+		{replyMap{}, "(empty hash)"},
+		{[]any{"a", int64(1)}, "1) \"a\"\n2) (integer) 1"},
+		{[]any{"a", []any{"b", "c"}}, "1) \"a\"\n2) 1) \"b\"\n   2) \"c\""},
+		{replyMap{"k", "v", "n", int64(2)}, "1# \"k\" => \"v\"\n2# \"n\" => (integer) 2"},
+	} {
+		if got := formatReply(tc.reply); got != tc.want {
+			t.Errorf("formatReply(%#v) = %q, want %q", tc.reply, got, tc.want)
+		}
+	}
+	items := make([]any, 10)
+	for i := range items {
+		items[i] = int64(i)
+	}
+	if lines := strings.Split(formatReply(items), "\n"); lines[0] != " 1) (integer) 0" || lines[9] != "10) (integer) 9" {
+		t.Errorf("formatReply of ten items = %q, want the indexes aligned", lines)
+	}
+	if !isError(replyError("ERR")) || isError("ERR") {
+		t.Error("isError does not tell error replies from strings")
+	}
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// maxHistory caps the lines kept in the history and its file.
+const maxHistory = 1000
+
+// errInterrupted is returned by readLine when Ctrl-C abandons the line.
+var errInterrupted = errors.New("interrupted")
+
+// lineEditor reads lines from a terminal with emacs-style editing, history
+// and completion. When the input is not a terminal, or raw mode is not
+// available on the platform, it reads plain lines instead.
+type lineEditor struct {
+	in       *os.File
+	r        *bufio.Reader
+	out      io.Writer
+	complete func(prefix string) []string // Candidates for the first word.
+	history  []string
+}
+
+// newLineEditor returns an editor reading in and echoing to out.
+func newLineEditor(in *os.File, out io.Writer, complete func(prefix string) []string) *lineEditor {
+	return &lineEditor{in: in, r: bufio.NewReader(in), out: out, complete: complete}
+}
+
+// loadHistory reads the history saved in file, if there is any.
+func (e *lineEditor) loadHistory(file string) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return // No history yet.
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" {
+			e.history = append(e.history, line)
+		}
+	}
+	e.history = e.history[max(len(e.history)-maxHistory, 0):]
+}
+
+// addHistory records line, unless it repeats the last one, and appends it
+// to file when file is not empty.
+func (e *lineEditor) addHistory(line, file string) {
+	if n := len(e.history); n > 0 && e.history[n-1] == line {
+		return
+	}
+	e.history = append(e.history, line)
+	if len(e.history) > maxHistory {
+		e.history = e.history[1:]
+	}
+	if file == "" {
+		return
+	}
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600) // It may hold passwords.
+	if err != nil {
+		return // History is a convenience; never fail a command over it.
+	}
+	defer f.Close() // Ensure the file is closed after writing.
+	fmt.Fprintln(f, line)
+}
+
+// readLine prompts for and returns one line, without its newline. It
+// returns io.EOF for Ctrl-D on an empty line and errInterrupted for Ctrl-C.
+func (e *lineEditor) readLine(prompt string) (string, error) {
+	restore, err := makeRaw(e.in)
+	if err != nil {
+		return e.readPlain(prompt) // Piped input, or no raw mode here.
+	}
+	defer restore() // Give the terminal back before the reply is printed.
+	return e.edit(prompt)
+}
+
+// readPlain reads a line without editing.
+func (e *lineEditor) readPlain(prompt string) (string, error) {
+	fmt.Fprint(e.out, prompt)
+	line, err := e.r.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil // A last line without a newline still counts.
+	}
+	return strings.TrimRight(line, "\r\n"), err
+}
+
+// Control keys understood by edit.
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyBackspace = 8
+	keyTab       = 9
+	keyCtrlK     = 11
+	keyCtrlL     = 12
+	keyEnter     = 13
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlU     = 21
+	keyCtrlW     = 23
+	keyEscape    = 27
+	keyDelete    = 127
+)
+
+// edit runs the editing loop in raw mode.
+func (e *lineEditor) edit(prompt string) (string, error) {
+	var line []rune
+	pos := 0                 // Cursor position in line.
+	index := len(e.history)  // History entry shown; len(e.history) is the new line.
+	draft := ""              // The new line, kept while browsing the history.
+	show := func(s string) { // Replace the line with s, cursor at the end.
+		line = []rune(s)
+		pos = len(line)
+	}
+	e.redraw(prompt, line, pos)
+	for {
+		r, _, err := e.r.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		switch r {
+		case keyEnter, '\n':
+			fmt.Fprint(e.out, "\r\n")
+			return string(line), nil
+		case keyCtrlC:
+			fmt.Fprint(e.out, "^C\r\n")
+			return "", errInterrupted
+		case keyCtrlD:
+			if len(line) == 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return "", io.EOF
+			}
+			if pos < len(line) {
+				line = append(line[:pos], line[pos+1:]...)
+			}
+		case keyBackspace, keyDelete:
+			if pos > 0 {
+				line = append(line[:pos-1], line[pos:]...)
+				pos--
+			}
+		case keyTab:
+			line, pos = e.completeLine(line, pos)
+		case keyCtrlA:
+			pos = 0
+		case keyCtrlE:
+			pos = len(line)
+		case keyCtrlB:
+			pos = max(pos-1, 0)
+		case keyCtrlF:
+			pos = min(pos+1, len(line))
+		case keyCtrlK:
+			line = line[:pos]
+		case keyCtrlU:
+			line, pos = line[pos:], 0
+		case keyCtrlW:
+			start := pos
+			for start > 0 && line[start-1] == ' ' {
+				start--
+			}
+			for start > 0 && line[start-1] != ' ' {
+				start--
+			}
+			line, pos = append(line[:start], line[pos:]...), start
+		case keyCtrlL:
+			fmt.Fprint(e.out, "\x1b[H\x1b[2J") // Clear the screen.
+		case keyCtrlP, keyCtrlN:
+			index, draft = e.browse(index, r == keyCtrlP, line, draft, show)
+		case keyEscape:
+			switch e.escape() {
+			case 'A':
+				index, draft = e.browse(index, true, line, draft, show)
+			case 'B':
+				index, draft = e.browse(index, false, line, draft, show)
+			case 'C':
+				pos = min(pos+1, len(line))
+			case 'D':
+				pos = max(pos-1, 0)
+			case 'H':
+				pos = 0
+			case 'F':
+				pos = len(line)
+			case '~': // Delete.
+				if pos < len(line) {
+					line = append(line[:pos], line[pos+1:]...)
+				}
+			}
+		default:
+			if r < ' ' {
+				continue // Other control keys do nothing.
+			}
+			line = append(line[:pos], append([]rune{r}, line[pos:]...)...)
+			pos++
+		}
+		e.redraw(prompt, line, pos)
+	}
+}
+
+// escape reads the rest of an escape sequence and returns its final byte,
+// with the delete key's ESC [ 3 ~ reported as '~' and ESC O x as x.
+func (e *lineEditor) escape() byte {
+	b, err := e.r.ReadByte()
+	if err != nil || b != '[' && b != 'O' {
+		return 0
+	}
+	for {
+		c, err := e.r.ReadByte()
+		if err != nil {
+			return 0
+		}
+		if c < '0' || c > '9' && c != ';' { // Parameters are digits and semicolons.
+			return c
+		}
+	}
+}
+
+// browse moves through the history, up towards older lines or down towards
+// the new one, and returns the new position and draft.
+func (e *lineEditor) browse(index int, up bool, line []rune, draft string, show func(string)) (int, string) {
+	if index == len(e.history) {
+		draft = string(line) // Leaving the new line; keep what was typed.
+	}
+	switch {
+	case up && index > 0:
+		index--
+	case !up && index < len(e.history):
+		index++
+	default:
+		return index, draft
+	}
+	if index == len(e.history) {
+		show(draft)
+	} else {
+		show(e.history[index])
+	}
+	return index, draft
+}
+
+// completeLine completes the first word when the cursor is inside it: a
+// single candidate is filled in with a space after it, several are filled
+// in as far as they agree and, if that adds nothing, listed.
+func (e *lineEditor) completeLine(line []rune, pos int) ([]rune, int) {
+	word := string(line[:pos])
+	if strings.ContainsAny(word, " \t") || e.complete == nil {
+		return line, pos // Only command names are completed.
+	}
+	matches := e.complete(word)
+	switch len(matches) {
+	case 0:
+		fmt.Fprint(e.out, "\a") // Ring the bell.
+		return line, pos
+	case 1:
+		return e.replaceWord(line, pos, matches[0]+" ")
+	}
+	common := matches[0]
+	for _, m := range matches[1:] {
+		for !strings.HasPrefix(m, common) {
+			common = common[:len(common)-1]
+		}
+	}
+	if len(common) > len(word) {
+		return e.replaceWord(line, pos, common)
+	}
+	fmt.Fprintf(e.out, "\r\n%s\r\n", strings.Join(matches, "  "))
+	return line, pos
+}
+
+// replaceWord replaces line[:pos] with word and puts the cursor after it.
+func (e *lineEditor) replaceWord(line []rune, pos int, word string) ([]rune, int) {
+	rest := line[pos:]
+	if strings.HasSuffix(word, " ") && len(rest) > 0 && rest[0] == ' ' {
+		word = strings.TrimSuffix(word, " ") // Don't double the space.
+	}
+	out := append([]rune(word), rest...)
+	return out, len([]rune(word))
+}
+
+// redraw rewrites the current line and puts the cursor at pos.
+func (e *lineEditor) redraw(prompt string, line []rune, pos int) {
+	s := "\r" + prompt + string(line) + "\x1b[K" // Clear whatever the old line left.
+	if back := len(line) - pos; back > 0 {
+		s += fmt.Sprintf("\x1b[%dD", back)
+	}
+	fmt.Fprint(e.out, s)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// typed returns an editor that reads the keys in input and echoes to out.
+func typed(input string, out io.Writer) *lineEditor {
+	e := newLineEditor(nil, out, completeCommand)
+	e.r = bufio.NewReader(strings.NewReader(input))
+	return e
+}
+
+func TestLineEditorEdit(t *testing.T) {
+	for _, tc := range []struct {
+		name, input, want string
+	}{
+		{"plain", "get k\r", "get k"},
+		{"backspace", "gett\x7f k\r", "get k"},
+		{"insert at the start", "et k\x01g\r", "get k"},
+		{"arrow keys", "gt k\x1b[D\x1b[D\x1b[De\r", "get k"},
+		{"home and end", "et\x1b[Hg\x1b[F k\r", "get k"},
+		{"delete key", "gxet k\x01\x06\x1b[3~\r", "get k"},
+		{"ctrl-k", "get k rest\x02\x02\x02\x02\x02\x0b\r", "get k"},
+		{"ctrl-u", "junk\x15get k\r", "get k"},
+		{"ctrl-w", "get junk\x17k\r", "get k"},
+		{"ctrl-d deletes under the cursor", "gext k\x01\x06\x06\x04\r", "get k"},
+		{"other control keys", "get\x07 k\r", "get k"},
+		{"unicode", "set k héllo\r", "set k héllo"},
+		{"complete a single command", "HGETA\tk\r", "HGETALL k"},
+		{"complete lower case", "hgeta\tk\r", "hgetall k"},
+		{"complete the common prefix", "XREA\t\r", "XREAD"},
+		{"complete before a space", "hgeta k\x02\x02\t\r", "hgetall k"},
+		{"complete only the first word", "get xr\t\r", "get xr"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := typed(tc.input, io.Discard).edit("> ")
+			if err != nil || got != tc.want {
+				t.Errorf("edit = %q, %v; want %q", got, err, tc.want)
+			}
+		})
+	}
+
+	var out strings.Builder
+	if _, err := typed("abc\x03", &out).edit("> "); !errors.Is(err, errInterrupted) {
+		t.Errorf("Ctrl-C: %v, want errInterrupted", err)
+	}
+	if _, err := typed("\x04", io.Discard).edit("> "); err != io.EOF {
+		t.Errorf("Ctrl-D on an empty line: %v, want io.EOF", err)
+	}
+	if _, err := typed("QQQ\t", &out).edit("> "); err != io.EOF || !strings.Contains(out.String(), "\a") {
+		t.Errorf("completing nothing: %v, output %q; want the bell", err, out.String())
+	}
+	out.Reset()
+	typed("s\t\t\r", &out).edit("> ")
+	if !strings.Contains(out.String(), "set  swapdb  setnx") {
+		t.Errorf("completing an ambiguous prefix printed %q, want the candidates listed", out.String())
+	}
+}
+
+func TestLineEditorHistory(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "history")
+	e := typed("", io.Discard)
+	for _, line := range []string{"get a", "get b", "get b", "get c"} {
+		e.addHistory(line, file)
+	}
+	if want := []string{"get a", "get b", "get c"}; !slices.Equal(e.history, want) {
+		t.Errorf("history = %q, want %q: repeats are dropped", e.history, want)
+	}
+	if info, err := os.Stat(file); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("history file: %v, want mode 0600", err)
+	}
+
+	loaded := typed("", io.Discard)
+	loaded.loadHistory(file)
+	if !slices.Equal(loaded.history, e.history) {
+		t.Errorf("loaded history = %q, want %q", loaded.history, e.history)
+	}
+	for _, tc := range []struct {
+		name, input, want string
+	}{
+		{"up once", "\x1b[A\r", "get c"},
+		{"up twice", "\x1b[A\x1b[A\r", "get b"},
+		{"past the oldest", "\x10\x10\x10\x10\r", "get a"},
+		{"down keeps the draft", "draft\x1b[A\x1b[A\x1b[B\x1b[B\r", "draft"},
+		{"edit a recalled line", "\x10\x7fz\r", "get z"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			loaded.r = bufio.NewReader(strings.NewReader(tc.input))
+			if got, err := loaded.edit("> "); err != nil || got != tc.want {
+				t.Errorf("edit = %q, %v; want %q", got, err, tc.want)
+			}
+		})
+	}
+
+	for range maxHistory + 5 {
+		e.addHistory(strings.Repeat("x", len(e.history)%7+1), "")
+	}
+	if len(e.history) != maxHistory {
+		t.Errorf("history holds %d lines, want at most %d", len(e.history), maxHistory)
+	}
+}
+
+func TestLineEditorReadPlain(t *testing.T) {
+	e := typed("get a\r\nget b", io.Discard)
+	for _, want := range []string{"get a", "get b"} {
+		if got, err := e.readPlain("> "); err != nil || got != want {
+			t.Errorf("readPlain = %q, %v; want %q", got, err, want)
+		}
+	}
+	if _, err := e.readPlain("> "); err != io.EOF {
+		t.Errorf("readPlain at the end: %v, want io.EOF", err)
+	}
+}
@@ -0,0 +1,255 @@
+// Command cli is an interactive client for the RESP server, in the style of
+// redis-cli. Each line typed is split into arguments, sent as a command and
+// its reply pretty-printed; the up and down arrows walk the history, which
+// is kept in ~/.redis_cli_history, and Tab completes command names.
+// Arguments after the flags are run as one command instead, for scripts:
+//
+//	cli -addr localhost:6379 SET greeting hello
+//
+// With -tls it connects over TLS, verifying the server against -cacert and
+// presenting -cert and -key to servers that require client certificates.
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:6379", "address of the server")
+	password := flag.String("pass", "", "password to AUTH with")
+	useTLS := flag.Bool("tls", false, "connect over TLS")
+	caCert := flag.String("cacert", "", "PEM file of the authorities to trust with -tls; the system's by default")
+	cert := flag.String("cert", "", "PEM client certificate to present with -tls, for servers that verify clients")
+	key := flag.String("key", "", "PEM private key of -cert")
+	flag.Parse()
+
+	conn, err := dial(*addr, *useTLS, *caCert, *cert, *key)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not connect to %s: %v\n", *addr, err)
+		os.Exit(1)
+	}
+	c := newClient(conn)
+	defer c.Close() // Close the connection on exit.
+
+	if *password != "" {
+		if reply, err := c.do("AUTH", *password); err != nil || isError(reply) {
+			fmt.Fprintf(os.Stderr, "AUTH failed: %s\n", describe(reply, err))
+			os.Exit(1)
+		}
+	}
+	if flag.NArg() > 0 {
+		reply, err := c.do(flag.Args()...)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Println(formatReply(reply))
+		return
+	}
+	if err := repl(c, *addr+"> "); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// dial connects to the server, over TLS if useTLS is set.
+func dial(addr string, useTLS bool, caCert, cert, key string) (net.Conn, error) {
+	if !useTLS {
+		return net.Dial("tcp", addr)
+	}
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caCert != "" {
+		pem, err := os.ReadFile(caCert)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %s", caCert)
+		}
+	}
+	if cert != "" {
+		pair, err := tls.LoadX509KeyPair(cert, key)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{pair}
+	}
+	return tls.Dial("tcp", addr, cfg)
+}
+
+// repl reads commands from the terminal until EOF, exit or QUIT.
+func repl(c *client, prompt string) error {
+	editor := newLineEditor(os.Stdin, os.Stdout, completeCommand)
+	historyFile := ""
+	if home, err := os.UserHomeDir(); err == nil {
+		historyFile = filepath.Join(home, ".redis_cli_history")
+		editor.loadHistory(historyFile)
+	}
+	for {
+		line, err := editor.readLine(prompt)
+		if errors.Is(err, errInterrupted) {
+			continue // Ctrl-C abandons the line, as in a shell.
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		args, err := splitArgs(line)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		if len(args) == 0 {
+			continue
+		}
+		editor.addHistory(line, historyFile)
+		name := strings.ToUpper(args[0])
+		if name == "EXIT" {
+			return nil
+		}
+		reply, err := c.do(args...)
+		if err != nil {
+			return fmt.Errorf("connection lost: %w", err)
+		}
+		fmt.Println(formatReply(reply))
+		if name == "QUIT" {
+			return nil
+		}
+		if name == "SUBSCRIBE" && !isError(reply) {
+			return c.listen() // Only pub/sub commands are allowed from now on.
+		}
+	}
+}
+
+// listen prints pub/sub messages as they arrive, until the connection ends.
+func (c *client) listen() error {
+	fmt.Println("Reading messages... (press Ctrl-C to quit)")
+	for {
+		reply, err := c.read()
+		if err != nil {
+			return fmt.Errorf("connection lost: %w", err)
+		}
+		fmt.Println(formatReply(reply))
+	}
+}
+
+// describe words an AUTH failure.
+func describe(reply any, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return string(reply.(replyError))
+}
+
+// commandNames are what Tab completes: the server's commands, including
+// those it handles per connection.
+var commandNames = []string{
+	"AUTH", "CHECKSYNC", "CONFIG", "COPY", "DEBUG", "DECR", "DECRBY", "DEL", "DISCARD", "DUMP",
+	"ECHO", "EVAL", "EVALSHA", "EXEC", "EXISTS", "FCALL", "GET", "HELLO", "HGETALL", "HSET",
+	"INCR", "INCRBY", "INFO", "KEYS", "MGET", "MSET", "MULTI", "PFADD", "PFCOUNT", "PFMERGE", "PING",
+	"PUBLISH", "QUIT", "RENAME", "REPLICAOF", "RESTORE",
+	"SCRIPT", "SELECT", "SET", "SWAPDB", "SETNX", "GETSET", "SUBSCRIBE", "UNSUBSCRIBE", "UNWATCH", "WATCH", "XACK", "XADD",
+	"XGROUP", "XRANGE", "XREAD", "XREADGROUP", "ZSCORE",
+}
+
+// completeCommand returns the command names that start with prefix, in
+// lower case if prefix is.
+func completeCommand(prefix string) []string {
+	lower := prefix != "" && strings.ToLower(prefix) == prefix
+	var matches []string
+	for _, name := range commandNames {
+		if strings.HasPrefix(name, strings.ToUpper(prefix)) {
+			if lower {
+				name = strings.ToLower(name)
+			}
+			matches = append(matches, name)
+		}
+	}
+	return matches
+}
+
+// errBadQuotes reports a line whose quotes do not pair up.
+var errBadQuotes = errors.New("Invalid argument(s): unbalanced quotes")
+
+// splitArgs splits a line into arguments at spaces, as redis-cli does.
+// An argument in double quotes may contain spaces and the escapes \n, \r,
+// \t, \", \\ and \xHH; one in single quotes only the escape \'.
+func splitArgs(line string) ([]string, error) {
+	var args []string
+	s := []rune(line)
+	for i := 0; i < len(s); {
+		if s[i] == ' ' || s[i] == '\t' {
+			i++
+			continue
+		}
+		var arg strings.Builder
+		for i < len(s) && s[i] != ' ' && s[i] != '\t' {
+			switch quote := s[i]; quote {
+			case '"', '\'':
+				i++
+				for ; i < len(s) && s[i] != quote; i++ {
+					if s[i] != '\\' || i+1 == len(s) {
+						arg.WriteRune(s[i])
+						continue
+					}
+					i++ // An escape.
+					switch {
+					case quote == '\'' && s[i] != '\'':
+						arg.WriteRune('\\') // Only \' is an escape in single quotes.
+						arg.WriteRune(s[i])
+					case quote == '\'':
+						arg.WriteRune('\'')
+					case s[i] == 'n':
+						arg.WriteByte('\n')
+					case s[i] == 'r':
+						arg.WriteByte('\r')
+					case s[i] == 't':
+						arg.WriteByte('\t')
+					case s[i] == 'x' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2]):
+						arg.WriteByte(byte(hexValue(s[i+1])<<4 | hexValue(s[i+2])))
+						i += 2
+					default:
+						arg.WriteRune(s[i]) // \" and \\ among others.
+					}
+				}
+				if i == len(s) {
+					return nil, errBadQuotes
+				}
+				i++ // The closing quote.
+			default:
+				arg.WriteRune(s[i])
+				i++
+			}
+		}
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
+
+// isHex reports whether r is a hexadecimal digit.
+func isHex(r rune) bool {
+	return r >= '0' && r <= '9' || r >= 'a' && r <= 'f' || r >= 'A' && r <= 'F'
+}
+
+// hexValue returns the value of the hexadecimal digit r.
+func hexValue(r rune) int {
+	switch {
+	case r >= 'a':
+		return int(r-'a') + 10
+	case r >= 'A':
+		return int(r-'A') + 10
+	}
+	return int(r - '0')
+}
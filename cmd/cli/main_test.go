@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestSplitArgs(t *testing.T) {
+	for _, tc := range []struct {
+		line string
+		want []string
+	}{
+		{"", nil},
+		{"  get   k  ", []string{"get", "k"}},
+		{"set k\t\"two words\"", []string{"set", "k", "two words"}},
+		{`set k "a\"b\\c\n\t\x41"`, []string{"set", "k", "a\"b\\c\n\tA"}},
+		{`set k 'it\'s \n'`, []string{"set", "k", `it's \n`}},
+		{`set k ab"c d"e`, []string{"set", "k", "abc de"}},
+		{`set k ""`, []string{"set", "k", ""}},
+		{`echo "\xZZ"`, []string{"echo", "xZZ"}},
+	} {
+		if got, err := splitArgs(tc.line); err != nil || !slices.Equal(got, tc.want) {
+			t.Errorf("splitArgs(%q) = %q, %v; want %q", tc.line, got, err, tc.want)
+		}
+	}
+	for _, line := range []string{`set k "open`, `set k 'open`, `set k "ends in \"`} {
+		if _, err := splitArgs(line); !errors.Is(err, errBadQuotes) {
+			t.Errorf("splitArgs(%q) error = %v, want errBadQuotes", line, err)
+		}
+	}
+}
+
+func TestCompleteCommand(t *testing.T) {
+	for _, tc := range []struct {
+		prefix string
+		want   []string
+	}{
+		{"HGETA", []string{"HGETALL"}},
+		{"hgeta", []string{"hgetall"}},
+		{"XRead", []string{"XREAD", "XREADGROUP"}},
+		{"nope", nil},
+	} {
+		if got := completeCommand(tc.prefix); !slices.Equal(got, tc.want) {
+			t.Errorf("completeCommand(%q) = %q, want %q", tc.prefix, got, tc.want)
+		}
+	}
+	if n := len(completeCommand("")); n != len(commandNames) {
+		t.Errorf("completeCommand(\"\") returned %d names, want all %d", n, len(commandNames))
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// makeRaw reports that raw mode is unavailable on this platform, so the
+// editor falls back to reading plain lines, without history recall or
+// completion.
+func makeRaw(f *os.File) (func(), error) {
+	return nil, errors.New("raw terminal mode is not supported on this platform")
+}
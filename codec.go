@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Codec is a snapshot file format, for PersistWith and LoadWith. The
+// formats are fixed, since each needs to know the store's own types:
+//
+//   - GobCodec is the checksummed binary snapshot of Persist and Load.
+//   - JSONCodec is the enveloped JSON document of PersistJSON and LoadJSON.
+//   - MsgpackCodec is the same document as JSONCodec encoded as
+//     MessagePack, for a compact file other languages can still read.
+type Codec interface {
+	// Name names the format in logs and errors.
+	Name() string
+
+	persist(db *DataBase, fileName string) error // Writes and logs a snapshot.
+	load(db *DataBase, fileName string) error    // Merges a snapshot into db.
+}
+
+// The snapshot codecs.
+var (
+	GobCodec     Codec = gobCodec{}
+	JSONCodec    Codec = jsonCodec{}
+	MsgpackCodec Codec = msgpackCodec{}
+)
+
+// PersistWith saves the database to fileName in the format of codec.
+// PersistWith(GobCodec) is Persist and PersistWith(JSONCodec) is
+// PersistJSON; the rules for TTLs and unencodable values are those of the
+// codec's format.
+func (db *DataBase) PersistWith(fileName string, codec Codec) error {
+	return codec.persist(db, fileName)
+}
+
+// LoadWith merges a snapshot written by PersistWith with the same codec
+// into the database, as Load does for its own files.
+func (db *DataBase) LoadWith(fileName string, codec Codec) error {
+	return codec.load(db, fileName)
+}
+
+// gobCodec is the binary snapshot format of Persist.
+type gobCodec struct{}
+
+// Name returns "gob".
+func (gobCodec) Name() string { return "gob" }
+
+// persist writes the binary snapshot.
+func (gobCodec) persist(db *DataBase, fileName string) error { return db.Persist(fileName) }
+
+// load reads the binary snapshot.
+func (gobCodec) load(db *DataBase, fileName string) error { return db.Load(fileName) }
+
+// jsonCodec is the JSON document format of PersistJSON.
+type jsonCodec struct{}
+
+// Name returns "json".
+func (jsonCodec) Name() string { return "json" }
+
+// persist writes the JSON document.
+func (jsonCodec) persist(db *DataBase, fileName string) error { return db.PersistJSON(fileName) }
+
+// load reads the JSON document.
+func (jsonCodec) load(db *DataBase, fileName string) error { return db.LoadJSON(fileName) }
+
+// msgpackCodec is the JSON document's structure encoded as MessagePack.
+type msgpackCodec struct{}
+
+// Name returns "msgpack".
+func (msgpackCodec) Name() string { return "msgpack" }
+
+// persist writes the document as MessagePack.
+func (msgpackCodec) persist(db *DataBase, fileName string) error {
+	err := persistMsgpack(db, fileName)
+	db.logSave(fileName, err)
+	return err
+}
+
+// persistMsgpack builds the envelopes as for JSON and re-encodes them, so
+// both formats restore the same types.
+func persistMsgpack(db *DataBase, fileName string) error {
+	release, err := db.acquireSave(fileName) // One writer per file at a time.
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	snap, skipped := db.jsonDocument()
+	doc, err := json.Marshal(&snap)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.UseNumber() // Keep integers exact rather than going through float64.
+	var tree any
+	if err := dec.Decode(&tree); err != nil {
+		return err
+	}
+	return db.writeDocument(fileName, skipped, func(w io.Writer) error {
+		mw := &msgpackWriter{}
+		if err := mw.write(tree); err != nil {
+			return err
+		}
+		_, err := w.Write(mw.buf)
+		return err
+	})
+}
+
+// load reads a MessagePack document and restores it as LoadJSON would.
+func (msgpackCodec) load(db *DataBase, fileName string) error {
+	file, err := db.backend.Load(fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close() // Ensure the file is closed after reading.
+	blob, err := io.ReadAll(file)
+	if err != nil {
+		return err
+	}
+	mr := &msgpackReader{buf: blob}
+	tree, err := mr.read()
+	if err == nil && len(mr.buf) > 0 {
+		err = fmt.Errorf("%d trailing bytes", len(mr.buf))
+	}
+	if err != nil {
+		return fmt.Errorf("msgpack snapshot: %w", err)
+	}
+	doc, err := json.Marshal(tree)
+	if err != nil {
+		return fmt.Errorf("msgpack snapshot: %w", err)
+	}
+	var snap jsonSnapshot
+	if err := json.Unmarshal(doc, &snap); err != nil {
+		return fmt.Errorf("msgpack snapshot: %w", err)
+	}
+	return db.loadDocument(fileName, "msgpack", snap)
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+// command executes one RESP command. args excludes the command name.
+type command struct {
+	minArgs int // Fewest arguments accepted.
+	maxArgs int // Most arguments accepted, or -1 for no limit.
+	run     func(db *DataBase, args []string) any
+	keyed   bool // The first argument is a key, recorded on trace spans.
+}
+
+// commands is the dispatch table of the RESP server, keyed by upper-case name.
+var commands = map[string]command{
+	"PING":   {0, 1, cmdPing, false},
+	"ECHO":   {1, 1, func(db *DataBase, args []string) any { return args[0] }, false},
+	"QUIT":   {0, 0, func(db *DataBase, args []string) any { return simpleString("OK") }, false},
+	"GET":    {1, 1, cmdGet, true},
+	"SET":    {2, 2, cmdSet, true},
+	"SETNX":  {2, 2, cmdSetNX, true},
+	"GETSET": {2, 2, cmdGetSet, true},
+	"MSET":   {2, -1, cmdMSet, true},
+	"MGET":   {1, -1, cmdMGet, true},
+	"DEL":    {1, -1, cmdDel, true},
+	"EXISTS": {1, -1, cmdExists, true},
+	"KEYS":   {1, 1, cmdKeys, false},
+	"INCR":   {1, 1, cmdIncr, true},
+	"DECR":   {1, 1, cmdDecr, true},
+	"INCRBY": {2, 2, cmdIncrBy, true},
+	"DECRBY": {2, 2, cmdDecrBy, true},
+
+	"RENAME":  {2, 2, cmdRename, true},
+	"COPY":    {2, 3, cmdCopy, true},
+	"DUMP":    {1, 1, cmdDump, true},
+	"RESTORE": {3, 4, cmdRestore, true},
+
+	"HSET":    {3, -1, cmdHSet, true},
+	"HGETALL": {1, 1, cmdHGetAll, true},
+	"ZSCORE":  {2, 2, cmdZScore, true},
+
+	"PFADD":   {1, -1, cmdPFAdd, true},
+	"PFCOUNT": {1, -1, cmdPFCount, true},
+	"PFMERGE": {1, -1, cmdPFMerge, true},
+
+	"XADD":       {4, -1, cmdXAdd, true},
+	"XRANGE":     {3, 5, cmdXRange, true},
+	"XREAD":      {3, -1, cmdXRead, false},
+	"XREADGROUP": {6, -1, cmdXReadGroup, false},
+	"XGROUP":     {1, 5, cmdXGroup, false},
+	"XACK":       {3, -1, cmdXAck, true},
+
+	"PUBLISH": {2, 2, cmdPublish, false},
+
+	"REPLICAOF": {2, 2, cmdReplicaOf, false},
+	"CHECKSYNC": {0, 0, cmdCheckSync, false},
+
+	"FCALL":   {2, -1, cmdFCall, false},
+	"EVAL":    {2, -1, cmdEval, false},
+	"EVALSHA": {2, -1, cmdEvalSHA, false},
+	"SCRIPT":  {1, -1, cmdScript, false},
+	"CONFIG":  {1, -1, cmdConfig, false},
+	"INFO":    {0, -1, cmdInfo, false},
+
+	"DEBUG": {1, -1, cmdDebug, false},
+}
+
+// dispatch runs a command, waiting for any EXEC in progress to finish.
+func (s *Server) dispatch(sess *session, args []string) any {
+	s.execMu.RLock()         // EXEC takes the write side to run alone.
+	defer s.execMu.RUnlock() // Release the lock when the function exits.
+	return s.run(sess, args)
+}
+
+// lookupCommand finds a command and validates its arity.
+func lookupCommand(args []string) (string, command, error) {
+	name := strings.ToUpper(args[0])
+	cmd, ok := commands[name]
+	if !ok {
+		return "", command{}, fmt.Errorf("unknown command '%s'", args[0])
+	}
+	params := args[1:]
+	if len(params) < cmd.minArgs || (cmd.maxArgs >= 0 && len(params) > cmd.maxArgs) {
+		return "", command{}, fmt.Errorf("wrong number of arguments for '%s' command", strings.ToLower(name))
+	}
+	return name, cmd, nil
+}
+
+// run looks up and runs a command against the client's database. The
+// caller must hold execMu.
+func (s *Server) run(sess *session, args []string) any {
+	if isDBCommand(args[0]) {
+		return s.dbCommand(sess, args)
+	}
+	name, cmd, err := lookupCommand(args)
+	if err != nil {
+		return err
+	}
+	params := args[1:]
+	cmd = scriptingAs(name, cmd, sess.user)
+	if s.cfg.Tracer != nil {
+		return s.traceCommand(sess.db, name, cmd, params)
+	}
+	return cmd.run(sess.db, params)
+}
+
+// cmdPing replies PONG, or echoes its optional argument.
+func cmdPing(db *DataBase, args []string) any {
+	if len(args) == 1 {
+		return args[0]
+	}
+	return simpleString("PONG")
+}
+
+// cmdGet returns a key's value as a bulk string.
+func cmdGet(db *DataBase, args []string) any {
+	value, ok := db.Get(args[0])
+	if !ok {
+		return nil // Null bulk string.
+	}
+	return stringReply(value)
+}
+
+// cmdSet stores a string value.
+func cmdSet(db *DataBase, args []string) any {
+	if err := db.Set(args[0], args[1]); err != nil {
+		return err
+	}
+	return simpleString("OK")
+}
+
+// cmdSetNX stores a string value if the key is new, replying 1 if it was.
+func cmdSetNX(db *DataBase, args []string) any {
+	set, err := db.SetNX(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	if set {
+		return 1
+	}
+	return 0
+}
+
+// cmdGetSet stores a string value and replies with the one it replaced.
+func cmdGetSet(db *DataBase, args []string) any {
+	old, existed, err := db.GetSet(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	if !existed {
+		return nil // Null bulk string.
+	}
+	return stringReply(old)
+}
+
+// cmdMSet stores string values for key value [key value ...] at once.
+func cmdMSet(db *DataBase, args []string) any {
+	if len(args)%2 != 0 {
+		return fmt.Errorf("wrong number of arguments for 'mset' command")
+	}
+	pairs := make(map[string]any, len(args)/2)
+	for i := 0; i < len(args); i += 2 {
+		pairs[args[i]] = args[i+1] // A repeated key keeps its last value, as in Redis.
+	}
+	if err := db.MSet(pairs); err != nil {
+		return err
+	}
+	return simpleString("OK")
+}
+
+// cmdMGet replies with the values of the keys, null for missing ones and,
+// as in Redis, for those holding a collection.
+func cmdMGet(db *DataBase, args []string) any {
+	values := db.MGet(args...)
+	reply := make([]any, len(values))
+	for i, value := range values {
+		if s := stringReply(value); value != nil && s != ErrWrongType {
+			reply[i] = s
+		}
+	}
+	return reply
+}
+
+// cmdDel deletes keys and replies with how many existed.
+func cmdDel(db *DataBase, args []string) any {
+	deleted := 0
+	for _, key := range args {
+		if db.Delete(key) {
+			deleted++
+		}
+	}
+	return deleted
+}
+
+// cmdExists replies with how many of the keys exist.
+func cmdExists(db *DataBase, args []string) any {
+	return db.Exists(args...)
+}
+
+// cmdKeys replies with the keys matching a glob pattern.
+func cmdKeys(db *DataBase, args []string) any {
+	return db.Keys(args[0])
+}
+
+// cmdIncr increments a counter by one and replies with its new value.
+func cmdIncr(db *DataBase, args []string) any {
+	return counterReply(db.Incr(args[0]))
+}
+
+// cmdDecr decrements a counter by one and replies with its new value.
+func cmdDecr(db *DataBase, args []string) any {
+	return counterReply(db.Decr(args[0]))
+}
+
+// cmdIncrBy adds an integer to a counter and replies with its new value.
+func cmdIncrBy(db *DataBase, args []string) any {
+	delta, ok := parseInt(args[1])
+	if !ok {
+		return ErrNotInteger
+	}
+	return counterReply(db.IncrBy(args[0], delta))
+}
+
+// cmdDecrBy subtracts an integer from a counter and replies with its new
+// value.
+func cmdDecrBy(db *DataBase, args []string) any {
+	delta, ok := parseInt(args[1])
+	if !ok {
+		return ErrNotInteger
+	}
+	return counterReply(db.DecrBy(args[0], delta))
+}
+
+// counterReply turns a counter result into an integer or error reply.
+func counterReply(n int64, err error) any {
+	if err != nil {
+		return err
+	}
+	return n
+}
+
+// cmdHSet stores field-value pairs in a hash and replies with how many
+// fields were added rather than updated.
+func cmdHSet(db *DataBase, args []string) any {
+	if len(args)%2 == 0 {
+		return fmt.Errorf("wrong number of arguments for 'hset' command") // A field without a value.
+	}
+	added := 0
+	for i := 1; i < len(args); i += 2 {
+		created, err := db.HSet(args[0], args[i], args[i+1])
+		if err != nil {
+			return err
+		}
+		if created {
+			added++
+		}
+	}
+	return added
+}
+
+// cmdHGetAll replies with a hash's fields and values as a map, sorted by
+// field; RESP2 clients see it as a flat array.
+func cmdHGetAll(db *DataBase, args []string) any {
+	hash, err := db.HGetAll(args[0])
+	if err != nil {
+		return err
+	}
+	fields := slices.Sorted(maps.Keys(hash))
+	reply := make(respMap, 0, 2*len(fields))
+	for _, field := range fields {
+		reply = append(reply, field, stringReply(hash[field]))
+	}
+	return reply
+}
+
+// cmdZScore replies with a member's score, a double under RESP3.
+func cmdZScore(db *DataBase, args []string) any {
+	score, ok, err := db.ZScore(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return nil
+	}
+	return score
+}
+
+// cmdRename handles RENAME src dst.
+func cmdRename(db *DataBase, args []string) any {
+	if err := db.Rename(args[0], args[1]); err != nil {
+		return err
+	}
+	return simpleString("OK")
+}
+
+// cmdCopy handles COPY src dst [REPLACE], replying 1 if the key was copied.
+func cmdCopy(db *DataBase, args []string) any {
+	if len(args) == 3 && !strings.EqualFold(args[2], "REPLACE") {
+		return errSyntax
+	}
+	copied, err := db.Copy(args[0], args[1], len(args) == 3)
+	if err != nil {
+		return err
+	}
+	if copied {
+		return 1
+	}
+	return 0
+}
+
+// cmdDump replies with a key's serialized value, or null if it is missing.
+func cmdDump(db *DataBase, args []string) any {
+	data, err := db.Dump(args[0])
+	if err != nil {
+		return err
+	}
+	if data == nil {
+		return nil
+	}
+	return data
+}
+
+// cmdRestore handles RESTORE key ttl payload [REPLACE], with the TTL in
+// milliseconds and 0 for none.
+func cmdRestore(db *DataBase, args []string) any {
+	if len(args) == 4 && !strings.EqualFold(args[3], "REPLACE") {
+		return errSyntax
+	}
+	ms, ok := parseInt(args[1])
+	if !ok {
+		return ErrNotInteger
+	}
+	if ms < 0 {
+		return errors.New("ERR Invalid TTL value, must be >= 0")
+	}
+	if err := db.RestoreKey(args[0], []byte(args[2]), time.Duration(ms)*time.Millisecond, len(args) == 4); err != nil {
+		return err
+	}
+	return simpleString("OK")
+}
+
+// cmdPFAdd replies 1 if PFADD changed the counter's estimate, 0 if not.
+func cmdPFAdd(db *DataBase, args []string) any {
+	items := make([]any, len(args)-1)
+	for i, item := range args[1:] {
+		items[i] = item
+	}
+	changed, err := db.PFAdd(args[0], items...)
+	if err != nil {
+		return err
+	}
+	if changed {
+		return 1
+	}
+	return 0
+}
+
+// cmdPFCount replies with the estimated number of distinct items.
+func cmdPFCount(db *DataBase, args []string) any {
+	n, err := db.PFCount(args...)
+	if err != nil {
+		return err
+	}
+	return n
+}
+
+// cmdPFMerge merges counters into the first key.
+func cmdPFMerge(db *DataBase, args []string) any {
+	if err := db.PFMerge(args[0], args[1:]...); err != nil {
+		return err
+	}
+	return simpleString("OK")
+}
+
+// cmdPublish sends a message to a channel's subscribers and replies with
+// how many received it.
+func cmdPublish(db *DataBase, args []string) any {
+	return db.Publish(args[0], args[1])
+}
+
+// stringReply renders a stored value for string commands. Collection types
+// are rejected with WRONGTYPE, just as Redis does for GET on a list.
+func stringReply(value any) any {
+	switch v := value.(type) {
+	case string, []byte:
+		return v
+	case List, Hash, Set, *ZSet, *Stream, *HyperLogLog:
+		return ErrWrongType
+	}
+	return fmt.Sprint(value) // Numbers and other scalars in their text form.
+}
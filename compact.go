@@ -0,0 +1,102 @@
+package main
+
+import "time"
+
+// rehashChunk is how many entries one short lock window migrates.
+const rehashChunk = 1024
+
+// removeKey deletes a key together with its metadata, counting the deletion
+// towards automatic compaction. The caller must hold the write lock.
+func (db *DataBase) removeKey(key string) {
+	db.removeKeyFor(key, EventDel)
+}
+
+// removeKeyFor implements removeKey, reporting the removal to Notify
+// watchers as event.
+func (db *DataBase) removeKeyFor(key, event string) {
+	db.data.del(key)
+	db.expires.del(key)
+	delete(db.fieldExpires, key)
+	db.untag(key)
+	db.bury(key)
+	delete(db.priorVersions, key)
+	if db.recency != nil {
+		db.recency.forget(key)
+	}
+	if db.lfu != nil {
+		db.lfu.forget(key)
+	}
+	db.untrackSize(key)
+	db.recordChange(key, true)
+	db.logChange(key)
+	db.notify.send(key, event)
+	db.deletes++
+	db.changed()
+	if db.compactThreshold > 0 && db.deletes >= db.compactThreshold {
+		db.compact() // Enough churn to make rebuilding worthwhile.
+	}
+}
+
+// Compact rebuilds the internal maps into fresh ones sized to the current
+// number of keys. Go maps never shrink, so a store that grew large and then
+// had most of its keys deleted keeps the peak-sized backing storage until it
+// is compacted.
+//
+// The rebuild is incremental, like Redis's rehashing: Compact only swaps in
+// the new, empty maps and returns, and a background goroutine then migrates
+// the entries in chunks of rehashChunk, each under its own short write lock.
+// Until it finishes, reads and writes are served from both maps, so no call
+// observes the migration; Rehashing reports whether one is still running.
+// Calling Compact during a rehash has no further effect.
+func (db *DataBase) Compact() {
+	db.lock.Lock()         // Acquire a write lock to swap the maps.
+	defer db.lock.Unlock() // Release the lock when the function exits.
+	db.compact()
+}
+
+// Rehashing reports whether a Compact is still migrating entries.
+func (db *DataBase) Rehashing() bool {
+	db.lock.RLock()         // Acquire a read lock.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+	return db.data.rehashing() || db.expires.rehashing()
+}
+
+// compact starts the incremental rebuild. The caller must hold the write lock.
+func (db *DataBase) compact() {
+	db.deletes = 0 // Start counting churn afresh.
+	if db.data.rehashing() || db.expires.rehashing() {
+		return // The running rehash already targets right-sized maps.
+	}
+	db.data.startRehash()
+	db.expires.startRehash()
+
+	// The field TTL table is small next to the keyspace; rebuild it at once.
+	fieldExpires := make(map[string]map[string]time.Time, len(db.fieldExpires))
+	for key, fields := range db.fieldExpires {
+		fieldExpires[key] = fields
+	}
+	db.fieldExpires = fieldExpires
+
+	db.logger.Debug("compaction started", "keys", db.data.len())
+	db.spawn(db.rehash)
+}
+
+// rehash migrates entries in short lock windows until both dicts are done
+// or the database is closed.
+func (db *DataBase) rehash() {
+	for {
+		select {
+		case <-db.stop:
+			return // Closing; the dicts stay usable in their split state.
+		default:
+		}
+		db.lock.Lock()
+		done := db.data.rehashStep(rehashChunk)
+		done = db.expires.rehashStep(rehashChunk) && done
+		db.lock.Unlock()
+		if done {
+			db.logger.Debug("compaction finished")
+			return
+		}
+	}
+}
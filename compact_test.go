@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCompactKeepsBehavior(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1_000_000, 0))
+	db := NewDataBase(WithClock(clock))
+	defer db.Close()
+	for i := range 20_000 {
+		db.Set(fmt.Sprintf("key%d", i), i)
+	}
+	for i := range 20_000 {
+		if i%100 != 0 {
+			db.Delete(fmt.Sprintf("key%d", i))
+		}
+	}
+	db.SetWithTTL("key0", 0, time.Minute)
+	db.HSetEX("hash", "f", "v", time.Minute)
+
+	db.Compact()
+	for deadline := time.Now().Add(10 * time.Second); db.Rehashing(); {
+		if time.Now().After(deadline) {
+			t.Fatal("the rehash did not finish")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if got := len(db.Keys("*")); got != 201 {
+		t.Errorf("%d keys after Compact, want 201", got)
+	}
+	for i := range 20_000 {
+		key := fmt.Sprintf("key%d", i)
+		value, ok := db.Get(key)
+		if want := i%100 == 0; ok != want || ok && value != i {
+			t.Fatalf("Get(%s) = %v, %v after Compact", key, value, ok)
+		}
+	}
+	if ttl := db.TTL("key0"); ttl != time.Minute {
+		t.Errorf("TTL(key0) = %v after Compact, want a minute", ttl)
+	}
+	clock.Advance(time.Minute)
+	if _, ok := db.Get("key0"); ok {
+		t.Error("key0 outlived its TTL after Compact")
+	}
+	if _, ok, _ := db.HGet("hash", "f"); ok {
+		t.Error("the hash field outlived its TTL after Compact")
+	}
+	db.Set("after", 1)
+	if value, _ := db.Get("after"); value != 1 {
+		t.Errorf("Get(after) = %v, want 1", value)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"sync"
+)
+
+// compressedValue is how a large string or []byte value is kept once
+// CompressLargeValues is on. Reads decompress it afresh every time, so the
+// store only ever holds the compressed bytes.
+type compressedValue struct {
+	data     []byte // DEFLATE-compressed payload.
+	size     int    // Length of the original value.
+	isString bool   // The original was a string rather than a []byte.
+}
+
+// CompressionStats describes the values kept compressed by
+// CompressLargeValues.
+type CompressionStats struct {
+	Values      int   // Values currently stored compressed.
+	RawBytes    int64 // Their total size uncompressed.
+	StoredBytes int64 // Their total size as stored.
+}
+
+// Ratio returns RawBytes divided by StoredBytes, or 1 if nothing is
+// compressed.
+func (s CompressionStats) Ratio() float64 {
+	if s.StoredBytes == 0 {
+		return 1
+	}
+	return float64(s.RawBytes) / float64(s.StoredBytes)
+}
+
+// CompressLargeValues keeps string and []byte values of at least threshold
+// bytes compressed in memory, which suits large logs or HTML documents.
+// Compression is transparent: Get, the string helpers such as GetString and
+// ReadRangeTo, and snapshots all see the original value, and MemoryUsage and
+// SetMaxMemory count the compressed size. Values that do not shrink are kept
+// as they are. Every read of a compressed value decompresses it, trading CPU
+// for memory, so set threshold well above the size of hot values. A
+// threshold of zero or less leaves compression off.
+func CompressLargeValues(threshold int) Option {
+	return func(db *DataBase) {
+		if threshold <= 0 {
+			return
+		}
+		db.data.store = func(v any) any { return compressValue(v, threshold) }
+		db.data.resolve = db.resolveValue
+	}
+}
+
+// CompressionStats reports how much CompressLargeValues is saving. It scans
+// every key, so it costs time proportional to the size of the store.
+func (db *DataBase) CompressionStats() CompressionStats {
+	db.lock.RLock()         // Acquire a read lock.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+	var stats CompressionStats
+	for _, v := range db.data.rawAll() {
+		if cv, ok := v.(*compressedValue); ok {
+			stats.Values++
+			stats.RawBytes += int64(cv.size)
+			stats.StoredBytes += int64(len(cv.data))
+		}
+	}
+	return stats
+}
+
+// flateWriters recycles compressors, each of which allocates several hundred
+// kilobytes of state.
+var flateWriters = sync.Pool{New: func() any {
+	w, _ := flate.NewWriter(nil, flate.BestSpeed) // Only an invalid level fails.
+	return w
+}}
+
+// compressValue returns the compressed form of a string or []byte value of
+// at least threshold bytes, or v itself if it is smaller, of another type, or
+// does not compress.
+func compressValue(v any, threshold int) any {
+	var raw []byte
+	isString := false
+	switch v := v.(type) {
+	case string:
+		raw, isString = []byte(v), true
+	case []byte:
+		raw = v
+	default:
+		return v
+	}
+	if len(raw) < threshold {
+		return v
+	}
+	buf := getBuffer()
+	defer putBuffer(buf) // Its contents are cloned below.
+	w := flateWriters.Get().(*flate.Writer)
+	defer flateWriters.Put(w)
+	w.Reset(buf)
+	w.Write(raw) // Writes to a bytes.Buffer do not fail.
+	w.Close()
+	if buf.Len() >= len(raw) {
+		return v // Incompressible; keeping it as it is costs less.
+	}
+	return &compressedValue{data: bytes.Clone(buf.Bytes()), size: len(raw), isString: isString}
+}
+
+// resolveValue undoes compressValue and resolves mapped values; other values
+// pass through untouched. It is safe under the read lock.
+func (db *DataBase) resolveValue(v any) (any, bool) {
+	cv, ok := v.(*compressedValue)
+	if !ok {
+		return db.resolveMapped(v)
+	}
+	raw := make([]byte, 0, cv.size)
+	buf := bytes.NewBuffer(raw)
+	if _, err := io.Copy(buf, flate.NewReader(bytes.NewReader(cv.data))); err != nil {
+		db.logger.Error("compressed value decode failed", "err", err)
+		return nil, false
+	}
+	if cv.isString {
+		return buf.String(), true
+	}
+	return buf.Bytes(), true
+}
+
+// stored returns the form in which the value read from key is kept, so its
+// memory can be estimated at its compressed size. The caller must hold the
+// lock.
+func (db *DataBase) stored(key string, value any) any {
+	if db.data.store == nil {
+		return value
+	}
+	if raw, ok := db.data.raw(key); ok {
+		if cv, ok := raw.(*compressedValue); ok {
+			return cv
+		}
+	}
+	return value
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"math/rand/v2"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompressLargeValues(t *testing.T) {
+	db := NewDataBase(CompressLargeValues(1024))
+	defer db.Close()
+	plain := NewDataBase()
+	defer plain.Close()
+	page := strings.Repeat("<li class=\"item\">entry</li>\n", 2000) // About 56 KiB of HTML.
+	blob := bytes.Repeat([]byte("log line\n"), 5000)
+	noise := make([]byte, 4096)
+	rand.NewChaCha8([32]byte{}).Read(noise) // Random bytes do not shrink.
+	for _, store := range []*DataBase{db, plain} {
+		store.Set("page", page)
+		store.Set("blob", blob)
+		store.Set("noise", noise)
+		store.Set("small", "tiny")
+	}
+
+	if got, _ := db.Get("page"); got != page {
+		t.Error("Get of a compressed string did not return the original")
+	}
+	if got, ok := db.GetString("page"); !ok || got != page {
+		t.Error("GetString of a compressed string did not return the original")
+	}
+	if got, _ := db.Get("blob"); !bytes.Equal(got.([]byte), blob) {
+		t.Error("Get of a compressed []byte did not return the original")
+	}
+	var buf bytes.Buffer
+	if n, err := db.ReadRangeTo("page", &buf, -28, -1); err != nil || n != 28 || buf.String() != page[len(page)-28:] {
+		t.Errorf("ReadRangeTo of the last item = %d, %v, %q", n, err, buf.String())
+	}
+
+	db.lock.RLock()
+	for key, compressed := range map[string]bool{"page": true, "blob": true, "noise": false, "small": false} {
+		raw, _ := db.data.raw(key)
+		if _, ok := raw.(*compressedValue); ok != compressed {
+			t.Errorf("%s stored compressed = %v, want %v", key, ok, compressed)
+		}
+	}
+	db.lock.RUnlock()
+	for _, key := range []string{"page", "blob"} {
+		packed, _ := db.MemoryUsage(key)
+		full, _ := plain.MemoryUsage(key)
+		if packed*10 > full {
+			t.Errorf("MemoryUsage(%s) = %d compressed, %d not, want a tenth at most", key, packed, full)
+		}
+	}
+	stats := db.CompressionStats()
+	if stats.Values != 2 || stats.RawBytes != int64(len(page)+len(blob)) || stats.Ratio() < 10 {
+		t.Errorf("CompressionStats = %+v, ratio %.1f; want the page and the blob, 10:1 or better", stats, stats.Ratio())
+	}
+
+	fileName := filepath.Join(t.TempDir(), "database.gob")
+	if err := db.Persist(fileName); err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewDataBase()
+	defer loaded.Close()
+	if err := loaded.Load(fileName); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := loaded.Get("page"); got != page {
+		t.Error("a snapshot did not hold the original of a compressed value")
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidConfig is wrapped by the errors Reconfigure returns for a
+// configuration it refuses.
+var ErrInvalidConfig = errors.New("invalid configuration")
+
+// Config holds the settings that can be changed while the database runs.
+type Config struct {
+	MaxMemory      int64          // Memory budget in bytes, as for SetMaxMemory; 0 for none.
+	EvictionPolicy EvictionPolicy // What to do once over the budget.
+	SweepInterval  time.Duration  // How often expired data is actively removed.
+	DefaultTTL     time.Duration  // TTL of plain Sets, as for SetDefaultTTL; 0 for none.
+}
+
+// Config returns the current runtime configuration, for passing to
+// Reconfigure with some fields changed.
+func (db *DataBase) Config() Config {
+	db.lock.RLock()         // Acquire a read lock.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+	return Config{
+		MaxMemory:      db.maxMemory,
+		EvictionPolicy: db.evictionPolicy,
+		SweepInterval:  db.sweepInterval,
+		DefaultTTL:     db.defaultTTL,
+	}
+}
+
+// Reconfigure applies cfg in one step, without restarting the database:
+// no operation sees some settings changed and others not. A lower memory
+// budget takes effect at once, evicting keys if the policy allows, and a
+// new sweep interval restarts the sweeper's cadence from now. A
+// configuration with a negative budget or TTL, a non-positive sweep
+// interval or an unknown policy is refused with an error wrapping
+// ErrInvalidConfig, and nothing changes.
+func (db *DataBase) Reconfigure(cfg Config) error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+	db.lock.Lock()    // Acquire a write lock.
+	defer db.unlock() // Release the lock, evicting first if now over budget.
+	db.setMaxMemory(cfg.MaxMemory, cfg.EvictionPolicy)
+	db.defaultTTL = cfg.DefaultTTL
+	if cfg.SweepInterval != db.sweepInterval {
+		db.sweepInterval = cfg.SweepInterval
+		select {
+		case db.sweepReset <- struct{}{}:
+		default: // The sweeper has a reset pending and will read the new value.
+		}
+	}
+	db.logger.Info("configuration changed", "max_memory", cfg.MaxMemory, "policy", cfg.EvictionPolicy.String(),
+		"sweep_interval", cfg.SweepInterval, "default_ttl", cfg.DefaultTTL)
+	return nil
+}
+
+// validate checks a configuration for Reconfigure.
+func (cfg Config) validate() error {
+	switch {
+	case cfg.MaxMemory < 0:
+		return fmt.Errorf("%w: negative max memory %d", ErrInvalidConfig, cfg.MaxMemory)
+	case cfg.EvictionPolicy < NoEviction || cfg.EvictionPolicy > VolatileLFU:
+		return fmt.Errorf("%w: unknown eviction policy %d", ErrInvalidConfig, int(cfg.EvictionPolicy))
+	case cfg.SweepInterval <= 0:
+		return fmt.Errorf("%w: sweep interval %v is not positive", ErrInvalidConfig, cfg.SweepInterval)
+	case cfg.DefaultTTL < 0:
+		return fmt.Errorf("%w: negative default TTL %v", ErrInvalidConfig, cfg.DefaultTTL)
+	}
+	return nil
+}
+
+// configParam is a setting exposed by CONFIG GET and CONFIG SET, under its
+// Redis name where Redis has one.
+type configParam struct {
+	get func(cfg Config) string
+	set func(cfg *Config, value string) bool // Reports false for a malformed value.
+}
+
+// configParams lists the settings CONFIG knows, keyed by lower-case name.
+var configParams = map[string]configParam{
+	"maxmemory": {
+		get: func(cfg Config) string { return strconv.FormatInt(cfg.MaxMemory, 10) },
+		set: func(cfg *Config, value string) (ok bool) {
+			cfg.MaxMemory, ok = parseMemory(value)
+			return ok
+		},
+	},
+	"maxmemory-policy": {
+		get: func(cfg Config) string { return cfg.EvictionPolicy.String() },
+		set: func(cfg *Config, value string) (ok bool) {
+			cfg.EvictionPolicy, ok = parseEvictionPolicy(value)
+			return ok
+		},
+	},
+	"hz": { // Sweeps per second, Redis's frequency of background tasks.
+		get: func(cfg Config) string { return strconv.FormatInt(int64(time.Second/cfg.SweepInterval), 10) },
+		set: func(cfg *Config, value string) bool {
+			hz, err := strconv.Atoi(value)
+			if err != nil || hz <= 0 {
+				return false
+			}
+			cfg.SweepInterval = time.Second / time.Duration(hz)
+			return true
+		},
+	},
+	"default-ttl": { // In seconds; not a Redis setting.
+		get: func(cfg Config) string { return strconv.FormatInt(int64(cfg.DefaultTTL/time.Second), 10) },
+		set: func(cfg *Config, value string) bool {
+			secs, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || secs < 0 {
+				return false
+			}
+			cfg.DefaultTTL = time.Duration(secs) * time.Second
+			return true
+		},
+	},
+}
+
+// parseMemory parses a byte count the way Redis does, with an optional
+// unit: k, m and g are powers of 1000 and kb, mb and gb powers of 1024.
+func parseMemory(s string) (int64, bool) {
+	s = strings.ToLower(s)
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		factor int64
+	}{{"kb", 1 << 10}, {"mb", 1 << 20}, {"gb", 1 << 30}, {"k", 1e3}, {"m", 1e6}, {"g", 1e9}} {
+		if strings.HasSuffix(s, unit.suffix) {
+			s, multiplier = strings.TrimSuffix(s, unit.suffix), unit.factor
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 || n > math.MaxInt64/multiplier {
+		return 0, false
+	}
+	return n * multiplier, true
+}
+
+// cmdConfig handles CONFIG GET pattern and CONFIG SET parameter value
+// [parameter value ...]. A CONFIG SET applies all of its settings through
+// Reconfigure or none of them.
+func cmdConfig(db *DataBase, args []string) any {
+	switch strings.ToUpper(args[0]) {
+	case "GET":
+		if len(args) != 2 {
+			return fmt.Errorf("wrong number of arguments for 'config|get' command")
+		}
+		cfg := db.Config()
+		names := slices.Sorted(maps.Keys(configParams))
+		reply := respMap{}
+		for _, name := range names {
+			if matchGlob(strings.ToLower(args[1]), name) {
+				reply = append(reply, name, configParams[name].get(cfg))
+			}
+		}
+		return reply
+	case "SET":
+		if len(args) < 3 || len(args)%2 == 0 {
+			return fmt.Errorf("wrong number of arguments for 'config|set' command")
+		}
+		cfg := db.Config()
+		for i := 1; i < len(args); i += 2 {
+			param, ok := configParams[strings.ToLower(args[i])]
+			if !ok {
+				return fmt.Errorf("Unknown option or number of arguments for CONFIG SET - '%s'", args[i])
+			}
+			if !param.set(&cfg, args[i+1]) {
+				return fmt.Errorf("ERR CONFIG SET failed (possibly related to argument '%s') - argument couldn't be parsed into an integer or valid value", args[i])
+			}
+		}
+		if err := db.Reconfigure(cfg); err != nil {
+			return fmt.Errorf("ERR CONFIG SET failed - %v", err)
+		}
+		return simpleString("OK")
+	}
+	return fmt.Errorf("unknown subcommand '%s'. Try CONFIG GET or CONFIG SET.", args[0])
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// stored reports whether key is still held, expired or not, without the
+// lazy expiry of a read.
+func stored(db *DataBase, key string) bool {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+	return db.data.has(key)
+}
+
+func TestReconfigureSweepInterval(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1_000_000, 0))
+	db := NewDataBase(WithClock(clock), WithSweepInterval(time.Hour))
+	defer db.Close()
+	db.SetWithTTL("k", "v", time.Minute)
+	time.Sleep(20 * time.Millisecond) // Let the sweeper rearm for the new deadline.
+	clock.Advance(time.Hour)          // The fake clock wakes no one: only the interval does.
+	time.Sleep(50 * time.Millisecond)
+	if !stored(db, "k") {
+		t.Fatal("the expired key was swept before its hourly sweep")
+	}
+
+	cfg := db.Config()
+	cfg.SweepInterval = 5 * time.Millisecond
+	if err := db.Reconfigure(cfg); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the sweeper to run at the new interval", func() bool { return !stored(db, "k") })
+
+	start := time.Now()
+	db.SetWithTTL("k2", "v", time.Minute)
+	clock.Advance(time.Hour)
+	waitFor(t, "the next sweep", func() bool { return !stored(db, "k2") })
+	if waited := time.Since(start); waited > time.Second {
+		t.Errorf("the next sweep came after %v, want about 5ms", waited)
+	}
+
+	bad := db.Config()
+	bad.SweepInterval = 0
+	if err := db.Reconfigure(bad); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Reconfigure with no sweep interval: %v, want ErrInvalidConfig", err)
+	}
+	if got := db.Config().SweepInterval; got != 5*time.Millisecond {
+		t.Errorf("SweepInterval after a refused Reconfigure = %v, want 5ms kept", got)
+	}
+	if reply := cmdConfig(db, []string{"SET", "hz", "50"}); reply != simpleString("OK") {
+		t.Fatalf("CONFIG SET hz 50 = %v, want OK", reply)
+	}
+	if got := db.Config().SweepInterval; got != 20*time.Millisecond {
+		t.Errorf("SweepInterval after CONFIG SET hz 50 = %v, want 20ms", got)
+	}
+}
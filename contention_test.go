@@ -0,0 +1,54 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestContentionStatsRecordsWaits(t *testing.T) {
+	db := NewDataBase(WithContentionTracking(5 * time.Millisecond))
+	defer db.Close()
+	db.Set("k", "v")
+	db.Get("k")
+	if stats := db.ContentionStats(); stats.Acquisitions < 2 {
+		t.Errorf("Acquisitions = %d after a Set and a Get, want at least 2", stats.Acquisitions)
+	}
+
+	const hold = 30 * time.Millisecond
+	held := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		db.Eval(func(tx *Txn) (any, error) {
+			close(held)
+			time.Sleep(hold) // Keep the write lock so the readers queue.
+			return nil, nil
+		})
+	}()
+	<-held
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			db.Get("k")
+		}()
+	}
+	wg.Wait()
+
+	stats := db.ContentionStats()
+	if stats.Contended < 4 || stats.Slow < 1 {
+		t.Errorf("Contended = %d, Slow = %d; want the 4 queued readers counted", stats.Contended, stats.Slow)
+	}
+	if stats.TotalWait < hold/2 || stats.MaxWait <= 0 || stats.MaxWait > stats.TotalWait {
+		t.Errorf("TotalWait = %v, MaxWait = %v; want waits of the order of %v", stats.TotalWait, stats.MaxWait, hold)
+	}
+
+	off := NewDataBase()
+	defer off.Close()
+	off.Set("k", "v")
+	if stats := off.ContentionStats(); stats != (ContentionStats{}) {
+		t.Errorf("ContentionStats without tracking = %+v, want zero", stats)
+	}
+}
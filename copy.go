@@ -0,0 +1,126 @@
+package main
+
+import (
+	"maps"
+	"reflect"
+)
+
+// GetCopy retrieves the value associated with a key like Get, but returns a
+// deep copy of container values (slices, maps and arrays, including List,
+// Hash, Set and ZSet, recursively) so the caller may mutate the result
+// freely without racing the store or corrupting it. Scalars, structs and
+// other pointers are returned as is. Use Get when the value will only be read: it avoids
+// the copy but aliases the stored value.
+func (db *DataBase) GetCopy(key string) (any, bool) {
+	db.injectLatency()
+	if db.hot != nil {
+		db.hot.record(key) // Sample the access for HotKeys.
+	}
+	db.lock.RLock()         // Acquire a read lock while copying.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+	value, exists := db.lookup(key)
+	db.recordRead(exists)
+	if !exists {
+		return nil, false
+	}
+	return deepCopy(value), true
+}
+
+// deepCopy returns a copy of v in which every nested slice, map and array is
+// duplicated. Other kinds of values are shared with the original.
+func deepCopy(v any) any {
+	if v == nil {
+		return nil
+	}
+	return copyValue(reflect.ValueOf(v)).Interface()
+}
+
+// deepCopier is implemented by stored types that know how to copy themselves,
+// such as *ZSet, whose unexported fields reflection cannot duplicate.
+type deepCopier interface {
+	deepCopy() any
+}
+
+// copyValue implements deepCopy over reflect values, preserving named types.
+func copyValue(v reflect.Value) reflect.Value {
+	if v.IsValid() && v.CanInterface() {
+		if c, ok := v.Interface().(deepCopier); ok && !(v.Kind() == reflect.Pointer && v.IsNil()) {
+			return reflect.ValueOf(c.deepCopy())
+		}
+	}
+	switch v.Kind() {
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			out.Index(i).Set(copyValue(v.Index(i)))
+		}
+		return out
+	case reflect.Array:
+		out := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			out.Index(i).Set(copyValue(v.Index(i)))
+		}
+		return out
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			out.SetMapIndex(iter.Key(), copyValue(iter.Value()))
+		}
+		return out
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.New(v.Type()).Elem()
+		out.Set(copyValue(v.Elem())) // Copy whatever the interface holds.
+		return out
+	}
+	return v // Scalars, structs, pointers, channels and funcs are shared.
+}
+
+// Clone returns an independent deep copy of the database for what-if runs:
+// every live key with its value, deep-copied as by GetCopy, its TTL, hash
+// field TTLs and version, together with settings such as prefix policies,
+// the default TTL, the clock, logger and snapshot backend. Mutating either
+// database never affects the other. The clone runs its own background
+// goroutines and must be closed separately. Pub/Sub subscribers, OnExpire
+// callbacks and access statistics are not carried over.
+func (db *DataBase) Clone() *DataBase {
+	db.lock.RLock()         // Acquire a read lock for a consistent copy.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+
+	clone := NewDataBase(WithLogger(db.logger), WithSweepInterval(db.sweepInterval), WithClock(db.clock), WithBackend(db.backend))
+	clone.lock.Lock() // Its sweeper is already running.
+	defer clone.lock.Unlock()
+
+	now := db.clock.Now()
+	for key, value := range db.data.all() {
+		if db.isExpired(key, now) {
+			continue // Dead keys awaiting removal are not copied.
+		}
+		clone.data.set(key, deepCopy(value))
+		if deadline, ok := db.expires.get(key); ok {
+			clone.expires.set(key, deadline)
+		}
+		if fields, ok := db.fieldExpires[key]; ok {
+			clone.fieldExpires[key] = maps.Clone(fields)
+		}
+		if version, ok := db.versions[key]; ok {
+			clone.versions[key] = version
+		}
+	}
+	clone.writeSeq = db.writeSeq
+	clone.policies = maps.Clone(db.policies)
+	clone.defaultTTL = db.defaultTTL
+	clone.encoding = db.encoding
+	clone.compactThreshold = db.compactThreshold
+	clone.failFastSaves = db.failFastSaves
+	return clone
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGetCopyIsolatesStore(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	db.Set("doc", map[string]any{"tags": []any{"a", "b"}, "meta": map[string]any{"n": 1}})
+	db.RPush("list", "x", "y")
+	db.HSet("hash", "f", "v")
+	db.ZAdd("zset", ZMember{"m", 1})
+
+	value, _ := db.GetCopy("doc")
+	doc := value.(map[string]any)
+	doc["tags"].([]any)[0] = "changed"
+	doc["meta"].(map[string]any)["n"] = 2
+	doc["new"] = true
+	want := map[string]any{"tags": []any{"a", "b"}, "meta": map[string]any{"n": 1}}
+	if stored, _ := db.Get("doc"); !reflect.DeepEqual(stored, want) {
+		t.Errorf("store after mutating the copy = %v, want %v", stored, want)
+	}
+
+	list, _ := db.GetCopy("list")
+	list.(List)[0] = "changed"
+	if got, _ := db.LRange("list", 0, -1); !reflect.DeepEqual(got, []any{"x", "y"}) {
+		t.Errorf("list = %v after mutating the copy", got)
+	}
+	hash, _ := db.GetCopy("hash")
+	hash.(Hash)["f"] = "changed"
+	if got, _, _ := db.HGet("hash", "f"); got != "v" {
+		t.Errorf("hash field = %v after mutating the copy", got)
+	}
+	zset, _ := db.GetCopy("zset")
+	zset.(*ZSet).add("other", 2)
+	if members, _ := db.ZRange("zset", 0, -1); len(members) != 1 {
+		t.Errorf("sorted set = %v after mutating the copy, want one member", members)
+	}
+
+	if _, ok := db.GetCopy("missing"); ok {
+		t.Error("GetCopy of a missing key reported ok")
+	}
+}
+
+func TestCloneIsIndependent(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1_000_000, 0))
+	db := NewDataBase(WithClock(clock))
+	defer db.Close()
+	db.Set("name", "ada")
+	db.Set("doc", map[string]any{"n": 1})
+	db.RPush("list", "x")
+	db.HSet("hash", "f", "v")
+	db.SAdd("set", "a")
+	db.SetWithTTL("session", "tok", time.Minute)
+	db.SetWithTTL("lapsed", "v", time.Second)
+	clock.Advance(time.Second)
+
+	clone := db.Clone()
+	defer clone.Close()
+	if _, ok := clone.Get("lapsed"); ok {
+		t.Error("Clone copied an expired key")
+	}
+	if ttl := clone.TTL("session"); ttl != time.Minute-time.Second {
+		t.Errorf("TTL(session) in the clone = %v, want %v", ttl, time.Minute-time.Second)
+	}
+
+	clone.Set("name", "grace")
+	value, _ := clone.Get("doc")
+	value.(map[string]any)["n"] = 2
+	clone.RPush("list", "y")
+	clone.HSet("hash", "f", "changed")
+	clone.SAdd("set", "b")
+	clone.PersistKey("session")
+	clone.Delete("hash")
+	clone.Set("new", 1)
+	for key, want := range map[string]any{"name": "ada", "doc": map[string]any{"n": 1}, "list": List{"x"}, "hash": Hash{"f": "v"}, "set": Set{"a": {}}} {
+		if got, _ := db.Get(key); !reflect.DeepEqual(got, want) {
+			t.Errorf("original %s = %v after mutating the clone, want %v", key, got, want)
+		}
+	}
+	if db.Exists("new") != 0 || db.TTL("session") != time.Minute-time.Second {
+		t.Error("a change to the clone reached the original")
+	}
+
+	db.Set("name", "bob") // And the other way round.
+	db.RPush("list", "z")
+	if got, _ := clone.Get("name"); got != "grace" {
+		t.Errorf("clone name = %v after writing the original, want grace", got)
+	}
+	if got, _ := clone.LRange("list", 0, -1); !reflect.DeepEqual(got, []any{"x", "y"}) {
+		t.Errorf("clone list = %v after writing the original, want [x y]", got)
+	}
+}
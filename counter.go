@@ -0,0 +1,282 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ErrNotFloat is returned when a float increment targets a non-numeric value.
+var ErrNotFloat = errors.New("ERR value is not a valid float")
+
+// ErrNaNOrInf is returned when a float increment would store NaN or ±Inf.
+var ErrNaNOrInf = errors.New("ERR increment would produce NaN or Infinity")
+
+// toFloat converts a stored value to float64. Integers, floats and strings
+// holding a decimal number are accepted, mirroring how Redis treats strings.
+func toFloat(value any) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int8:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case string:
+		return parseFloat(v)
+	case []byte:
+		return parseFloat(string(v))
+	}
+	return 0, false
+}
+
+// parseFloat parses a string-stored number. Surrounding spaces, NaN and
+// infinities are rejected, as Redis does for INCRBYFLOAT.
+func parseFloat(s string) (float64, bool) {
+	if s != strings.TrimSpace(s) {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, false
+	}
+	return f, true
+}
+
+// IncrByFloat adds delta to the number stored at key and returns the result.
+// A missing key counts as 0. The result is always stored as a float64, even
+// if the key previously held an integer or a numeric string.
+//
+// The usual binary floating-point caveats apply: decimal fractions such as
+// 0.1 are not exactly representable, so long runs of additions accumulate
+// rounding error, and integers beyond 2^53 lose precision once converted.
+// Use integer counters when exact arithmetic matters.
+func (db *DataBase) IncrByFloat(key string, delta float64) (float64, error) {
+	db.lock.Lock()    // Acquire a write lock for the read-modify-write.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	if db.readOnly {
+		return 0, ErrReadOnly
+	}
+	db.expireIfNeeded(key)
+
+	current := 0.0 // A missing key starts at zero.
+	if value, exists := db.data.get(key); exists {
+		f, ok := toFloat(value)
+		if !ok {
+			return 0, ErrNotFloat
+		}
+		current = f
+	}
+	result := current + delta
+	if math.IsNaN(result) || math.IsInf(result, 0) {
+		return 0, ErrNaNOrInf // Leave the stored value untouched.
+	}
+	db.data.set(key, result) // Keeps any TTL, as Redis does for increments.
+	db.touch(key)
+	return result, nil
+}
+
+// ErrNotInteger is returned when an integer increment targets a value that
+// is not an integer or is out of the int64 range.
+var ErrNotInteger = errors.New("ERR value is not an integer or out of range")
+
+// ErrOverflow is returned when an increment or decrement would move a
+// counter past the int64 limits; the stored value is left unchanged.
+var ErrOverflow = errors.New("ERR increment or decrement would overflow")
+
+// toInt converts a stored value to int64. Integer types that fit and
+// strings holding a base-10 integer are accepted, as Redis does for INCR.
+func toInt(value any) (int64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return v, true
+	case int:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case uint:
+		return int64(v), uint64(v) <= math.MaxInt64
+	case uint8:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case uint64:
+		return int64(v), v <= math.MaxInt64
+	case string:
+		return parseInt(v)
+	case []byte:
+		return parseInt(string(v))
+	}
+	return 0, false
+}
+
+// parseInt parses a string-stored integer, rejecting signs and spaces that
+// Redis would not accept.
+func parseInt(s string) (int64, bool) {
+	if s == "" || s[0] == '+' || s != strings.TrimSpace(s) {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	return n, err == nil
+}
+
+// IncrBy adds delta to the integer stored at key and returns the result.
+// A missing key counts as 0 and the result is stored as an int64, keeping
+// any TTL. It returns ErrNotInteger for non-integer values and ErrOverflow,
+// leaving the value unchanged, if the sum would not fit in an int64.
+func (db *DataBase) IncrBy(key string, delta int64) (int64, error) {
+	db.lock.Lock()    // Acquire a write lock for the read-modify-write.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	if db.readOnly {
+		return 0, ErrReadOnly
+	}
+	return db.incrByLocked(key, delta)
+}
+
+// incrByLocked implements IncrBy. The caller must hold the write lock.
+func (db *DataBase) incrByLocked(key string, delta int64) (int64, error) {
+	db.expireIfNeeded(key)
+
+	var current int64 // A missing key starts at zero.
+	if value, exists := db.data.get(key); exists {
+		n, ok := toInt(value)
+		if !ok {
+			return 0, ErrNotInteger
+		}
+		current = n
+	}
+	if (delta > 0 && current > math.MaxInt64-delta) || (delta < 0 && current < math.MinInt64-delta) {
+		return 0, ErrOverflow // Redis refuses rather than wrapping around.
+	}
+	result := current + delta
+	db.data.set(key, result) // Keeps any TTL, as Redis does for increments.
+	db.touch(key)
+	return result, nil
+}
+
+// IncrByMany applies every delta to its key under a single write lock, so a
+// batch of counter updates costs one lock round trip rather than one per key,
+// and returns each key's new value. Keys follow the rules of IncrBy. The
+// batch is all or nothing: if any key holds a non-integer value or would
+// overflow, nothing is changed and the error names the first such key in
+// sorted order.
+func (db *DataBase) IncrByMany(deltas map[string]int64) (map[string]int64, error) {
+	db.lock.Lock()    // One lock for the whole batch.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	if db.readOnly {
+		return nil, ErrReadOnly
+	}
+	results := make(map[string]int64, len(deltas))
+	var failed string // The first failing key in sorted order, found without sorting.
+	var failure error
+	for key, delta := range deltas { // Check every key before changing any.
+		db.expireIfNeeded(key)
+		var current int64
+		var err error
+		if value, exists := db.data.get(key); exists {
+			n, ok := toInt(value)
+			if !ok {
+				err = ErrNotInteger
+			}
+			current = n
+		}
+		if err == nil && ((delta > 0 && current > math.MaxInt64-delta) || (delta < 0 && current < math.MinInt64-delta)) {
+			err = ErrOverflow
+		}
+		if err != nil {
+			if failure == nil || key < failed {
+				failed, failure = key, err
+			}
+			continue
+		}
+		results[key] = current + delta
+	}
+	if failure != nil {
+		return nil, fmt.Errorf("incr %q: %w", failed, failure)
+	}
+	for key, n := range results {
+		db.data.set(key, n) // Keeps any TTL, as IncrBy does.
+		db.touch(key)
+	}
+	return results, nil
+}
+
+// DecrBy subtracts delta from the integer stored at key, like IncrBy with
+// the opposite sign.
+func (db *DataBase) DecrBy(key string, delta int64) (int64, error) {
+	if delta == math.MinInt64 {
+		return 0, ErrOverflow // Its negation does not fit in an int64.
+	}
+	return db.IncrBy(key, -delta)
+}
+
+// Incr adds one to the integer stored at key.
+func (db *DataBase) Incr(key string) (int64, error) {
+	return db.IncrBy(key, 1)
+}
+
+// Decr subtracts one from the integer stored at key.
+func (db *DataBase) Decr(key string) (int64, error) {
+	return db.IncrBy(key, -1)
+}
+
+// GetInt returns the value at key as an int64, whether it was stored as an
+// integer, as a float with no fractional part, or as a string holding
+// either, such as values written through the RESP server. It reports false
+// for a missing key and returns ErrNotInteger if the value is not a whole
+// number that fits in an int64.
+func (db *DataBase) GetInt(key string) (int64, bool, error) {
+	value, exists := db.Get(key)
+	if !exists {
+		return 0, false, nil
+	}
+	if n, ok := toInt(value); ok {
+		return n, true, nil
+	}
+	f, ok := toFloat(value)
+	if !ok || f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+		return 0, true, ErrNotInteger
+	}
+	return int64(f), true, nil
+}
+
+// GetFloat returns the value at key as a float64, converting integers and
+// numeric strings as IncrByFloat does. It reports false for a missing key
+// and returns ErrNotFloat if the value is not numeric.
+func (db *DataBase) GetFloat(key string) (float64, bool, error) {
+	value, exists := db.Get(key)
+	if !exists {
+		return 0, false, nil
+	}
+	f, ok := toFloat(value)
+	if !ok {
+		return 0, true, ErrNotFloat
+	}
+	return f, true, nil
+}
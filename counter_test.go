@@ -0,0 +1,249 @@
+package main
+
+import (
+	"errors"
+	"maps"
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestIncrByFloat(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	if got, err := db.IncrByFloat("f", -2.5); err != nil || got != -2.5 {
+		t.Fatalf("IncrByFloat of a missing key by -2.5 = %v, %v", got, err)
+	}
+	if got, _ := db.IncrByFloat("f", -0.5); got != -3 {
+		t.Errorf("second negative delta = %v, want -3", got)
+	}
+
+	var sum float64
+	for range 1000 {
+		sum, _ = db.IncrByFloat("acc", 0.1)
+	}
+	if math.Abs(sum-100) > 1e-9 {
+		t.Errorf("1000 increments by 0.1 = %v, want about 100", sum)
+	}
+	if value, _ := db.Get("acc"); value != sum {
+		t.Errorf("stored %v, want the returned %v", value, sum)
+	}
+
+	db.Set("int", int64(10))
+	db.Set("str", "1.5")
+	if got, _ := db.IncrByFloat("int", -0.25); got != 9.75 {
+		t.Errorf("IncrByFloat of an int64 = %v, want 9.75", got)
+	}
+	if got, _ := db.IncrByFloat("str", 1); got != 2.5 {
+		t.Errorf("IncrByFloat of a numeric string = %v, want 2.5", got)
+	}
+	if value, _ := db.Get("int"); value != 9.75 {
+		t.Errorf("int is stored as %#v, want float64(9.75)", value)
+	}
+
+	db.Set("word", "abc")
+	if _, err := db.IncrByFloat("word", 1); !errors.Is(err, ErrNotFloat) {
+		t.Errorf("IncrByFloat of a word: %v, want ErrNotFloat", err)
+	}
+	db.Set("big", math.MaxFloat64)
+	if _, err := db.IncrByFloat("big", math.MaxFloat64); !errors.Is(err, ErrNaNOrInf) {
+		t.Errorf("IncrByFloat to +Inf: %v, want ErrNaNOrInf", err)
+	}
+	if value, _ := db.Get("big"); value != math.MaxFloat64 {
+		t.Errorf("big = %v after the refused increment", value)
+	}
+}
+
+func TestIncrDecrOverflow(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	db.Set("max", int64(math.MaxInt64))
+	db.Set("min", int64(math.MinInt64))
+	for _, tc := range []struct {
+		name string
+		op   func() (int64, error)
+		key  string
+		want int64
+	}{
+		{"Incr", func() (int64, error) { return db.Incr("max") }, "max", math.MaxInt64},
+		{"IncrBy", func() (int64, error) { return db.IncrBy("max", math.MaxInt64) }, "max", math.MaxInt64},
+		{"Decr", func() (int64, error) { return db.Decr("min") }, "min", math.MinInt64},
+		{"DecrBy", func() (int64, error) { return db.DecrBy("min", 1) }, "min", math.MinInt64},
+		{"IncrBy negative", func() (int64, error) { return db.IncrBy("min", -1) }, "min", math.MinInt64},
+		{"DecrBy MinInt64", func() (int64, error) { return db.DecrBy("zero", math.MinInt64) }, "zero", 0},
+	} {
+		if _, err := tc.op(); !errors.Is(err, ErrOverflow) {
+			t.Errorf("%s past the limit: %v, want ErrOverflow", tc.name, err)
+		}
+		if value, _ := db.Get(tc.key); tc.want != 0 && value != tc.want {
+			t.Errorf("%s left %s = %v, want %v unchanged", tc.name, tc.key, value, tc.want)
+		}
+	}
+	if db.Exists("zero") != 0 {
+		t.Error("a refused DecrBy created the key")
+	}
+
+	if got, err := db.Decr("max"); err != nil || got != math.MaxInt64-1 {
+		t.Errorf("Decr from MaxInt64 = %d, %v", got, err)
+	}
+	if got, err := db.IncrBy("min", math.MaxInt64); err != nil || got != -1 {
+		t.Errorf("IncrBy(MaxInt64) from MinInt64 = %d, %v; want -1", got, err)
+	}
+}
+
+func TestGetIntAndGetFloatCoerce(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	for key, value := range map[string]any{
+		"int": 7, "int64": int64(7), "uint8": uint8(7), "float": 7.0,
+		"string": "7", "bytes": []byte("7"), "floatString": "7.0",
+	} {
+		db.Set(key, value)
+		if n, ok, err := db.GetInt(key); err != nil || !ok || n != 7 {
+			t.Errorf("GetInt of %T %v = %d, %v, %v; want 7", value, value, n, ok, err)
+		}
+		if f, ok, err := db.GetFloat(key); err != nil || !ok || f != 7 {
+			t.Errorf("GetFloat of %T %v = %v, %v, %v; want 7", value, value, f, ok, err)
+		}
+	}
+
+	db.Set("fraction", "2.5")
+	if f, _, err := db.GetFloat("fraction"); err != nil || f != 2.5 {
+		t.Errorf("GetFloat(2.5) = %v, %v", f, err)
+	}
+	if _, ok, err := db.GetInt("fraction"); !ok || !errors.Is(err, ErrNotInteger) {
+		t.Errorf("GetInt of 2.5: %v, %v; want ErrNotInteger", ok, err)
+	}
+	db.Set("huge", 1e300)
+	if _, _, err := db.GetInt("huge"); !errors.Is(err, ErrNotInteger) {
+		t.Errorf("GetInt of 1e300: %v, want ErrNotInteger", err)
+	}
+	db.Set("word", "abc")
+	if _, ok, err := db.GetInt("word"); !ok || !errors.Is(err, ErrNotInteger) {
+		t.Errorf("GetInt of a word: %v, %v; want ErrNotInteger", ok, err)
+	}
+	if _, ok, err := db.GetFloat("word"); !ok || !errors.Is(err, ErrNotFloat) {
+		t.Errorf("GetFloat of a word: %v, %v; want ErrNotFloat", ok, err)
+	}
+	if _, ok, err := db.GetInt("missing"); ok || err != nil {
+		t.Errorf("GetInt of a missing key = %v, %v; want false, nil", ok, err)
+	}
+	if _, ok, err := db.GetFloat("missing"); ok || err != nil {
+		t.Errorf("GetFloat of a missing key = %v, %v; want false, nil", ok, err)
+	}
+}
+
+func TestIncrByManyAllOrNothing(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	db.Set("hits", int64(10))
+	db.Set("views", "5") // A numeric string counts, as for IncrBy.
+	got, err := db.IncrByMany(map[string]int64{"hits": 1, "views": -2, "new": 7})
+	want := map[string]int64{"hits": 11, "views": 3, "new": 7}
+	if err != nil || !maps.Equal(got, want) {
+		t.Fatalf("IncrByMany = %v, %v; want %v", got, err, want)
+	}
+	for key, n := range want {
+		if value, _ := db.Get(key); value != n {
+			t.Errorf("%s = %#v, want %d", key, value, n)
+		}
+	}
+
+	db.Set("name", "ada")
+	db.Set("max", int64(math.MaxInt64))
+	if _, err := db.IncrByMany(map[string]int64{"hits": 1, "name": 1, "max": 1}); !errors.Is(err, ErrOverflow) {
+		t.Errorf("IncrByMany with an overflow and a non-integer: %v, want ErrOverflow for max, first in sorted order", err)
+	}
+	if _, err := db.IncrByMany(map[string]int64{"hits": 1, "name": 1}); !errors.Is(err, ErrNotInteger) {
+		t.Errorf("IncrByMany with a non-integer: %v, want ErrNotInteger", err)
+	}
+	if value, _ := db.Get("hits"); value != int64(11) {
+		t.Errorf("hits = %v after the refused batches, want 11 unchanged", value)
+	}
+}
+
+// benchmarkCounters is a batch of 100 counter deltas, as a metrics sink
+// receives them.
+func benchmarkCounters() map[string]int64 {
+	deltas := make(map[string]int64, 100)
+	for i := range 100 {
+		deltas["metric:"+strconv.Itoa(i)] = int64(i)
+	}
+	return deltas
+}
+
+// BenchmarkIncrBatch applies a batch of 100 deltas per op from parallel
+// writers, with one IncrByMany or with an IncrBy per key. IncrByMany
+// takes the lock once a batch rather than once a key, which pays off as
+// the writers contend for it (run with -cpu 1,4,8). On one core, where
+// they hardly contend, IncrBy is slightly ahead: IncrByMany also builds
+// the map of results.
+func BenchmarkIncrBatch(b *testing.B) {
+	deltas := benchmarkCounters()
+	b.Run("IncrByMany", func(b *testing.B) {
+		db := NewDataBase()
+		defer db.Close()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				db.IncrByMany(deltas)
+			}
+		})
+	})
+	b.Run("IncrBy", func(b *testing.B) {
+		db := NewDataBase()
+		defer db.Close()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				for key, delta := range deltas {
+					db.IncrBy(key, delta)
+				}
+			}
+		})
+	})
+}
+
+func TestServerCounters(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	c := dial(t, startServer(t, db, ServerConfig{}))
+	for _, step := range []struct {
+		args []string
+		want any
+	}{
+		{[]string{"INCR", "n"}, int64(1)}, // A missing counter starts at 0.
+		{[]string{"INCRBY", "n", "41"}, int64(42)},
+		{[]string{"DECR", "n"}, int64(41)},
+		{[]string{"DECRBY", "n", "50"}, int64(-9)},
+		{[]string{"INCRBY", "n", "-1"}, int64(-10)},
+		{[]string{"GET", "n"}, "-10"},
+		{[]string{"SET", "s", "7"}, "OK"},
+		{[]string{"INCR", "s"}, int64(8)}, // Strings holding integers count.
+		{[]string{"SET", "max", strconv.FormatInt(math.MaxInt64, 10)}, "OK"},
+	} {
+		if reply := c.do(t, step.args...); reply != step.want {
+			t.Errorf("%q = %#v, want %#v", step.args, reply, step.want)
+		}
+	}
+	for _, tc := range []struct {
+		args []string
+		want error
+	}{
+		{[]string{"INCRBY", "n", "lots"}, ErrNotInteger},
+		{[]string{"DECRBY", "n", "1.5"}, ErrNotInteger},
+		{[]string{"SET", "word", "abc"}, nil},
+		{[]string{"INCR", "word"}, ErrNotInteger},
+		{[]string{"INCR", "max"}, ErrOverflow},
+		{[]string{"DECRBY", "n", strconv.FormatInt(math.MaxInt64, 10)}, ErrOverflow},
+	} {
+		reply := c.do(t, tc.args...)
+		if tc.want == nil {
+			continue
+		}
+		if err, ok := reply.(error); !ok || err.Error() != tc.want.Error() {
+			t.Errorf("%q = %v, want %v", tc.args, reply, tc.want)
+		}
+	}
+	if reply := c.do(t, "GET", "n"); reply != "-10" {
+		t.Errorf("GET n after failed updates = %v, want -10 unchanged", reply)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+// csvHeader is the first row written by ExportCSV and expected by ImportCSV.
+var csvHeader = []string{"key", "type", "value"}
+
+// ExportCSV writes every scalar entry as a key,type,value row, preceded by a
+// header row. The type column holds the value's kind (string, int64, float64,
+// bool, bytes, ...) so ImportCSV can restore it; []byte values are written as
+// base64. Container values (slices, maps, structs, ...) are skipped. Rows are
+// sorted by key and quoting of commas, quotes and newlines follows RFC 4180.
+func (db *DataBase) ExportCSV(w io.Writer) error {
+	db.lock.RLock()         // Acquire a read lock for a consistent export.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+
+	keys := make([]string, 0, db.data.len())
+	now := db.clock.Now()
+	for key := range db.data.all() {
+		if !db.isExpired(key, now) {
+			keys = append(keys, key) // Skip dead keys awaiting removal.
+		}
+	}
+	sort.Strings(keys) // Deterministic output is friendlier to diff tools.
+
+	out := csv.NewWriter(w) // Handles quoting and escaping for us.
+	if err := out.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		kind, text, ok := formatCSVValue(db.data.value(key))
+		if !ok {
+			continue // Containers have no flat representation.
+		}
+		if err := out.Write([]string{key, kind, text}); err != nil {
+			return err
+		}
+	}
+	out.Flush()        // Push buffered rows to w.
+	return out.Error() // Report any error from the final flush.
+}
+
+// ImportCSV loads rows written by ExportCSV, replacing existing keys with the
+// same name. The whole file is parsed before anything is stored, so a
+// malformed row leaves the database unchanged, as does a read-only database,
+// which returns ErrReadOnly.
+func (db *DataBase) ImportCSV(r io.Reader) error {
+	in := csv.NewReader(r)
+	in.FieldsPerRecord = len(csvHeader) // Every row must be key,type,value.
+
+	header, err := in.Read()
+	if err != nil {
+		return err // Covers empty input as io.EOF.
+	}
+	if !reflect.DeepEqual(header, csvHeader) {
+		return fmt.Errorf("csv: unexpected header %q", header)
+	}
+
+	values := make(map[string]any)
+	for {
+		row, err := in.Read()
+		if err == io.EOF {
+			break // All rows consumed.
+		}
+		if err != nil {
+			return err
+		}
+		value, err := parseCSVValue(row[1], row[2])
+		if err != nil {
+			return fmt.Errorf("csv: key %q: %w", row[0], err)
+		}
+		values[row[0]] = value
+	}
+
+	db.lock.Lock()    // Acquire a write lock to store the rows.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	if db.readOnly {
+		return ErrReadOnly
+	}
+	for key, value := range values {
+		db.setLocked(key, value)
+	}
+	return nil
+}
+
+// formatCSVValue returns the kind label and textual form of a scalar value.
+// It reports false for values that cannot be represented as a single cell.
+func formatCSVValue(value any) (kind, text string, ok bool) {
+	if b, isBytes := value.([]byte); isBytes {
+		return "bytes", base64.StdEncoding.EncodeToString(b), true
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.String:
+		return "string", v.String(), true
+	case reflect.Bool:
+		return "bool", strconv.FormatBool(v.Bool()), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Kind().String(), strconv.FormatInt(v.Int(), 10), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Kind().String(), strconv.FormatUint(v.Uint(), 10), true
+	case reflect.Float32, reflect.Float64:
+		return v.Kind().String(), strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits()), true
+	}
+	return "", "", false // Slices, maps, structs, nil and friends.
+}
+
+// parseCSVValue converts a cell back into a value of the named kind.
+func parseCSVValue(kind, text string) (any, error) {
+	switch kind {
+	case "string":
+		return text, nil
+	case "bytes":
+		return base64.StdEncoding.DecodeString(text)
+	case "bool":
+		return strconv.ParseBool(text)
+	case "int", "int8", "int16", "int32", "int64":
+		n, err := strconv.ParseInt(text, 10, kindBits(kind))
+		if err != nil {
+			return nil, err
+		}
+		return convertKind(n, kind), nil
+	case "uint", "uint8", "uint16", "uint32", "uint64":
+		n, err := strconv.ParseUint(text, 10, kindBits(kind))
+		if err != nil {
+			return nil, err
+		}
+		return convertKind(n, kind), nil
+	case "float32", "float64":
+		f, err := strconv.ParseFloat(text, kindBits(kind))
+		if err != nil {
+			return nil, err
+		}
+		return convertKind(f, kind), nil
+	}
+	return nil, fmt.Errorf("unknown type %q", kind)
+}
+
+// csvKinds maps kind labels to the Go types they restore to.
+var csvKinds = map[string]reflect.Type{
+	"int": reflect.TypeOf(int(0)), "int8": reflect.TypeOf(int8(0)),
+	"int16": reflect.TypeOf(int16(0)), "int32": reflect.TypeOf(int32(0)),
+	"int64": reflect.TypeOf(int64(0)), "uint": reflect.TypeOf(uint(0)),
+	"uint8": reflect.TypeOf(uint8(0)), "uint16": reflect.TypeOf(uint16(0)),
+	"uint32": reflect.TypeOf(uint32(0)), "uint64": reflect.TypeOf(uint64(0)),
+	"float32": reflect.TypeOf(float32(0)), "float64": reflect.TypeOf(float64(0)),
+}
+
+// kindBits returns the bit size used when parsing a numeric kind.
+func kindBits(kind string) int {
+	return csvKinds[kind].Bits()
+}
+
+// convertKind converts a parsed number to the concrete type for kind.
+func convertKind(n any, kind string) any {
+	return reflect.ValueOf(n).Convert(csvKinds[kind]).Interface()
+}
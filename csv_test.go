@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCSVRoundTrip(t *testing.T) {
+	src := NewDataBase()
+	defer src.Close()
+	values := map[string]any{
+		"name":    "ada, \"the\" first\nline two", // Needs quoting.
+		"bytes":   []byte{0, 1, 254, 255},
+		"flag":    true,
+		"int":     42,
+		"int8":    int8(-8),
+		"int64":   int64(-1) << 40,
+		"uint16":  uint16(65535),
+		"float32": float32(1.5),
+		"float64": 0.1,
+	}
+	for key, value := range values {
+		src.Set(key, value)
+	}
+	src.Set("list", []string{"a", "b"}) // Containers are left out.
+	var buf bytes.Buffer
+	if err := src.ExportCSV(&buf); err != nil {
+		t.Fatalf("ExportCSV: %v", err)
+	}
+	if !strings.HasPrefix(buf.String(), "key,type,value\n") {
+		t.Errorf("export does not start with the header: %q", buf.String())
+	}
+
+	dst := NewDataBase()
+	defer dst.Close()
+	if err := dst.ImportCSV(&buf); err != nil {
+		t.Fatalf("ImportCSV: %v", err)
+	}
+	if got := len(dst.Keys("*")); got != len(values) {
+		t.Errorf("imported %d keys, want %d", got, len(values))
+	}
+	for key, want := range values {
+		if got, _ := dst.Get(key); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s = %#v, want %#v", key, got, want)
+		}
+	}
+}
+
+func TestImportCSVMalformed(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	db.Set("keep", "v")
+	for _, input := range []string{
+		"key,type,value\nok,string,x\nbad,int64,notanumber\n",
+		"key,type,value\nbad,complex,1\n",
+		"wrong,header,row\n",
+	} {
+		if err := db.ImportCSV(strings.NewReader(input)); err == nil {
+			t.Errorf("ImportCSV(%q) succeeded", input)
+		}
+	}
+	if keys := db.Keys("*"); len(keys) != 1 {
+		t.Errorf("malformed imports changed the keys: %q", keys)
+	}
+}
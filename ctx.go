@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"io"
+	"slices"
+	"time"
+)
+
+// ctxCheckInterval is how many keys a walk of the keyspace visits between
+// checks of its context.
+const ctxCheckInterval = 1024
+
+// PersistCtx is Persist with a context. Cancelling ctx, or reaching its
+// deadline, stops the save part-way with the context's error; the file
+// being replaced is left as it was, as after any failed save. Waiting for
+// another save of the same file to finish cannot be interrupted.
+func (db *DataBase) PersistCtx(ctx context.Context, fileName string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if db.latency != nil {
+		defer db.latency["Persist"].observe(time.Now()) // Time the whole save.
+	}
+	err := db.persist(ctx, fileName, PersistOptions{})
+	db.logSave(fileName, err)
+	return err
+}
+
+// LoadCtx is Load with a context. The snapshot is decoded before anything
+// is merged, so a load stopped by ctx returns the context's error with the
+// database unchanged.
+func (db *DataBase) LoadCtx(ctx context.Context, fileName string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if db.latency != nil {
+		defer db.latency["Load"].observe(time.Now()) // Time the whole load.
+	}
+	err := db.load(ctx, fileName, nil)
+	if err != nil {
+		db.logger.Error("snapshot load failed", "file", fileName, "err", err)
+	} else {
+		db.logger.Info("snapshot loaded", "file", fileName)
+	}
+	return err
+}
+
+// KeysCtx is Keys with a context, checked as the keyspace is walked, so a
+// broad pattern over a large store can be given a deadline. A walk stopped
+// by ctx returns its error and no keys, and releases the read lock at once.
+func (db *DataBase) KeysCtx(ctx context.Context, pattern string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	db.lock.RLock()         // Acquire a read lock.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+	now := db.clock.Now()
+	var keys []string
+	visited := 0
+	for key := range db.data.all() {
+		if visited++; visited%ctxCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		if matchGlob(pattern, key) && !db.isExpired(key, now) {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	return keys, nil
+}
+
+// ctxWriter fails writes with the context's error once it is done.
+type ctxWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+// withCtxWriter returns w, wrapped to stop writing when ctx is done unless
+// ctx can never be.
+func withCtxWriter(ctx context.Context, w io.Writer) io.Writer {
+	if ctx.Done() == nil {
+		return w // Background and the like; skip the check on every write.
+	}
+	return &ctxWriter{ctx, w}
+}
+
+// Write writes p unless the context is done.
+func (cw *ctxWriter) Write(p []byte) (int, error) {
+	if err := cw.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cw.w.Write(p)
+}
+
+// ctxReader fails reads with the context's error once it is done.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+// withCtxReader returns r, wrapped to stop reading when ctx is done unless
+// ctx can never be.
+func withCtxReader(ctx context.Context, r io.Reader) io.Reader {
+	if ctx.Done() == nil {
+		return r // Background and the like; skip the check on every read.
+	}
+	return &ctxReader{ctx, r}
+}
+
+// Read reads into p unless the context is done.
+func (cr *ctxReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
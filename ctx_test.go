@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// cancelAfter is a context that reports itself cancelled once Err has been
+// called n times, to stop an operation part-way at a predictable point.
+type cancelAfter struct {
+	context.Context
+	n atomic.Int32
+}
+
+// newCancelAfter returns a context that is cancelled from the nth call
+// to Err on.
+func newCancelAfter(n int32) *cancelAfter {
+	c := &cancelAfter{Context: context.Background()}
+	c.n.Store(n)
+	return c
+}
+
+// Done returns a channel, so that the context is checked at all.
+func (c *cancelAfter) Done() <-chan struct{} { return make(chan struct{}) }
+
+// Err returns context.Canceled once the calls run out.
+func (c *cancelAfter) Err() error {
+	if c.n.Add(-1) < 0 {
+		return context.Canceled
+	}
+	return nil
+}
+
+// ctxFixture returns a database with enough keys that saving, loading and
+// walking them checks the context many times.
+func ctxFixture(t *testing.T) *DataBase {
+	t.Helper()
+	db := NewDataBase()
+	t.Cleanup(func() { db.Close() })
+	for i := range 5000 {
+		db.Set("key:"+strconv.Itoa(i), "value")
+	}
+	return db
+}
+
+func TestPersistCtx(t *testing.T) {
+	db := ctxFixture(t)
+	fileName := filepath.Join(t.TempDir(), "database.gob")
+	if err := db.PersistCtx(context.Background(), fileName); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db.Set("key:0", "changed")
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, ctx := range []context.Context{cancelled, newCancelAfter(3)} { // Before and during the save.
+		if err := db.PersistCtx(ctx, fileName); !errors.Is(err, context.Canceled) {
+			t.Errorf("PersistCtx with a cancelled context: %v, want context.Canceled", err)
+		}
+	}
+	if after, _ := os.ReadFile(fileName); string(after) != string(before) {
+		t.Error("a cancelled PersistCtx changed the snapshot")
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(fileName)); len(entries) != 1 {
+		t.Errorf("a cancelled PersistCtx left %d files, want the snapshot alone", len(entries))
+	}
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	if err := db.PersistCtx(ctx, fileName); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("PersistCtx past its deadline: %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestLoadCtx(t *testing.T) {
+	src := ctxFixture(t)
+	fileName := filepath.Join(t.TempDir(), "database.gob")
+	if err := src.Persist(fileName); err != nil {
+		t.Fatal(err)
+	}
+	db := NewDataBase()
+	defer db.Close()
+	db.Set("kept", "v")
+	if err := db.LoadCtx(newCancelAfter(3), fileName); !errors.Is(err, context.Canceled) {
+		t.Fatalf("LoadCtx cancelled part-way: %v, want context.Canceled", err)
+	}
+	if keys := db.Keys("*"); len(keys) != 1 {
+		t.Errorf("a cancelled LoadCtx left %d keys, want the database unchanged", len(keys))
+	}
+	if err := db.LoadCtx(context.Background(), fileName); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(db.Keys("*")); n != 5001 {
+		t.Errorf("%d keys after LoadCtx, want 5001", n)
+	}
+}
+
+func TestKeysCtx(t *testing.T) {
+	db := ctxFixture(t)
+	keys, err := db.KeysCtx(context.Background(), "key:1*")
+	if want := db.Keys("key:1*"); err != nil || len(keys) != len(want) {
+		t.Errorf("KeysCtx = %d keys, %v; want the %d of Keys", len(keys), err, len(want))
+	}
+	if keys, err := db.KeysCtx(newCancelAfter(2), "*"); !errors.Is(err, context.Canceled) || keys != nil {
+		t.Errorf("KeysCtx cancelled during the walk = %d keys, %v; want none and context.Canceled", len(keys), err)
+	}
+	db.Set("after", "v") // The read lock was released.
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := db.GetCtx(cancelled, "key:0"); !errors.Is(err, context.Canceled) {
+		t.Errorf("GetCtx with a cancelled context: %v, want context.Canceled", err)
+	}
+	if err := db.SetCtx(cancelled, "key:0", "changed"); !errors.Is(err, context.Canceled) {
+		t.Errorf("SetCtx with a cancelled context: %v, want context.Canceled", err)
+	}
+	if value, _ := db.Get("key:0"); value != "value" {
+		t.Errorf("key:0 = %v, want it untouched by the cancelled SetCtx", value)
+	}
+}
+
+func TestServerShutdownWaitsForCommands(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	db.OnGet(func(ctx context.Context, key string, found bool) {
+		if key == "slow" {
+			started <- struct{}{}
+			<-release
+		}
+	})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(db, ServerConfig{})
+	go s.Serve(ln)
+	busy, idle := dial(t, ln.Addr().String()), dial(t, ln.Addr().String())
+	idle.do(t, "PING")
+
+	busy.send(t, "GET", "slow")
+	<-started
+	shut := make(chan error, 1)
+	go func() { shut <- s.Shutdown(context.Background()) }()
+	select {
+	case err := <-shut:
+		t.Fatalf("Shutdown returned %v while a command was running", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	if reply := busy.read(t); reply != nil {
+		t.Errorf("the running GET replied %v, want its null reply", reply)
+	}
+	if err := <-shut; err != nil {
+		t.Errorf("Shutdown: %v", err)
+	}
+	if _, err := idle.r.ReadByte(); err == nil {
+		t.Error("an idle connection stayed open after Shutdown")
+	}
+	if _, err := net.Dial("tcp", ln.Addr().String()); err == nil {
+		t.Error("the server accepted a connection after Shutdown")
+	}
+}
+
+func TestServerShutdownDeadline(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	release := make(chan struct{})
+	defer close(release)
+	started := make(chan struct{}, 1)
+	db.OnGet(func(ctx context.Context, key string, found bool) {
+		started <- struct{}{}
+		<-release
+	})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(db, ServerConfig{})
+	go s.Serve(ln)
+	c := dial(t, ln.Addr().String())
+	c.send(t, "GET", "stuck")
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := s.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Shutdown with a command stuck: %v, want context.DeadlineExceeded", err)
+	}
+	if _, err := c.r.ReadByte(); err == nil {
+		t.Error("the stuck connection stayed open once the deadline passed")
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrDBIndex is returned for a database index outside a Databases, worded
+// as Redis words it.
+var ErrDBIndex = errors.New("ERR DB index is out of range")
+
+// Databases is a fixed set of numbered, isolated keyspaces in one process,
+// like the databases of a Redis server that clients pick with SELECT. Each
+// is a full DataBase with its own keys, TTLs, limits and background work;
+// they share only their Pub/Sub channels, which in Redis are not per
+// database either.
+type Databases struct {
+	dbs    []*DataBase
+	swapMu sync.Mutex // Serializes SwapDB, which locks two databases at once.
+}
+
+// NewDatabases returns n empty databases, numbered from 0, each created by
+// NewDataBase with opts.
+func NewDatabases(n int, opts ...Option) *Databases {
+	d := &Databases{dbs: make([]*DataBase, n)}
+	for i := range d.dbs {
+		d.dbs[i] = NewDataBase(opts...)
+		d.dbs[i].pubsub = d.dbs[0].pubsub // One set of channels for all.
+	}
+	return d
+}
+
+// Len returns the number of databases.
+func (d *Databases) Len() int {
+	return len(d.dbs)
+}
+
+// DB returns database n, or ErrDBIndex if there is no such database. The
+// handle stays valid for the life of the set; after SwapDB it serves the
+// data it was swapped with.
+func (d *Databases) DB(n int) (*DataBase, error) {
+	if n < 0 || n >= len(d.dbs) {
+		return nil, ErrDBIndex
+	}
+	return d.dbs[n], nil
+}
+
+// SwapDB exchanges the contents of databases a and b, with their TTLs and
+// hash field TTLs, so handles to a see what b held and the other way
+// round, as with Redis SWAPDB. Both are locked for the exchange, so no one
+// sees it half done. It returns ErrReadOnly if either is read-only. Unlike
+// Redis it takes time in proportion to the keys moved, and prefix policies
+// and memory budgets are not checked against the moved values.
+func (d *Databases) SwapDB(a, b int) error {
+	if a < 0 || a >= len(d.dbs) || b < 0 || b >= len(d.dbs) {
+		return ErrDBIndex
+	}
+	if a == b {
+		return nil
+	}
+	d.swapMu.Lock()
+	defer d.swapMu.Unlock()
+	first, second := d.dbs[min(a, b)], d.dbs[max(a, b)]
+	first.lock.Lock() // Lock in index order.
+	defer first.unlock()
+	second.lock.Lock()
+	defer second.unlock()
+	if first.readOnly || second.readOnly {
+		return ErrReadOnly
+	}
+	fromFirst, fromSecond := first.takeAll(), second.takeAll()
+	first.placeAll(fromSecond)
+	second.placeAll(fromFirst)
+	return nil
+}
+
+// movedKey is a key taken out of one database by takeAll.
+type movedKey struct {
+	key      string
+	value    any
+	deadline time.Time
+	hasTTL   bool
+	fields   map[string]time.Time
+}
+
+// takeAll removes every live key, returning them with their TTLs. The
+// caller must hold the write lock.
+func (db *DataBase) takeAll() []movedKey {
+	now := db.clock.Now()
+	var moved []movedKey
+	keys := make([]string, 0, db.data.len())
+	for key, value := range db.data.all() {
+		keys = append(keys, key) // Collect first: removal must not race the iteration.
+		if db.isExpired(key, now) {
+			continue
+		}
+		m := movedKey{key: key, value: value, fields: db.fieldExpires[key]}
+		m.deadline, m.hasTTL = db.expires.get(key)
+		moved = append(moved, m)
+	}
+	for _, key := range keys {
+		db.removeKey(key)
+	}
+	return moved
+}
+
+// placeAll stores keys taken by takeAll. The caller must hold the write
+// lock.
+func (db *DataBase) placeAll(moved []movedKey) {
+	for _, m := range moved {
+		db.place(m.key, m.value, true, m.deadline, m.hasTTL, m.fields)
+	}
+}
+
+// FlushDB deletes every key of database n and returns how many live keys
+// were removed.
+func (d *Databases) FlushDB(n int) (int, error) {
+	db, err := d.DB(n)
+	if err != nil {
+		return 0, err
+	}
+	return db.FlushAll(), nil
+}
+
+// FlushAll deletes every key of every database and returns how many live
+// keys were removed.
+func (d *Databases) FlushAll() int {
+	n := 0
+	for _, db := range d.dbs {
+		n += db.FlushAll()
+	}
+	return n
+}
+
+// Archive writes every database to w in the format of DataBase.Archive,
+// with a record naming the database before its keys. Each database is
+// archived at its own instant, one after another.
+func (d *Databases) Archive(w io.Writer) error {
+	return writeArchive(w, d.dbs, len(d.dbs) > 1)
+}
+
+// Restore merges an archive written by Archive into the databases, each
+// key into the database it was archived from, replacing existing keys of
+// the same names. An archive written by DataBase.Archive restores into
+// database 0. Nothing is restored if the archive is damaged, as with
+// DataBase.Restore, or names a database beyond Len.
+func (d *Databases) Restore(r io.Reader) error {
+	loaded, err := readArchive(r)
+	if err != nil {
+		return err
+	}
+	for n := range loaded {
+		if n >= len(d.dbs) {
+			return fmt.Errorf("archive: database %d: %w", n, ErrDBIndex)
+		}
+	}
+	var errs []error
+	for n, entries := range loaded {
+		if err := d.dbs[n].merge(entries); err != nil {
+			errs = append(errs, fmt.Errorf("archive: database %d: %w", n, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Persist saves every database to fileName with Archive, through the
+// backend of database 0. As with DataBase.Persist, a failed save keeps the
+// previous file, and values that cannot be encoded are left out and
+// reported in an *UnencodableError once the rest is saved.
+func (d *Databases) Persist(fileName string) error {
+	w, err := d.dbs[0].backend.Save(fileName)
+	if err != nil {
+		return err
+	}
+	err = d.Archive(w)
+	var skipped *UnencodableError
+	if err != nil && !errors.As(err, &skipped) {
+		abortSave(w)
+		return err
+	}
+	if err := syncFile(w); err != nil {
+		abortSave(w)
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return err // The skipped keys, if any.
+}
+
+// Load restores the databases from a file written by Persist.
+func (d *Databases) Load(fileName string) error {
+	r, err := d.dbs[0].backend.Load(fileName)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return d.Restore(r)
+}
+
+// Close closes every database.
+func (d *Databases) Close() error {
+	for _, db := range d.dbs {
+		db.Close()
+	}
+	return nil
+}
+
+// NewServer returns a server for the databases: clients start on database
+// 0 and switch with SELECT, and SWAPDB exchanges two databases. Replicas
+// that connect to it follow database 0 only.
+func (d *Databases) NewServer(cfg ServerConfig) *Server {
+	s := NewServer(d.dbs[0], cfg)
+	s.dbs = d
+	return s
+}
+
+// isDBCommand reports whether name is SELECT or SWAPDB, which act on the
+// server's set of databases rather than on one, and so are not in commands.
+func isDBCommand(name string) bool {
+	return strings.EqualFold(name, "SELECT") || strings.EqualFold(name, "SWAPDB")
+}
+
+// dbCommand runs SELECT or SWAPDB for a client. A server made by NewServer
+// has database 0 alone. The caller must hold execMu.
+func (s *Server) dbCommand(sess *session, args []string) any {
+	name := strings.ToUpper(args[0])
+	want := 1 // SELECT index
+	if name == "SWAPDB" {
+		want = 2 // SWAPDB index1 index2
+	}
+	if len(args)-1 != want {
+		return fmt.Errorf("wrong number of arguments for '%s' command", strings.ToLower(name))
+	}
+	indexes := make([]int, want)
+	for i, arg := range args[1:] {
+		n, ok := parseInt(arg)
+		if !ok {
+			return ErrNotInteger
+		}
+		indexes[i] = int(n)
+	}
+	dbs := s.dbs
+	if dbs == nil {
+		dbs = &Databases{dbs: []*DataBase{s.db}}
+	}
+	if name == "SWAPDB" {
+		if err := dbs.SwapDB(indexes[0], indexes[1]); err != nil {
+			return err
+		}
+		return simpleString("OK")
+	}
+	db, err := dbs.DB(indexes[0])
+	if err != nil {
+		return err
+	}
+	sess.db = db
+	return simpleString("OK")
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSwapDBMovesTTLs(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1_000_000, 0))
+	d := NewDatabases(3, WithClock(clock))
+	defer d.Close()
+	zero, _ := d.DB(0)
+	one, _ := d.DB(1)
+	zero.SetWithTTL("timed", "zero", time.Minute)
+	zero.HSetEX("hash", "brief", 1, time.Second)
+	zero.HSet("hash", "kept", 2)
+	one.Set("plain", "one")
+
+	if err := d.SwapDB(0, 1); err != nil {
+		t.Fatalf("SwapDB: %v", err)
+	}
+	if value, _ := zero.Get("plain"); value != "one" {
+		t.Errorf("database 0 plain = %v, want one: handles follow the data", value)
+	}
+	if _, ok := zero.Get("timed"); ok {
+		t.Error("database 0 kept its own key after the swap")
+	}
+	if ttl := zero.TTL("plain"); ttl >= 0 {
+		t.Errorf("TTL of plain = %v, want none", ttl)
+	}
+	if value, _ := one.Get("timed"); value != "zero" {
+		t.Errorf("database 1 timed = %v, want zero", value)
+	}
+	if ttl := one.TTL("timed"); ttl != time.Minute {
+		t.Errorf("TTL of timed in database 1 = %v, want a minute", ttl)
+	}
+	clock.Advance(2 * time.Second)
+	if got, _ := one.HGetAll("hash"); !reflect.DeepEqual(got, map[string]any{"kept": 2}) {
+		t.Errorf("hash in database 1 after its field TTL = %v, want only kept", got)
+	}
+	clock.Advance(time.Minute)
+	if _, ok := one.Get("timed"); ok {
+		t.Error("timed outlived its TTL in database 1")
+	}
+
+	if err := d.SwapDB(2, 2); err != nil {
+		t.Errorf("SwapDB of a database with itself: %v", err)
+	}
+	for _, pair := range [][2]int{{0, 3}, {-1, 0}} {
+		if err := d.SwapDB(pair[0], pair[1]); !errors.Is(err, ErrDBIndex) {
+			t.Errorf("SwapDB(%d, %d): %v, want ErrDBIndex", pair[0], pair[1], err)
+		}
+	}
+}
+
+func TestSwapDBRefusesReadOnly(t *testing.T) {
+	d := NewDatabases(2)
+	defer d.Close()
+	zero, _ := d.DB(0)
+	one, _ := d.DB(1)
+	zero.Set("k", "zero")
+	one.Set("k", "one")
+	one.SetReadOnly(true)
+	if err := d.SwapDB(0, 1); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("SwapDB with a read-only database: %v, want ErrReadOnly", err)
+	}
+	if value, _ := zero.Get("k"); value != "zero" {
+		t.Errorf("database 0 k = %v after a refused swap, want zero", value)
+	}
+	if value, _ := one.Get("k"); value != "one" {
+		t.Errorf("database 1 k = %v after a refused swap, want one", value)
+	}
+}
+
+func TestServerSelect(t *testing.T) {
+	d := NewDatabases(2)
+	defer d.Close()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := d.NewServer(ServerConfig{})
+	go s.Serve(ln)
+	t.Cleanup(func() { s.Close() })
+	c := dial(t, ln.Addr().String())
+
+	c.do(t, "SET", "k", "zero")
+	if reply := c.do(t, "SELECT", "1"); reply != "OK" {
+		t.Fatalf("SELECT 1 = %v, want OK", reply)
+	}
+	if reply := c.do(t, "GET", "k"); reply != nil {
+		t.Errorf("GET k in database 1 = %v, want nil", reply)
+	}
+	c.do(t, "SET", "k", "one")
+	for _, args := range [][]string{{"SELECT", "2"}, {"SELECT", "-1"}} {
+		if reply, ok := c.do(t, args...).(error); !ok || reply.Error() != ErrDBIndex.Error() {
+			t.Errorf("%q = %v, want %v", args, reply, ErrDBIndex)
+		}
+	}
+	if reply, ok := c.do(t, "SELECT", "one").(error); !ok || !strings.Contains(reply.Error(), "not an integer") {
+		t.Errorf("SELECT one = %v, want an integer error", reply)
+	}
+	if reply := c.do(t, "GET", "k"); reply != "one" {
+		t.Errorf("GET k after a refused SELECT = %v, want one: the client stays on database 1", reply)
+	}
+	if reply := c.do(t, "SWAPDB", "0", "1"); reply != "OK" {
+		t.Fatalf("SWAPDB = %v, want OK", reply)
+	}
+	if reply := c.do(t, "GET", "k"); reply != "zero" {
+		t.Errorf("GET k in database 1 after SWAPDB = %v, want zero", reply)
+	}
+
+	single := NewDataBase()
+	defer single.Close()
+	alone := dial(t, startServer(t, single, ServerConfig{}))
+	if reply, ok := alone.do(t, "SELECT", "1").(error); !ok || reply.Error() != ErrDBIndex.Error() {
+		t.Errorf("SELECT 1 on a single database = %v, want %v", reply, ErrDBIndex)
+	}
+}
+
+func TestDatabasesArchiveRoundTrip(t *testing.T) {
+	d := NewDatabases(3)
+	defer d.Close()
+	for n, value := range []string{"zero", "one", "two"} {
+		db, _ := d.DB(n)
+		db.Set("k", value)
+		db.SetWithTTL("timed:"+value, n, time.Hour)
+	}
+	var buf bytes.Buffer
+	if err := d.Archive(&buf); err != nil {
+		t.Fatalf("Archive: %v", err)
+	}
+	fileName := filepath.Join(t.TempDir(), "dbs.snapshot")
+	if err := d.Persist(fileName); err != nil {
+		t.Fatalf("Persist: %v", err)
+	}
+
+	for name, restore := range map[string]func(*Databases) error{
+		"Restore": func(r *Databases) error { return r.Restore(bytes.NewReader(buf.Bytes())) },
+		"Load":    func(r *Databases) error { return r.Load(fileName) },
+	} {
+		restored := NewDatabases(3)
+		if err := restore(restored); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		for n, value := range []string{"zero", "one", "two"} {
+			db, _ := restored.DB(n)
+			if got, _ := db.Get("k"); got != value {
+				t.Errorf("%s: database %d k = %v, want %s", name, n, got, value)
+			}
+			if ttl := db.TTL("timed:" + value); ttl <= 0 || ttl > time.Hour {
+				t.Errorf("%s: database %d TTL = %v, want up to an hour", name, n, ttl)
+			}
+			if keys := db.Keys("*"); len(keys) != 2 {
+				t.Errorf("%s: database %d holds %v, want only its own keys", name, n, keys)
+			}
+		}
+		restored.Close()
+	}
+
+	small := NewDatabases(2)
+	defer small.Close()
+	if err := small.Restore(bytes.NewReader(buf.Bytes())); !errors.Is(err, ErrDBIndex) {
+		t.Errorf("Restore into too few databases: %v, want ErrDBIndex", err)
+	}
+	if db, _ := small.DB(0); len(db.Keys("*")) != 0 {
+		t.Error("a refused Restore wrote keys")
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SetArtificialLatency makes every Get, GetCopy, GetString, Set, SetString,
+// SetWithTTL and Delete sleep for d before doing its work, so clients can be
+// tested against a slow store, for example to exercise their timeouts.
+//
+// This is a testing and debugging aid only and must never be enabled in
+// production. The sleep happens before any lock is taken, so it slows each
+// caller without serializing the others. Zero, the default, turns it off.
+func (db *DataBase) SetArtificialLatency(d time.Duration) {
+	db.artificialLatency.Store(int64(max(d, 0)))
+}
+
+// injectLatency sleeps for the artificial latency, if any.
+func (db *DataBase) injectLatency() {
+	if d := db.artificialLatency.Load(); d > 0 {
+		time.Sleep(time.Duration(d))
+	}
+}
+
+// cmdDebug implements the testing subcommands of DEBUG:
+//
+//	DEBUG SLEEP <seconds>          block this connection once, as in Redis
+//	DEBUG LATENCY <milliseconds>   set the artificial latency of the store
+func cmdDebug(db *DataBase, args []string) any {
+	switch strings.ToUpper(args[0]) {
+	case "SLEEP":
+		if len(args) != 2 {
+			return fmt.Errorf("wrong number of arguments for 'debug sleep' command")
+		}
+		secs, err := strconv.ParseFloat(args[1], 64)
+		if err != nil || secs < 0 {
+			return fmt.Errorf("value is not a valid float")
+		}
+		time.Sleep(time.Duration(secs * float64(time.Second)))
+		return simpleString("OK")
+	case "LATENCY":
+		if len(args) != 2 {
+			return fmt.Errorf("wrong number of arguments for 'debug latency' command")
+		}
+		ms, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil || ms < 0 {
+			return fmt.Errorf("value is not an integer or out of range")
+		}
+		db.SetArtificialLatency(time.Duration(ms) * time.Millisecond)
+		return simpleString("OK")
+	}
+	return fmt.Errorf("unknown subcommand '%s'", args[0])
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestArtificialLatency(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	db.SetArtificialLatency(30 * time.Millisecond)
+	for name, op := range map[string]func(){
+		"Set":       func() { db.Set("k", "v") },
+		"Get":       func() { db.Get("k") },
+		"GetString": func() { db.GetString("k") },
+		"Delete":    func() { db.Delete("k") },
+	} {
+		start := time.Now()
+		op()
+		if took := time.Since(start); took < 30*time.Millisecond {
+			t.Errorf("%s took %v, want at least the injected 30ms", name, took)
+		}
+	}
+
+	db.SetArtificialLatency(0)
+	start := time.Now()
+	for range 100 {
+		db.Get("k")
+	}
+	if took := time.Since(start); took >= 30*time.Millisecond {
+		t.Errorf("100 Gets took %v with the latency off", took)
+	}
+}
+
+func TestDebugCommands(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	c := dial(t, startServer(t, db, ServerConfig{}))
+	start := time.Now()
+	if reply := c.do(t, "DEBUG", "SLEEP", "0.05"); reply != "OK" {
+		t.Fatalf("DEBUG SLEEP = %v, want OK", reply)
+	}
+	if took := time.Since(start); took < 50*time.Millisecond {
+		t.Errorf("DEBUG SLEEP 0.05 returned after %v", took)
+	}
+
+	if reply := c.do(t, "DEBUG", "LATENCY", "20"); reply != "OK" {
+		t.Fatalf("DEBUG LATENCY = %v, want OK", reply)
+	}
+	start = time.Now()
+	c.do(t, "GET", "k")
+	if took := time.Since(start); took < 20*time.Millisecond {
+		t.Errorf("GET took %v, want at least the 20ms set by DEBUG LATENCY", took)
+	}
+	if _, ok := c.do(t, "DEBUG", "NOPE").(error); !ok {
+		t.Error("an unknown DEBUG subcommand did not fail")
+	}
+}
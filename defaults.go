@@ -0,0 +1,30 @@
+package main
+
+// GetOrDefault returns the value stored at key, or def if the key is missing
+// or expired. A nil def falls back to the provider set with
+// SetDefaultProvider, if any. The default is only returned, never stored, so
+// the next call for a missing key computes it again.
+func (db *DataBase) GetOrDefault(key string, def any) any {
+	if value, exists := db.Get(key); exists {
+		return value
+	}
+	if def != nil {
+		return def
+	}
+	db.lock.RLock() // The provider is read under the lock.
+	provider := db.defaultProvider
+	db.lock.RUnlock()
+	if provider == nil {
+		return nil
+	}
+	return provider(key) // Outside the lock, so it may call back into the database.
+}
+
+// SetDefaultProvider sets the function GetOrDefault consults for missing
+// keys when it is given no default of its own. Its result is not stored. A
+// nil fn removes the provider.
+func (db *DataBase) SetDefaultProvider(fn func(key string) any) {
+	db.lock.Lock()         // Acquire a write lock.
+	defer db.lock.Unlock() // Release the lock when the function exits.
+	db.defaultProvider = fn
+}
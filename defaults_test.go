@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetOrDefault(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1_000_000, 0))
+	db := NewDataBase(WithClock(clock))
+	defer db.Close()
+	db.Set("lang", "go")
+	db.SetWithTTL("session", "tok", time.Second)
+	clock.Advance(time.Second)
+
+	if got := db.GetOrDefault("lang", "en"); got != "go" {
+		t.Errorf("GetOrDefault of a present key = %v, want go", got)
+	}
+	if got := db.GetOrDefault("missing", "en"); got != "en" {
+		t.Errorf("GetOrDefault of a missing key = %v, want the default en", got)
+	}
+	if got := db.GetOrDefault("session", "none"); got != "none" {
+		t.Errorf("GetOrDefault of an expired key = %v, want the default", got)
+	}
+	if got := db.GetOrDefault("missing", nil); got != nil {
+		t.Errorf("GetOrDefault with no default or provider = %v, want nil", got)
+	}
+
+	var asked []string
+	db.SetDefaultProvider(func(key string) any {
+		asked = append(asked, key)
+		db.Exists(key) // Runs outside the lock, so it may call back in.
+		return "default:" + key
+	})
+	if got := db.GetOrDefault("theme", nil); got != "default:theme" {
+		t.Errorf("GetOrDefault with a provider = %v, want default:theme", got)
+	}
+	if got := db.GetOrDefault("theme", "dark"); got != "dark" {
+		t.Errorf("GetOrDefault with a default and a provider = %v, want the default to win", got)
+	}
+	if got := db.GetOrDefault("lang", nil); got != "go" {
+		t.Errorf("GetOrDefault of a present key with a provider = %v, want go", got)
+	}
+	db.GetOrDefault("theme", nil)
+	if len(asked) != 2 || asked[0] != "theme" || asked[1] != "theme" {
+		t.Errorf("provider asked for %q, want theme twice: the default is not cached", asked)
+	}
+	if _, ok := db.Get("theme"); ok {
+		t.Error("the provided default was stored")
+	}
+
+	db.SetDefaultProvider(nil)
+	if got := db.GetOrDefault("theme", nil); got != nil {
+		t.Errorf("GetOrDefault after removing the provider = %v, want nil", got)
+	}
+}
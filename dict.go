@@ -0,0 +1,149 @@
+package main
+
+import "iter"
+
+// dict is a string-keyed map that can be rebuilt incrementally, in the
+// manner of Redis's incremental rehashing. While a rehash is in progress the
+// entries live in two maps: main, which receives every write, and old, which
+// is drained into main a chunk at a time. Reads consult both, so callers
+// never observe the migration. The caller provides any locking.
+type dict[V any] struct {
+	main map[string]V
+	old  map[string]V // Non-nil only while rehashing.
+
+	// resolve, when set, turns a stored placeholder into the value it
+	// stands for on every read, reporting false if it cannot. It lets
+	// OpenMMapped leave values undecoded until they are first used.
+	resolve func(V) (V, bool)
+
+	// store, when set, turns a value into the form kept in the maps
+	// before every write; resolve must undo it. It lets
+	// CompressLargeValues keep large values compressed.
+	store func(V) V
+}
+
+// newDict returns an empty dict.
+func newDict[V any]() *dict[V] {
+	return &dict[V]{main: make(map[string]V)}
+}
+
+// get returns the value stored at key.
+func (d *dict[V]) get(key string) (V, bool) {
+	v, ok := d.main[key]
+	if !ok {
+		v, ok = d.old[key] // Indexing a nil map is fine.
+	}
+	if ok && d.resolve != nil {
+		return d.resolve(v)
+	}
+	return v, ok
+}
+
+// raw returns the value at key as it is kept, without resolving it.
+func (d *dict[V]) raw(key string) (V, bool) {
+	v, ok := d.main[key]
+	if !ok {
+		v, ok = d.old[key]
+	}
+	return v, ok
+}
+
+// value returns the value stored at key, or the zero value.
+func (d *dict[V]) value(key string) V {
+	v, _ := d.get(key)
+	return v
+}
+
+// has reports whether key is present.
+func (d *dict[V]) has(key string) bool {
+	_, ok := d.get(key)
+	return ok
+}
+
+// set stores value at key. Writes always land in main.
+func (d *dict[V]) set(key string, value V) {
+	if d.store != nil {
+		value = d.store(value)
+	}
+	d.main[key] = value
+	if d.old != nil {
+		delete(d.old, key) // The key has effectively migrated.
+	}
+}
+
+// del removes key.
+func (d *dict[V]) del(key string) {
+	delete(d.main, key)
+	if d.old != nil {
+		delete(d.old, key)
+	}
+}
+
+// len returns the number of entries.
+func (d *dict[V]) len() int {
+	return len(d.main) + len(d.old)
+}
+
+// all iterates over every entry. Entries may be deleted during iteration.
+func (d *dict[V]) all() iter.Seq2[string, V] {
+	return func(yield func(string, V) bool) {
+		for _, m := range []map[string]V{d.main, d.old} {
+			for k, v := range m {
+				if d.resolve != nil {
+					var ok bool
+					if v, ok = d.resolve(v); !ok {
+						continue // Unreadable entries are skipped, as get hides them.
+					}
+				}
+				if !yield(k, v) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// rawAll iterates over every entry as it is kept, without resolving values.
+func (d *dict[V]) rawAll() iter.Seq2[string, V] {
+	return func(yield func(string, V) bool) {
+		for _, m := range []map[string]V{d.main, d.old} {
+			for k, v := range m {
+				if !yield(k, v) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// rehashing reports whether entries are still being migrated.
+func (d *dict[V]) rehashing() bool {
+	return d.old != nil
+}
+
+// startRehash begins migrating every entry into a fresh map sized to the
+// current count. If a rehash is already running it simply continues.
+func (d *dict[V]) startRehash() {
+	if d.old != nil {
+		return
+	}
+	d.old = d.main
+	d.main = make(map[string]V, len(d.old))
+}
+
+// rehashStep migrates up to n entries and reports whether the rehash is
+// complete, at which point the oversized old map is released.
+func (d *dict[V]) rehashStep(n int) bool {
+	for k, v := range d.old {
+		if n == 0 {
+			break
+		}
+		d.main[k] = v
+		delete(d.old, k)
+		n--
+	}
+	if len(d.old) == 0 {
+		d.old = nil // Let the garbage collector have it.
+	}
+	return d.old == nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestDictMidRehash(t *testing.T) {
+	d := newDict[int]()
+	for i := range 100 {
+		d.set(fmt.Sprint(i), i)
+	}
+	d.startRehash()
+	d.rehashStep(30)
+	if !d.rehashing() || len(d.main) != 30 || len(d.old) != 70 {
+		t.Fatalf("after one step: main %d, old %d", len(d.main), len(d.old))
+	}
+	d.set("5", 500)  // Possibly still in old.
+	d.del("6")       // Possibly still in old.
+	d.set("new", -1) // Lands in main.
+	if d.len() != 100 {
+		t.Errorf("len = %d, want 100", d.len())
+	}
+	if v, ok := d.get("5"); !ok || v != 500 {
+		t.Errorf("get(5) = %d, %v; want the new 500", v, ok)
+	}
+	if d.has("6") {
+		t.Error("a deleted key is still visible")
+	}
+	seen := 0
+	for range d.all() {
+		seen++
+	}
+	if seen != 100 {
+		t.Errorf("all visited %d entries, want 100", seen)
+	}
+	for !d.rehashStep(7) {
+	}
+	if d.rehashing() || d.len() != 100 || d.value("5") != 500 || d.value("99") != 99 {
+		t.Errorf("after the rehash: rehashing %v, len %d", d.rehashing(), d.len())
+	}
+}
+
+func TestOperationsMidRehash(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1_000_000, 0))
+	db := NewDataBase(WithClock(clock))
+	defer db.Close()
+	for i := range 1000 {
+		db.SetWithTTL(fmt.Sprintf("key%d", i), i, time.Hour)
+	}
+	db.lock.Lock() // Start a rehash by hand, with no goroutine to finish it.
+	db.data.startRehash()
+	db.expires.startRehash()
+	db.data.rehashStep(400)
+	db.expires.rehashStep(100)
+	db.lock.Unlock()
+	if !db.Rehashing() {
+		t.Fatal("no rehash running")
+	}
+
+	db.Set("key1", "overwritten")
+	db.Delete("key2")
+	db.Set("fresh", 1)
+	db.Expire("key3", time.Minute)
+	if n, _ := db.Incr("counter"); n != 1 {
+		t.Errorf("Incr mid-rehash = %d", n)
+	}
+	if value, _ := db.Get("key1"); value != "overwritten" {
+		t.Errorf("key1 = %v", value)
+	}
+	if _, ok := db.Get("key2"); ok {
+		t.Error("deleted key2 is visible")
+	}
+	if got := len(db.Keys("*")); got != 1001 {
+		t.Errorf("%d keys mid-rehash, want 1001", got)
+	}
+	if ttl := db.TTL("key500"); ttl != time.Hour {
+		t.Errorf("TTL of an unmigrated key = %v", ttl)
+	}
+	clock.Advance(time.Minute)
+	if _, ok := db.Get("key3"); ok {
+		t.Error("key3 outlived its new TTL")
+	}
+
+	db.lock.Lock()
+	for !db.data.rehashStep(50) || !db.expires.rehashStep(50) {
+	}
+	db.lock.Unlock()
+	if db.Rehashing() {
+		t.Error("still rehashing after the last step")
+	}
+	if value, _ := db.Get("key999"); value != 999 {
+		t.Errorf("key999 = %v after the rehash", value)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"crypto/sha256"
+	"io"
+	"reflect"
+	"sort"
+)
+
+// DiffSnapshots compares two snapshot files and reports, in sorted order,
+// the keys present only in fileB (added), only in fileA (removed), and in
+// both with values that differ under reflect.DeepEqual (changed).
+//
+// Neither file is loaded into memory whole. The first pass keeps just a
+// digest of each encoded value of fileA; records of fileB whose digest
+// matches are equal without decoding. Since gob does not encode maps in a
+// fixed order, equal values may still digest differently, so only those
+// candidates are decoded and compared with DeepEqual in a second pass.
+//
+// Files compressed by WithAtRest are read as they are; encrypted ones need
+// the key, so compare them with DataBase.DiffSnapshots.
+func DiffSnapshots(fileA, fileB string) (added, removed, changed []string, err error) {
+	return diffSnapshots(atRestBackend{Backend: FileBackend{}}.Load, fileA, fileB)
+}
+
+// DiffSnapshots is like the DiffSnapshots function, but reads the files
+// through the database's backend (see WithBackend) and at-rest settings
+// (see WithAtRest), so it also compares snapshots encrypted with its key.
+func (db *DataBase) DiffSnapshots(fileA, fileB string) (added, removed, changed []string, err error) {
+	return diffSnapshots(db.backend.Load, fileA, fileB)
+}
+
+// diffSnapshots implements DiffSnapshots, opening the files with load.
+func diffSnapshots(load func(name string) (io.ReadCloser, error), fileA, fileB string) (added, removed, changed []string, err error) {
+	digestsA := make(map[string][sha256.Size]byte)
+	err = scanSnapshotFile(load, fileA, func(key string, sr *snapshotReader) error {
+		blob, err := sr.raw(key)
+		if err != nil {
+			return err
+		}
+		digestsA[key] = sha256.Sum256(blob)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	seen := make(map[string]bool, len(digestsA))
+	candidates := make(map[string]any) // Decoded fileB values that need DeepEqual.
+	err = scanSnapshotFile(load, fileB, func(key string, sr *snapshotReader) error {
+		blob, err := sr.raw(key)
+		if err != nil {
+			return err
+		}
+		digest, inA := digestsA[key]
+		if !inA {
+			added = append(added, key)
+			return nil
+		}
+		seen[key] = true
+		if digest == sha256.Sum256(blob) {
+			return nil // Byte-identical encoding: certainly equal.
+		}
+		value, err := decodeValue(blob)
+		if err != nil {
+			return err
+		}
+		candidates[key] = value
+		return nil
+	})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	for key := range digestsA {
+		if !seen[key] {
+			removed = append(removed, key)
+		}
+	}
+	if len(candidates) > 0 {
+		err = scanSnapshotFile(load, fileA, func(key string, sr *snapshotReader) error {
+			other, ok := candidates[key]
+			if !ok {
+				return sr.skip() // Not a candidate; no need to decode it.
+			}
+			value, err := sr.value(key)
+			if err != nil {
+				return err
+			}
+			if !reflect.DeepEqual(value, other) {
+				changed = append(changed, key)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Strings(changed)
+	return added, removed, changed, nil
+}
+
+// scanSnapshotFile streams the records of a snapshot file opened with load,
+// calling fn for each key. fn must consume the record's value with raw,
+// value or skip.
+func scanSnapshotFile(load func(name string) (io.ReadCloser, error), fileName string, fn func(key string, sr *snapshotReader) error) error {
+	file, err := load(fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	sr, err := newSnapshotReader(file)
+	if err != nil {
+		return err
+	}
+	for {
+		key, err := sr.next()
+		if err == io.EOF {
+			return sr.verify() // Reached the end marker.
+		}
+		if err != nil {
+			return sr.checked(err)
+		}
+		if err := fn(key, sr); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// diffFixture saves two snapshots of db, before and after changing it, and
+// returns their names.
+func diffFixture(t *testing.T, db *DataBase) (fileA, fileB string) {
+	t.Helper()
+	dir := t.TempDir()
+	fileA, fileB = filepath.Join(dir, "a.gob"), filepath.Join(dir, "b.gob")
+	db.Set("same", "1")
+	db.Set("changed", "old")
+	db.Set("removed", "gone")
+	db.Set("hash", map[string]any{"x": 1, "y": 2, "z": 3}) // Map order may differ between saves.
+	if err := db.Persist(fileA); err != nil {
+		t.Fatal(err)
+	}
+	db.Set("changed", "new")
+	db.Delete("removed")
+	db.Set("added", "here")
+	if err := db.Persist(fileB); err != nil {
+		t.Fatal(err)
+	}
+	return fileA, fileB
+}
+
+// checkDiff compares the result of a DiffSnapshots call with the changes
+// made by diffFixture.
+func checkDiff(t *testing.T, added, removed, changed []string, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("DiffSnapshots: %v", err)
+	}
+	if !slices.Equal(added, []string{"added"}) {
+		t.Errorf("added = %q, want [added]", added)
+	}
+	if !slices.Equal(removed, []string{"removed"}) {
+		t.Errorf("removed = %q, want [removed]", removed)
+	}
+	if !slices.Equal(changed, []string{"changed"}) {
+		t.Errorf("changed = %q, want [changed]", changed)
+	}
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	fileA, fileB := diffFixture(t, db)
+	added, removed, changed, err := DiffSnapshots(fileA, fileB)
+	checkDiff(t, added, removed, changed, err)
+}
+
+func TestDiffSnapshotsCompressed(t *testing.T) {
+	db := NewDataBase(WithAtRest(AtRestConfig{Compression: Gzip}))
+	defer db.Close()
+	fileA, fileB := diffFixture(t, db)
+	added, removed, changed, err := DiffSnapshots(fileA, fileB)
+	checkDiff(t, added, removed, changed, err)
+}
+
+func TestDiffSnapshotsEncrypted(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	db := NewDataBase(WithAtRest(AtRestConfig{Compression: Gzip, Key: key}))
+	defer db.Close()
+	fileA, fileB := diffFixture(t, db)
+	if _, _, _, err := DiffSnapshots(fileA, fileB); !errors.Is(err, errNoKey) {
+		t.Errorf("DiffSnapshots without the key: %v, want errNoKey", err)
+	}
+	added, removed, changed, err := db.DiffSnapshots(fileA, fileB)
+	checkDiff(t, added, removed, changed, err)
+}
+
+// writeSnapshot writes entries to a snapshot file with snapshotWriter
+// directly, without going through a database.
+func writeSnapshot(t *testing.T, fileName string, entries map[string]any) {
+	t.Helper()
+	file, err := os.Create(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	sw, err := newSnapshotWriter(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, value := range entries {
+		if err := sw.writeEntry(key, value, time.Time{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sw.close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDiffHandBuiltSnapshots(t *testing.T) {
+	dir := t.TempDir()
+	fileA, fileB := filepath.Join(dir, "a.gob"), filepath.Join(dir, "b.gob")
+	writeSnapshot(t, fileA, map[string]any{
+		"same":    int64(1),
+		"changed": "old",
+		"retyped": int64(2),
+		"removed": "gone",
+		"list":    List{"a", "b"},
+	})
+	writeSnapshot(t, fileB, map[string]any{
+		"same":    int64(1),
+		"changed": "new",
+		"retyped": "2", // Equal text, different type.
+		"added":   "here",
+		"list":    List{"a", "b"},
+	})
+	added, removed, changed, err := DiffSnapshots(fileA, fileB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(added, []string{"added"}) || !slices.Equal(removed, []string{"removed"}) ||
+		!slices.Equal(changed, []string{"changed", "retyped"}) {
+		t.Errorf("DiffSnapshots = added %q, removed %q, changed %q", added, removed, changed)
+	}
+
+	if added, removed, changed, err := DiffSnapshots(fileA, fileA); err != nil || len(added)+len(removed)+len(changed) > 0 {
+		t.Errorf("DiffSnapshots of a file with itself = %q, %q, %q, %v", added, removed, changed, err)
+	}
+	if _, _, _, err := DiffSnapshots(fileA, filepath.Join(dir, "missing.gob")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("DiffSnapshots with a missing file: %v, want os.ErrNotExist", err)
+	}
+}
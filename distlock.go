@@ -0,0 +1,87 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Errors returned by Lock and the methods of *Lock.
+var (
+	ErrLockHeld = errors.New("lock: held by another owner")
+	ErrLockLost = errors.New("lock: no longer held; it expired or was released")
+)
+
+// Lock is an exclusive lock on a name, held by whoever took it with
+// DataBase.Lock until it is unlocked or its TTL runs out. The lock is an
+// ordinary key holding a random token with a TTL, so it is replicated and
+// persisted like any key, and a holder that dies gives it up when the TTL
+// expires rather than blocking everyone forever.
+type Lock struct {
+	db    *DataBase
+	name  string
+	token string        // Unique to this holder; proves ownership.
+	ttl   time.Duration // Restarted by Refresh.
+}
+
+// Lock takes the lock called name for ttl, storing it under the key name,
+// or returns ErrLockHeld if someone else holds it. It does not wait: retry
+// or back off as suits the caller. A holder doing work that may outlast ttl
+// should call Refresh well before it runs out, since an expired lock can be
+// taken by someone else while the work is still going.
+func (db *DataBase) Lock(name string, ttl time.Duration) (*Lock, error) {
+	if ttl <= 0 {
+		return nil, fmt.Errorf("lock: ttl %v is not positive", ttl)
+	}
+	var raw [16]byte
+	rand.Read(raw[:]) // Never fails; see crypto/rand.
+	l := &Lock{db: db, name: name, token: hex.EncodeToString(raw[:]), ttl: ttl}
+
+	db.lock.Lock()    // One lock for the check, the write and the TTL.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	if db.readOnly {
+		return nil, ErrReadOnly
+	}
+	db.expireIfNeeded(name) // An expired lock is free to take.
+	if db.data.has(name) {
+		return nil, ErrLockHeld
+	}
+	if err := db.setChecked(name, l.token); err != nil {
+		return nil, err
+	}
+	db.expires.set(name, db.clock.Now().Add(ttl)) // Logged with the write, at unlock.
+	return l, nil
+}
+
+// Name returns the name the lock was taken under.
+func (l *Lock) Name() string { return l.name }
+
+// Unlock releases the lock. Only the holder's token is deleted, so a holder
+// whose lock expired and was taken by someone else gets ErrLockLost and
+// leaves the new holder's lock alone.
+func (l *Lock) Unlock() error {
+	if !l.db.DeleteIfEqual(l.name, l.token) {
+		return ErrLockLost
+	}
+	return nil
+}
+
+// Refresh restarts the lock's TTL from now, keeping it for another full
+// ttl, or returns ErrLockLost if it is no longer held by l.
+func (l *Lock) Refresh() error {
+	db := l.db
+	db.lock.Lock()    // One lock for the check and the new deadline.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	if db.readOnly {
+		return ErrReadOnly
+	}
+	db.expireIfNeeded(l.name)
+	if value, exists := db.data.get(l.name); !exists || value != l.token {
+		return ErrLockLost
+	}
+	db.expires.set(l.name, db.clock.Now().Add(l.ttl))
+	db.touch(l.name)
+	return nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLockContention(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	const workers = 16
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		holder *Lock
+		held   int
+	)
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l, err := db.Lock("job", time.Minute)
+			if errors.Is(err, ErrLockHeld) {
+				return
+			}
+			if err != nil {
+				t.Errorf("Lock: %v", err)
+				return
+			}
+			mu.Lock()
+			holder, held = l, held+1
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	if held != 1 {
+		t.Fatalf("%d of %d callers took the lock, want exactly 1", held, workers)
+	}
+	if _, err := db.Lock("job", time.Minute); !errors.Is(err, ErrLockHeld) {
+		t.Errorf("Lock of a held lock: %v, want ErrLockHeld", err)
+	}
+	if _, err := db.Lock("other", time.Minute); err != nil {
+		t.Errorf("Lock of another name: %v", err)
+	}
+	if err := holder.Unlock(); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	if _, err := db.Lock("job", time.Minute); err != nil {
+		t.Errorf("Lock after Unlock: %v", err)
+	}
+}
+
+func TestLockExpiry(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1_000_000, 0))
+	db := NewDataBase(WithClock(clock))
+	defer db.Close()
+	first, err := db.Lock("job", 10*time.Second)
+	if err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+
+	clock.Advance(6 * time.Second)
+	if err := first.Refresh(); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	clock.Advance(6 * time.Second) // Past the first TTL, inside the refreshed one.
+	if _, err := db.Lock("job", time.Second); !errors.Is(err, ErrLockHeld) {
+		t.Errorf("Lock after Refresh: %v, want ErrLockHeld", err)
+	}
+
+	clock.Advance(5 * time.Second)
+	second, err := db.Lock("job", 10*time.Second)
+	if err != nil {
+		t.Fatalf("Lock after the TTL ran out: %v, want it free", err)
+	}
+	if err := first.Refresh(); !errors.Is(err, ErrLockLost) {
+		t.Errorf("Refresh of an expired lock: %v, want ErrLockLost", err)
+	}
+	if err := second.Refresh(); err != nil {
+		t.Errorf("Refresh by the new holder: %v", err)
+	}
+
+	if _, err := db.Lock("job", 0); err == nil {
+		t.Error("Lock with a zero TTL succeeded")
+	}
+}
+
+func TestUnlockChecksToken(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1_000_000, 0))
+	db := NewDataBase(WithClock(clock))
+	defer db.Close()
+	stale, err := db.Lock("job", time.Second)
+	if err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+	clock.Advance(2 * time.Second)
+	current, err := db.Lock("job", time.Minute)
+	if err != nil {
+		t.Fatalf("Lock after expiry: %v", err)
+	}
+
+	if err := stale.Unlock(); !errors.Is(err, ErrLockLost) {
+		t.Errorf("Unlock with a stale token: %v, want ErrLockLost", err)
+	}
+	if _, err := db.Lock("job", time.Minute); !errors.Is(err, ErrLockHeld) {
+		t.Errorf("Lock after a stale Unlock: %v, want the new holder to keep it", err)
+	}
+	forged := &Lock{db: db, name: "job", token: "guessed", ttl: time.Minute}
+	if err := forged.Unlock(); !errors.Is(err, ErrLockLost) {
+		t.Errorf("Unlock with a wrong token: %v, want ErrLockLost", err)
+	}
+
+	if err := current.Unlock(); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	if err := current.Unlock(); !errors.Is(err, ErrLockLost) {
+		t.Errorf("second Unlock: %v, want ErrLockLost", err)
+	}
+	if _, ok := db.Get("job"); ok {
+		t.Error("the lock key survived Unlock")
+	}
+}
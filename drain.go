@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"time"
+)
+
+// ErrReadOnly is returned by writes once SetReadOnly or Drain has made the
+// database read-only.
+var ErrReadOnly = errors.New("READONLY the database is not accepting writes")
+
+// drainPoll is how often Drain checks whether background work has settled.
+const drainPoll = time.Millisecond
+
+// Drain prepares the database for shutdown under load. It makes the database
+// read-only, so every later write fails with ErrReadOnly (or, for methods
+// without an error, does nothing), while reads carry on. It then waits for
+// the writes already queued by SetAsync to be applied and for a running
+// BGSave or compaction to finish, and finally, if SaveRules is configured
+// and anything changed since the last save, saves a snapshot to its file.
+//
+// Drain returns the save error, if any, or ctx.Err() if ctx ends first; the
+// database stays read-only either way. Call Close afterwards to stop the
+// background goroutines.
+func (db *DataBase) Drain(ctx context.Context) error {
+	db.lock.Lock() // Writers check the flag under the lock, so none slips past.
+	db.readOnly = true
+	db.lock.Unlock()
+	db.logger.Info("draining")
+
+	if err := settle(ctx, func() bool { return db.asyncPending.Load() == 0 }); err != nil {
+		return err
+	}
+	if err := settle(ctx, db.idle); err != nil {
+		return err
+	}
+
+	db.lock.RLock()
+	sched := db.saveSchedule
+	db.lock.RUnlock()
+	if sched == nil || db.dirty.Load() == 0 {
+		return nil // Nothing to flush.
+	}
+	done := make(chan error, 1)
+	db.spawn(func() { done <- db.Persist(sched.fileName) }) // Close still waits for it.
+	select {
+	case err := <-done:
+		if saveFailed(err) {
+			return err
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// SetReadOnly makes the database refuse writes, as Drain does, or accept
+// them again, for maintenance windows or promoting a replica by hand.
+// While read-only, every write fails with ErrReadOnly (or, for methods
+// without an error, does nothing), and so do loads such as Load and
+// ImportCSV; reads carry on. On a replica (see ReplicaOf) the setting
+// becomes the caller's: stopping replication no longer makes the database
+// writable, and SetReadOnly(false) lets local writes diverge from the
+// primary until the next full sync.
+func (db *DataBase) SetReadOnly(readOnly bool) {
+	db.lock.Lock()    // Writers check the flag under the lock.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	db.readOnly = readOnly
+	if db.replica != nil {
+		db.replica.ownsReadOnly = false
+	}
+	db.logger.Info("read-only changed", "read_only", readOnly)
+}
+
+// ReadOnly reports whether the database refuses writes, because of
+// SetReadOnly, Drain or ReplicaOf.
+func (db *DataBase) ReadOnly() bool {
+	db.lock.RLock()         // Acquire a read lock.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+	return db.readOnly
+}
+
+// Shutdown stops the database cleanly: it shuts down the servers made for
+// it by NewServer, as Server.Shutdown does, so commands already running
+// finish and reply; it then drains the database, making it read-only and
+// saving a final snapshot to the SaveRules file if anything changed (see
+// Drain); and last it closes it, stopping the background goroutines and
+// syncing and closing the append-only file (see Close). If ctx ends first,
+// the servers hang up on their remaining clients, the save is abandoned
+// unless already written, and the database is still closed; the errors met
+// along the way, ctx's among them, are returned joined.
+func (db *DataBase) Shutdown(ctx context.Context) error {
+	db.serversMu.Lock()
+	servers := slices.Collect(maps.Keys(db.servers))
+	db.serversMu.Unlock()
+	var errs []error
+	for _, s := range servers {
+		if err := s.Shutdown(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := db.Drain(ctx); err != nil {
+		errs = append(errs, err)
+	}
+	db.Close()
+	db.logger.Info("shut down")
+	return errors.Join(errs...)
+}
+
+// attachServer records a server for Shutdown.
+func (db *DataBase) attachServer(s *Server) {
+	db.serversMu.Lock()
+	defer db.serversMu.Unlock()
+	if db.servers == nil {
+		db.servers = make(map[*Server]struct{})
+	}
+	db.servers[s] = struct{}{}
+}
+
+// detachServer forgets a server once it is closed.
+func (db *DataBase) detachServer(s *Server) {
+	db.serversMu.Lock()
+	defer db.serversMu.Unlock()
+	delete(db.servers, s)
+}
+
+// idle reports whether no BGSave or compaction is running.
+func (db *DataBase) idle() bool {
+	db.lock.RLock()         // Acquire a read lock.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+	return db.bgsave == nil && !db.data.rehashing() && !db.expires.rehashing()
+}
+
+// settle waits until done reports true or ctx ends.
+func settle(ctx context.Context, done func() bool) error {
+	ticker := time.NewTicker(drainPoll)
+	defer ticker.Stop()
+	for !done() {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
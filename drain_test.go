@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDrainPersistsAsyncWrites(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "database.gob")
+	db := NewDataBase(WithAsyncWrites(1024))
+	defer db.Close()
+	db.SaveRules(fileName, SaveRule{After: time.Hour, Changes: 1 << 30}) // Never due on its own.
+	for i := range 500 {
+		if err := db.SetAsync(fmt.Sprintf("key%d", i), i); err != nil {
+			t.Fatalf("SetAsync: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := db.Drain(ctx); err != nil {
+		t.Fatalf("Drain: %v", err)
+	}
+	if err := db.SetAsync("late", 1); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("SetAsync after Drain: %v, want ErrReadOnly", err)
+	}
+
+	restored := NewDataBase()
+	defer restored.Close()
+	if err := restored.Load(fileName); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if got := len(restored.Keys("*")); got != 500 {
+		t.Errorf("snapshot holds %d keys, want all 500 queued writes", got)
+	}
+}
+
+func TestReadOnlyRefusesWrites(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	db.Set("counter", int64(1))
+	fileName := filepath.Join(t.TempDir(), "database.gob")
+	if err := db.Persist(fileName); err != nil {
+		t.Fatal(err)
+	}
+	var csv strings.Builder
+	if err := db.ExportCSV(&csv); err != nil {
+		t.Fatal(err)
+	}
+	db.Delete("counter")
+	db.SetReadOnly(true)
+	if !db.ReadOnly() {
+		t.Fatal("ReadOnly() = false after SetReadOnly(true)")
+	}
+
+	for name, write := range map[string]func() error{
+		"Set":       func() error { return db.Set("k", "v") },
+		"ImportCSV": func() error { return db.ImportCSV(strings.NewReader(csv.String())) },
+		"Load":      func() error { return db.Load(fileName) },
+		"LoadBestEffort": func() error {
+			_, err := db.LoadBestEffort(fileName)
+			return err
+		},
+	} {
+		if err := write(); !errors.Is(err, ErrReadOnly) {
+			t.Errorf("%s on a read-only database: %v, want ErrReadOnly", name, err)
+		}
+	}
+	if allowed, remaining := db.AllowN("limit", 10, time.Minute, 1); allowed || remaining != 0 {
+		t.Errorf("AllowN on a read-only database = %v, %d; want false, 0", allowed, remaining)
+	}
+	if keys := db.Keys("*"); len(keys) != 0 {
+		t.Errorf("read-only database was written: %v", keys)
+	}
+
+	db.SetReadOnly(false)
+	if allowed, remaining := db.AllowN("limit", 10, time.Minute, 1); !allowed || remaining != 9 {
+		t.Errorf("AllowN once writable = %v, %d; want true, 9", allowed, remaining)
+	}
+	if err := db.ImportCSV(strings.NewReader(csv.String())); err != nil {
+		t.Errorf("ImportCSV once writable: %v", err)
+	}
+}
+
+func TestShutdownSavesAndStopsServers(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "database.gob")
+	db := NewDataBase()
+	db.SaveRules(fileName, SaveRule{After: time.Hour, Changes: 1 << 30}) // Only the final save.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go NewServer(db, ServerConfig{}).Serve(ln)
+	c := dial(t, ln.Addr().String())
+	if reply := c.do(t, "SET", "k", "v"); reply != "OK" {
+		t.Fatalf("SET = %v, want OK", reply)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := db.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if _, err := c.r.ReadByte(); err == nil {
+		t.Error("a client connection stayed open after Shutdown")
+	}
+	if _, err := net.Dial("tcp", ln.Addr().String()); err == nil {
+		t.Error("the server accepted a connection after Shutdown")
+	}
+	if err := db.Set("late", 1); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Set after Shutdown: %v, want ErrReadOnly", err)
+	}
+	select {
+	case <-db.stop:
+	default:
+		t.Error("Shutdown left the background goroutines running")
+	}
+
+	restored := NewDataBase()
+	defer restored.Close()
+	if err := restored.Load(fileName); err != nil {
+		t.Fatalf("Load of the final save: %v", err)
+	}
+	if value, _ := restored.Get("k"); value != "v" {
+		t.Errorf("saved k = %v, want v", value)
+	}
+}
+
+func TestShutdownPastDeadline(t *testing.T) {
+	db := NewDataBase()
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	defer close(release)
+	db.OnGet(func(ctx context.Context, key string, found bool) {
+		started <- struct{}{}
+		<-release
+	})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go NewServer(db, ServerConfig{}).Serve(ln)
+	dial(t, ln.Addr().String()).send(t, "GET", "stuck")
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := db.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Shutdown with a command stuck: %v, want context.DeadlineExceeded", err)
+	}
+	select {
+	case <-db.stop:
+	default:
+		t.Error("a Shutdown that ran out of time left the database open")
+	}
+}
+
+func TestSetReadOnlyOnReplica(t *testing.T) {
+	primary := NewDataBase()
+	defer primary.Close()
+	addr := startServer(t, primary, ServerConfig{})
+	replica := NewDataBase()
+	defer replica.Close()
+	if err := replica.ReplicaOf(addr); err != nil {
+		t.Fatal(err)
+	}
+	if !replica.ReadOnly() {
+		t.Fatal("a replica is writable")
+	}
+	replica.SetReadOnly(true) // The setting is now the caller's...
+	replica.ReplicaOf("")
+	if !replica.ReadOnly() {
+		t.Error("stopping replication undid SetReadOnly(true)") // ...and outlasts replication.
+	}
+	replica.SetReadOnly(false)
+	if err := replica.Set("k", "v"); err != nil {
+		t.Errorf("Set after SetReadOnly(false): %v", err)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"maps"
+	"slices"
+	"time"
+)
+
+// ErrBusyKey is returned by RestoreKey for a key that exists, unless told
+// to replace it; worded as Redis words it.
+var ErrBusyKey = errors.New("BUSYKEY Target key name already exists.")
+
+// errDumpCorrupt reports a payload RestoreKey cannot use.
+var errDumpCorrupt = errors.New("ERR DUMP payload version or checksum are wrong")
+
+// Dump serializes the value at key for RestoreKey, here or in another
+// process, or returns nil if the key is missing. The payload is the value
+// in the portable encoding of Archive, then the key's hash field TTLs,
+// written as a count and each field with its deadline in Unix nanoseconds,
+// then the archive version byte and a CRC-32C of everything before it. The
+// key's own TTL is not included, as in Redis; RestoreKey takes it
+// separately. Values Archive cannot encode return an *UnencodableError.
+func (db *DataBase) Dump(key string) ([]byte, error) {
+	db.lock.RLock()         // Acquire a read lock.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+	value, ok := db.lookup(key)
+	if !ok {
+		return nil, nil
+	}
+	b, err := appendArchiveValue(nil, value)
+	if err != nil {
+		return nil, &UnencodableError{Keys: []string{key}}
+	}
+	fields := db.fieldExpires[key]
+	b = binary.AppendUvarint(b, uint64(len(fields)))
+	for _, field := range slices.Sorted(maps.Keys(fields)) {
+		b = binary.AppendVarint(appendString(b, field), fields[field].UnixNano())
+	}
+	b = append(b, archiveVersion)
+	return binary.BigEndian.AppendUint32(b, crc32.Checksum(b, checksumTable)), nil
+}
+
+// RestoreKey stores at key the value serialized by Dump, with its hash
+// field TTLs, expiring after ttl if it is positive. A key that exists is
+// ErrBusyKey unless replace is set. The value must satisfy the prefix
+// policy of key and fit the memory budget, as for Set.
+func (db *DataBase) RestoreKey(key string, data []byte, ttl time.Duration, replace bool) error {
+	value, fields, err := parseDump(data)
+	if err != nil {
+		return err
+	}
+
+	db.lock.Lock()    // Acquire a write lock.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	if db.readOnly {
+		return ErrReadOnly
+	}
+	db.expireIfNeeded(key)
+	if !replace && db.data.has(key) {
+		return ErrBusyKey
+	}
+	if err := db.checkPolicy(key, value); err != nil {
+		return err
+	}
+	if err := db.checkOOM(key, value); err != nil {
+		return err
+	}
+	var deadline time.Time
+	if ttl > 0 {
+		deadline = db.clock.Now().Add(ttl)
+	}
+	db.place(key, value, true, deadline, ttl > 0, fields)
+	return nil
+}
+
+// parseDump checks and decodes a payload written by Dump.
+func parseDump(data []byte) (any, map[string]time.Time, error) {
+	if len(data) < 5 {
+		return nil, nil, errDumpCorrupt
+	}
+	body, sum := data[:len(data)-4], data[len(data)-4:]
+	if crc32.Checksum(body, checksumTable) != binary.BigEndian.Uint32(sum) {
+		return nil, nil, errDumpCorrupt
+	}
+	if v := body[len(body)-1]; v < 1 || v > archiveVersion {
+		return nil, nil, errDumpCorrupt
+	}
+	d := &archiveDecoder{b: body[:len(body)-1]}
+	value, err := d.value()
+	if err != nil {
+		return nil, nil, err
+	}
+	var fields map[string]time.Time
+	if n := d.count(); n > 0 {
+		fields = make(map[string]time.Time, n)
+		for range n {
+			field := d.string()
+			fields[field] = time.Unix(0, d.varint())
+		}
+	}
+	if d.err == nil && len(d.b) > 0 {
+		d.fail() // Trailing bytes.
+	}
+	return value, fields, d.err
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDumpRestoreKey(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1_000_000, 0))
+	src := NewDataBase(WithClock(clock))
+	defer src.Close()
+	src.SetWithTTL("hash", Hash{"kept": "a"}, time.Hour)
+	src.HSetEX("hash", "brief", "b", time.Second)
+	data, err := src.Dump("hash")
+	if err != nil || data == nil {
+		t.Fatalf("Dump = %v, %v", data, err)
+	}
+	if data, err := src.Dump("missing"); data != nil || err != nil {
+		t.Errorf("Dump of a missing key = %v, %v; want nil", data, err)
+	}
+
+	dst := NewDataBase(WithClock(clock))
+	defer dst.Close()
+	if err := dst.RestoreKey("copy", data, 0, false); err != nil {
+		t.Fatalf("RestoreKey: %v", err)
+	}
+	if ttl := dst.TTL("copy"); ttl >= 0 {
+		t.Errorf("TTL of a key restored with ttl 0 = %v, want none: Dump leaves the key's TTL out", ttl)
+	}
+	if err := dst.RestoreKey("copy", data, time.Minute, false); !errors.Is(err, ErrBusyKey) {
+		t.Errorf("RestoreKey onto an existing key: %v, want ErrBusyKey", err)
+	}
+	if err := dst.RestoreKey("copy", data, time.Minute, true); err != nil {
+		t.Fatalf("RestoreKey with replace: %v", err)
+	}
+	if ttl := dst.TTL("copy"); ttl != time.Minute {
+		t.Errorf("TTL of the restored key = %v, want a minute", ttl)
+	}
+	clock.Advance(2 * time.Second)
+	if got, _ := dst.HGetAll("copy"); !reflect.DeepEqual(got, map[string]any{"kept": "a"}) {
+		t.Errorf("restored hash after its field TTL = %v, want only kept", got)
+	}
+}
+
+func TestRestoreKeyRejectsCorruptPayloads(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	db.Set("k", List{"a", int64(2)})
+	data, err := db.Dump("k")
+	if err != nil {
+		t.Fatalf("Dump: %v", err)
+	}
+	// seal frames body as Dump does, so only the contents are wrong.
+	seal := func(body []byte, version byte) []byte {
+		b := append(append([]byte(nil), body...), version)
+		return binary.BigEndian.AppendUint32(b, crc32.Checksum(b, checksumTable))
+	}
+	body := data[:len(data)-5]
+	flipped := append([]byte(nil), data...)
+	flipped[0] ^= 0xff
+	for _, tc := range []struct {
+		name    string
+		payload []byte
+		want    error // Nil for any error.
+	}{
+		{"empty", nil, errDumpCorrupt},
+		{"too short", data[:3], errDumpCorrupt},
+		{"bad checksum", flipped, errDumpCorrupt},
+		{"future version", seal(body, archiveVersion+1), errDumpCorrupt},
+		{"cut short", seal(body[:len(body)-2], archiveVersion), nil},
+		{"trailing bytes", seal(append(append([]byte(nil), body...), 0), archiveVersion), nil},
+	} {
+		err := db.RestoreKey("restored", tc.payload, 0, false)
+		if err == nil || (tc.want != nil && !errors.Is(err, tc.want)) {
+			t.Errorf("RestoreKey of a payload %s: %v, want an error", tc.name, err)
+		}
+	}
+	if _, ok := db.Get("restored"); ok {
+		t.Error("a corrupt payload was restored")
+	}
+}
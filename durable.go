@@ -0,0 +1,38 @@
+package main
+
+import "errors"
+
+// ErrNoPersistence is returned by SetDurable when neither an append-only
+// file (EnableAOF) nor a snapshot file (SaveEvery or SaveRules) has been
+// configured, so there is nowhere durable to write to.
+var ErrNoPersistence = errors.New("durable writes need persistence enabled with EnableAOF or SaveEvery")
+
+// SetDurable stores value at key like Set and returns only once the write is
+// on stable storage, so the value survives a crash. With an append-only file
+// (see EnableAOF) it syncs the file after the write, which is cheap. Failing
+// that it saves a full snapshot to the SaveRules file, synced to disk, which
+// costs a whole snapshot per call, so reserve it for the writes that matter.
+// Without either it writes nothing and returns ErrNoPersistence. If the sync
+// or save fails, the value stays in memory and its error is returned; so is
+// the sticky error of an earlier failed append (see AOFError), since the
+// file may not hold the write.
+func (db *DataBase) SetDurable(key string, value any) error {
+	db.lock.RLock()
+	sched, logged := db.saveSchedule, db.aof != nil
+	db.lock.RUnlock()
+	if sched == nil && !logged {
+		return ErrNoPersistence
+	}
+	if err := db.Set(key, value); err != nil {
+		return err
+	}
+	if logged {
+		if synced, err := db.syncAOF(); synced {
+			return err // The write is in the file already; make it stick.
+		}
+		if sched == nil {
+			return ErrNoPersistence // The file was closed in the meantime.
+		}
+	}
+	return db.Persist(sched.fileName)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSetDurableSurvivesRestart(t *testing.T) {
+	db := NewDataBase()
+	if err := db.SetDurable("k", "v"); !errors.Is(err, ErrNoPersistence) {
+		t.Errorf("SetDurable with no persistence: %v, want ErrNoPersistence", err)
+	}
+	if _, ok := db.Get("k"); ok {
+		t.Error("SetDurable with no persistence wrote the key")
+	}
+	db.Close()
+
+	dir := t.TempDir()
+	aofName := filepath.Join(dir, "appendonly.aof")
+	logged := NewDataBase()
+	if err := logged.EnableAOF(aofName, FsyncEverySec); err != nil {
+		t.Fatalf("EnableAOF: %v", err)
+	}
+	if err := logged.SetDurable("order:1", "paid"); err != nil {
+		t.Fatalf("SetDurable with an AOF: %v", err)
+	}
+	// No Close: the restart replays what SetDurable made stick, not
+	// what a clean shutdown would flush.
+	replayed := NewDataBase()
+	defer replayed.Close()
+	if err := replayed.LoadAOF(aofName); err != nil {
+		t.Fatalf("LoadAOF: %v", err)
+	}
+	if value, ok := replayed.Get("order:1"); !ok || value != "paid" {
+		t.Errorf("after replaying the AOF: order:1 = %v, %v; want paid", value, ok)
+	}
+	logged.Close()
+
+	snapName := filepath.Join(dir, "dump.gob")
+	saved := NewDataBase()
+	saved.SaveEvery(1000, snapName) // Far off, so only SetDurable saves.
+	if err := saved.SetDurable("order:2", "shipped"); err != nil {
+		t.Fatalf("SetDurable with a snapshot: %v", err)
+	}
+	loaded := NewDataBase()
+	defer loaded.Close()
+	if err := loaded.Load(snapName); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if value, ok := loaded.Get("order:2"); !ok || value != "shipped" {
+		t.Errorf("after loading the snapshot: order:2 = %v, %v; want shipped", value, ok)
+	}
+	saved.Close()
+}
+
+func TestSetDurableReportsFailedAOF(t *testing.T) {
+	aofName := filepath.Join(t.TempDir(), "appendonly.aof")
+	db := NewDataBase()
+	defer db.Close()
+	if err := db.EnableAOF(aofName, FsyncEverySec); err != nil {
+		t.Fatalf("EnableAOF: %v", err)
+	}
+	if err := os.Mkdir(aofName+".rewrite", 0o755); err != nil { // Keeps the rewriter from clearing the error.
+		t.Fatal(err)
+	}
+	log := db.aof
+	log.mu.Lock()
+	writable := log.file
+	readOnly, err := os.Open(aofName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.file = readOnly
+	log.mu.Unlock()
+	defer func() {
+		log.mu.Lock()
+		log.file = writable
+		log.mu.Unlock()
+		readOnly.Close()
+	}()
+
+	if err := db.SetDurable("order:1", "paid"); err == nil || !errors.Is(err, db.AOFError()) {
+		t.Errorf("SetDurable with a failing AOF: %v, want the AOF error %v", err, db.AOFError())
+	}
+	log.mu.Lock()
+	log.file = writable // The file works again, but it missed order:1.
+	log.mu.Unlock()
+	if err := db.SetDurable("order:2", "paid"); err == nil {
+		t.Error("SetDurable succeeded while the AOF missed an earlier write")
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// EncodingThresholds are the size limits Encoding uses to pick a label. They
+// mirror the Redis configuration directives of the same purpose, and the
+// defaults are the Redis defaults.
+type EncodingThresholds struct {
+	EmbstrMaxLen     int // Longest string labelled "embstr"; longer is "raw". Default 44.
+	ListpackEntries  int // Most entries of a "listpack" list, hash, set or zset. Default 128.
+	ListpackValueLen int // Longest element of a "listpack" collection. Default 64.
+	IntsetEntries    int // Most members of an "intset" set. Default 512.
+}
+
+// defaultEncodingThresholds are the Redis defaults.
+var defaultEncodingThresholds = EncodingThresholds{
+	EmbstrMaxLen:     44,
+	ListpackEntries:  128,
+	ListpackValueLen: 64,
+	IntsetEntries:    512,
+}
+
+// WithEncodingThresholds replaces the limits used by Encoding. Zero fields
+// keep their defaults.
+func WithEncodingThresholds(t EncodingThresholds) Option {
+	return func(db *DataBase) {
+		d := defaultEncodingThresholds
+		db.encoding = EncodingThresholds{
+			EmbstrMaxLen:     orDefault(t.EmbstrMaxLen, d.EmbstrMaxLen),
+			ListpackEntries:  orDefault(t.ListpackEntries, d.ListpackEntries),
+			ListpackValueLen: orDefault(t.ListpackValueLen, d.ListpackValueLen),
+			IntsetEntries:    orDefault(t.IntsetEntries, d.IntsetEntries),
+		}
+	}
+}
+
+// orDefault returns v, or def if v is not positive.
+func orDefault(v, def int) int {
+	if v > 0 {
+		return v
+	}
+	return def
+}
+
+// Encoding reports the representation Redis would choose for the value at
+// key, as OBJECT ENCODING does. This store keeps every value as a plain Go
+// value, so the label is a heuristic on the value's type and size, meant to
+// show where a value sits relative to the compact encodings real Redis uses:
+//
+//   - strings: "int" if the text is a 64-bit integer, "embstr" up to
+//     EmbstrMaxLen bytes, "raw" beyond; integers are "int" and other scalars
+//     "embstr".
+//   - lists: "listpack" up to ListpackEntries elements of at most
+//     ListpackValueLen bytes each, "quicklist" beyond.
+//   - hashes: "listpack" within the same limits, "hashtable" beyond.
+//   - sets: "intset" if every member is an integer and there are at most
+//     IntsetEntries, "listpack" within the listpack limits, "hashtable" beyond.
+//   - sorted sets: "listpack" within the listpack limits, "skiplist" beyond.
+//
+// It reports false if the key does not exist. Limits are set with
+// WithEncodingThresholds.
+func (db *DataBase) Encoding(key string) (string, bool) {
+	db.lock.RLock()         // Acquire a read lock.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+
+	value, exists := db.lookup(key)
+	if !exists {
+		return "", false
+	}
+	t := db.encoding
+	switch v := value.(type) {
+	case string:
+		return stringEncoding(v, t), true
+	case []byte:
+		return stringEncoding(string(v), t), true
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return "int", true
+	case List:
+		small := len(v) <= t.ListpackEntries
+		for i := 0; small && i < len(v); i++ {
+			small = elementLen(v[i]) <= t.ListpackValueLen
+		}
+		return pick(small, "listpack", "quicklist"), true
+	case Hash:
+		small := len(v) <= t.ListpackEntries
+		for field, val := range v {
+			if !small {
+				break
+			}
+			small = len(field) <= t.ListpackValueLen && elementLen(val) <= t.ListpackValueLen
+		}
+		return pick(small, "listpack", "hashtable"), true
+	case Set:
+		ints, small := len(v) <= t.IntsetEntries, len(v) <= t.ListpackEntries
+		for m := range v {
+			if _, err := strconv.ParseInt(m, 10, 64); err != nil {
+				ints = false
+			}
+			small = small && len(m) <= t.ListpackValueLen
+		}
+		if ints {
+			return "intset", true
+		}
+		return pick(small, "listpack", "hashtable"), true
+	case *ZSet:
+		small := v.Len() <= t.ListpackEntries
+		for m := range v.all() {
+			if !small || len(m.Member) > t.ListpackValueLen {
+				small = false
+				break
+			}
+		}
+		return pick(small, "listpack", "skiplist"), true
+	case *Stream:
+		return "stream", true
+	case *HyperLogLog:
+		return "raw", true // Redis keeps counters as strings, and dense ones are raw.
+	}
+	return "embstr", true // Floats, bools and other scalars are stored as short strings.
+}
+
+// stringEncoding labels a string value.
+func stringEncoding(s string, t EncodingThresholds) string {
+	if len(s) <= 20 {
+		if _, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return "int"
+		}
+	}
+	return pick(len(s) <= t.EmbstrMaxLen, "embstr", "raw")
+}
+
+// elementLen is the length of a collection element in its text form.
+func elementLen(v any) int {
+	switch e := v.(type) {
+	case string:
+		return len(e)
+	case []byte:
+		return len(e)
+	}
+	return len(fmt.Sprint(v))
+}
+
+// pick returns a if cond holds, else b.
+func pick(cond bool, a, b string) string {
+	if cond {
+		return a
+	}
+	return b
+}
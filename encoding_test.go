@@ -0,0 +1,77 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestEncodingTransitions(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	check := func(key, want string) {
+		t.Helper()
+		if got, ok := db.Encoding(key); !ok || got != want {
+			t.Errorf("Encoding(%s) = %q, %v; want %q", key, got, ok, want)
+		}
+	}
+
+	db.Set("s", "12345")
+	check("s", "int")
+	db.Set("s", strings.Repeat("x", 44))
+	check("s", "embstr")
+	db.Set("s", strings.Repeat("x", 45))
+	check("s", "raw")
+	db.Set("s", int64(7))
+	check("s", "int")
+
+	for i := range 128 {
+		db.RPush("list", i)
+		db.HSet("hash", "f"+strconv.Itoa(i), i)
+		db.ZAdd("zset", ZMember{"m" + strconv.Itoa(i), float64(i)})
+	}
+	check("list", "listpack")
+	check("hash", "listpack")
+	check("zset", "listpack")
+	db.RPush("list", 128) // One entry past the limit.
+	db.HSet("hash", "f128", 128)
+	db.ZAdd("zset", ZMember{"m128", 128})
+	check("list", "quicklist")
+	check("hash", "hashtable")
+	check("zset", "skiplist")
+
+	db.RPush("wide", strings.Repeat("x", 64))
+	check("wide", "listpack")
+	db.RPush("wide", strings.Repeat("x", 65)) // One element too long.
+	check("wide", "quicklist")
+
+	for i := range 512 {
+		db.SAdd("ints", i)
+	}
+	check("ints", "intset")
+	db.SAdd("ints", 512)
+	check("ints", "hashtable")
+	db.SAdd("names", "ada")
+	check("names", "listpack")
+
+	if _, ok := db.Encoding("missing"); ok {
+		t.Error("Encoding of a missing key reported ok")
+	}
+}
+
+func TestEncodingThresholds(t *testing.T) {
+	db := NewDataBase(WithEncodingThresholds(EncodingThresholds{EmbstrMaxLen: 4, ListpackEntries: 2}))
+	defer db.Close()
+	db.Set("s", "abcde")
+	if got, _ := db.Encoding("s"); got != "raw" {
+		t.Errorf("Encoding of 5 bytes with EmbstrMaxLen 4 = %q, want raw", got)
+	}
+	db.RPush("list", 1, 2, 3)
+	if got, _ := db.Encoding("list"); got != "quicklist" {
+		t.Errorf("Encoding of 3 elements with ListpackEntries 2 = %q, want quicklist", got)
+	}
+	db.SAdd("set", 1, 2, 3) // IntsetEntries kept its default.
+	if got, _ := db.Encoding("set"); got != "intset" {
+		t.Errorf("Encoding of 3 integers = %q, want intset", got)
+	}
+}
@@ -0,0 +1,585 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNoScript is returned by EvalSHA for a script that is not cached.
+var ErrNoScript = errors.New("NOSCRIPT No matching script. Please use EVAL.")
+
+// EvalScript runs script, written in the Lua subset described below,
+// atomically like Eval: no other reader or writer sees the keyspace between
+// its commands. keys and args are the script's KEYS and ARGV tables; args
+// are converted to strings as Redis clients do. The script's return value
+// is converted as Redis converts it for the reply: numbers to int64
+// (truncated), strings to strings, true to int64 1, false and nil to nil,
+// tables to []any of their sequence, a table {ok = "..."} to its status
+// string and a table {err = "..."} to an error. The script is compiled once
+// and cached under its SHA1 hex digest for EvalSHA.
+//
+// Scripts run commands with redis.call(name, arg, ...), which stops the
+// script on an error reply, or redis.pcall, which returns {err = "..."}
+// instead. The commands available are the string, counter and expiry
+// commands: GET, SET (with EX, PX, NX and XX), SETNX, GETSET, DEL, EXISTS,
+// INCR, DECR, INCRBY, DECRBY, EXPIRE, PEXPIRE, TTL, PTTL and PERSIST.
+//
+// The language is Lua 5.1 without varargs, method calls, metatables and
+// string patterns, and its functions, closures included, return only
+// their first value. The libraries are tonumber, tostring, type, error,
+// pairs, ipairs, string.len, string.sub, string.upper, string.lower,
+// string.rep, string.format, table.insert, table.remove, table.concat,
+// table.getn, math.floor, math.ceil, math.abs, math.sqrt, math.min,
+// math.max, redis.call, redis.pcall, redis.status_reply and
+// redis.error_reply. As in Redis, scripts may not
+// create global variables, and there is no rollback: the writes a script
+// made before failing stay.
+func (db *DataBase) EvalScript(script string, keys []string, args []any) (any, error) {
+	chunk, err := compileLua(script)
+	if err != nil {
+		return nil, err
+	}
+	sha := scriptSHA(script)
+	return db.evalChunk(keys, args, func() *luaChunk {
+		db.cacheScript(sha, chunk)
+		return chunk
+	})
+}
+
+// EvalSHA runs a script cached by EvalScript or ScriptLoad, named by the
+// SHA1 hex digest of its text, or returns ErrNoScript.
+func (db *DataBase) EvalSHA(sha1 string, keys []string, args []any) (any, error) {
+	return db.evalChunk(keys, args, func() *luaChunk {
+		return db.luaScripts[strings.ToLower(sha1)]
+	})
+}
+
+// ScriptLoad compiles script and caches it for EvalSHA without running it,
+// returning its SHA1 hex digest.
+func (db *DataBase) ScriptLoad(script string) (string, error) {
+	chunk, err := compileLua(script)
+	if err != nil {
+		return "", err
+	}
+	sha := scriptSHA(script)
+	db.lock.Lock()         // Acquire a write lock.
+	defer db.lock.Unlock() // Release the lock when the function exits.
+	db.cacheScript(sha, chunk)
+	return sha, nil
+}
+
+// ScriptExists reports, for each SHA1 digest, whether its script is cached.
+func (db *DataBase) ScriptExists(sha1s ...string) []bool {
+	db.lock.RLock()         // Acquire a read lock.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+	exists := make([]bool, len(sha1s))
+	for i, sha := range sha1s {
+		_, exists[i] = db.luaScripts[strings.ToLower(sha)]
+	}
+	return exists
+}
+
+// ScriptFlush empties the script cache.
+func (db *DataBase) ScriptFlush() {
+	db.lock.Lock()         // Acquire a write lock.
+	defer db.lock.Unlock() // Release the lock when the function exits.
+	db.luaScripts = nil
+}
+
+// scriptSHA returns the SHA1 hex digest naming a script.
+func scriptSHA(script string) string {
+	sum := sha1.Sum([]byte(script))
+	return hex.EncodeToString(sum[:])
+}
+
+// cacheScript stores a compiled script. The caller must hold the write lock.
+func (db *DataBase) cacheScript(sha string, chunk *luaChunk) {
+	if db.luaScripts == nil {
+		db.luaScripts = make(map[string]*luaChunk)
+	}
+	db.luaScripts[sha] = chunk
+}
+
+// evalChunk runs the script that find returns, under the write lock, and
+// converts its result for the Go API.
+func (db *DataBase) evalChunk(keys []string, args []any, find func() *luaChunk) (any, error) {
+	argv := make([]string, len(args))
+	for i, arg := range args {
+		argv[i] = scriptArg(arg)
+	}
+	reply, err := db.runScript(nil, keys, argv, find) // The Go API may run every command.
+	if err != nil {
+		return nil, err
+	}
+	if err, ok := reply.(error); ok {
+		return nil, err
+	}
+	return plainReply(reply), nil
+}
+
+// runScript runs the script that find returns, called under the write
+// lock so that EVALSHA cannot race SCRIPT FLUSH, and returns its result as
+// a RESP reply. Each command the script calls is first passed to acl, the
+// ACL check of the client running the script, unless acl is nil.
+func (db *DataBase) runScript(acl aclCheck, keys, args []string, find func() *luaChunk) (any, error) {
+	return db.Eval(func(tx *Txn) (any, error) {
+		chunk := find()
+		if chunk == nil {
+			return nil, ErrNoScript
+		}
+		in := newLuaInterp(keys, args, func(args []string) any { return scriptCommand(tx, acl, args) })
+		result, err := in.run(chunk)
+		if err != nil {
+			return nil, err
+		}
+		return luaReply(result), nil
+	})
+}
+
+// scriptArg renders an EvalScript argument as a string.
+func scriptArg(arg any) string {
+	switch v := arg.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	}
+	return fmt.Sprint(arg) // Integers and other scalars in their text form.
+}
+
+// luaRedisLib is the redis library of scripts.
+var luaRedisLib = map[string]luaBuiltin{
+	"call": func(in *luaInterp, args []any) (any, error) {
+		reply, err := luaCommand(in, "call", args)
+		if err != nil {
+			return nil, err
+		}
+		if err, ok := reply.(error); ok {
+			return nil, err // The script stops with the command's error.
+		}
+		return replyToLua(reply), nil
+	},
+	"pcall": func(in *luaInterp, args []any) (any, error) {
+		reply, err := luaCommand(in, "pcall", args)
+		if err != nil {
+			return nil, err
+		}
+		return replyToLua(reply), nil
+	},
+	"status_reply": func(in *luaInterp, args []any) (any, error) {
+		s, err := in.stringArg("status_reply", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return &luaTable{hash: map[any]any{"ok": s}}, nil
+	},
+	"error_reply": func(in *luaInterp, args []any) (any, error) {
+		s, err := in.stringArg("error_reply", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return &luaTable{hash: map[any]any{"err": s}}, nil
+	},
+}
+
+// luaCommand converts the arguments of redis.call or redis.pcall and runs
+// the command.
+func luaCommand(in *luaInterp, fn string, args []any) (any, error) {
+	if len(args) == 0 {
+		return nil, in.errorf("Please specify at least one argument for redis.%s()", fn)
+	}
+	strs := make([]string, len(args))
+	for i, arg := range args {
+		s, ok := luaToString(arg)
+		if !ok {
+			return nil, in.errorf("Lua redis lib command arguments must be strings or integers")
+		}
+		strs[i] = s
+	}
+	return in.call(strs), nil
+}
+
+// scriptCommands are the commands scripts can run, through the Txn of
+// their Eval. args excludes the command name.
+var scriptCommands = map[string]struct {
+	minArgs, maxArgs int
+	run              func(tx *Txn, args []string) any
+}{
+	"GET":     {1, 1, scriptGet},
+	"SET":     {2, -1, scriptSet},
+	"SETNX":   {2, 2, scriptSetNX},
+	"GETSET":  {2, 2, scriptGetSet},
+	"DEL":     {1, -1, scriptDel},
+	"EXISTS":  {1, -1, scriptExists},
+	"INCR":    {1, 1, func(tx *Txn, args []string) any { return counterReply(tx.IncrBy(args[0], 1)) }},
+	"DECR":    {1, 1, func(tx *Txn, args []string) any { return counterReply(tx.IncrBy(args[0], -1)) }},
+	"INCRBY":  {2, 2, scriptIncrBy(1)},
+	"DECRBY":  {2, 2, scriptIncrBy(-1)},
+	"EXPIRE":  {2, 2, scriptExpire(time.Second)},
+	"PEXPIRE": {2, 2, scriptExpire(time.Millisecond)},
+	"TTL":     {1, 1, scriptTTL(time.Second)},
+	"PTTL":    {1, 1, scriptTTL(time.Millisecond)},
+	"PERSIST": {1, 1, scriptPersist},
+}
+
+// aclCheck is the ACL check of a script's client, aclUser.check, passed
+// as a func so the dispatch table does not refer to itself through it.
+type aclCheck func(name string, args []string) error
+
+// scriptCommand runs one command of a script, replying with acl's NOPERM
+// error if the client may not run it on its keys.
+func scriptCommand(tx *Txn, acl aclCheck, args []string) any {
+	name := strings.ToUpper(args[0])
+	cmd, ok := scriptCommands[name]
+	if !ok {
+		return fmt.Errorf("This Redis command is not allowed from script") // Or not a command at all.
+	}
+	params := args[1:]
+	if len(params) < cmd.minArgs || (cmd.maxArgs >= 0 && len(params) > cmd.maxArgs) {
+		return fmt.Errorf("Wrong number of args calling Redis command from script")
+	}
+	if acl != nil {
+		if err := acl(name, params); err != nil {
+			return err // redis.call raises it; redis.pcall returns it as an error table.
+		}
+	}
+	return cmd.run(tx, params)
+}
+
+// scriptGet implements GET for scripts.
+func scriptGet(tx *Txn, args []string) any {
+	value, ok := tx.Get(args[0])
+	if !ok {
+		return nil
+	}
+	return stringReply(value)
+}
+
+// scriptSet implements SET key value [EX seconds | PX milliseconds]
+// [NX | XX] for scripts, replying nil when NX or XX stops the write.
+func scriptSet(tx *Txn, args []string) any {
+	var ttl time.Duration
+	var nx, xx bool
+	for i := 2; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i]); opt {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "EX", "PX":
+			if i+1 == len(args) || ttl != 0 {
+				return errSyntax
+			}
+			i++
+			n, ok := parseInt(args[i])
+			if !ok || n <= 0 {
+				return fmt.Errorf("invalid expire time in 'set' command")
+			}
+			unit := time.Second
+			if opt == "PX" {
+				unit = time.Millisecond
+			}
+			ttl = time.Duration(n) * unit
+		default:
+			return errSyntax
+		}
+	}
+	if nx && xx {
+		return errSyntax
+	}
+	if _, exists := tx.Get(args[0]); nx && exists || xx && !exists {
+		return nil
+	}
+	if err := tx.Set(args[0], args[1]); err != nil {
+		return err
+	}
+	if ttl > 0 {
+		tx.Expire(args[0], ttl)
+	}
+	return simpleString("OK")
+}
+
+// scriptSetNX implements SETNX for scripts.
+func scriptSetNX(tx *Txn, args []string) any {
+	if _, exists := tx.Get(args[0]); exists {
+		return 0
+	}
+	if err := tx.Set(args[0], args[1]); err != nil {
+		return err
+	}
+	return 1
+}
+
+// scriptGetSet implements GETSET for scripts.
+func scriptGetSet(tx *Txn, args []string) any {
+	old, existed := tx.Get(args[0])
+	reply := any(nil)
+	if existed {
+		if reply = stringReply(old); reply == ErrWrongType {
+			return reply
+		}
+	}
+	if err := tx.Set(args[0], args[1]); err != nil {
+		return err
+	}
+	return reply
+}
+
+// scriptDel implements DEL for scripts.
+func scriptDel(tx *Txn, args []string) any {
+	deleted := 0
+	for _, key := range args {
+		if tx.Delete(key) {
+			deleted++
+		}
+	}
+	return deleted
+}
+
+// scriptExists implements EXISTS for scripts.
+func scriptExists(tx *Txn, args []string) any {
+	n := 0
+	for _, key := range args {
+		if _, ok := tx.Get(key); ok {
+			n++
+		}
+	}
+	return n
+}
+
+// scriptIncrBy returns INCRBY, or DECRBY for a sign of -1, for scripts.
+func scriptIncrBy(sign int64) func(tx *Txn, args []string) any {
+	return func(tx *Txn, args []string) any {
+		delta, ok := parseInt(args[1])
+		if !ok {
+			return ErrNotInteger
+		}
+		return counterReply(tx.IncrBy(args[0], sign*delta))
+	}
+}
+
+// scriptExpire returns EXPIRE, counting in unit, for scripts.
+func scriptExpire(unit time.Duration) func(tx *Txn, args []string) any {
+	return func(tx *Txn, args []string) any {
+		n, ok := parseInt(args[1])
+		if !ok {
+			return ErrNotInteger
+		}
+		if tx.Expire(args[0], time.Duration(n)*unit) {
+			return 1
+		}
+		return 0
+	}
+}
+
+// scriptTTL returns TTL, counting in unit, for scripts.
+func scriptTTL(unit time.Duration) func(tx *Txn, args []string) any {
+	return func(tx *Txn, args []string) any {
+		ttl := tx.TTL(args[0])
+		if ttl == TTLMissing || ttl == TTLPersistent {
+			return int64(ttl) // The sentinels are -2 and -1 in every unit.
+		}
+		return int64((ttl + unit - 1) / unit) // Round up, as Redis does.
+	}
+}
+
+// scriptPersist implements PERSIST for scripts.
+func scriptPersist(tx *Txn, args []string) any {
+	if tx.db.readOnly {
+		return ErrReadOnly
+	}
+	if tx.TTL(args[0]) < 0 {
+		return 0 // Missing, or already persistent.
+	}
+	tx.db.expires.del(args[0])
+	tx.db.touch(args[0])
+	return 1
+}
+
+// replyToLua converts a command reply to a Lua value, as Redis does for
+// redis.call: integers to numbers, bulk strings to strings, nulls to
+// false, arrays to tables, and status and error replies to tables with an
+// ok or err field.
+func replyToLua(reply any) any {
+	switch v := reply.(type) {
+	case nil:
+		return false
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case bool:
+		if v {
+			return 1.0
+		}
+		return 0.0
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case simpleString:
+		return &luaTable{hash: map[any]any{"ok": string(v)}}
+	case error:
+		return &luaTable{hash: map[any]any{"err": errorReply(v)}}
+	case []any:
+		values := make([]any, len(v))
+		for i, item := range v {
+			values[i] = replyToLua(item)
+		}
+		return newLuaArray(values)
+	}
+	return fmt.Sprint(reply)
+}
+
+// luaReply converts a script's result to a RESP reply, as Redis does:
+// numbers to integers, truncated, strings to bulk strings, true to 1,
+// false and nil to null, tables with an err or ok field to error or
+// status replies and other tables to arrays of their sequence.
+func luaReply(v any) any {
+	switch v := v.(type) {
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return int64(math.MinInt64) // What Lua's number to integer cast gives.
+		}
+		return int64(v)
+	case string:
+		return v
+	case bool:
+		if v {
+			return int64(1)
+		}
+		return nil
+	case *luaTable:
+		if msg, ok := v.get("err").(string); ok {
+			return errors.New(msg)
+		}
+		if status, ok := v.get("ok").(string); ok {
+			return simpleString(status)
+		}
+		items := make([]any, len(v.array))
+		for i, item := range v.array {
+			items[i] = luaReply(item)
+		}
+		return items
+	}
+	return nil // nil, and functions, which have no reply.
+}
+
+// plainReply converts a script's RESP reply for the Go API, with status
+// replies as plain strings.
+func plainReply(reply any) any {
+	switch v := reply.(type) {
+	case simpleString:
+		return string(v)
+	case []any:
+		for i, item := range v {
+			v[i] = plainReply(item)
+		}
+	}
+	return reply
+}
+
+// cmdEval runs EVAL script numkeys [key ...] [arg ...] as the default
+// user; the server binds it to the client's user with scriptingAs.
+func cmdEval(db *DataBase, args []string) any {
+	return evalAs(db, nil, args)
+}
+
+// cmdEvalSHA runs EVALSHA sha1 numkeys [key ...] [arg ...] as the default
+// user, like cmdEval.
+func cmdEvalSHA(db *DataBase, args []string) any {
+	return evalSHAAs(db, nil, args)
+}
+
+// scriptingAs returns cmd, named name, bound to user if it runs a script,
+// so that the commands the script calls are checked against user's ACL
+// rather than run as the default user.
+func scriptingAs(name string, cmd command, user *aclUser) command {
+	if user == nil {
+		return cmd // The default user may run everything.
+	}
+	switch name {
+	case "EVAL":
+		cmd.run = func(db *DataBase, args []string) any { return evalAs(db, user.check, args) }
+	case "EVALSHA":
+		cmd.run = func(db *DataBase, args []string) any { return evalSHAAs(db, user.check, args) }
+	}
+	return cmd
+}
+
+// evalAs runs EVAL, passing the script's commands to acl.
+func evalAs(db *DataBase, acl aclCheck, args []string) any {
+	chunk, err := compileLua(args[0])
+	if err != nil {
+		return err
+	}
+	sha := scriptSHA(args[0])
+	return evalCommand(db, acl, args[1:], func() *luaChunk {
+		db.cacheScript(sha, chunk)
+		return chunk
+	})
+}
+
+// evalSHAAs runs EVALSHA, passing the script's commands to acl.
+func evalSHAAs(db *DataBase, acl aclCheck, args []string) any {
+	sha := strings.ToLower(args[0])
+	return evalCommand(db, acl, args[1:], func() *luaChunk { return db.luaScripts[sha] })
+}
+
+// evalCommand splits numkeys [key ...] [arg ...] and runs the script find
+// returns, passing its commands to acl.
+func evalCommand(db *DataBase, acl aclCheck, args []string, find func() *luaChunk) any {
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 0 {
+		return fmt.Errorf("Number of keys can't be negative")
+	}
+	if n > len(args)-1 {
+		return fmt.Errorf("Number of keys can't be greater than number of args")
+	}
+	reply, err := db.runScript(acl, args[1:1+n], args[1+n:], find)
+	if err != nil {
+		return err
+	}
+	return reply
+}
+
+// cmdScript runs SCRIPT LOAD, EXISTS and FLUSH.
+func cmdScript(db *DataBase, args []string) any {
+	switch strings.ToUpper(args[0]) {
+	case "LOAD":
+		if len(args) != 2 {
+			return fmt.Errorf("wrong number of arguments for 'script|load' command")
+		}
+		sha, err := db.ScriptLoad(args[1])
+		if err != nil {
+			return err
+		}
+		return sha
+	case "EXISTS":
+		if len(args) < 2 {
+			return fmt.Errorf("wrong number of arguments for 'script|exists' command")
+		}
+		reply := make([]any, len(args)-1)
+		for i, exists := range db.ScriptExists(args[1:]...) {
+			reply[i] = exists
+		}
+		return reply
+	case "FLUSH":
+		if len(args) > 2 || len(args) == 2 && !strings.EqualFold(args[1], "SYNC") && !strings.EqualFold(args[1], "ASYNC") {
+			return errSyntax
+		}
+		db.ScriptFlush()
+		return simpleString("OK")
+	}
+	return fmt.Errorf("unknown subcommand '%s'. Try SCRIPT LOAD, SCRIPT EXISTS or SCRIPT FLUSH.", args[0])
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestServerEval(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	c := dial(t, startServer(t, db, ServerConfig{}))
+
+	script := "redis.call('SET', KEYS[1], ARGV[1]) return redis.call('INCRBY', KEYS[1], ARGV[2])"
+	if reply := c.do(t, "EVAL", script, "1", "n", "40", "2"); reply != int64(42) {
+		t.Errorf("EVAL SET and INCRBY = %v, want 42", reply)
+	}
+	for _, tc := range []struct {
+		script string
+		want   any
+	}{
+		{"return {1, 'two', {3}}", []any{int64(1), "two", []any{int64(3)}}},
+		{"return 3.99", int64(3)}, // Numbers truncate to integers.
+		{"return true", int64(1)},
+		{"return false", nil},
+		{"return redis.status_reply('FINE')", "FINE"},
+		{"return redis.call('GET', 'missing')", nil},
+		{"return type(redis.call('GET', 'missing'))", "boolean"}, // A null reply is false in Lua.
+		{"return redis.pcall('INCR', 'n')", int64(43)},
+	} {
+		if reply := c.do(t, "EVAL", tc.script, "0"); !reflect.DeepEqual(reply, tc.want) {
+			t.Errorf("EVAL %q = %#v, want %#v", tc.script, reply, tc.want)
+		}
+	}
+	db.Set("word", "abc")
+	if reply, ok := c.do(t, "EVAL", "return redis.call('INCR', KEYS[1])", "1", "word").(error); !ok || !strings.Contains(reply.Error(), "not an integer") {
+		t.Errorf("redis.call of a failing INCR = %v, want its error", reply)
+	}
+	if reply := c.do(t, "EVAL", "return redis.pcall('INCR', KEYS[1])['err']", "1", "word"); reply == nil {
+		t.Error("redis.pcall of a failing INCR returned no error table")
+	}
+	if reply, ok := c.do(t, "EVAL", "return redis.call('FLUSHALL')", "0").(error); !ok || !strings.Contains(reply.Error(), "not allowed from script") {
+		t.Errorf("EVAL of an unsupported command = %v, want an error", reply)
+	}
+	if reply, ok := c.do(t, "EVAL", "return 1", "2", "only-one").(error); !ok || !strings.Contains(reply.Error(), "greater than number of args") {
+		t.Errorf("EVAL with numkeys past the args = %v, want an error", reply)
+	}
+	if reply, ok := c.do(t, "EVAL", "return (", "0").(error); !ok || !strings.HasPrefix(reply.Error(), "ERR Error compiling script") {
+		t.Errorf("EVAL of a bad script = %v, want a compile error", reply)
+	}
+}
+
+func TestServerScriptCache(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	c := dial(t, startServer(t, db, ServerConfig{}))
+	script := "return ARGV[1] .. KEYS[1]"
+	sha := scriptSHA(script)
+
+	if reply, ok := c.do(t, "EVALSHA", sha, "1", "k", "v").(error); !ok || reply.Error() != ErrNoScript.Error() {
+		t.Errorf("EVALSHA before loading = %v, want NOSCRIPT", reply)
+	}
+	if reply := c.do(t, "SCRIPT", "LOAD", script); reply != sha {
+		t.Fatalf("SCRIPT LOAD = %v, want the SHA1 %s", reply, sha)
+	}
+	if reply := c.do(t, "EVALSHA", strings.ToUpper(sha), "1", "k", "v"); reply != "vk" {
+		t.Errorf("EVALSHA = %v, want vk", reply)
+	}
+	if reply := c.do(t, "SCRIPT", "EXISTS", sha, "ffff"); !reflect.DeepEqual(reply, []any{int64(1), int64(0)}) {
+		t.Errorf("SCRIPT EXISTS = %v, want [1 0]", reply)
+	}
+	if reply := c.do(t, "SCRIPT", "FLUSH"); reply != "OK" {
+		t.Errorf("SCRIPT FLUSH = %v, want OK", reply)
+	}
+	if reply := c.do(t, "SCRIPT", "EXISTS", sha); !reflect.DeepEqual(reply, []any{int64(0)}) {
+		t.Errorf("SCRIPT EXISTS after FLUSH = %v, want [0]", reply)
+	}
+	if reply := c.do(t, "EVAL", script, "1", "k", "v"); reply != "vk" {
+		t.Errorf("EVAL = %v, want vk", reply)
+	}
+	if reply := c.do(t, "EVALSHA", sha, "1", "x", "y"); reply != "yx" {
+		t.Errorf("EVALSHA after EVAL = %v, want yx: EVAL caches its script", reply)
+	}
+	if _, ok := c.do(t, "SCRIPT", "LOAD", "return (").(error); !ok {
+		t.Error("SCRIPT LOAD of a bad script succeeded")
+	}
+}
+
+func TestEvalScriptAPI(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	got, err := db.EvalScript("redis.call('SET', KEYS[1], ARGV[1]) return redis.call('GET', KEYS[1])", []string{"k"}, []any{42})
+	if err != nil || got != "42" {
+		t.Errorf("EvalScript = %v, %v; want 42", got, err)
+	}
+	if _, err := db.EvalScript("error('boom')", nil, nil); err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("EvalScript of a failing script: %v, want boom", err)
+	}
+	if _, err := db.EvalSHA("0000", nil, nil); !errors.Is(err, ErrNoScript) {
+		t.Errorf("EvalSHA of an unknown script: %v, want ErrNoScript", err)
+	}
+}
+
+func TestServerEvalChecksACL(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	addr := startServer(t, db, ServerConfig{Users: []ACLUser{
+		{Name: "scripter", Password: "pw", Commands: []string{"@scripting"}, Keys: []string{"*"}},
+		{Name: "app", Password: "pw", Commands: []string{"@all"}, Keys: []string{"app:*"}},
+	}})
+	db.Set("k", "v")
+
+	scripter := dial(t, addr)
+	if reply := scripter.do(t, "AUTH", "scripter", "pw"); reply != "OK" {
+		t.Fatalf("AUTH = %v, want OK", reply)
+	}
+	for _, script := range []string{
+		"return redis.call('GET', KEYS[1])",
+		"return redis.call('SET', KEYS[1], 'changed')",
+	} {
+		if reply, ok := scripter.do(t, "EVAL", script, "1", "k").(error); !ok || !strings.HasPrefix(reply.Error(), "NOPERM") {
+			t.Errorf("EVAL %q = %v, want NOPERM: the script runs as its client's user", script, reply)
+		}
+	}
+	if value, _ := db.Get("k"); value != "v" {
+		t.Errorf("k = %v after a refused SET, want v", value)
+	}
+	pcall := "local reply = redis.pcall('SET', KEYS[1], 'changed') return reply['err']"
+	if reply, _ := scripter.do(t, "EVAL", pcall, "1", "k").(string); !strings.HasPrefix(reply, "NOPERM") {
+		t.Errorf("redis.pcall of a denied SET = %q, want a NOPERM error table", reply)
+	}
+	sha := scripter.do(t, "SCRIPT", "LOAD", "return redis.call('GET', KEYS[1])")
+	if reply, ok := scripter.do(t, "EVALSHA", sha.(string), "1", "k").(error); !ok || !strings.HasPrefix(reply.Error(), "NOPERM") {
+		t.Errorf("EVALSHA of a denied GET = %v, want NOPERM", reply)
+	}
+
+	app := dial(t, addr)
+	if reply := app.do(t, "AUTH", "app", "pw"); reply != "OK" {
+		t.Fatalf("AUTH = %v, want OK", reply)
+	}
+	if reply := app.do(t, "EVAL", "return redis.call('SET', KEYS[1], 'v')", "1", "app:1"); reply != "OK" {
+		t.Errorf("EVAL SET app:1 = %v, want OK", reply)
+	}
+	// The key is not declared, so only the script's own call can catch it.
+	if reply, ok := app.do(t, "EVAL", "return redis.call('SET', 'other', 'v')", "0").(error); !ok || reply.Error() != errNoPermKey.Error() {
+		t.Errorf("EVAL SET other = %v, want %v", reply, errNoPermKey)
+	}
+	if _, ok := db.Get("other"); ok {
+		t.Error("a script wrote a key its user may not access")
+	}
+
+	open := dial(t, startServer(t, db, ServerConfig{}))
+	if reply := open.do(t, "EVAL", "return redis.call('GET', KEYS[1])", "1", "k"); reply != "v" {
+		t.Errorf("EVAL GET as the default user = %v, want v", reply)
+	}
+}
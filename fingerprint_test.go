@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFingerprintOrderIndependent(t *testing.T) {
+	a, b := NewDataBase(), NewDataBase()
+	defer a.Close()
+	defer b.Close()
+	a.Set("x", "1")
+	a.Set("y", "2")
+	a.HSet("h", "f1", "v1")
+	a.HSet("h", "f2", "v2")
+	b.HSet("h", "f2", "v2")
+	b.Set("y", "2")
+	b.HSet("h", "f1", "v1")
+	b.Set("x", "1")
+	if a.Fingerprint() != b.Fingerprint() {
+		t.Fatal("equal data in a different insertion order gave different fingerprints")
+	}
+
+	b.Set("x", "changed")
+	if a.Fingerprint() == b.Fingerprint() {
+		t.Fatal("a changed value left the fingerprints equal")
+	}
+	b.Set("x", "1")
+	b.SetWithTTL("z", "3", 0)
+	if a.Fingerprint() == b.Fingerprint() {
+		t.Fatal("an extra key left the fingerprints equal")
+	}
+}
+
+func TestFingerprintIgnoresTTL(t *testing.T) {
+	a, b := NewDataBase(), NewDataBase()
+	defer a.Close()
+	defer b.Close()
+	a.Set("k", "v")
+	b.SetWithTTL("k", "v", time.Hour)
+	if a.Fingerprint() != b.Fingerprint() {
+		t.Fatal("a TTL changed the fingerprint")
+	}
+}
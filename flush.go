@@ -0,0 +1,98 @@
+package main
+
+import "slices"
+
+// FlushAll deletes every key, like Redis FLUSHALL, and returns how many live
+// keys were removed. Keys whose TTL had already elapsed are dropped too but
+// not counted, and no expiry callbacks run. FlushAllDryRun reports the same
+// count without deleting anything.
+func (db *DataBase) FlushAll() int {
+	db.lock.Lock()    // Acquire a write lock.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	if db.readOnly {
+		return 0
+	}
+	live := db.countLive()
+	keys := make([]string, 0, db.data.len())
+	for key := range db.data.all() {
+		keys = append(keys, key) // Collect first: removal must not race the iteration.
+	}
+	for _, key := range keys {
+		db.removeKey(key)
+	}
+	return live
+}
+
+// FlushAllDryRun returns how many keys FlushAll would delete right now,
+// leaving the store unchanged.
+func (db *DataBase) FlushAllDryRun() int {
+	db.lock.RLock()         // Acquire a read lock.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+	return db.countLive()
+}
+
+// countLive returns the number of unexpired keys. The caller must hold the
+// lock.
+func (db *DataBase) countLive() int {
+	now, n := db.clock.Now(), 0
+	for key := range db.data.all() {
+		if !db.isExpired(key, now) {
+			n++
+		}
+	}
+	return n
+}
+
+// DeletePattern deletes every key matching the glob pattern, with the syntax
+// of matchGlob as in Redis KEYS, under one write lock, and returns how many
+// live keys were removed. Keys whose TTL had already elapsed are not
+// counted. It deletes nothing while the database is read-only. Since a
+// broad pattern can wipe most of the store, DeletePatternDryRun shows what
+// would go first.
+func (db *DataBase) DeletePattern(pattern string) int {
+	db.lock.Lock()    // Acquire a write lock.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	if db.readOnly {
+		return 0
+	}
+	keys := db.matchingKeys(pattern) // Collect first: removal must not race the iteration.
+	for _, key := range keys {
+		db.removeKey(key)
+	}
+	return len(keys)
+}
+
+// Keys returns the live keys matching the glob pattern, sorted, like Redis
+// KEYS; "*" lists the whole keyspace. Like KEYS it walks every key under
+// one read lock, which holds off writers for the length of the walk on a
+// large store; Scan pages through the keys instead.
+func (db *DataBase) Keys(pattern string) []string {
+	db.lock.RLock()         // Acquire a read lock.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+	keys := db.matchingKeys(pattern)
+	slices.Sort(keys)
+	return keys
+}
+
+// DeletePatternDryRun returns the keys DeletePattern would delete right now,
+// sorted, leaving the store unchanged.
+func (db *DataBase) DeletePatternDryRun(pattern string) []string {
+	db.lock.RLock()         // Acquire a read lock.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+	keys := db.matchingKeys(pattern)
+	slices.Sort(keys)
+	return keys
+}
+
+// matchingKeys returns the unexpired keys matching pattern. The caller must
+// hold the lock.
+func (db *DataBase) matchingKeys(pattern string) []string {
+	now := db.clock.Now()
+	var keys []string
+	for key := range db.data.all() {
+		if matchGlob(pattern, key) && !db.isExpired(key, now) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
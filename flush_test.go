@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestDryRunsLeaveStoreUnchanged(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1_000_000, 0))
+	db := NewDataBase(WithClock(clock))
+	defer db.Close()
+	for _, key := range []string{"temp:1", "temp:2", "keep:1"} {
+		db.Set(key, 1)
+	}
+	db.SetWithTTL("temp:lapsed", 1, time.Second)
+	clock.Advance(time.Second)
+	before := db.Fingerprint()
+
+	if got, want := db.DeletePatternDryRun("temp:*"), []string{"temp:1", "temp:2"}; !slices.Equal(got, want) {
+		t.Errorf("DeletePatternDryRun(temp:*) = %q, want %q", got, want)
+	}
+	if got := db.DeletePatternDryRun("none:*"); len(got) != 0 {
+		t.Errorf("DeletePatternDryRun(none:*) = %q, want none", got)
+	}
+	if n := db.FlushAllDryRun(); n != 3 {
+		t.Errorf("FlushAllDryRun = %d, want the 3 live keys", n)
+	}
+	if db.Fingerprint() != before || db.Exists("temp:1", "temp:2", "keep:1") != 3 {
+		t.Fatal("a dry run changed the store")
+	}
+
+	preview := db.DeletePatternDryRun("temp:*")
+	if n := db.DeletePattern("temp:*"); n != len(preview) {
+		t.Errorf("DeletePattern = %d, want the %d keys the dry run listed", n, len(preview))
+	}
+	count := db.FlushAllDryRun()
+	if n := db.FlushAll(); n != count {
+		t.Errorf("FlushAll = %d, want the dry run's %d", n, count)
+	}
+}
+
+func TestDeletePatternSessions(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1_000_000, 0))
+	db := NewDataBase(WithClock(clock))
+	defer db.Close()
+	for i := range 100 {
+		db.Set(fmt.Sprintf("session:%d", i), i)
+	}
+	db.RPush("session:queue", "a")
+	db.SetWithTTL("session:lapsed", 1, time.Second)
+	keep := []string{"config", "sessions", "user:1:session:2", "xsession:1"}
+	for _, key := range keep {
+		db.Set(key, 1)
+	}
+	clock.Advance(time.Second)
+
+	if n := db.DeletePattern("session:*"); n != 101 {
+		t.Errorf("DeletePattern(session:*) = %d, want the 101 live sessions", n)
+	}
+	if keys := db.Keys("*"); !slices.Equal(keys, keep) {
+		t.Errorf("keys left = %q, want %q", keys, keep)
+	}
+	if n := db.DeletePattern("session:*"); n != 0 {
+		t.Errorf("DeletePattern again = %d, want 0", n)
+	}
+
+	db.Set("session:new", 1)
+	db.SetReadOnly(true)
+	if n := db.DeletePattern("session:*"); n != 0 || db.Exists("session:new") != 1 {
+		t.Errorf("DeletePattern on a read-only store = %d, want nothing deleted", n)
+	}
+}
+
+func TestKeysDeleteFlushAll(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1_000_000, 0))
+	db := NewDataBase(WithClock(clock))
+	defer db.Close()
+	for _, key := range []string{"user:2", "user:1", "order:1", "user:10"} {
+		db.Set(key, "v")
+	}
+	db.SetWithTTL("user:gone", "v", time.Second)
+	clock.Advance(time.Second)
+
+	if got := db.Keys("user:?"); !slices.Equal(got, []string{"user:1", "user:2"}) {
+		t.Errorf("Keys(user:?) = %q, want user:1 and user:2, sorted", got)
+	}
+	if got := db.Keys("*"); !slices.Equal(got, []string{"order:1", "user:1", "user:10", "user:2"}) {
+		t.Errorf("Keys(*) = %q, want every live key, sorted", got)
+	}
+	if got := db.Keys("nothing:*"); len(got) != 0 {
+		t.Errorf("Keys(nothing:*) = %q, want none", got)
+	}
+	if db.Exists("user:1") != 1 || db.Exists("user:gone") != 0 {
+		t.Error("Exists disagrees with Keys")
+	}
+
+	if !db.Delete("user:1") || db.Delete("user:1") || db.Delete("user:gone") {
+		t.Error("Delete did not report exactly one deletion of a live key")
+	}
+	if n := db.FlushAll(); n != 3 {
+		t.Errorf("FlushAll = %d, want the 3 live keys", n)
+	}
+	if got := db.Keys("*"); len(got) != 0 {
+		t.Errorf("Keys after FlushAll = %q, want none", got)
+	}
+	if n := db.FlushAll(); n != 0 {
+		t.Errorf("FlushAll of an empty store = %d, want 0", n)
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"encoding/gob"
+	"sort"
+	"time"
+)
+
+// Hash is the value stored under a key holding a Redis-style hash.
+type Hash map[string]any
+
+func init() {
+	gob.Register(Hash{}) // Allow hashes to be persisted inside the any-typed map.
+}
+
+// hashAt returns the hash stored at key, or nil if the key is absent.
+// It returns ErrWrongType if the key holds a non-hash value.
+// The caller must hold the lock.
+func (db *DataBase) hashAt(key string) (Hash, error) {
+	value, exists := db.lookup(key)
+	if !exists {
+		return nil, nil // Absent keys behave like empty hashes.
+	}
+	hash, ok := value.(Hash)
+	if !ok {
+		return nil, ErrWrongType
+	}
+	return hash, nil
+}
+
+// fieldExpired reports whether a hash field has outlived its TTL.
+// The caller must hold the lock.
+func (db *DataBase) fieldExpired(key, field string, now time.Time) bool {
+	deadline, ok := db.fieldExpires[key][field]
+	return ok && !now.Before(deadline)
+}
+
+// HSet stores value in field of the hash at key, creating the hash if needed.
+// Any TTL previously set on the field is cleared. Returns true if the field is new.
+func (db *DataBase) HSet(key, field string, value any) (bool, error) {
+	db.lock.Lock()    // Acquire a write lock.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	return db.hset(key, field, value, 0)
+}
+
+// HSetEX stores value in field of the hash at key and makes that field alone
+// expire after ttl, independently of its sibling fields. Once expired the
+// field is treated as absent by reads and removed by the background sweeper;
+// a hash emptied this way is deleted. A non-positive ttl behaves like HSet.
+func (db *DataBase) HSetEX(key, field string, value any, ttl time.Duration) (bool, error) {
+	db.lock.Lock()    // Acquire a write lock.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	return db.hset(key, field, value, ttl)
+}
+
+// hset implements HSet and HSetEX. The caller must hold the write lock.
+func (db *DataBase) hset(key, field string, value any, ttl time.Duration) (bool, error) {
+	if db.readOnly {
+		return false, ErrReadOnly
+	}
+	db.expireIfNeeded(key)
+	if err := db.checkGrowth(); err != nil {
+		return false, err
+	}
+	hash, err := db.hashAt(key)
+	if err != nil {
+		return false, err
+	}
+	if hash == nil {
+		hash = make(Hash) // First field creates the hash.
+		db.data.set(key, hash)
+	}
+	db.cow(key) // Keep a running BGSave's view intact.
+	_, existed := hash[field]
+	isNew := !existed || db.fieldExpired(key, field, db.clock.Now()) // An expired field counts as new.
+	hash[field] = value
+
+	if ttl > 0 {
+		if db.fieldExpires[key] == nil {
+			db.fieldExpires[key] = make(map[string]time.Time)
+		}
+		db.fieldExpires[key][field] = db.clock.Now().Add(ttl) // Track this field's deadline.
+	} else {
+		db.clearFieldTTL(key, field) // A plain write makes the field persistent.
+	}
+	db.touch(key)
+	return isNew, nil
+}
+
+// clearFieldTTL forgets the deadline of a single hash field.
+// The caller must hold the write lock.
+func (db *DataBase) clearFieldTTL(key, field string) {
+	fields, ok := db.fieldExpires[key]
+	if !ok {
+		return
+	}
+	delete(fields, field)
+	if len(fields) == 0 {
+		delete(db.fieldExpires, key) // Drop the companion entry when empty.
+	}
+}
+
+// HDel removes fields from the hash at key, along with any TTLs on them,
+// and returns how many live fields were removed; fields that were absent or
+// already expired are not counted. Removing the last field deletes the key.
+func (db *DataBase) HDel(key string, fields ...string) (int, error) {
+	db.lock.Lock()    // Acquire a write lock.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	if db.readOnly {
+		return 0, ErrReadOnly
+	}
+	db.expireIfNeeded(key)
+
+	hash, err := db.hashAt(key)
+	if err != nil || hash == nil {
+		return 0, err
+	}
+	db.cow(key) // Keep a running BGSave's view intact.
+	now, removed, changed := db.clock.Now(), 0, false
+	for _, field := range fields {
+		if _, ok := hash[field]; !ok {
+			continue
+		}
+		if !db.fieldExpired(key, field, now) {
+			removed++
+		}
+		delete(hash, field)
+		db.clearFieldTTL(key, field)
+		changed = true
+	}
+	if len(hash) == 0 {
+		db.removeKey(key) // An emptied hash disappears, as in Redis.
+	} else if changed {
+		db.touch(key)
+	}
+	return removed, nil
+}
+
+// HLen returns the number of live fields in the hash at key, or 0 if the
+// key does not exist.
+func (db *DataBase) HLen(key string) (int, error) {
+	db.lock.RLock()         // Acquire a read lock.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+
+	hash, err := db.hashAt(key)
+	if err != nil {
+		return 0, err
+	}
+	now, n := db.clock.Now(), 0
+	for field := range hash {
+		if !db.fieldExpired(key, field, now) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// HGet returns the value of field in the hash at key.
+// Expired fields are reported as absent.
+func (db *DataBase) HGet(key, field string) (any, bool, error) {
+	db.lock.RLock()         // Acquire a read lock.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+
+	hash, err := db.hashAt(key)
+	if err != nil {
+		return nil, false, err
+	}
+	value, ok := hash[field]
+	if !ok || db.fieldExpired(key, field, db.clock.Now()) {
+		return nil, false, nil
+	}
+	return value, true, nil
+}
+
+// HExists reports whether field is present, and not expired, in the hash at
+// key.
+func (db *DataBase) HExists(key, field string) (bool, error) {
+	db.lock.RLock()         // Acquire a read lock.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+
+	hash, err := db.hashAt(key)
+	if err != nil {
+		return false, err
+	}
+	_, ok := hash[field]
+	return ok && !db.fieldExpired(key, field, db.clock.Now()), nil
+}
+
+// HGetAll returns a copy of all live fields in the hash at key.
+func (db *DataBase) HGetAll(key string) (map[string]any, error) {
+	db.lock.RLock()         // Acquire a read lock.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+
+	hash, err := db.hashAt(key)
+	if err != nil {
+		return nil, err
+	}
+	now := db.clock.Now()
+	out := make(map[string]any, len(hash))
+	for field, value := range hash {
+		if !db.fieldExpired(key, field, now) {
+			out[field] = value // Skip fields whose TTL has elapsed.
+		}
+	}
+	return out, nil
+}
+
+// HMGet returns the values of the given fields in the hash at key, in the
+// order requested, with nil for fields that are absent or expired. A missing
+// key yields all nils. Only the requested fields are read, under one read
+// lock, so wide hashes are not copied.
+func (db *DataBase) HMGet(key string, fields ...string) ([]any, error) {
+	db.lock.RLock()         // Acquire a read lock.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+
+	hash, err := db.hashAt(key)
+	if err != nil {
+		return nil, err
+	}
+	now := db.clock.Now()
+	out := make([]any, len(fields))
+	for i, field := range fields {
+		if value, ok := hash[field]; ok && !db.fieldExpired(key, field, now) {
+			out[i] = value
+		}
+	}
+	return out, nil
+}
+
+// HKeys returns the live field names of the hash at key in sorted order.
+// It reports false if the key does not exist or does not hold a hash.
+func (db *DataBase) HKeys(key string) ([]string, bool) {
+	db.lock.RLock()         // Acquire a read lock.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+	return db.liveFields(key)
+}
+
+// HVals returns the live field values of the hash at key, in the order of
+// the fields returned by HKeys. It reports false if the key does not exist
+// or does not hold a hash.
+func (db *DataBase) HVals(key string) ([]any, bool) {
+	db.lock.RLock()         // Acquire a read lock.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+
+	fields, ok := db.liveFields(key)
+	if !ok {
+		return nil, false
+	}
+	hash, _ := db.hashAt(key)
+	values := make([]any, len(fields))
+	for i, field := range fields {
+		values[i] = hash[field]
+	}
+	return values, true
+}
+
+// liveFields returns the sorted unexpired fields of the hash at key.
+// The caller must hold the lock.
+func (db *DataBase) liveFields(key string) ([]string, bool) {
+	hash, err := db.hashAt(key)
+	if err != nil || hash == nil {
+		return nil, false
+	}
+	now := db.clock.Now()
+	fields := make([]string, 0, len(hash))
+	for field := range hash {
+		if !db.fieldExpired(key, field, now) {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+	return fields, true
+}
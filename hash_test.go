@@ -0,0 +1,168 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestHSetEXFieldExpiresAlone(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1_000_000, 0))
+	db := NewDataBase(WithClock(clock))
+	defer db.Close()
+	db.HSet("user", "name", "ada")
+	db.HSetEX("user", "session", "tok", time.Minute)
+	db.HSetEX("user", "later", "x", time.Hour)
+
+	clock.Advance(time.Minute)
+	if _, ok, _ := db.HGet("user", "session"); ok {
+		t.Error("HGet returned the field past its TTL")
+	}
+	if ok, _ := db.HExists("user", "session"); ok {
+		t.Error("HExists reported the field past its TTL")
+	}
+	if n, _ := db.HLen("user"); n != 2 {
+		t.Errorf("HLen = %d, want its 2 live fields", n)
+	}
+	all, _ := db.HGetAll("user")
+	if len(all) != 2 || all["name"] != "ada" || all["later"] != "x" {
+		t.Errorf("HGetAll = %v, want name and later", all)
+	}
+
+	db.sweep() // Removes the field rather than hiding it.
+	db.lock.RLock()
+	_, tracked := db.fieldExpires["user"]["session"]
+	hash, _ := db.data.value("user").(Hash)
+	fields := len(hash)
+	db.lock.RUnlock()
+	if tracked {
+		t.Error("the sweeper kept the expired field's deadline")
+	}
+	if fields != 2 {
+		t.Errorf("hash holds %d fields after the sweep, want 2", fields)
+	}
+
+	db.HSet("user", "later", "y") // A plain write clears the field's TTL.
+	clock.Advance(2 * time.Hour)
+	if value, ok, _ := db.HGet("user", "later"); !ok || value != "y" {
+		t.Errorf("HGet(later) after HSet = %v, %v; want y", value, ok)
+	}
+}
+
+func TestHSetEXEmptiesHash(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1_000_000, 0))
+	db := NewDataBase(WithClock(clock))
+	defer db.Close()
+	db.HSetEX("h", "a", 1, time.Second)
+	db.HSetEX("h", "b", 2, 2*time.Second)
+	clock.Advance(2 * time.Second)
+	db.sweep()
+	if _, ok := db.Get("h"); ok {
+		t.Error("a hash whose fields all expired was kept")
+	}
+	db.lock.RLock()
+	_, tracked := db.fieldExpires["h"]
+	db.lock.RUnlock()
+	if tracked {
+		t.Error("the emptied hash kept its field deadlines")
+	}
+}
+
+func TestHMGet(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1_000_000, 0))
+	db := NewDataBase(WithClock(clock))
+	defer db.Close()
+	db.HSet("user", "name", "ada")
+	db.HSet("user", "lang", "go")
+	db.HSetEX("user", "session", "tok", time.Second)
+	clock.Advance(time.Second)
+
+	got, err := db.HMGet("user", "lang", "missing", "name", "session", "lang")
+	if want := []any{"go", nil, "ada", nil, "go"}; err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("HMGet = %v, %v; want %v", got, err, want)
+	}
+	if got, err := db.HMGet("nohash", "a", "b"); err != nil || !reflect.DeepEqual(got, []any{nil, nil}) {
+		t.Errorf("HMGet of a missing key = %v, %v; want [<nil> <nil>]", got, err)
+	}
+	if keys, ok := db.HKeys("user"); !ok || !slices.Equal(keys, []string{"lang", "name"}) {
+		t.Errorf("HKeys = %q, %v; want [lang name]", keys, ok)
+	}
+	if values, ok := db.HVals("user"); !ok || !reflect.DeepEqual(values, []any{"go", "ada"}) {
+		t.Errorf("HVals = %v, %v; want [go ada]", values, ok)
+	}
+	if _, ok := db.HKeys("nohash"); ok {
+		t.Error("HKeys of a missing key reported ok")
+	}
+
+	db.Set("str", "x")
+	if _, err := db.HMGet("str", "a"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("HMGet of a string: %v, want ErrWrongType", err)
+	}
+	if _, ok := db.HVals("str"); ok {
+		t.Error("HVals of a string reported ok")
+	}
+}
+
+func TestHExists(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	db.HSet("hash", "f", nil) // A nil value is still a field.
+	if ok, err := db.HExists("hash", "f"); err != nil || !ok {
+		t.Errorf("HExists(f) = %v, %v; want true", ok, err)
+	}
+	if ok, err := db.HExists("hash", "g"); err != nil || ok {
+		t.Errorf("HExists(g) = %v, %v; want false", ok, err)
+	}
+	if ok, err := db.HExists("missing", "f"); err != nil || ok {
+		t.Errorf("HExists of a missing key = %v, %v; want false", ok, err)
+	}
+	db.SAdd("set", "f")
+	if _, err := db.HExists("set", "f"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("HExists of a set: %v, want ErrWrongType", err)
+	}
+}
+
+func TestHDelHLen(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1_000_000, 0))
+	db := NewDataBase(WithClock(clock))
+	defer db.Close()
+	db.HSet("h", "a", 1)
+	db.HSet("h", "b", 2)
+	db.HSet("h", "c", 3)
+	db.HSetEX("h", "brief", 4, time.Second)
+	if n, err := db.HLen("h"); n != 4 || err != nil {
+		t.Errorf("HLen = %d, %v; want 4", n, err)
+	}
+	clock.Advance(time.Second)
+	if n, _ := db.HLen("h"); n != 3 {
+		t.Errorf("HLen after a field expired = %d, want 3", n)
+	}
+	if n, err := db.HDel("h", "a", "missing", "a", "brief"); n != 1 || err != nil {
+		t.Errorf("HDel = %d, %v; want only the live field a counted", n, err)
+	}
+	if got, _ := db.HGetAll("h"); !reflect.DeepEqual(got, map[string]any{"b": 2, "c": 3}) {
+		t.Errorf("hash after HDel = %v, want b and c", got)
+	}
+	if n, _ := db.HDel("h", "b", "c"); n != 2 {
+		t.Errorf("HDel of the rest = %d, want 2", n)
+	}
+	if _, ok := db.Get("h"); ok {
+		t.Error("the emptied hash survived HDel")
+	}
+	if n, err := db.HLen("h"); n != 0 || err != nil {
+		t.Errorf("HLen of a missing key = %d, %v; want 0", n, err)
+	}
+	if n, err := db.HDel("h", "a"); n != 0 || err != nil {
+		t.Errorf("HDel on a missing key = %d, %v; want 0", n, err)
+	}
+
+	db.Set("str", "v")
+	if _, err := db.HDel("str", "f"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("HDel on a string: %v, want ErrWrongType", err)
+	}
+	if _, err := db.HLen("str"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("HLen of a string: %v, want ErrWrongType", err)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"container/list"
+	"time"
+)
+
+// Change is one write to a key, as recorded by WithHistory.
+type Change struct {
+	Time    time.Time // When the write happened, by the database clock.
+	Version uint64    // The key's version after the write; 0 for a removal.
+	Value   any       // A copy of the value after the write; nil for a removal.
+	Deleted bool      // The key was removed: deleted, expired or evicted.
+}
+
+// historyTracker keeps the recent changes of the most recently changed keys.
+// It is only touched under the database lock.
+type historyTracker struct {
+	perKey  int                      // Changes kept per key.
+	maxKeys int                      // Keys with a history at once.
+	rings   map[string]*historyRing  // History by key.
+	order   *list.List               // Front is the most recently changed key.
+	elems   map[string]*list.Element // Each key's place in order.
+}
+
+// historyRing is a ring buffer of one key's latest changes.
+type historyRing struct {
+	changes []Change
+	next    int // Where the next change goes once the ring is full.
+}
+
+// WithHistory records the last perKey writes of each key, with their time
+// and a copy of the value, for History. This is for debugging: every write
+// then deep-copies the value it stores, so large collections that change
+// often are expensive to track. At most maxKeys keys have a history; once
+// more keys change, the history of the key changed longest ago is dropped.
+// Non-positive limits leave history off.
+func WithHistory(perKey, maxKeys int) Option {
+	return func(db *DataBase) {
+		if perKey > 0 && maxKeys > 0 {
+			db.history = &historyTracker{
+				perKey:  perKey,
+				maxKeys: maxKeys,
+				rings:   make(map[string]*historyRing),
+				order:   list.New(),
+				elems:   make(map[string]*list.Element),
+			}
+		}
+	}
+}
+
+// History returns up to n of the latest recorded changes to key, oldest
+// first; n of zero or less returns all of them. It returns nil if history is
+// off (see WithHistory) or nothing has been recorded for key. A key's
+// history outlives its deletion, so the removal itself can be seen.
+func (db *DataBase) History(key string, n int) []Change {
+	db.lock.RLock()         // Acquire a read lock.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+	if db.history == nil {
+		return nil
+	}
+	ring := db.history.rings[key]
+	if ring == nil {
+		return nil
+	}
+	all := make([]Change, 0, len(ring.changes))
+	all = append(all, ring.changes[ring.next:]...) // Oldest first.
+	all = append(all, ring.changes[:ring.next]...)
+	if n > 0 && n < len(all) {
+		all = all[len(all)-n:]
+	}
+	for i := range all {
+		all[i].Value = deepCopy(all[i].Value) // Callers may modify what they get.
+	}
+	return all
+}
+
+// recordChange adds a change to key's history, if history is on. The
+// caller must hold the write lock.
+func (db *DataBase) recordChange(key string, deleted bool) {
+	h := db.history
+	if h == nil {
+		return
+	}
+	c := Change{Time: db.clock.Now(), Deleted: deleted}
+	if !deleted {
+		c.Version = db.versions[key]
+		c.Value = deepCopy(db.data.value(key)) // Later in-place writes must not alter it.
+	}
+	if e, ok := h.elems[key]; ok {
+		h.order.MoveToFront(e)
+	} else {
+		h.elems[key] = h.order.PushFront(key)
+		h.rings[key] = &historyRing{}
+		if h.order.Len() > h.maxKeys {
+			oldest := h.order.Remove(h.order.Back()).(string)
+			delete(h.elems, oldest)
+			delete(h.rings, oldest)
+		}
+	}
+	ring := h.rings[key]
+	if len(ring.changes) < h.perKey {
+		ring.changes = append(ring.changes, c)
+		return
+	}
+	ring.changes[ring.next] = c // Overwrite the oldest change.
+	ring.next = (ring.next + 1) % h.perKey
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestHistoryInOrder(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1_000_000, 0))
+	db := NewDataBase(WithClock(clock), WithHistory(3, 2))
+	defer db.Close()
+	start := clock.Now()
+	db.Set("k", int64(1))
+	clock.Advance(time.Second)
+	db.Incr("k")
+	clock.Advance(time.Second)
+	db.Set("k", "x")
+	clock.Advance(time.Second)
+	db.Delete("k")
+
+	changes := db.History("k", 0)
+	want := []struct {
+		value   any
+		deleted bool
+	}{{int64(2), false}, {"x", false}, {nil, true}} // The first write fell out of the ring.
+	if len(changes) != len(want) {
+		t.Fatalf("History = %+v, want %d changes", changes, len(want))
+	}
+	for i, c := range changes {
+		if c.Value != want[i].value || c.Deleted != want[i].deleted {
+			t.Errorf("change %d = %+v, want value %v, deleted %v", i, c, want[i].value, want[i].deleted)
+		}
+		if at := start.Add(time.Duration(i+1) * time.Second); !c.Time.Equal(at) {
+			t.Errorf("change %d at %v, want %v", i, c.Time, at)
+		}
+	}
+	if changes[0].Version == 0 || changes[1].Version <= changes[0].Version || changes[2].Version != 0 {
+		t.Errorf("versions = %d, %d, %d; want rising, then 0 for the removal", changes[0].Version, changes[1].Version, changes[2].Version)
+	}
+	if last := db.History("k", 2); len(last) != 2 || last[0].Value != "x" {
+		t.Errorf("History(k, 2) = %+v, want the latest two", last)
+	}
+
+	db.RPush("list", "a")
+	db.RPush("list", "b")
+	changes = db.History("list", 0)
+	if len(changes) != 2 || !reflect.DeepEqual(changes[0].Value, List{"a"}) {
+		t.Errorf("list history = %+v, want the value as it was at each write", changes)
+	}
+	db.Set("other", 1) // A third key drops the history of the key changed longest ago.
+	if changes := db.History("k", 0); changes != nil {
+		t.Errorf("History(k) past maxKeys = %+v, want it dropped", changes)
+	}
+
+	off := NewDataBase()
+	defer off.Close()
+	off.Set("k", 1)
+	if changes := off.History("k", 0); changes != nil {
+		t.Errorf("History without WithHistory = %+v, want nil", changes)
+	}
+}
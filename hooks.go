@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// GetHook observes a read made by Get or GetCtx: the context of the call,
+// the key and whether it was found.
+type GetHook func(ctx context.Context, key string, found bool)
+
+// SetHook observes a write made by Set, SetCtx or SetAsync: the context of
+// the call, the key, the value and the error the write returned, if any.
+type SetHook func(ctx context.Context, key string, value any, err error)
+
+// hookList is an immutable slice of hooks, replaced whole on registration so
+// the hot paths can read it without a lock.
+type hookList[H any] struct {
+	p atomic.Pointer[[]H]
+}
+
+// add appends h, copying the current list.
+func (l *hookList[H]) add(h H) {
+	for {
+		old := l.p.Load()
+		var hooks []H
+		if old != nil {
+			hooks = append(hooks, *old...)
+		}
+		hooks = append(hooks, h)
+		if l.p.CompareAndSwap(old, &hooks) {
+			return
+		}
+	}
+}
+
+// load returns the registered hooks.
+func (l *hookList[H]) load() []H {
+	if hooks := l.p.Load(); hooks != nil {
+		return *hooks
+	}
+	return nil
+}
+
+// OnGet registers fn to run after every Get and GetCtx, on the calling
+// goroutine and outside the database lock, with the context given to GetCtx
+// or context.Background() for Get. Hooks run in registration order and
+// should be quick, since the read waits for them.
+func (db *DataBase) OnGet(fn GetHook) {
+	db.getHooks.add(fn)
+}
+
+// OnSet registers fn to run after every Set, SetCtx and SetAsync write, like
+// OnGet. Writes made by other methods, including SetString and SetWithTTL,
+// do not call it. For SetAsync the hook runs on the applier goroutine once
+// the write is applied, with context.Background().
+func (db *DataBase) OnSet(fn SetHook) {
+	db.setHooks.add(fn)
+}
+
+// runGetHooks calls the OnGet hooks and logs the read to any audit log.
+func (db *DataBase) runGetHooks(ctx context.Context, key string, value any, found bool) {
+	db.audit.Load().record("get", key, value, &found, nil)
+	for _, fn := range db.getHooks.load() {
+		fn(ctx, key, found)
+	}
+}
+
+// runSetHooks calls the OnSet hooks and logs the write to any audit log.
+func (db *DataBase) runSetHooks(ctx context.Context, key string, value any, err error) {
+	db.audit.Load().record("set", key, value, nil, err)
+	for _, fn := range db.setHooks.load() {
+		fn(ctx, key, value, err)
+	}
+}
+
+// GetCtx is Get with a context, which reaches the OnGet hooks and, with
+// WithTracer, becomes the parent of a "db.Get" span, so a read can be tied
+// to the request that made it. A context that is already done fails the
+// call with its error before anything is read; waiting for the lock cannot
+// be interrupted, as sync.RWMutex has no timed acquisition.
+func (db *DataBase) GetCtx(ctx context.Context, key string) (any, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+	ctx, span := db.startSpan(ctx, "db.Get", key)
+	defer span.End()
+	value, exists := db.get(key)
+	span.SetAttribute("db.hit", exists)
+	db.runGetHooks(ctx, key, value, exists)
+	return value, exists, nil
+}
+
+// SetCtx is Set with a context, passed to the OnSet hooks and tracing like
+// GetCtx. A context that is already done fails the call with its error
+// before anything is written.
+func (db *DataBase) SetCtx(ctx context.Context, key string, value any) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	ctx, span := db.startSpan(ctx, "db.Set", key)
+	defer span.End()
+	err := db.set(key, value, false)
+	if err != nil {
+		span.SetAttribute("error", err.Error())
+	}
+	db.runSetHooks(ctx, key, value, err)
+	return err
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// requestIDKey is the context key a caller would carry a request ID under.
+type requestIDKey struct{}
+
+func TestSetCtxReachesHooks(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	var setIDs, getIDs []any
+	db.OnSet(func(ctx context.Context, key string, _ any, _ error) {
+		setIDs = append(setIDs, ctx.Value(requestIDKey{}))
+	})
+	db.OnGet(func(ctx context.Context, key string, _ bool) {
+		getIDs = append(getIDs, ctx.Value(requestIDKey{}))
+	})
+
+	ctx := context.WithValue(context.Background(), requestIDKey{}, "req-42")
+	if err := db.SetCtx(ctx, "user:1", "ada"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := db.GetCtx(ctx, "user:1"); !ok || err != nil {
+		t.Fatalf("GetCtx = %v, %v; want the key", ok, err)
+	}
+	db.Set("user:2", "bob") // No context: the hook sees no request ID.
+	if len(setIDs) != 2 || setIDs[0] != "req-42" || setIDs[1] != nil {
+		t.Errorf("OnSet saw request IDs %v, want [req-42 <nil>]", setIDs)
+	}
+	if len(getIDs) != 1 || getIDs[0] != "req-42" {
+		t.Errorf("OnGet saw request IDs %v, want [req-42]", getIDs)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := db.SetCtx(cancelled, "user:3", "cy"); !errors.Is(err, context.Canceled) {
+		t.Errorf("SetCtx with a cancelled context: %v, want context.Canceled", err)
+	}
+	if _, ok := db.Get("user:3"); ok {
+		t.Error("SetCtx with a cancelled context wrote the key")
+	}
+	if len(setIDs) != 2 {
+		t.Error("a refused SetCtx ran the OnSet hooks")
+	}
+}
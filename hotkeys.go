@@ -0,0 +1,96 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// KeyCount is a key and its estimated number of accesses, as reported by
+// HotKeys.
+type KeyCount struct {
+	Key   string
+	Count uint64
+}
+
+// hotWindow holds the sampled access counters of one sampling window.
+type hotWindow struct {
+	start  time.Time
+	counts sync.Map // Key to *atomic.Uint64.
+}
+
+// hotKeyTracker samples key accesses. Only one access in every rate is
+// counted, so the untaken path costs a single atomic increment.
+type hotKeyTracker struct {
+	rate    uint64
+	window  time.Duration
+	calls   atomic.Uint64             // Accesses seen, sampled or not.
+	current atomic.Pointer[hotWindow] // The window being filled.
+	last    atomic.Pointer[hotWindow] // The previous, complete window.
+}
+
+// WithHotKeyTracking enables HotKeys. One in every sampleRate accesses is
+// counted (every access when sampleRate is 1 or less), and counts cover the
+// current window plus the one before it, so keys that have gone cold drop out
+// of the report after two windows. Tracking is off by default.
+func WithHotKeyTracking(sampleRate int, window time.Duration) Option {
+	return func(db *DataBase) {
+		if window <= 0 {
+			return
+		}
+		t := &hotKeyTracker{rate: uint64(max(sampleRate, 1)), window: window}
+		t.current.Store(&hotWindow{start: time.Now()})
+		t.last.Store(&hotWindow{})
+		db.hot = t
+	}
+}
+
+// record counts an access to key if it falls in the sample.
+func (t *hotKeyTracker) record(key string) {
+	if t.calls.Add(1)%t.rate != 0 {
+		return // Not sampled.
+	}
+	w := t.current.Load()
+	if now := time.Now(); now.Sub(w.start) >= t.window {
+		if t.current.CompareAndSwap(w, &hotWindow{start: now}) {
+			t.last.Store(w) // The filled window becomes the previous one.
+		}
+		w = t.current.Load()
+	}
+	if c, ok := w.counts.Load(key); ok {
+		c.(*atomic.Uint64).Add(1)
+		return
+	}
+	c, _ := w.counts.LoadOrStore(key, new(atomic.Uint64))
+	c.(*atomic.Uint64).Add(1)
+}
+
+// HotKeys returns up to n of the most accessed keys, busiest first, with
+// their estimated access counts: the sampled counts scaled by the sample
+// rate. Reads and writes through Get, GetCopy, Set and SetWithTTL are
+// counted. It returns nil unless the database was created with
+// WithHotKeyTracking.
+func (db *DataBase) HotKeys(n int) []KeyCount {
+	if db.hot == nil || n <= 0 {
+		return nil
+	}
+	totals := make(map[string]uint64)
+	for _, w := range []*hotWindow{db.hot.last.Load(), db.hot.current.Load()} {
+		w.counts.Range(func(key, c any) bool {
+			totals[key.(string)] += c.(*atomic.Uint64).Load()
+			return true
+		})
+	}
+	top := make([]KeyCount, 0, len(totals))
+	for key, count := range totals {
+		top = append(top, KeyCount{key, count * db.hot.rate})
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Count != top[j].Count {
+			return top[i].Count > top[j].Count
+		}
+		return top[i].Key < top[j].Key // Stable order for ties.
+	})
+	return top[:min(n, len(top))]
+}
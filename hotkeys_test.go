@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHotKeys(t *testing.T) {
+	db := NewDataBase(WithHotKeyTracking(1, time.Hour))
+	defer db.Close()
+	for i := range 200 {
+		db.Set(fmt.Sprintf("cold%d", i), i)
+	}
+	var wg sync.WaitGroup
+	for _, key := range []string{"hot:a", "hot:b", "hot:c"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			db.Set(key, 0)
+			for range 1000 {
+				db.Get(key)
+			}
+		}()
+	}
+	wg.Wait()
+
+	top := db.HotKeys(3)
+	keys := make([]string, len(top))
+	for i, kc := range top {
+		keys[i] = kc.Key
+		if kc.Count != 1001 {
+			t.Errorf("%s counted %d accesses, want 1001", kc.Key, kc.Count)
+		}
+	}
+	if !slices.Equal(keys, []string{"hot:a", "hot:b", "hot:c"}) {
+		t.Errorf("HotKeys(3) = %v, want the three hammered keys", top)
+	}
+	if got := db.HotKeys(1000); len(got) != 203 {
+		t.Errorf("HotKeys(1000) listed %d keys, want all 203", len(got))
+	}
+}
+
+func TestHotKeysSampled(t *testing.T) {
+	db := NewDataBase(WithHotKeyTracking(10, time.Hour))
+	defer db.Close()
+	for range 1000 {
+		db.Get("hot")
+	}
+	db.Get("cold")
+	top := db.HotKeys(1)
+	if len(top) != 1 || top[0].Key != "hot" || top[0].Count < 900 || top[0].Count > 1100 {
+		t.Errorf("HotKeys(1) = %v, want hot at about 1000", top)
+	}
+	untracked := NewDataBase()
+	defer untracked.Close()
+	if untracked.HotKeys(5) != nil {
+		t.Error("HotKeys without tracking is not nil")
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// httpMaxBody caps the request bodies the HTTP API reads.
+const httpMaxBody = 64 << 20
+
+// httpValue is a value as the HTTP API sends and receives it: the envelope
+// of PersistJSON, whose type names the Go type to store, with the key's
+// remaining TTL on reads and the TTL to set on writes.
+type httpValue struct {
+	jsonEnvelope
+	TTL int64 `json:"ttl_ms,omitempty"` // Milliseconds; 0 for none.
+}
+
+// httpKey is the response to GET /keys/{key}.
+type httpKey struct {
+	Key string `json:"key"`
+	httpValue
+}
+
+// httpScan is the response to GET /scan.
+type httpScan struct {
+	Keys   []string `json:"keys"`
+	Cursor string   `json:"cursor"` // A string, as in Redis, since it may exceed 2^53.
+}
+
+// HTTPHandler returns an HTTP handler exposing the keyspace as a JSON API,
+// for clients that do not speak RESP. It serves the same database as any
+// Server, so writes made through either are seen by both:
+//
+//	http.ListenAndServe(":8080", db.HTTPHandler())
+//
+// The endpoints are:
+//
+//	GET    /keys/{key}   200 {"key", "type", "value", "ttl_ms"}, or 404
+//	PUT    /keys/{key}   body {"type", "value", "ttl_ms"}; 204
+//	DELETE /keys/{key}   204, or 404 if the key did not exist
+//	POST   /mset         body {"key": {"type", "value"}, ...}; 204
+//	GET    /scan         ?match=pattern&cursor=0&count=10; 200 {"keys", "cursor"}
+//
+// Values are enveloped as by PersistJSON: type names what the value is
+// stored as, such as "int64", "hash" or "list", and may be left out on
+// writes to store what encoding/json decodes value to, which makes numbers
+// float64. Keys may contain slashes. Errors are {"error": message}, with
+// 400 for a malformed request, 413 for a body over 64 MB, 422 for a prefix
+// policy violation, 503 while the database is read-only and 507 when a
+// write would exceed a NoEviction memory budget. The handler does no
+// authentication, so expose it only where every client may use the whole
+// keyspace, or wrap it in a handler that checks.
+//
+// With WithTracer, each request is traced in a span named after its route,
+// such as "GET /keys/{key...}", joining the caller's trace when the request
+// carries a W3C traceparent header.
+func (db *DataBase) HTTPHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /keys/{key...}", db.httpTraced(db.httpGet))
+	mux.HandleFunc("PUT /keys/{key...}", db.httpTraced(db.httpPut))
+	mux.HandleFunc("DELETE /keys/{key...}", db.httpTraced(db.httpDelete))
+	mux.HandleFunc("POST /mset", db.httpTraced(db.httpMSet))
+	mux.HandleFunc("GET /scan", db.httpTraced(db.httpScan))
+	return mux
+}
+
+// httpTraced runs h inside a span named after the request's route, as
+// traceCommand does for RESP commands, recording the key it targets and
+// the status it replied with. Without a tracer it returns h unchanged.
+func (db *DataBase) httpTraced(h http.HandlerFunc) http.HandlerFunc {
+	if db.tracer == nil {
+		return h
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := ExtractTraceParent(r.Context(), r.Header)
+		ctx, span := db.tracer.Start(ctx, r.Pattern)
+		defer span.End()
+		if key := r.PathValue("key"); key != "" {
+			span.SetAttribute("db.key", key)
+		}
+		sw := &httpStatusWriter{ResponseWriter: w, status: http.StatusOK}
+		h(sw, r.WithContext(ctx))
+		span.SetAttribute("http.status_code", sw.status)
+		if sw.status >= http.StatusBadRequest {
+			span.SetAttribute("status", "error")
+		} else {
+			span.SetAttribute("status", "ok")
+		}
+	}
+}
+
+// httpStatusWriter remembers the status a handler replies with.
+type httpStatusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader implements http.ResponseWriter.
+func (w *httpStatusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// httpGet serves GET /keys/{key}.
+func (db *DataBase) httpGet(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	value, ok := db.GetCopy(key) // Marshalled without the lock, so it must not alias the store.
+	if !ok {
+		httpError(w, http.StatusNotFound, errors.New("no such key"))
+		return
+	}
+	env, err := toEnvelope(value)
+	if err != nil {
+		httpError(w, http.StatusInternalServerError, err)
+		return
+	}
+	resp := httpKey{Key: key, httpValue: httpValue{jsonEnvelope: env}}
+	if ttl := db.TTL(key); ttl > 0 {
+		resp.TTL = max(ttl.Milliseconds(), 1) // Round a last sub-millisecond up, not to "none".
+	}
+	httpJSON(w, http.StatusOK, resp)
+}
+
+// httpPut serves PUT /keys/{key}.
+func (db *DataBase) httpPut(w http.ResponseWriter, r *http.Request) {
+	var body httpValue
+	if !httpDecode(w, r, &body) {
+		return
+	}
+	if body.TTL < 0 {
+		httpError(w, http.StatusBadRequest, errors.New("ttl_ms is negative"))
+		return
+	}
+	value, err := httpValueOf(body.jsonEnvelope)
+	if err != nil {
+		httpError(w, http.StatusBadRequest, err)
+		return
+	}
+	if body.TTL > 0 {
+		err = db.SetWithTTL(r.PathValue("key"), value, time.Duration(body.TTL)*time.Millisecond)
+	} else {
+		err = db.Set(r.PathValue("key"), value)
+	}
+	httpWritten(w, err)
+}
+
+// httpDelete serves DELETE /keys/{key}.
+func (db *DataBase) httpDelete(w http.ResponseWriter, r *http.Request) {
+	if db.ReadOnly() {
+		httpError(w, http.StatusServiceUnavailable, ErrReadOnly) // Delete would only report false.
+		return
+	}
+	if !db.Delete(r.PathValue("key")) {
+		httpError(w, http.StatusNotFound, errors.New("no such key"))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// httpMSet serves POST /mset.
+func (db *DataBase) httpMSet(w http.ResponseWriter, r *http.Request) {
+	var body map[string]jsonEnvelope
+	if !httpDecode(w, r, &body) {
+		return
+	}
+	pairs := make(map[string]any, len(body))
+	for key, env := range body {
+		value, err := httpValueOf(env)
+		if err != nil {
+			httpError(w, http.StatusBadRequest, err)
+			return
+		}
+		pairs[key] = value
+	}
+	httpWritten(w, db.MSet(pairs))
+}
+
+// httpScan serves GET /scan.
+func (db *DataBase) httpScan(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var cursor uint64
+	if s := q.Get("cursor"); s != "" {
+		var err error
+		if cursor, err = strconv.ParseUint(s, 10, 64); err != nil {
+			httpError(w, http.StatusBadRequest, errors.New("cursor is not an unsigned integer"))
+			return
+		}
+	}
+	count := 0 // Scan's default.
+	if s := q.Get("count"); s != "" {
+		var err error
+		if count, err = strconv.Atoi(s); err != nil || count <= 0 {
+			httpError(w, http.StatusBadRequest, errors.New("count is not a positive integer"))
+			return
+		}
+	}
+	keys, next := db.Scan(cursor, q.Get("match"), count) // No match returns every key.
+	if keys == nil {
+		keys = []string{} // An empty page is [], not null.
+	}
+	httpJSON(w, http.StatusOK, httpScan{Keys: keys, Cursor: strconv.FormatUint(next, 10)})
+}
+
+// httpValueOf rebuilds the value of a request envelope. A missing value is
+// an error rather than a null value.
+func httpValueOf(env jsonEnvelope) (any, error) {
+	if env.Value == nil {
+		return nil, errors.New("value is missing")
+	}
+	return fromEnvelope(env)
+}
+
+// httpDecode reads a JSON request body into v, replying 400 or 413 and
+// reporting false if it cannot.
+func httpDecode(w http.ResponseWriter, r *http.Request, v any) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, httpMaxBody))
+	err := dec.Decode(v)
+	if err == nil && dec.More() {
+		err = errors.New("unexpected data after the JSON body")
+	}
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		httpError(w, http.StatusRequestEntityTooLarge, err)
+	case err != nil:
+		httpError(w, http.StatusBadRequest, err)
+	}
+	return err == nil
+}
+
+// httpWritten replies to a write with 204, or with the status matching its
+// error.
+func httpWritten(w http.ResponseWriter, err error) {
+	var policy *PolicyError
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent)
+	case errors.As(err, &policy):
+		httpError(w, http.StatusUnprocessableEntity, err)
+	case errors.Is(err, ErrReadOnly):
+		httpError(w, http.StatusServiceUnavailable, err)
+	case errors.Is(err, ErrOOM):
+		httpError(w, http.StatusInsufficientStorage, err)
+	default:
+		httpError(w, http.StatusInternalServerError, err)
+	}
+}
+
+// httpError replies with status and {"error": err}.
+func httpError(w http.ResponseWriter, status int, err error) {
+	httpJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// httpJSON replies with status and v as JSON.
+func httpJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v) // A failed write means the client went away.
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// httpDo sends a request to h and returns the recorded response.
+func httpDo(h http.Handler, method, target, body string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func TestHTTPHandlerKeys(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	h := db.HTTPHandler()
+
+	if w := httpDo(h, "PUT", "/keys/user/1", `{"type":"string","value":"ada","ttl_ms":60000}`, nil); w.Code != http.StatusNoContent {
+		t.Fatalf("PUT: %d %s", w.Code, w.Body)
+	}
+	w := httpDo(h, "GET", "/keys/user/1", "", nil)
+	var got httpKey
+	if err := json.Unmarshal(w.Body.Bytes(), &got); w.Code != http.StatusOK || err != nil {
+		t.Fatalf("GET: %d %s", w.Code, w.Body)
+	}
+	if got.Key != "user/1" || string(got.Value) != `"ada"` || got.TTL <= 0 || got.TTL > 60000 {
+		t.Errorf("GET = %+v", got)
+	}
+	if w := httpDo(h, "POST", "/mset", `{"a":{"type":"int64","value":1},"b":{"value":"x"}}`, nil); w.Code != http.StatusNoContent {
+		t.Fatalf("POST /mset: %d %s", w.Code, w.Body)
+	}
+	if value, _ := db.Get("a"); value != int64(1) {
+		t.Errorf("Get(a) = %#v, want int64(1)", value)
+	}
+	if w := httpDo(h, "DELETE", "/keys/a", "", nil); w.Code != http.StatusNoContent {
+		t.Errorf("DELETE: %d", w.Code)
+	}
+	if w := httpDo(h, "DELETE", "/keys/a", "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("DELETE of a missing key: %d, want 404", w.Code)
+	}
+	if w := httpDo(h, "GET", "/keys/a", "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("GET of a missing key: %d, want 404", w.Code)
+	}
+	if w := httpDo(h, "PUT", "/keys/c", `{"value":`, nil); w.Code != http.StatusBadRequest {
+		t.Errorf("PUT of malformed JSON: %d, want 400", w.Code)
+	}
+
+	db.SetReadOnly(true)
+	if w := httpDo(h, "PUT", "/keys/c", `{"value":"x"}`, nil); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("PUT while read-only: %d, want 503", w.Code)
+	}
+}
+
+func TestHTTPHandlerScan(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	for _, key := range []string{"user:1", "user:2", "order:1"} {
+		db.Set(key, "v")
+	}
+	w := httpDo(db.HTTPHandler(), "GET", "/scan?match=user:*&count=100", "", nil)
+	var page httpScan
+	if err := json.Unmarshal(w.Body.Bytes(), &page); w.Code != http.StatusOK || err != nil {
+		t.Fatalf("GET /scan: %d %s", w.Code, w.Body)
+	}
+	if len(page.Keys) != 2 || page.Cursor != "0" {
+		t.Errorf("GET /scan = %+v, want both user keys and cursor 0", page)
+	}
+	if w := httpDo(db.HTTPHandler(), "GET", "/scan?cursor=x", "", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("GET /scan with a bad cursor: %d, want 400", w.Code)
+	}
+}
+
+func TestHTTPHandlerTracing(t *testing.T) {
+	tracer := &recordingTracer{}
+	db := NewDataBase(WithTracer(tracer))
+	defer db.Close()
+	h := db.HTTPHandler()
+
+	header := http.Header{"Traceparent": {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}}
+	httpDo(h, "PUT", "/keys/k", `{"value":"v"}`, header)
+	httpDo(h, "GET", "/keys/missing", "", nil)
+
+	if len(tracer.spans) != 2 {
+		t.Fatalf("recorded %d spans, want 2", len(tracer.spans))
+	}
+	put, get := tracer.spans[0], tracer.spans[1]
+	if put.name != "PUT /keys/{key...}" || put.attrs["db.key"] != "k" || put.attrs["status"] != "ok" || !put.ended {
+		t.Errorf("PUT span = %+v", put)
+	}
+	if !put.parent.Sampled || put.parent.SpanID != [8]byte{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7} {
+		t.Errorf("PUT span parent = %+v, want the traceparent header's", put.parent)
+	}
+	if get.attrs["http.status_code"] != http.StatusNotFound || get.attrs["status"] != "error" {
+		t.Errorf("GET span = %+v, want a 404 error", get)
+	}
+	if get.parent != (SpanContext{}) {
+		t.Errorf("GET span has parent %+v without a traceparent header", get.parent)
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/gob"
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"slices"
+)
+
+// HyperLogLog parameters, as in Redis: 2^14 registers give a standard
+// error of 0.81%, and each register holds the longest run of zeros seen in
+// the remaining 50 bits of an item's hash, plus one.
+const (
+	hllPrecision = 14
+	hllRegisters = 1 << hllPrecision
+	hllQ         = 64 - hllPrecision
+)
+
+// HyperLogLog is the value stored under a key holding an approximate
+// distinct counter, built by PFAdd. It takes hllRegisters bytes however
+// many items are added.
+type HyperLogLog struct {
+	Registers []uint8
+}
+
+func init() {
+	gob.Register(&HyperLogLog{}) // Allow counters to be persisted inside the any-typed map.
+}
+
+// newHyperLogLog returns an empty counter.
+func newHyperLogLog() *HyperLogLog {
+	return &HyperLogLog{Registers: make([]uint8, hllRegisters)}
+}
+
+// deepCopy returns an independent copy, used by GetCopy.
+func (h *HyperLogLog) deepCopy() any {
+	return &HyperLogLog{Registers: slices.Clone(h.Registers)}
+}
+
+// valid reports whether the counter has the expected registers, as one
+// restored from a file written by another build might not.
+func (h *HyperLogLog) valid() bool {
+	if len(h.Registers) != hllRegisters {
+		return false
+	}
+	for _, r := range h.Registers {
+		if r > hllQ+1 {
+			return false
+		}
+	}
+	return true
+}
+
+// hllHash hashes an item with FNV-1a, finished with the MurmurHash3 mixer
+// so every bit depends on every input bit, as the registers need. Unlike
+// maphash it is the same in every process, so saved counters stay valid.
+func hllHash(item string) uint64 {
+	f := fnv.New64a()
+	f.Write([]byte(item))
+	x := f.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+// add counts item, reporting whether a register changed.
+func (h *HyperLogLog) add(item string) bool {
+	x := hllHash(item)
+	index := x & (hllRegisters - 1)
+	rest := x>>hllPrecision | 1<<hllQ // The sentinel bit caps the run at hllQ.
+	run := uint8(bits.TrailingZeros64(rest)) + 1
+	if run <= h.Registers[index] {
+		return false
+	}
+	h.Registers[index] = run
+	return true
+}
+
+// merge folds other into h, so h counts the items of both.
+func (h *HyperLogLog) merge(other *HyperLogLog) {
+	for i, r := range other.Registers {
+		h.Registers[i] = max(h.Registers[i], r)
+	}
+}
+
+// count estimates how many distinct items were added, with the estimator
+// from Otmar Ertl's "New cardinality estimation algorithms for HyperLogLog
+// sketches", which Redis also uses and which needs no bias tables.
+func (h *HyperLogLog) count() int {
+	var histogram [hllQ + 2]int
+	for _, r := range h.Registers {
+		histogram[r]++
+	}
+	m := float64(hllRegisters)
+	z := m * hllTau(1-float64(histogram[hllQ+1])/m)
+	for k := hllQ; k >= 1; k-- {
+		z = 0.5 * (z + float64(histogram[k]))
+	}
+	z += m * hllSigma(float64(histogram[0])/m)
+	return int(math.Round(0.5 / math.Ln2 * m * m / z))
+}
+
+// hllSigma is Ertl's sigma function, correcting for empty registers.
+func hllSigma(x float64) float64 {
+	if x == 1 {
+		return math.Inf(1)
+	}
+	y, z := 1.0, x
+	for {
+		x *= x
+		prev := z
+		z += x * y
+		y += y
+		if z == prev {
+			return z
+		}
+	}
+}
+
+// hllTau is Ertl's tau function, correcting for saturated registers.
+func hllTau(x float64) float64 {
+	if x == 0 || x == 1 {
+		return 0
+	}
+	y, z := 1.0, 1-x
+	for {
+		x = math.Sqrt(x)
+		prev := z
+		y *= 0.5
+		z -= (1 - x) * (1 - x) * y
+		if z == prev {
+			return z / 3
+		}
+	}
+}
+
+// hllAt returns the counter stored at key, or nil if the key is absent.
+// It returns ErrWrongType if the key holds a different kind of value.
+// The caller must hold the lock.
+func (db *DataBase) hllAt(key string) (*HyperLogLog, error) {
+	value, exists := db.lookup(key)
+	if !exists {
+		return nil, nil
+	}
+	h, ok := value.(*HyperLogLog)
+	if !ok || !h.valid() {
+		return nil, ErrWrongType
+	}
+	return h, nil
+}
+
+// PFAdd adds items to the HyperLogLog counter at key, creating it if
+// needed, and reports whether its estimate may have changed: true if the
+// counter was created or a register updated. Items are counted by their
+// string form, so 5 and "5" are the same item.
+func (db *DataBase) PFAdd(key string, items ...any) (bool, error) {
+	db.lock.Lock()    // Acquire a write lock.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	if db.readOnly {
+		return false, ErrReadOnly
+	}
+	db.expireIfNeeded(key)
+	if err := db.checkGrowth(); err != nil {
+		return false, err
+	}
+
+	h, err := db.hllAt(key)
+	if err != nil {
+		return false, err
+	}
+	changed := h == nil
+	if h == nil {
+		h = newHyperLogLog() // The first add creates the counter, even with no items.
+		db.data.set(key, h)
+	}
+	db.cow(key) // Keep a running BGSave's view intact.
+	for _, item := range items {
+		if h.add(setMember(item)) {
+			changed = true
+		}
+	}
+	if changed {
+		db.touch(key)
+	}
+	return changed, nil
+}
+
+// PFCount returns the approximate number of distinct items added to the
+// counters at keys, counting an item added to several of them once.
+// Missing keys count as empty. The estimate has a standard error of 0.81%.
+func (db *DataBase) PFCount(keys ...string) (int, error) {
+	db.lock.RLock()         // Acquire a read lock.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+	var union *HyperLogLog
+	for _, key := range keys {
+		h, err := db.hllAt(key)
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case h == nil:
+		case union == nil && len(keys) == 1:
+			union = h // Read only; no need to copy.
+		case union == nil:
+			union = h.deepCopy().(*HyperLogLog)
+		default:
+			union.merge(h)
+		}
+	}
+	if union == nil {
+		return 0, nil
+	}
+	return union.count(), nil
+}
+
+// PFMerge stores at dest a counter of the items counted at dest and at
+// srcs, creating dest if needed. Missing sources count as empty.
+func (db *DataBase) PFMerge(dest string, srcs ...string) error {
+	db.lock.Lock()    // Acquire a write lock.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	if db.readOnly {
+		return ErrReadOnly
+	}
+	db.expireIfNeeded(dest)
+	if err := db.checkGrowth(); err != nil {
+		return err
+	}
+
+	h, err := db.hllAt(dest)
+	if err != nil {
+		return err
+	}
+	sources := make([]*HyperLogLog, 0, len(srcs))
+	for _, src := range srcs {
+		s, err := db.hllAt(src)
+		if err != nil {
+			return err // Checked before dest is created or changed.
+		}
+		if s != nil {
+			sources = append(sources, s)
+		}
+	}
+	if h == nil {
+		h = newHyperLogLog()
+		db.data.set(dest, h)
+	}
+	db.cow(dest) // Keep a running BGSave's view intact.
+	for _, s := range sources {
+		h.merge(s)
+	}
+	db.touch(dest)
+	return nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+)
+
+// addRange adds the items prefix0 .. prefix(n-1) to the counter at key.
+func addRange(t *testing.T, db *DataBase, key, prefix string, from, to int) {
+	t.Helper()
+	items := make([]any, 0, to-from)
+	for i := from; i < to; i++ {
+		items = append(items, fmt.Sprint(prefix, i))
+	}
+	if _, err := db.PFAdd(key, items...); err != nil {
+		t.Fatalf("PFAdd: %v", err)
+	}
+}
+
+func TestPFCountErrorBounds(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	added := 0
+	for _, n := range []int{1, 10, 100, 1000, 10000, 100000, 500000} {
+		addRange(t, db, "hll", "item:", added, n)
+		added = n
+		got, err := db.PFCount("hll")
+		if err != nil {
+			t.Fatalf("PFCount: %v", err)
+		}
+		// Five standard errors of 0.81%, and exact up to the small cases.
+		bound := math.Max(5*0.0081*float64(n), 1)
+		if diff := math.Abs(float64(got - n)); diff > bound {
+			t.Errorf("PFCount after %d distinct items = %d, off by %.0f, more than %.0f", n, got, diff, bound)
+		}
+	}
+	addRange(t, db, "hll", "item:", 0, 1000) // Repeats change nothing.
+	if changed, _ := db.PFAdd("hll", "item:1", "item:2"); changed {
+		t.Error("PFAdd of items already counted reported a change")
+	}
+}
+
+func TestPFAddEmpty(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	if n, err := db.PFCount("missing"); n != 0 || err != nil {
+		t.Errorf("PFCount of a missing key = %d, %v; want 0", n, err)
+	}
+	if changed, err := db.PFAdd("empty"); !changed || err != nil {
+		t.Errorf("PFAdd with no items = %v, %v; want the counter created", changed, err)
+	}
+	if n, _ := db.PFCount("empty"); n != 0 {
+		t.Errorf("PFCount of an empty counter = %d, want 0", n)
+	}
+	if changed, _ := db.PFAdd("empty"); changed {
+		t.Error("PFAdd with no items to an existing counter reported a change")
+	}
+	db.PFAdd("nums", 5)
+	if changed, _ := db.PFAdd("nums", "5"); changed {
+		t.Error(`PFAdd("5") after PFAdd(5) reported a change: items count by their string form`)
+	}
+	db.Set("str", "v")
+	if _, err := db.PFAdd("str", "x"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("PFAdd to a string: %v, want ErrWrongType", err)
+	}
+	if _, err := db.PFCount("empty", "str"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("PFCount including a string: %v, want ErrWrongType", err)
+	}
+}
+
+func TestPFMerge(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	addRange(t, db, "a", "x", 0, 6000)
+	addRange(t, db, "b", "x", 4000, 10000) // Overlaps a by 2000.
+	if err := db.PFMerge("union", "a", "b", "missing"); err != nil {
+		t.Fatalf("PFMerge: %v", err)
+	}
+	union, _ := db.PFCount("union")
+	if diff := math.Abs(float64(union - 10000)); diff > 5*0.0081*10000 {
+		t.Errorf("PFCount of the merge = %d, want about 10000", union)
+	}
+	if n, _ := db.PFCount("a", "b"); n != union {
+		t.Errorf("PFCount(a, b) = %d, want the merged count %d", n, union)
+	}
+	if n, _ := db.PFCount("a"); math.Abs(float64(n-6000)) > 5*0.0081*6000 {
+		t.Errorf("PFCount(a) = %d after the merge, want the source unchanged at about 6000", n)
+	}
+
+	addRange(t, db, "dest", "y", 0, 1000) // Merging keeps what dest counted.
+	db.PFMerge("dest", "a")
+	if n, _ := db.PFCount("dest"); math.Abs(float64(n-7000)) > 5*0.0081*7000 {
+		t.Errorf("PFCount(dest) = %d after merging a into it, want about 7000", n)
+	}
+	if err := db.PFMerge("fresh"); err != nil {
+		t.Fatalf("PFMerge without sources: %v", err)
+	}
+	if n, err := db.PFCount("fresh"); n != 0 || err != nil {
+		t.Errorf("PFCount of a merge of nothing = %d, %v; want an empty counter", n, err)
+	}
+	db.Set("str", "v")
+	if err := db.PFMerge("untouched", "a", "str"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("PFMerge from a string: %v, want ErrWrongType", err)
+	}
+	if _, ok := db.Get("untouched"); ok {
+		t.Error("a failed PFMerge created its destination")
+	}
+}
+
+func TestServerHyperLogLog(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	c := dial(t, startServer(t, db, ServerConfig{}))
+	if reply := c.do(t, "PFADD", "h", "a", "b", "c"); reply != int64(1) {
+		t.Errorf("PFADD = %v, want 1", reply)
+	}
+	if reply := c.do(t, "PFADD", "h", "a"); reply != int64(0) {
+		t.Errorf("PFADD of a counted item = %v, want 0", reply)
+	}
+	c.do(t, "PFADD", "g", "c", "d")
+	if reply := c.do(t, "PFCOUNT", "h", "g"); reply != int64(4) {
+		t.Errorf("PFCOUNT h g = %v, want 4", reply)
+	}
+	if reply := c.do(t, "PFMERGE", "m", "h", "g"); reply != "OK" {
+		t.Errorf("PFMERGE = %v, want OK", reply)
+	}
+	if reply := c.do(t, "PFCOUNT", "m"); reply != int64(4) {
+		t.Errorf("PFCOUNT m = %v, want 4", reply)
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Info is a point-in-time report on the database, as served by the INFO
+// command and MetricsHandler.
+type Info struct {
+	Uptime time.Duration // Time since NewDataBase.
+	Role   string        // "master", or "replica" while following a primary (see ReplicaOf).
+
+	ConnectedClients  int // Connections open on the Servers serving the database.
+	ConnectedReplicas int // Replicas streaming changes from it.
+
+	Keys        int   // Keys currently stored, including expired ones not yet removed.
+	KeysWithTTL int   // Those of them with a deadline.
+	UsedMemory  int64 // Estimated memory used by all keys, as measured by MemoryUsage.
+	MaxMemory   int64 // The budget set by SetMaxMemory; 0 is unlimited.
+
+	Hits      uint64  // Key reads that found their key.
+	Misses    uint64  // Key reads that did not.
+	Evictions uint64  // Keys evicted to stay under the memory budget.
+	Ops       uint64  // Key reads and writes since the database was created.
+	OpsPerSec float64 // Ops per second since the previous report, at least a second ago.
+
+	ChangesSinceSave int64     // Writes not yet in a snapshot.
+	LastSave         time.Time // When the last snapshot was saved; zero if none has been.
+	PersistenceState string    // The state of the save circuit breaker (see PersistenceState).
+}
+
+// opsSampler turns the running operation count into a rate.
+type opsSampler struct {
+	mu   sync.Mutex
+	at   time.Time // When the count was last sampled.
+	ops  uint64    // The count then.
+	rate float64   // Operations per second over the last sampled interval.
+}
+
+// sample records ops at now and returns the rate since the previous sample,
+// or the previous rate if that was less than a second ago, so callers
+// polling fast do not see the rate of a few milliseconds.
+func (s *opsSampler) sample(now time.Time, ops uint64) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if elapsed := now.Sub(s.at); elapsed >= time.Second {
+		s.rate = float64(ops-s.ops) / elapsed.Seconds()
+		s.at, s.ops = now, ops
+	}
+	return s.rate
+}
+
+// Info returns a report on the database. While no memory budget is set the
+// memory estimate is not maintained, so it is computed by walking every key,
+// which costs time in proportion to the size of the store.
+func (db *DataBase) Info() Info {
+	state := db.PersistenceState() // Before the read lock; the breaker has its own.
+	db.lock.RLock()                // Acquire a read lock.
+	defer db.lock.RUnlock()        // Release the lock when the function exits.
+	now := db.clock.Now()
+	info := Info{
+		Uptime:            now.Sub(db.started),
+		Role:              "master",
+		ConnectedClients:  int(db.clients.Load()),
+		ConnectedReplicas: int(db.feeds.count.Load()),
+		Keys:              db.data.len(),
+		KeysWithTTL:       db.expires.len(),
+		UsedMemory:        db.memUsed,
+		MaxMemory:         db.maxMemory,
+		Hits:              db.hits.Load(),
+		Misses:            db.misses.Load(),
+		Evictions:         db.evictions,
+		ChangesSinceSave:  db.dirty.Load(),
+		PersistenceState:  state,
+	}
+	if db.replica != nil {
+		info.Role = "replica"
+	}
+	if db.keySizes == nil {
+		for key, value := range db.data.all() {
+			info.UsedMemory += entrySize(key, db.stored(key, value))
+		}
+	}
+	info.Ops = info.Hits + info.Misses + db.writes.Load()
+	info.OpsPerSec = db.opsRate.sample(now, info.Ops)
+	if saved := db.lastSave.Load(); saved != 0 {
+		info.LastSave = time.Unix(0, saved)
+	}
+	return info
+}
+
+// infoSections lists the sections of the INFO reply in order, each with
+// the fields it reports.
+var infoSections = []struct {
+	name   string
+	fields func(info Info) []any // Alternating field names and values.
+}{
+	{"Server", func(info Info) []any {
+		return []any{"uptime_in_seconds", int64(info.Uptime.Seconds())}
+	}},
+	{"Clients", func(info Info) []any {
+		return []any{"connected_clients", info.ConnectedClients}
+	}},
+	{"Memory", func(info Info) []any {
+		return []any{"used_memory", info.UsedMemory, "maxmemory", info.MaxMemory}
+	}},
+	{"Persistence", func(info Info) []any {
+		var lastSave int64
+		if !info.LastSave.IsZero() {
+			lastSave = info.LastSave.Unix()
+		}
+		return []any{
+			"rdb_changes_since_last_save", info.ChangesSinceSave,
+			"rdb_last_save_time", lastSave,
+			"rdb_breaker_state", info.PersistenceState,
+		}
+	}},
+	{"Stats", func(info Info) []any {
+		return []any{
+			"total_commands_processed", info.Ops,
+			"instantaneous_ops_per_sec", fmt.Sprintf("%.2f", info.OpsPerSec),
+			"keyspace_hits", info.Hits,
+			"keyspace_misses", info.Misses,
+			"evicted_keys", info.Evictions,
+		}
+	}},
+	{"Replication", func(info Info) []any {
+		return []any{"role", info.Role, "connected_slaves", info.ConnectedReplicas}
+	}},
+	{"Keyspace", func(info Info) []any {
+		return []any{"db0", fmt.Sprintf("keys=%d,expires=%d", info.Keys, info.KeysWithTTL)}
+	}},
+}
+
+// cmdInfo replies with INFO [section ...] as Redis formats it: a bulk
+// string of "# Section" headers, each followed by field:value lines.
+// Without arguments, or with "all" or "default", every section is included.
+func cmdInfo(db *DataBase, args []string) any {
+	want := make(map[string]bool, len(args))
+	for _, arg := range args {
+		want[strings.ToLower(arg)] = true
+	}
+	all := len(args) == 0 || want["all"] || want["default"] || want["everything"]
+	info := db.Info()
+	var b strings.Builder
+	for _, section := range infoSections {
+		if !all && !want[strings.ToLower(section.name)] {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteString("\r\n")
+		}
+		fmt.Fprintf(&b, "# %s\r\n", section.name)
+		fields := section.fields(info)
+		for i := 0; i < len(fields); i += 2 {
+			fmt.Fprintf(&b, "%s:%v\r\n", fields[i], fields[i+1])
+		}
+	}
+	return b.String()
+}
+
+// metric is one metric of MetricsHandler.
+type metric struct {
+	name  string
+	kind  string // "gauge" or "counter".
+	help  string
+	value func(info Info) float64
+}
+
+// metrics lists what MetricsHandler exposes, under the names used by the
+// common Redis exporter so existing dashboards work.
+var metrics = []metric{
+	{"redis_uptime_in_seconds", "gauge", "Seconds since the database was created.",
+		func(info Info) float64 { return info.Uptime.Seconds() }},
+	{"redis_connected_clients", "gauge", "Client connections open.",
+		func(info Info) float64 { return float64(info.ConnectedClients) }},
+	{"redis_connected_slaves", "gauge", "Replicas streaming changes.",
+		func(info Info) float64 { return float64(info.ConnectedReplicas) }},
+	{"redis_db_keys", "gauge", "Keys stored.",
+		func(info Info) float64 { return float64(info.Keys) }},
+	{"redis_db_keys_expiring", "gauge", "Keys stored with a TTL.",
+		func(info Info) float64 { return float64(info.KeysWithTTL) }},
+	{"redis_memory_used_bytes", "gauge", "Estimated memory used by all keys.",
+		func(info Info) float64 { return float64(info.UsedMemory) }},
+	{"redis_memory_max_bytes", "gauge", "Memory budget; 0 is unlimited.",
+		func(info Info) float64 { return float64(info.MaxMemory) }},
+	{"redis_keyspace_hits_total", "counter", "Key reads that found their key.",
+		func(info Info) float64 { return float64(info.Hits) }},
+	{"redis_keyspace_misses_total", "counter", "Key reads that did not find their key.",
+		func(info Info) float64 { return float64(info.Misses) }},
+	{"redis_evicted_keys_total", "counter", "Keys evicted to stay under the memory budget.",
+		func(info Info) float64 { return float64(info.Evictions) }},
+	{"redis_commands_processed_total", "counter", "Key reads and writes served.",
+		func(info Info) float64 { return float64(info.Ops) }},
+	{"redis_instantaneous_ops_per_sec", "gauge", "Key reads and writes per second, recently.",
+		func(info Info) float64 { return info.OpsPerSec }},
+	{"redis_rdb_changes_since_last_save", "gauge", "Writes not yet in a snapshot.",
+		func(info Info) float64 { return float64(info.ChangesSinceSave) }},
+	{"redis_rdb_last_save_timestamp_seconds", "gauge", "Unix time of the last snapshot saved; 0 if none.",
+		func(info Info) float64 {
+			if info.LastSave.IsZero() {
+				return 0
+			}
+			return float64(info.LastSave.Unix())
+		}},
+}
+
+// MetricsHandler returns an HTTP handler serving the Info report in the
+// Prometheus text exposition format, for mounting at /metrics:
+//
+//	http.Handle("/metrics", db.MetricsHandler())
+//
+// Each scrape takes a fresh report, with the costs described at Info.
+func (db *DataBase) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info := db.Info()
+		var b strings.Builder
+		for _, m := range metrics {
+			fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n%s %g\n", m.name, m.help, m.name, m.kind, m.name, m.value(info))
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.Write([]byte(b.String())) // A failed write means the scraper went away.
+	})
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	db.SetMaxMemory(1<<20, NoEviction)
+	db.Set("a", "1")
+	db.SetWithTTL("b", "2", time.Minute)
+	db.Get("a")
+	db.Get("missing")
+
+	w := httptest.NewRecorder()
+	db.MetricsHandler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q, want the Prometheus text format", ct)
+	}
+
+	values := make(map[string]float64)
+	types := make(map[string]string)
+	sc := bufio.NewScanner(w.Body)
+	for sc.Scan() {
+		line := sc.Text()
+		if rest, ok := strings.CutPrefix(line, "# TYPE "); ok {
+			name, kind, _ := strings.Cut(rest, " ")
+			types[name] = kind
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, raw, ok := strings.Cut(line, " ")
+		value, err := strconv.ParseFloat(raw, 64)
+		if !ok || err != nil {
+			t.Fatalf("malformed sample line %q", line)
+		}
+		if _, dup := values[name]; dup {
+			t.Errorf("%s is reported twice", name)
+		}
+		values[name] = value
+	}
+	for name, want := range map[string]float64{
+		"redis_db_keys":                         2,
+		"redis_db_keys_expiring":                1,
+		"redis_keyspace_hits_total":             1,
+		"redis_keyspace_misses_total":           1,
+		"redis_memory_max_bytes":                1 << 20,
+		"redis_evicted_keys_total":              0,
+		"redis_connected_clients":               0,
+		"redis_connected_slaves":                0,
+		"redis_rdb_changes_since_last_save":     2,
+		"redis_rdb_last_save_timestamp_seconds": 0,
+	} {
+		if got, ok := values[name]; !ok || got != want {
+			t.Errorf("%s = %v (reported %v), want %v", name, got, ok, want)
+		}
+	}
+	if values["redis_memory_used_bytes"] <= 0 {
+		t.Errorf("redis_memory_used_bytes = %v, want the keys' size", values["redis_memory_used_bytes"])
+	}
+	if values["redis_commands_processed_total"] < 4 {
+		t.Errorf("redis_commands_processed_total = %v, want at least the 4 operations", values["redis_commands_processed_total"])
+	}
+	for _, m := range metrics {
+		if _, ok := values[m.name]; !ok {
+			t.Errorf("%s is missing", m.name)
+		}
+		if types[m.name] != m.kind {
+			t.Errorf("%s has TYPE %q, want %q", m.name, types[m.name], m.kind)
+		}
+		if strings.HasSuffix(m.name, "_total") != (m.kind == "counter") {
+			t.Errorf("%s is a %s; counters, and only counters, end in _total", m.name, m.kind)
+		}
+	}
+}
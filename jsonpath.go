@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	gob.Register(map[string]any{}) // JSON objects, so documents can be persisted.
+	gob.Register([]any{})          // JSON arrays.
+}
+
+// ErrNoPath is returned by JSONGet when the path does not exist.
+var ErrNoPath = errors.New("json: path does not exist")
+
+// pathSegment is one step of a JSON path: an object field or an array index.
+type pathSegment struct {
+	field string
+	index int
+	isIdx bool
+}
+
+// String renders the segment as it appears in a path.
+func (s pathSegment) String() string {
+	if s.isIdx {
+		return "[" + strconv.Itoa(s.index) + "]"
+	}
+	return "." + s.field
+}
+
+// parsePath splits a dot/bracket path such as "a.b[0].c" into segments.
+// An empty path, "$" or "." designates the whole document.
+func parsePath(path string) ([]pathSegment, error) {
+	path = strings.TrimPrefix(path, "$")
+	var segs []pathSegment
+	for i := 0; i < len(path); {
+		switch path[i] {
+		case '.':
+			i++ // Separator before a field name.
+		case '[':
+			end := strings.IndexByte(path[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("json: unterminated index in path %q", path)
+			}
+			n, err := strconv.Atoi(path[i+1 : i+end])
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("json: bad index %q in path %q", path[i+1:i+end], path)
+			}
+			segs = append(segs, pathSegment{index: n, isIdx: true})
+			i += end + 1
+		default:
+			end := strings.IndexAny(path[i:], ".[")
+			if end < 0 {
+				end = len(path) - i // Field runs to the end of the path.
+			}
+			segs = append(segs, pathSegment{field: path[i : i+end]})
+			i += end
+		}
+	}
+	return segs, nil
+}
+
+// JSONSet stores value at path inside the document held at key, a tree of
+// map[string]any objects and []any arrays. Missing intermediate objects and
+// arrays are created, and arrays are padded with nil up to a new index.
+// Setting the root path ("" or "$") replaces the whole document. Walking
+// through a value of the wrong kind, such as indexing into an object,
+// returns an error naming the offending part of the path.
+func (db *DataBase) JSONSet(key, path string, value any) error {
+	segs, err := parsePath(path)
+	if err != nil {
+		return err
+	}
+
+	db.lock.Lock()    // Acquire a write lock for the in-place update.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	if db.readOnly {
+		return ErrReadOnly
+	}
+	db.expireIfNeeded(key)
+	if err := db.checkGrowth(); err != nil {
+		return err
+	}
+
+	root, exists := db.data.get(key)
+	if !exists {
+		root = nil // A fresh document is built from the path.
+	}
+	db.cow(key) // setPath updates the document in place.
+	updated, err := setPath(root, segs, value, "$")
+	if err != nil {
+		return err
+	}
+	if exists {
+		db.data.set(key, updated) // Keep any TTL on the document.
+		db.touch(key)
+	} else {
+		db.setLocked(key, updated)
+	}
+	return nil
+}
+
+// setPath assigns value below node and returns the possibly new node, since
+// growing an array or creating a container replaces it. where is the path
+// walked so far, for error messages.
+func setPath(node any, segs []pathSegment, value any, where string) (any, error) {
+	if len(segs) == 0 {
+		return value, nil
+	}
+	seg, rest := segs[0], segs[1:]
+	if seg.isIdx {
+		if node == nil {
+			node = []any{} // Create the missing array.
+		}
+		arr, ok := node.([]any)
+		if !ok {
+			return nil, fmt.Errorf("json: %s is %T, not an array", where, node)
+		}
+		for len(arr) <= seg.index {
+			arr = append(arr, nil) // Pad up to the requested slot.
+		}
+		child, err := setPath(arr[seg.index], rest, value, where+seg.String())
+		if err != nil {
+			return nil, err
+		}
+		arr[seg.index] = child
+		return arr, nil
+	}
+
+	if node == nil {
+		node = map[string]any{} // Create the missing object.
+	}
+	obj, ok := node.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("json: %s is %T, not an object", where, node)
+	}
+	child, err := setPath(obj[seg.field], rest, value, where+seg.String())
+	if err != nil {
+		return nil, err
+	}
+	obj[seg.field] = child
+	return obj, nil
+}
+
+// JSONGet returns the value at path inside the document held at key. It
+// returns ErrNoPath if the key or any step of the path is missing, and a
+// descriptive error if the path walks through a value of the wrong kind.
+// Container results alias the stored document and must not be modified.
+func (db *DataBase) JSONGet(key, path string) (any, error) {
+	segs, err := parsePath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	db.lock.RLock()         // Acquire a read lock.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+
+	node, exists := db.lookup(key)
+	if !exists {
+		return nil, ErrNoPath
+	}
+	where := "$"
+	for _, seg := range segs {
+		switch n := node.(type) {
+		case []any:
+			if !seg.isIdx {
+				return nil, fmt.Errorf("json: %s is an array, not an object", where)
+			}
+			if seg.index >= len(n) {
+				return nil, ErrNoPath
+			}
+			node = n[seg.index]
+		case map[string]any:
+			if seg.isIdx {
+				return nil, fmt.Errorf("json: %s is an object, not an array", where)
+			}
+			child, ok := n[seg.field]
+			if !ok {
+				return nil, ErrNoPath
+			}
+			node = child
+		default:
+			return nil, fmt.Errorf("json: %s is %T, not a container", where, node)
+		}
+		where += seg.String()
+	}
+	return node, nil
+}
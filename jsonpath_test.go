@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJSONPathNested(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	if err := db.JSONSet("doc", "$.user.addresses[1].city", "Paris"); err != nil {
+		t.Fatalf("JSONSet of a deep path: %v", err)
+	}
+	if err := db.JSONSet("doc", "user.name", "ada"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.JSONSet("doc", "user.addresses[1].zip", 75001); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := db.JSONGet("doc", "$.user.addresses[1].city"); err != nil || got != "Paris" {
+		t.Errorf("JSONGet(city) = %v, %v; want Paris", got, err)
+	}
+	want := map[string]any{"user": map[string]any{
+		"name":      "ada",
+		"addresses": []any{nil, map[string]any{"city": "Paris", "zip": 75001}},
+	}}
+	if got, _ := db.JSONGet("doc", "$"); !reflect.DeepEqual(got, want) {
+		t.Errorf("document = %v, want %v", got, want)
+	}
+	if got, _ := db.JSONGet("doc", "user.addresses[0]"); got != nil {
+		t.Errorf("padding element = %v, want nil", got)
+	}
+
+	for _, path := range []string{"user.email", "user.addresses[5]", "other.x"} {
+		if _, err := db.JSONGet("doc", path); !errors.Is(err, ErrNoPath) {
+			t.Errorf("JSONGet(%s): %v, want ErrNoPath", path, err)
+		}
+	}
+	if _, err := db.JSONGet("missing", "$"); !errors.Is(err, ErrNoPath) {
+		t.Errorf("JSONGet of a missing key: %v, want ErrNoPath", err)
+	}
+	if _, err := db.JSONGet("doc", "user[0]"); err == nil || errors.Is(err, ErrNoPath) {
+		t.Errorf("JSONGet indexing an object: %v, want a kind error", err)
+	}
+	if err := db.JSONSet("doc", "user.name.first", "x"); err == nil || !strings.Contains(err.Error(), "$.user.name") {
+		t.Errorf("JSONSet through a string: %v, want an error naming $.user.name", err)
+	}
+	if _, err := db.JSONGet("doc", "a[x]"); err == nil {
+		t.Error("JSONGet with a bad index succeeded")
+	}
+
+	if err := db.JSONSet("doc", "$", []any{1}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := db.JSONGet("doc", "[0]"); got != 1 {
+		t.Errorf("after replacing the root: [0] = %v, want 1", got)
+	}
+}
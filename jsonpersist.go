@@ -0,0 +1,378 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// jsonSnapshotVersion is the format version written by PersistJSON.
+const jsonSnapshotVersion = 1
+
+// jsonSnapshot is the document written by PersistJSON.
+type jsonSnapshot struct {
+	Version int                   `json:"version"`
+	Keys    map[string]jsonRecord `json:"keys"`
+}
+
+// jsonRecord is one key of a JSON snapshot.
+type jsonRecord struct {
+	jsonEnvelope
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // Absent for keys without a TTL.
+}
+
+// jsonEnvelope wraps a value with the name of its type, so that LoadJSON can
+// rebuild the concrete type rather than what plain JSON decodes to. An empty
+// Type marks a value of an unknown type, stored as plain JSON.
+type jsonEnvelope struct {
+	Type  string          `json:"type,omitempty"`
+	Value json.RawMessage `json:"value"`
+}
+
+// jsonScalars are the built-in types an envelope records by their Go name.
+var jsonScalars = map[string]reflect.Type{}
+
+func init() {
+	for _, v := range []any{
+		"", []byte(nil), false,
+		int(0), int8(0), int16(0), int32(0), int64(0),
+		uint(0), uint8(0), uint16(0), uint32(0), uint64(0),
+		float32(0), float64(0),
+	} {
+		t := reflect.TypeOf(v)
+		jsonScalars[t.String()] = t
+	}
+}
+
+// jsonStreamEntry is a stream entry whose field values are enveloped.
+type jsonStreamEntry struct {
+	ID     StreamID
+	Fields map[string]jsonEnvelope
+}
+
+// jsonStream is the enveloped form of a *Stream.
+type jsonStream struct {
+	Entries []jsonStreamEntry
+	LastID  StreamID
+	Groups  map[string]*StreamGroup `json:",omitempty"`
+}
+
+// PersistJSON saves the database to fileName as an indented JSON document,
+// which is readable and diffable where the binary snapshot of Persist is
+// not. Every value is wrapped in an envelope naming its type, so LoadJSON
+// restores integers as the same integer type rather than float64, and the
+// store's lists, hashes, sets, sorted sets and streams, with the elements
+// they contain, as themselves. Values of a type named by RegisterType are
+// restored as that type too. Values of any other type are written as plain
+// JSON and come back as what encoding/json decodes them to, such as
+// map[string]any for a struct. TTLs are kept as absolute deadlines.
+//
+// Values that cannot be marshalled are skipped and reported in an
+// *UnencodableError, as in Persist. The file does not count as a save for
+// SaveEvery, which tracks the binary snapshot.
+func (db *DataBase) PersistJSON(fileName string) error {
+	err := db.persistJSON(fileName)
+	db.logSave(fileName, err)
+	return err
+}
+
+// persistJSON writes the JSON snapshot; PersistJSON wraps it with logging.
+func (db *DataBase) persistJSON(fileName string) error {
+	release, err := db.acquireSave(fileName) // One writer per file at a time.
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	snap, skipped := db.jsonDocument()
+	return db.writeDocument(fileName, skipped, func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(&snap)
+	})
+}
+
+// jsonDocument builds the document written by PersistJSON, returning with
+// it the keys whose values cannot be marshalled.
+func (db *DataBase) jsonDocument() (jsonSnapshot, []string) {
+	db.lock.RLock()         // Hold writers off while the values are marshalled.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+	snap := jsonSnapshot{Version: jsonSnapshotVersion, Keys: make(map[string]jsonRecord, db.data.len())}
+	var skipped []string
+	now := db.clock.Now()
+	for key, value := range db.data.all() {
+		if db.isExpired(key, now) {
+			continue // Dead keys awaiting removal are not saved.
+		}
+		env, err := toEnvelope(value)
+		if err != nil {
+			skipped = append(skipped, key)
+			continue
+		}
+		rec := jsonRecord{jsonEnvelope: env}
+		if deadline, ok := db.expires.get(key); ok {
+			rec.ExpiresAt = &deadline
+		}
+		snap.Keys[key] = rec
+	}
+	return snap, skipped
+}
+
+// writeDocument saves a snapshot document, written by encode, to fileName
+// through the backend, reporting the skipped keys in an *UnencodableError.
+func (db *DataBase) writeDocument(fileName string, skipped []string, encode func(w io.Writer) error) error {
+	file, err := db.backend.Save(fileName)
+	if err != nil {
+		return err
+	}
+	defer abortSave(file) // Keep the previous snapshot if writing fails.
+	if err := encode(file); err != nil {
+		return err
+	}
+	if err := syncFile(file); err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err // Closing commits the snapshot, so its error matters.
+	}
+	if len(skipped) > 0 {
+		sort.Strings(skipped)
+		return &UnencodableError{Keys: skipped}
+	}
+	return nil
+}
+
+// LoadJSON merges the keys of a snapshot written by PersistJSON into the
+// database, rebuilding each value's recorded type. Keys whose deadline has
+// passed are dropped. Nothing is loaded if any value fails to decode.
+func (db *DataBase) LoadJSON(fileName string) error {
+	file, err := db.backend.Load(fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close() // Ensure the file is closed after reading.
+
+	var snap jsonSnapshot
+	if err := json.NewDecoder(file).Decode(&snap); err != nil {
+		return fmt.Errorf("json snapshot: %w", err)
+	}
+	return db.loadDocument(fileName, "json", snap)
+}
+
+// loadDocument merges the keys of a decoded PersistJSON document, read
+// from fileName in format, into the database.
+func (db *DataBase) loadDocument(fileName, format string, snap jsonSnapshot) error {
+	if snap.Version < 1 || snap.Version > jsonSnapshotVersion {
+		return fmt.Errorf("%s snapshot: unsupported version %d", format, snap.Version)
+	}
+	loaded := make(map[string]snapshotEntry, len(snap.Keys))
+	for key, rec := range snap.Keys {
+		value, err := fromEnvelope(rec.jsonEnvelope)
+		if err != nil {
+			return fmt.Errorf("%s snapshot: key %q: %w", format, key, err)
+		}
+		entry := snapshotEntry{value: value}
+		if rec.ExpiresAt != nil {
+			entry.deadline = *rec.ExpiresAt
+		}
+		loaded[key] = entry
+	}
+	if err := db.merge(loaded); err != nil {
+		return err
+	}
+	db.logger.Info(format+" snapshot loaded", "file", fileName, "keys", len(loaded))
+	return nil
+}
+
+// toEnvelope wraps value, and the elements of any collection, with their
+// type names.
+func toEnvelope(value any) (jsonEnvelope, error) {
+	var typ string
+	payload := value
+	var err error
+	switch v := value.(type) {
+	case nil:
+		return jsonEnvelope{Value: json.RawMessage("null")}, nil
+	case List:
+		typ = "list"
+		payload, err = toEnvelopes(v)
+	case []any:
+		typ = "[]any"
+		payload, err = toEnvelopes(v)
+	case Hash:
+		typ = "hash"
+		payload, err = toEnvelopeMap(v)
+	case map[string]any:
+		typ = "map[string]any"
+		payload, err = toEnvelopeMap(v)
+	case Set:
+		typ, payload = "set", sortedMembers(v)
+	case *ZSet:
+		typ, payload = "zset", v.members()
+	case *Stream:
+		typ = "stream"
+		s := jsonStream{Entries: make([]jsonStreamEntry, len(v.Entries)), LastID: v.LastID, Groups: v.Groups}
+		for i, e := range v.Entries {
+			s.Entries[i].ID = e.ID
+			if s.Entries[i].Fields, err = toEnvelopeMap(e.Fields); err != nil {
+				break
+			}
+		}
+		payload = s
+	case *HyperLogLog:
+		typ, payload = "hyperloglog", v.Registers // Base64 in JSON.
+	default:
+		if name, ok := registeredName(value); ok {
+			typ = name
+		} else if _, ok := jsonScalars[reflect.TypeOf(value).String()]; ok {
+			typ = reflect.TypeOf(value).String()
+		}
+	}
+	if err != nil {
+		return jsonEnvelope{}, err
+	}
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return jsonEnvelope{}, err
+	}
+	return jsonEnvelope{Type: typ, Value: raw}, nil
+}
+
+// toEnvelopes wraps each element of a slice.
+func toEnvelopes(items []any) ([]jsonEnvelope, error) {
+	out := make([]jsonEnvelope, len(items))
+	for i, item := range items {
+		env, err := toEnvelope(item)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = env
+	}
+	return out, nil
+}
+
+// toEnvelopeMap wraps each value of a map.
+func toEnvelopeMap(m map[string]any) (map[string]jsonEnvelope, error) {
+	out := make(map[string]jsonEnvelope, len(m))
+	for k, item := range m {
+		env, err := toEnvelope(item)
+		if err != nil {
+			return nil, err
+		}
+		out[k] = env
+	}
+	return out, nil
+}
+
+// fromEnvelope rebuilds the value wrapped by toEnvelope.
+func fromEnvelope(env jsonEnvelope) (any, error) {
+	switch env.Type {
+	case "":
+		var v any // Unknown type: whatever plain JSON decodes to.
+		err := json.Unmarshal(env.Value, &v)
+		return v, err
+	case "list", "[]any":
+		var items []jsonEnvelope
+		if err := json.Unmarshal(env.Value, &items); err != nil {
+			return nil, err
+		}
+		out, err := fromEnvelopes(items)
+		if env.Type == "list" {
+			return List(out), err
+		}
+		return out, err
+	case "hash", "map[string]any":
+		var items map[string]jsonEnvelope
+		if err := json.Unmarshal(env.Value, &items); err != nil {
+			return nil, err
+		}
+		out, err := fromEnvelopeMap(items)
+		if env.Type == "hash" {
+			return Hash(out), err
+		}
+		return out, err
+	case "set":
+		var members []string
+		if err := json.Unmarshal(env.Value, &members); err != nil {
+			return nil, err
+		}
+		set := make(Set, len(members))
+		for _, m := range members {
+			set[m] = struct{}{}
+		}
+		return set, nil
+	case "zset":
+		var members []ZMember
+		if err := json.Unmarshal(env.Value, &members); err != nil {
+			return nil, err
+		}
+		z := newZSet()
+		for _, m := range members {
+			z.add(m.Member, m.Score)
+		}
+		return z, nil
+	case "hyperloglog":
+		h := &HyperLogLog{}
+		if err := json.Unmarshal(env.Value, &h.Registers); err != nil {
+			return nil, err
+		}
+		if !h.valid() {
+			return nil, fmt.Errorf("invalid %s registers", env.Type)
+		}
+		return h, nil
+	case "stream":
+		var js jsonStream
+		if err := json.Unmarshal(env.Value, &js); err != nil {
+			return nil, err
+		}
+		s := &Stream{Entries: make([]StreamEntry, len(js.Entries)), LastID: js.LastID, Groups: js.Groups}
+		for i, e := range js.Entries {
+			fields, err := fromEnvelopeMap(e.Fields)
+			if err != nil {
+				return nil, err
+			}
+			s.Entries[i] = StreamEntry{ID: e.ID, Fields: fields}
+		}
+		return s, nil
+	}
+	typ, ok := jsonScalars[env.Type]
+	if !ok {
+		if typ, ok = registeredType(env.Type); !ok {
+			return nil, fmt.Errorf("value of unregistered type %q", env.Type)
+		}
+	}
+	ptr := reflect.New(typ)
+	if err := json.Unmarshal(env.Value, ptr.Interface()); err != nil {
+		return nil, fmt.Errorf("type %q: %w", env.Type, err)
+	}
+	return ptr.Elem().Interface(), nil
+}
+
+// fromEnvelopes unwraps each element of a slice.
+func fromEnvelopes(items []jsonEnvelope) ([]any, error) {
+	out := make([]any, len(items))
+	for i, item := range items {
+		v, err := fromEnvelope(item)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+// fromEnvelopeMap unwraps each value of a map.
+func fromEnvelopeMap(items map[string]jsonEnvelope) (map[string]any, error) {
+	out := make(map[string]any, len(items))
+	for k, item := range items {
+		v, err := fromEnvelope(item)
+		if err != nil {
+			return nil, err
+		}
+		out[k] = v
+	}
+	return out, nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// unregistered is a struct no test registers, so JSON gives it back as a
+// plain map.
+type unregistered struct {
+	N int
+}
+
+func TestPersistJSONKeepsTypes(t *testing.T) {
+	const name = "test.JSONProfile"
+	t.Cleanup(func() { forgetType(name) })
+	RegisterType(name, oldProfile{})
+
+	db := NewDataBase()
+	defer db.Close()
+	want := map[string]any{
+		"int":     42,
+		"int64":   int64(-1 << 40),
+		"uint8":   uint8(255),
+		"float":   1.5,
+		"profile": oldProfile{"ada", 36},
+		"nested":  []any{1, "two", []any{int64(3), []any{uint16(4)}}},
+		"list":    List{int32(1), oldProfile{"bob", 7}},
+		"hash":    Hash{"age": 36, "tags": []any{"a", int8(-1)}},
+	}
+	for key, value := range want {
+		db.Set(key, value)
+	}
+	db.Set("other", unregistered{N: 5})
+	db.SetWithTTL("ttl", 7, time.Hour)
+	fileName := filepath.Join(t.TempDir(), "database.json")
+	if err := db.PersistJSON(fileName); err != nil {
+		t.Fatalf("PersistJSON: %v", err)
+	}
+
+	loaded := NewDataBase()
+	defer loaded.Close()
+	if err := loaded.LoadJSON(fileName); err != nil {
+		t.Fatalf("LoadJSON: %v", err)
+	}
+	for key, value := range want {
+		if got, _ := loaded.Get(key); !reflect.DeepEqual(got, value) {
+			t.Errorf("%s = %#v, want %#v", key, got, value)
+		}
+	}
+	if got, _ := loaded.Get("other"); !reflect.DeepEqual(got, map[string]any{"N": float64(5)}) {
+		t.Errorf("unregistered struct = %#v, want the plain JSON map", got)
+	}
+	if ttl := loaded.TTL("ttl"); ttl <= 0 || ttl > time.Hour {
+		t.Errorf("TTL(ttl) = %v, want up to an hour", ttl)
+	}
+}
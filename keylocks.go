@@ -0,0 +1,83 @@
+package main
+
+import (
+	"sort"
+	"sync"
+)
+
+// keyLock is a reference-counted mutex guarding a single key.
+type keyLock struct {
+	mu   sync.Mutex // Serializes WithKeys callers on this key.
+	refs int        // Number of callers holding or waiting for the lock.
+}
+
+// WithKeys runs fn while holding exclusive per-key locks on the given keys.
+// Only callers of WithKeys that share a key are serialized; operations on
+// other keys, and plain Get/Set calls, keep running concurrently. The locks
+// are advisory: fn should use the regular methods to read and write the keys.
+//
+// To avoid deadlock, the keys are de-duplicated and locked in ascending
+// lexical order, so two callers with overlapping key sets always acquire
+// their common keys in the same sequence and can never wait on each other
+// in a cycle. The locks are released in reverse order once fn returns.
+func (db *DataBase) WithKeys(keys []string, fn func()) {
+	ordered := append([]string(nil), keys...) // Copy so the caller's slice is untouched.
+	sort.Strings(ordered)                     // A global order prevents lock cycles.
+	ordered = dedupSorted(ordered)            // Locking a key twice would self-deadlock.
+
+	locks := make([]*keyLock, len(ordered))
+	for i, key := range ordered {
+		locks[i] = db.acquireKeyLock(key) // Blocks until the key is ours.
+	}
+	defer func() {
+		for i := len(ordered) - 1; i >= 0; i-- {
+			db.releaseKeyLock(ordered[i], locks[i]) // Release in reverse order.
+		}
+	}()
+
+	fn() // Run the caller's compound operation.
+}
+
+// acquireKeyLock registers interest in a key's lock and then locks it.
+func (db *DataBase) acquireKeyLock(key string) *keyLock {
+	db.keyLocksMu.Lock() // Protect the lock table.
+	if db.keyLocks == nil {
+		db.keyLocks = make(map[string]*keyLock) // Created lazily on first use.
+	}
+	kl, ok := db.keyLocks[key]
+	if !ok {
+		kl = &keyLock{} // First caller for this key.
+		db.keyLocks[key] = kl
+	}
+	kl.refs++ // Keep the entry alive while we wait.
+	db.keyLocksMu.Unlock()
+
+	kl.mu.Lock() // Wait for exclusive access outside the table lock.
+	return kl
+}
+
+// releaseKeyLock unlocks a key and drops its table entry once unused.
+func (db *DataBase) releaseKeyLock(key string, kl *keyLock) {
+	kl.mu.Unlock() // Let the next waiter in.
+
+	db.keyLocksMu.Lock()
+	defer db.keyLocksMu.Unlock()
+	kl.refs--
+	if kl.refs == 0 {
+		delete(db.keyLocks, key) // Nobody else needs it; keep the table small.
+	}
+}
+
+// dedupSorted removes adjacent duplicates from a sorted slice in place.
+func dedupSorted(keys []string) []string {
+	if len(keys) == 0 {
+		return keys
+	}
+	out := keys[:1]
+	for _, key := range keys[1:] {
+		if key != out[len(out)-1] {
+			out = append(out, key) // Keep only the first of each run.
+		}
+	}
+	return out
+}
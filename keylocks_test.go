@@ -0,0 +1,62 @@
+package main
+
+import (
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestWithKeysOverlappingStress(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	keys := []string{"a", "b", "c", "d", "e"}
+	for _, key := range keys {
+		db.Set(key, int64(0))
+	}
+	const workers, rounds = 8, 200
+	var wg sync.WaitGroup
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range rounds {
+				// Overlapping sets in varying orders, with a duplicate, so any
+				// missing ordering or de-duplication would deadlock.
+				set := []string{keys[(w+i)%5], keys[(w+i+2)%5], keys[(w+i)%5]}
+				if w%2 == 1 {
+					set[0], set[1] = set[1], set[0]
+				}
+				db.WithKeys(set, func() {
+					for _, key := range slices.Compact(slices.Sorted(slices.Values(set))) {
+						value, _ := db.Get(key)
+						db.Set(key, value.(int64)+1) // A lost update shows up in the total.
+					}
+				})
+			}
+		}()
+	}
+	wg.Wait()
+	var total int64
+	for _, key := range keys {
+		value, _ := db.Get(key)
+		total += value.(int64)
+	}
+	if want := int64(workers * rounds * 2); total != want {
+		t.Errorf("total of the counters = %d, want %d", total, want)
+	}
+	if n := len(db.keyLocks); n != 0 {
+		t.Errorf("%d key locks left in the table", n)
+	}
+}
+
+func TestDedupSorted(t *testing.T) {
+	for _, tc := range [][2][]string{
+		{nil, nil},
+		{{"a"}, {"a"}},
+		{{"a", "a", "b", "c", "c", "c"}, {"a", "b", "c"}},
+	} {
+		if got := dedupSorted(tc[0]); !slices.Equal(got, tc[1]) {
+			t.Errorf("dedupSorted(%q) = %q, want %q", tc[0], got, tc[1])
+		}
+	}
+}
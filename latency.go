@@ -0,0 +1,98 @@
+package main
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// latencyBounds are the inclusive upper bounds of the histogram buckets.
+// A final, implicit bucket collects everything slower than the last bound.
+var latencyBounds = []time.Duration{
+	time.Microsecond,
+	10 * time.Microsecond,
+	100 * time.Microsecond,
+	time.Millisecond,
+	10 * time.Millisecond,
+	100 * time.Millisecond,
+	time.Second,
+}
+
+// Histogram is a point-in-time copy of the latency distribution of one method.
+type Histogram struct {
+	Bounds []time.Duration // Upper bound of each bucket except the last.
+	Counts []uint64        // Calls per bucket; len(Counts) == len(Bounds)+1.
+	Count  uint64          // Total number of recorded calls.
+	Total  time.Duration   // Sum of all recorded durations.
+}
+
+// latencyRecorder accumulates durations for one method using atomics, so
+// recording never takes the database lock.
+type latencyRecorder struct {
+	counts [8]atomic.Uint64 // One counter per bucket, the last is overflow.
+	total  atomic.Int64     // Sum of durations in nanoseconds.
+}
+
+// observe records the time elapsed since start. time.Since uses the monotonic
+// clock reading captured by time.Now, so wall-clock jumps do not skew it.
+func (r *latencyRecorder) observe(start time.Time) {
+	d := time.Since(start)
+	bucket := len(latencyBounds) // Overflow bucket unless a bound fits.
+	for i, bound := range latencyBounds {
+		if d <= bound {
+			bucket = i
+			break
+		}
+	}
+	r.counts[bucket].Add(1)
+	r.total.Add(int64(d))
+}
+
+// snapshot copies the recorder into an immutable Histogram.
+func (r *latencyRecorder) snapshot() Histogram {
+	h := Histogram{
+		Bounds: append([]time.Duration(nil), latencyBounds...),
+		Counts: make([]uint64, len(latencyBounds)+1),
+		Total:  time.Duration(r.total.Load()),
+	}
+	for i := range h.Counts {
+		h.Counts[i] = r.counts[i].Load()
+		h.Count += h.Counts[i]
+	}
+	return h
+}
+
+// latencyTracker holds one recorder per instrumented method.
+type latencyTracker map[string]*latencyRecorder
+
+// newLatencyTracker creates recorders for the instrumented methods. The map is
+// never modified afterwards, so it is safe to read without locking.
+func newLatencyTracker() latencyTracker {
+	return latencyTracker{
+		"Get":     {},
+		"Set":     {},
+		"Persist": {},
+		"Load":    {},
+	}
+}
+
+// WithLatencyTracking records the duration of every Get, Set, Persist and
+// Load call into per-method histograms readable through LatencyStats. It is
+// off by default because timing each call adds a small overhead.
+func WithLatencyTracking() Option {
+	return func(db *DataBase) {
+		db.latency = newLatencyTracker()
+	}
+}
+
+// LatencyStats returns a copy of the latency histogram of each instrumented
+// method, or nil if latency tracking is disabled.
+func (db *DataBase) LatencyStats() map[string]Histogram {
+	if db.latency == nil {
+		return nil
+	}
+	stats := make(map[string]Histogram, len(db.latency))
+	for method, recorder := range db.latency {
+		stats[method] = recorder.snapshot()
+	}
+	return stats
+}
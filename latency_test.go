@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLatencySlowSetLandsHigh(t *testing.T) {
+	db := NewDataBase(WithLatencyTracking())
+	defer db.Close()
+	db.Get("missing")
+
+	db.lock.Lock() // Make the Set wait for the lock.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		db.Set("k", "v")
+	}()
+	time.Sleep(20 * time.Millisecond)
+	db.lock.Unlock()
+	<-done
+
+	stats := db.LatencyStats()
+	set := stats["Set"]
+	if set.Count != 1 || set.Total < 20*time.Millisecond {
+		t.Fatalf("Set histogram = %+v, want one call of at least 20ms", set)
+	}
+	for i, bound := range set.Bounds {
+		if bound < 20*time.Millisecond && set.Counts[i] != 0 {
+			t.Errorf("the slow Set landed in the %v bucket", bound)
+		}
+	}
+	if stats["Get"].Count != 1 {
+		t.Errorf("Get histogram counted %d calls, want 1", stats["Get"].Count)
+	}
+	if len(set.Counts) != len(set.Bounds)+1 {
+		t.Errorf("%d counts for %d bounds, want one more for the overflow", len(set.Counts), len(set.Bounds))
+	}
+}
+
+func TestLatencyStatsDisabled(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	db.Set("k", "v")
+	if stats := db.LatencyStats(); stats != nil {
+		t.Errorf("LatencyStats without tracking = %v, want nil", stats)
+	}
+}
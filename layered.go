@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// LayerError is returned by LoadLayered when a file fails to load.
+type LayerError struct {
+	File   string   // The file that failed.
+	Loaded []string // The files before it, which were loaded.
+	Err    error
+}
+
+// Error implements the error interface.
+func (e *LayerError) Error() string {
+	loaded := "none"
+	if len(e.Loaded) > 0 {
+		loaded = strings.Join(e.Loaded, ", ")
+	}
+	return fmt.Sprintf("load layer %s: %v (loaded: %s)", e.File, e.Err, loaded)
+}
+
+// Unwrap returns the load error, such as ErrChecksumMismatch.
+func (e *LayerError) Unwrap() error {
+	return e.Err
+}
+
+// LoadLayered loads each snapshot in files in order, like Load, so a base
+// snapshot can be overlaid with newer incremental ones: keys in later files
+// replace the same keys from earlier files, and other keys are merged in.
+// It stops at the first file that fails to load, for example because it is
+// corrupt, returning a *LayerError that names it and the files already
+// loaded, which stay applied. The failing file changes nothing, as Load
+// decodes a whole snapshot before applying it.
+func (db *DataBase) LoadLayered(files ...string) error {
+	for i, file := range files {
+		if err := db.Load(file); err != nil {
+			return &LayerError{File: file, Loaded: files[:i:i], Err: err}
+		}
+	}
+	return nil
+}
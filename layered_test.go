@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestLoadLayered(t *testing.T) {
+	dir := t.TempDir()
+	save := func(name string, pairs map[string]any) string {
+		t.Helper()
+		db := NewDataBase()
+		defer db.Close()
+		for key, value := range pairs {
+			db.Set(key, value)
+		}
+		fileName := filepath.Join(dir, name)
+		if err := db.Persist(fileName); err != nil {
+			t.Fatal(err)
+		}
+		return fileName
+	}
+	base := save("base.gob", map[string]any{"a": 1, "b": 2, "c": 3})
+	delta := save("delta.gob", map[string]any{"b": 20, "d": 4})
+
+	db := NewDataBase()
+	defer db.Close()
+	if err := db.LoadLayered(base, delta); err != nil {
+		t.Fatalf("LoadLayered: %v", err)
+	}
+	for key, want := range map[string]any{"a": 1, "b": 20, "c": 3, "d": 4} {
+		if got, _ := db.Get(key); got != want {
+			t.Errorf("%s = %v, want %v: the delta wins over the base", key, got, want)
+		}
+	}
+
+	data, err := os.ReadFile(delta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)/2] ^= 0xFF
+	corrupt := filepath.Join(dir, "corrupt.gob")
+	if err := os.WriteFile(corrupt, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fresh := NewDataBase()
+	defer fresh.Close()
+	err = fresh.LoadLayered(base, corrupt, delta)
+	var layer *LayerError
+	if !errors.As(err, &layer) || layer.File != corrupt || !slices.Equal(layer.Loaded, []string{base}) {
+		t.Fatalf("LoadLayered with a corrupt layer: %v, want a *LayerError naming it after the base", err)
+	}
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("LoadLayered with a corrupt layer: %v, want it to wrap ErrChecksumMismatch", err)
+	}
+	if keys := fresh.Keys("*"); !slices.Equal(keys, []string{"a", "b", "c"}) {
+		t.Errorf("keys after the failed layer = %q, want the base's alone", keys)
+	}
+	if got, _ := fresh.Get("b"); got != 2 {
+		t.Errorf("b = %v, want the base's 2: the corrupt layer changed nothing", got)
+	}
+
+	err = fresh.LoadLayered(filepath.Join(dir, "missing.gob"))
+	if !errors.As(err, &layer) || len(layer.Loaded) != 0 || !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("LoadLayered of a missing file: %v, want a *LayerError wrapping fs.ErrNotExist", err)
+	}
+}
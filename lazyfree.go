@@ -0,0 +1,80 @@
+package main
+
+// lazyFreeThreshold is the element count above which Unlink hands a value
+// to the background freer instead of dropping it inline, as Redis does.
+const lazyFreeThreshold = 64
+
+// lazyFreeBacklog bounds the values queued for the background freer.
+const lazyFreeBacklog = 128
+
+// startLazyFree launches the goroutine that releases values unlinked by
+// Unlink. It stops when Close is called.
+func (db *DataBase) startLazyFree() {
+	db.spawn(func() {
+		for {
+			select {
+			case <-db.lazyFree:
+				// Receiving drops the last reference, so the value becomes
+				// garbage here rather than on the goroutine holding the lock.
+			case <-db.stop:
+				return // Close was called; anything queued is left to the GC.
+			}
+		}
+	})
+}
+
+// Unlink removes the given keys like Delete and returns how many existed,
+// but keeps the write lock only for the map removals: values holding more
+// than lazyFreeThreshold elements are handed to a background goroutine to be
+// released, so the garbage they leave behind is not reclaimed while other
+// callers wait on the lock. Small and scalar values are dropped inline, and
+// if the freer is backed up a value is dropped inline too rather than
+// blocking.
+func (db *DataBase) Unlink(keys ...string) int {
+	db.lock.Lock()    // Acquire a write lock.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	if db.readOnly {
+		return 0
+	}
+	removed := 0
+	for _, key := range keys {
+		if db.expireIfNeeded(key) {
+			continue // It expired just now; that is not a deletion.
+		}
+		value, exists := db.data.get(key)
+		if !exists {
+			continue
+		}
+		db.removeKey(key)
+		removed++
+		if elements(value) > lazyFreeThreshold {
+			select {
+			case db.lazyFree <- value: // Released in the background.
+			default: // The freer is busy; let the GC have it directly.
+			}
+		}
+	}
+	return removed
+}
+
+// elements returns how many elements a collection value holds, or 1 for a
+// scalar.
+func elements(value any) int {
+	switch v := value.(type) {
+	case List:
+		return len(v)
+	case Hash:
+		return len(v)
+	case Set:
+		return len(v)
+	case *ZSet:
+		return v.Len()
+	case *Stream:
+		return len(v.Entries)
+	case map[string]any:
+		return len(v)
+	case []any:
+		return len(v)
+	}
+	return 1
+}
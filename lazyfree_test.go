@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestUnlinkRemovesPromptly(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1_000_000, 0))
+	db := NewDataBase(WithClock(clock))
+	defer db.Close()
+	big := make([]any, 10*lazyFreeThreshold)
+	for i := range big {
+		db.SAdd("bigset", fmt.Sprint(i))
+		big[i] = i
+	}
+	db.RPush("biglist", big...)
+	db.Set("small", "v")
+	db.SetWithTTL("lapsed", "v", time.Second)
+	clock.Advance(time.Second)
+
+	if n := db.Unlink("bigset", "biglist", "small", "lapsed", "missing"); n != 3 {
+		t.Errorf("Unlink = %d, want the 3 live keys", n)
+	}
+	for _, key := range []string{"bigset", "biglist", "small"} { // Gone on return, not later.
+		if _, ok := db.Get(key); ok {
+			t.Errorf("%s is still readable after Unlink", key)
+		}
+	}
+	if n := len(db.Keys("*")); n != 0 {
+		t.Errorf("%d keys left", n)
+	}
+	if elements(List(big)) != len(big) || elements("scalar") != 1 {
+		t.Error("elements miscounts")
+	}
+}
+
+func TestUnlinkWithBusyFreer(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	big := make(List, 2*lazyFreeThreshold)
+	for i := range lazyFreeBacklog + 10 { // More than the freer can queue.
+		db.Set(fmt.Sprintf("list%d", i), append(List(nil), big...))
+	}
+	keys := db.Keys("*")
+	done := make(chan int)
+	go func() { done <- db.Unlink(keys...) }()
+	select {
+	case n := <-done:
+		if n != len(keys) {
+			t.Errorf("Unlink = %d, want %d", n, len(keys))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Unlink blocked on a full freer")
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// LFU counter parameters, the Redis defaults.
+const (
+	lfuInitValue    = 5           // Counter of a new key, so it is not evicted at once.
+	lfuLogFactor    = 10          // How much slower each counter increase gets.
+	defaultLFUDecay = time.Minute // Idle time that takes one off a counter.
+)
+
+// lfuTracker holds a logarithmic access counter per key, as Redis does for
+// its LFU policies. Reads update it under the shared read lock, so it has
+// its own mutex.
+type lfuTracker struct {
+	mu       sync.Mutex
+	decay    time.Duration          // Idle time per counter decrement.
+	counters map[string]*lfuCounter // Counter by key.
+}
+
+// lfuCounter is one key's access frequency.
+type lfuCounter struct {
+	freq uint8     // Logarithmic access count, saturating at 255.
+	last time.Time // When the counter was last brought up to date.
+}
+
+// WithLFUTracking keeps a Redis-style logarithmic access counter per key,
+// enabling AccessFrequency. A counter rises quickly for the first accesses
+// and ever more slowly after that, so 255 stands for about a million
+// accesses, and it drops by one for every decay interval in which the key
+// was not accessed, so keys that were popular once lose their standing. A
+// non-positive decay uses the Redis default of one minute. Each access then
+// also takes a short, shared mutex, so it is off by default.
+func WithLFUTracking(decay time.Duration) Option {
+	return func(db *DataBase) {
+		if decay <= 0 {
+			decay = defaultLFUDecay
+		}
+		db.lfu = &lfuTracker{decay: decay, counters: make(map[string]*lfuCounter)}
+	}
+}
+
+// AccessFrequency returns the access counter of key, like Redis OBJECT
+// FREQ, with any decay due applied; reading it does not count as an access.
+// It reports false if the key does not exist or LFU tracking is off (see
+// WithLFUTracking).
+func (db *DataBase) AccessFrequency(key string) (uint8, bool) {
+	db.lock.RLock()         // Acquire a read lock.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+	if db.lfu == nil {
+		return 0, false
+	}
+	if _, exists := db.data.get(key); !exists || db.isExpired(key, db.clock.Now()) {
+		return 0, false
+	}
+	return db.lfu.frequency(key, db.clock.Now()), true
+}
+
+// hit counts one access to key: the counter is decayed for the time the key
+// sat idle and then incremented with a probability that falls as it grows.
+// A key seen for the first time starts at lfuInitValue.
+func (t *lfuTracker) hit(key string, now time.Time, rng *lockedRand) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c := t.counters[key]
+	if c == nil {
+		t.counters[key] = &lfuCounter{freq: lfuInitValue, last: now}
+		return
+	}
+	c.freq = t.decayed(c, now)
+	c.last = now
+	if c.freq == 255 {
+		return // Saturated.
+	}
+	base := max(float64(c.freq)-lfuInitValue, 0)
+	if rng.float64() < 1/(base*lfuLogFactor+1) {
+		c.freq++
+	}
+}
+
+// frequency returns the decayed counter of key without counting an access.
+func (t *lfuTracker) frequency(key string, now time.Time) uint8 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c := t.counters[key]
+	if c == nil {
+		return 0
+	}
+	return t.decayed(c, now)
+}
+
+// decayed returns c's counter less one for each decay interval since it
+// was last updated. The caller must hold t.mu.
+func (t *lfuTracker) decayed(c *lfuCounter, now time.Time) uint8 {
+	periods := now.Sub(c.last) / t.decay
+	if periods >= time.Duration(c.freq) {
+		return 0
+	}
+	return c.freq - uint8(max(periods, 0))
+}
+
+// forget drops a removed key.
+func (t *lfuTracker) forget(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.counters, key)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAccessFrequencyRisesAndDecays(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1_000_000, 0))
+	db := NewDataBase(WithClock(clock), WithLFUTracking(time.Minute))
+	defer db.Close()
+	db.Set("hot", "v")
+	db.Set("cold", "v")
+	start, ok := db.AccessFrequency("hot")
+	if !ok || start != lfuInitValue {
+		t.Fatalf("AccessFrequency of a new key = %d, %v; want %d", start, ok, lfuInitValue)
+	}
+
+	for range 1000 {
+		db.Get("hot")
+	}
+	hot, _ := db.AccessFrequency("hot")
+	if hot < lfuInitValue+5 {
+		t.Errorf("AccessFrequency after 1000 reads = %d, want well above %d", hot, lfuInitValue)
+	}
+	if again, _ := db.AccessFrequency("hot"); again != hot {
+		t.Errorf("AccessFrequency read twice = %d then %d: reading it counted as an access", hot, again)
+	}
+	if cold, _ := db.AccessFrequency("cold"); cold != lfuInitValue {
+		t.Errorf("AccessFrequency of an unread key = %d, want %d", cold, lfuInitValue)
+	}
+
+	clock.Advance(3*time.Minute + time.Second)
+	if decayed, _ := db.AccessFrequency("hot"); decayed != hot-3 {
+		t.Errorf("AccessFrequency after three idle minutes = %d, want %d", decayed, hot-3)
+	}
+	clock.Advance(time.Duration(255) * time.Minute)
+	if decayed, ok := db.AccessFrequency("hot"); !ok || decayed != 0 {
+		t.Errorf("AccessFrequency after a long idle spell = %d, %v; want 0", decayed, ok)
+	}
+	db.Get("hot")
+	if revived, _ := db.AccessFrequency("hot"); revived != 1 {
+		t.Errorf("AccessFrequency after one more read = %d, want 1: the first increment is certain", revived)
+	}
+
+	if _, ok := db.AccessFrequency("missing"); ok {
+		t.Error("AccessFrequency of a missing key reported ok")
+	}
+	off := NewDataBase()
+	defer off.Close()
+	off.Set("k", "v")
+	if _, ok := off.AccessFrequency("k"); ok {
+		t.Error("AccessFrequency without WithLFUTracking reported ok")
+	}
+}
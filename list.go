@@ -0,0 +1,352 @@
+package main
+
+import (
+	"encoding/gob"
+	"errors"
+	"reflect"
+)
+
+// ErrZeroStep is returned by LRangeStep when step is zero.
+var ErrZeroStep = errors.New("ERR step can't be zero")
+
+// List is the value stored under a key holding a Redis-style list.
+type List []any
+
+func init() {
+	gob.Register(List{}) // Allow lists to be persisted inside the any-typed map.
+}
+
+// listAt returns the list stored at key, or nil if the key is absent.
+// It returns ErrWrongType if the key holds a non-list value.
+// The caller must hold the lock.
+func (db *DataBase) listAt(key string) (List, error) {
+	value, exists := db.lookup(key)
+	if !exists {
+		return nil, nil // Absent keys behave like empty lists.
+	}
+	list, ok := value.(List)
+	if !ok {
+		return nil, ErrWrongType
+	}
+	return list, nil
+}
+
+// storeList writes a list back to key, deleting the key if the list is empty
+// as Redis does. The caller must hold the write lock.
+func (db *DataBase) storeList(key string, list List) {
+	if len(list) == 0 {
+		db.removeKey(key)
+		return
+	}
+	db.data.set(key, list)
+	db.touch(key)
+}
+
+// listRange converts Redis-style inclusive start/stop indexes, where negative
+// values count from the tail, into a half-open [lo, hi) slice range over a
+// list of length n. An empty range yields lo == hi.
+func listRange(start, stop, n int) (lo, hi int) {
+	if start < 0 {
+		start += n // -1 is the last element.
+	}
+	if stop < 0 {
+		stop += n
+	}
+	if start < 0 {
+		start = 0 // Clamp to the head.
+	}
+	if stop >= n {
+		stop = n - 1 // Clamp to the tail.
+	}
+	if start > stop {
+		return 0, 0 // Nothing selected.
+	}
+	return start, stop + 1
+}
+
+// RPush appends values to the tail of the list at key, creating it if needed.
+// Returns the new length of the list.
+func (db *DataBase) RPush(key string, values ...any) (int, error) {
+	db.lock.Lock()    // Acquire a write lock.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	if db.readOnly {
+		return 0, ErrReadOnly
+	}
+	db.expireIfNeeded(key)
+	if err := db.checkGrowth(); err != nil {
+		return 0, err
+	}
+
+	list, err := db.listAt(key)
+	if err != nil {
+		return 0, err
+	}
+	list = append(list, values...)
+	db.storeList(key, list)
+	return len(list), nil
+}
+
+// LPush prepends values to the head of the list at key, creating it if
+// needed. As in Redis, each value is pushed in turn, so LPush(key, a, b, c)
+// leaves c at the head. Returns the new length of the list.
+func (db *DataBase) LPush(key string, values ...any) (int, error) {
+	db.lock.Lock()    // Acquire a write lock.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	if db.readOnly {
+		return 0, ErrReadOnly
+	}
+	db.expireIfNeeded(key)
+	if err := db.checkGrowth(); err != nil {
+		return 0, err
+	}
+
+	list, err := db.listAt(key)
+	if err != nil {
+		return 0, err
+	}
+	pushed := make(List, 0, len(values)+len(list))
+	for i := len(values) - 1; i >= 0; i-- {
+		pushed = append(pushed, values[i]) // The last value ends up at the head.
+	}
+	pushed = append(pushed, list...)
+	db.storeList(key, pushed)
+	return len(pushed), nil
+}
+
+// LPop removes and returns the head of the list at key, or false if the key
+// is absent. Popping the last element deletes the key.
+func (db *DataBase) LPop(key string) (any, bool, error) {
+	return db.pop(key, true)
+}
+
+// RPop removes and returns the tail of the list at key, or false if the key
+// is absent. Popping the last element deletes the key.
+func (db *DataBase) RPop(key string) (any, bool, error) {
+	return db.pop(key, false)
+}
+
+// pop implements LPop and RPop.
+func (db *DataBase) pop(key string, left bool) (any, bool, error) {
+	db.lock.Lock()    // Acquire a write lock.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	if db.readOnly {
+		return nil, false, ErrReadOnly
+	}
+	return db.popLocked(key, left)
+}
+
+// popLocked implements pop. The caller must hold the write lock.
+func (db *DataBase) popLocked(key string, left bool) (any, bool, error) {
+	db.expireIfNeeded(key)
+	list, err := db.listAt(key)
+	if err != nil || len(list) == 0 {
+		return nil, false, err
+	}
+	var elem any
+	if left {
+		elem, list = list[0], list[1:]
+	} else {
+		n := len(list) - 1
+		elem, list = list[n], list[:n:n] // Cap the slice so a later push cannot overwrite a snapshot's tail.
+	}
+	db.storeList(key, list)
+	return elem, true, nil
+}
+
+// LLen returns the length of the list at key, or 0 if the key does not
+// exist.
+func (db *DataBase) LLen(key string) (int, error) {
+	db.lock.RLock()         // Acquire a read lock.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+
+	list, err := db.listAt(key)
+	if err != nil {
+		return 0, err
+	}
+	return len(list), nil
+}
+
+// LRange returns a copy of the elements between start and stop, inclusive.
+// Negative indexes count from the tail, so LRange(key, 0, -1) is the whole list.
+func (db *DataBase) LRange(key string, start, stop int) ([]any, error) {
+	db.lock.RLock()         // Acquire a read lock.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+
+	list, err := db.listAt(key)
+	if err != nil {
+		return nil, err
+	}
+	lo, hi := listRange(start, stop, len(list))
+	return append([]any(nil), list[lo:hi]...), nil // Copy so callers cannot alias the store.
+}
+
+// LRangeStep returns a copy of every step-th element from start to stop,
+// inclusive, like a Python slice with an inclusive end, so a large list can
+// be sampled without fetching it all. Negative indexes count from the tail.
+// A positive step walks towards the tail and needs start <= stop; a negative
+// step walks towards the head and needs start >= stop, so
+// LRangeStep(key, -1, 0, -1) is the whole list reversed. Out-of-range
+// indexes are clamped to the list, as in LRange. A step of zero returns
+// ErrZeroStep.
+func (db *DataBase) LRangeStep(key string, start, stop, step int) ([]any, error) {
+	if step == 0 {
+		return nil, ErrZeroStep
+	}
+	db.lock.RLock()         // Acquire a read lock.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+
+	list, err := db.listAt(key)
+	if err != nil {
+		return nil, err
+	}
+	if step > 0 {
+		lo, hi := listRange(start, stop, len(list))
+		out := make([]any, 0, (hi-lo+step-1)/step)
+		for i := lo; i < hi; i += step {
+			out = append(out, list[i])
+		}
+		return out, nil
+	}
+	lo, hi := listRange(stop, start, len(list)) // The same range, walked backwards.
+	out := make([]any, 0, (hi-lo-step-1)/-step)
+	for i := hi - 1; i >= lo; i += step {
+		out = append(out, list[i])
+	}
+	return out, nil
+}
+
+// LTrim keeps only the elements between start and stop, inclusive, with the
+// same index rules as LRange. Trimming everything deletes the key.
+func (db *DataBase) LTrim(key string, start, stop int) error {
+	db.lock.Lock()    // Acquire a write lock.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	if db.readOnly {
+		return ErrReadOnly
+	}
+	db.expireIfNeeded(key)
+
+	list, err := db.listAt(key)
+	if err != nil {
+		return err
+	}
+	lo, hi := listRange(start, stop, len(list))
+	db.storeList(key, append(List(nil), list[lo:hi]...)) // Copy to release the trimmed backing array.
+	return nil
+}
+
+// RPushCapped appends values to the list at key and then drops elements from
+// the head so the list never holds more than maxLen entries, giving fixed-size
+// ring buffer semantics (RPUSH followed by LTRIM key -maxLen -1). Both steps
+// happen under one write lock. Returns the resulting length of the list.
+func (db *DataBase) RPushCapped(key string, maxLen int, values ...any) (int, error) {
+	db.lock.Lock()    // Acquire a write lock for the push and trim.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	if db.readOnly {
+		return 0, ErrReadOnly
+	}
+	db.expireIfNeeded(key)
+	if err := db.checkGrowth(); err != nil {
+		return 0, err
+	}
+
+	list, err := db.listAt(key)
+	if err != nil {
+		return 0, err
+	}
+	list = append(list, values...)
+	if maxLen < 0 {
+		maxLen = 0
+	}
+	if over := len(list) - maxLen; over > 0 {
+		list = append(List(nil), list[over:]...) // Drop the oldest elements.
+	}
+	db.storeList(key, list)
+	return len(list), nil
+}
+
+// LMove atomically pops an element from the head (fromLeft) or tail of the
+// list at src and pushes it onto the head (toLeft) or tail of the list at dst,
+// like Redis LMOVE, so a worker can claim a job into an in-flight list without
+// a window in which the job is in neither. It returns the moved element and
+// true, or false if src is empty or missing. When src and dst are the same
+// key the list is rotated. Both keys are checked for the list type before
+// anything changes.
+func (db *DataBase) LMove(src, dst string, fromLeft, toLeft bool) (any, bool, error) {
+	db.lock.Lock()    // Acquire a write lock for the pop and the push.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	if db.readOnly {
+		return nil, false, ErrReadOnly
+	}
+	db.expireIfNeeded(src)
+	db.expireIfNeeded(dst)
+
+	from, err := db.listAt(src)
+	if err != nil {
+		return nil, false, err
+	}
+	to, err := db.listAt(dst)
+	if err != nil {
+		return nil, false, err // Fail before touching src.
+	}
+	if len(from) == 0 {
+		return nil, false, nil // Nothing to move.
+	}
+
+	var elem any
+	if fromLeft {
+		elem, from = from[0], from[1:]
+	} else {
+		elem, from = from[len(from)-1], from[:len(from)-1]
+	}
+	if src == dst {
+		to = from // Rotate within the one list.
+	} else {
+		db.storeList(src, from)
+	}
+	if toLeft {
+		to = append(List{elem}, to...)
+	} else {
+		to = append(to, elem)
+	}
+	db.storeList(dst, to)
+	return elem, true, nil
+}
+
+// LPos returns the indexes of elements of the list at key equal to value,
+// compared with reflect.DeepEqual, like Redis LPOS. rank picks the match to
+// start from: 1 (or 0) is the first match from the head, 2 the second, and
+// negative ranks count matches from the tail, so -1 is the last match; the
+// indexes are always counted from the head but are returned in search order.
+// count limits how many indexes are returned, with 0 meaning all. A missing
+// key or no match yields an empty slice.
+func (db *DataBase) LPos(key string, value any, rank, count int) ([]int, error) {
+	db.lock.RLock()         // Acquire a read lock.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+
+	list, err := db.listAt(key)
+	if err != nil {
+		return nil, err
+	}
+	if rank == 0 {
+		rank = 1
+	}
+	step, i := 1, 0
+	if rank < 0 {
+		step, i, rank = -1, len(list)-1, -rank // Search from the tail.
+	}
+	positions := []int{}
+	for ; i >= 0 && i < len(list); i += step {
+		if !reflect.DeepEqual(list[i], value) {
+			continue
+		}
+		if rank > 1 {
+			rank-- // Skip matches before the requested rank.
+			continue
+		}
+		positions = append(positions, i)
+		if count > 0 && len(positions) == count {
+			break
+		}
+	}
+	return positions, nil
+}
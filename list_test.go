@@ -0,0 +1,226 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestRPushCappedDropsOldest(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	for i := range 5 {
+		n, err := db.RPushCapped("recent", 3, i)
+		if err != nil || n != min(i+1, 3) {
+			t.Fatalf("RPushCapped(%d) = %d, %v; want %d", i, n, err, min(i+1, 3))
+		}
+	}
+	if got, _ := db.LRange("recent", 0, -1); !reflect.DeepEqual(got, []any{2, 3, 4}) {
+		t.Errorf("list = %v, want the newest three [2 3 4]", got)
+	}
+	if n, _ := db.RPushCapped("recent", 3, 5, 6, 7, 8); n != 3 {
+		t.Errorf("RPushCapped of a batch past the cap = %d, want 3", n)
+	}
+	if got, _ := db.LRange("recent", 0, -1); !reflect.DeepEqual(got, []any{6, 7, 8}) {
+		t.Errorf("list = %v, want [6 7 8]", got)
+	}
+	if n, _ := db.RPushCapped("recent", 5, 9); n != 4 {
+		t.Errorf("RPushCapped under a larger cap = %d, want 4", n)
+	}
+	if n, _ := db.RPushCapped("recent", 0, 10); n != 0 {
+		t.Errorf("RPushCapped with a cap of 0 = %d, want 0", n)
+	}
+	if _, ok := db.Get("recent"); ok {
+		t.Error("a list capped to nothing was kept")
+	}
+}
+
+func TestLMove(t *testing.T) {
+	for _, tc := range []struct {
+		fromLeft, toLeft bool
+		moved            any
+		src, dst         []any
+	}{
+		{true, true, 1, []any{2, 3}, []any{1, "x"}},
+		{true, false, 1, []any{2, 3}, []any{"x", 1}},
+		{false, true, 3, []any{1, 2}, []any{3, "x"}},
+		{false, false, 3, []any{1, 2}, []any{"x", 3}},
+	} {
+		db := NewDataBase()
+		db.RPush("src", 1, 2, 3)
+		db.RPush("dst", "x")
+		moved, ok, err := db.LMove("src", "dst", tc.fromLeft, tc.toLeft)
+		if err != nil || !ok || moved != tc.moved {
+			t.Errorf("LMove(%v, %v) = %v, %v, %v; want %v", tc.fromLeft, tc.toLeft, moved, ok, err, tc.moved)
+		}
+		src, _ := db.LRange("src", 0, -1)
+		dst, _ := db.LRange("dst", 0, -1)
+		if !reflect.DeepEqual(src, tc.src) || !reflect.DeepEqual(dst, tc.dst) {
+			t.Errorf("LMove(%v, %v): src %v, dst %v; want %v, %v", tc.fromLeft, tc.toLeft, src, dst, tc.src, tc.dst)
+		}
+		db.Close()
+	}
+}
+
+func TestLMoveRotatesAndRefuses(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	db.RPush("ring", 1, 2, 3)
+	db.LMove("ring", "ring", true, false)
+	if got, _ := db.LRange("ring", 0, -1); !reflect.DeepEqual(got, []any{2, 3, 1}) {
+		t.Errorf("rotated left = %v, want [2 3 1]", got)
+	}
+	db.LMove("ring", "ring", false, true)
+	if got, _ := db.LRange("ring", 0, -1); !reflect.DeepEqual(got, []any{1, 2, 3}) {
+		t.Errorf("rotated back = %v, want [1 2 3]", got)
+	}
+
+	if _, ok, err := db.LMove("empty", "ring", true, true); ok || err != nil {
+		t.Errorf("LMove from a missing list = %v, %v; want false, nil", ok, err)
+	}
+	if _, ok := db.Get("empty"); ok {
+		t.Error("LMove from a missing list created it")
+	}
+	db.Set("str", "x")
+	if _, _, err := db.LMove("ring", "str", true, true); !errors.Is(err, ErrWrongType) {
+		t.Errorf("LMove onto a string: %v, want ErrWrongType", err)
+	}
+	if got, _ := db.LRange("ring", 0, -1); len(got) != 3 {
+		t.Errorf("ring = %v after the refused move, want it untouched", got)
+	}
+}
+
+func TestLPos(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	db.RPush("list", "a", "b", "c", "b", "a", "b") // b at 1, 3 and 5.
+	for _, tc := range []struct {
+		rank, count int
+		want        []int
+	}{
+		{0, 1, []int{1}},
+		{1, 0, []int{1, 3, 5}},
+		{2, 0, []int{3, 5}},
+		{2, 1, []int{3}},
+		{3, 5, []int{5}},
+		{4, 0, []int{}},
+		{-1, 1, []int{5}},
+		{-1, 0, []int{5, 3, 1}}, // Tail first, still counted from the head.
+		{-2, 2, []int{3, 1}},
+		{-3, 0, []int{1}},
+	} {
+		got, err := db.LPos("list", "b", tc.rank, tc.count)
+		if err != nil || !slices.Equal(got, tc.want) {
+			t.Errorf("LPos(b, rank %d, count %d) = %v, %v; want %v", tc.rank, tc.count, got, err, tc.want)
+		}
+	}
+	if got, _ := db.LPos("list", "z", 1, 0); got == nil || len(got) != 0 {
+		t.Errorf("LPos of an absent element = %#v, want an empty slice", got)
+	}
+	if got, _ := db.LPos("missing", "a", 1, 0); len(got) != 0 {
+		t.Errorf("LPos of a missing key = %v, want none", got)
+	}
+	db.Set("str", "x")
+	if _, err := db.LPos("str", "x", 1, 0); !errors.Is(err, ErrWrongType) {
+		t.Errorf("LPos of a string: %v, want ErrWrongType", err)
+	}
+}
+
+func TestLLen(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	db.RPush("list", 1, 2, 3)
+	if n, err := db.LLen("list"); err != nil || n != 3 {
+		t.Errorf("LLen = %d, %v; want 3", n, err)
+	}
+	if n, err := db.LLen("missing"); err != nil || n != 0 {
+		t.Errorf("LLen of a missing key = %d, %v; want 0", n, err)
+	}
+	db.HSet("hash", "f", 1)
+	if _, err := db.LLen("hash"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("LLen of a hash: %v, want ErrWrongType", err)
+	}
+}
+
+func TestLRangeStep(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	for i := range 10 {
+		db.RPush("log", i)
+	}
+	for _, tc := range []struct {
+		start, stop, step int
+		want              []any
+	}{
+		{0, -1, 1, []any{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}},
+		{0, -1, 3, []any{0, 3, 6, 9}},
+		{-1, 0, -1, []any{9, 8, 7, 6, 5, 4, 3, 2, 1, 0}}, // The whole list reversed.
+		{-1, 0, -3, []any{9, 6, 3, 0}},
+		{8, 2, -2, []any{8, 6, 4, 2}},
+		{-3, -8, -2, []any{7, 5, 3}},
+		{0, -1, 100, []any{0}}, // A step past the length takes the first element only.
+		{-1, 0, -100, []any{9}},
+		{3, 3, 5, []any{3}},
+		{-100, 100, 4, []any{0, 4, 8}}, // Indexes are clamped, as in LRange.
+		{100, -100, -4, []any{9, 5, 1}},
+		{2, 5, -1, []any{}}, // A negative step needs start >= stop.
+		{5, 2, 1, []any{}},
+	} {
+		got, err := db.LRangeStep("log", tc.start, tc.stop, tc.step)
+		if err != nil || !slices.Equal(got, tc.want) {
+			t.Errorf("LRangeStep(%d, %d, %d) = %v, %v; want %v", tc.start, tc.stop, tc.step, got, err, tc.want)
+		}
+	}
+
+	if got, err := db.LRangeStep("missing", 0, -1, 2); err != nil || len(got) != 0 {
+		t.Errorf("LRangeStep of a missing key = %v, %v; want empty", got, err)
+	}
+	if _, err := db.LRangeStep("log", 0, -1, 0); !errors.Is(err, ErrZeroStep) {
+		t.Errorf("LRangeStep with step 0: %v, want ErrZeroStep", err)
+	}
+	db.Set("str", "x")
+	if _, err := db.LRangeStep("str", 0, -1, 1); !errors.Is(err, ErrWrongType) {
+		t.Errorf("LRangeStep of a string: %v, want ErrWrongType", err)
+	}
+}
+
+func TestLPushLPopRPop(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	if n, err := db.LPush("l", "a", "b", "c"); n != 3 || err != nil {
+		t.Fatalf("LPush = %d, %v; want 3", n, err)
+	}
+	db.RPush("l", "z")
+	if got, _ := db.LRange("l", 0, -1); !reflect.DeepEqual(got, []any{"c", "b", "a", "z"}) {
+		t.Errorf("list = %v, want [c b a z]: each LPush value goes to the head in turn", got)
+	}
+	if elem, ok, err := db.LPop("l"); elem != "c" || !ok || err != nil {
+		t.Errorf("LPop = %v, %v, %v; want c", elem, ok, err)
+	}
+	if elem, ok, err := db.RPop("l"); elem != "z" || !ok || err != nil {
+		t.Errorf("RPop = %v, %v, %v; want z", elem, ok, err)
+	}
+	db.LPop("l")
+	db.RPop("l")
+	if _, ok := db.Get("l"); ok {
+		t.Error("the emptied list survived its last pop")
+	}
+	if elem, ok, err := db.LPop("l"); elem != nil || ok || err != nil {
+		t.Errorf("LPop of a missing key = %v, %v, %v; want nothing", elem, ok, err)
+	}
+	if _, ok, _ := db.RPop("l"); ok {
+		t.Error("RPop of a missing key reported an element")
+	}
+
+	db.Set("str", "v")
+	if _, err := db.LPush("str", "x"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("LPush to a string: %v, want ErrWrongType", err)
+	}
+	if _, _, err := db.LPop("str"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("LPop of a string: %v, want ErrWrongType", err)
+	}
+	if _, _, err := db.RPop("str"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("RPop of a string: %v, want ErrWrongType", err)
+	}
+}
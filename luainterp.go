@@ -0,0 +1,1107 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// luaMaxSteps caps the statements and calls a script may run, so a runaway
+// loop fails instead of holding the write lock forever.
+const luaMaxSteps = 10_000_000
+
+// luaMaxDepth caps how deeply a script's functions may call each other, so
+// runaway recursion fails instead of exhausting the Go stack.
+const luaMaxDepth = 200
+
+// Values of a running script are nil, bool, float64, string, *luaTable,
+// luaBuiltin, *luaClosure and *luaIterator.
+
+// luaTable is a Lua table: an array part for the keys 1 to n and a hash
+// part for the rest.
+type luaTable struct {
+	array    []any
+	hash     map[any]any
+	readOnly bool // A library table, which scripts may not change.
+}
+
+// luaBuiltin is a function a script can call.
+type luaBuiltin func(in *luaInterp, args []any) (any, error)
+
+// luaClosure is a function defined by a script, with the scope it was
+// defined in, whose locals it keeps seeing and changing.
+type luaClosure struct {
+	fn    *luaFunction
+	scope *luaScope
+}
+
+// luaIterator is what pairs and ipairs return for a generic for: the
+// entries of a table, captured when the loop starts.
+type luaIterator struct {
+	entries [][2]any
+}
+
+// get returns t[key], or nil.
+func (t *luaTable) get(key any) any {
+	if i, ok := t.arrayIndex(key); ok && i < len(t.array) {
+		return t.array[i]
+	}
+	return t.hash[key]
+}
+
+// set sets t[key] to value; nil removes the key.
+func (t *luaTable) set(key, value any) {
+	i, ok := t.arrayIndex(key)
+	switch {
+	case ok && i < len(t.array):
+		t.array[i] = value
+		for len(t.array) > 0 && t.array[len(t.array)-1] == nil {
+			t.array = t.array[:len(t.array)-1] // Trailing nils end the sequence.
+		}
+		return
+	case ok && i == len(t.array) && value != nil:
+		t.array = append(t.array, value)
+		for { // Keys already in the hash may now continue the sequence.
+			next := float64(len(t.array) + 1)
+			v, found := t.hash[next]
+			if !found {
+				return
+			}
+			delete(t.hash, next)
+			t.array = append(t.array, v)
+		}
+	}
+	if value == nil {
+		delete(t.hash, key)
+		return
+	}
+	if t.hash == nil {
+		t.hash = make(map[any]any)
+	}
+	t.hash[key] = value
+}
+
+// arrayIndex returns the array index of key if it is a positive integer.
+func (t *luaTable) arrayIndex(key any) (int, bool) {
+	f, ok := key.(float64)
+	if !ok || f < 1 || f != math.Trunc(f) || f > math.MaxInt32 {
+		return 0, false
+	}
+	return int(f) - 1, true
+}
+
+// newLuaArray returns a table holding values at 1 to len(values).
+func newLuaArray(values []any) *luaTable {
+	return &luaTable{array: values}
+}
+
+// luaScope holds the local variables of a block.
+type luaScope struct {
+	vars   map[string]any
+	parent *luaScope
+}
+
+// lookup finds the scope declaring name.
+func (s *luaScope) lookup(name string) (*luaScope, bool) {
+	for ; s != nil; s = s.parent {
+		if _, ok := s.vars[name]; ok {
+			return s, true
+		}
+	}
+	return nil, false
+}
+
+// luaFlow says how a block finished.
+type luaFlow int
+
+const (
+	luaNormal   luaFlow = iota
+	luaBroke            // A break left the innermost loop.
+	luaReturned         // A return left the script.
+)
+
+// luaInterp runs a compiled script.
+type luaInterp struct {
+	globals map[string]any // Read-only: scripts may not create globals.
+	steps   int
+	depth   int                     // Script functions being called.
+	line    int                     // Of the statement running, for errors.
+	call    func(args []string) any // Runs a command for redis.call.
+}
+
+// luaRuntimeError is an error raised by a script, reported as Redis does.
+type luaRuntimeError struct {
+	line int
+	msg  string
+}
+
+// Error formats the error with the line it was raised on.
+func (e *luaRuntimeError) Error() string {
+	return fmt.Sprintf("Error running script: user_script:%d: %s", e.line, e.msg)
+}
+
+// errorf returns a runtime error at the current line.
+func (in *luaInterp) errorf(format string, args ...any) error {
+	return &luaRuntimeError{in.line, fmt.Sprintf(format, args...)}
+}
+
+// run runs a chunk and returns what it returns.
+func (in *luaInterp) run(chunk *luaChunk) (any, error) {
+	_, result, err := in.execBlock(chunk.body, nil)
+	return result, err
+}
+
+// step counts work towards luaMaxSteps.
+func (in *luaInterp) step() error {
+	if in.steps++; in.steps > luaMaxSteps {
+		return in.errorf("script exceeded %d steps", luaMaxSteps)
+	}
+	return nil
+}
+
+// execBlock runs stmts in a new scope inside parent.
+func (in *luaInterp) execBlock(stmts []luaStmt, parent *luaScope) (luaFlow, any, error) {
+	scope := &luaScope{vars: make(map[string]any), parent: parent}
+	for _, stmt := range stmts {
+		if err := in.step(); err != nil {
+			return 0, nil, err
+		}
+		in.line = stmt.line
+		flow, result, err := in.exec(stmt.node, scope)
+		if err != nil || flow != luaNormal {
+			return flow, result, err
+		}
+	}
+	return luaNormal, nil, nil
+}
+
+// exec runs the node of one statement.
+func (in *luaInterp) exec(stmt any, scope *luaScope) (luaFlow, any, error) {
+	switch s := stmt.(type) {
+	case *luaLocal:
+		values, err := in.evalList(s.exprs, len(s.names), scope)
+		if err != nil {
+			return 0, nil, err
+		}
+		for i, name := range s.names {
+			scope.vars[name] = values[i]
+		}
+	case *luaLocalFunction:
+		scope.vars[s.name] = &luaClosure{fn: s.fn, scope: scope} // Declared first, so it sees itself.
+	case *luaAssign:
+		values, err := in.evalList(s.exprs, len(s.targets), scope)
+		if err != nil {
+			return 0, nil, err
+		}
+		for i, target := range s.targets {
+			if err := in.assign(target, values[i], scope); err != nil {
+				return 0, nil, err
+			}
+		}
+	case *luaCallStmt:
+		if _, err := in.eval(s.call, scope); err != nil {
+			return 0, nil, err
+		}
+	case *luaIf:
+		for i, cond := range s.conds {
+			v, err := in.eval(cond, scope)
+			if err != nil {
+				return 0, nil, err
+			}
+			if luaTruthy(v) {
+				return in.execBlock(s.blocks[i], scope)
+			}
+		}
+		return in.execBlock(s.orElse, scope)
+	case *luaWhile:
+		for {
+			if err := in.step(); err != nil {
+				return 0, nil, err // Even an empty loop counts.
+			}
+			v, err := in.eval(s.cond, scope)
+			if err != nil || !luaTruthy(v) {
+				return luaNormal, nil, err
+			}
+			flow, result, err := in.execBlock(s.body, scope)
+			if err != nil || flow == luaReturned {
+				return flow, result, err
+			}
+			if flow == luaBroke {
+				return luaNormal, nil, nil
+			}
+		}
+	case *luaRepeat:
+		for {
+			if err := in.step(); err != nil {
+				return 0, nil, err
+			}
+			// The condition sees the body's locals, as in Lua.
+			body := &luaScope{vars: make(map[string]any), parent: scope}
+			flow, result, err := in.execInScope(s.body, body)
+			if err != nil || flow == luaReturned {
+				return flow, result, err
+			}
+			if flow == luaBroke {
+				return luaNormal, nil, nil
+			}
+			v, err := in.eval(s.cond, body)
+			if err != nil || luaTruthy(v) {
+				return luaNormal, nil, err
+			}
+		}
+	case *luaNumFor:
+		return in.numFor(s, scope)
+	case *luaGenFor:
+		v, err := in.eval(s.iter, scope)
+		if err != nil {
+			return 0, nil, err
+		}
+		iter, ok := v.(*luaIterator)
+		if !ok {
+			return 0, nil, in.errorf("for iterator must be pairs(t) or ipairs(t), not a %s value", luaType(v))
+		}
+		for _, entry := range iter.entries {
+			if err := in.step(); err != nil {
+				return 0, nil, err
+			}
+			body := &luaScope{vars: make(map[string]any), parent: scope}
+			for i, name := range s.names {
+				if i < 2 {
+					body.vars[name] = entry[i]
+				} else {
+					body.vars[name] = nil
+				}
+			}
+			flow, result, err := in.execInScope(s.body, body)
+			if err != nil || flow == luaReturned {
+				return flow, result, err
+			}
+			if flow == luaBroke {
+				break
+			}
+		}
+	case *luaDo:
+		return in.execBlock(s.body, scope)
+	case *luaReturn:
+		var result any
+		for i, e := range s.exprs {
+			v, err := in.eval(e, scope)
+			if err != nil {
+				return 0, nil, err
+			}
+			if i == 0 {
+				result = v // Redis keeps only the first value of a script.
+			}
+		}
+		return luaReturned, result, nil
+	case *luaBreak:
+		return luaBroke, nil, nil
+	}
+	return luaNormal, nil, nil
+}
+
+// execInScope runs stmts in scope, which the caller has set up.
+func (in *luaInterp) execInScope(stmts []luaStmt, scope *luaScope) (luaFlow, any, error) {
+	for _, stmt := range stmts {
+		if err := in.step(); err != nil {
+			return 0, nil, err
+		}
+		in.line = stmt.line
+		flow, result, err := in.exec(stmt.node, scope)
+		if err != nil || flow != luaNormal {
+			return flow, result, err
+		}
+	}
+	return luaNormal, nil, nil
+}
+
+// numFor runs a numeric for loop.
+func (in *luaInterp) numFor(s *luaNumFor, scope *luaScope) (luaFlow, any, error) {
+	bounds := []luaExpr{s.start, s.limit, s.step}
+	if s.step == nil {
+		bounds[2] = &luaConst{1.0}
+	}
+	var n [3]float64
+	for i, e := range bounds {
+		v, err := in.eval(e, scope)
+		if err != nil {
+			return 0, nil, err
+		}
+		f, ok := luaToNumber(v)
+		if !ok {
+			return 0, nil, in.errorf("'for' %s must be a number", [3]string{"initial value", "limit", "step"}[i])
+		}
+		n[i] = f
+	}
+	if n[2] == 0 {
+		return 0, nil, in.errorf("'for' step is zero")
+	}
+	for i := n[0]; n[2] > 0 && i <= n[1] || n[2] < 0 && i >= n[1]; i += n[2] {
+		if err := in.step(); err != nil {
+			return 0, nil, err
+		}
+		body := &luaScope{vars: map[string]any{s.name: i}, parent: scope}
+		flow, result, err := in.execInScope(s.body, body)
+		if err != nil || flow == luaReturned {
+			return flow, result, err
+		}
+		if flow == luaBroke {
+			break
+		}
+	}
+	return luaNormal, nil, nil
+}
+
+// assign stores value in a variable or table field.
+func (in *luaInterp) assign(target luaExpr, value any, scope *luaScope) error {
+	switch t := target.(type) {
+	case *luaVar:
+		declared, ok := scope.lookup(t.name)
+		if !ok {
+			return in.errorf("Script attempted to create global variable '%s'", t.name)
+		}
+		declared.vars[t.name] = value
+	case *luaIndex:
+		obj, err := in.eval(t.obj, scope)
+		if err != nil {
+			return err
+		}
+		key, err := in.eval(t.key, scope)
+		if err != nil {
+			return err
+		}
+		table, ok := obj.(*luaTable)
+		if !ok {
+			return in.errorf("attempt to index a %s value", luaType(obj))
+		}
+		if table.readOnly {
+			return in.errorf("Attempt to modify a readonly table")
+		}
+		if err := in.checkKey(key); err != nil {
+			return err
+		}
+		table.set(key, value)
+	}
+	return nil
+}
+
+// checkKey rejects the values that cannot be table keys.
+func (in *luaInterp) checkKey(key any) error {
+	switch k := key.(type) {
+	case nil:
+		return in.errorf("table index is nil")
+	case float64:
+		if math.IsNaN(k) {
+			return in.errorf("table index is NaN")
+		}
+	case luaBuiltin, *luaIterator:
+		return in.errorf("functions cannot be table keys here")
+	}
+	return nil
+}
+
+// evalList evaluates exprs into exactly n values, padding with nil.
+func (in *luaInterp) evalList(exprs []luaExpr, n int, scope *luaScope) ([]any, error) {
+	values := make([]any, max(n, len(exprs)))
+	for i, e := range exprs {
+		v, err := in.eval(e, scope)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return values[:n], nil
+}
+
+// eval evaluates an expression.
+func (in *luaInterp) eval(expr luaExpr, scope *luaScope) (any, error) {
+	switch e := expr.(type) {
+	case *luaConst:
+		return e.value, nil
+	case *luaVar:
+		if declared, ok := scope.lookup(e.name); ok {
+			return declared.vars[e.name], nil
+		}
+		if v, ok := in.globals[e.name]; ok {
+			return v, nil
+		}
+		return nil, in.errorf("Script attempted to access nonexistent global variable '%s'", e.name)
+	case *luaIndex:
+		obj, err := in.eval(e.obj, scope)
+		if err != nil {
+			return nil, err
+		}
+		key, err := in.eval(e.key, scope)
+		if err != nil {
+			return nil, err
+		}
+		table, ok := obj.(*luaTable)
+		if !ok {
+			in.line = e.line
+			return nil, in.errorf("attempt to index a %s value", luaType(obj))
+		}
+		if _, isFunc := key.(luaBuiltin); isFunc {
+			return nil, nil // Never a key; see checkKey.
+		}
+		return table.get(key), nil
+	case *luaCall:
+		fn, err := in.eval(e.fn, scope)
+		if err != nil {
+			return nil, err
+		}
+		args := make([]any, len(e.args))
+		for i, a := range e.args {
+			if args[i], err = in.eval(a, scope); err != nil {
+				return nil, err
+			}
+		}
+		in.line = e.line
+		if err := in.step(); err != nil {
+			return nil, err
+		}
+		switch fn := fn.(type) {
+		case luaBuiltin:
+			return fn(in, args)
+		case *luaClosure:
+			return in.callClosure(fn, args)
+		}
+		return nil, in.errorf("attempt to call a %s value", luaType(fn))
+	case *luaUnary:
+		v, err := in.eval(e.operand, scope)
+		if err != nil {
+			return nil, err
+		}
+		in.line = e.line
+		return in.unary(e.op, v)
+	case *luaBinary:
+		left, err := in.eval(e.left, scope)
+		if err != nil {
+			return nil, err
+		}
+		switch e.op { // and and or short-circuit.
+		case "and":
+			if !luaTruthy(left) {
+				return left, nil
+			}
+			return in.eval(e.right, scope)
+		case "or":
+			if luaTruthy(left) {
+				return left, nil
+			}
+			return in.eval(e.right, scope)
+		}
+		right, err := in.eval(e.right, scope)
+		if err != nil {
+			return nil, err
+		}
+		in.line = e.line
+		return in.binary(e.op, left, right)
+	case *luaTableCons:
+		t := &luaTable{}
+		next := 1.0
+		for i, value := range e.values {
+			v, err := in.eval(value, scope)
+			if err != nil {
+				return nil, err
+			}
+			if e.keys[i] == nil {
+				t.set(next, v)
+				next++
+				continue
+			}
+			key, err := in.eval(e.keys[i], scope)
+			if err != nil {
+				return nil, err
+			}
+			if err := in.checkKey(key); err != nil {
+				return nil, err
+			}
+			t.set(key, v)
+		}
+		return t, nil
+	case *luaFunction:
+		return &luaClosure{fn: e, scope: scope}, nil
+	}
+	return nil, in.errorf("unknown expression %T", expr)
+}
+
+// callClosure calls a script function with args, missing ones nil and
+// extra ones dropped, and returns the first value it returns.
+func (in *luaInterp) callClosure(c *luaClosure, args []any) (any, error) {
+	if in.depth >= luaMaxDepth {
+		return nil, in.errorf("stack overflow")
+	}
+	in.depth++
+	defer func() { in.depth-- }()
+	scope := &luaScope{vars: make(map[string]any, len(c.fn.params)), parent: c.scope}
+	for i, name := range c.fn.params {
+		scope.vars[name] = luaArg(args, i)
+	}
+	line := in.line
+	flow, result, err := in.execInScope(c.fn.body, scope)
+	if err != nil {
+		return nil, err // Reported at the line inside the function.
+	}
+	in.line = line
+	if flow != luaReturned {
+		return nil, nil // Falling off the end returns nothing.
+	}
+	return result, nil
+}
+
+// unary applies a unary operator.
+func (in *luaInterp) unary(op string, v any) (any, error) {
+	switch op {
+	case "not":
+		return !luaTruthy(v), nil
+	case "-":
+		if n, ok := luaToNumber(v); ok {
+			return -n, nil
+		}
+		return nil, in.errorf("attempt to perform arithmetic on a %s value", luaType(v))
+	}
+	switch v := v.(type) { // #
+	case string:
+		return float64(len(v)), nil
+	case *luaTable:
+		return float64(len(v.array)), nil
+	}
+	return nil, in.errorf("attempt to get length of a %s value", luaType(v))
+}
+
+// binary applies a binary operator other than and and or.
+func (in *luaInterp) binary(op string, left, right any) (any, error) {
+	switch op {
+	case "==":
+		return luaEqual(left, right), nil
+	case "~=":
+		return !luaEqual(left, right), nil
+	case "..":
+		l, lok := luaToString(left)
+		r, rok := luaToString(right)
+		if !lok || !rok {
+			bad := left
+			if lok {
+				bad = right
+			}
+			return nil, in.errorf("attempt to concatenate a %s value", luaType(bad))
+		}
+		return l + r, nil
+	case "<", "<=", ">", ">=":
+		if op == ">" || op == ">=" {
+			left, right = right, left
+			op = strings.Replace(op, ">", "<", 1)
+		}
+		switch l := left.(type) {
+		case float64:
+			if r, ok := right.(float64); ok {
+				return l < r || op == "<=" && l == r, nil
+			}
+		case string:
+			if r, ok := right.(string); ok {
+				return l < r || op == "<=" && l == r, nil
+			}
+		}
+		return nil, in.errorf("attempt to compare %s with %s", luaType(left), luaType(right))
+	}
+	l, lok := luaToNumber(left)
+	r, rok := luaToNumber(right)
+	if !lok || !rok {
+		bad := left
+		if lok {
+			bad = right
+		}
+		return nil, in.errorf("attempt to perform arithmetic on a %s value", luaType(bad))
+	}
+	switch op {
+	case "+":
+		return l + r, nil
+	case "-":
+		return l - r, nil
+	case "*":
+		return l * r, nil
+	case "/":
+		return l / r, nil
+	case "%":
+		return l - math.Floor(l/r)*r, nil
+	}
+	return math.Pow(l, r), nil // ^
+}
+
+// luaEqual implements ==: values of different types are never equal and
+// tables only to themselves. Functions, which Go cannot compare, are
+// never equal to anything.
+func luaEqual(a, b any) bool {
+	if _, isFunc := a.(luaBuiltin); isFunc {
+		return false
+	}
+	if _, isFunc := b.(luaBuiltin); isFunc {
+		return false
+	}
+	return a == b
+}
+
+// luaTruthy reports whether v counts as true: everything but nil and false.
+func luaTruthy(v any) bool {
+	return v != nil && v != false
+}
+
+// luaType returns the Lua type name of v.
+func luaType(v any) string {
+	switch v.(type) {
+	case nil:
+		return "nil"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case *luaTable:
+		return "table"
+	case luaBuiltin, *luaClosure, *luaIterator:
+		return "function"
+	}
+	return "userdata"
+}
+
+// luaToNumber converts a number, or a string holding one, to a number.
+func luaToNumber(v any) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case string:
+		return parseLuaNumber(v)
+	}
+	return 0, false
+}
+
+// luaToString converts a string, or a number, to a string.
+func luaToString(v any) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case float64:
+		return luaFormatNumber(v), true
+	}
+	return "", false
+}
+
+// luaFormatNumber formats a number as Lua's %.14g does, integers without
+// a fraction.
+func luaFormatNumber(f float64) string {
+	if f == math.Trunc(f) && math.Abs(f) < 1e15 {
+		return strconv.FormatInt(int64(f), 10)
+	}
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case math.IsNaN(f):
+		return "nan"
+	}
+	return strconv.FormatFloat(f, 'g', 14, 64)
+}
+
+// newLuaInterp returns an interpreter for one run of a script with the
+// given KEYS and ARGV, whose redis.call runs commands through call.
+func newLuaInterp(keys, args []string, call func(args []string) any) *luaInterp {
+	strs := func(ss []string) *luaTable {
+		values := make([]any, len(ss))
+		for i, s := range ss {
+			values[i] = s
+		}
+		return newLuaArray(values)
+	}
+	in := &luaInterp{call: call}
+	in.globals = map[string]any{
+		"KEYS":     strs(keys),
+		"ARGV":     strs(args),
+		"redis":    luaLib(luaRedisLib),
+		"string":   luaLib(luaStringLib),
+		"table":    luaLib(luaTableLib),
+		"math":     luaLib(luaMathLib),
+		"tonumber": luaBuiltin(luaTonumber),
+		"tostring": luaBuiltin(luaTostring),
+		"type":     luaBuiltin(func(in *luaInterp, args []any) (any, error) { return luaType(luaArg(args, 0)), nil }),
+		"error":    luaBuiltin(luaErrorFn),
+		"ipairs":   luaBuiltin(luaIpairs),
+		"pairs":    luaBuiltin(luaPairs),
+	}
+	return in
+}
+
+// luaLib builds a read-only library table of functions.
+func luaLib(fns map[string]luaBuiltin) *luaTable {
+	t := &luaTable{hash: make(map[any]any, len(fns)), readOnly: true}
+	for name, fn := range fns {
+		t.hash[name] = fn
+	}
+	return t
+}
+
+// luaArg returns args[i], or nil past the end.
+func luaArg(args []any, i int) any {
+	if i < len(args) {
+		return args[i]
+	}
+	return nil
+}
+
+// numberArg returns args[i] as a number, or an error naming fn.
+func (in *luaInterp) numberArg(fn string, args []any, i int) (float64, error) {
+	n, ok := luaToNumber(luaArg(args, i))
+	if !ok {
+		return 0, in.errorf("bad argument #%d to '%s' (number expected, got %s)", i+1, fn, luaType(luaArg(args, i)))
+	}
+	return n, nil
+}
+
+// stringArg returns args[i] as a string, or an error naming fn.
+func (in *luaInterp) stringArg(fn string, args []any, i int) (string, error) {
+	s, ok := luaToString(luaArg(args, i))
+	if !ok {
+		return "", in.errorf("bad argument #%d to '%s' (string expected, got %s)", i+1, fn, luaType(luaArg(args, i)))
+	}
+	return s, nil
+}
+
+// tableArg returns args[i] as a table, or an error naming fn.
+func (in *luaInterp) tableArg(fn string, args []any, i int) (*luaTable, error) {
+	t, ok := luaArg(args, i).(*luaTable)
+	if !ok {
+		return nil, in.errorf("bad argument #%d to '%s' (table expected, got %s)", i+1, fn, luaType(luaArg(args, i)))
+	}
+	return t, nil
+}
+
+// luaTonumber implements tonumber(v [, base]).
+func luaTonumber(in *luaInterp, args []any) (any, error) {
+	if len(args) > 1 {
+		base, err := in.numberArg("tonumber", args, 1)
+		if err != nil {
+			return nil, err
+		}
+		s, ok := luaToString(luaArg(args, 0))
+		n, err := strconv.ParseInt(strings.TrimSpace(s), int(base), 64)
+		if !ok || err != nil {
+			return nil, nil
+		}
+		return float64(n), nil
+	}
+	if n, ok := luaToNumber(luaArg(args, 0)); ok {
+		return n, nil
+	}
+	return nil, nil
+}
+
+// luaTostring implements tostring(v).
+func luaTostring(in *luaInterp, args []any) (any, error) {
+	v := luaArg(args, 0)
+	if s, ok := luaToString(v); ok {
+		return s, nil
+	}
+	switch v := v.(type) {
+	case nil:
+		return "nil", nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	}
+	return fmt.Sprintf("%s: %p", luaType(v), v), nil
+}
+
+// luaErrorFn implements error(message), which stops the script. A table
+// with an err field, as redis.error_reply makes, becomes that error reply.
+func luaErrorFn(in *luaInterp, args []any) (any, error) {
+	if t, ok := luaArg(args, 0).(*luaTable); ok {
+		if msg, ok := t.get("err").(string); ok {
+			return nil, errors.New(msg)
+		}
+	}
+	msg, _ := luaToString(luaArg(args, 0))
+	return nil, in.errorf("%s", msg)
+}
+
+// luaIpairs implements ipairs(t).
+func luaIpairs(in *luaInterp, args []any) (any, error) {
+	t, err := in.tableArg("ipairs", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	iter := &luaIterator{}
+	for i, v := range t.array {
+		iter.entries = append(iter.entries, [2]any{float64(i + 1), v})
+	}
+	return iter, nil
+}
+
+// luaPairs implements pairs(t): the array part in order, then the other
+// keys sorted, so scripts run the same way every time.
+func luaPairs(in *luaInterp, args []any) (any, error) {
+	iter, err := luaIpairs(in, args)
+	if err != nil {
+		return nil, err
+	}
+	t := args[0].(*luaTable)
+	keys := make([]any, 0, len(t.hash))
+	for k := range t.hash {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j]) })
+	for _, k := range keys {
+		iter.(*luaIterator).entries = append(iter.(*luaIterator).entries, [2]any{k, t.hash[k]})
+	}
+	return iter, nil
+}
+
+// luaStringLib is the string library, without patterns.
+var luaStringLib = map[string]luaBuiltin{
+	"len": func(in *luaInterp, args []any) (any, error) {
+		s, err := in.stringArg("len", args, 0)
+		return float64(len(s)), err
+	},
+	"upper": func(in *luaInterp, args []any) (any, error) {
+		s, err := in.stringArg("upper", args, 0)
+		return strings.ToUpper(s), err
+	},
+	"lower": func(in *luaInterp, args []any) (any, error) {
+		s, err := in.stringArg("lower", args, 0)
+		return strings.ToLower(s), err
+	},
+	"rep": func(in *luaInterp, args []any) (any, error) {
+		s, err := in.stringArg("rep", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		n, err := in.numberArg("rep", args, 1)
+		if err != nil {
+			return nil, err
+		}
+		if n <= 0 {
+			return "", nil
+		}
+		if float64(len(s))*n > 512<<20 {
+			return nil, in.errorf("resulting string too large")
+		}
+		return strings.Repeat(s, int(n)), nil
+	},
+	"sub": func(in *luaInterp, args []any) (any, error) {
+		s, err := in.stringArg("sub", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		start, err := in.numberArg("sub", args, 1)
+		if err != nil {
+			return nil, err
+		}
+		end := -1.0
+		if luaArg(args, 2) != nil {
+			if end, err = in.numberArg("sub", args, 2); err != nil {
+				return nil, err
+			}
+		}
+		n := float64(len(s))
+		if start < 0 {
+			start = max(n+start+1, 1)
+		} else if start == 0 {
+			start = 1
+		}
+		if end < 0 {
+			end = n + end + 1
+		}
+		end = min(end, n)
+		if start > end {
+			return "", nil
+		}
+		return s[int(start)-1 : int(end)], nil
+	},
+	"format": func(in *luaInterp, args []any) (any, error) {
+		format, err := in.stringArg("format", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		var b strings.Builder
+		arg := 1
+		for i := 0; i < len(format); i++ {
+			if format[i] != '%' {
+				b.WriteByte(format[i])
+				continue
+			}
+			j := i + 1
+			for j < len(format) && strings.IndexByte("-+ #0123456789.", format[j]) >= 0 {
+				j++
+			}
+			if j == len(format) {
+				return nil, in.errorf("invalid option in format string")
+			}
+			spec, verb := format[i:j], format[j]
+			i = j
+			switch verb {
+			case '%':
+				b.WriteByte('%')
+				continue
+			case 'd', 'i', 'x', 'X', 'c':
+				n, err := in.numberArg("format", args, arg)
+				if err != nil {
+					return nil, err
+				}
+				if verb == 'i' {
+					verb = 'd'
+				}
+				fmt.Fprintf(&b, spec+string(verb), int64(n))
+			case 'f', 'g', 'G', 'e', 'E':
+				n, err := in.numberArg("format", args, arg)
+				if err != nil {
+					return nil, err
+				}
+				fmt.Fprintf(&b, spec+string(verb), n)
+			case 's', 'q':
+				s, err := luaTostring(in, []any{luaArg(args, arg)})
+				if err != nil {
+					return nil, err
+				}
+				if verb == 'q' {
+					s = strconv.Quote(s.(string))
+					verb = 's'
+				}
+				fmt.Fprintf(&b, spec+string(verb), s)
+			default:
+				return nil, in.errorf("invalid option '%%%c' to 'format'", verb)
+			}
+			arg++
+		}
+		return b.String(), nil
+	},
+}
+
+// luaTableLib is the table library.
+var luaTableLib = map[string]luaBuiltin{
+	"insert": func(in *luaInterp, args []any) (any, error) {
+		t, err := in.tableArg("insert", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		if t.readOnly {
+			return nil, in.errorf("Attempt to modify a readonly table")
+		}
+		switch len(args) {
+		case 2:
+			t.set(float64(len(t.array)+1), args[1])
+		case 3:
+			pos, err := in.numberArg("insert", args, 1)
+			if err != nil {
+				return nil, err
+			}
+			if pos < 1 || pos > float64(len(t.array)+1) || pos != math.Trunc(pos) {
+				return nil, in.errorf("bad argument #2 to 'insert' (position out of bounds)")
+			}
+			if args[2] == nil {
+				return nil, nil
+			}
+			t.array = append(t.array, nil)
+			copy(t.array[int(pos):], t.array[int(pos)-1:])
+			t.array[int(pos)-1] = args[2]
+		default:
+			return nil, in.errorf("wrong number of arguments to 'insert'")
+		}
+		return nil, nil
+	},
+	"remove": func(in *luaInterp, args []any) (any, error) {
+		t, err := in.tableArg("remove", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		if t.readOnly {
+			return nil, in.errorf("Attempt to modify a readonly table")
+		}
+		if len(t.array) == 0 {
+			return nil, nil
+		}
+		pos := float64(len(t.array))
+		if len(args) > 1 {
+			if pos, err = in.numberArg("remove", args, 1); err != nil {
+				return nil, err
+			}
+			if pos < 1 || pos > float64(len(t.array)) || pos != math.Trunc(pos) {
+				return nil, nil
+			}
+		}
+		removed := t.array[int(pos)-1]
+		t.array = append(t.array[:int(pos)-1], t.array[int(pos):]...)
+		return removed, nil
+	},
+	"concat": func(in *luaInterp, args []any) (any, error) {
+		t, err := in.tableArg("concat", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		sep := ""
+		if luaArg(args, 1) != nil {
+			if sep, err = in.stringArg("concat", args, 1); err != nil {
+				return nil, err
+			}
+		}
+		parts := make([]string, len(t.array))
+		for i, v := range t.array {
+			s, ok := luaToString(v)
+			if !ok {
+				return nil, in.errorf("invalid value (at index %d) in table for 'concat'", i+1)
+			}
+			parts[i] = s
+		}
+		return strings.Join(parts, sep), nil
+	},
+	"getn": func(in *luaInterp, args []any) (any, error) {
+		t, err := in.tableArg("getn", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return float64(len(t.array)), nil
+	},
+}
+
+// luaMathLib is the part of the math library scripts commonly use.
+var luaMathLib = map[string]luaBuiltin{
+	"floor": luaMathFn("floor", math.Floor),
+	"ceil":  luaMathFn("ceil", math.Ceil),
+	"abs":   luaMathFn("abs", math.Abs),
+	"sqrt":  luaMathFn("sqrt", math.Sqrt),
+	"min":   luaMinMax("min", func(a, b float64) bool { return a < b }),
+	"max":   luaMinMax("max", func(a, b float64) bool { return a > b }),
+}
+
+// luaMathFn wraps a function of one number.
+func luaMathFn(name string, fn func(float64) float64) luaBuiltin {
+	return func(in *luaInterp, args []any) (any, error) {
+		n, err := in.numberArg(name, args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return fn(n), nil
+	}
+}
+
+// luaMinMax returns math.min or math.max, keeping the argument for which
+// better holds against all others.
+func luaMinMax(name string, better func(a, b float64) bool) luaBuiltin {
+	return func(in *luaInterp, args []any) (any, error) {
+		best, err := in.numberArg(name, args, 0)
+		if err != nil {
+			return nil, err
+		}
+		for i := 1; i < len(args); i++ {
+			n, err := in.numberArg(name, args, i)
+			if err != nil {
+				return nil, err
+			}
+			if better(n, best) {
+				best = n
+			}
+		}
+		return best, nil
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// runLua compiles and runs src with no KEYS or ARGV, whose redis.call
+// replies with its arguments joined by spaces.
+func runLua(t *testing.T, src string) (any, error) {
+	t.Helper()
+	chunk, err := compileLua(src)
+	if err != nil {
+		t.Fatalf("compileLua(%q): %v", src, err)
+	}
+	in := newLuaInterp(nil, nil, func(args []string) any { return strings.Join(args, " ") })
+	return in.run(chunk)
+}
+
+func TestLuaClosures(t *testing.T) {
+	for _, tc := range []struct {
+		name, src string
+		want      any
+	}{
+		{"local function", "local function double(n) return n * 2 end return double(21)", 42.0},
+		{"recursion", "local function fact(n) if n <= 1 then return 1 end return n * fact(n - 1) end return fact(10)", 3628800.0},
+		{"anonymous", "local add = function(a, b) return a + b end return add(2, 3)", 5.0},
+		{"missing arguments are nil", "local function f(a, b) return b == nil end return f(1)", true},
+		{"no return", "local function f() end return f() == nil", true},
+		{"counter keeps its upvalue", `
+			local function counter()
+				local n = 0
+				return function() n = n + 1 return n end
+			end
+			local c1, c2 = counter(), counter()
+			c1() c1()
+			return c1() * 10 + c2()`, 31.0},
+		{"shared upvalue", `
+			local n = 0
+			local function inc() n = n + 1 end
+			inc() inc()
+			return n`, 2.0},
+		{"loop variable per iteration", `
+			local fns = {}
+			for i = 1, 3 do fns[i] = function() return i end end
+			return fns[1]() + fns[3]()`, 4.0},
+		{"function stored in a table", `
+			local t = {}
+			function t.greet(name) return "hello " .. name end
+			return t.greet("ada")`, "hello ada"},
+		{"function as argument", `
+			local function apply(f, x) return f(x) end
+			return apply(function(x) return x + 1 end, 1)`, 2.0},
+		{"type", "return type(function() end)", "function"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := runLua(t, tc.src)
+			if err != nil || got != tc.want {
+				t.Errorf("got %v, %v; want %v", got, err, tc.want)
+			}
+		})
+	}
+}
+
+func TestLuaClosureErrors(t *testing.T) {
+	for _, tc := range []struct{ name, src, want string }{
+		{"global function", "function f() end", "create global variable 'f'"},
+		{"runaway recursion", "local function f() return f() end return f()", "stack overflow"},
+		{"error inside a function", "local function f()\nerror('boom')\nend\nf()", "user_script:2: boom"},
+		{"calling a non-function", "local x = 1 return x()", "attempt to call a number value"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := runLua(t, tc.src); err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("error = %v, want one containing %q", err, tc.want)
+			}
+		})
+	}
+	for _, src := range []string{"local function f(...) end", "local t = {} function t:m() end"} {
+		if _, err := compileLua(src); err == nil {
+			t.Errorf("compileLua(%q) succeeded, want a syntax error", src)
+		}
+	}
+}
+
+func TestLuaArithmetic(t *testing.T) {
+	for _, tc := range []struct {
+		src  string
+		want any
+	}{
+		{"return 7 + 3 * 2", 13.0},
+		{"return (7 + 3) * 2", 20.0},
+		{"return 7 / 2", 3.5},
+		{"return 7 % 3", 1.0},
+		{"return -7 % 3", 2.0}, // Lua's modulo takes the divisor's sign.
+		{"return 2 ^ 10", 1024.0},
+		{"return 2 ^ 3 ^ 2", 512.0}, // ^ is right associative.
+		{"return -2 ^ 2", -4.0},     // Unary minus binds looser than ^.
+		{"return '10' + 5", 15.0},   // Strings holding numbers coerce.
+		{"return 1 / 0 > 1e308", true},
+		{"return 10 .. 20", "1020"},
+		{"return 1 < 2 and 'a' < 'b' and 2 >= 2", true},
+		{"return 1 == '1'", false},
+		{"return nil or false", false},
+		{"return 0 and 'zero is true'", "zero is true"},
+		{"return not nil", true},
+		{"return #'hello'", 5.0},
+		{"return math.floor(3.7) + math.max(1, 5, 3)", 8.0},
+		{"return string.format('%d-%s', 4, 'x')", "4-x"},
+		{"return tonumber('0x10')", 16.0},
+	} {
+		if got, err := runLua(t, tc.src); err != nil || got != tc.want {
+			t.Errorf("%s = %v, %v; want %v", tc.src, got, err, tc.want)
+		}
+	}
+}
+
+func TestLuaTables(t *testing.T) {
+	for _, tc := range []struct {
+		name, src string
+		want      any
+	}{
+		{"sequence length", "local t = {10, 20, 30} return #t", 3.0},
+		{"fields", "local t = {x = 1, ['y'] = 2} t.z = 3 return t.x + t.y + t['z']", 6.0},
+		{"missing field is nil", "local t = {} return t.nope == nil", true},
+		{"insert and remove", "local t = {} table.insert(t, 'a') table.insert(t, 'b') table.insert(t, 1, 'c') table.remove(t) return table.concat(t, ',')", "c,a"},
+		{"hash keys join the sequence", "local t = {} t[2] = 'b' t[1] = 'a' return #t", 2.0},
+		{"nil ends the sequence", "local t = {1, 2, 3} t[3] = nil return #t", 2.0},
+		{"ipairs in order", "local s = '' for i, v in ipairs({'a', 'b', 'c'}) do s = s .. i .. v end return s", "1a2b3c"},
+		{"pairs visits every key", "local n = 0 for k, v in pairs({1, 2, x = 3}) do n = n + v end return n", 6.0},
+		{"tables are references", "local a = {} local b = a b.x = 1 return a.x", 1.0},
+		{"tables equal only themselves", "return {} == {}", false},
+		{"KEYS is a table", "return type(KEYS)", "table"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got, err := runLua(t, tc.src); err != nil || got != tc.want {
+				t.Errorf("got %v, %v; want %v", got, err, tc.want)
+			}
+		})
+	}
+}
+
+func TestLuaRuntimeErrors(t *testing.T) {
+	for _, tc := range []struct{ name, src, want string }{
+		{"arithmetic on nil", "local x return x + 1", "attempt to perform arithmetic on a nil value"},
+		{"concatenating a table", "return 'a' .. {}", "attempt to concatenate a table value"},
+		{"comparing mixed types", "return 1 < 'a'", "attempt to compare number with string"},
+		{"indexing nil", "local x return x.y", "attempt to index a nil value"},
+		{"nil table key", "local t = {} t[nil] = 1", "table index is nil"},
+		{"creating a global", "x = 1", "Script attempted to create global variable 'x'"},
+		{"reading a missing global", "return nope", "Script attempted to access nonexistent global variable 'nope'"},
+		{"changing a library", "string.len = nil", "Attempt to modify a readonly table"},
+		{"error()", "error('custom failure')", "custom failure"},
+		{"for step zero", "for i = 1, 2, 0 do end", "'for' step is zero"},
+		{"runaway loop", "while true do end", "script exceeded"},
+		{"error line", "local a = 1\n\nreturn a + nil", "user_script:3:"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := runLua(t, tc.src)
+			if err == nil || !strings.HasPrefix(err.Error(), "Error running script: ") || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("error = %v, want a runtime error containing %q", err, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,755 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// This file compiles the subset of Lua 5.1 that EVAL scripts are written
+// in: local variables, assignment, if, while, repeat, numeric and generic
+// for, break, return, function definitions and closures, the Lua operators
+// and table constructors. Varargs and method calls are not supported, and
+// a function returns only its first value.
+
+// luaTokenKind classifies a token.
+type luaTokenKind int
+
+const (
+	luaEOF     luaTokenKind = iota
+	luaName                 // An identifier.
+	luaNumber               // A numeric literal.
+	luaString               // A string literal, unquoted.
+	luaKeyword              // A keyword or a symbol such as == or (.
+)
+
+// luaToken is one lexical token of a script.
+type luaToken struct {
+	kind luaTokenKind
+	text string  // The name, keyword, symbol or string contents.
+	num  float64 // The value of a number.
+	line int
+}
+
+// luaKeywords are the reserved words of Lua.
+var luaKeywords = map[string]bool{
+	"and": true, "break": true, "do": true, "else": true, "elseif": true, "end": true,
+	"false": true, "for": true, "function": true, "if": true, "in": true, "local": true,
+	"nil": true, "not": true, "or": true, "repeat": true, "return": true, "then": true,
+	"true": true, "until": true, "while": true,
+}
+
+// luaSymbols are the symbols of Lua, longest first so they match greedily.
+var luaSymbols = []string{
+	"...", "..", "==", "~=", "<=", ">=",
+	"+", "-", "*", "/", "%", "^", "#", "<", ">", "=",
+	"(", ")", "{", "}", "[", "]", ";", ":", ",", ".",
+}
+
+// luaSyntaxError is a compile error, raised by the lexer and parser as a
+// panic and returned by compileLua.
+type luaSyntaxError struct {
+	line int
+	msg  string
+}
+
+// Error formats the error as Redis does for a script that does not compile.
+func (e *luaSyntaxError) Error() string {
+	return fmt.Sprintf("Error compiling script: user_script:%d: %s", e.line, e.msg)
+}
+
+// luaFail raises a syntax error at line.
+func luaFail(line int, format string, args ...any) {
+	panic(&luaSyntaxError{line, fmt.Sprintf(format, args...)})
+}
+
+// lexLua splits a script into tokens.
+func lexLua(src string) []luaToken {
+	var toks []luaToken
+	line := 1
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case strings.HasPrefix(src[i:], "--"):
+			i += 2
+			if level, ok := longBracket(src[i:]); ok {
+				end := strings.Index(src[i:], "]"+strings.Repeat("=", level)+"]")
+				if end < 0 {
+					luaFail(line, "unfinished long comment")
+				}
+				line += strings.Count(src[i:i+end], "\n")
+				i += end + level + 2
+				continue
+			}
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case isLuaLetter(c):
+			start := i
+			for i < len(src) && (isLuaLetter(src[i]) || isDigit(src[i])) {
+				i++
+			}
+			word := src[start:i]
+			kind := luaName
+			if luaKeywords[word] {
+				kind = luaKeyword
+			}
+			toks = append(toks, luaToken{kind: kind, text: word, line: line})
+		case isDigit(c) || c == '.' && i+1 < len(src) && isDigit(src[i+1]):
+			start := i
+			if strings.HasPrefix(src[i:], "0x") || strings.HasPrefix(src[i:], "0X") {
+				i += 2
+			}
+			for i < len(src) && (isDigit(src[i]) || isLuaLetter(src[i]) || src[i] == '.' ||
+				(src[i] == '+' || src[i] == '-') && (src[i-1] == 'e' || src[i-1] == 'E')) {
+				i++
+			}
+			n, ok := parseLuaNumber(src[start:i])
+			if !ok {
+				luaFail(line, "malformed number near '%s'", src[start:i])
+			}
+			toks = append(toks, luaToken{kind: luaNumber, num: n, line: line})
+		case c == '"' || c == '\'':
+			s, n := lexLuaString(src[i:], line)
+			toks = append(toks, luaToken{kind: luaString, text: s, line: line})
+			i += n
+		case c == '[':
+			if level, ok := longBracket(src[i:]); ok {
+				body := src[i+level+2:]
+				end := strings.Index(body, "]"+strings.Repeat("=", level)+"]")
+				if end < 0 {
+					luaFail(line, "unfinished long string")
+				}
+				s := strings.TrimPrefix(body[:end], "\n") // A first newline is skipped.
+				toks = append(toks, luaToken{kind: luaString, text: s, line: line})
+				line += strings.Count(body[:end], "\n")
+				i += level + 2 + end + level + 2
+				continue
+			}
+			fallthrough
+		default:
+			sym := ""
+			for _, s := range luaSymbols {
+				if strings.HasPrefix(src[i:], s) {
+					sym = s
+					break
+				}
+			}
+			if sym == "" {
+				luaFail(line, "unexpected symbol near '%c'", c)
+			}
+			toks = append(toks, luaToken{kind: luaKeyword, text: sym, line: line})
+			i += len(sym)
+		}
+	}
+	return append(toks, luaToken{kind: luaEOF, line: line})
+}
+
+// isLuaLetter reports whether c may start an identifier.
+func isLuaLetter(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// isDigit reports whether c is a decimal digit.
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// longBracket reports whether s starts with a long bracket, [[ or [=[ and
+// so on, and returns its level, the number of equals signs.
+func longBracket(s string) (int, bool) {
+	if !strings.HasPrefix(s, "[") {
+		return 0, false
+	}
+	level := 0
+	for level+1 < len(s) && s[level+1] == '=' {
+		level++
+	}
+	return level, level+1 < len(s) && s[level+1] == '['
+}
+
+// parseLuaNumber parses a numeric literal or, for tonumber and arithmetic
+// on strings, a numeric string.
+func parseLuaNumber(s string) (float64, bool) {
+	s = strings.TrimSpace(s)
+	if hex, ok := strings.CutPrefix(strings.ToLower(s), "0x"); ok {
+		n, err := strconv.ParseUint(hex, 16, 64)
+		return float64(n), err == nil
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || strings.ContainsAny(s, "nN_") { // Not inf, nan or Go's digit separators.
+		return 0, false
+	}
+	return n, true
+}
+
+// lexLuaString reads a quoted string at the start of s, returning its
+// contents and the length of the literal.
+func lexLuaString(s string, line int) (string, int) {
+	quote := s[0]
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == quote:
+			return b.String(), i + 1
+		case c == '\n':
+			luaFail(line, "unfinished string")
+		case c == '\\' && i+1 < len(s):
+			i++
+			switch e := s[i]; e {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case 'a':
+				b.WriteByte('\a')
+			case 'b':
+				b.WriteByte('\b')
+			case 'f':
+				b.WriteByte('\f')
+			case 'v':
+				b.WriteByte('\v')
+			case '\n':
+				b.WriteByte('\n')
+			default:
+				if !isDigit(e) {
+					b.WriteByte(e) // \\, \" and \' stand for themselves.
+					continue
+				}
+				n, j := 0, i
+				for ; j < len(s) && j < i+3 && isDigit(s[j]); j++ {
+					n = n*10 + int(s[j]-'0')
+				}
+				if n > 255 {
+					luaFail(line, "escape sequence too large")
+				}
+				b.WriteByte(byte(n))
+				i = j - 1
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	luaFail(line, "unfinished string")
+	return "", 0
+}
+
+// Expressions of a compiled script.
+type (
+	luaExpr any
+
+	luaConst struct{ value any } // nil, a bool, a float64 or a string.
+	luaVar   struct{ name string }
+	luaIndex struct {
+		obj, key luaExpr
+		line     int
+	}
+	luaCall struct {
+		fn   luaExpr
+		args []luaExpr
+		line int
+	}
+	luaBinary struct {
+		op          string
+		left, right luaExpr
+		line        int
+	}
+	luaUnary struct {
+		op      string
+		operand luaExpr
+		line    int
+	}
+	luaTableCons struct {
+		keys   []luaExpr // nil for a positional field.
+		values []luaExpr
+	}
+	luaFunction struct {
+		params []string
+		body   []luaStmt
+	}
+)
+
+// Statements of a compiled script.
+type (
+	// luaStmt is a statement node with the line it starts on.
+	luaStmt struct {
+		line int
+		node any
+	}
+
+	luaLocal struct {
+		names []string
+		exprs []luaExpr
+	}
+	luaLocalFunction struct { // local function name, which can call itself.
+		name string
+		fn   *luaFunction
+	}
+	luaAssign struct {
+		targets []luaExpr // luaVar or luaIndex.
+		exprs   []luaExpr
+	}
+	luaCallStmt struct{ call *luaCall }
+	luaIf       struct {
+		conds  []luaExpr
+		blocks [][]luaStmt // One per cond.
+		orElse []luaStmt
+	}
+	luaWhile struct {
+		cond luaExpr
+		body []luaStmt
+	}
+	luaRepeat struct {
+		body []luaStmt
+		cond luaExpr
+	}
+	luaNumFor struct {
+		name               string
+		start, limit, step luaExpr // step is nil for the default of 1.
+		body               []luaStmt
+	}
+	luaGenFor struct {
+		names []string
+		iter  luaExpr
+		body  []luaStmt
+	}
+	luaDo     struct{ body []luaStmt }
+	luaReturn struct{ exprs []luaExpr }
+	luaBreak  struct{}
+)
+
+// luaChunk is a compiled script.
+type luaChunk struct {
+	body []luaStmt
+}
+
+// compileLua compiles a script.
+func compileLua(src string) (chunk *luaChunk, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			syntaxErr, ok := r.(*luaSyntaxError)
+			if !ok {
+				panic(r) // A bug, not a bad script.
+			}
+			err = syntaxErr
+		}
+	}()
+	p := &luaParser{toks: lexLua(src)}
+	body := p.block()
+	if tok := p.peek(); tok.kind != luaEOF {
+		luaFail(tok.line, "'<eof>' expected near '%s'", tok.text)
+	}
+	return &luaChunk{body: body}, nil
+}
+
+// luaParser is a recursive descent parser over the tokens of a script.
+type luaParser struct {
+	toks []luaToken
+	pos  int
+}
+
+// peek returns the next token without consuming it.
+func (p *luaParser) peek() luaToken { return p.toks[p.pos] }
+
+// next consumes and returns the next token.
+func (p *luaParser) next() luaToken {
+	tok := p.toks[p.pos]
+	if tok.kind != luaEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// is reports whether the next token is the keyword or symbol text.
+func (p *luaParser) is(text string) bool {
+	tok := p.peek()
+	return tok.kind == luaKeyword && tok.text == text
+}
+
+// accept consumes the keyword or symbol text if it comes next.
+func (p *luaParser) accept(text string) bool {
+	if p.is(text) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+// expect consumes the keyword or symbol text, failing if it is not next.
+func (p *luaParser) expect(text string) {
+	if !p.accept(text) {
+		tok := p.peek()
+		luaFail(tok.line, "'%s' expected near '%s'", text, tokenText(tok))
+	}
+}
+
+// name consumes an identifier and returns it.
+func (p *luaParser) name() string {
+	tok := p.next()
+	if tok.kind != luaName {
+		luaFail(tok.line, "<name> expected near '%s'", tokenText(tok))
+	}
+	return tok.text
+}
+
+// tokenText describes a token for an error message.
+func tokenText(tok luaToken) string {
+	switch tok.kind {
+	case luaEOF:
+		return "<eof>"
+	case luaNumber:
+		return luaFormatNumber(tok.num)
+	}
+	return tok.text
+}
+
+// blockEnd reports whether the next token ends a block.
+func (p *luaParser) blockEnd() bool {
+	tok := p.peek()
+	if tok.kind == luaEOF {
+		return true
+	}
+	if tok.kind != luaKeyword {
+		return false
+	}
+	switch tok.text {
+	case "end", "else", "elseif", "until":
+		return true
+	}
+	return false
+}
+
+// block parses statements up to the end of a block. A return or break
+// must be the last statement, as in Lua.
+func (p *luaParser) block() []luaStmt {
+	var stmts []luaStmt
+	for !p.blockEnd() {
+		if p.accept(";") {
+			continue
+		}
+		line := p.peek().line
+		stmt := p.statement()
+		stmts = append(stmts, luaStmt{line, stmt})
+		switch stmt.(type) {
+		case *luaReturn, *luaBreak:
+			p.accept(";")
+			if !p.blockEnd() {
+				tok := p.peek()
+				luaFail(tok.line, "'end' expected near '%s'", tokenText(tok))
+			}
+		}
+	}
+	return stmts
+}
+
+// statement parses one statement and returns its node.
+func (p *luaParser) statement() any {
+	tok := p.peek()
+	if tok.kind == luaKeyword {
+		switch tok.text {
+		case "local":
+			p.next()
+			if p.accept("function") {
+				return &luaLocalFunction{name: p.name(), fn: p.functionBody()}
+			}
+			stmt := &luaLocal{names: p.names()}
+			if p.accept("=") {
+				stmt.exprs = p.exprList()
+			}
+			return stmt
+		case "if":
+			p.next()
+			stmt := &luaIf{}
+			for {
+				stmt.conds = append(stmt.conds, p.expr(0))
+				p.expect("then")
+				stmt.blocks = append(stmt.blocks, p.block())
+				if !p.accept("elseif") {
+					break
+				}
+			}
+			if p.accept("else") {
+				stmt.orElse = p.block()
+			}
+			p.expect("end")
+			return stmt
+		case "while":
+			p.next()
+			cond := p.expr(0)
+			p.expect("do")
+			body := p.block()
+			p.expect("end")
+			return &luaWhile{cond, body}
+		case "repeat":
+			p.next()
+			body := p.block()
+			p.expect("until")
+			return &luaRepeat{body, p.expr(0)}
+		case "for":
+			p.next()
+			return p.forStatement()
+		case "do":
+			p.next()
+			body := p.block()
+			p.expect("end")
+			return &luaDo{body}
+		case "return":
+			p.next()
+			stmt := &luaReturn{}
+			if !p.blockEnd() && !p.is(";") {
+				stmt.exprs = p.exprList()
+			}
+			return stmt
+		case "break":
+			p.next()
+			return &luaBreak{}
+		case "function":
+			p.next()
+			var target luaExpr = &luaVar{p.name()}
+			for p.is(".") {
+				dot := p.next()
+				target = &luaIndex{obj: target, key: &luaConst{p.name()}, line: dot.line}
+			}
+			if p.is(":") {
+				luaFail(tok.line, "method calls are not supported")
+			}
+			return &luaAssign{targets: []luaExpr{target}, exprs: []luaExpr{p.functionBody()}}
+		}
+	}
+	target := p.suffixed()
+	if p.is("=") || p.is(",") {
+		stmt := &luaAssign{targets: []luaExpr{p.assignable(target, tok.line)}}
+		for p.accept(",") {
+			stmt.targets = append(stmt.targets, p.assignable(p.suffixed(), tok.line))
+		}
+		p.expect("=")
+		stmt.exprs = p.exprList()
+		return stmt
+	}
+	call, ok := target.(*luaCall)
+	if !ok {
+		luaFail(tok.line, "syntax error near '%s'", tokenText(p.peek()))
+	}
+	return &luaCallStmt{call}
+}
+
+// assignable checks that target can be assigned to.
+func (p *luaParser) assignable(target luaExpr, line int) luaExpr {
+	switch target.(type) {
+	case *luaVar, *luaIndex:
+		return target
+	}
+	luaFail(line, "syntax error near '='")
+	return nil
+}
+
+// forStatement parses the rest of a numeric or generic for loop.
+func (p *luaParser) forStatement() any {
+	names := p.names()
+	if len(names) == 1 && p.accept("=") {
+		stmt := &luaNumFor{name: names[0]}
+		stmt.start = p.expr(0)
+		p.expect(",")
+		stmt.limit = p.expr(0)
+		if p.accept(",") {
+			stmt.step = p.expr(0)
+		}
+		p.expect("do")
+		stmt.body = p.block()
+		p.expect("end")
+		return stmt
+	}
+	p.expect("in")
+	stmt := &luaGenFor{names: names, iter: p.expr(0)}
+	p.expect("do")
+	stmt.body = p.block()
+	p.expect("end")
+	return stmt
+}
+
+// functionBody parses the parameters and body of a function, after its name
+// if it has one, up to the closing end.
+func (p *luaParser) functionBody() *luaFunction {
+	p.expect("(")
+	fn := &luaFunction{}
+	for !p.is(")") {
+		if tok := p.peek(); tok.kind == luaKeyword && tok.text == "..." {
+			luaFail(tok.line, "varargs are not supported; use KEYS and ARGV")
+		}
+		fn.params = append(fn.params, p.name())
+		if !p.accept(",") {
+			break
+		}
+	}
+	p.expect(")")
+	fn.body = p.block()
+	p.expect("end")
+	return fn
+}
+
+// names parses a comma-separated list of identifiers.
+func (p *luaParser) names() []string {
+	names := []string{p.name()}
+	for p.accept(",") {
+		names = append(names, p.name())
+	}
+	return names
+}
+
+// exprList parses a comma-separated list of expressions.
+func (p *luaParser) exprList() []luaExpr {
+	exprs := []luaExpr{p.expr(0)}
+	for p.accept(",") {
+		exprs = append(exprs, p.expr(0))
+	}
+	return exprs
+}
+
+// luaPriority gives each binary operator its left and right priority, as
+// in the Lua parser; a right priority below the left makes it right
+// associative.
+var luaPriority = map[string][2]int{
+	"or": {1, 1}, "and": {2, 2},
+	"<": {3, 3}, ">": {3, 3}, "<=": {3, 3}, ">=": {3, 3}, "~=": {3, 3}, "==": {3, 3},
+	"..": {5, 4},
+	"+":  {6, 6}, "-": {6, 6},
+	"*": {7, 7}, "/": {7, 7}, "%": {7, 7},
+	"^": {10, 9},
+}
+
+// luaUnaryPriority binds unary operators tighter than everything but ^.
+const luaUnaryPriority = 8
+
+// expr parses an expression whose binary operators bind tighter than
+// limit.
+func (p *luaParser) expr(limit int) luaExpr {
+	var left luaExpr
+	if tok := p.peek(); tok.kind == luaKeyword && (tok.text == "not" || tok.text == "-" || tok.text == "#") {
+		p.next()
+		left = &luaUnary{op: tok.text, operand: p.expr(luaUnaryPriority), line: tok.line}
+	} else {
+		left = p.simple()
+	}
+	for {
+		tok := p.peek()
+		prio, ok := luaPriority[tok.text]
+		if tok.kind != luaKeyword || !ok || prio[0] <= limit {
+			return left
+		}
+		p.next()
+		left = &luaBinary{op: tok.text, left: left, right: p.expr(prio[1]), line: tok.line}
+	}
+}
+
+// simple parses a literal, a table constructor or a suffixed expression.
+func (p *luaParser) simple() luaExpr {
+	tok := p.peek()
+	switch tok.kind {
+	case luaNumber:
+		p.next()
+		return &luaConst{tok.num}
+	case luaString:
+		p.next()
+		return &luaConst{tok.text}
+	case luaKeyword:
+		switch tok.text {
+		case "nil":
+			p.next()
+			return &luaConst{nil}
+		case "true":
+			p.next()
+			return &luaConst{true}
+		case "false":
+			p.next()
+			return &luaConst{false}
+		case "{":
+			return p.table()
+		case "function":
+			p.next()
+			return p.functionBody()
+		case "...":
+			luaFail(tok.line, "varargs are not supported; use KEYS and ARGV")
+		}
+	}
+	return p.suffixed()
+}
+
+// suffixed parses a name or parenthesized expression followed by any
+// number of field accesses, indexes and calls.
+func (p *luaParser) suffixed() luaExpr {
+	tok := p.next()
+	var e luaExpr
+	switch {
+	case tok.kind == luaName:
+		e = &luaVar{tok.text}
+	case tok.kind == luaKeyword && tok.text == "(":
+		e = p.expr(0)
+		p.expect(")")
+	default:
+		luaFail(tok.line, "unexpected symbol near '%s'", tokenText(tok))
+	}
+	for {
+		tok := p.peek()
+		switch {
+		case tok.kind == luaKeyword && tok.text == ".":
+			p.next()
+			e = &luaIndex{obj: e, key: &luaConst{p.name()}, line: tok.line}
+		case tok.kind == luaKeyword && tok.text == "[":
+			p.next()
+			key := p.expr(0)
+			p.expect("]")
+			e = &luaIndex{obj: e, key: key, line: tok.line}
+		case tok.kind == luaKeyword && tok.text == "(":
+			p.next()
+			call := &luaCall{fn: e, line: tok.line}
+			if !p.is(")") {
+				call.args = p.exprList()
+			}
+			p.expect(")")
+			e = call
+		case tok.kind == luaString:
+			p.next()
+			e = &luaCall{fn: e, args: []luaExpr{&luaConst{tok.text}}, line: tok.line}
+		case tok.kind == luaKeyword && tok.text == "{":
+			e = &luaCall{fn: e, args: []luaExpr{p.table()}, line: tok.line}
+		case tok.kind == luaKeyword && tok.text == ":":
+			luaFail(tok.line, "method calls are not supported")
+		default:
+			return e
+		}
+	}
+}
+
+// table parses a table constructor.
+func (p *luaParser) table() luaExpr {
+	p.expect("{")
+	t := &luaTableCons{}
+	for !p.is("}") {
+		var key luaExpr
+		switch {
+		case p.is("["):
+			p.next()
+			key = p.expr(0)
+			p.expect("]")
+			p.expect("=")
+		case p.peek().kind == luaName && p.toks[p.pos+1].kind == luaKeyword && p.toks[p.pos+1].text == "=":
+			key = &luaConst{p.name()}
+			p.next() // The =.
+		}
+		t.keys = append(t.keys, key)
+		t.values = append(t.values, p.expr(0))
+		if !p.accept(",") && !p.accept(";") {
+			break
+		}
+	}
+	p.expect("}")
+	return t
+}
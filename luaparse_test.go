@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompileLua(t *testing.T) {
+	for _, tc := range []struct {
+		name, src string
+	}{
+		{"empty", ""},
+		{"return", "return 1"},
+		{"locals and assignment", "local a, b = 1, 2; a, b = b, a"},
+		{"if chain", "local x = 1 if x == 1 then x = 2 elseif x == 2 then x = 3 else x = 4 end"},
+		{"loops", "local n = 0 while n < 3 do n = n + 1 end repeat n = n - 1 until n == 0 for i = 1, 10, 2 do end for k, v in pairs({}) do end"},
+		{"do block and break", "do local x = 1 end while true do break end"},
+		{"table constructors", "local t = {1, 2; x = 3, ['y z'] = 4, [5] = 6,}"},
+		{"calls without parentheses", "local s = tostring 'a' local t = type {}"},
+		{"long strings and comments", "--[[ block\ncomment ]] local s = [==[raw ]] text]==] -- line comment"},
+		{"escapes", `local s = "tab\t nl\n quote\" byte\65 \\"`},
+		{"numbers", "local a, b, c = 0x1F, 1.5e3, .5"},
+		{"operator precedence", "return 1 + 2 * 3 ^ 2 ^ 0.5 .. 'x' == 'y' or not nil and -#'abc'"},
+		{"functions", "local function f(a, b) return a end local g = function() end"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := compileLua(tc.src); err != nil {
+				t.Errorf("compileLua(%q): %v", tc.src, err)
+			}
+		})
+	}
+}
+
+func TestCompileLuaErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name, src, want string
+	}{
+		{"unclosed block", "if true then", "user_script:1: 'end' expected near '<eof>'"},
+		{"statement after return", "return 1 local x = 2", "'end' expected near 'local'"},
+		{"missing then", "if true return end", "'then' expected near 'return'"},
+		{"bad assignment target", "f() = 1", "syntax error near '='"},
+		{"expression statement", "local x = 1\nx", "user_script:2: syntax error"},
+		{"unfinished string", "local s = 'abc", "unfinished string"},
+		{"unfinished long string", "local s = [[abc", "unfinished long string"},
+		{"malformed number", "local n = 1e", "malformed number near '1e'"},
+		{"unexpected symbol", "local x = @", "unexpected symbol near '@'"},
+		{"varargs", "return ...", "varargs are not supported"},
+		{"method call", "local t = {} t:m()", "method calls are not supported"},
+		{"error line", "local a = 1\nlocal b = 2\nlocal = 3", "user_script:3:"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := compileLua(tc.src)
+			if err == nil || !strings.HasPrefix(err.Error(), "Error compiling script: ") || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("compileLua(%q) = %v, want a compile error containing %q", tc.src, err, tc.want)
+			}
+		})
+	}
+}
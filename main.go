@@ -1,79 +1,582 @@
 package main
 
 import (
-	"encoding/gob"
-	"os"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// ErrWrongType is returned when an operation targets a key holding a value
+// of a different kind, e.g. a set command on a plain string.
+var ErrWrongType = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+
 // DataBase represents a thread-safe in-memory key-value store.
 type DataBase struct {
-	data map[string]any // The map to store key-value pairs.
-	lock sync.RWMutex   // A read-write mutex to ensure thread safety.
+	data *dict[any] // The map to store key-value pairs.
+	lock dbLock     // A read-write mutex to ensure thread safety.
+
+	keyLocks   map[string]*keyLock // Per-key locks used by WithKeys.
+	keyLocksMu sync.Mutex          // Guards the keyLocks table.
+
+	logger *slog.Logger // Structured logger for background and persistence events.
+
+	expires         *expiryTable                    // Key deadlines for keys with a TTL.
+	fieldExpires    map[string]map[string]time.Time // Hash field deadlines, keyed by key then field.
+	expireCallbacks []func(key string, value any)   // Registered by OnExpire.
+	pendingExpired  []expiredKey                    // Expired under the lock, awaiting callbacks.
+
+	tagKeys map[string]map[string]struct{} // Keys by tag, set by Tag; nil until used.
+	keyTags map[string]map[string]struct{} // Tags by key, the inverse of tagKeys.
+
+	sweepInterval time.Duration  // How often the background sweeper runs.
+	sweepReset    chan struct{}  // Tells the sweeper its interval changed.
+	stop          chan struct{}  // Closed by Close to stop background goroutines.
+	closeOnce     sync.Once      // Makes Close idempotent.
+	wg            sync.WaitGroup // Tracks running background goroutines.
+
+	latency latencyTracker // Per-method latency histograms; nil when disabled.
+
+	deletes          int // Keys deleted since the last compaction.
+	compactThreshold int // Deletes that trigger an automatic Compact; 0 disables.
+
+	backend Backend // Where snapshots are stored.
+	atRest  *atRest // Set by WithAtRest; nil stores files as they are.
+
+	saves         map[string]*sync.Mutex // One lock per snapshot name being written.
+	savesMu       sync.Mutex             // Guards the saves table.
+	failFastSaves bool                   // Overlapping saves fail instead of waiting.
+
+	policies map[string]Policy // Value constraints by key prefix.
+
+	clock Clock       // Time source for expiration.
+	rand  *lockedRand // Random source for SRandMember, SPop and friends.
+
+	lazyFree chan any // Large values unlinked by Unlink, awaiting release.
+
+	versions map[string]uint64 // Version of each key, bumped on every write.
+	writeSeq uint64            // Last version handed out.
+
+	tombstones     map[string]uint64 // Version of the deletion of each deleted key, for Watch.
+	tombstoneFloor uint64            // writeSeq when tombstones were last dropped.
+
+	hot *hotKeyTracker // Sampled access counts for HotKeys; nil when disabled.
+
+	defaultTTL time.Duration // TTL applied by plain Set; 0 means none.
+
+	mapped bool // Some values may still live in a mapping (see OpenMMapped).
+
+	encoding EncodingThresholds // Limits used by Encoding.
+
+	bgsave *bgSnapshot            // The running BGSave, whose view writers preserve.
+	views  map[*Snapshot]struct{} // Open Views, whose state writers preserve too.
+
+	recency *recencyList // Keys in access order; nil when not tracked.
+
+	pubsub *pubSub // Pub/Sub subscriptions.
+
+	dirty        atomic.Int64  // Changes since the last successful save.
+	saveSchedule *saveSchedule // Set by SaveRules; nil disables automatic saves.
+	saveInterval time.Duration // Wait of the SaveEvery fallback rule.
+	saveKick     chan struct{} // Wakes the saver when the threshold is reached.
+	saverStarted bool          // The saver goroutine is running.
+	breaker      saveBreaker   // Pauses the saver while saves keep failing.
+
+	artificialLatency atomic.Int64 // Testing delay per operation, in nanoseconds.
+
+	maxMemory      int64            // Memory budget set by SetMaxMemory; 0 is unlimited.
+	evictionPolicy EvictionPolicy   // What to do once over budget.
+	memUsed        int64            // Running estimate of memory used by all keys.
+	keySizes       map[string]int64 // Estimated size per key; nil while untracked.
+	evictions      uint64           // Keys evicted to stay under budget.
+
+	asyncQueue   chan asyncOp // Writes queued by SetAsync; nil when disabled.
+	asyncPending atomic.Int64 // Queued writes not yet applied, including one in progress.
+
+	readOnly bool // Writes are refused (see SetReadOnly and Drain).
+
+	serversMu sync.Mutex           // Guards servers.
+	servers   map[*Server]struct{} // Servers made by NewServer and not yet closed, for Shutdown.
+
+	getHooks hookList[GetHook] // Registered by OnGet.
+	setHooks hookList[SetHook] // Registered by OnSet.
+	tracer   Tracer            // Traces GetCtx and SetCtx; nil when disabled.
+
+	audit atomic.Pointer[auditLog] // Set by EnableAuditLog.
+
+	hits   atomic.Uint64 // Key reads that found their key, for Stats.
+	misses atomic.Uint64 // Key reads that did not.
+	writes atomic.Uint64 // Key writes, for Info.
+
+	started  time.Time    // When NewDataBase returned the database, for Info.
+	opsRate  opsSampler   // Operations per second, for Info.
+	lastSave atomic.Int64 // Unix nanoseconds of the last snapshot saved; 0 if none.
+	clients  atomic.Int64 // Connections open on Servers for the database.
+
+	goroutines atomic.Int32 // Background goroutines running, for ActiveGoroutines.
+
+	scripts    map[string]Script    // Registered by RegisterScript.
+	luaScripts map[string]*luaChunk // Cached by EvalScript and ScriptLoad, by SHA1.
+
+	defaultProvider func(key string) any // Consulted by GetOrDefault; nil when unset.
+
+	priorVersions map[string][]any // Values replaced by SetVersioned, newest first.
+
+	history *historyTracker // Recent changes per key; nil when not recorded.
+
+	lfu *lfuTracker // Access frequency per key; nil when not tracked.
+
+	aof *aofLog // Set by EnableAOF; nil when changes are not logged.
+
+	notify keyNotifier // Watchers registered by Notify.
+	waits  keyWaiters  // Calls blocked until a key is written, such as BLPop.
+
+	unflushed map[string]struct{} // Keys changed under the write lock, for the AOF and replicas.
+	feeds     replicaFeeds        // Streams to connected replicas.
+	replica   *replicaLink        // Link to the primary; nil unless ReplicaOf.
+	replMu    sync.Mutex          // Serializes ReplicaOf.
+	replTLS   *tls.Config         // Set by WithReplicationTLS.
 }
 
-// NewDataBase initializes and returns a new instance of DataBase.
-func NewDataBase() *DataBase {
-	return &DataBase{
-		data: make(map[string]any), // Initialize the map.
+// NewDataBase initializes and returns a new instance of DataBase,
+// applying any options in order.
+func NewDataBase(opts ...Option) *DataBase {
+	db := &DataBase{
+		data:          newDict[any](),                        // Initialize the map.
+		logger:        slog.New(slog.DiscardHandler),         // Silent unless configured.
+		expires:       newExpiryTable(),                      // No TTLs yet.
+		fieldExpires:  make(map[string]map[string]time.Time), // No field TTLs yet.
+		sweepInterval: defaultSweepInterval,
+		sweepReset:    make(chan struct{}, 1),
+		backend:       FileBackend{}, // Snapshots go to local files by default.
+		clock:         realClock{},   // Expire against the system clock.
+		rand:          newLockedRand(rand.Uint64(), rand.Uint64()),
+		stop:          make(chan struct{}),
+		lazyFree:      make(chan any, lazyFreeBacklog),
+		versions:      make(map[string]uint64),
+		tombstones:    make(map[string]uint64),
+		encoding:      defaultEncodingThresholds,
+		pubsub:        newPubSub(),
+		saveInterval:  defaultSaveInterval,
+		saveKick:      make(chan struct{}, 1),
+		breaker:       saveBreaker{limit: defaultBreakerFailures, cooldown: defaultBreakerCooldown},
+	}
+	for _, opt := range opts {
+		opt(db) // Apply caller-supplied configuration.
+	}
+	if _, ok := db.backend.(atRestBackend); !ok {
+		db.backend = atRestBackend{db.backend, db.atRest} // Detects the at-rest formats even without WithAtRest.
 	}
+	db.started = db.clock.Now() // After WithClock, if given.
+	db.opsRate.at = db.started
+	db.startSweeper()  // Actively expire data in the background.
+	db.startLazyFree() // Release unlinked values in the background.
+	if db.asyncQueue != nil {
+		db.startApplier() // Apply queued async writes.
+	}
+	return db
+}
+
+// Set adds or updates a key-value pair in the database. The key expires
+// after the default TTL if one is configured (see SetDefaultTTL).
+// It returns a *PolicyError if the value violates the key's prefix policy,
+// and ErrOOM if it would exceed a NoEviction memory budget (see SetMaxMemory).
+// While the database is read-only (see Drain) it returns ErrReadOnly.
+func (db *DataBase) Set(key string, value any) error {
+	err := db.set(key, value, false)
+	db.runSetHooks(context.Background(), key, value, err)
+	return err
 }
 
-// Set adds or updates a key-value pair in the database.
-func (db *DataBase) Set(key string, value any) {
-	db.lock.Lock()         // Acquire a write lock.
-	defer db.lock.Unlock() // Release the lock when the function exits.
-	db.data[key] = value   // Store the key-value pair.
+// set implements Set. Queued writes accepted by SetAsync before the database
+// turned read-only are still applied.
+func (db *DataBase) set(key string, value any, queued bool) error {
+	db.injectLatency()
+	if db.latency != nil {
+		defer db.latency["Set"].observe(time.Now()) // Time the call, including lock wait.
+	}
+	if db.hot != nil {
+		db.hot.record(key) // Sample the access for HotKeys.
+	}
+	db.lock.Lock()    // Acquire a write lock.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	if db.readOnly && !queued {
+		return ErrReadOnly
+	}
+	return db.setChecked(key, value)
+}
+
+// setChecked stores a value as Set does, enforcing the prefix policy and
+// memory budget and applying the default TTL. The caller must hold the
+// write lock.
+func (db *DataBase) setChecked(key string, value any) error {
+	if err := db.checkPolicy(key, value); err != nil {
+		return err // Leave the old value in place.
+	}
+	if err := db.checkOOM(key, value); err != nil {
+		return err
+	}
+	db.setLocked(key, value)
+	if db.defaultTTL > 0 {
+		db.expires.set(key, db.clock.Now().Add(db.defaultTTL)) // Cache-style default expiry.
+	}
+	return nil
+}
+
+// setLocked stores a value, discarding any TTLs of the previous value.
+// The caller must hold the write lock.
+func (db *DataBase) setLocked(key string, value any) {
+	db.expireIfNeeded(key)       // Let an expired old value fire its callbacks.
+	db.data.set(key, value)      // Store the key-value pair.
+	db.expires.del(key)          // A plain write makes the key persistent.
+	delete(db.fieldExpires, key) // Field TTLs belonged to the replaced value.
+	db.touch(key)
 }
 
 // Get retrieves the value associated with a key from the database.
 // Returns the value and a boolean indicating if the key exists.
+// This is the fast path: container values are returned without copying and
+// alias the store, so they must not be modified. See GetCopy.
 func (db *DataBase) Get(key string) (any, bool) {
-	db.lock.RLock()         // Acquire a read lock.
-	defer db.lock.RUnlock() // Release the lock when the function exits.
-	value, exists := db.data[key]
+	value, exists := db.get(key)
+	db.runGetHooks(context.Background(), key, value, exists)
+	return value, exists
+}
+
+// get implements Get and GetCtx, without the hooks.
+func (db *DataBase) get(key string) (any, bool) {
+	db.injectLatency()
+	if db.latency != nil {
+		defer db.latency["Get"].observe(time.Now()) // Time the call, including lock wait.
+	}
+	if db.hot != nil {
+		db.hot.record(key) // Sample the access for HotKeys.
+	}
+	db.lock.RLock() // Acquire a read lock.
+	value, exists := db.data.get(key)
+	if exists && db.isExpired(key, db.clock.Now()) {
+		db.lock.RUnlock() // Upgrade to a write lock to remove the key lazily.
+		db.lock.Lock()
+		db.expireIfNeeded(key)         // Re-checks: another goroutine may have won.
+		value, exists = db.lookup(key) // The key may have been set again meanwhile.
+		db.unlock()
+		db.recordRead(exists)
+		return value, exists
+	}
+	if exists {
+		db.accessed(key)
+	}
+	db.lock.RUnlock() // Release the read lock.
+	db.recordRead(exists)
 	return value, exists
 }
 
+// Delete removes a key from the database.
+// Returns true if the key existed. While the database is read-only (see
+// Drain) nothing is deleted and it returns false.
+func (db *DataBase) Delete(key string) bool {
+	deleted := db.del(key, false)
+	db.audit.Load().record("del", key, nil, &deleted, nil)
+	return deleted
+}
+
+// Exists returns how many of keys exist, like Redis EXISTS: a key named
+// twice is counted twice. Unlike Get it does not count as an access. It
+// takes several keys so that EXISTS, MULTI and Sharded check a batch under
+// one lock; for a single key, Exists(key) == 1 is the yes-or-no test.
+func (db *DataBase) Exists(keys ...string) int {
+	db.lock.RLock()         // One read lock for the whole batch.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+	now, n := db.clock.Now(), 0
+	for _, key := range keys {
+		if db.data.has(key) && !db.isExpired(key, now) {
+			n++
+		}
+	}
+	return n
+}
+
+// del implements Delete, applying queued deletes like set.
+func (db *DataBase) del(key string, queued bool) bool {
+	db.injectLatency()
+	db.lock.Lock()    // Acquire a write lock.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	if db.readOnly && !queued {
+		return false
+	}
+	return db.delLocked(key)
+}
+
+// delLocked deletes key as Delete does. The caller must hold the write lock.
+func (db *DataBase) delLocked(key string) bool {
+	if db.expireIfNeeded(key) {
+		return false // It expired just now; that is not a deletion.
+	}
+	if _, exists := db.data.get(key); !exists {
+		return false // Nothing to delete.
+	}
+	db.removeKey(key)
+	return true
+}
+
+// DeleteIfEqual deletes key only if its value deep-equals expected, under
+// reflect.DeepEqual, and reports whether it did. The comparison and the
+// delete happen under one write lock, which makes it the safe way to release
+// a lock taken with MSetNX: a holder whose lock expired and was taken by
+// someone else leaves the new holder's lock alone. It returns false for a
+// missing key and while the database is read-only.
+func (db *DataBase) DeleteIfEqual(key string, expected any) bool {
+	db.lock.Lock()    // One lock for the comparison and the delete.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	if db.readOnly {
+		return false
+	}
+	db.expireIfNeeded(key)
+	value, exists := db.data.get(key)
+	if !exists || !reflect.DeepEqual(value, expected) {
+		return false // Someone else's value, or none at all.
+	}
+	db.removeKey(key)
+	return true
+}
+
+// UnencodableError reports the keys that Persist skipped because their values
+// could not be gob-encoded (for example channels or funcs).
+type UnencodableError struct {
+	Keys []string // The keys whose values were left out of the snapshot.
+}
+
+// Error implements the error interface, listing the offending keys.
+func (e *UnencodableError) Error() string {
+	return fmt.Sprintf("persist: skipped %d unencodable value(s): %s", len(e.Keys), strings.Join(e.Keys, ", "))
+}
+
+// PersistOptions leaves categories of keys out of a snapshot, for backups
+// that should hold only durable data. The zero value saves everything.
+type PersistOptions struct {
+	// SkipTypes lists value kinds to leave out, using the labels of
+	// Policy.Types, such as "list" or "hash".
+	SkipTypes []string
+
+	// SkipExpiring leaves out every key that has a TTL.
+	SkipExpiring bool
+}
+
+// skips reports whether a key holding value is left out of the snapshot.
+func (o PersistOptions) skips(value any, hasTTL bool) bool {
+	return (o.SkipExpiring && hasTTL) || slices.Contains(o.SkipTypes, kindOf(value))
+}
+
+// filtered reports whether the options leave anything out.
+func (o PersistOptions) filtered() bool {
+	return o.SkipExpiring || len(o.SkipTypes) > 0
+}
+
 // Persist saves the current state of the database to a file.
+// The snapshot is consistent: writers are held off by a read lock for the
+// whole save, so the file holds the store exactly as it was at one instant,
+// with no entry torn by a concurrent write. Reads carry on meanwhile; use
+// BGSave to avoid blocking writers on a large store.
+// Concurrent calls for the same file are serialized (see WithFailFastSaves).
+// Values that cannot be encoded are skipped rather than aborting the whole
+// snapshot; in that case the file is still written with every other key and
+// an *UnencodableError listing the skipped keys is returned.
 func (db *DataBase) Persist(fileName string) error {
-	db.lock.RLock()         // Acquire a read lock to ensure data consistency.
+	if db.latency != nil {
+		defer db.latency["Persist"].observe(time.Now()) // Time the whole save.
+	}
+	err := db.persist(context.Background(), fileName, PersistOptions{})
+	db.logSave(fileName, err)
+	return err
+}
+
+// PersistWithOptions saves the database to a file like Persist, leaving out
+// the keys excluded by opts. Loading the file restores only the keys that
+// were kept. Since a filtered snapshot is not a full copy of the data, it
+// does not count as a save for SaveEvery.
+func (db *DataBase) PersistWithOptions(fileName string, opts PersistOptions) error {
+	err := db.persist(context.Background(), fileName, opts)
+	db.logSave(fileName, err)
+	return err
+}
+
+// persist writes the snapshot; Persist wraps it with logging.
+func (db *DataBase) persist(ctx context.Context, fileName string, opts PersistOptions) (err error) {
+	release, err := db.acquireSave(fileName) // One writer per file at a time.
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	db.lock.RLock()         // Hold off writers so the snapshot is of one instant.
 	defer db.lock.RUnlock() // Release the lock when the function exits.
 
-	file, err := os.Create(fileName) // Create or overwrite the file.
+	if !opts.filtered() {
+		saved := db.dirty.Swap(0) // Writers are held off, so this is exact.
+		defer func() {
+			if saveFailed(err) {
+				db.dirty.Add(saved) // The changes are still unsaved.
+			}
+		}()
+	}
+	db.faultInMapped()                     // The target may be the mapped file itself.
+	file, err := db.backend.Save(fileName) // Create or overwrite the snapshot.
 	if err != nil {
 		return err // Return the error if file creation fails.
 	}
-	defer file.Close() // Ensure the file is closed after writing.
+	defer abortSave(file) // Keep the previous snapshot if writing fails.
 
-	encode := gob.NewEncoder(file) // Create a new encoder for the file.
-	if err := encode.Encode(db.data); err != nil {
-		return err // Return the error if encoding fails.
+	sw, err := newSnapshotWriter(withCtxWriter(ctx, file)) // Write the header.
+	if err != nil {
+		return err
+	}
+	var skipped []string // Keys whose values cannot be encoded.
+	now := db.clock.Now()
+	for key, value := range db.data.all() {
+		if db.isExpired(key, now) {
+			continue // Dead keys awaiting removal are not saved.
+		}
+		deadline, hasTTL := db.expires.get(key) // Zero for keys without a TTL.
+		if opts.skips(value, hasTTL) {
+			continue // Excluded from this snapshot by the caller.
+		}
+		err := sw.writeEntry(key, value, deadline)
+		if errors.Is(err, errUnencodable) {
+			skipped = append(skipped, key) // Remember the bad key and move on.
+			continue
+		}
+		if err != nil {
+			return err // Return the error if writing fails.
+		}
+	}
+	if err := sw.close(); err != nil {
+		return err
+	}
+	if err := syncFile(file); err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err // Closing commits the snapshot, so its error matters.
+	}
+	if len(skipped) > 0 {
+		sort.Strings(skipped)                   // Report the keys in a stable order.
+		return &UnencodableError{Keys: skipped} // The snapshot was saved without them.
 	}
 	return nil // Return nil if the operation is successful.
 }
 
-// Load restores the database state from a file.
+// logSave records the outcome of a snapshot write.
+func (db *DataBase) logSave(fileName string, err error) {
+	var unencodable *UnencodableError
+	switch {
+	case err == nil:
+		db.logger.Info("snapshot saved", "file", fileName)
+		db.lastSave.Store(db.clock.Now().UnixNano())
+	case errors.As(err, &unencodable):
+		db.logger.Warn("snapshot saved with skipped keys", "file", fileName, "skipped", unencodable.Keys)
+		db.lastSave.Store(db.clock.Now().UnixNano())
+	default:
+		db.logger.Error("snapshot save failed", "file", fileName, "err", err)
+	}
+}
+
+// Load restores the database state from a file. A read-only database loads
+// nothing and returns ErrReadOnly.
 func (db *DataBase) Load(fileName string) error {
-	db.lock.Lock()         // Acquire a write lock to modify the database.
-	defer db.lock.Unlock() // Release the lock when the function exits.
+	return db.LoadFiltered(fileName, nil)
+}
 
-	file, err := os.Open(fileName) // Open the file for reading.
+// LoadFiltered restores only the keys for which keep returns true, merging
+// them into the database. Records are streamed from the file and the values
+// of rejected keys are skipped without being decoded, so restoring a small
+// subset of a large snapshot stays cheap. A nil keep loads every key.
+func (db *DataBase) LoadFiltered(fileName string, keep func(key string) bool) error {
+	if db.latency != nil {
+		defer db.latency["Load"].observe(time.Now()) // Time the whole load.
+	}
+	err := db.load(context.Background(), fileName, keep)
+	if err != nil {
+		db.logger.Error("snapshot load failed", "file", fileName, "err", err)
+	} else {
+		db.logger.Info("snapshot loaded", "file", fileName)
+	}
+	return err
+}
+
+// load reads the snapshot; the exported loaders wrap it with logging.
+func (db *DataBase) load(ctx context.Context, fileName string, keep func(key string) bool) error {
+	file, err := db.backend.Load(fileName) // Open the snapshot for reading.
 	if err != nil {
 		return err // Return the error if file opening fails.
 	}
 	defer file.Close() // Ensure the file is closed after reading.
 
-	decode := gob.NewDecoder(file) // Create a new decoder for the file.
-	if err := decode.Decode(&db.data); err != nil {
+	loaded, err := readSnapshot(withCtxReader(ctx, file), keep, false) // Decode without holding the lock.
+	if err != nil {
 		return err // Return the error if decoding fails.
 	}
-	return nil // Return nil if the operation is successful.
+	return db.merge(loaded)
+}
+
+// LoadBestEffort salvages what it can from a damaged snapshot, such as one
+// truncated by a crash mid-write. Every complete record before the damage is
+// merged into the database, records whose values fail to decode are skipped,
+// and the number of keys recovered is returned together with the error that
+// stopped the read (nil if the whole file was intact). A file that fails its
+// checksum is still salvaged, with ErrChecksumMismatch in the error.
+func (db *DataBase) LoadBestEffort(fileName string) (loaded int, err error) {
+	file, err := db.backend.Load(fileName) // Open the snapshot for reading.
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close() // Ensure the file is closed after reading.
+
+	recovered, err := readSnapshot(file, nil, true) // Keep going past bad values.
+	if mergeErr := db.merge(recovered); mergeErr != nil {
+		return 0, mergeErr
+	}
+	if err != nil {
+		db.logger.Warn("snapshot partially recovered", "file", fileName, "keys", len(recovered), "err", err)
+	}
+	return len(recovered), err
+}
+
+// merge stores decoded snapshot entries, replacing existing keys, and
+// restores their TTLs. Keys whose deadline passed while they were on disk are
+// dropped rather than loaded. A read-only database stores nothing and
+// returns ErrReadOnly.
+func (db *DataBase) merge(loaded map[string]snapshotEntry) error {
+	db.lock.Lock()    // Acquire a write lock to modify the database.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	if db.readOnly {
+		return ErrReadOnly
+	}
+	now := db.clock.Now()
+	for key, entry := range loaded {
+		if !entry.deadline.IsZero() && !entry.deadline.After(now) {
+			continue // Expired while saved; it would only fire a stale callback.
+		}
+		db.setLocked(key, entry.value) // Loaded keys replace existing ones.
+		if !entry.deadline.IsZero() {
+			db.expires.set(key, entry.deadline)
+		}
+	}
+	return nil
 }
 
 func main() {
 	// Create a new instance of the database.
 	db := NewDataBase()
+	defer db.Close() // Stop background goroutines on exit.
 
 	// Add some key-value pairs to the database.
 	db.Set("key1", "value1")
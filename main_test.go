@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lockedBuffer is a bytes.Buffer safe to log to from several goroutines.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// waitFor polls cond until it holds, failing the test after five seconds.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); !cond(); time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
+
+func TestPersistSkipsUnencodable(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	db.Set("name", "ada")
+	db.Set("count", int64(3))
+	db.Set("callback", func() {})
+	db.Set("channel", make(chan int))
+	fileName := filepath.Join(t.TempDir(), "database.gob")
+
+	var skipped *UnencodableError
+	if err := db.Persist(fileName); !errors.As(err, &skipped) {
+		t.Fatalf("Persist: %v, want an *UnencodableError", err)
+	}
+	if !slices.Equal(skipped.Keys, []string{"callback", "channel"}) {
+		t.Errorf("skipped keys = %q, want [callback channel]", skipped.Keys)
+	}
+
+	loaded := NewDataBase()
+	defer loaded.Close()
+	if err := loaded.Load(fileName); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if got := loaded.Keys("*"); !slices.Equal(got, []string{"count", "name"}) {
+		t.Errorf("loaded keys = %q, want [count name]", got)
+	}
+	if value, _ := loaded.Get("name"); value != "ada" {
+		t.Errorf("name = %v, want ada", value)
+	}
+	if value, _ := loaded.Get("count"); value != int64(3) {
+		t.Errorf("count = %#v, want int64(3)", value)
+	}
+}
+
+func TestLoadFilteredPrefix(t *testing.T) {
+	src := NewDataBase()
+	defer src.Close()
+	src.Set("user:1", "ada")
+	src.SetWithTTL("user:2", "bob", time.Hour)
+	src.Set("order:1", "book")
+	src.Set("userx", "not a user key")
+	fileName := filepath.Join(t.TempDir(), "database.gob")
+	if err := src.Persist(fileName); err != nil {
+		t.Fatal(err)
+	}
+
+	db := NewDataBase()
+	defer db.Close()
+	db.Set("order:1", "kept") // Rejected keys leave existing ones alone.
+	if err := db.LoadFiltered(fileName, func(key string) bool { return strings.HasPrefix(key, "user:") }); err != nil {
+		t.Fatalf("LoadFiltered: %v", err)
+	}
+	if got := db.Keys("*"); !slices.Equal(got, []string{"order:1", "user:1", "user:2"}) {
+		t.Errorf("keys = %q, want [order:1 user:1 user:2]", got)
+	}
+	if value, _ := db.Get("order:1"); value != "kept" {
+		t.Errorf("order:1 = %v, want the existing kept", value)
+	}
+	if ttl := db.TTL("user:2"); ttl <= 0 || ttl > time.Hour {
+		t.Errorf("TTL(user:2) = %v, want up to an hour", ttl)
+	}
+}
+
+func TestPersistKeepsTTLs(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1_000_000, 0))
+	src := NewDataBase(WithClock(clock))
+	defer src.Close()
+	src.SetWithTTL("short", "v", 10*time.Second)
+	src.SetWithTTL("long", "v", time.Hour)
+	src.Set("forever", "v")
+	fileName := filepath.Join(t.TempDir(), "database.gob")
+	if err := src.Persist(fileName); err != nil {
+		t.Fatal(err)
+	}
+
+	clock.Advance(time.Minute) // Past short's deadline while the store is down.
+	db := NewDataBase(WithClock(clock))
+	defer db.Close()
+	if err := db.Load(fileName); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := db.Get("short"); ok {
+		t.Error("Load restored a key that expired while saved")
+	}
+	if ttl := db.TTL("long"); ttl != time.Hour-time.Minute {
+		t.Errorf("TTL(long) = %v, want the remaining %v", ttl, time.Hour-time.Minute)
+	}
+	if ttl := db.TTL("forever"); ttl != TTLPersistent {
+		t.Errorf("TTL(forever) = %v, want none", ttl)
+	}
+	clock.Advance(time.Hour)
+	if _, ok := db.Get("long"); ok {
+		t.Error("long outlived its restored deadline")
+	}
+}
+
+func TestPersistWithOptionsSkips(t *testing.T) {
+	src := NewDataBase()
+	defer src.Close()
+	src.Set("name", "ada")
+	src.Set("count", 3)
+	src.RPush("queue", "job")
+	src.HSet("user", "name", "ada")
+	src.SAdd("tags", "go")
+	src.SetWithTTL("cache", "v", time.Hour)
+	src.HSet("session", "tok", "x")
+	src.Expire("session", time.Hour)
+	fileName := filepath.Join(t.TempDir(), "database.gob")
+
+	for _, tc := range []struct {
+		opts PersistOptions
+		want []string
+	}{
+		{PersistOptions{}, []string{"cache", "count", "name", "queue", "session", "tags", "user"}},
+		{PersistOptions{SkipTypes: []string{"list", "set"}}, []string{"cache", "count", "name", "session", "user"}},
+		{PersistOptions{SkipExpiring: true}, []string{"count", "name", "queue", "tags", "user"}},
+		{PersistOptions{SkipTypes: []string{"hash", "int"}, SkipExpiring: true}, []string{"name", "queue", "tags"}},
+	} {
+		if err := src.PersistWithOptions(fileName, tc.opts); err != nil {
+			t.Fatal(err)
+		}
+		db := NewDataBase()
+		if err := db.Load(fileName); err != nil {
+			t.Fatal(err)
+		}
+		if got := db.Keys("*"); !slices.Equal(got, tc.want) {
+			t.Errorf("loaded after %+v = %q, want %q", tc.opts, got, tc.want)
+		}
+		db.Close()
+	}
+}
+
+func TestDeleteIfEqual(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1_000_000, 0))
+	db := NewDataBase(WithClock(clock))
+	defer db.Close()
+	if ok, _ := db.SetNX("lock", "token-a"); !ok {
+		t.Fatal("SetNX of a free lock failed")
+	}
+	db.Expire("lock", time.Second)
+	clock.Advance(time.Second) // A's lock lapses and B takes it.
+	if ok, _ := db.SetNX("lock", "token-b"); !ok {
+		t.Fatal("SetNX of a lapsed lock failed")
+	}
+
+	if db.DeleteIfEqual("lock", "token-a") {
+		t.Error("DeleteIfEqual with a mismatched value deleted the lock")
+	}
+	if value, _ := db.Get("lock"); value != "token-b" {
+		t.Errorf("lock = %v after the refused delete, want B's token kept", value)
+	}
+	if !db.DeleteIfEqual("lock", "token-b") {
+		t.Error("DeleteIfEqual with the matching value refused")
+	}
+	if _, ok := db.Get("lock"); ok {
+		t.Error("the lock survived a matching DeleteIfEqual")
+	}
+	if db.DeleteIfEqual("lock", "token-b") {
+		t.Error("DeleteIfEqual of a missing key reported a delete")
+	}
+
+	db.Set("bytes", []byte("abc"))
+	if !db.DeleteIfEqual("bytes", []byte("abc")) {
+		t.Error("DeleteIfEqual did not deep-compare a []byte")
+	}
+	db.Set("num", int64(1))
+	if db.DeleteIfEqual("num", 1) {
+		t.Error("DeleteIfEqual matched an int against an int64")
+	}
+	db.SetReadOnly(true)
+	if db.DeleteIfEqual("num", int64(1)) {
+		t.Error("DeleteIfEqual deleted from a read-only store")
+	}
+}
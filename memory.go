@@ -0,0 +1,262 @@
+package main
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"iter"
+	"slices"
+	"strings"
+	"time"
+)
+
+// entryOverhead approximates the bytes a key costs beyond its payload: the
+// map slot, the string and interface headers, and the TTL bookkeeping.
+const entryOverhead = 64
+
+// ErrOOM is returned by writes refused under the NoEviction policy because
+// they would take the store over its memory budget.
+var ErrOOM = errors.New("OOM command not allowed when used memory > 'maxmemory'.")
+
+// EvictionPolicy chooses which keys make room when the store exceeds the
+// budget set by SetMaxMemory. The names follow the Redis maxmemory-policy
+// settings.
+type EvictionPolicy int
+
+const (
+	NoEviction     EvictionPolicy = iota // Refuse growing writes with ErrOOM.
+	AllKeysLRU                           // Evict the least recently used key.
+	AllKeysRandom                        // Evict any key at random.
+	VolatileLRU                          // Evict the least recently used key with a TTL.
+	VolatileRandom                       // Evict a random key with a TTL.
+	VolatileTTL                          // Evict the key with a TTL closest to expiring.
+	AllKeysLFU                           // Evict the least frequently used key.
+	VolatileLFU                          // Evict the least frequently used key with a TTL.
+)
+
+// policyNames are the Redis maxmemory-policy names of the policies.
+var policyNames = []string{"noeviction", "allkeys-lru", "allkeys-random", "volatile-lru", "volatile-random", "volatile-ttl", "allkeys-lfu", "volatile-lfu"}
+
+// String returns the policy's Redis maxmemory-policy name.
+func (p EvictionPolicy) String() string {
+	if p < 0 || int(p) >= len(policyNames) {
+		return fmt.Sprintf("EvictionPolicy(%d)", int(p))
+	}
+	return policyNames[p]
+}
+
+// parseEvictionPolicy looks a policy up by its Redis name.
+func parseEvictionPolicy(name string) (EvictionPolicy, bool) {
+	i := slices.Index(policyNames, strings.ToLower(name))
+	return EvictionPolicy(i), i >= 0
+}
+
+// volatileTTLSample is how many keys with a TTL VolatileTTL compares per
+// eviction, as Redis samples rather than keeping keys sorted by deadline.
+const volatileTTLSample = 16
+
+// lfuSample is how many keys the LFU policies compare per eviction.
+const lfuSample = 16
+
+// entrySize estimates the memory held by one key and its value.
+func entrySize(key string, value any) int64 {
+	return int64(len(key) + valueSize(value) + entryOverhead)
+}
+
+// MemoryUsage estimates the bytes used by key and its value, like Redis
+// MEMORY USAGE. It reports false if the key does not exist. The estimate
+// counts payload bytes plus a fixed per-key overhead, not Go's exact
+// allocation sizes.
+func (db *DataBase) MemoryUsage(key string) (int64, bool) {
+	db.lock.RLock()         // Acquire a read lock.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+	value, exists := db.lookup(key)
+	if !exists {
+		return 0, false
+	}
+	return entrySize(key, db.stored(key, value)), true
+}
+
+// UsedMemory returns the running estimate of the memory used by all keys,
+// as maintained for SetMaxMemory. It is zero while no budget is set.
+func (db *DataBase) UsedMemory() int64 {
+	db.lock.RLock()         // Acquire a read lock.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+	return db.memUsed
+}
+
+// SetMaxMemory caps the estimated memory of the store at bytes, as measured
+// by MemoryUsage, and chooses what happens when a write exceeds it: under
+// NoEviction writes that would grow the store past the budget fail with
+// ErrOOM and change nothing, while the other policies let the write through
+// and then evict keys until the store is back under budget. A budget of zero
+// or less removes the cap.
+//
+// The total is kept up to date on every write rather than recomputed, which
+// costs re-estimating the size of each modified value, so updates to very
+// large collections get slower while a budget is set. The LRU policies turn
+// on recency tracking (see WithRecencyTracking); keys not accessed since are
+// treated as least recently used. The LFU policies likewise turn on access
+// counters (see WithLFUTracking) with the default decay, and evict the key
+// with the lowest counter among a sample, as Redis does.
+func (db *DataBase) SetMaxMemory(bytes int64, policy EvictionPolicy) {
+	db.lock.Lock()    // Acquire a write lock.
+	defer db.unlock() // Release the lock, evicting first if now over budget.
+	db.setMaxMemory(bytes, policy)
+}
+
+// setMaxMemory implements SetMaxMemory. The caller must hold the write lock
+// and release it with unlock.
+func (db *DataBase) setMaxMemory(bytes int64, policy EvictionPolicy) {
+	db.evictionPolicy = policy // Kept without a budget too, for Config.
+	if bytes <= 0 {
+		db.maxMemory, db.memUsed, db.keySizes = 0, 0, nil // Stop tracking.
+		return
+	}
+	db.maxMemory = bytes
+	if db.keySizes == nil {
+		db.keySizes = make(map[string]int64, db.data.len())
+		for key, value := range db.data.all() {
+			size := entrySize(key, db.stored(key, value))
+			db.keySizes[key] = size
+			db.memUsed += size
+		}
+	}
+	if (policy == AllKeysLRU || policy == VolatileLRU) && db.recency == nil {
+		db.recency = &recencyList{order: list.New(), elems: make(map[string]*list.Element)}
+		for key := range db.data.all() {
+			db.recency.elems[key] = db.recency.order.PushBack(key) // Unknown recency: oldest.
+		}
+	}
+	if (policy == AllKeysLFU || policy == VolatileLFU) && db.lfu == nil {
+		db.lfu = &lfuTracker{decay: defaultLFUDecay, counters: make(map[string]*lfuCounter)} // Keys not seen since count as unused.
+	}
+}
+
+// trackSize updates the running total after key was written.
+// The caller must hold the write lock.
+func (db *DataBase) trackSize(key string) {
+	if db.keySizes == nil {
+		return
+	}
+	value, exists := db.data.get(key)
+	if !exists {
+		return
+	}
+	size := entrySize(key, db.stored(key, value))
+	db.memUsed += size - db.keySizes[key]
+	db.keySizes[key] = size
+}
+
+// untrackSize removes a deleted key from the running total.
+// The caller must hold the write lock.
+func (db *DataBase) untrackSize(key string) {
+	if db.keySizes == nil {
+		return
+	}
+	db.memUsed -= db.keySizes[key]
+	delete(db.keySizes, key)
+}
+
+// checkOOM refuses, under NoEviction, storing value at key if that would
+// take the store over budget. The caller must hold the lock.
+func (db *DataBase) checkOOM(key string, value any) error {
+	if db.maxMemory <= 0 || db.evictionPolicy != NoEviction {
+		return nil
+	}
+	if db.memUsed-db.keySizes[key]+entrySize(key, value) > db.maxMemory {
+		return ErrOOM
+	}
+	return nil
+}
+
+// checkGrowth refuses, under NoEviction, writes that add to a collection
+// while the store is already at or over budget. The caller must hold the
+// lock.
+func (db *DataBase) checkGrowth() error {
+	if db.maxMemory > 0 && db.evictionPolicy == NoEviction && db.memUsed >= db.maxMemory {
+		return ErrOOM
+	}
+	return nil
+}
+
+// evictIfNeeded removes keys chosen by the eviction policy until the store
+// is back under budget or nothing more can be evicted. The caller must hold
+// the write lock.
+func (db *DataBase) evictIfNeeded() {
+	if db.maxMemory <= 0 || db.evictionPolicy == NoEviction {
+		return
+	}
+	evicted := 0
+	for db.memUsed > db.maxMemory {
+		key, ok := db.evictionCandidate()
+		if !ok {
+			break // Only keys the policy may not touch are left.
+		}
+		db.removeKeyFor(key, EventEvicted)
+		db.evictions++
+		evicted++
+	}
+	if evicted > 0 {
+		db.logger.Debug("evicted keys", "count", evicted, "used_memory", db.memUsed, "max_memory", db.maxMemory)
+	}
+}
+
+// evictionCandidate picks the next key to evict under the current policy.
+// The caller must hold the write lock.
+func (db *DataBase) evictionCandidate() (string, bool) {
+	switch db.evictionPolicy {
+	case AllKeysLRU, VolatileLRU:
+		db.recency.mu.Lock()
+		defer db.recency.mu.Unlock()
+		for e := db.recency.order.Back(); e != nil; e = e.Prev() {
+			key := e.Value.(string)
+			if _, hasTTL := db.expires.get(key); hasTTL || db.evictionPolicy == AllKeysLRU {
+				return key, true
+			}
+		}
+	case AllKeysRandom:
+		for key := range db.data.all() {
+			return key, true // Map iteration starts at a random entry.
+		}
+	case VolatileRandom:
+		for key := range db.expires.all() {
+			return key, true
+		}
+	case VolatileTTL:
+		best, bestDeadline, checked := "", time.Time{}, 0
+		for key, deadline := range db.expires.all() {
+			if checked == volatileTTLSample {
+				break
+			}
+			checked++
+			if best == "" || deadline.Before(bestDeadline) {
+				best, bestDeadline = key, deadline
+			}
+		}
+		return best, best != ""
+	case AllKeysLFU:
+		return leastFrequent(db, db.data.rawAll()) // Only keys are needed, not decoded values.
+	case VolatileLFU:
+		return leastFrequent(db, db.expires.all())
+	}
+	return "", false
+}
+
+// leastFrequent returns the key with the lowest access counter among the
+// first lfuSample keys of keys, which start at a random entry as map
+// iteration does. The caller must hold the write lock.
+func leastFrequent[V any](db *DataBase, keys iter.Seq2[string, V]) (string, bool) {
+	now := db.clock.Now()
+	best, bestFreq, checked := "", uint8(0), 0
+	for key := range keys {
+		if checked == lfuSample {
+			break
+		}
+		checked++
+		if freq := db.lfu.frequency(key, now); best == "" || freq < bestFreq {
+			best, bestFreq = key, freq
+		}
+	}
+	return best, best != ""
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sumMemoryUsage adds up MemoryUsage over every key, which the running
+// total must match.
+func sumMemoryUsage(db *DataBase) int64 {
+	var sum int64
+	for _, key := range db.Keys("*") {
+		n, _ := db.MemoryUsage(key)
+		sum += n
+	}
+	return sum
+}
+
+func TestMaxMemoryEvictsLRU(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	value := strings.Repeat("v", 100)
+	db.Set("key:0", value)
+	size, _ := db.MemoryUsage("key:0")
+	budget := 10*size + 10 // Room for the longer names of key:10 and key:11.
+	db.SetMaxMemory(budget, AllKeysLRU)
+
+	for i := 1; i < 10; i++ {
+		db.Set("key:"+strconv.Itoa(i), value)
+	}
+	if n := len(db.Keys("*")); n != 10 {
+		t.Fatalf("%d keys at the budget, want all 10", n)
+	}
+	db.Get("key:0") // Now the most recently used.
+	db.Set("key:10", value)
+	db.Set("key:11", value)
+	if used := db.UsedMemory(); used > budget {
+		t.Errorf("UsedMemory = %d, over the budget of %d", used, budget)
+	}
+	for key, alive := range map[string]bool{"key:0": true, "key:1": false, "key:2": false, "key:3": true, "key:11": true} {
+		if _, ok := db.Get(key); ok != alive {
+			t.Errorf("%s exists = %v, want %v", key, ok, alive)
+		}
+	}
+	if used, sum := db.UsedMemory(), sumMemoryUsage(db); used != sum {
+		t.Errorf("UsedMemory = %d, but the keys add up to %d", used, sum)
+	}
+
+	db.SetMaxMemory(0, AllKeysLRU)
+	if used := db.UsedMemory(); used != 0 {
+		t.Errorf("UsedMemory without a budget = %d, want 0", used)
+	}
+}
+
+func TestMaxMemoryNoEviction(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	value := strings.Repeat("v", 100)
+	db.Set("key:0", value)
+	size, _ := db.MemoryUsage("key:0")
+	db.SetMaxMemory(3*size, NoEviction)
+	db.Set("key:1", value)
+	db.Set("key:2", value)
+
+	if err := db.Set("key:3", value); !errors.Is(err, ErrOOM) {
+		t.Fatalf("Set over the budget: %v, want ErrOOM", err)
+	}
+	if err := db.Set("key:0", value+"more"); !errors.Is(err, ErrOOM) {
+		t.Errorf("growing a key over the budget: %v, want ErrOOM", err)
+	}
+	if got, _ := db.Get("key:0"); got != value {
+		t.Error("a refused Set changed the value")
+	}
+	if _, err := db.RPush("key:list", 1); !errors.Is(err, ErrOOM) {
+		t.Errorf("RPush at the budget: %v, want ErrOOM", err)
+	}
+	if n := len(db.Keys("*")); n != 3 {
+		t.Errorf("%d keys after the refusals, want 3: noeviction never evicts", n)
+	}
+	if err := db.Set("key:0", strings.Repeat("w", 100)); err != nil {
+		t.Errorf("overwriting a key with a value of the same size: %v", err)
+	}
+
+	db.Delete("key:2") // Frees room.
+	if err := db.Set("key:3", value); err != nil {
+		t.Errorf("Set after a Delete made room: %v", err)
+	}
+	if used, sum := db.UsedMemory(), sumMemoryUsage(db); used != sum {
+		t.Errorf("UsedMemory = %d, but the keys add up to %d", used, sum)
+	}
+}
+
+func TestMaxMemoryEvictsLFU(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	value := strings.Repeat("v", 100)
+	db.SetMaxMemory(1<<20, AllKeysLFU) // Counters start with the keys.
+	for i := range 5 {
+		db.Set("key:"+strconv.Itoa(i), value)
+	}
+	for range 200 {
+		for _, key := range []string{"key:0", "key:1", "key:3", "key:4"} {
+			db.Get(key)
+		}
+	}
+	size, _ := db.MemoryUsage("key:0")
+	db.SetMaxMemory(4*size, AllKeysLFU) // Over budget by one key.
+	if _, ok := db.Get("key:2"); ok {
+		t.Error("the never read key:2 survived, want it evicted first")
+	}
+	if n := len(db.Keys("*")); n != 4 {
+		t.Errorf("%d keys left, want 4", n)
+	}
+	if used, sum := db.UsedMemory(), sumMemoryUsage(db); used != sum || used > 4*size {
+		t.Errorf("UsedMemory = %d, keys add up to %d, budget %d", used, sum, 4*size)
+	}
+}
+
+func TestMaxMemoryVolatileLFU(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	value := strings.Repeat("v", 100)
+	db.SetMaxMemory(1<<20, VolatileLFU)
+	db.SetWithTTL("hot", value, time.Hour)
+	db.SetWithTTL("old", value, time.Hour)
+	db.Set("pin", value) // No TTL: never evicted.
+	for range 200 {
+		db.Get("hot")
+	}
+	size, _ := db.MemoryUsage("pin")
+
+	db.SetMaxMemory(2*size, VolatileLFU)
+	for key, alive := range map[string]bool{"hot": true, "old": false, "pin": true} {
+		if _, ok := db.Get(key); ok != alive {
+			t.Errorf("%s exists = %v, want %v", key, ok, alive)
+		}
+	}
+	db.SetMaxMemory(size/2, VolatileLFU) // Less than the key without a TTL needs.
+	if keys := db.Keys("*"); len(keys) != 1 || keys[0] != "pin" {
+		t.Errorf("keys = %v, want only pin: volatile-lfu only evicts keys with a TTL", keys)
+	}
+}
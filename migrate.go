@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"time"
+)
+
+// ErrSameDatabase is returned by Migrate when the source is the destination.
+var ErrSameDatabase = errors.New("migrate: source and destination are the same database")
+
+// migration is one key read from the source of a Migrate.
+type migration struct {
+	value    any
+	deadline time.Time
+	hasTTL   bool
+	fields   map[string]time.Time // Hash field TTLs, if any.
+	version  uint64               // Source version, so a move deletes only what was copied.
+}
+
+// Migrate copies keys from src to dst, with their TTLs and hash field TTLs,
+// and returns how many were transferred. Missing keys are skipped. With move
+// set, each key is deleted from src once it has been written to dst, unless
+// it was written in src in the meantime, so a concurrent update is never
+// lost, or src is read-only (see Drain). Keys are transferred one at a
+// time: the first key dst refuses, for example because of a prefix policy
+// or its memory budget, stops the migration with an error naming the key,
+// leaving that key and the rest in src untouched. Values are deep-copied,
+// so the two stores share nothing.
+func Migrate(src, dst *DataBase, keys []string, move bool) (int, error) {
+	if src == dst {
+		return 0, ErrSameDatabase
+	}
+	transferred := 0
+	for _, key := range keys {
+		m, ok := src.export(key)
+		if !ok {
+			continue // Nothing to transfer.
+		}
+		if err := dst.importKey(key, m); err != nil {
+			return transferred, fmt.Errorf("migrate %q: %w", key, err)
+		}
+		if move {
+			src.deleteIfVersion(key, m.version)
+		}
+		transferred++
+	}
+	return transferred, nil
+}
+
+// export reads a key for Migrate.
+func (db *DataBase) export(key string) (migration, bool) {
+	db.lock.RLock()         // Acquire a read lock while copying.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+	value, ok := db.lookup(key)
+	if !ok {
+		return migration{}, false
+	}
+	m := migration{value: deepCopy(value), version: db.versions[key]}
+	m.deadline, m.hasTTL = db.expires.get(key)
+	if fields := db.fieldExpires[key]; fields != nil {
+		m.fields = maps.Clone(fields)
+	}
+	return m, true
+}
+
+// importKey writes a key read by export, replacing any value at key.
+func (db *DataBase) importKey(key string, m migration) error {
+	db.lock.Lock()    // Acquire a write lock.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	if db.readOnly {
+		return ErrReadOnly
+	}
+	db.expireIfNeeded(key)
+	if err := db.checkPolicy(key, m.value); err != nil {
+		return err
+	}
+	if err := db.checkOOM(key, m.value); err != nil {
+		return err
+	}
+	db.place(key, m.value, true, m.deadline, m.hasTTL, m.fields)
+	return nil
+}
+
+// deleteIfVersion deletes key if its version is still version.
+func (db *DataBase) deleteIfVersion(key string, version uint64) {
+	db.lock.Lock()    // One lock for the check and the delete.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	if db.readOnly {
+		return
+	}
+	db.expireIfNeeded(key)
+	if db.data.has(key) && db.versions[key] == version {
+		db.removeKey(key)
+	}
+}
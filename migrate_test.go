@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestMigrateCopyAndMove(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1_000_000, 0))
+	src, dst := NewDataBase(WithClock(clock)), NewDataBase(WithClock(clock))
+	defer src.Close()
+	defer dst.Close()
+	src.SetWithTTL("session", "tok", time.Minute)
+	src.RPush("queue", "a", "b")
+
+	n, err := Migrate(src, dst, []string{"session", "queue", "missing"}, false)
+	if err != nil || n != 2 {
+		t.Fatalf("Migrate copy = %d, %v; want 2", n, err)
+	}
+	for _, db := range []*DataBase{src, dst} {
+		if value, _ := db.Get("session"); value != "tok" {
+			t.Errorf("session = %v after the copy, want tok in both", value)
+		}
+		if ttl := db.TTL("session"); ttl != time.Minute {
+			t.Errorf("TTL(session) = %v after the copy, want the minute kept", ttl)
+		}
+	}
+	dst.RPush("queue", "c")
+	if items, _ := src.LRange("queue", 0, -1); len(items) != 2 {
+		t.Errorf("src queue = %v after a push to the copy, want them independent", items)
+	}
+
+	src.Set("session", "tok")
+	dst.FlushAll()
+	if n, err := Migrate(src, dst, []string{"session", "queue"}, true); err != nil || n != 2 {
+		t.Fatalf("Migrate move = %d, %v; want 2", n, err)
+	}
+	if keys := src.Keys("*"); len(keys) != 0 {
+		t.Errorf("src keys after the move = %q, want none", keys)
+	}
+	if keys := dst.Keys("*"); !slices.Equal(keys, []string{"queue", "session"}) {
+		t.Errorf("dst keys after the move = %q, want [queue session]", keys)
+	}
+	if _, err := Migrate(src, src, []string{"queue"}, true); !errors.Is(err, ErrSameDatabase) {
+		t.Errorf("Migrate onto itself: %v, want ErrSameDatabase", err)
+	}
+}
+
+func TestMigratePartialFailure(t *testing.T) {
+	src, dst := NewDataBase(), NewDataBase()
+	defer src.Close()
+	defer dst.Close()
+	dst.SetPrefixPolicy("num:", Policy{Types: []string{"int"}})
+	src.Set("a", 1)
+	src.Set("num:x", "not a number")
+	src.Set("c", 3)
+
+	n, err := Migrate(src, dst, []string{"a", "num:x", "c"}, true)
+	var policy *PolicyError
+	if n != 1 || !errors.As(err, &policy) {
+		t.Fatalf("Migrate with a refused key = %d, %v; want 1 and a *PolicyError", n, err)
+	}
+	if keys := src.Keys("*"); !slices.Equal(keys, []string{"c", "num:x"}) {
+		t.Errorf("src keys = %q, want the refused key and the rest left", keys)
+	}
+	if keys := dst.Keys("*"); !slices.Equal(keys, []string{"a"}) {
+		t.Errorf("dst keys = %q, want only the key moved before the failure", keys)
+	}
+
+	src.Set("b", 2)
+	dst.SetReadOnly(true)
+	if n, err := Migrate(src, dst, []string{"b"}, true); n != 0 || !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Migrate to a read-only store = %d, %v; want 0 and ErrReadOnly", n, err)
+	}
+	if value, _ := src.Get("b"); value != 2 {
+		t.Errorf("src b = %v after the failed move, want it kept", value)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"sync"
+	"time"
+)
+
+// mappedValue stands in for a value still sitting encoded in a snapshot
+// mapped by OpenMMapped. It is decoded once, on first use.
+type mappedValue struct {
+	blob  []byte // The encoded value, pointing into the mapping.
+	once  sync.Once
+	value any
+	err   error
+}
+
+// OpenMMapped opens a database backed by the snapshot at path, as written
+// by Persist, without decoding it. The file is memory-mapped and only its
+// record index is read at startup: every key is registered at once, pointing
+// at its encoded value in the mapping, and a value is decoded the first time
+// anything reads it. Startup time then depends on the number of keys rather
+// than on the size of the data, which suits multi-gigabyte caches that
+// restart often, and values never read cost only page cache. The file's
+// checksum is verified first, which reads it through once but decodes
+// nothing; a corrupt file fails with ErrChecksumMismatch.
+//
+// Writes replace mapped values with ordinary in-memory ones. Persist decodes
+// every remaining mapped value before it writes, so saving back over path is
+// safe; nothing else may modify or truncate the file while it is mapped. The
+// mapping stays in place for the life of the process. Values that fail to
+// decode when first read are logged and treated as missing. Legacy snapshots
+// without the record header use the regular loader, Load.
+func OpenMMapped(path string, opts ...Option) (*DataBase, error) {
+	mapped, err := mapFile(path)
+	if err != nil {
+		return nil, err
+	}
+	records, err := indexSnapshot(mapped)
+	if err != nil {
+		return nil, fmt.Errorf("mmap %s: %w", path, err)
+	}
+	db := NewDataBase(opts...)
+	db.lock.Lock() // The sweeper is already running.
+	defer db.lock.Unlock()
+	db.mapped = true
+	db.data.resolve = db.resolveValue // Also undoes any compression.
+	now := db.clock.Now()
+	for key, rec := range records {
+		if !rec.deadline.IsZero() && !rec.deadline.After(now) {
+			continue // Expired while saved.
+		}
+		db.data.set(key, &mappedValue{blob: rec.blob})
+		if !rec.deadline.IsZero() {
+			db.expires.set(key, rec.deadline)
+		}
+	}
+	db.logger.Info("snapshot mapped", "file", path, "keys", len(records))
+	return db, nil
+}
+
+// mappedRecord locates one record of a mapped snapshot.
+type mappedRecord struct {
+	blob     []byte    // The encoded value, a slice of the mapping.
+	deadline time.Time // Zero for keys without a TTL.
+}
+
+// indexSnapshot walks the records of a mapped snapshot and returns each
+// key's encoded value as a slice of data, without copying or decoding it.
+func indexSnapshot(data []byte) (map[string]mappedRecord, error) {
+	if len(data) < len(snapshotMagic)+1 || string(data[:len(snapshotMagic)]) != snapshotMagic {
+		return nil, errors.New("not a record snapshot")
+	}
+	v := data[len(snapshotMagic)]
+	if v < 1 || v > snapshotVersion {
+		return nil, fmt.Errorf("snapshot: unsupported version %d", v)
+	}
+	if v >= 3 {
+		if len(data) < len(snapshotMagic)+1+checksumSize {
+			return nil, ErrChecksumMismatch
+		}
+		body := data[:len(data)-checksumSize]
+		if binary.BigEndian.Uint32(data[len(body):]) != crc32.Checksum(body, checksumTable) {
+			return nil, ErrChecksumMismatch // Checking up front reads every page once.
+		}
+		data = body
+	}
+	records := make(map[string]mappedRecord)
+	off := len(snapshotMagic) + 1
+	field := func() ([]byte, error) { // Reads one length-prefixed byte string.
+		n, size := binary.Uvarint(data[off:])
+		if size <= 0 || n > uint64(len(data)-off-size) {
+			return nil, errors.New("snapshot: truncated record")
+		}
+		off += size
+		b := data[off : off+int(n) : off+int(n)] // Cap it so appends cannot clobber the mapping.
+		off += int(n)
+		return b, nil
+	}
+	for off < len(data) {
+		tag := data[off]
+		off++
+		switch tag {
+		case recordEnd:
+			if off < len(data) {
+				return nil, ErrChecksumMismatch // Only a sum may follow: the version byte is damaged.
+			}
+			return records, nil
+		case recordEntry, recordEntryTTL:
+			key, err := field()
+			if err != nil {
+				return nil, err
+			}
+			var rec mappedRecord
+			if tag == recordEntryTTL {
+				nanos, size := binary.Varint(data[off:])
+				if size <= 0 {
+					return nil, errors.New("snapshot: truncated record")
+				}
+				off += size
+				rec.deadline = time.Unix(0, nanos)
+			}
+			if rec.blob, err = field(); err != nil {
+				return nil, err
+			}
+			records[string(key)] = rec
+		default:
+			return nil, fmt.Errorf("snapshot: unknown record tag %q", tag)
+		}
+	}
+	return nil, errors.New("snapshot: missing end marker")
+}
+
+// resolveMapped decodes a mapped value on first use; other values pass
+// through untouched. It is safe under the read lock.
+func (db *DataBase) resolveMapped(v any) (any, bool) {
+	mv, ok := v.(*mappedValue)
+	if !ok {
+		return v, true
+	}
+	mv.once.Do(func() {
+		mv.value, mv.err = decodeValue(mv.blob)
+		mv.blob = nil // Decoded; the mapping is no longer needed for it.
+		if mv.err != nil {
+			db.logger.Error("mapped value decode failed", "err", mv.err)
+		}
+	})
+	return mv.value, mv.err == nil
+}
+
+// faultInMapped decodes every value still mapped, so the file behind the
+// mapping can be overwritten. The caller must hold the lock.
+func (db *DataBase) faultInMapped() {
+	if !db.mapped {
+		return
+	}
+	for range db.data.all() {
+		// Iterating resolves each value.
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// mapFile reads the file at path into memory on platforms without mmap,
+// keeping the lazy decoding of OpenMMapped but not its startup speed.
+func mapFile(path string) ([]byte, error) {
+	return os.ReadFile(path)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOpenMMapped(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1_000_000, 0))
+	src := NewDataBase(WithClock(clock))
+	defer src.Close()
+	src.Set("name", "ada")
+	src.Set("count", int64(42))
+	src.RPush("list", 1, 2)
+	src.SetWithTTL("session", "tok", time.Minute)
+	fileName := filepath.Join(t.TempDir(), "database.gob")
+	if err := src.Persist(fileName); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := OpenMMapped(fileName, WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.lock.RLock()
+	raw, _ := db.data.raw("name")
+	db.lock.RUnlock()
+	if mv, ok := raw.(*mappedValue); !ok || mv.blob == nil { // Not decoded until read.
+		t.Error("OpenMMapped decoded a value at startup")
+	}
+	if value, _ := db.Get("name"); value != "ada" {
+		t.Errorf("name = %v, want ada", value)
+	}
+	if value, _ := db.Get("count"); value != int64(42) {
+		t.Errorf("count = %v, want 42", value)
+	}
+	if got, _ := db.LRange("list", 0, -1); len(got) != 2 {
+		t.Errorf("list = %v, want [1 2]", got)
+	}
+	if ttl := db.TTL("session"); ttl != time.Minute {
+		t.Errorf("TTL(session) = %v, want a minute", ttl)
+	}
+
+	db.Set("name", "grace") // Overwrites the mapped value, then saves over it.
+	if err := db.Persist(fileName); err != nil {
+		t.Fatal(err)
+	}
+	reloaded := NewDataBase(WithClock(clock))
+	defer reloaded.Close()
+	if err := reloaded.Load(fileName); err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := reloaded.Get("name"); value != "grace" {
+		t.Errorf("name after saving over the mapping = %v, want grace", value)
+	}
+	if value, _ := reloaded.Get("count"); value != int64(42) {
+		t.Errorf("count after saving over the mapping = %v, want 42", value)
+	}
+}
+
+// BenchmarkStartup opens a snapshot of 100,000 keys of 1 KiB with the gob
+// loader, which decodes every value, and with OpenMMapped, which only
+// indexes the records, then reads one key.
+func BenchmarkStartup(b *testing.B) {
+	src := NewDataBase()
+	value := strings.Repeat("v", 1024)
+	for i := range 100_000 {
+		src.Set("key:"+strconv.Itoa(i), value)
+	}
+	fileName := filepath.Join(b.TempDir(), "database.gob")
+	if err := src.Persist(fileName); err != nil {
+		b.Fatal(err)
+	}
+	src.Close()
+
+	b.Run("gob", func(b *testing.B) {
+		for range b.N {
+			db := NewDataBase()
+			if err := db.Load(fileName); err != nil {
+				b.Fatal(err)
+			}
+			db.Get("key:1")
+			db.Close()
+		}
+	})
+	b.Run("mmap", func(b *testing.B) {
+		for range b.N {
+			db, err := OpenMMapped(fileName)
+			if err != nil {
+				b.Fatal(err)
+			}
+			db.Get("key:1")
+			db.Close()
+		}
+	})
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+)
+
+// msgpackWriter encodes the generic tree encoding/json decodes a document
+// to, with numbers as json.Number, in the MessagePack format.
+type msgpackWriter struct {
+	buf []byte
+}
+
+// write appends v. Maps are written with their keys sorted, so the same
+// document always encodes to the same bytes.
+func (mw *msgpackWriter) write(v any) error {
+	switch v := v.(type) {
+	case nil:
+		mw.buf = append(mw.buf, 0xc0)
+	case bool:
+		if v {
+			mw.buf = append(mw.buf, 0xc3)
+		} else {
+			mw.buf = append(mw.buf, 0xc2)
+		}
+	case json.Number:
+		return mw.writeNumber(v)
+	case string:
+		mw.writeHeader(len(v), 0xa0, 32, 0xd9, 0xda, 0xdb)
+		mw.buf = append(mw.buf, v...)
+	case []any:
+		mw.writeHeader(len(v), 0x90, 16, 0, 0xdc, 0xdd)
+		for _, item := range v {
+			if err := mw.write(item); err != nil {
+				return err
+			}
+		}
+	case map[string]any:
+		mw.writeHeader(len(v), 0x80, 16, 0, 0xde, 0xdf)
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		for _, key := range keys {
+			mw.write(key)
+			if err := mw.write(v[key]); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("msgpack: cannot encode %T", v)
+	}
+	return nil
+}
+
+// writeNumber appends an integer in its smallest form, or a float64 for a
+// number with a fraction or exponent.
+func (mw *msgpackWriter) writeNumber(n json.Number) error {
+	if i, err := strconv.ParseInt(string(n), 10, 64); err == nil {
+		switch {
+		case i >= 0 && i < 128:
+			mw.buf = append(mw.buf, byte(i)) // Positive fixint.
+		case i >= -32 && i < 0:
+			mw.buf = append(mw.buf, byte(int8(i))) // Negative fixint.
+		case i >= math.MinInt8 && i <= math.MaxInt8:
+			mw.buf = append(mw.buf, 0xd0, byte(int8(i)))
+		case i >= math.MinInt16 && i <= math.MaxInt16:
+			mw.buf = binary.BigEndian.AppendUint16(append(mw.buf, 0xd1), uint16(i))
+		case i >= math.MinInt32 && i <= math.MaxInt32:
+			mw.buf = binary.BigEndian.AppendUint32(append(mw.buf, 0xd2), uint32(i))
+		default:
+			mw.buf = binary.BigEndian.AppendUint64(append(mw.buf, 0xd3), uint64(i))
+		}
+		return nil
+	}
+	if u, err := strconv.ParseUint(string(n), 10, 64); err == nil {
+		mw.buf = binary.BigEndian.AppendUint64(append(mw.buf, 0xcf), u) // Above MaxInt64.
+		return nil
+	}
+	f, err := strconv.ParseFloat(string(n), 64)
+	if err != nil {
+		return fmt.Errorf("msgpack: malformed number %q", n)
+	}
+	mw.buf = binary.BigEndian.AppendUint64(append(mw.buf, 0xcb), math.Float64bits(f))
+	return nil
+}
+
+// writeHeader appends the type byte and length of a string, array or map:
+// fix|n below fixMax, then the 8-, 16- or 32-bit length forms. An 8-bit
+// code of 0 means the type has no 8-bit form.
+func (mw *msgpackWriter) writeHeader(n int, fix byte, fixMax int, code8, code16, code32 byte) {
+	switch {
+	case n < fixMax:
+		mw.buf = append(mw.buf, fix|byte(n))
+	case code8 != 0 && n <= math.MaxUint8:
+		mw.buf = append(mw.buf, code8, byte(n))
+	case n <= math.MaxUint16:
+		mw.buf = binary.BigEndian.AppendUint16(append(mw.buf, code16), uint16(n))
+	default:
+		mw.buf = binary.BigEndian.AppendUint32(append(mw.buf, code32), uint32(n))
+	}
+}
+
+// errMsgpackTruncated reports a document that ends inside a value.
+var errMsgpackTruncated = errors.New("msgpack: unexpected end of data")
+
+// msgpackReader decodes MessagePack into the generic tree msgpackWriter
+// encodes, so that it can be handed to encoding/json. Binary data decodes
+// as a string and every number as a json.Number.
+type msgpackReader struct {
+	buf []byte // What is left to read.
+}
+
+// read decodes the next value.
+func (mr *msgpackReader) read() (any, error) {
+	code, err := mr.take(1)
+	if err != nil {
+		return nil, err
+	}
+	c := code[0]
+	switch {
+	case c < 0x80:
+		return json.Number(strconv.Itoa(int(c))), nil // Positive fixint.
+	case c >= 0xe0:
+		return json.Number(strconv.Itoa(int(int8(c)))), nil // Negative fixint.
+	case c&0xf0 == 0x80:
+		return mr.readMap(int(c & 0x0f))
+	case c&0xf0 == 0x90:
+		return mr.readArray(int(c & 0x0f))
+	case c&0xe0 == 0xa0:
+		return mr.readString(int(c & 0x1f))
+	}
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xd9: // bin 8, str 8.
+		return mr.readSized(1, mr.readString)
+	case 0xc5, 0xda: // bin 16, str 16.
+		return mr.readSized(2, mr.readString)
+	case 0xc6, 0xdb: // bin 32, str 32.
+		return mr.readSized(4, mr.readString)
+	case 0xdc:
+		return mr.readSized(2, mr.readArray)
+	case 0xdd:
+		return mr.readSized(4, mr.readArray)
+	case 0xde:
+		return mr.readSized(2, mr.readMap)
+	case 0xdf:
+		return mr.readSized(4, mr.readMap)
+	case 0xca, 0xcb:
+		size := 4
+		if c == 0xcb {
+			size = 8
+		}
+		b, err := mr.take(size)
+		if err != nil {
+			return nil, err
+		}
+		f := math.Float64frombits(binary.BigEndian.Uint64(b))
+		bits := 64
+		if size == 4 {
+			f, bits = float64(math.Float32frombits(binary.BigEndian.Uint32(b))), 32
+		}
+		if math.IsInf(f, 0) || math.IsNaN(f) {
+			return nil, fmt.Errorf("msgpack: %v has no JSON form", f)
+		}
+		return json.Number(strconv.FormatFloat(f, 'g', -1, bits)), nil
+	case 0xcc, 0xcd, 0xce, 0xcf: // uint 8 to 64.
+		u, err := mr.readUint(1 << (c - 0xcc))
+		if err != nil {
+			return nil, err
+		}
+		return json.Number(strconv.FormatUint(u, 10)), nil
+	case 0xd0, 0xd1, 0xd2, 0xd3: // int 8 to 64.
+		size := 1 << (c - 0xd0)
+		u, err := mr.readUint(size)
+		if err != nil {
+			return nil, err
+		}
+		i := int64(u<<(64-8*size)) >> (64 - 8*size) // Sign-extend.
+		return json.Number(strconv.FormatInt(i, 10)), nil
+	}
+	return nil, fmt.Errorf("msgpack: unsupported type byte 0x%02x", c)
+}
+
+// readSized reads a big-endian length of size bytes and then the value it
+// prefixes with readBody.
+func (mr *msgpackReader) readSized(size int, readBody func(n int) (any, error)) (any, error) {
+	n, err := mr.readUint(size)
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(len(mr.buf)) {
+		return nil, errMsgpackTruncated // Every element takes at least a byte.
+	}
+	return readBody(int(n))
+}
+
+// readString reads a string or binary body of n bytes.
+func (mr *msgpackReader) readString(n int) (any, error) {
+	b, err := mr.take(n)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// readArray reads n elements.
+func (mr *msgpackReader) readArray(n int) (any, error) {
+	items := make([]any, 0, min(n, len(mr.buf)))
+	for range n {
+		item, err := mr.read()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// readMap reads n key-value pairs. Keys must be strings, as in JSON.
+func (mr *msgpackReader) readMap(n int) (any, error) {
+	m := make(map[string]any, min(n, len(mr.buf)))
+	for range n {
+		key, err := mr.read()
+		if err != nil {
+			return nil, err
+		}
+		name, ok := key.(string)
+		if !ok {
+			return nil, fmt.Errorf("msgpack: map key of type %T", key)
+		}
+		if m[name], err = mr.read(); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// readUint reads a big-endian unsigned integer of size bytes.
+func (mr *msgpackReader) readUint(size int) (uint64, error) {
+	b, err := mr.take(size)
+	if err != nil {
+		return 0, err
+	}
+	var u uint64
+	for _, c := range b {
+		u = u<<8 | uint64(c)
+	}
+	return u, nil
+}
+
+// take consumes the next n bytes.
+func (mr *msgpackReader) take(n int) ([]byte, error) {
+	if n > len(mr.buf) {
+		return nil, errMsgpackTruncated
+	}
+	b := mr.buf[:n]
+	mr.buf = mr.buf[n:]
+	return b, nil
+}
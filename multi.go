@@ -0,0 +1,255 @@
+package main
+
+import (
+	"reflect"
+	"time"
+)
+
+// MSetNX stores every pair only if none of the keys exists, like Redis
+// MSETNX. The existence check and the writes happen under one write lock, so
+// a group of related keys can be claimed exactly once: either all pairs are
+// written and true is returned, or nothing is written and false is returned.
+// A prefix policy violation by any pair also rejects the whole batch, with
+// the *PolicyError returned, as does exceeding a NoEviction memory budget,
+// with ErrOOM. The error is returned alongside the Redis-style result, as
+// by SetNX and MSet, because a batch refused that way, or by a read-only
+// database, is not one whose keys someone else holds: a caller treating
+// false as "already claimed" must not mistake a full store for that.
+func (db *DataBase) MSetNX(pairs map[string]any) (bool, error) {
+	db.lock.Lock()    // One lock for the check and the writes.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	if db.readOnly {
+		return false, ErrReadOnly
+	}
+
+	for key, value := range pairs {
+		db.expireIfNeeded(key) // An expired key no longer counts as existing.
+		if db.data.has(key) {
+			return false, nil // Someone already holds this key.
+		}
+		if err := db.checkPolicy(key, value); err != nil {
+			return false, err
+		}
+	}
+	var added int64
+	for key, value := range pairs {
+		added += entrySize(key, value)
+	}
+	if db.maxMemory > 0 && db.evictionPolicy == NoEviction && db.memUsed+added > db.maxMemory {
+		return false, ErrOOM // The keys are all new, so the batch adds its full size.
+	}
+	for key, value := range pairs {
+		db.setLocked(key, value)
+	}
+	return true, nil
+}
+
+// MSet stores every pair under one write lock, like Redis MSET, so no
+// reader sees some of the keys updated and others not, and the lock is
+// taken once rather than once per key. Each key is written as by Set,
+// losing any TTL unless a default TTL applies. The batch is checked before
+// anything is written: a prefix policy violation by any pair returns the
+// *PolicyError, and a NoEviction budget the batch would exceed ErrOOM,
+// with no key changed.
+func (db *DataBase) MSet(pairs map[string]any) error {
+	db.lock.Lock()    // One lock for the whole batch.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	if db.readOnly {
+		return ErrReadOnly
+	}
+	if err := db.msetCheck(pairs); err != nil {
+		return err
+	}
+	db.msetApply(pairs)
+	return nil
+}
+
+// msetCheck returns the error MSet would return for pairs, without
+// writing anything. The caller must hold the write lock.
+func (db *DataBase) msetCheck(pairs map[string]any) error {
+	budget := db.maxMemory > 0 && db.evictionPolicy == NoEviction
+	var delta int64
+	for key, value := range pairs {
+		db.expireIfNeeded(key)
+		if err := db.checkPolicy(key, value); err != nil {
+			return err
+		}
+		if budget {
+			delta += entrySize(key, value) - db.keySizes[key] // Overwrites free their old size.
+		}
+	}
+	if budget && delta > 0 && db.memUsed+delta > db.maxMemory {
+		return ErrOOM
+	}
+	return nil
+}
+
+// msetApply writes pairs checked by msetCheck. The caller must hold the
+// write lock.
+func (db *DataBase) msetApply(pairs map[string]any) {
+	expiresAt := db.clock.Now().Add(db.defaultTTL)
+	for key, value := range pairs {
+		db.setLocked(key, value)
+		if db.defaultTTL > 0 {
+			db.expires.set(key, expiresAt) // Cache-style default expiry.
+		}
+	}
+}
+
+// MGet returns the values of keys in order, like Redis MGET, with nil for
+// each key that does not exist. All keys are read under one read lock, so
+// the values are a consistent view: none was written between the reads.
+// As with Get, container values alias the store and must not be modified.
+func (db *DataBase) MGet(keys ...string) []any {
+	db.lock.RLock() // One read lock for the whole batch.
+	now := db.clock.Now()
+	values := make([]any, len(keys))
+	found := make([]bool, len(keys))
+	for i, key := range keys {
+		value, exists := db.data.get(key)
+		if !exists || db.isExpired(key, now) {
+			continue // Expired keys read as missing; the sweeper removes them.
+		}
+		db.accessed(key)
+		values[i], found[i] = value, true
+	}
+	db.lock.RUnlock() // Release the read lock.
+	for _, ok := range found {
+		db.recordRead(ok)
+	}
+	return values
+}
+
+// SetNX stores value only if key does not exist, like Redis SETNX, and
+// reports whether it did. The check and the write happen under one write
+// lock, so of several callers racing for the same key exactly one wins,
+// which makes it the building block of locks and idempotency keys. The
+// write is checked like Set's: a prefix policy violation returns the
+// *PolicyError and a full NoEviction budget ErrOOM, with nothing stored.
+func (db *DataBase) SetNX(key string, value any) (bool, error) {
+	db.lock.Lock()    // One lock for the check and the write.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	if db.readOnly {
+		return false, ErrReadOnly
+	}
+	db.expireIfNeeded(key) // An expired key no longer counts as existing.
+	if db.data.has(key) {
+		return false, nil // Someone already holds this key.
+	}
+	if err := db.setChecked(key, value); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// GetSet stores value and returns the value it replaced, like Redis
+// GETSET, with false if key did not exist. No write can come between the
+// read and the write. As with Set, the key loses its TTL, unless a default
+// TTL applies. If the write is refused the error is returned and the old
+// value stays in place.
+func (db *DataBase) GetSet(key string, value any) (any, bool, error) {
+	db.lock.Lock()    // One lock for the read and the write.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	if db.readOnly {
+		return nil, false, ErrReadOnly
+	}
+	db.expireIfNeeded(key)
+	old, existed := db.data.get(key)
+	if err := db.setChecked(key, value); err != nil {
+		return nil, false, err
+	}
+	return old, existed, nil
+}
+
+// CompareAndSwap stores newValue only if key holds a value that
+// deep-equals old, under reflect.DeepEqual, and reports whether it did. A
+// missing key never matches. Like DeleteIfEqual, it lets a caller update a
+// value it read earlier without overwriting a concurrent change: on false,
+// read again and retry. The key keeps its TTL, since the swap updates the
+// value rather than replacing the key. A refused write returns the
+// *PolicyError or ErrOOM and leaves the value unchanged.
+func (db *DataBase) CompareAndSwap(key string, old, newValue any) (bool, error) {
+	db.lock.Lock()    // One lock for the comparison and the write.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	if db.readOnly {
+		return false, ErrReadOnly
+	}
+	db.expireIfNeeded(key)
+	value, exists := db.data.get(key)
+	if !exists || !reflect.DeepEqual(value, old) {
+		return false, nil // Changed since the caller read it, or gone.
+	}
+	if err := db.checkPolicy(key, newValue); err != nil {
+		return false, err
+	}
+	if err := db.checkOOM(key, newValue); err != nil {
+		return false, err
+	}
+	db.data.set(key, newValue)   // The TTL in db.expires stays.
+	delete(db.fieldExpires, key) // Field TTLs belonged to the replaced value.
+	db.touch(key)
+	return true, nil
+}
+
+// Swap exchanges the values of key1 and key2, along with their TTLs and
+// hash field TTLs, under one write lock, for double-buffering without the
+// races of separate reads and writes. Absence swaps too: if only one key
+// exists, afterwards only the other does, and if neither exists nothing
+// changes. The moved values must satisfy the prefix policy of their new
+// keys; otherwise the *PolicyError is returned and neither key changes.
+func (db *DataBase) Swap(key1, key2 string) error {
+	db.lock.Lock()    // One lock for both reads and both writes.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	if db.readOnly {
+		return ErrReadOnly
+	}
+	db.expireIfNeeded(key1)
+	db.expireIfNeeded(key2)
+	if key1 == key2 {
+		return nil // Swapping a key with itself changes nothing.
+	}
+
+	v1, ok1 := db.data.get(key1)
+	v2, ok2 := db.data.get(key2)
+	if ok1 {
+		if err := db.checkPolicy(key2, v1); err != nil {
+			return err
+		}
+	}
+	if ok2 {
+		if err := db.checkPolicy(key1, v2); err != nil {
+			return err
+		}
+	}
+	d1, ttl1 := db.expires.get(key1)
+	d2, ttl2 := db.expires.get(key2)
+	f1, f2 := db.fieldExpires[key1], db.fieldExpires[key2]
+
+	db.place(key1, v2, ok2, d2, ttl2, f2)
+	db.place(key2, v1, ok1, d1, ttl1, f1)
+	return nil
+}
+
+// place stores one side of a Swap: the value with its deadline and field
+// TTLs, or removes the key if the value came from a missing key. The caller
+// must hold the write lock.
+func (db *DataBase) place(key string, value any, exists bool, deadline time.Time, hasTTL bool, fields map[string]time.Time) {
+	if !exists {
+		if db.data.has(key) {
+			db.removeKey(key)
+		}
+		return
+	}
+	db.data.set(key, value)
+	if hasTTL {
+		db.expires.set(key, deadline)
+	} else {
+		db.expires.del(key)
+	}
+	if fields != nil {
+		db.fieldExpires[key] = fields
+	} else {
+		delete(db.fieldExpires, key)
+	}
+	db.touch(key)
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMSetNXAllOrNothing(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1_000_000, 0))
+	db := NewDataBase(WithClock(clock))
+	defer db.Close()
+	db.Set("b", "taken")
+	ok, err := db.MSetNX(map[string]any{"a": 1, "b": 2, "c": 3})
+	if ok || err != nil {
+		t.Fatalf("MSetNX with one existing key = %v, %v; want false", ok, err)
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, exists := db.Get(key); exists {
+			t.Errorf("the rejected batch stored %s", key)
+		}
+	}
+	if value, _ := db.Get("b"); value != "taken" {
+		t.Errorf("b = %v, want the existing taken", value)
+	}
+
+	if ok, err := db.MSetNX(map[string]any{"a": 1, "c": 3}); !ok || err != nil {
+		t.Fatalf("MSetNX of new keys = %v, %v", ok, err)
+	}
+	if values := db.MGet("a", "c"); values[0] != 1 || values[1] != 3 {
+		t.Errorf("MGet = %v, want [1 3]", values)
+	}
+
+	db.SetWithTTL("lapsed", "old", time.Second)
+	clock.Advance(time.Second)
+	if ok, _ := db.MSetNX(map[string]any{"lapsed": "new"}); !ok {
+		t.Error("an expired key blocked MSetNX")
+	}
+}
+
+func TestSwap(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1_000_000, 0))
+	db := NewDataBase(WithClock(clock))
+	defer db.Close()
+	db.SetWithTTL("front", "a", time.Minute)
+	db.Set("back", "b")
+	if err := db.Swap("front", "back"); err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := db.Get("front"); value != "b" {
+		t.Errorf("front = %v after the swap, want b", value)
+	}
+	if value, _ := db.Get("back"); value != "a" {
+		t.Errorf("back = %v after the swap, want a", value)
+	}
+	if ttl := db.TTL("back"); ttl != time.Minute {
+		t.Errorf("TTL(back) = %v, want front's minute", ttl)
+	}
+	if ttl := db.TTL("front"); ttl != TTLPersistent {
+		t.Errorf("TTL(front) = %v, want back's none", ttl)
+	}
+
+	db.Swap("back", "empty") // Absence swaps too.
+	if _, ok := db.Get("back"); ok {
+		t.Error("back still exists after swapping with a missing key")
+	}
+	if value, _ := db.Get("empty"); value != "a" || db.TTL("empty") != time.Minute {
+		t.Errorf("empty = %v with TTL %v, want a with a minute", value, db.TTL("empty"))
+	}
+	if err := db.Swap("none1", "none2"); err != nil || db.Exists("none1", "none2") != 0 {
+		t.Errorf("Swap of two missing keys: %v, and it created one", err)
+	}
+	if err := db.Swap("front", "front"); err != nil {
+		t.Errorf("Swap of a key with itself: %v", err)
+	}
+	if value, _ := db.Get("front"); value != "b" {
+		t.Errorf("front = %v after swapping with itself, want b", value)
+	}
+
+	db.SetPrefixPolicy("num:", Policy{Types: []string{"int"}})
+	db.Set("num:1", 1)
+	var policy *PolicyError
+	if err := db.Swap("front", "num:1"); !errors.As(err, &policy) {
+		t.Errorf("Swap breaking a prefix policy: %v, want a *PolicyError", err)
+	}
+	if value, _ := db.Get("num:1"); value != 1 {
+		t.Errorf("num:1 = %v after the refused swap, want 1", value)
+	}
+}
+
+func TestSetNXOneWinner(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	const callers = 16
+	var wg sync.WaitGroup
+	wins := make(chan int, callers)
+	for i := range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if ok, err := db.SetNX("lock", i); err != nil {
+				t.Errorf("SetNX: %v", err)
+			} else if ok {
+				wins <- i
+			}
+		}()
+	}
+	wg.Wait()
+	close(wins)
+	var winners []int
+	for i := range wins {
+		winners = append(winners, i)
+	}
+	if len(winners) != 1 {
+		t.Fatalf("%d callers won SetNX, want exactly 1", len(winners))
+	}
+	if value, _ := db.Get("lock"); value != winners[0] {
+		t.Errorf("lock = %v, want the winner's %d", value, winners[0])
+	}
+
+	clock := NewFakeClock(time.Unix(1_000_000, 0))
+	db = NewDataBase(WithClock(clock))
+	defer db.Close()
+	db.SetWithTTL("lease", "old", time.Second)
+	clock.Advance(time.Second)
+	if ok, err := db.SetNX("lease", "new"); !ok || err != nil {
+		t.Errorf("SetNX over an expired key = %v, %v; want true", ok, err)
+	}
+}
+
+func TestGetSet(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	if old, existed, err := db.GetSet("k", 1); old != nil || existed || err != nil {
+		t.Errorf("GetSet of a missing key = %v, %v, %v; want nil, false", old, existed, err)
+	}
+	db.Expire("k", time.Hour)
+	if old, existed, err := db.GetSet("k", 2); old != 1 || !existed || err != nil {
+		t.Errorf("GetSet = %v, %v, %v; want 1, true", old, existed, err)
+	}
+	if value, _ := db.Get("k"); value != 2 {
+		t.Errorf("k = %v, want 2", value)
+	}
+	if ttl := db.TTL("k"); ttl != TTLPersistent {
+		t.Errorf("TTL after GetSet = %v, want it cleared as Set does", ttl)
+	}
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	db.SetWithTTL("k", []int{1, 2}, time.Hour)
+	for _, tc := range []struct {
+		old, newValue any
+		want          bool
+	}{
+		{[]int{1, 3}, "x", false},
+		{[]int{1, 2}, "swapped", true}, // Compared by value, not identity.
+		{[]int{1, 2}, "again", false},
+		{"swapped", int64(0), true},
+	} {
+		if ok, err := db.CompareAndSwap("k", tc.old, tc.newValue); ok != tc.want || err != nil {
+			t.Errorf("CompareAndSwap(%v, %v) = %v, %v; want %v", tc.old, tc.newValue, ok, err, tc.want)
+		}
+	}
+	if ttl := db.TTL("k"); ttl <= 0 {
+		t.Errorf("TTL after CompareAndSwap = %v, want the hour kept", ttl)
+	}
+	if ok, _ := db.CompareAndSwap("missing", nil, 1); ok {
+		t.Error("CompareAndSwap of a missing key matched nil")
+	}
+
+	var wg sync.WaitGroup // Read-modify-write loops lose no increments.
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				for {
+					value, _ := db.Get("k")
+					if ok, _ := db.CompareAndSwap("k", value, value.(int64)+1); ok {
+						break
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if value, _ := db.Get("k"); value != int64(800) {
+		t.Errorf("k = %v after 800 increments, want 800", value)
+	}
+
+	db.SetReadOnly(true)
+	if _, err := db.CompareAndSwap("k", int64(800), 0); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("CompareAndSwap while read-only: %v, want ErrReadOnly", err)
+	}
+	if _, err := db.SetNX("new", 0); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("SetNX while read-only: %v, want ErrReadOnly", err)
+	}
+	if _, _, err := db.GetSet("k", 0); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("GetSet while read-only: %v, want ErrReadOnly", err)
+	}
+}
+
+func TestMSetMGetAtomic(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	db.MSet(map[string]any{"from": 0, "to": 0})
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 1; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if err := db.MSet(map[string]any{"from": i, "to": i}); err != nil {
+				t.Errorf("MSet: %v", err)
+				return
+			}
+		}
+	}()
+	for range 2000 {
+		if values := db.MGet("from", "to"); values[0] != values[1] {
+			close(stop)
+			wg.Wait()
+			t.Fatalf("MGet = %v: it saw half of an MSet", values)
+		}
+	}
+	close(stop)
+	wg.Wait()
+}
+
+func TestMSetMGet(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1_000_000, 0))
+	db := NewDataBase(WithClock(clock))
+	defer db.Close()
+	db.SetWithTTL("a", "old", time.Hour)
+	db.SetWithTTL("lapsing", "v", time.Second)
+	if err := db.MSet(map[string]any{"a": 1, "b": "two"}); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := db.TTL("a"); ttl != TTLPersistent {
+		t.Errorf("TTL(a) after MSet = %v, want it cleared as Set does", ttl)
+	}
+	clock.Advance(time.Second)
+	if values := db.MGet("a", "missing", "b", "lapsing", "a"); !reflect.DeepEqual(values, []any{1, nil, "two", nil, 1}) {
+		t.Errorf("MGet = %v, want [1 <nil> two <nil> 1]", values)
+	}
+	if values := db.MGet(); len(values) != 0 {
+		t.Errorf("MGet of no keys = %v, want none", values)
+	}
+
+	value := strings.Repeat("v", 100)
+	db.MSet(map[string]any{"x": value})
+	size, _ := db.MemoryUsage("x")
+	db.SetMaxMemory(db.UsedMemory()+size, NoEviction) // Room for one more key.
+	if err := db.MSet(map[string]any{"y": value, "z": value}); !errors.Is(err, ErrOOM) {
+		t.Errorf("MSet over the budget: %v, want ErrOOM", err)
+	}
+	if values := db.MGet("y", "z"); values[0] != nil || values[1] != nil {
+		t.Errorf("a refused MSet stored %v", values)
+	}
+	db.SetReadOnly(true)
+	if err := db.MSet(map[string]any{"a": 0}); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("MSet while read-only: %v, want ErrReadOnly", err)
+	}
+}
+
+// BenchmarkBatchWrite compares writing 100 keys with one MSet against 100
+// Set calls, which take the lock once per key, from parallel writers that
+// contend for it.
+func BenchmarkBatchWrite(b *testing.B) {
+	pairs := make(map[string]any, 100)
+	for i := range 100 {
+		pairs["key:"+strconv.Itoa(i)] = i
+	}
+	b.Run("MSet", func(b *testing.B) {
+		db := NewDataBase()
+		defer db.Close()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				db.MSet(pairs)
+			}
+		})
+	})
+	b.Run("Set", func(b *testing.B) {
+		db := NewDataBase()
+		defer db.Close()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				for key, value := range pairs {
+					db.Set(key, value)
+				}
+			}
+		})
+	})
+}
+
+func TestMSetNXErrors(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	value := strings.Repeat("v", 100)
+	db.Set("x", value)
+	size, _ := db.MemoryUsage("x")
+	db.SetMaxMemory(db.UsedMemory()+size, NoEviction)
+	if ok, err := db.MSetNX(map[string]any{"y": value, "z": value}); ok || !errors.Is(err, ErrOOM) {
+		t.Errorf("MSetNX over the budget = %v, %v; want false, ErrOOM", ok, err)
+	}
+	if ok, err := db.MSetNX(map[string]any{"x": value}); ok || err != nil {
+		t.Errorf("MSetNX of an existing key = %v, %v; want false and no error", ok, err)
+	}
+	db.SetReadOnly(true)
+	if ok, err := db.MSetNX(map[string]any{"new": 1}); ok || !errors.Is(err, ErrReadOnly) {
+		t.Errorf("MSetNX while read-only = %v, %v; want false, ErrReadOnly", ok, err)
+	}
+	if values := db.MGet("y", "z", "new"); values[0] != nil || values[1] != nil || values[2] != nil {
+		t.Errorf("refused batches stored %v", values)
+	}
+}
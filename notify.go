@@ -0,0 +1,78 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Keyspace event kinds, named after the Redis keyspace notifications.
+const (
+	EventSet     = "set"     // The key was created or written, in place or not.
+	EventDel     = "del"     // The key was deleted.
+	EventExpired = "expired" // The key's TTL elapsed.
+	EventEvicted = "evicted" // The key was evicted to stay under the memory budget.
+)
+
+// KeyEvent reports a change to a key: which key, and one of the Event*
+// kinds.
+type KeyEvent struct {
+	Key   string
+	Event string
+}
+
+// keyNotifier holds the watchers registered by Notify. Events are sent
+// under the database write lock, so it has its own lock for registration.
+type keyNotifier struct {
+	mu       sync.Mutex
+	watchers map[chan KeyEvent]string // Glob pattern by watcher.
+	count    atomic.Int32             // len(watchers), read without mu.
+}
+
+// Notify delivers a KeyEvent for every change to a key matching the glob
+// pattern, with the syntax of Keys, until the returned cancel func is
+// called, which also closes the channel. Every write counts as EventSet,
+// including in-place updates such as HSet and TTL changes, and keys removed
+// by FlushAll or DeletePattern each report EventDel. Like Subscribe,
+// delivery never blocks writers: a watcher more than subscriberBuffer events
+// behind misses events until it catches up. Events are sent while the
+// write lock is held, so a watcher sees them in the order they happened.
+func (db *DataBase) Notify(pattern string) (<-chan KeyEvent, func()) {
+	n := &db.notify
+	ch := make(chan KeyEvent, subscriberBuffer)
+	n.mu.Lock()
+	if n.watchers == nil {
+		n.watchers = make(map[chan KeyEvent]string)
+	}
+	n.watchers[ch] = pattern
+	n.count.Store(int32(len(n.watchers)))
+	n.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			n.mu.Lock()
+			defer n.mu.Unlock()
+			delete(n.watchers, ch)
+			n.count.Store(int32(len(n.watchers)))
+			close(ch) // send holds the lock, so this is safe.
+		})
+	}
+}
+
+// send delivers an event to every watcher whose pattern matches key.
+func (n *keyNotifier) send(key, event string) {
+	if n.count.Load() == 0 {
+		return // Nobody is watching; the common case.
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for ch, pattern := range n.watchers {
+		if !matchGlob(pattern, key) {
+			continue
+		}
+		select {
+		case ch <- KeyEvent{key, event}:
+		default: // Too far behind; drop rather than stall the writer.
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// drainEvents returns the events already queued on ch.
+func drainEvents(ch <-chan KeyEvent) []KeyEvent {
+	var events []KeyEvent
+	for {
+		select {
+		case e, ok := <-ch:
+			if !ok {
+				return events
+			}
+			events = append(events, e)
+		default:
+			return events
+		}
+	}
+}
+
+func TestNotifyEvents(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1_000_000, 0))
+	db := NewDataBase(WithClock(clock))
+	defer db.Close()
+	events, cancel := db.Notify("user:*")
+	defer cancel()
+	all, cancelAll := db.Notify("*")
+	defer cancelAll()
+
+	db.Set("user:1", "ada")
+	db.Set("item:1", "book") // Does not match user:*.
+	db.HSet("user:2", "name", "grace")
+	db.Expire("user:1", time.Second)
+	db.Delete("user:2")
+	db.Delete("user:missing") // Nothing to delete, so no event.
+	clock.Advance(2 * time.Second)
+	db.Set("user:1", "again") // Expires the old value first.
+
+	want := []KeyEvent{
+		{"user:1", EventSet},
+		{"user:2", EventSet},
+		{"user:1", EventSet}, // A TTL change is a write.
+		{"user:2", EventDel},
+		{"user:1", EventExpired},
+		{"user:1", EventSet},
+	}
+	if got := drainEvents(events); !slices.Equal(got, want) {
+		t.Errorf("user:* events = %v, want %v", got, want)
+	}
+	if got := drainEvents(all); len(got) != len(want)+1 || got[1] != (KeyEvent{"item:1", EventSet}) {
+		t.Errorf("* events = %v, want the user:* ones and item:1", got)
+	}
+
+	db.SetMaxMemory(1, AllKeysRandom) // Too small for any key.
+	got := drainEvents(all)
+	slices.SortFunc(got, func(a, b KeyEvent) int { return strings.Compare(a.Key, b.Key) })
+	if want := []KeyEvent{{"item:1", EventEvicted}, {"user:1", EventEvicted}}; !slices.Equal(got, want) {
+		t.Errorf("events after shrinking the budget = %v, want %v", got, want)
+	}
+}
+
+func TestNotifyCancelAndSlowWatcher(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	slow, cancelSlow := db.Notify("*")
+	events, cancel := db.Notify("*")
+
+	for i := range subscriberBuffer + 10 { // Nobody reads slow: writers must not block.
+		db.Set("key:"+strconv.Itoa(i), i)
+	}
+	if got := drainEvents(slow); len(got) != subscriberBuffer || got[0].Key != "key:0" {
+		t.Errorf("a full watcher got %d events, want the first %d", len(got), subscriberBuffer)
+	}
+	drainEvents(events)
+
+	cancel()
+	cancel() // Cancelling twice is harmless.
+	db.Set("after", 1)
+	if e, ok := <-events; ok {
+		t.Errorf("received %v after cancel, want the channel closed", e)
+	}
+	if e := <-slow; e != (KeyEvent{"after", EventSet}) {
+		t.Errorf("the other watcher got %v, want the event for after", e)
+	}
+	cancelSlow()
+	if n := db.notify.count.Load(); n != 0 {
+		t.Errorf("%d watchers registered after cancelling both, want 0", n)
+	}
+}
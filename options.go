@@ -0,0 +1,31 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+)
+
+// Option configures a DataBase at construction time.
+type Option func(*DataBase)
+
+// WithLogger sets the structured logger used for background and persistence
+// events. By default a DataBase logs nothing.
+func WithLogger(logger *slog.Logger) Option {
+	return func(db *DataBase) {
+		if logger != nil {
+			db.logger = logger
+		}
+	}
+}
+
+// WithSweepInterval sets the longest the sweeper waits between runs. Keys
+// are removed as soon as their deadline passes whatever the interval; it
+// bounds how often expired hash fields are removed and how long expiry lags
+// behind a fake clock (see WithClock).
+func WithSweepInterval(interval time.Duration) Option {
+	return func(db *DataBase) {
+		if interval > 0 {
+			db.sweepInterval = interval
+		}
+	}
+}
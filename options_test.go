@@ -0,0 +1,57 @@
+package main
+
+import (
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWithLoggerLogsPersistence(t *testing.T) {
+	var log lockedBuffer
+	db := NewDataBase(WithLogger(slog.New(slog.NewTextHandler(&log, nil))))
+	defer db.Close()
+	dir := t.TempDir()
+	fileName := filepath.Join(dir, "db.gob")
+	db.Set("k", "v")
+
+	for _, step := range []struct {
+		name string
+		run  func() error
+		want string
+	}{
+		{"save", func() error { return db.Persist(fileName) }, `level=INFO msg="snapshot saved" file=` + fileName},
+		{"load", func() error { return db.Load(fileName) }, `level=INFO msg="snapshot loaded" file=` + fileName},
+		{"failed load", func() error { return db.Load(filepath.Join(dir, "missing")) }, `level=ERROR msg="snapshot load failed"`},
+		{"failed save", func() error { return db.Persist(filepath.Join(dir, "no", "such", "dir")) }, `level=ERROR msg="snapshot save failed"`},
+		{"skipped keys", func() error {
+			db.Set("func", func() {}) // Cannot be encoded.
+			return db.Persist(fileName)
+		}, `level=WARN msg="snapshot saved with skipped keys" file=` + fileName + " skipped=[func]"},
+	} {
+		before := len(log.String())
+		step.run()
+		if got := log.String()[before:]; !strings.Contains(got, step.want) {
+			t.Errorf("%s logged %q, want %q", step.name, got, step.want)
+		}
+	}
+}
+
+func TestWithLoggerDefaults(t *testing.T) {
+	db := NewDataBase(WithLogger(nil)) // Ignored: the database stays silent.
+	defer db.Close()
+	if db.logger == nil {
+		t.Fatal("WithLogger(nil) left the database without a logger")
+	}
+	if err := db.Persist(filepath.Join(t.TempDir(), "db.gob")); err != nil {
+		t.Fatalf("Persist: %v", err)
+	}
+
+	var first, second lockedBuffer
+	db = NewDataBase(WithLogger(slog.New(slog.NewTextHandler(&first, nil))), WithLogger(slog.New(slog.NewTextHandler(&second, nil))))
+	defer db.Close()
+	db.Persist(filepath.Join(t.TempDir(), "db.gob"))
+	if first.String() != "" || !strings.Contains(second.String(), "snapshot saved") {
+		t.Errorf("logs = %q and %q, want only the later WithLogger used", first.String(), second.String())
+	}
+}
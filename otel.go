@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// otelScope names this package as the instrumentation scope of its spans.
+const otelScope = "github.com/MohammadAminLouragi/Redis"
+
+// OTelTracer adapts an OpenTelemetry TracerProvider to Tracer, for
+// ServerConfig.Tracer and WithTracer. Spans started from a context
+// carrying a remote parent from ExtractTraceParent join the caller's
+// trace, and a span whose status attribute is "error" ends with an error
+// status, described by its error attribute when it has one.
+func OTelTracer(tp trace.TracerProvider) Tracer {
+	return otelTracer{tp.Tracer(otelScope)}
+}
+
+// otelTracer is the Tracer returned by OTelTracer.
+type otelTracer struct {
+	tracer trace.Tracer
+}
+
+// Start implements Tracer.
+func (t otelTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	if sc, ok := RemoteSpanContext(ctx); ok && !trace.SpanContextFromContext(ctx).IsValid() {
+		cfg := trace.SpanContextConfig{TraceID: sc.TraceID, SpanID: sc.SpanID, Remote: true}
+		if sc.Sampled {
+			cfg.TraceFlags = trace.FlagsSampled
+		}
+		ctx = trace.ContextWithRemoteSpanContext(ctx, trace.NewSpanContext(cfg))
+	}
+	ctx, span := t.tracer.Start(ctx, name)
+	return ctx, otelSpan{span}
+}
+
+// otelSpan is the Span returned by otelTracer.
+type otelSpan struct {
+	span trace.Span
+}
+
+// SetAttribute implements Span, keeping the type of strings, bools and
+// numbers and recording anything else by its fmt.Sprint form.
+func (s otelSpan) SetAttribute(key string, value any) {
+	switch {
+	case key == "error":
+		s.span.SetStatus(codes.Error, fmt.Sprint(value))
+	case key == "status" && value == "error": // HTTP errors carry no message.
+		s.span.SetStatus(codes.Error, "")
+	}
+	switch v := value.(type) {
+	case string:
+		s.span.SetAttributes(attribute.String(key, v))
+	case bool:
+		s.span.SetAttributes(attribute.Bool(key, v))
+	case int:
+		s.span.SetAttributes(attribute.Int(key, v))
+	case int64:
+		s.span.SetAttributes(attribute.Int64(key, v))
+	case float64:
+		s.span.SetAttributes(attribute.Float64(key, v))
+	default:
+		s.span.SetAttributes(attribute.String(key, fmt.Sprint(v)))
+	}
+}
+
+// End implements Span.
+func (s otelSpan) End() { s.span.End() }
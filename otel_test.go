@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// spanAttr returns the value of the attribute key on span, or an invalid
+// value if it has none.
+func spanAttr(span sdktrace.ReadOnlySpan, key string) attribute.Value {
+	for _, kv := range span.Attributes() {
+		if string(kv.Key) == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestOTelTracerServer(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	defer tp.Shutdown(t.Context())
+	db := NewDataBase()
+	defer db.Close()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(db, ServerConfig{Tracer: OTelTracer(tp)})
+	go s.Serve(ln)
+	c := dial(t, ln.Addr().String())
+	c.do(t, "SET", "user:1", "ada")
+	db.RPush("list", "a")
+	c.do(t, "GET", "list") // Not a string.
+	c.do(t, "PING")
+	s.Close() // Waits for the connection, so the spans have ended.
+
+	spans := recorder.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("recorded %d spans, want one per command", len(spans))
+	}
+	for i, want := range []struct {
+		name, key, status string
+		code              codes.Code
+	}{
+		{"redis.SET", "user:1", "ok", codes.Unset},
+		{"redis.GET", "list", "error", codes.Error},
+		{"redis.PING", "", "ok", codes.Unset},
+	} {
+		span := spans[i]
+		if span.Name() != want.name || spanAttr(span, "db.key").AsString() != want.key || spanAttr(span, "status").AsString() != want.status || span.Status().Code != want.code {
+			t.Errorf("span %d = %s on %q with status %v, want %s on %q with status %s",
+				i, span.Name(), spanAttr(span, "db.key").AsString(), span.Status(), want.name, want.key, want.status)
+		}
+	}
+	if desc := spans[1].Status().Description; desc == "" {
+		t.Error("the failed command's span status has no description")
+	}
+	if spans[0].InstrumentationScope().Name != otelScope {
+		t.Errorf("instrumentation scope = %q, want %q", spans[0].InstrumentationScope().Name, otelScope)
+	}
+}
+
+func TestOTelTracerJoinsRemoteParent(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	defer tp.Shutdown(t.Context())
+	db := NewDataBase(WithTracer(OTelTracer(tp)))
+	defer db.Close()
+	h := db.HTTPHandler()
+
+	header := http.Header{"Traceparent": {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}}
+	httpDo(h, "PUT", "/keys/k", `{"value":"v"}`, header)
+	httpDo(h, "GET", "/keys/missing", "", nil)
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("recorded %d spans, want 2", len(spans))
+	}
+	put, get := spans[0], spans[1]
+	if got := put.Parent(); !got.IsRemote() || got.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" || got.SpanID().String() != "00f067aa0ba902b7" || !got.IsSampled() {
+		t.Errorf("PUT span parent = %v, want the traceparent header's", got)
+	}
+	if put.SpanContext().TraceID() != put.Parent().TraceID() {
+		t.Errorf("PUT span trace = %v, want the caller's %v", put.SpanContext().TraceID(), put.Parent().TraceID())
+	}
+	if get.Parent().IsValid() {
+		t.Errorf("GET span has parent %v without a traceparent header", get.Parent())
+	}
+	if spanAttr(get, "http.status_code").AsInt64() != http.StatusNotFound || get.Status().Code != codes.Error {
+		t.Errorf("GET span status = %v, code %v, want a 404 error", get.Status(), spanAttr(get, "http.status_code"))
+	}
+}
@@ -0,0 +1,459 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"time"
+)
+
+// Snapshot file layout
+//
+// A snapshot is a magic header followed by a stream of self-contained records:
+//
+//	header: "GOREDIS" version(1 byte)
+//	entry:  'K' uvarint(len(key)) key uvarint(len(value)) value
+//	ttl:    'T' uvarint(len(key)) key varint(deadline) uvarint(len(value)) value
+//	end:    'E'
+//	sum:    crc32(4 bytes, big-endian)
+//
+// A 'T' record is an entry for a key with a TTL; its deadline is the absolute
+// expiry time in Unix nanoseconds. The trailing sum is the CRC-32C
+// (Castagnoli) of every byte from the header through the end marker, so
+// bit-rot anywhere in the file is caught on load. Version 1 files, written
+// before TTLs were saved, contain only 'K' records; neither they nor version
+// 2 files carry a sum. Both are still read.
+//
+// Each value is gob-encoded on its own, so one unencodable value never breaks
+// the file, a reader can skip a value without decoding it, and a truncated
+// file still yields every record written before the damage. Files without the
+// header are treated as the legacy format: a single gob-encoded map.
+const (
+	snapshotMagic   = "GOREDIS"
+	snapshotVersion = 3
+	checksumSize    = 4 // Bytes in the trailing CRC-32C.
+
+	recordEntry    = 'K' // A key/value record.
+	recordEntryTTL = 'T' // A key/value record with an expiry deadline.
+	recordEnd      = 'E' // Marks a complete snapshot.
+
+	// maxSnapshotRecord caps the length of a key or value, so a corrupted
+	// length is reported rather than allocated. It is far above anything the
+	// server accepts, and fits an int on every platform.
+	maxSnapshotRecord = 1<<31 - 1
+	snapshotPrealloc  = 1 << 20 // Longer strings are read without allocating up front.
+)
+
+// ErrChecksumMismatch is returned when loading a snapshot whose contents do
+// not match its checksum, meaning the file was corrupted or truncated after
+// it was written. Nothing from such a file is loaded, except by
+// LoadBestEffort.
+var ErrChecksumMismatch = errors.New("snapshot: checksum mismatch")
+
+// checksumTable is the CRC-32C polynomial, which has hardware support on
+// common CPUs.
+var checksumTable = crc32.MakeTable(crc32.Castagnoli)
+
+// errUnencodable marks a value that gob cannot encode.
+var errUnencodable = errors.New("value cannot be gob-encoded")
+
+// gobValue wraps a value so gob records its concrete type, exactly as it does
+// for the values of a map[string]any. Values of a type named by RegisterType
+// leave Value empty and are stored as Data under their registered Type name
+// instead; blobs written before the registry existed decode with Type unset.
+// Values with a custom serializer (see RegisterSerializer) are likewise
+// stored as Data, produced by the serializer named in Codec.
+type gobValue struct {
+	Value any
+	Type  string // Registered type name, if any.
+	Data  []byte // The encoded value of a registered type.
+	Codec string // Custom serializer name, if any.
+}
+
+// encodeValue gob-encodes a single value into a standalone blob.
+func encodeValue(value any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := encodeValueTo(&buf, value); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeValueTo implements encodeValue, appending the blob to buf, which
+// lets snapshot writers encode into a pooled buffer.
+func encodeValueTo(buf *bytes.Buffer, value any) error {
+	wrapped := gobValue{Value: value}
+	if s, ok := serializerFor(value); ok {
+		data, err := s.marshal(value)
+		if err != nil {
+			return fmt.Errorf("%w: %v", errUnencodable, err)
+		}
+		wrapped = gobValue{Codec: s.name, Data: data}
+	} else if name, ok := registeredName(value); ok {
+		data := getBuffer() // Copied into buf by the encoder below.
+		defer putBuffer(data)
+		if err := encodeRegistered(data, value); err != nil {
+			return fmt.Errorf("%w: %v", errUnencodable, err)
+		}
+		wrapped = gobValue{Type: name, Data: data.Bytes()}
+	}
+	if err := gob.NewEncoder(buf).Encode(&wrapped); err != nil {
+		return fmt.Errorf("%w: %v", errUnencodable, err)
+	}
+	return nil
+}
+
+// decodeValue reverses encodeValue.
+func decodeValue(blob []byte) (any, error) {
+	var v gobValue
+	if err := gob.NewDecoder(bytes.NewReader(blob)).Decode(&v); err != nil {
+		return nil, err
+	}
+	if v.Codec != "" {
+		s, ok := serializerNamed(v.Codec)
+		if !ok {
+			return nil, fmt.Errorf("snapshot: no serializer registered for %q", v.Codec)
+		}
+		return s.unmarshal(v.Data)
+	}
+	if v.Type != "" {
+		return decodeRegistered(v.Type, v.Data) // Map the stable name onto today's type.
+	}
+	return v.Value, nil
+}
+
+// snapshotWriter writes the record stream to an underlying writer.
+type snapshotWriter struct {
+	w       *bufio.Writer
+	out     io.Writer                   // The underlying writer, for the trailing sum.
+	sum     hash.Hash32                 // Checksum of everything written so far.
+	scratch [binary.MaxVarintLen64]byte // Reused for length prefixes.
+}
+
+// newSnapshotWriter writes the header and returns a writer for the records.
+func newSnapshotWriter(w io.Writer) (*snapshotWriter, error) {
+	sum := crc32.New(checksumTable)
+	sw := &snapshotWriter{w: bufio.NewWriter(io.MultiWriter(w, sum)), out: w, sum: sum}
+	if _, err := sw.w.WriteString(snapshotMagic); err != nil {
+		return nil, err
+	}
+	if err := sw.w.WriteByte(snapshotVersion); err != nil {
+		return nil, err
+	}
+	return sw, nil
+}
+
+// writeEntry encodes and appends one key/value record, with its expiry
+// deadline unless deadline is zero. It returns an error wrapping
+// errUnencodable, without writing anything, if the value cannot be encoded;
+// the stream remains valid in that case.
+func (sw *snapshotWriter) writeEntry(key string, value any, deadline time.Time) error {
+	buf := getBuffer()
+	defer putBuffer(buf) // writeRaw copies the blob into the bufio.Writer.
+	if err := encodeValueTo(buf, value); err != nil {
+		return err // Nothing has been written for this record.
+	}
+	return sw.writeRaw(key, buf.Bytes(), deadline)
+}
+
+// writeRaw appends a record whose value is already encoded.
+func (sw *snapshotWriter) writeRaw(key string, blob []byte, deadline time.Time) error {
+	tag := byte(recordEntry)
+	if !deadline.IsZero() {
+		tag = recordEntryTTL
+	}
+	if err := sw.w.WriteByte(tag); err != nil {
+		return err
+	}
+	if err := sw.writeBytes([]byte(key)); err != nil {
+		return err
+	}
+	if !deadline.IsZero() {
+		n := binary.PutVarint(sw.scratch[:], deadline.UnixNano())
+		if _, err := sw.w.Write(sw.scratch[:n]); err != nil {
+			return err
+		}
+	}
+	return sw.writeBytes(blob)
+}
+
+// writeBytes writes a length-prefixed byte string.
+func (sw *snapshotWriter) writeBytes(b []byte) error {
+	n := binary.PutUvarint(sw.scratch[:], uint64(len(b)))
+	if _, err := sw.w.Write(sw.scratch[:n]); err != nil {
+		return err
+	}
+	_, err := sw.w.Write(b)
+	return err
+}
+
+// close writes the end marker, flushes buffered records and appends the
+// checksum.
+func (sw *snapshotWriter) close() error {
+	if err := sw.w.WriteByte(recordEnd); err != nil {
+		return err
+	}
+	if err := sw.w.Flush(); err != nil {
+		return err
+	}
+	_, err := sw.out.Write(sw.sum.Sum(nil)) // Written around sum, so it is not hashed.
+	return err
+}
+
+// checksumReader passes a stream through unchanged while hashing all of it
+// except the last checksumSize bytes, which it holds back as the trailer
+// since the end of the stream is only known once it has been reached.
+type checksumReader struct {
+	r    io.Reader
+	sum  hash.Hash32
+	tail []byte // The latest bytes read, not yet hashed.
+}
+
+// Read implements io.Reader.
+func (cr *checksumReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.tail = append(cr.tail, p[:n]...)
+	if extra := len(cr.tail) - checksumSize; extra > 0 {
+		cr.sum.Write(cr.tail[:extra])
+		cr.tail = append(cr.tail[:0], cr.tail[extra:]...)
+	}
+	return n, err
+}
+
+// snapshotReader reads the record stream written by snapshotWriter.
+type snapshotReader struct {
+	r        *bufio.Reader
+	sum      *checksumReader // Hashes what r reads, for verify.
+	version  byte            // Format version; 0 for the legacy format.
+	deadline time.Time       // Expiry of the current record; zero if none.
+
+	legacy map[string]any // Set when reading a legacy single-map file.
+	keys   []string       // Remaining legacy keys, consumed by next.
+}
+
+// newSnapshotReader validates the header. Files that do not start with the
+// magic header are decoded as a legacy gob map and replayed record by record.
+func newSnapshotReader(r io.Reader) (*snapshotReader, error) {
+	sum := &checksumReader{r: r, sum: crc32.New(checksumTable)}
+	sr := &snapshotReader{r: bufio.NewReader(sum), sum: sum}
+	header, err := sr.r.Peek(len(snapshotMagic) + 1)
+	if err == nil && string(header[:len(snapshotMagic)]) == snapshotMagic {
+		sr.version = header[len(snapshotMagic)]
+		if sr.version < 1 || sr.version > snapshotVersion {
+			return nil, fmt.Errorf("snapshot: unsupported version %d", sr.version)
+		}
+		_, err = sr.r.Discard(len(header)) // Consume the header.
+		return sr, err
+	}
+
+	// No header: fall back to the original whole-map gob format.
+	if err := gob.NewDecoder(sr.r).Decode(&sr.legacy); err != nil {
+		return nil, err
+	}
+	for key := range sr.legacy {
+		sr.keys = append(sr.keys, key)
+	}
+	return sr, nil
+}
+
+// next advances to the following record and returns its key, setting
+// deadline to the record's expiry, if it has one. It returns
+// io.EOF after the end marker, and io.ErrUnexpectedEOF if the stream stops
+// before the end marker. The record's value must then be consumed with
+// value, raw or skip before next is called again.
+func (sr *snapshotReader) next() (string, error) {
+	if sr.legacy != nil {
+		if len(sr.keys) == 0 {
+			return "", io.EOF
+		}
+		key := sr.keys[0]
+		sr.keys = sr.keys[1:]
+		return key, nil
+	}
+
+	tag, err := sr.r.ReadByte()
+	if err != nil {
+		return "", unexpected(err) // The end marker is missing.
+	}
+	sr.deadline = time.Time{}
+	switch tag {
+	case recordEnd:
+		if _, err := sr.r.Peek(1); sr.version < 3 && err == nil {
+			return "", ErrChecksumMismatch // Only a sum may follow: the version byte is damaged.
+		}
+		return "", io.EOF
+	case recordEntry:
+		key, err := sr.readBytes()
+		return string(key), err
+	case recordEntryTTL:
+		key, err := sr.readBytes()
+		if err != nil {
+			return "", err
+		}
+		nanos, err := binary.ReadVarint(sr.r)
+		if err != nil {
+			return "", unexpected(err)
+		}
+		sr.deadline = time.Unix(0, nanos)
+		return string(key), nil
+	}
+	return "", fmt.Errorf("snapshot: unknown record tag %q", tag)
+}
+
+// value decodes the value of the current record, given its key.
+func (sr *snapshotReader) value(key string) (any, error) {
+	if sr.legacy != nil {
+		return sr.legacy[key], nil
+	}
+	blob, err := sr.readBytes()
+	if err != nil {
+		return nil, err
+	}
+	return decodeValue(blob)
+}
+
+// raw returns the encoded value of the current record without decoding it.
+func (sr *snapshotReader) raw(key string) ([]byte, error) {
+	if sr.legacy != nil {
+		return encodeValue(sr.legacy[key]) // Legacy files hold decoded values only.
+	}
+	return sr.readBytes()
+}
+
+// skip discards the value of the current record without decoding it.
+func (sr *snapshotReader) skip() error {
+	if sr.legacy != nil {
+		return nil
+	}
+	n, err := sr.length()
+	if err != nil {
+		return err
+	}
+	_, err = sr.r.Discard(n)
+	return unexpected(err)
+}
+
+// readBytes reads a length-prefixed byte string.
+func (sr *snapshotReader) readBytes() ([]byte, error) {
+	n, err := sr.length()
+	if err != nil {
+		return nil, err
+	}
+	if n <= snapshotPrealloc {
+		b := make([]byte, n)
+		if _, err := io.ReadFull(sr.r, b); err != nil {
+			return nil, unexpected(err)
+		}
+		return b, nil
+	}
+	// Grow with the data actually read, so a corrupted length that is
+	// within the limit still cannot allocate more than the file holds.
+	b, err := io.ReadAll(io.LimitReader(sr.r, int64(n)))
+	if err == nil && len(b) < n {
+		err = io.ErrUnexpectedEOF
+	}
+	return b, err
+}
+
+// length reads the uvarint length of a byte string, rejecting lengths over
+// maxSnapshotRecord as corruption that has lost the framing.
+func (sr *snapshotReader) length() (int, error) {
+	n, err := binary.ReadUvarint(sr.r)
+	if err != nil {
+		return 0, unexpected(err)
+	}
+	if n > maxSnapshotRecord {
+		return 0, fmt.Errorf("snapshot: record length %d exceeds %d bytes: %w", n, maxSnapshotRecord, io.ErrUnexpectedEOF)
+	}
+	return int(n), nil
+}
+
+// verify reads the rest of the stream and checks it against the trailing
+// checksum, returning ErrChecksumMismatch if they differ. Formats without a
+// checksum always pass.
+func (sr *snapshotReader) verify() error {
+	if sr.version < 3 {
+		return nil
+	}
+	if _, err := io.Copy(io.Discard, sr.r); err != nil {
+		return err
+	}
+	if len(sr.sum.tail) != checksumSize || binary.BigEndian.Uint32(sr.sum.tail) != sr.sum.sum.Sum32() {
+		return ErrChecksumMismatch
+	}
+	return nil
+}
+
+// checked adds ErrChecksumMismatch to err if the stream fails verification,
+// so that reading errors caused by corruption are reported as such.
+func (sr *snapshotReader) checked(err error) error {
+	if sumErr := sr.verify(); sumErr != nil {
+		return errors.Join(sumErr, err)
+	}
+	return err
+}
+
+// unexpected converts a bare io.EOF inside a record into io.ErrUnexpectedEOF,
+// since a well-formed stream only ends after the end marker.
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// snapshotEntry is a decoded record: a value and its expiry deadline, which
+// is zero for keys without a TTL.
+type snapshotEntry struct {
+	value    any
+	deadline time.Time
+}
+
+// readSnapshot decodes every record accepted by keep (all records when keep
+// is nil) into a new map. Rejected values are skipped without decoding.
+//
+// On failure the map holds every record decoded before the error. With
+// bestEffort set, a value that fails to decode is skipped and reading goes
+// on, since its neighbours are framed independently; such errors are joined
+// with the one that finally stops the stream, if any. The stream's checksum
+// is verified once it has been read, and ErrChecksumMismatch is joined to
+// the result if it fails, even when an earlier error stopped the read.
+func readSnapshot(r io.Reader, keep func(key string) bool, bestEffort bool) (map[string]snapshotEntry, error) {
+	loaded := make(map[string]snapshotEntry)
+	sr, err := newSnapshotReader(r)
+	if err != nil {
+		return loaded, err
+	}
+	var valueErrs []error // Per-record failures tolerated in best-effort mode.
+	for {
+		key, err := sr.next()
+		if err == io.EOF {
+			return loaded, sr.checked(errors.Join(valueErrs...)) // Reached the end marker.
+		}
+		if err != nil {
+			return loaded, sr.checked(errors.Join(append(valueErrs, err)...))
+		}
+		if keep != nil && !keep(key) {
+			if err := sr.skip(); err != nil {
+				return loaded, sr.checked(errors.Join(append(valueErrs, err)...))
+			}
+			continue
+		}
+		value, err := sr.value(key)
+		if err != nil {
+			err = fmt.Errorf("snapshot: key %q: %w", key, err)
+			if !bestEffort || errors.Is(err, io.ErrUnexpectedEOF) {
+				return loaded, sr.checked(errors.Join(append(valueErrs, err)...)) // Framing is lost.
+			}
+			valueErrs = append(valueErrs, err) // Skip just this record.
+			continue
+		}
+		loaded[key] = snapshotEntry{value, sr.deadline}
+	}
+}
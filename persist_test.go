@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// persistKeys saves n keys to a snapshot in a temporary directory and
+// returns the file's name and contents.
+func persistKeys(t *testing.T, n int) (string, []byte) {
+	t.Helper()
+	db := NewDataBase()
+	defer db.Close()
+	for i := range n {
+		db.Set(fmt.Sprintf("key%03d", i), fmt.Sprintf("value%03d", i))
+	}
+	fileName := filepath.Join(t.TempDir(), "database.gob")
+	if err := db.Persist(fileName); err != nil {
+		t.Fatalf("Persist: %v", err)
+	}
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fileName, data
+}
+
+func TestLoadBestEffortTruncated(t *testing.T) {
+	fileName, data := persistKeys(t, 100)
+	if err := os.WriteFile(fileName, data[:len(data)/2], 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	db := NewDataBase()
+	defer db.Close()
+	if err := db.Load(fileName); err == nil {
+		t.Fatal("Load of a truncated file succeeded")
+	}
+	loaded, err := db.LoadBestEffort(fileName)
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("LoadBestEffort error = %v, want io.ErrUnexpectedEOF", err)
+	}
+	if loaded == 0 || loaded >= 100 {
+		t.Fatalf("LoadBestEffort recovered %d keys, want some but not all of 100", loaded)
+	}
+	if got := len(db.Keys("*")); got != loaded {
+		t.Errorf("database holds %d keys, want the %d recovered", got, loaded)
+	}
+	for _, key := range db.Keys("*") {
+		if value, _ := db.Get(key); value != "value"+key[len("key"):] {
+			t.Errorf("recovered %s = %v", key, value)
+		}
+	}
+}
+
+func TestLoadBestEffortCorruptLength(t *testing.T) {
+	header := append([]byte(snapshotMagic), snapshotVersion)
+	for _, tc := range []struct {
+		name string
+		body []byte
+	}{
+		{"key length", binary.AppendUvarint([]byte{recordEntry}, 1<<62)},
+		{"value length", binary.AppendUvarint(append([]byte{recordEntry, 1}, 'k'), 1<<62)},
+		{"skipped value", binary.AppendUvarint(append([]byte{recordEntry, 1}, 'k'), 1<<40)},
+		{"length past the end", binary.AppendUvarint(append([]byte{recordEntry, 1}, 'k'), 1<<30)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fileName := filepath.Join(t.TempDir(), "database.gob")
+			if err := os.WriteFile(fileName, append(header, tc.body...), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			db := NewDataBase()
+			defer db.Close()
+			loaded, err := db.LoadBestEffort(fileName)
+			if !errors.Is(err, io.ErrUnexpectedEOF) {
+				t.Errorf("LoadBestEffort error = %v, want io.ErrUnexpectedEOF", err)
+			}
+			if loaded != 0 {
+				t.Errorf("LoadBestEffort recovered %d keys, want 0", loaded)
+			}
+			if err := db.LoadFiltered(fileName, func(string) bool { return false }); !errors.Is(err, io.ErrUnexpectedEOF) {
+				t.Errorf("LoadFiltered error = %v, want io.ErrUnexpectedEOF", err)
+			}
+		})
+	}
+}
+
+func TestLoadBestEffortCorruptValue(t *testing.T) {
+	fileName, data := persistKeys(t, 10)
+	data[len(data)/2] ^= 0xff // Damage one value in the middle of the file.
+	if err := os.WriteFile(fileName, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	db := NewDataBase()
+	defer db.Close()
+	loaded, err := db.LoadBestEffort(fileName)
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("LoadBestEffort error = %v, want ErrChecksumMismatch", err)
+	}
+	if loaded < 9 {
+		t.Errorf("LoadBestEffort recovered %d keys, want at least the 9 undamaged", loaded)
+	}
+}
+
+func TestPersistLoadRoundTrip(t *testing.T) {
+	fileName, _ := persistKeys(t, 50)
+	db := NewDataBase()
+	defer db.Close()
+	if err := db.Load(fileName); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if got := len(db.Keys("*")); got != 50 {
+		t.Errorf("Load restored %d keys, want 50", got)
+	}
+}
+
+func TestLoadDetectsFlippedByte(t *testing.T) {
+	fileName, data := persistKeys(t, 10)
+	for i := range data {
+		damaged := bytes.Clone(data)
+		damaged[i] ^= 0x01 // A single bit of rot anywhere in the file.
+		if err := os.WriteFile(fileName, damaged, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		db := NewDataBase()
+		err := db.Load(fileName)
+		if err == nil {
+			t.Fatalf("Load of a file with byte %d flipped succeeded", i)
+		}
+		if i >= len(snapshotMagic) && !errors.Is(err, ErrChecksumMismatch) { // Past the magic, which fails as a foreign file.
+			t.Errorf("Load with byte %d flipped: %v, want ErrChecksumMismatch", i, err)
+		}
+		if n := len(db.Keys("*")); n != 0 {
+			t.Fatalf("Load with byte %d flipped merged %d keys, want none", i, n)
+		}
+		db.Close()
+	}
+
+	data[len(snapshotMagic)] = 2 // A version without a sum, followed by one.
+	if err := os.WriteFile(fileName, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenMMapped(fileName); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("OpenMMapped with the version damaged: %v, want ErrChecksumMismatch", err)
+	}
+}
+
+// TestPersistUnderConcurrentWrites saves in a tight loop while writers keep
+// pairs of keys equal with MSet, push to lists in place and delete keys, and
+// checks every snapshot against those invariants. Run it with -race.
+func TestPersistUnderConcurrentWrites(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for w := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			list := fmt.Sprintf("log:%d", w)
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				a, b := fmt.Sprintf("a:%d:%d", w, i%50), fmt.Sprintf("b:%d:%d", w, i%50)
+				db.MSet(map[string]any{a: i, b: i}) // a and b always change together.
+				db.RPushCapped(list, 100, i)        // Updated in place.
+				db.HSet("hash:"+list, "last", i)
+				if i%7 == 0 {
+					db.Unlink(a, b) // Removed together too.
+				}
+			}
+		}()
+	}
+
+	fileName := filepath.Join(t.TempDir(), "database.gob")
+	for range 20 {
+		if err := db.Persist(fileName); err != nil {
+			t.Fatalf("Persist: %v", err)
+		}
+		loaded := NewDataBase()
+		if err := loaded.Load(fileName); err != nil {
+			t.Fatalf("Load: %v", err)
+		}
+		for _, key := range loaded.Keys("a:*") {
+			a, _ := loaded.Get(key)
+			if b, _ := loaded.Get("b" + key[1:]); b != a {
+				t.Fatalf("snapshot has %s = %v but b%s = %v: a save saw half an MSet", key, a, key[1:], b)
+			}
+		}
+		for w := range 4 {
+			items, _ := loaded.LRange(fmt.Sprintf("log:%d", w), 0, -1)
+			for i := 1; i < len(items); i++ {
+				if items[i] != items[i-1].(int)+1 {
+					t.Fatalf("log:%d holds %v after %v in the snapshot: a list was torn", w, items[i], items[i-1])
+				}
+			}
+		}
+		loaded.Close()
+	}
+	close(stop)
+	wg.Wait()
+}
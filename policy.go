@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Policy constrains the values that Set may store under keys with a given
+// prefix. The zero value allows everything.
+type Policy struct {
+	// MaxSize caps the estimated payload size of a value in bytes
+	// (see valueSize); zero means no cap.
+	MaxSize int
+
+	// Types lists the value kinds allowed, using the labels returned by
+	// kindOf: "string", "bytes", "int", "float", "bool", "list", "hash",
+	// "set", "zset", "stream", "hyperloglog" and "other". An empty list
+	// allows every kind.
+	Types []string
+}
+
+// PolicyError is returned by Set when a value violates its key's policy.
+type PolicyError struct {
+	Key    string // The key being written.
+	Prefix string // The prefix whose policy was violated.
+	Reason string // What was wrong with the value.
+}
+
+// Error implements the error interface.
+func (e *PolicyError) Error() string {
+	return fmt.Sprintf("policy %q rejects key %q: %s", e.Prefix, e.Key, e.Reason)
+}
+
+// kindOf classifies a value for prefix policies.
+func kindOf(value any) string {
+	switch value.(type) {
+	case string:
+		return "string"
+	case []byte:
+		return "bytes"
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return "int"
+	case float32, float64:
+		return "float"
+	case bool:
+		return "bool"
+	case List:
+		return "list"
+	case Hash:
+		return "hash"
+	case Set:
+		return "set"
+	case *ZSet:
+		return "zset"
+	case *Stream:
+		return "stream"
+	case *HyperLogLog:
+		return "hyperloglog"
+	}
+	return "other"
+}
+
+// SetPrefixPolicy applies policy to every key starting with prefix, for
+// example a 1 MiB cap under "cache:" and integers only under "counter:".
+// When several prefixes match a key, the longest one wins and the others are
+// ignored. Setting a policy again for the same prefix replaces it. Existing
+// values are not checked; the policy applies to later Set calls.
+func (db *DataBase) SetPrefixPolicy(prefix string, policy Policy) {
+	db.lock.Lock()         // Acquire a write lock.
+	defer db.lock.Unlock() // Release the lock when the function exits.
+	if db.policies == nil {
+		db.policies = make(map[string]Policy) // Created lazily on first use.
+	}
+	policy.Types = slices.Clone(policy.Types) // Don't alias the caller's slice.
+	db.policies[prefix] = policy
+}
+
+// checkPolicy validates value against the longest matching prefix policy.
+// The caller must hold the lock.
+func (db *DataBase) checkPolicy(key string, value any) error {
+	best, found := "", false
+	for prefix := range db.policies {
+		if strings.HasPrefix(key, prefix) && (!found || len(prefix) > len(best)) {
+			best, found = prefix, true
+		}
+	}
+	if !found {
+		return nil // Unconstrained key.
+	}
+	policy := db.policies[best]
+	if len(policy.Types) > 0 && !slices.Contains(policy.Types, kindOf(value)) {
+		return &PolicyError{key, best, fmt.Sprintf("type %s not allowed", kindOf(value))}
+	}
+	if policy.MaxSize > 0 {
+		if size := valueSize(value); size > policy.MaxSize {
+			return &PolicyError{key, best, fmt.Sprintf("size %d exceeds %d bytes", size, policy.MaxSize)}
+		}
+	}
+	return nil
+}
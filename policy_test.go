@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrefixPolicies(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	db.SetPrefixPolicy("cache:", Policy{MaxSize: 16})
+	db.SetPrefixPolicy("cache:int:", Policy{Types: []string{"int"}}) // Longer, so it wins.
+	db.SetPrefixPolicy("counter:", Policy{Types: []string{"int", "float"}, MaxSize: 8})
+
+	for _, tc := range []struct {
+		key    string
+		value  any
+		prefix string // Of the violated policy; empty if allowed.
+	}{
+		{"cache:a", "short", ""},
+		{"cache:a", strings.Repeat("x", 17), "cache:"},
+		{"cache:int:a", 7, ""},
+		{"cache:int:a", "7", "cache:int:"},
+		{"cache:int:a", strings.Repeat("x", 17), "cache:int:"}, // Only the longest prefix applies.
+		{"counter:a", 1.5, ""},
+		{"counter:a", true, "counter:"},
+		{"other", strings.Repeat("x", 1000), ""},
+	} {
+		err := db.Set(tc.key, tc.value)
+		var policy *PolicyError
+		if tc.prefix == "" {
+			if err != nil {
+				t.Errorf("Set(%s, %T): %v", tc.key, tc.value, err)
+			}
+			continue
+		}
+		if !errors.As(err, &policy) || policy.Prefix != tc.prefix || policy.Key != tc.key {
+			t.Errorf("Set(%s, %T): %v, want a violation of %s", tc.key, tc.value, err, tc.prefix)
+		}
+	}
+	if value, _ := db.Get("cache:int:a"); value != 7 {
+		t.Errorf("cache:int:a = %v after refused writes, want 7", value)
+	}
+
+	var policy *PolicyError
+	if err := db.SetWithTTL("counter:b", "x", time.Minute); !errors.As(err, &policy) {
+		t.Errorf("SetWithTTL: %v, want a *PolicyError", err)
+	}
+	db.SetPrefixPolicy("counter:", Policy{}) // Replaced by one allowing everything.
+	if err := db.Set("counter:b", "x"); err != nil {
+		t.Errorf("Set after the policy was replaced: %v", err)
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"bytes"
+	"sync"
+)
+
+// maxPooledBuffer is the largest buffer returned to bufferPool; bigger ones
+// are left to the garbage collector, so one huge value does not stay pinned.
+const maxPooledBuffer = 64 << 10
+
+// bufferPool recycles the scratch buffers used to encode values for
+// snapshots and compression, which are otherwise allocated once per value.
+var bufferPool = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+// getBuffer returns an empty buffer from the pool.
+func getBuffer() *bytes.Buffer {
+	return bufferPool.Get().(*bytes.Buffer)
+}
+
+// putBuffer returns buf to the pool. Nothing may use buf, or any slice of
+// its contents, afterwards.
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBuffer {
+		return
+	}
+	buf.Reset()
+	bufferPool.Put(buf)
+}
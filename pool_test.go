@@ -0,0 +1,43 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// benchmarkPooled runs op b.N times with the buffer pool, and again with a
+// fresh, empty pool for every op, so that each buffer is allocated anew as
+// it was before pooling. Compare the allocs/op of the two.
+func benchmarkPooled(b *testing.B, op func()) {
+	newBuffer := bufferPool.New
+	b.Run("pooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for range b.N {
+			op()
+		}
+	})
+	b.Run("unpooled", func(b *testing.B) {
+		defer func() { bufferPool = sync.Pool{New: newBuffer} }()
+		b.ReportAllocs()
+		for range b.N {
+			bufferPool = sync.Pool{New: newBuffer} // Nothing to reuse.
+			op()
+		}
+	})
+}
+
+// BenchmarkPoolCompressedSet is a Set-heavy workload of 4 KiB log entries
+// that CompressLargeValues compresses, each through a scratch buffer:
+// pooled, a Set no longer allocates its scratch buffer.
+func BenchmarkPoolCompressedSet(b *testing.B) {
+	db := NewDataBase(CompressLargeValues(1024))
+	defer db.Close()
+	entry := strings.Repeat("GET /index.html 200\n", 205)
+	i := 0
+	benchmarkPooled(b, func() {
+		db.Set("log:"+strconv.Itoa(i%1000), entry)
+		i++
+	})
+}
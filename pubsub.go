@@ -0,0 +1,135 @@
+package main
+
+import "sync"
+
+// subscriberBuffer is how many undelivered messages a subscriber may have
+// queued before further messages to it are dropped.
+const subscriberBuffer = 64
+
+// PMessage is a message delivered to a pattern subscriber, carrying the
+// channel it was published on along with the pattern that matched it.
+type PMessage struct {
+	Pattern string
+	Channel string
+	Payload any
+}
+
+// pubSub holds the channel and pattern subscriptions. It is independent of
+// the keyspace and has its own lock.
+type pubSub struct {
+	mu       sync.RWMutex
+	channels map[string]map[chan any]struct{}      // Exact subscribers by channel.
+	patterns map[string]map[chan PMessage]struct{} // Pattern subscribers by pattern.
+	replay   *replayLog                            // Recent messages; nil unless WithReplayBuffer.
+}
+
+// newPubSub returns an empty registry.
+func newPubSub() *pubSub {
+	return &pubSub{
+		channels: make(map[string]map[chan any]struct{}),
+		patterns: make(map[string]map[chan PMessage]struct{}),
+	}
+}
+
+// Subscribe delivers every message published on channel to the returned
+// Go channel until the returned cancel func is called, which also closes it.
+// Delivery never blocks Publish: a subscriber that falls more than
+// subscriberBuffer messages behind misses messages until it catches up.
+// NewSubscription follows several channels and patterns on one Go channel.
+func (db *DataBase) Subscribe(channel string) (<-chan any, func()) {
+	return db.pubsub.subscribe(channel, 0)
+}
+
+// subscribe registers a new subscriber of channel, queueing up to replay of
+// its recent messages first, and returns the func that cancels it.
+func (ps *pubSub) subscribe(channel string, replay int) (chan any, func()) {
+	ps.mu.Lock() // Hold off Publish so any replay joins live delivery exactly.
+	var backlog []any
+	if ps.replay != nil && replay > 0 {
+		backlog = ps.replay.recent(channel, replay)
+	}
+	ch := make(chan any, subscriberBuffer+len(backlog))
+	for _, message := range backlog {
+		ch <- message // Fits: the channel has room for the whole backlog.
+	}
+	if ps.channels[channel] == nil {
+		ps.channels[channel] = make(map[chan any]struct{})
+	}
+	ps.channels[channel][ch] = struct{}{}
+	ps.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			ps.mu.Lock()
+			defer ps.mu.Unlock()
+			delete(ps.channels[channel], ch)
+			if len(ps.channels[channel]) == 0 {
+				delete(ps.channels, channel)
+			}
+			close(ch) // Publish holds the lock while sending, so this is safe.
+		})
+	}
+}
+
+// PSubscribe is like Subscribe but receives messages published on every
+// channel matching the glob pattern, with the same syntax as Keys. Each
+// message says which channel it came from.
+func (db *DataBase) PSubscribe(pattern string) (<-chan PMessage, func()) {
+	ps := db.pubsub
+	ch := make(chan PMessage, subscriberBuffer)
+	ps.mu.Lock()
+	if ps.patterns[pattern] == nil {
+		ps.patterns[pattern] = make(map[chan PMessage]struct{})
+	}
+	ps.patterns[pattern][ch] = struct{}{}
+	ps.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			ps.mu.Lock()
+			defer ps.mu.Unlock()
+			delete(ps.patterns[pattern], ch)
+			if len(ps.patterns[pattern]) == 0 {
+				delete(ps.patterns, pattern)
+			}
+			close(ch)
+		})
+	}
+}
+
+// Publish sends message to every subscriber of channel and to every pattern
+// subscriber whose pattern matches it, so a subscriber holding both kinds of
+// subscription receives it once per subscription, as in Redis. It returns
+// the number of subscriptions that received the message; subscribers whose
+// buffer is full are skipped and not counted.
+func (db *DataBase) Publish(channel string, message any) int {
+	ps := db.pubsub
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+	if ps.replay != nil {
+		ps.replay.record(channel, message)
+	}
+	received := 0
+	for ch := range ps.channels[channel] {
+		select {
+		case ch <- message:
+			received++
+		default: // Too far behind; drop rather than stall the publisher.
+		}
+	}
+	for pattern, subs := range ps.patterns {
+		if !matchGlob(pattern, channel) {
+			continue
+		}
+		for ch := range subs {
+			select {
+			case ch <- PMessage{pattern, channel, message}:
+				received++
+			default:
+			}
+		}
+	}
+	return received
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestPSubscribeOverlapsSubscribe(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	exact, cancelExact := db.Subscribe("news.sport")
+	defer cancelExact()
+	wide, cancelWide := db.PSubscribe("news.*")
+	defer cancelWide()
+	other, cancelOther := db.PSubscribe("weather.*")
+	defer cancelOther()
+
+	if n := db.Publish("news.sport", "goal"); n != 2 {
+		t.Errorf("Publish = %d, want the exact and the pattern subscriber", n)
+	}
+	if message := <-exact; message != "goal" {
+		t.Errorf("exact subscriber got %v, want goal", message)
+	}
+	if pm := <-wide; pm != (PMessage{"news.*", "news.sport", "goal"}) {
+		t.Errorf("pattern subscriber got %+v", pm)
+	}
+
+	if n := db.Publish("news.tech", "chips"); n != 1 {
+		t.Errorf("Publish to a channel only the pattern matches = %d, want 1", n)
+	}
+	if pm := <-wide; pm.Channel != "news.tech" || pm.Payload != "chips" {
+		t.Errorf("pattern subscriber got %+v, want chips on news.tech", pm)
+	}
+	if len(exact) != 0 || len(other) != 0 {
+		t.Error("a subscriber received a message for a channel it does not follow")
+	}
+
+	cancelWide()
+	if _, open := <-wide; open {
+		t.Error("cancel left the pattern channel open")
+	}
+	cancelWide() // Cancelling twice is harmless.
+	if n := db.Publish("news.sport", "again"); n != 1 {
+		t.Errorf("Publish after the pattern was cancelled = %d, want 1", n)
+	}
+}
+
+// receive takes n messages from ch, failing the test if they do not come.
+func receive(t *testing.T, ch <-chan any, n int) []any {
+	t.Helper()
+	got := make([]any, 0, n)
+	for range n {
+		select {
+		case message := <-ch:
+			got = append(got, message)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("received %v, want %d messages", got, n)
+		}
+	}
+	return got
+}
+
+func TestSubscribeWithReplay(t *testing.T) {
+	db := NewDataBase(WithReplayBuffer(3))
+	defer db.Close()
+	for i := range 5 {
+		db.Publish("orders", i) // Only the last three are kept.
+	}
+	db.Publish("other", "x")
+
+	late, cancelLate := db.SubscribeWithReplay("orders", 10)
+	defer cancelLate()
+	short, cancelShort := db.SubscribeWithReplay("orders", 2)
+	defer cancelShort()
+	live, cancelLive := db.Subscribe("orders")
+	defer cancelLive()
+	db.Publish("orders", 5)
+	db.Publish("orders", 6)
+
+	for _, tc := range []struct {
+		name string
+		ch   <-chan any
+		want []any
+	}{
+		{"replay 10", late, []any{2, 3, 4, 5, 6}}, // The buffer, then live, in order.
+		{"replay 2", short, []any{3, 4, 5, 6}},
+		{"no replay", live, []any{5, 6}},
+	} {
+		if got := receive(t, tc.ch, len(tc.want)); !slices.Equal(got, tc.want) {
+			t.Errorf("%s received %v, want %v", tc.name, got, tc.want)
+		}
+		select {
+		case extra := <-tc.ch:
+			t.Errorf("%s received %v as well: a message was repeated", tc.name, extra)
+		default:
+		}
+	}
+
+	off := NewDataBase()
+	defer off.Close()
+	off.Publish("orders", "before")
+	ch, cancel := off.SubscribeWithReplay("orders", 10)
+	defer cancel()
+	off.Publish("orders", "after")
+	if got := receive(t, ch, 1); got[0] != "after" {
+		t.Errorf("without WithReplayBuffer received %v first, want only live messages", got[0])
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"math/rand/v2"
+	"sync"
+)
+
+// lockedRand is a random source shared by commands that run under a read
+// lock, so it needs its own mutex.
+type lockedRand struct {
+	mu sync.Mutex
+	r  *rand.Rand
+}
+
+// newLockedRand seeds a PCG generator. Equal seeds give equal sequences.
+func newLockedRand(seed1, seed2 uint64) *lockedRand {
+	return &lockedRand{r: rand.New(rand.NewPCG(seed1, seed2))}
+}
+
+// intN returns a uniform random int in [0, n).
+func (lr *lockedRand) intN(n int) int {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	return lr.r.IntN(n)
+}
+
+// perm returns a random permutation of [0, n).
+func (lr *lockedRand) perm(n int) []int {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	return lr.r.Perm(n)
+}
+
+// WithRandSeed makes random commands such as SRandMember and SPop
+// reproducible: two databases with the same seed and the same contents
+// return the same picks. By default the generator is seeded randomly.
+func WithRandSeed(seed uint64) Option {
+	return func(db *DataBase) {
+		db.rand = newLockedRand(seed, seed)
+	}
+}
+
+// float64 returns a uniform random float64 in [0, 1).
+func (lr *lockedRand) float64() float64 {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	return lr.r.Float64()
+}
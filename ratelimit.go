@@ -0,0 +1,43 @@
+package main
+
+import "time"
+
+// AllowN reports whether n more events may happen for key under a limit of
+// limit events per window, consuming them if so, and returns how many events
+// remain in the current window.
+//
+// It uses a fixed-window counter, the classic Redis INCR+EXPIRE pattern: the
+// first event opens a window of the given length, stored as an int64 counter
+// at key with a TTL of window, and the counter disappears when the window
+// elapses. Fixed windows are cheap and exact within a window but can let up
+// to 2*limit events through across a window boundary. A request that would
+// exceed the limit is rejected whole and consumes nothing. A read-only
+// database, which cannot record events, allows none.
+func (db *DataBase) AllowN(key string, limit int, window time.Duration, n int) (allowed bool, remaining int) {
+	db.lock.Lock()    // Check and consume atomically.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	if db.readOnly {
+		return false, 0
+	}
+	db.expireIfNeeded(key)
+
+	used, isCounter := db.data.value(key).(int64)
+	_, hasDeadline := db.expires.get(key)
+	open := isCounter && hasDeadline // Anything else means no window is running.
+	if !open {
+		used = 0
+	}
+	if used+int64(n) > int64(limit) {
+		return false, max(limit-int(used), 0) // Over the limit; consume nothing.
+	}
+
+	used += int64(n)
+	if open {
+		db.data.set(key, used) // Same window; keep its deadline.
+		db.touch(key)
+	} else {
+		db.setLocked(key, used)                         // First event opens the window.
+		db.expires.set(key, db.clock.Now().Add(window)) // The window closes by expiry.
+	}
+	return true, limit - int(used)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAllowNLimitAndReset(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1_000_000, 0))
+	db := NewDataBase(WithClock(clock))
+	defer db.Close()
+	for i := range 5 {
+		allowed, remaining := db.AllowN("api:ada", 5, time.Minute, 1)
+		if !allowed || remaining != 4-i {
+			t.Fatalf("event %d: %v, %d remaining; want allowed with %d", i+1, allowed, remaining, 4-i)
+		}
+	}
+	if allowed, remaining := db.AllowN("api:ada", 5, time.Minute, 1); allowed || remaining != 0 {
+		t.Errorf("event past the limit: %v, %d remaining; want refused with 0", allowed, remaining)
+	}
+	if allowed, _ := db.AllowN("api:bob", 5, time.Minute, 1); !allowed {
+		t.Error("another key shares the limit")
+	}
+
+	clock.Advance(time.Minute - time.Nanosecond)
+	if allowed, _ := db.AllowN("api:ada", 5, time.Minute, 1); allowed {
+		t.Error("allowed before the window elapsed")
+	}
+	clock.Advance(time.Nanosecond)
+	if allowed, remaining := db.AllowN("api:ada", 5, time.Minute, 1); !allowed || remaining != 4 {
+		t.Errorf("after the window: %v, %d remaining; want a fresh window with 4", allowed, remaining)
+	}
+}
+
+func TestAllowNBatch(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	if allowed, remaining := db.AllowN("k", 10, time.Minute, 7); !allowed || remaining != 3 {
+		t.Fatalf("AllowN(7) = %v, %d", allowed, remaining)
+	}
+	if allowed, remaining := db.AllowN("k", 10, time.Minute, 4); allowed || remaining != 3 {
+		t.Errorf("AllowN(4) over the limit = %v, %d; want refused, consuming nothing", allowed, remaining)
+	}
+	if allowed, remaining := db.AllowN("k", 10, time.Minute, 3); !allowed || remaining != 0 {
+		t.Errorf("AllowN(3) up to the limit = %v, %d; want allowed with 0 left", allowed, remaining)
+	}
+}
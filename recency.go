@@ -0,0 +1,87 @@
+package main
+
+import (
+	"container/list"
+	"sort"
+	"sync"
+)
+
+// recencyList orders keys from most to least recently accessed. Reads update
+// it under the shared read lock, so it has its own mutex.
+type recencyList struct {
+	mu    sync.Mutex
+	order *list.List               // Front is the most recently used key.
+	elems map[string]*list.Element // Each key's place in order.
+}
+
+// WithRecencyTracking keeps every key in access order, enabling
+// KeysByRecency. Each access then also takes a short, shared mutex, so it is
+// off by default.
+func WithRecencyTracking() Option {
+	return func(db *DataBase) {
+		db.recency = &recencyList{order: list.New(), elems: make(map[string]*list.Element)}
+	}
+}
+
+// used moves key to the front of the list.
+func (r *recencyList) used(key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if e, ok := r.elems[key]; ok {
+		r.order.MoveToFront(e)
+		return
+	}
+	r.elems[key] = r.order.PushFront(key)
+}
+
+// forget drops a removed key.
+func (r *recencyList) forget(key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if e, ok := r.elems[key]; ok {
+		r.order.Remove(e)
+		delete(r.elems, key)
+	}
+}
+
+// accessed records a read or write of key when recency or LFU tracking is
+// on.
+func (db *DataBase) accessed(key string) {
+	if db.recency != nil {
+		db.recency.used(key)
+	}
+	if db.lfu != nil {
+		db.lfu.hit(key, db.clock.Now(), db.rand)
+	}
+}
+
+// KeysByRecency returns up to n live keys, from the most to the least
+// recently accessed, where any read or write of a key counts as an access.
+// It shows the working set of a cache. Without WithRecencyTracking no order
+// is known, and up to n keys are returned in lexical order instead.
+func (db *DataBase) KeysByRecency(n int) []string {
+	db.lock.RLock()         // Acquire a read lock.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+
+	now := db.clock.Now()
+	if db.recency == nil {
+		var keys []string
+		for key := range db.data.all() {
+			if !db.isExpired(key, now) {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		return keys[:min(max(n, 0), len(keys))]
+	}
+
+	db.recency.mu.Lock()
+	defer db.recency.mu.Unlock()
+	keys := make([]string, 0, min(max(n, 0), db.recency.order.Len()))
+	for e := db.recency.order.Front(); e != nil && len(keys) < n; e = e.Next() {
+		if key := e.Value.(string); !db.isExpired(key, now) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestKeysByRecency(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1_000_000, 0))
+	db := NewDataBase(WithClock(clock), WithRecencyTracking())
+	defer db.Close()
+	for _, key := range []string{"a", "b", "c", "d"} {
+		db.Set(key, 1)
+	}
+	db.SetWithTTL("lapsed", 1, time.Second)
+	db.Get("b")
+	db.Get("a")
+	db.Set("d", 2) // A write counts as an access too.
+	db.Get("missing")
+
+	clock.Advance(time.Second) // Expired keys are left out.
+	if got, want := db.KeysByRecency(10), []string{"d", "a", "b", "c"}; !slices.Equal(got, want) {
+		t.Errorf("KeysByRecency(10) = %q, want %q", got, want)
+	}
+	if got, want := db.KeysByRecency(2), []string{"d", "a"}; !slices.Equal(got, want) {
+		t.Errorf("KeysByRecency(2) = %q, want %q", got, want)
+	}
+	db.Delete("a")
+	if got, want := db.KeysByRecency(10), []string{"d", "b", "c"}; !slices.Equal(got, want) {
+		t.Errorf("KeysByRecency after a Delete = %q, want %q", got, want)
+	}
+	if got := db.KeysByRecency(0); len(got) != 0 {
+		t.Errorf("KeysByRecency(0) = %q, want none", got)
+	}
+
+	plain := NewDataBase()
+	defer plain.Close()
+	for _, key := range []string{"c", "a", "b"} {
+		plain.Set(key, 1)
+	}
+	if got, want := plain.KeysByRecency(2), []string{"a", "b"}; !slices.Equal(got, want) {
+		t.Errorf("KeysByRecency without tracking = %q, want the lexical %q", got, want)
+	}
+}
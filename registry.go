@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// typeRegistry maps stable, user-chosen names to Go types for snapshots.
+var typeRegistry = struct {
+	mu     sync.RWMutex
+	byName map[string]reflect.Type // Every registered name, old and new.
+	byType map[reflect.Type]string // The name each type is saved under.
+}{
+	byName: make(map[string]reflect.Type),
+	byType: make(map[reflect.Type]string),
+}
+
+// serializer is a custom encoding registered with RegisterSerializer.
+type serializer struct {
+	name      string // Identifies the serializer in snapshots.
+	marshal   func(any) ([]byte, error)
+	unmarshal func([]byte) (any, error)
+}
+
+// serializerRegistry holds the custom serializers, by type and by name.
+var serializerRegistry = struct {
+	mu     sync.RWMutex
+	byType map[reflect.Type]*serializer
+	byName map[string]*serializer
+}{
+	byType: make(map[reflect.Type]*serializer),
+	byName: make(map[string]*serializer),
+}
+
+// RegisterSerializer makes snapshots store values of type t with marshal
+// instead of gob, and Load rebuild them with unmarshal, for types that gob
+// encodes poorly or that already have a compact encoding, such as
+// protobuf messages. It takes precedence over RegisterType for the same
+// type. Snapshots identify the serializer by t's package path and name, so
+// the type must keep them for saved values to load; registering again
+// replaces the functions. Like RegisterType, it applies to top-level values
+// only, and it panics if either function is nil.
+func RegisterSerializer(t reflect.Type, marshal func(any) ([]byte, error), unmarshal func([]byte) (any, error)) {
+	if t == nil || marshal == nil || unmarshal == nil {
+		panic("RegisterSerializer: nil type or function")
+	}
+	s := &serializer{name: typeName(t), marshal: marshal, unmarshal: unmarshal}
+	serializerRegistry.mu.Lock()
+	defer serializerRegistry.mu.Unlock()
+	serializerRegistry.byType[t] = s
+	serializerRegistry.byName[s.name] = s
+}
+
+// typeName returns a name for t that stays the same across builds: its
+// package path and name, with a "*" for each level of pointer.
+func typeName(t reflect.Type) string {
+	if t.Kind() == reflect.Pointer && t.Name() == "" {
+		return "*" + typeName(t.Elem())
+	}
+	if t.Name() != "" && t.PkgPath() != "" {
+		return t.PkgPath() + "." + t.Name()
+	}
+	return t.String() // Built-in and unnamed types.
+}
+
+// serializerFor returns the serializer registered for value's type.
+func serializerFor(value any) (*serializer, bool) {
+	serializerRegistry.mu.RLock()
+	defer serializerRegistry.mu.RUnlock()
+	s, ok := serializerRegistry.byType[reflect.TypeOf(value)]
+	return s, ok
+}
+
+// serializerNamed returns the serializer saved under name.
+func serializerNamed(name string) (*serializer, bool) {
+	serializerRegistry.mu.RLock()
+	defer serializerRegistry.mu.RUnlock()
+	s, ok := serializerRegistry.byName[name]
+	return s, ok
+}
+
+// RegisterType gives the type of example a stable name in snapshots. Values
+// of a registered type are saved under that name rather than under the Go
+// type identity gob would record, so the type can be renamed or moved to
+// another package without breaking existing snapshots: register the new Go
+// type under the old name and Load maps the saved values onto it.
+//
+// A type may be registered under several names. The most recent name is used
+// for saving and every name is accepted when loading, which allows renaming
+// the stable name itself. Registering one name for two different types
+// panics. The registry applies to top-level values; values nested inside
+// lists, hashes or interfaces are still encoded by gob alone and need
+// gob.Register as before.
+func RegisterType(name string, example any) {
+	if name == "" || example == nil {
+		panic("RegisterType: empty name or nil example")
+	}
+	typ := reflect.TypeOf(example)
+	typeRegistry.mu.Lock()
+	defer typeRegistry.mu.Unlock()
+	if prev, ok := typeRegistry.byName[name]; ok && prev != typ {
+		panic(fmt.Sprintf("RegisterType: name %q already registered for %v", name, prev))
+	}
+	typeRegistry.byName[name] = typ
+	typeRegistry.byType[typ] = name
+}
+
+// registeredName returns the stable name of value's type, if registered.
+func registeredName(value any) (string, bool) {
+	typeRegistry.mu.RLock()
+	defer typeRegistry.mu.RUnlock()
+	name, ok := typeRegistry.byType[reflect.TypeOf(value)]
+	return name, ok
+}
+
+// registeredType returns the type registered under name.
+func registeredType(name string) (reflect.Type, bool) {
+	typeRegistry.mu.RLock()
+	defer typeRegistry.mu.RUnlock()
+	typ, ok := typeRegistry.byName[name]
+	return typ, ok
+}
+
+// encodeRegistered gob-encodes the concrete value into buf, without any
+// type name.
+func encodeRegistered(buf *bytes.Buffer, value any) error {
+	return gob.NewEncoder(buf).Encode(value)
+}
+
+// decodeRegistered decodes data written by encodeRegistered into a new value
+// of the type registered under name.
+func decodeRegistered(name string, data []byte) (any, error) {
+	typ, ok := registeredType(name)
+	if !ok {
+		return nil, fmt.Errorf("snapshot: value of unregistered type %q", name)
+	}
+	ptr := reflect.New(typ)
+	if err := gob.NewDecoder(bytes.NewReader(data)).DecodeValue(ptr); err != nil {
+		return nil, fmt.Errorf("snapshot: type %q: %w", name, err)
+	}
+	return ptr.Elem().Interface(), nil
+}
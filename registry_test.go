@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// oldProfile and newProfile stand for one type before and after it moved
+// to another package and was renamed.
+type oldProfile struct {
+	Name string
+	Age  int
+}
+
+type newProfile struct {
+	Name  string
+	Age   int
+	Email string // Added since; gob leaves it empty.
+}
+
+// forgetType removes name from the type registry, as a new build that no
+// longer has the old type would not have it.
+func forgetType(name string) {
+	typeRegistry.mu.Lock()
+	defer typeRegistry.mu.Unlock()
+	if typ, ok := typeRegistry.byName[name]; ok {
+		delete(typeRegistry.byType, typ)
+		delete(typeRegistry.byName, name)
+	}
+}
+
+func TestRegisterTypeSurvivesRename(t *testing.T) {
+	const name = "test.Profile"
+	t.Cleanup(func() { forgetType(name) })
+	RegisterType(name, oldProfile{})
+	src := NewDataBase()
+	defer src.Close()
+	src.Set("user:1", oldProfile{"ada", 36})
+	fileName := filepath.Join(t.TempDir(), "database.gob")
+	if err := src.Persist(fileName); err != nil {
+		t.Fatal(err)
+	}
+
+	forgetType(name) // The next build has only the new type...
+	RegisterType(name, newProfile{})
+
+	db := NewDataBase()
+	defer db.Close()
+	if err := db.Load(fileName); err != nil {
+		t.Fatalf("Load after the rename: %v", err)
+	}
+	value, _ := db.Get("user:1")
+	if !reflect.DeepEqual(value, newProfile{Name: "ada", Age: 36}) {
+		t.Errorf("user:1 = %#v, want it as a newProfile", value)
+	}
+
+	forgetType(name) // ...and a build that registers nothing cannot load it.
+	if err := NewDataBase().Load(fileName); err == nil {
+		t.Error("Load of an unregistered type succeeded")
+	}
+}
+
+func TestRegisterTypeNameClash(t *testing.T) {
+	const name = "test.Clash"
+	t.Cleanup(func() { forgetType(name) })
+	RegisterType(name, oldProfile{})
+	RegisterType(name, oldProfile{}) // Again for the same type is fine.
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a name for a second type did not panic")
+		}
+	}()
+	RegisterType(name, newProfile{})
+}
+
+// point has a custom serializer in registerPoint: eight bytes rather than
+// gob's type description.
+type point struct{ X, Y int32 }
+
+// registerPoint registers the serializer of point for the length of the
+// test, counting its calls in marshals and unmarshals.
+func registerPoint(t *testing.T, marshals, unmarshals *int) {
+	typ := reflect.TypeFor[point]()
+	RegisterSerializer(typ, func(v any) ([]byte, error) {
+		*marshals++
+		p := v.(point)
+		return binary.BigEndian.AppendUint32(binary.BigEndian.AppendUint32(nil, uint32(p.X)), uint32(p.Y)), nil
+	}, func(b []byte) (any, error) {
+		*unmarshals++
+		if len(b) != 8 {
+			return nil, errors.New("point: want 8 bytes")
+		}
+		return point{int32(binary.BigEndian.Uint32(b)), int32(binary.BigEndian.Uint32(b[4:]))}, nil
+	})
+	t.Cleanup(func() {
+		serializerRegistry.mu.Lock()
+		defer serializerRegistry.mu.Unlock()
+		delete(serializerRegistry.byName, serializerRegistry.byType[typ].name)
+		delete(serializerRegistry.byType, typ)
+	})
+}
+
+func TestRegisterSerializer(t *testing.T) {
+	marshals, unmarshals := 0, 0
+	registerPoint(t, &marshals, &unmarshals)
+
+	src := NewDataBase()
+	defer src.Close()
+	src.Set("origin", point{0, 0})
+	src.Set("corner", point{-3, 1 << 20})
+	src.Set("other", "plain") // Other types still use gob.
+	fileName := filepath.Join(t.TempDir(), "database.gob")
+	if err := src.Persist(fileName); err != nil {
+		t.Fatal(err)
+	}
+	if marshals != 2 {
+		t.Errorf("marshal ran %d times, want once per point", marshals)
+	}
+
+	db := NewDataBase()
+	defer db.Close()
+	if err := db.Load(fileName); err != nil {
+		t.Fatal(err)
+	}
+	if unmarshals != 2 {
+		t.Errorf("unmarshal ran %d times, want once per point", unmarshals)
+	}
+	for key, want := range map[string]any{"origin": point{0, 0}, "corner": point{-3, 1 << 20}, "other": "plain"} {
+		if got, _ := db.Get(key); got != want {
+			t.Errorf("%s = %#v after the round trip, want %#v", key, got, want)
+		}
+	}
+}
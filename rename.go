@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"maps"
+	"time"
+)
+
+// Key operation errors, worded as Redis words them.
+var (
+	ErrNoSuchKey = errors.New("ERR no such key")
+	ErrSameKey   = errors.New("ERR source and destination objects are the same")
+)
+
+// Rename moves the value at src to dst, with its TTL and hash field TTLs,
+// replacing whatever dst held, as one write. A missing src is ErrNoSuchKey;
+// renaming a key to itself changes nothing. The value must satisfy the
+// prefix policy of dst; otherwise the *PolicyError is returned and neither
+// key changes.
+func (db *DataBase) Rename(src, dst string) error {
+	db.lock.Lock()    // One lock for the read, the removal and the write.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	if db.readOnly {
+		return ErrReadOnly
+	}
+	db.expireIfNeeded(src)
+	db.expireIfNeeded(dst)
+
+	value, ok := db.data.get(src)
+	if !ok {
+		return ErrNoSuchKey
+	}
+	if src == dst {
+		return nil
+	}
+	if err := db.checkPolicy(dst, value); err != nil {
+		return err
+	}
+	deadline, hasTTL := db.expires.get(src)
+	fields := db.fieldExpires[src]
+	db.removeKey(src)
+	db.place(dst, value, true, deadline, hasTTL, fields)
+	return nil
+}
+
+// Copy stores a deep copy of the value at src under dst, with its TTL and
+// hash field TTLs, and reports whether it did. Nothing is copied if src is
+// missing, or if dst exists and replace is not set. Copying a key to itself
+// is ErrSameKey. The copy must satisfy the prefix policy of dst and fit the
+// memory budget, as for Set.
+func (db *DataBase) Copy(src, dst string, replace bool) (bool, error) {
+	if src == dst {
+		return false, ErrSameKey
+	}
+	db.lock.Lock()    // Acquire a write lock.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	if db.readOnly {
+		return false, ErrReadOnly
+	}
+	db.expireIfNeeded(src)
+	db.expireIfNeeded(dst)
+
+	value, ok := db.data.get(src)
+	if !ok || (!replace && db.data.has(dst)) {
+		return false, nil
+	}
+	value = deepCopy(value) // The two keys share nothing afterwards.
+	if err := db.checkPolicy(dst, value); err != nil {
+		return false, err
+	}
+	if err := db.checkOOM(dst, value); err != nil {
+		return false, err
+	}
+	deadline, hasTTL := db.expires.get(src)
+	var fields map[string]time.Time
+	if f := db.fieldExpires[src]; f != nil {
+		fields = maps.Clone(f)
+	}
+	db.place(dst, value, true, deadline, hasTTL, fields)
+	return true, nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRenameKeepsTTLs(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1_000_000, 0))
+	db := NewDataBase(WithClock(clock))
+	defer db.Close()
+	db.SetWithTTL("src", "v", time.Minute)
+	db.Set("dst", "replaced")
+	if err := db.Rename("src", "dst"); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+	if _, ok := db.Get("src"); ok {
+		t.Error("src survived Rename")
+	}
+	if value, _ := db.Get("dst"); value != "v" {
+		t.Errorf("dst = %v, want v", value)
+	}
+	if ttl := db.TTL("dst"); ttl != time.Minute {
+		t.Errorf("TTL(dst) = %v, want the minute src had", ttl)
+	}
+
+	db.Set("plain", "p")
+	db.SetWithTTL("timed", "t", time.Hour)
+	if err := db.Rename("plain", "timed"); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+	if ttl := db.TTL("timed"); ttl >= 0 {
+		t.Errorf("TTL after renaming a key without one = %v, want none: dst's old TTL goes with its value", ttl)
+	}
+
+	db.HSetEX("hash", "brief", 1, time.Second)
+	db.HSet("hash", "kept", 2)
+	if err := db.Rename("hash", "moved"); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+	clock.Advance(2 * time.Second)
+	if got, _ := db.HGetAll("moved"); !reflect.DeepEqual(got, map[string]any{"kept": 2}) {
+		t.Errorf("moved hash after its field TTL = %v, want only kept", got)
+	}
+}
+
+func TestRenameEdgeCases(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	if err := db.Rename("missing", "dst"); !errors.Is(err, ErrNoSuchKey) {
+		t.Errorf("Rename of a missing key: %v, want ErrNoSuchKey", err)
+	}
+	if _, ok := db.Get("dst"); ok {
+		t.Error("Rename of a missing key created dst")
+	}
+	db.SetWithTTL("k", "v", time.Minute)
+	if err := db.Rename("k", "k"); err != nil {
+		t.Errorf("Rename to the same key: %v", err)
+	}
+	if value, _ := db.Get("k"); value != "v" || db.TTL("k") <= 0 {
+		t.Errorf("k = %v with TTL %v after renaming it to itself, want both unchanged", value, db.TTL("k"))
+	}
+	db.SetReadOnly(true)
+	if err := db.Rename("k", "other"); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Rename on a read-only database: %v, want ErrReadOnly", err)
+	}
+}
+
+func TestCopy(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	db.SetWithTTL("src", List{"a"}, time.Minute)
+	db.Set("taken", "x")
+	if ok, err := db.Copy("src", "taken", false); ok || err != nil {
+		t.Errorf("Copy onto an existing key = %v, %v; want false without REPLACE", ok, err)
+	}
+	if ok, err := db.Copy("src", "taken", true); !ok || err != nil {
+		t.Errorf("Copy with replace = %v, %v; want true", ok, err)
+	}
+	if ttl := db.TTL("taken"); ttl <= 0 {
+		t.Errorf("TTL of the copy = %v, want src's", ttl)
+	}
+	db.RPush("taken", "b")
+	if got, _ := db.LRange("src", 0, -1); !reflect.DeepEqual(got, []any{"a"}) {
+		t.Errorf("src = %v after pushing to its copy, want [a]", got)
+	}
+	if ok, err := db.Copy("missing", "dst", false); ok || err != nil {
+		t.Errorf("Copy of a missing key = %v, %v; want false", ok, err)
+	}
+	if _, err := db.Copy("src", "src", true); !errors.Is(err, ErrSameKey) {
+		t.Errorf("Copy to itself: %v, want ErrSameKey", err)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import "sync"
+
+// replayLog keeps the most recent messages of every channel for
+// SubscribeWithReplay. It has its own lock because Publish appends to it
+// under the pub/sub read lock.
+type replayLog struct {
+	mu       sync.Mutex
+	size     int              // Messages kept per channel.
+	channels map[string][]any // Recent messages by channel, oldest first.
+}
+
+// WithReplayBuffer makes every channel remember its last size messages, so
+// SubscribeWithReplay can hand them to a subscriber that has just
+// reconnected. Messages are kept whether or not anyone is subscribed, and
+// each channel ever published on keeps its buffer, so the cost is up to size
+// messages per channel. Replay is off by default.
+func WithReplayBuffer(size int) Option {
+	return func(db *DataBase) {
+		if size > 0 {
+			db.pubsub.replay = &replayLog{size: size, channels: make(map[string][]any)}
+		}
+	}
+}
+
+// SubscribeWithReplay is like Subscribe, but first delivers up to the last
+// replay messages published on channel, oldest first, followed by every
+// message published from then on, with nothing missed or repeated in
+// between. It bridges the gap while a subscriber reconnects. Only messages
+// kept by WithReplayBuffer can be replayed; without it this is Subscribe.
+func (db *DataBase) SubscribeWithReplay(channel string, replay int) (<-chan any, func()) {
+	return db.pubsub.subscribe(channel, replay)
+}
+
+// record remembers message as the latest on channel.
+func (r *replayLog) record(channel string, message any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	buf := r.channels[channel]
+	if len(buf) == r.size {
+		buf = append(buf[:0:0], buf[1:]...) // Fresh array, so recent's copies stay intact.
+	}
+	r.channels[channel] = append(buf, message)
+}
+
+// recent returns up to n of the latest messages on channel, oldest first.
+func (r *replayLog) recent(channel string, n int) []any {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	buf := r.channels[channel]
+	return append([]any(nil), buf[max(len(buf)-n, 0):]...)
+}
@@ -0,0 +1,418 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Replication stream tags, used alongside the AOF set and delete records.
+const (
+	replSnapshotEnd = 'E' // The full sync snapshot is complete.
+	replCheck       = 'C' // The primary's fingerprint, sent by CheckReplicas.
+)
+
+// Replication tuning.
+const (
+	replFeedBacklog = 1024             // Batches a replica may fall behind before it is dropped.
+	replQueue       = 4096             // Records a replica receives ahead of applying them.
+	replRetry       = time.Second      // Wait before reconnecting to the primary.
+	replDialTimeout = 10 * time.Second // Limit on connecting to the primary.
+)
+
+// replFullResync is the primary's reply to SYNC, after which the connection
+// carries the replication stream.
+const replFullResync = "+FULLRESYNC\r\n"
+
+// errReplicaDiverged ends a replication link whose data no longer matches
+// the primary's, so that it reconnects with a full sync.
+var errReplicaDiverged = errors.New("replication: replica diverged from its primary")
+
+// replicaFeeds holds the primary's end of every replica stream. The set
+// changes under the shared read lock, so it has its own lock, and count
+// lets writers skip it cheaply while there are no replicas.
+type replicaFeeds struct {
+	mu    sync.Mutex
+	feeds map[*replicaFeed]struct{}
+	count atomic.Int32 // len(feeds), read without mu.
+}
+
+// replicaFeed queues the records bound for one replica.
+type replicaFeed struct {
+	batches chan []byte   // Encoded records, in the order they were made.
+	dropped chan struct{} // Closed once the replica fell too far behind.
+}
+
+// send queues records for every replica. A replica too far behind to take
+// them is dropped, and resynchronizes when it reconnects, rather than
+// stalling the writer. The caller must hold the lock.
+func (f *replicaFeeds) send(buf []byte) {
+	if f.count.Load() == 0 {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for feed := range f.feeds {
+		select {
+		case feed.batches <- buf: // Never modified once sent, so it can be shared.
+		default:
+			close(feed.dropped)
+			delete(f.feeds, feed)
+		}
+	}
+	f.count.Store(int32(len(f.feeds)))
+}
+
+// attachReplica registers a new replica and returns a snapshot of every
+// live key, ending in a snapshot end record, to send it before its feed.
+// Both are taken under the read lock, so the feed carries exactly the
+// changes made after the snapshot.
+func (db *DataBase) attachReplica() ([]byte, *replicaFeed) {
+	db.lock.RLock()         // Hold off writers so the snapshot is of one instant.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+
+	var snapshot []byte
+	now := db.clock.Now()
+	for key := range db.data.all() {
+		if !db.isExpired(key, now) {
+			snapshot = db.appendAOFRecord(snapshot, key)
+		}
+	}
+	snapshot = appendAOFFrame(snapshot, []byte{replSnapshotEnd})
+
+	feed := &replicaFeed{batches: make(chan []byte, replFeedBacklog), dropped: make(chan struct{})}
+	f := &db.feeds
+	f.mu.Lock()
+	if f.feeds == nil {
+		f.feeds = make(map[*replicaFeed]struct{})
+	}
+	f.feeds[feed] = struct{}{}
+	f.count.Store(int32(len(f.feeds)))
+	f.mu.Unlock()
+	return snapshot, feed
+}
+
+// detachReplica forgets a replica whose connection has ended.
+func (db *DataBase) detachReplica(feed *replicaFeed) {
+	f := &db.feeds
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.feeds, feed)
+	f.count.Store(int32(len(f.feeds)))
+}
+
+// CheckReplicas asks every connected replica to compare its data with the
+// primary's, like the CHECKSYNC command, and returns how many were asked.
+// The primary's Fingerprint is sent down each stream; a replica computes
+// its own once it has applied everything before it, as of the primary's
+// clock, and on a mismatch reports that it is out of sync (see
+// ReplicationLag) and reconnects for a full sync. This catches drift that
+// the stream itself cannot show. Computing the fingerprint walks the whole
+// keyspace under the read lock.
+func (db *DataBase) CheckReplicas() int {
+	db.lock.RLock()         // Writers wait, so the check falls between two of their batches.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+	if db.feeds.count.Load() == 0 {
+		return 0
+	}
+	now := db.clock.Now()
+	body := binary.BigEndian.AppendUint64([]byte{replCheck}, db.fingerprintAt(now))
+	body = binary.AppendVarint(body, now.UnixNano())
+	db.feeds.send(appendAOFFrame(nil, body))
+	return int(db.feeds.count.Load())
+}
+
+// replicaLink is a replica's connection to its primary.
+type replicaLink struct {
+	addr         string
+	stop         chan struct{} // Closed to end the link.
+	done         chan struct{} // Closed once the link has stopped.
+	queued       atomic.Int64  // Records received but not yet applied.
+	synced       atomic.Bool   // The full sync finished and no check has failed since.
+	ownsReadOnly bool          // The link made the database read-only.
+}
+
+// replItem is one entry of the replication stream after the snapshot: a
+// change to apply or a consistency check.
+type replItem struct {
+	rec         aofRecord
+	check       bool
+	fingerprint uint64    // The primary's fingerprint, for a check.
+	at          time.Time // The primary's clock when it took it.
+}
+
+// ReplicaOf makes the database a replica of the primary serving RESP at
+// addr, like Redis REPLICAOF. The replica connects, receives a full copy of
+// the primary's data, which replaces its own, and from then on applies the
+// primary's changes as they are made, while reads are served locally. The
+// database is read-only meanwhile, so local writes fail with ErrReadOnly.
+// If the connection drops, or a CheckReplicas check finds the data has
+// drifted, the replica reconnects and performs a new full sync. The primary
+// must not require a password.
+//
+// Calling ReplicaOf again switches to another primary, and an empty addr
+// stops replicating and makes the database writable again, like REPLICAOF
+// NO ONE, keeping the data it has. It returns an error, leaving the database
+// a primary, if the first connection fails.
+func (db *DataBase) ReplicaOf(addr string) error {
+	db.replMu.Lock() // One change of primary at a time.
+	defer db.replMu.Unlock()
+
+	db.lock.Lock()
+	old := db.replica
+	db.replica = nil
+	db.lock.Unlock()
+	if old != nil {
+		close(old.stop)
+		<-old.done
+	}
+	owns := old != nil && old.ownsReadOnly
+	if addr == "" {
+		if owns {
+			db.lock.Lock()
+			db.readOnly = false
+			db.lock.Unlock()
+		}
+		return nil
+	}
+
+	conn, err := db.dialPrimary(addr)
+	if err != nil {
+		if owns {
+			db.lock.Lock()
+			db.readOnly = false // Back to being a primary.
+			db.lock.Unlock()
+		}
+		return err
+	}
+	link := &replicaLink{addr: addr, stop: make(chan struct{}), done: make(chan struct{})}
+	db.lock.Lock()
+	link.ownsReadOnly = owns || !db.readOnly
+	db.readOnly = true
+	db.replica = link
+	db.lock.Unlock()
+	db.logger.Info("replicating", "primary", addr)
+	db.spawn(func() { db.runReplica(link, conn) })
+	return nil
+}
+
+// ReplicationLag reports, on a replica, how many changes it has received
+// from its primary but not yet applied, and whether it is in sync: connected,
+// with its full sync complete and no failed check since. A database that is
+// not a replica reports 0 and false.
+func (db *DataBase) ReplicationLag() (behind int, inSync bool) {
+	db.lock.RLock()
+	link := db.replica
+	db.lock.RUnlock()
+	if link == nil {
+		return 0, false
+	}
+	return int(link.queued.Load()), link.synced.Load()
+}
+
+// runReplica keeps the link to the primary up until ReplicaOf or Close
+// stops it, reconnecting after failures.
+func (db *DataBase) runReplica(link *replicaLink, conn net.Conn) {
+	defer close(link.done)
+	for {
+		if conn != nil {
+			err := db.replicate(link, conn)
+			link.synced.Store(false)
+			select {
+			case <-link.stop:
+				return
+			case <-db.stop:
+				return
+			default:
+			}
+			db.logger.Warn("replication link lost", "primary", link.addr, "err", err)
+			if errors.Is(err, errReplicaDiverged) {
+				conn, err = db.dialPrimary(link.addr) // Resync at once.
+				if err == nil {
+					continue
+				}
+			}
+		}
+		select {
+		case <-link.stop:
+			return
+		case <-db.stop:
+			return
+		case <-time.After(replRetry):
+		}
+		var err error
+		if conn, err = db.dialPrimary(link.addr); err != nil {
+			db.logger.Debug("cannot reach primary", "primary", link.addr, "err", err)
+			conn = nil
+		}
+	}
+}
+
+// dialPrimary connects to the primary at addr, over TLS if
+// WithReplicationTLS was given.
+func (db *DataBase) dialPrimary(addr string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: replDialTimeout}
+	if db.replTLS != nil {
+		return tls.DialWithDialer(dialer, "tcp", addr, db.replTLS) // Completes the handshake within the timeout.
+	}
+	return dialer.Dial("tcp", addr)
+}
+
+// WithReplicationTLS makes ReplicaOf connect to the primary over TLS with
+// cfg, for a primary whose ServerConfig.TLS is set. Unless cfg names a
+// ServerName, the primary's certificate is verified against the host of
+// the address given to ReplicaOf. For a primary that verifies client
+// certificates, put the replica's certificate in cfg.Certificates.
+func WithReplicationTLS(cfg *tls.Config) Option {
+	return func(db *DataBase) {
+		db.replTLS = cfg
+	}
+}
+
+// replicate runs one connection to the primary: it requests a full sync,
+// loads the snapshot and then applies the stream until the connection ends,
+// the link is stopped or the data is found to have diverged.
+func (db *DataBase) replicate(link *replicaLink, conn net.Conn) error {
+	quit := make(chan struct{})
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		select {
+		case <-quit:
+		case <-link.stop:
+		case <-db.stop:
+		}
+		conn.Close() // Unblocks the reads.
+	}()
+	defer func() {
+		close(quit)
+		<-closed
+	}()
+
+	if _, err := conn.Write([]byte("*1\r\n$4\r\nSYNC\r\n")); err != nil {
+		return err
+	}
+	r := bufio.NewReader(conn)
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if line != replFullResync {
+		return fmt.Errorf("replication: primary replied %q", strings.TrimSpace(line))
+	}
+
+	var snapshot []aofRecord
+	for {
+		body, err := readAOFFrame(r)
+		if err != nil {
+			return err
+		}
+		if body[0] == replSnapshotEnd {
+			break
+		}
+		rec, err := parseAOFRecord(body)
+		if err != nil {
+			return err
+		}
+		snapshot = append(snapshot, rec)
+	}
+	db.loadFullSync(snapshot)
+	link.synced.Store(true)
+	db.logger.Info("replica synchronized", "primary", link.addr, "keys", len(snapshot))
+
+	items := make(chan replItem, replQueue)
+	readErr := make(chan error, 1)
+	go func() {
+		defer close(items)
+		for {
+			item, err := readReplItem(r)
+			if err != nil {
+				readErr <- err
+				return
+			}
+			link.queued.Add(1)
+			select {
+			case items <- item:
+			case <-quit:
+				return
+			}
+		}
+	}()
+	defer link.queued.Store(0) // Whatever is still queued is dropped with the connection.
+	return db.applyStream(items, readErr, link)
+}
+
+// readReplItem reads the next change or check from the stream.
+func readReplItem(r *bufio.Reader) (replItem, error) {
+	body, err := readAOFFrame(r)
+	if err != nil {
+		return replItem{}, err
+	}
+	if body[0] == replCheck {
+		d := &archiveDecoder{b: body[1:]}
+		fp := d.bytes(8)
+		at := d.varint()
+		if d.err != nil {
+			return replItem{}, errAOFCorrupt
+		}
+		return replItem{check: true, fingerprint: binary.BigEndian.Uint64(fp), at: time.Unix(0, at)}, nil
+	}
+	rec, err := parseAOFRecord(body)
+	return replItem{rec: rec}, err
+}
+
+// applyStream applies the changes read from the primary, as many at a time
+// as have arrived, until the stream ends or a check fails.
+func (db *DataBase) applyStream(items <-chan replItem, readErr <-chan error, link *replicaLink) error {
+	var batch []aofRecord
+	for item := range items {
+		batch = batch[:0]
+		for !item.check {
+			batch = append(batch, item.rec)
+			if len(batch) == aofBatch || len(items) == 0 {
+				break
+			}
+			item = <-items // Only this goroutine receives, so it will not block.
+		}
+		db.replayAOF(batch)
+		link.queued.Add(-int64(len(batch)))
+		if item.check {
+			link.queued.Add(-1)
+			db.lock.RLock()
+			fp := db.fingerprintAt(item.at)
+			db.lock.RUnlock()
+			if fp != item.fingerprint {
+				return errReplicaDiverged
+			}
+			db.logger.Debug("replica in sync", "primary", link.addr)
+		}
+	}
+	return <-readErr
+}
+
+// loadFullSync replaces the whole keyspace with a primary's snapshot under
+// one write lock.
+func (db *DataBase) loadFullSync(records []aofRecord) {
+	db.lock.Lock()    // Acquire a write lock to replace the data.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	keys := make([]string, 0, db.data.len())
+	for key := range db.data.all() {
+		keys = append(keys, key) // Collect first: removal must not race the iteration.
+	}
+	for _, key := range keys {
+		db.removeKey(key)
+	}
+	now := db.clock.Now()
+	for _, rec := range records {
+		if rec.deadline.IsZero() || rec.deadline.After(now) {
+			db.place(rec.key, rec.value, true, rec.deadline, !rec.deadline.IsZero(), rec.fields)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckSyncDetectsDroppedCommand(t *testing.T) {
+	primary := NewDataBase()
+	defer primary.Close()
+	addr := startServer(t, primary, ServerConfig{})
+	var log lockedBuffer
+	replica := NewDataBase(WithLogger(slog.New(slog.NewTextHandler(&log, &slog.HandlerOptions{Level: slog.LevelDebug}))))
+	defer replica.Close()
+	if err := replica.ReplicaOf(addr); err != nil {
+		t.Fatal(err)
+	}
+	defer replica.ReplicaOf("")
+
+	primary.Set("a", "1")
+	primary.Set("b", "2")
+	waitFor(t, "the replica to apply both writes", func() bool {
+		_, inSync := replica.ReplicationLag()
+		return inSync && replica.Exists("a", "b") == 2
+	})
+	c := dial(t, addr)
+	if n := c.do(t, "CHECKSYNC"); n != int64(1) {
+		t.Fatalf("CHECKSYNC = %v, want 1 replica asked", n)
+	}
+	waitFor(t, "the replica to confirm it is in sync", func() bool {
+		return strings.Contains(log.String(), "replica in sync")
+	})
+
+	replica.lock.Lock() // Lose b on the replica, as if its Set never arrived.
+	replica.removeKey("b")
+	replica.lock.Unlock()
+	if replica.Fingerprint() == primary.Fingerprint() {
+		t.Fatal("the dropped key left the fingerprints equal")
+	}
+	if _, inSync := replica.ReplicationLag(); !inSync {
+		t.Fatal("the replica noticed the drift before any check")
+	}
+
+	if n := c.do(t, "CHECKSYNC"); n != int64(1) {
+		t.Fatalf("CHECKSYNC = %v, want 1 replica asked", n)
+	}
+	waitFor(t, "the replica to report the divergence", func() bool {
+		return strings.Contains(log.String(), "diverged")
+	})
+	waitFor(t, "the full resync to restore b", func() bool {
+		_, inSync := replica.ReplicationLag()
+		return inSync && replica.Exists("b") == 1
+	})
+	if replica.Fingerprint() != primary.Fingerprint() {
+		t.Error("the fingerprints still differ after the resync")
+	}
+}
+
+func TestReplicaOfFullSyncThenStream(t *testing.T) {
+	primary := NewDataBase()
+	defer primary.Close()
+	primary.Set("before", "1")
+	primary.SetWithTTL("ttl", "v", time.Hour)
+	primary.HSet("hash", "f", "v")
+	addr := startServer(t, primary, ServerConfig{})
+
+	replica := NewDataBase()
+	defer replica.Close()
+	replica.Set("own", "replaced by the full sync")
+	if err := replica.ReplicaOf(addr); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the full sync", func() bool {
+		_, inSync := replica.ReplicationLag()
+		return inSync
+	})
+	if keys := replica.Keys("*"); !slices.Equal(slices.Sorted(slices.Values(keys)), []string{"before", "hash", "ttl"}) {
+		t.Errorf("replica keys after the full sync = %v, want the primary's", keys)
+	}
+	if ttl := replica.TTL("ttl"); ttl <= 0 || ttl > time.Hour {
+		t.Errorf("replica TTL(ttl) = %v, want up to an hour", ttl)
+	}
+	if err := replica.Set("local", "v"); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Set on a replica: %v, want ErrReadOnly", err)
+	}
+
+	primary.Set("after", "2")
+	primary.Delete("before")
+	primary.HSet("hash", "g", "w")
+	waitFor(t, "the replica to apply the stream", func() bool {
+		g, _, _ := replica.HGet("hash", "g")
+		return replica.Exists("after") == 1 && replica.Exists("before") == 0 && g == "w"
+	})
+	if value, _ := replica.Get("after"); value != "2" {
+		t.Errorf("replica after = %v, want 2", value)
+	}
+	if replica.Fingerprint() != primary.Fingerprint() {
+		t.Error("the replica's fingerprint differs from the primary's")
+	}
+
+	if err := replica.ReplicaOf(""); err != nil {
+		t.Fatal(err)
+	}
+	if _, inSync := replica.ReplicationLag(); inSync {
+		t.Error("ReplicaOf(\"\") left the database a replica")
+	}
+	if err := replica.Set("local", "v"); err != nil {
+		t.Errorf("Set after ReplicaOf(\"\"): %v, want it writable again", err)
+	}
+	primary.Set("unseen", "v")
+	if value, _ := replica.Get("after"); value != "2" || replica.Exists("unseen") != 0 {
+		t.Error("the former replica lost its data or kept following the primary")
+	}
+}
+
+func TestReplicaOfUnreachablePrimary(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close() // Nothing listens there now.
+
+	db := NewDataBase()
+	defer db.Close()
+	if err := db.ReplicaOf(addr); err == nil {
+		t.Fatal("ReplicaOf an address nobody serves succeeded")
+	}
+	if err := db.Set("k", "v"); err != nil {
+		t.Errorf("Set after a failed ReplicaOf: %v, want the database still a primary", err)
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// errProtocol is returned for malformed RESP input.
+var errProtocol = errors.New("ERR Protocol error")
+
+// maxBulkLen caps the size of a single bulk string accepted from a client.
+const maxBulkLen = 512 << 20 // 512 MiB, the Redis proto-max-bulk-len default.
+
+// maxInlineLen caps a line: an inline command or a RESP header.
+const maxInlineLen = 64 << 10 // 64 KiB, as in Redis.
+
+// bulkChunk is how much of a bulk string is buffered ahead of the bytes
+// actually arriving, so a client announcing a huge one cannot make the
+// server allocate it up front.
+const bulkChunk = 64 << 10
+
+// respLimits bounds the requests readCommand accepts.
+type respLimits struct {
+	maxArgs int // Most elements in a RESP array.
+	maxBulk int // Longest bulk string.
+}
+
+// Request limits for clients that have authenticated and for those that
+// have not, who get only enough for AUTH and HELLO, as Redis allows them.
+var (
+	authedLimits   = respLimits{maxArgs: 1024 * 1024, maxBulk: maxBulkLen}
+	unauthedLimits = respLimits{maxArgs: 10, maxBulk: 16 << 10}
+)
+
+// simpleString is a reply written as a RESP simple string (+OK).
+type simpleString string
+
+// respMap is a map reply, written as a RESP3 map or, under RESP2, as a flat
+// array. It holds alternating keys and values, so the order is kept.
+type respMap []any
+
+// push is an out-of-band message such as a pub/sub delivery, written as a
+// RESP3 push or, under RESP2, as an array.
+type push []any
+
+// multiReply is several replies to one command, written back to back, as
+// SUBSCRIBE confirms each channel separately.
+type multiReply []any
+
+// nullArray is the null reply of commands that normally return an array,
+// such as an aborted EXEC. RESP2 spells it differently from a null string.
+type nullArray struct{}
+
+// readCommand reads one command from r, either as a RESP array of bulk
+// strings (what client libraries send) or as an inline space-separated line
+// (what people type into telnet), within limits.
+func readCommand(r *bufio.Reader, limits respLimits) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '*' {
+		return strings.Fields(line), nil // Inline command.
+	}
+
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n > limits.maxArgs {
+		return nil, errProtocol
+	}
+	args := make([]string, 0, max(n, 0))
+	for i := 0; i < n; i++ {
+		header, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(header) == 0 || header[0] != '$' {
+			return nil, errProtocol // Only bulk strings are valid in requests.
+		}
+		size, err := strconv.Atoi(header[1:])
+		if err != nil || size < 0 || size > limits.maxBulk {
+			return nil, errProtocol
+		}
+		var buf bytes.Buffer
+		buf.Grow(min(size+2, bulkChunk)) // Payload plus trailing CRLF; the rest grows as it arrives.
+		if _, err := io.CopyN(&buf, r, int64(size)+2); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		payload := buf.Bytes()
+		if payload[size] != '\r' || payload[size+1] != '\n' {
+			return nil, errProtocol
+		}
+		args = append(args, string(payload[:size]))
+	}
+	return args, nil
+}
+
+// readLine reads a CRLF- or LF-terminated line without its terminator,
+// refusing lines longer than maxInlineLen with errProtocol.
+func readLine(r *bufio.Reader) (string, error) {
+	var line []byte
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if len(line)+len(chunk) > maxInlineLen+2 { // Room for the CRLF.
+			return "", errProtocol
+		}
+		line = append(line, chunk...)
+		if err == nil {
+			break
+		}
+		if err != bufio.ErrBufferFull {
+			return "", err
+		}
+	}
+	line = bytes.TrimSuffix(line, []byte("\n"))
+	return string(bytes.TrimSuffix(line, []byte("\r"))), nil
+}
+
+// respWriter encodes replies onto a buffered connection writer.
+type respWriter struct {
+	w     *bufio.Writer
+	proto int // Protocol version, 2 or 3, as negotiated by HELLO.
+}
+
+// writeReply encodes a Go value as the matching RESP type:
+// nil as a null, simpleString as a status reply, error as an error reply,
+// integers as RESP integers, float64 as a double, strings and byte slices as
+// bulk strings, slices as arrays, respMap as a map and push as a push. The
+// types RESP2 lacks fall back to their RESP2 forms: null bulk strings, bulk
+// strings for doubles and arrays for maps and pushes. Any other value is
+// written as its fmt form.
+func (rw respWriter) writeReply(v any) {
+	switch v := v.(type) {
+	case nil:
+		if rw.proto == 3 {
+			rw.w.WriteString("_\r\n")
+		} else {
+			rw.w.WriteString("$-1\r\n")
+		}
+	case nullArray:
+		if rw.proto == 3 {
+			rw.w.WriteString("_\r\n")
+		} else {
+			rw.w.WriteString("*-1\r\n")
+		}
+	case simpleString:
+		rw.w.WriteString("+" + string(v) + "\r\n")
+	case error:
+		rw.w.WriteString("-" + errorReply(v) + "\r\n")
+	case int:
+		rw.writeInt(int64(v))
+	case int64:
+		rw.writeInt(v)
+	case bool:
+		if v {
+			rw.writeInt(1) // Redis reports booleans as 1/0.
+		} else {
+			rw.writeInt(0)
+		}
+	case string:
+		rw.writeBulk(v)
+	case []byte:
+		rw.writeBulk(string(v))
+	case []string:
+		fmt.Fprintf(rw.w, "*%d\r\n", len(v))
+		for _, s := range v {
+			rw.writeBulk(s)
+		}
+	case float64:
+		s := strconv.FormatFloat(v, 'g', -1, 64)
+		if rw.proto == 3 {
+			rw.w.WriteString("," + strings.ToLower(strings.TrimPrefix(s, "+")) + "\r\n") // RESP3 spells +Inf as inf.
+		} else {
+			rw.writeBulk(s)
+		}
+	case []any:
+		rw.writeAggregate('*', len(v), v)
+	case respMap:
+		if rw.proto == 3 {
+			rw.writeAggregate('%', len(v)/2, v)
+		} else {
+			rw.writeAggregate('*', len(v), v)
+		}
+	case push:
+		if rw.proto == 3 {
+			rw.writeAggregate('>', len(v), v)
+		} else {
+			rw.writeAggregate('*', len(v), v)
+		}
+	case multiReply:
+		for _, item := range v {
+			rw.writeReply(item)
+		}
+	default:
+		rw.writeBulk(fmt.Sprint(v))
+	}
+}
+
+// writeAggregate writes an aggregate header announcing n entries, followed
+// by items.
+func (rw respWriter) writeAggregate(kind byte, n int, items []any) {
+	rw.w.WriteByte(kind)
+	rw.w.WriteString(strconv.Itoa(n) + "\r\n")
+	for _, item := range items {
+		rw.writeReply(item)
+	}
+}
+
+// writeInt writes a RESP integer.
+func (rw respWriter) writeInt(n int64) {
+	rw.w.WriteString(":" + strconv.FormatInt(n, 10) + "\r\n")
+}
+
+// writeBulk writes a RESP bulk string.
+func (rw respWriter) writeBulk(s string) {
+	rw.w.WriteString("$" + strconv.Itoa(len(s)) + "\r\n" + s + "\r\n")
+}
+
+// errorReply formats an error for the wire. Errors that already start with
+// an upper-case code (WRONGTYPE, NOAUTH, ...) are sent as is; others get
+// the generic ERR prefix. Newlines are flattened to keep the reply valid.
+func errorReply(err error) string {
+	msg := strings.NewReplacer("\r", " ", "\n", " ").Replace(err.Error())
+	code, _, _ := strings.Cut(msg, " ")
+	if code != "" && code == strings.ToUpper(code) && strings.ToLower(code) != code {
+		return msg
+	}
+	return "ERR " + msg
+}
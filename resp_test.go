@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestReadCommandLimits(t *testing.T) {
+	small := respLimits{maxArgs: 3, maxBulk: 5}
+	for _, tc := range []struct {
+		name, input string
+		limits      respLimits
+		want        []string
+		err         error
+	}{
+		{"inline", "SET k v\r\n", small, []string{"SET", "k", "v"}, nil},
+		{"array", "*2\r\n$3\r\nGET\r\n$1\r\nk\r\n", small, []string{"GET", "k"}, nil},
+		{"bulk at the limit", "*1\r\n$5\r\nhello\r\n", small, []string{"hello"}, nil},
+		{"bulk over the limit", "*1\r\n$6\r\nhello!\r\n", small, nil, errProtocol},
+		{"too many elements", "*4\r\n", small, nil, errProtocol},
+		{"inline line too long", strings.Repeat("a", maxInlineLen+1) + "\r\n", authedLimits, nil, errProtocol},
+		{"header line too long", "*1\r\n$" + strings.Repeat("1", maxInlineLen) + "\r\n", authedLimits, nil, errProtocol},
+		{"bulk cut short", "*1\r\n$100000000\r\nabc", authedLimits, nil, io.ErrUnexpectedEOF},
+		{"missing CRLF", "*1\r\n$2\r\nabcd", small, nil, errProtocol},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			args, err := readCommand(bufio.NewReader(strings.NewReader(tc.input)), tc.limits)
+			if !errors.Is(err, tc.err) || !slices.Equal(args, tc.want) {
+				t.Errorf("readCommand = %q, %v; want %q, %v", args, err, tc.want, tc.err)
+			}
+		})
+	}
+}
+
+func TestReadCommandLongLine(t *testing.T) {
+	arg := strings.Repeat("a", 1000)
+	r := bufio.NewReaderSize(strings.NewReader("ECHO "+arg+"\r\n"), 16) // The line spans many buffers.
+	if args, err := readCommand(r, authedLimits); err != nil || !slices.Equal(args, []string{"ECHO", arg}) {
+		t.Errorf("readCommand of a line longer than the buffer = %d args, %v; want ECHO and its argument", len(args), err)
+	}
+}
+
+func TestServerLimitsUnauthenticatedRequests(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	addr := startServer(t, db, ServerConfig{Password: "s3cret"})
+	big := strings.Repeat("x", 32<<10)
+
+	c := dial(t, addr)
+	if reply, ok := c.do(t, "AUTH", big).(error); !ok || !strings.Contains(reply.Error(), "Protocol error") {
+		t.Errorf("a 32 KiB AUTH before authenticating = %v, want a protocol error", reply)
+	}
+
+	c = dial(t, addr)
+	if reply := c.do(t, "AUTH", "s3cret"); reply != "OK" {
+		t.Fatalf("AUTH = %v, want OK", reply)
+	}
+	if reply := c.do(t, "SET", "k", big); reply != "OK" {
+		t.Errorf("a 32 KiB SET after AUTH = %v, want OK", reply)
+	}
+}
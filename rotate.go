@@ -0,0 +1,58 @@
+package main
+
+// SetVersioned stores value at key like Set, but keeps the value it
+// replaces, so that during a secret rotation consumers can finish with the
+// previous secret while new ones pick up the current one. keep is how many
+// versions to retain, counting the new one; older versions are dropped and a
+// keep below 1 counts as 1. Writing key with any other method, or deleting
+// it, replaces or removes the current version without keeping it, and
+// previous versions are not saved in snapshots. It returns the errors Set
+// does.
+func (db *DataBase) SetVersioned(key string, value any, keep int) error {
+	db.lock.Lock()    // One lock for the rotation and the write.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	if db.readOnly {
+		return ErrReadOnly
+	}
+	db.expireIfNeeded(key)
+	current, exists := db.data.get(key)
+	prior := db.priorVersions[key] // Removed with the key if it just expired.
+	if err := db.setChecked(key, value); err != nil {
+		return err
+	}
+	if exists {
+		prior = append([]any{current}, prior...) // Newest first.
+	}
+	if len(prior) > keep-1 {
+		prior = prior[:max(keep-1, 0)]
+	}
+	if len(prior) == 0 {
+		delete(db.priorVersions, key)
+		return nil
+	}
+	if db.priorVersions == nil {
+		db.priorVersions = make(map[string][]any)
+	}
+	db.priorVersions[key] = prior
+	return nil
+}
+
+// GetVersion returns the current value of key for back 0, or the value it
+// had back writes ago through SetVersioned, reporting false if key does not
+// exist or that version is no longer kept.
+func (db *DataBase) GetVersion(key string, back int) (any, bool) {
+	db.lock.RLock()         // Acquire a read lock.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+	current, exists := db.lookup(key)
+	if !exists || back < 0 {
+		return nil, false
+	}
+	if back == 0 {
+		return current, true
+	}
+	prior := db.priorVersions[key]
+	if back > len(prior) {
+		return nil, false
+	}
+	return prior[back-1], true
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSetVersionedRotation(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	check := func(back int, want any, ok bool) {
+		t.Helper()
+		if got, found := db.GetVersion("secret", back); found != ok || got != want {
+			t.Errorf("GetVersion(secret, %d) = %v, %v; want %v, %v", back, got, found, want, ok)
+		}
+	}
+	db.SetVersioned("secret", "s1", 2)
+	check(0, "s1", true)
+	check(1, nil, false) // Nothing rotated out yet.
+
+	db.SetVersioned("secret", "s2", 2)
+	check(0, "s2", true)
+	check(1, "s1", true) // Consumers can finish with the previous secret.
+	if value, _ := db.Get("secret"); value != "s2" {
+		t.Errorf("Get = %v, want the current s2", value)
+	}
+
+	db.SetVersioned("secret", "s3", 2)
+	check(0, "s3", true)
+	check(1, "s2", true)
+	check(2, nil, false) // Beyond keep.
+
+	db.SetVersioned("secret", "s4", 3)
+	db.SetVersioned("secret", "s5", 3)
+	check(1, "s4", true)
+	check(2, "s3", true)
+	check(3, nil, false)
+	check(-1, nil, false)
+
+	db.SetPrefixPolicy("secret", Policy{Types: []string{"string"}})
+	var policy *PolicyError
+	if err := db.SetVersioned("secret", 42, 3); !errors.As(err, &policy) {
+		t.Fatalf("SetVersioned of a refused value: %v, want a *PolicyError", err)
+	}
+	check(0, "s5", true) // A refused write rotates nothing.
+	check(1, "s4", true)
+
+	db.Delete("secret")
+	check(0, nil, false)
+	db.SetVersioned("secret", "fresh", 3)
+	check(1, nil, false) // Deleting the key dropped its old versions.
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrSaveInProgress is returned by Persist when another save to the same
+// file is running and the database was created with WithFailFastSaves.
+var ErrSaveInProgress = errors.New("persist: save already in progress")
+
+// saveLock returns the mutex serializing saves to fileName.
+func (db *DataBase) saveLock(fileName string) *sync.Mutex {
+	db.savesMu.Lock()
+	defer db.savesMu.Unlock()
+	if db.saves == nil {
+		db.saves = make(map[string]*sync.Mutex) // Created lazily on first save.
+	}
+	mu, ok := db.saves[fileName]
+	if !ok {
+		mu = &sync.Mutex{}
+		db.saves[fileName] = mu
+	}
+	return mu
+}
+
+// acquireSave claims the right to write fileName, so overlapping Persist
+// calls on one file serialize instead of interleaving their writes. It
+// waits for a running save unless fail-fast saves are enabled, in which case
+// it returns ErrSaveInProgress. The returned func releases the claim.
+func (db *DataBase) acquireSave(fileName string) (func(), error) {
+	mu := db.saveLock(fileName)
+	if db.failFastSaves {
+		if !mu.TryLock() {
+			return nil, ErrSaveInProgress
+		}
+	} else {
+		mu.Lock() // Wait for the running save to finish.
+	}
+	return mu.Unlock, nil
+}
+
+// WithFailFastSaves makes a Persist that overlaps another save to the same
+// file return ErrSaveInProgress immediately instead of waiting its turn.
+func WithFailFastSaves() Option {
+	return func(db *DataBase) {
+		db.failFastSaves = true
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestConcurrentPersistSameFile(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	for i := range 5000 {
+		db.Set(fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i))
+	}
+	fileName := filepath.Join(t.TempDir(), "database.gob")
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = db.Persist(fileName)
+		}()
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("Persist %d: %v", i, err)
+		}
+	}
+
+	loaded := NewDataBase()
+	defer loaded.Close()
+	if err := loaded.Load(fileName); err != nil {
+		t.Fatalf("Load of the file both saves wrote: %v", err)
+	}
+	if got := len(loaded.Keys("*")); got != 5000 {
+		t.Errorf("loaded %d keys, want 5000", got)
+	}
+}
+
+func TestFailFastSaves(t *testing.T) {
+	db := NewDataBase(WithFailFastSaves())
+	defer db.Close()
+	dir := t.TempDir()
+	fileName := filepath.Join(dir, "database.gob")
+	release, err := db.acquireSave(fileName) // A save of the file is running.
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Persist(fileName); !errors.Is(err, ErrSaveInProgress) {
+		t.Errorf("overlapping Persist: %v, want ErrSaveInProgress", err)
+	}
+	if err := db.Persist(filepath.Join(dir, "other.gob")); err != nil {
+		t.Errorf("Persist of another file: %v", err)
+	}
+	release()
+	if err := db.Persist(fileName); err != nil {
+		t.Errorf("Persist once the save finished: %v", err)
+	}
+}
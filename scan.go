@@ -0,0 +1,134 @@
+package main
+
+import (
+	"hash/fnv"
+	"sort"
+)
+
+// defaultScanCount is the page size used when a scan asks for none.
+const defaultScanCount = 10
+
+// scanHash places a name on the scan cursor's number line.
+func scanHash(name string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return h.Sum64()
+}
+
+// scanPage picks the next page of names for a cursor-based scan. Names are
+// visited in order of their hash, and the cursor is the hash to resume from,
+// so unlike an offset it stays meaningful while the collection changes: a
+// name present for the whole scan is returned, and names added or removed
+// meanwhile may or may not be. Names with equal hashes are never split
+// across pages. It returns the page in visiting order and the next cursor,
+// which is 0 once the scan is complete. match filters the page afterwards,
+// so a page may come back empty even though the scan goes on, as in Redis.
+func scanPage(names func(yield func(string) bool), cursor uint64, count int, match string) ([]string, uint64) {
+	if count <= 0 {
+		count = defaultScanCount
+	}
+	type entry struct {
+		hash uint64
+		name string
+	}
+	var pending []entry
+	for name := range names {
+		if h := scanHash(name); h >= cursor {
+			pending = append(pending, entry{h, name})
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		if pending[i].hash != pending[j].hash {
+			return pending[i].hash < pending[j].hash
+		}
+		return pending[i].name < pending[j].name
+	})
+	n := min(count, len(pending))
+	for n < len(pending) && pending[n].hash == pending[n-1].hash {
+		n++ // Keep colliding names together.
+	}
+
+	var next uint64 // Zero ends the scan.
+	if n < len(pending) {
+		next = pending[n-1].hash + 1
+	}
+	page := make([]string, 0, n)
+	for _, e := range pending[:n] {
+		if match == "" || matchGlob(match, e.name) {
+			page = append(page, e.name)
+		}
+	}
+	return page, next
+}
+
+// Scan pages through the live keys, like Redis SCAN, with the cursor, match
+// and count rules of HScan. The read lock is held only for one page at a
+// time, so writers run between calls, and keys written meanwhile may or may
+// not be returned. Each page still hashes every key, so count trades the
+// number of calls against the work per call.
+func (db *DataBase) Scan(cursor uint64, match string, count int) (keys []string, next uint64) {
+	db.lock.RLock()         // Acquire a read lock.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+
+	now := db.clock.Now()
+	live := func(yield func(string) bool) {
+		for key := range db.data.rawAll() { // Only keys are needed, not decoded values.
+			if !db.isExpired(key, now) && !yield(key) {
+				return
+			}
+		}
+	}
+	return scanPage(live, cursor, count, match)
+}
+
+// HScan pages through the fields of the hash at key, like Redis HSCAN.
+// Start with cursor 0 and pass each returned next cursor to the following
+// call until it comes back 0. Each call visits about count fields (10 if
+// count is not positive) and returns those matching the glob pattern match
+// (all of them if match is empty) with their values. The hash may change
+// between calls: fields present for the whole scan are returned, others may
+// or may not be. A missing key is an empty hash.
+func (db *DataBase) HScan(key string, cursor uint64, match string, count int) (fields []string, values []any, next uint64, err error) {
+	db.lock.RLock()         // Acquire a read lock.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+
+	hash, err := db.hashAt(key)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	now := db.clock.Now()
+	live := func(yield func(string) bool) {
+		for field := range hash {
+			if !db.fieldExpired(key, field, now) && !yield(field) {
+				return
+			}
+		}
+	}
+	fields, next = scanPage(live, cursor, count, match)
+	values = make([]any, len(fields))
+	for i, field := range fields {
+		values[i] = hash[field]
+	}
+	return fields, values, next, nil
+}
+
+// SScan pages through the members of the set at key, like Redis SSCAN, with
+// the cursor, match and count rules of HScan.
+func (db *DataBase) SScan(key string, cursor uint64, match string, count int) (members []string, next uint64, err error) {
+	db.lock.RLock()         // Acquire a read lock.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+
+	set, err := db.setAt(key)
+	if err != nil {
+		return nil, 0, err
+	}
+	all := func(yield func(string) bool) {
+		for m := range set {
+			if !yield(m) {
+				return
+			}
+		}
+	}
+	members, next = scanPage(all, cursor, count, match)
+	return members, next, nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHScanMatchPages(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	for i := range 2000 {
+		db.HSet("big", "user:"+strconv.Itoa(i), i)
+		db.HSet("big", "item:"+strconv.Itoa(i), i)
+	}
+
+	seen := map[string]int{}
+	calls := 0
+	for cursor := uint64(0); ; {
+		fields, values, next, err := db.HScan("big", cursor, "user:*", 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, field := range fields {
+			n, err := strconv.Atoi(strings.TrimPrefix(field, "user:"))
+			if err != nil || values[i] != n {
+				t.Fatalf("HScan returned %s = %v, want user:* fields with their values", field, values[i])
+			}
+			seen[field]++
+		}
+		if calls++; calls == 10 {
+			db.HSet("big", "added", 0) // Writes between pages are tolerated.
+			db.HDel("big", "item:0")
+		}
+		if cursor = next; cursor == 0 {
+			break
+		}
+	}
+	for i := range 2000 {
+		if n := seen["user:"+strconv.Itoa(i)]; n != 1 {
+			t.Fatalf("user:%d returned %d times, want once", i, n)
+		}
+	}
+	if calls < 20 {
+		t.Errorf("the scan took %d calls, want pages of about 100 of 4000 fields", calls)
+	}
+}
+
+func TestSScan(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	for i := range 500 {
+		db.SAdd("tags", "go"+strconv.Itoa(i), "rust"+strconv.Itoa(i))
+	}
+	var got []string
+	for cursor := uint64(0); ; {
+		members, next, err := db.SScan("tags", cursor, "go*", 50)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, members...)
+		if cursor = next; cursor == 0 {
+			break
+		}
+	}
+	slices.Sort(got)
+	if len(got) != 500 || len(slices.Compact(got)) != 500 {
+		t.Errorf("SScan returned %d go* members, want each of 500 once", len(got))
+	}
+
+	if members, next, err := db.SScan("missing", 0, "", 10); err != nil || len(members) != 0 || next != 0 {
+		t.Errorf("SScan of a missing key = %v, %d, %v; want an empty, finished scan", members, next, err)
+	}
+	db.Set("str", "x")
+	if _, _, err := db.SScan("str", 0, "", 10); !errors.Is(err, ErrWrongType) {
+		t.Errorf("SScan of a string: %v, want ErrWrongType", err)
+	}
+	if _, _, _, err := db.HScan("tags", 0, "", 10); !errors.Is(err, ErrWrongType) {
+		t.Errorf("HScan of a set: %v, want ErrWrongType", err)
+	}
+}
+
+func TestScan(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1_000_000, 0))
+	db := NewDataBase(WithClock(clock))
+	defer db.Close()
+	for i := range 1000 {
+		db.Set("user:"+strconv.Itoa(i), i)
+		db.Set("item:"+strconv.Itoa(i), i)
+	}
+	db.SetWithTTL("user:gone", 1, time.Second)
+	clock.Advance(2 * time.Second) // Expired keys are never returned.
+
+	seen := map[string]int{}
+	calls := 0
+	for cursor := uint64(0); ; {
+		keys, next := db.Scan(cursor, "user:*", 50)
+		for _, key := range keys {
+			if !strings.HasPrefix(key, "user:") {
+				t.Fatalf("Scan returned %s, want only user:* keys", key)
+			}
+			seen[key]++
+		}
+		if calls++; calls == 5 {
+			db.Set("user:added", 0) // Writes between pages are tolerated.
+			db.Delete("item:0")
+		}
+		if cursor = next; cursor == 0 {
+			break
+		}
+	}
+	for i := range 1000 {
+		if n := seen["user:"+strconv.Itoa(i)]; n != 1 {
+			t.Fatalf("user:%d returned %d times, want once", i, n)
+		}
+	}
+	if seen["user:gone"] != 0 {
+		t.Error("Scan returned an expired key")
+	}
+	if calls < 30 {
+		t.Errorf("the scan took %d calls, want pages of about 50 of 2000 keys", calls)
+	}
+
+	var all []string
+	for cursor := uint64(0); ; {
+		keys, next := db.Scan(cursor, "", 0) // The default count and no filter.
+		if len(keys) > 2*defaultScanCount {
+			t.Fatalf("a page of %d keys, want about %d", len(keys), defaultScanCount)
+		}
+		all = append(all, keys...)
+		if cursor = next; cursor == 0 {
+			break
+		}
+	}
+	slices.Sort(all)
+	if want := db.Keys("*"); !slices.Equal(all, slices.Sorted(slices.Values(want))) {
+		t.Errorf("a full scan returned %d keys, want the %d of Keys", len(all), len(want))
+	}
+
+	empty := NewDataBase()
+	defer empty.Close()
+	if keys, next := empty.Scan(0, "*", 10); len(keys) != 0 || next != 0 {
+		t.Errorf("Scan of an empty database = %v, %d; want nothing and 0", keys, next)
+	}
+}
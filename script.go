@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Script is a named script run by the FCALL command of the RESP server,
+// with the keys and arguments the client passed.
+type Script func(tx *Txn, keys, args []string) (any, error)
+
+// Eval runs script atomically, the Go counterpart of a Redis Lua script: it
+// holds the write lock for the whole call, so the script's reads and writes
+// through tx form one step that no other reader or writer can observe half
+// done, and returns what the script returns. As in Redis, a script that
+// fails part way is not rolled back; the writes it made before returning
+// its error stay. The script must not call the database other than through
+// tx, which would deadlock, and should be quick, since it blocks everyone.
+func (db *DataBase) Eval(script func(tx *Txn) (any, error)) (any, error) {
+	db.lock.Lock()    // The script runs alone.
+	defer db.unlock() // Release the lock and run expiry callbacks, even on panic.
+	return script(&Txn{db: db, script: true})
+}
+
+// RegisterScript makes script callable over the RESP server as
+// FCALL name numkeys [key ...] [arg ...], where it runs through Eval.
+// Registering a name again replaces its script.
+func (db *DataBase) RegisterScript(name string, script Script) {
+	db.lock.Lock()         // Acquire a write lock.
+	defer db.lock.Unlock() // Release the lock when the function exits.
+	if db.scripts == nil {
+		db.scripts = make(map[string]Script)
+	}
+	db.scripts[name] = script
+}
+
+// cmdFCall runs a script registered with RegisterScript.
+func cmdFCall(db *DataBase, args []string) any {
+	db.lock.RLock()
+	script, ok := db.scripts[args[0]]
+	db.lock.RUnlock()
+	if !ok {
+		return fmt.Errorf("Function not found")
+	}
+	n, err := strconv.Atoi(args[1])
+	if err != nil || n < 0 {
+		return fmt.Errorf("Bad number of keys provided")
+	}
+	if n > len(args)-2 {
+		return fmt.Errorf("Number of keys can't be greater than number of args")
+	}
+	keys, rest := args[2:2+n], args[2+n:]
+	result, err := db.Eval(func(tx *Txn) (any, error) { return script(tx, keys, rest) })
+	if err != nil {
+		return err
+	}
+	return result
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+// errInsufficient is what the transfer script fails with when the source
+// account cannot cover the amount.
+var errInsufficient = errors.New("insufficient funds")
+
+// transfer moves amount from one account to another through Eval, only if
+// the source holds enough.
+func transfer(db *DataBase, from, to string, amount int64) error {
+	_, err := db.Eval(func(tx *Txn) (any, error) {
+		balance, _ := tx.Get(from)
+		if balance.(int64) < amount {
+			return nil, errInsufficient
+		}
+		tx.IncrBy(from, -amount)
+		return tx.IncrBy(to, amount)
+	})
+	return err
+}
+
+func TestEvalConditionalUpdate(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	db.Set("alice", int64(100))
+	db.Set("bob", int64(0))
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	refused := 0
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 50 {
+				if err := transfer(db, "alice", "bob", 1); errors.Is(err, errInsufficient) {
+					mu.Lock()
+					refused++
+					mu.Unlock()
+				} else if err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	alice, _ := db.Get("alice")
+	bob, _ := db.Get("bob")
+	if alice != int64(0) || bob != int64(100) || refused != 300 {
+		t.Errorf("alice = %v, bob = %v, %d refused; want 0, 100 and 300: a check and its update are one step", alice, bob, refused)
+	}
+
+	if err := transfer(db, "bob", "alice", 101); !errors.Is(err, errInsufficient) {
+		t.Errorf("transfer of too much: %v, want errInsufficient", err)
+	}
+	if bob, _ := db.Get("bob"); bob != int64(100) {
+		t.Errorf("bob = %v after the refused transfer, want 100", bob)
+	}
+
+	db.Set("frozen", "yes")
+	_, err := db.Eval(func(tx *Txn) (any, error) {
+		tx.Set("audit", "attempted")
+		if frozen, _ := tx.Get("frozen"); frozen == "yes" {
+			return nil, errors.New("account frozen")
+		}
+		return nil, nil
+	})
+	if err == nil {
+		t.Fatal("Eval did not return the script's error")
+	}
+	if audit, _ := db.Get("audit"); audit != "attempted" {
+		t.Errorf("audit = %v, want the write made before the error kept, as in Redis", audit)
+	}
+}
@@ -0,0 +1,434 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ServerConfig tunes the RESP server. The zero value means no limits.
+type ServerConfig struct {
+	Addr string // TCP address to listen on, e.g. ":6379".
+
+	// MaxConnections caps concurrently served clients. Connections beyond
+	// the limit receive a busy error reply and are closed. Zero is unlimited.
+	MaxConnections int
+
+	// IdleTimeout closes a connection that sends no command for this long.
+	IdleTimeout time.Duration
+
+	// ReadTimeout bounds how long a client may take to send the rest of a
+	// command once its first byte has arrived, defeating slow-loris clients.
+	ReadTimeout time.Duration
+
+	// Tracer, when set, records a span per command; nil disables tracing
+	// at no cost.
+	Tracer Tracer
+
+	// Password, when set, must be presented with AUTH before any other
+	// command is accepted, like requirepass in Redis. The server keeps only
+	// a hash of it.
+	Password string
+
+	// Users are named users with restricted access, who authenticate with
+	// AUTH username password. See ACLUser.
+	Users []ACLUser
+
+	// TLS, when set, makes the server speak TLS on every connection,
+	// replicas' included. Set ClientAuth to tls.RequireAndVerifyClientCert
+	// and ClientCAs to the accepted authorities for mutual TLS.
+	TLS *tls.Config
+}
+
+// errMaxClients is sent to connections rejected by MaxConnections.
+var errMaxClients = errors.New("ERR max number of clients reached")
+
+// Server serves a DataBase over the Redis Serialization Protocol, so
+// redis-cli and regular Redis client libraries can talk to it. Connections
+// speak RESP2 until they switch to RESP3 with HELLO 3, after which maps,
+// doubles and nulls get their own reply types and pub/sub messages arrive
+// as out-of-band pushes that can interleave with ordinary replies.
+type Server struct {
+	db  *DataBase
+	cfg ServerConfig
+
+	passHash []byte              // SHA-256 of cfg.Password; nil when no password is required.
+	users    map[string]*aclUser // cfg.Users by name.
+
+	mu       sync.Mutex
+	listener net.Listener          // Set by Serve.
+	conns    map[net.Conn]struct{} // Connections being served.
+	closed   bool                  // Set by Close.
+	wg       sync.WaitGroup        // Tracks connection and subscription goroutines.
+
+	dbs *Databases // Set by Databases.NewServer, for SELECT and SWAPDB; nil when serving db alone.
+
+	nextID atomic.Int64 // Last client ID handed out, reported by HELLO.
+	execMu sync.RWMutex // Held for writing by EXEC, for reading by other commands.
+
+	stopped context.Context    // Done once Close or Shutdown is called, ending blocked reads.
+	stop    context.CancelFunc // Cancels stopped.
+}
+
+// NewServer returns a server for db configured by cfg.
+func NewServer(db *DataBase, cfg ServerConfig) *Server {
+	s := &Server{
+		db:    db,
+		cfg:   cfg,
+		conns: make(map[net.Conn]struct{}),
+	}
+	s.stopped, s.stop = context.WithCancel(context.Background())
+	if cfg.Password != "" {
+		sum := sha256.Sum256([]byte(cfg.Password))
+		s.passHash = sum[:]
+		s.cfg.Password = "" // Only the hash is kept.
+	}
+	s.users = compileUsers(cfg.Users)
+	s.cfg.Users = nil // Their passwords too.
+
+	db.attachServer(s) // DataBase.Shutdown shuts it down too.
+	return s
+}
+
+// ListenAndServe listens on cfg.Addr and serves clients until Close is called.
+func (s *Server) ListenAndServe() error {
+	ln, err := net.Listen("tcp", s.cfg.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ln)
+}
+
+// Serve accepts connections on ln, handling each on its own goroutine,
+// wrapping ln in TLS when cfg.TLS is set. It returns nil once Close has
+// been called.
+func (s *Server) Serve(ln net.Listener) error {
+	if s.cfg.TLS != nil {
+		ln = tls.NewListener(ln, s.cfg.TLS)
+	}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		ln.Close()
+		return nil
+	}
+	s.listener = ln
+	s.mu.Unlock()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if s.isClosed() {
+				return nil // Expected after Close.
+			}
+			return err
+		}
+		if !s.track(conn) {
+			s.reject(conn) // Over the connection limit.
+			continue
+		}
+		s.wg.Add(1)
+		go s.serveConn(conn)
+	}
+}
+
+// Addr returns the listener's address, or nil before Serve is running.
+func (s *Server) Addr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
+// Close stops accepting connections, closes the open ones and waits for
+// their goroutines to finish.
+func (s *Server) Close() error {
+	err := s.hangUp()
+	s.wg.Wait()
+	return err
+}
+
+// hangUp stops accepting connections and closes the open ones, without
+// waiting for commands still running on them.
+func (s *Server) hangUp() error {
+	s.db.detachServer(s)
+	s.mu.Lock()
+	s.closed = true
+	s.stop() // Blocked XREADs reply and return.
+	var err error
+	if s.listener != nil {
+		err = s.listener.Close() // Unblocks Accept.
+	}
+	for conn := range s.conns {
+		conn.Close() // Unblocks pending reads.
+	}
+	s.mu.Unlock()
+	return err
+}
+
+// Shutdown stops the server gracefully: it stops accepting connections,
+// lets commands already running finish and send their replies, and closes
+// each connection once it is waiting for its next command, then waits for
+// the connection goroutines. Commands a client has only partly sent are
+// dropped with the connection. If ctx is done before every connection has
+// finished, the rest are closed and ctx's error is returned at once; a
+// command still running then finishes in the background, its reply lost.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.db.detachServer(s)
+	s.mu.Lock()
+	s.closed = true
+	s.stop() // Blocked XREADs reply and return.
+	var err error
+	if s.listener != nil {
+		err = s.listener.Close() // Unblocks Accept.
+	}
+	for conn := range s.conns {
+		conn.SetReadDeadline(time.Now()) // Wakes connections waiting for a command.
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return err
+	case <-ctx.Done():
+		s.hangUp() // Out of time; hang up on whoever is left.
+		return ctx.Err()
+	}
+}
+
+// isClosed reports whether Close has been called.
+func (s *Server) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+// track registers conn unless the connection limit has been reached.
+func (s *Server) track(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cfg.MaxConnections > 0 && len(s.conns) >= s.cfg.MaxConnections {
+		return false
+	}
+	s.conns[conn] = struct{}{}
+	s.db.clients.Add(1) // Reported by Info.
+	return true
+}
+
+// untrack forgets a finished connection.
+func (s *Server) untrack(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conns, conn)
+	s.db.clients.Add(-1)
+}
+
+// reject tells a client the server is full and hangs up.
+func (s *Server) reject(conn net.Conn) {
+	s.db.logger.Warn("connection rejected", "remote", conn.RemoteAddr(), "max_connections", s.cfg.MaxConnections)
+	conn.SetDeadline(time.Now().Add(time.Second)) // Don't let a stuck client, or its TLS handshake, block Accept.
+	fmt.Fprintf(conn, "-%s\r\n", errMaxClients.Error())
+	conn.Close()
+}
+
+// serveConn reads commands from one client and writes back their replies.
+// Commands that arrive together are pipelined: every command already in the
+// read buffer is executed before the accumulated replies are flushed in a
+// single write, and replies always come back in the order of the commands.
+func (s *Server) serveConn(conn net.Conn) {
+	defer s.wg.Done()
+	defer s.untrack(conn)
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	sess := &session{
+		authed: s.passHash == nil,
+		id:     s.nextID.Add(1),
+		db:     s.db,
+		w:      &respWriter{w: bufio.NewWriter(conn), proto: 2}, // RESP2 until HELLO 3.
+	}
+	defer sess.unsubscribeAll() // Stops the forwarders before the connection closes.
+	for {
+		if err := s.awaitCommand(conn, r); err != nil {
+			return // Idle timeout, disconnect or server shutdown.
+		}
+		limits := authedLimits
+		if !sess.authed {
+			limits = unauthedLimits
+		}
+		args, err := readCommand(r, limits)
+		if err != nil {
+			if errors.Is(err, errProtocol) {
+				sess.wmu.Lock()
+				sess.w.writeReply(err) // Tell the client before hanging up.
+				sess.w.w.Flush()
+				sess.wmu.Unlock()
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue // Blank inline line.
+		}
+		if sess.isSync(args) {
+			s.syncReplica(sess, conn, r) // The connection is a replication stream from now on.
+			return
+		}
+		reply := s.handle(sess, args)
+		quit := strings.EqualFold(args[0], "QUIT")
+		sess.wmu.Lock()
+		sess.w.writeReply(reply) // Replies queue up in command order.
+		if r.Buffered() == 0 || quit {
+			err = sess.w.w.Flush() // Otherwise pipelined commands are waiting; answer them first.
+		}
+		sess.startForwarders() // Only once the subscribe confirmation is queued.
+		sess.wmu.Unlock()
+		if err != nil || quit {
+			return
+		}
+	}
+}
+
+// awaitCommand blocks until the next command starts arriving, enforcing the
+// idle timeout, and then arms the read timeout for the rest of the command.
+func (s *Server) awaitCommand(conn net.Conn, r *bufio.Reader) error {
+	if s.cfg.IdleTimeout > 0 {
+		conn.SetReadDeadline(time.Now().Add(s.cfg.IdleTimeout))
+	} else {
+		conn.SetReadDeadline(time.Time{})
+	}
+	if r.Buffered() == 0 && s.isClosed() {
+		return net.ErrClosed // Shutdown; checked after the deadline it may have cut short.
+	}
+	if _, err := r.Peek(1); err != nil {
+		return err
+	}
+	if s.cfg.ReadTimeout > 0 {
+		conn.SetReadDeadline(time.Now().Add(s.cfg.ReadTimeout))
+	} else {
+		conn.SetReadDeadline(time.Time{})
+	}
+	return nil
+}
+
+// session is the per-connection state of a client.
+type session struct {
+	authed bool      // AUTH succeeded, or no password is required.
+	user   *aclUser  // The user AUTH succeeded as; nil for the default user.
+	id     int64     // Client ID, unique per server.
+	name   string    // Set by HELLO SETNAME.
+	db     *DataBase // The database commands run against (see SELECT).
+
+	w   *respWriter // The connection's reply writer.
+	wmu sync.Mutex  // Serializes replies with pushed pub/sub messages.
+
+	subs    map[string]func() // Subscribed channels and their cancel funcs.
+	pending []func()          // Forwarders to start once the reply is queued.
+
+	multi  bool       // Inside MULTI: commands are queued until EXEC.
+	queued [][]string // Commands queued since MULTI.
+	txErr  bool       // A command failed to queue, so EXEC must refuse.
+	tx     *Txn       // Keys watched with WATCH, or nil.
+}
+
+// Authentication replies, worded as Redis words them.
+var (
+	errNoAuth     = errors.New("NOAUTH Authentication required.")
+	errWrongPass  = errors.New("WRONGPASS invalid username-password pair or user is disabled.")
+	errNoPassword = errors.New("AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?")
+)
+
+// errSubscribed refuses regular commands from a RESP2 client that is
+// subscribed, since its replies would be mistaken for messages.
+var errSubscribed = errors.New("ERR only SUBSCRIBE / UNSUBSCRIBE / PING / QUIT are allowed in this context")
+
+// handle runs one command for a client. It answers the connection-level
+// commands AUTH, HELLO, SUBSCRIBE, UNSUBSCRIBE and the transaction commands
+// itself, refuses everything but AUTH, HELLO and QUIT until the client has
+// authenticated, and, as Redis does for RESP2 clients, only lets subscribed
+// clients manage their subscriptions, PING and QUIT. Inside MULTI other
+// commands are queued rather than run.
+func (s *Server) handle(sess *session, args []string) any {
+	name := strings.ToUpper(args[0])
+	switch name {
+	case "AUTH":
+		return s.auth(sess, args[1:])
+	case "HELLO":
+		return s.hello(sess, args[1:])
+	case "QUIT":
+		return s.dispatch(sess, args)
+	}
+	if !sess.authed {
+		return errNoAuth
+	}
+	if len(sess.subs) > 0 && sess.w.proto == 2 && name != "SUBSCRIBE" && name != "UNSUBSCRIBE" && name != "PING" {
+		return errSubscribed
+	}
+	if err := sess.user.check(name, args[1:]); err != nil {
+		if sess.multi {
+			sess.txErr = true // Like a command that fails to queue.
+		}
+		return err
+	}
+	switch name {
+	case "MULTI", "EXEC", "DISCARD", "WATCH", "UNWATCH":
+		return s.transaction(sess, name, args[1:])
+	}
+	if sess.multi {
+		return sess.enqueue(args)
+	}
+	switch name {
+	case "SUBSCRIBE":
+		return s.subscribe(sess, args[1:])
+	case "UNSUBSCRIBE":
+		return sess.unsubscribe(args[1:])
+	case "XREAD", "XREADGROUP":
+		return s.streamRead(sess, name, args)
+	}
+	return s.dispatch(sess, args)
+}
+
+// auth checks AUTH [username] password, against cfg.Password for the
+// default user and cfg.Users for the others.
+func (s *Server) auth(sess *session, args []string) any {
+	if len(args) < 1 || len(args) > 2 {
+		return fmt.Errorf("wrong number of arguments for 'auth' command")
+	}
+	user, password := "default", args[len(args)-1]
+	if len(args) == 2 {
+		user = args[0]
+	}
+	if user == "default" && s.passHash == nil {
+		return errNoPassword
+	}
+	var match bool
+	named, ok := s.users[user]
+	switch {
+	case user == "default":
+		sum := sha256.Sum256([]byte(password))
+		match = subtle.ConstantTimeCompare(sum[:], s.passHash) == 1 // Hashing first keeps the length secret too.
+	case ok:
+		match = named.passwordMatches(password)
+	}
+	if !match {
+		s.db.logger.Warn("authentication failed", "user", user)
+		return errWrongPass
+	}
+	sess.authed, sess.user = true, named // named is nil for the default user.
+	return simpleString("OK")
+}
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startServer serves db with cfg on a local port for the length of the
+// test and returns its address.
+func startServer(t *testing.T, db *DataBase, cfg ServerConfig) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(db, cfg)
+	go s.Serve(ln)
+	t.Cleanup(func() { s.Close() })
+	return ln.Addr().String()
+}
+
+// respClient is a minimal RESP client for tests.
+type respClient struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// dial connects a respClient to addr, closed at the end of the test.
+func dial(t *testing.T, addr string) *respClient {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(10 * time.Second)) // A hung server fails the test.
+	return &respClient{conn: conn, r: bufio.NewReader(conn)}
+}
+
+// send writes a command as a RESP array of bulk strings, without reading
+// its reply.
+func (c *respClient) send(t *testing.T, args ...string) {
+	t.Helper()
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(c.conn, b.String()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// do sends a command and returns its reply.
+func (c *respClient) do(t *testing.T, args ...string) any {
+	t.Helper()
+	c.send(t, args...)
+	return c.read(t)
+}
+
+// read reads one reply: simple and bulk strings as string, errors as
+// error, integers as int64, nulls as nil, arrays and sets as []any, maps
+// as respMap and pushes as push, doubles as their text and booleans as
+// bool.
+func (c *respClient) read(t *testing.T) any {
+	t.Helper()
+	reply, err := readReply(c.r)
+	if err != nil {
+		t.Fatalf("reading a reply: %v", err)
+	}
+	return reply
+}
+
+// readReply implements respClient.read.
+func readReply(r *bufio.Reader) (any, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if line == "" {
+		return nil, errProtocol
+	}
+	body := line[1:]
+	switch line[0] {
+	case '+', ',':
+		return body, nil
+	case '-':
+		return errors.New(body), nil
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '#':
+		return body == "t", nil
+	case '_':
+		return nil, nil
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < 0 {
+			return nil, err // $-1 is a null.
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*', '~', '>', '%':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < 0 {
+			return nil, err // *-1 is a null array.
+		}
+		if line[0] == '%' {
+			n *= 2 // A key and a value per entry.
+		}
+		items := make([]any, n)
+		for i := range items {
+			if items[i], err = readReply(r); err != nil {
+				return nil, err
+			}
+		}
+		switch line[0] {
+		case '%':
+			return respMap(items), nil
+		case '>':
+			return push(items), nil
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("unknown reply type %q", line)
+}
+
+func TestServerGetSetDelExists(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	c := dial(t, startServer(t, db, ServerConfig{}))
+	for _, step := range []struct {
+		args []string
+		want any
+	}{
+		{[]string{"GET", "a"}, nil},
+		{[]string{"SET", "a", "1"}, "OK"},
+		{[]string{"SET", "b", "two words"}, "OK"},
+		{[]string{"GET", "b"}, "two words"},
+		{[]string{"EXISTS", "a", "b", "a", "missing"}, int64(3)}, // A key named twice counts twice.
+		{[]string{"del", "a", "missing"}, int64(1)},              // Command names are case-insensitive.
+		{[]string{"EXISTS", "a"}, int64(0)},
+		{[]string{"DEL", "a"}, int64(0)},
+		{[]string{"SET", "empty", ""}, "OK"},
+		{[]string{"GET", "empty"}, ""},
+	} {
+		if reply := c.do(t, step.args...); reply != step.want {
+			t.Errorf("%q = %#v, want %#v", step.args, reply, step.want)
+		}
+	}
+	if value, _ := db.Get("b"); value != "two words" {
+		t.Errorf("the database holds b = %v, want the value SET wrote", value)
+	}
+
+	for _, tc := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"NOSUCH", "x"}, "ERR unknown command 'NOSUCH'"},
+		{[]string{"GET"}, "ERR wrong number of arguments for 'get' command"},
+		{[]string{"DEL"}, "ERR wrong number of arguments for 'del' command"},
+		{[]string{"EXISTS"}, "ERR wrong number of arguments for 'exists' command"},
+	} {
+		if reply, ok := c.do(t, tc.args...).(error); !ok || reply.Error() != tc.want {
+			t.Errorf("%q = %v, want %q", tc.args, reply, tc.want)
+		}
+	}
+
+	if _, err := io.WriteString(c.conn, "SET inline value\r\nGET inline\r\n"); err != nil {
+		t.Fatal(err)
+	}
+	if reply := c.read(t); reply != "OK" {
+		t.Errorf("inline SET = %v, want OK", reply)
+	}
+	if reply := c.read(t); reply != "value" {
+		t.Errorf("inline GET = %v, want value", reply)
+	}
+}
+
+func TestServerClientsShareData(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	addr := startServer(t, db, ServerConfig{})
+	writer, reader := dial(t, addr), dial(t, addr)
+	writer.do(t, "SET", "shared", "v")
+	if reply := reader.do(t, "GET", "shared"); reply != "v" {
+		t.Errorf("GET from another connection = %v, want v", reply)
+	}
+	writer.conn.Close()
+	if reply := reader.do(t, "DEL", "shared"); reply != int64(1) {
+		t.Errorf("DEL after the other client left = %v, want 1", reply)
+	}
+}
+
+func TestServerMaxConnections(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	addr := startServer(t, db, ServerConfig{MaxConnections: 2})
+	first, second := dial(t, addr), dial(t, addr)
+	for _, c := range []*respClient{first, second} {
+		if reply := c.do(t, "PING"); reply != "PONG" {
+			t.Fatalf("PING = %v", reply)
+		}
+	}
+
+	third := dial(t, addr)
+	reply, err := readReply(third.r) // Rejected without sending anything.
+	if err != nil {
+		t.Fatalf("reading the rejection: %v", err)
+	}
+	if e, ok := reply.(error); !ok || e.Error() != errMaxClients.Error() {
+		t.Errorf("third connection got %v, want %v", reply, errMaxClients)
+	}
+	if _, err := third.r.ReadByte(); err != io.EOF {
+		t.Errorf("the rejected connection was not closed: %v", err)
+	}
+
+	first.conn.Close() // Frees a slot.
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		c := dial(t, addr)
+		if reply := c.do(t, "PING"); reply == "PONG" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("no slot freed after a client left")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestServerIdleTimeout(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	addr := startServer(t, db, ServerConfig{IdleTimeout: 50 * time.Millisecond})
+	c := dial(t, addr)
+	if reply := c.do(t, "PING"); reply != "PONG" {
+		t.Fatalf("PING = %v", reply)
+	}
+	start := time.Now()
+	if _, err := c.r.ReadByte(); err != io.EOF {
+		t.Fatalf("idle connection: %v, want it closed", err)
+	}
+	if waited := time.Since(start); waited < 40*time.Millisecond {
+		t.Errorf("closed after %v, before the idle timeout", waited)
+	}
+}
+
+func TestServerReadTimeout(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	addr := startServer(t, db, ServerConfig{ReadTimeout: 50 * time.Millisecond})
+	c := dial(t, addr)
+	io.WriteString(c.conn, "*1\r\n$4\r\nPI") // Half a command, then nothing.
+	if _, err := c.r.ReadByte(); err != io.EOF {
+		t.Errorf("slow client: %v, want the connection closed", err)
+	}
+}
+
+func TestServerPipelining(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	c := dial(t, startServer(t, db, ServerConfig{}))
+	var b strings.Builder
+	for i := range 1000 {
+		fmt.Fprintf(&b, "*3\r\n$3\r\nSET\r\n$7\r\ncounter\r\n$%d\r\n%d\r\n", len(strconv.Itoa(i)), i)
+	}
+	b.WriteString("*2\r\n$3\r\nGET\r\n$7\r\ncounter\r\n")
+	if _, err := io.WriteString(c.conn, b.String()); err != nil { // One write for all of them.
+		t.Fatal(err)
+	}
+	for i := range 1000 {
+		if reply := c.read(t); reply != "OK" {
+			t.Fatalf("reply %d = %v, want OK", i, reply)
+		}
+	}
+	if reply := c.read(t); reply != "999" {
+		t.Errorf("GET after the pipeline = %v, want the last SET's 999", reply)
+	}
+}
+
+func TestServerAuth(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	addr := startServer(t, db, ServerConfig{Password: "s3cret"})
+	c := dial(t, addr)
+	for _, args := range [][]string{{"GET", "k"}, {"SET", "k", "v"}, {"PING"}} {
+		if reply, ok := c.do(t, args...).(error); !ok || reply.Error() != errNoAuth.Error() {
+			t.Errorf("%s before AUTH = %v, want NOAUTH", args[0], reply)
+		}
+	}
+	if _, ok := db.Get("k"); ok {
+		t.Fatal("a SET before AUTH was applied")
+	}
+	if reply, ok := c.do(t, "AUTH", "wrong").(error); !ok || !strings.HasPrefix(reply.Error(), "WRONGPASS") {
+		t.Errorf("AUTH with a wrong password = %v, want WRONGPASS", reply)
+	}
+	if reply, ok := c.do(t, "GET", "k").(error); !ok || reply.Error() != errNoAuth.Error() {
+		t.Errorf("GET after a failed AUTH = %v, want NOAUTH", reply)
+	}
+
+	if reply := c.do(t, "AUTH", "s3cret"); reply != "OK" {
+		t.Fatalf("AUTH = %v, want OK", reply)
+	}
+	if reply := c.do(t, "SET", "k", "v"); reply != "OK" {
+		t.Errorf("SET after AUTH = %v, want OK", reply)
+	}
+	if reply := c.do(t, "GET", "k"); reply != "v" {
+		t.Errorf("GET after AUTH = %v, want v", reply)
+	}
+	if reply, ok := dial(t, addr).do(t, "GET", "k").(error); !ok || reply.Error() != errNoAuth.Error() {
+		t.Errorf("GET on a new connection = %v, want NOAUTH: AUTH is per connection", reply)
+	}
+
+	open := dial(t, startServer(t, db, ServerConfig{}))
+	if reply := open.do(t, "GET", "k"); reply != "v" {
+		t.Errorf("GET without a password configured = %v, want v", reply)
+	}
+	if _, ok := open.do(t, "AUTH", "s3cret").(error); !ok {
+		t.Error("AUTH without a password configured succeeded")
+	}
+}
+
+// kind sends a command and returns the type byte of its reply along with
+// the reply, so a test can tell RESP3 types from their RESP2 fallbacks.
+func (c *respClient) kind(t *testing.T, args ...string) (byte, any) {
+	t.Helper()
+	c.send(t, args...)
+	b, err := c.r.Peek(1)
+	if err != nil {
+		t.Fatalf("reading a reply: %v", err)
+	}
+	return b[0], c.read(t)
+}
+
+func TestServerHello(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	c := dial(t, startServer(t, db, ServerConfig{}))
+	db.HSet("user:1", "name", "ada")
+	db.HSet("user:1", "age", "36")
+	db.ZAdd("board", ZMember{"ada", 1.5})
+
+	if kind, reply := c.kind(t, "HGETALL", "user:1"); kind != '*' || len(reply.([]any)) != 4 {
+		t.Errorf("HGETALL before HELLO = %c %v, want a flat RESP2 array", kind, reply)
+	}
+	if kind, reply := c.kind(t, "ZSCORE", "board", "ada"); kind != '$' || reply != "1.5" {
+		t.Errorf("ZSCORE before HELLO = %c %v, want a bulk string", kind, reply)
+	}
+	if kind, _ := c.kind(t, "HELLO"); kind != '*' {
+		t.Errorf("HELLO with no version replied with %c, want an array: RESP2 stays", kind)
+	}
+	if reply, ok := c.do(t, "HELLO", "4").(error); !ok || !strings.HasPrefix(reply.Error(), "NOPROTO") {
+		t.Errorf("HELLO 4 = %v, want NOPROTO", reply)
+	}
+
+	reply, ok := c.do(t, "HELLO", "3", "SETNAME", "app").(respMap)
+	if !ok {
+		t.Fatalf("HELLO 3 = %#v, want a map", reply)
+	}
+	meta := map[any]any{}
+	for i := 0; i+1 < len(reply); i += 2 {
+		meta[reply[i]] = reply[i+1]
+	}
+	if meta["server"] != "redis" || meta["proto"] != int64(3) || meta["role"] != "master" {
+		t.Errorf("HELLO 3 metadata = %v", meta)
+	}
+	if _, ok := meta["id"].(int64); !ok {
+		t.Errorf("HELLO 3 has no client id: %v", meta)
+	}
+
+	want := respMap{"age", "36", "name", "ada"}
+	if kind, reply := c.kind(t, "HGETALL", "user:1"); kind != '%' || fmt.Sprint(reply) != fmt.Sprint(want) {
+		t.Errorf("HGETALL under RESP3 = %c %v, want the map %v", kind, reply, want)
+	}
+	if kind, reply := c.kind(t, "ZSCORE", "board", "ada"); kind != ',' || reply != "1.5" {
+		t.Errorf("ZSCORE under RESP3 = %c %v, want the double 1.5", kind, reply)
+	}
+	if kind, reply := c.kind(t, "GET", "missing"); kind != '_' || reply != nil {
+		t.Errorf("GET of a missing key under RESP3 = %c %v, want a null", kind, reply)
+	}
+
+	if reply := c.do(t, "SUBSCRIBE", "news"); fmt.Sprint(reply) != fmt.Sprint(push{"subscribe", "news", int64(1)}) {
+		t.Fatalf("SUBSCRIBE under RESP3 = %#v, want a push", reply)
+	}
+	if kind, reply := c.kind(t, "GET", "user:2"); kind != '_' {
+		t.Errorf("GET while subscribed under RESP3 = %c %v, want it served", kind, reply)
+	}
+	db.Publish("news", "goal")
+	if msg, ok := c.read(t).(push); !ok || fmt.Sprint(msg) != fmt.Sprint(push{"message", "news", "goal"}) {
+		t.Errorf("published message = %#v, want a push", msg)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// serverVersion is the Redis version HELLO reports, the one whose commands
+// and replies the server follows.
+const serverVersion = "7.0.0"
+
+// HELLO replies, worded as Redis words them.
+var (
+	errNoProto     = errors.New("NOPROTO unsupported protocol version")
+	errSyntax      = errors.New("ERR syntax error")
+	errHelloNoAuth = errors.New("NOAUTH HELLO must be called with the client already authenticated, otherwise the HELLO <proto> AUTH <user> <pass> option can be used to authenticate the client and select the RESP protocol version at the same time")
+)
+
+// hello handles HELLO [protover [AUTH username password] [SETNAME name]],
+// switching the connection to RESP2 or RESP3 and replying with a map of
+// server details. Without a version it only reports them.
+func (s *Server) hello(sess *session, args []string) any {
+	proto := sess.w.proto
+	if len(args) > 0 {
+		v, err := strconv.Atoi(args[0])
+		if err != nil {
+			return errors.New("ERR Protocol version is not an integer or out of range")
+		}
+		if v != 2 && v != 3 {
+			return errNoProto
+		}
+		proto, args = v, args[1:]
+	}
+	for len(args) > 0 {
+		switch strings.ToUpper(args[0]) {
+		case "AUTH":
+			if len(args) < 3 {
+				return errSyntax
+			}
+			if err, ok := s.auth(sess, args[1:3]).(error); ok {
+				return err
+			}
+			args = args[3:]
+		case "SETNAME":
+			if len(args) < 2 {
+				return errSyntax
+			}
+			sess.name, args = args[1], args[2:]
+		default:
+			return errSyntax
+		}
+	}
+	if !sess.authed {
+		return errHelloNoAuth
+	}
+	sess.wmu.Lock() // Forwarders read the version while writing.
+	sess.w.proto = proto
+	sess.wmu.Unlock()
+	return respMap{
+		"server", "redis",
+		"version", serverVersion,
+		"proto", proto,
+		"id", sess.id,
+		"mode", "standalone",
+		"role", "master",
+		"modules", []any{},
+	}
+}
+
+// subscribe handles SUBSCRIBE channel [channel ...], confirming each channel
+// with the number of channels the client is now subscribed to. Messages are
+// delivered as pushes once the confirmations have been written.
+func (s *Server) subscribe(sess *session, channels []string) any {
+	if len(channels) == 0 {
+		return fmt.Errorf("wrong number of arguments for 'subscribe' command")
+	}
+	if sess.subs == nil {
+		sess.subs = make(map[string]func())
+	}
+	replies := make(multiReply, 0, len(channels))
+	for _, channel := range channels {
+		if _, ok := sess.subs[channel]; !ok {
+			msgs, cancel := s.db.Subscribe(channel)
+			sess.subs[channel] = cancel
+			sess.pending = append(sess.pending, func() {
+				s.wg.Add(1)
+				go s.forward(sess, channel, msgs)
+			})
+		}
+		replies = append(replies, push{"subscribe", channel, len(sess.subs)})
+	}
+	return replies
+}
+
+// unsubscribe handles UNSUBSCRIBE [channel ...]; without channels it leaves
+// every channel.
+func (sess *session) unsubscribe(channels []string) any {
+	if len(channels) == 0 {
+		for channel := range sess.subs {
+			channels = append(channels, channel)
+		}
+		sort.Strings(channels)
+		if len(channels) == 0 {
+			return push{"unsubscribe", nil, 0}
+		}
+	}
+	replies := make(multiReply, 0, len(channels))
+	for _, channel := range channels {
+		if cancel, ok := sess.subs[channel]; ok {
+			cancel() // Closes the channel, which ends its forwarder.
+			delete(sess.subs, channel)
+		}
+		replies = append(replies, push{"unsubscribe", channel, len(sess.subs)})
+	}
+	return replies
+}
+
+// unsubscribeAll drops every subscription when the connection ends.
+func (sess *session) unsubscribeAll() {
+	for channel, cancel := range sess.subs {
+		cancel()
+		delete(sess.subs, channel)
+	}
+}
+
+// startForwarders starts the forwarders of channels just subscribed to.
+// The caller must hold sess.wmu.
+func (sess *session) startForwarders() {
+	for _, start := range sess.pending {
+		start()
+	}
+	sess.pending = nil
+}
+
+// forward writes the messages published on channel to the client as
+// pushes, until the subscription is cancelled.
+func (s *Server) forward(sess *session, channel string, msgs <-chan any) {
+	defer s.wg.Done()
+	for msg := range msgs {
+		switch msg.(type) {
+		case string, []byte:
+		default:
+			msg = fmt.Sprint(msg) // Messages from the Go API may be any value.
+		}
+		sess.wmu.Lock()
+		sess.w.writeReply(push{"message", channel, msg})
+		err := sess.w.w.Flush()
+		sess.wmu.Unlock()
+		if err != nil {
+			s.db.logger.Debug("dropping subscription delivery", "id", sess.id, "err", err)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// syncReplica serves SYNC: it sends the replica a full snapshot and then
+// every change as it is made, until the replica disconnects, falls too far
+// behind or the server shuts down. The connection carries nothing else
+// from then on.
+func (s *Server) syncReplica(sess *session, conn net.Conn, r *bufio.Reader) {
+	snapshot, feed := s.db.attachReplica()
+	defer s.db.detachReplica(feed)
+	s.db.logger.Info("replica attached", "id", sess.id, "remote", conn.RemoteAddr(), "bytes", len(snapshot))
+
+	conn.SetReadDeadline(time.Time{}) // A replica stays quiet indefinitely.
+	gone := make(chan struct{})
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		io.Copy(io.Discard, r) // Replicas send nothing more; this ends when the connection does.
+		close(gone)
+	}()
+
+	w := sess.w.w
+	w.WriteString(replFullResync)
+	w.Write(snapshot)
+	if err := w.Flush(); err != nil {
+		return
+	}
+	for {
+		select {
+		case batch := <-feed.batches:
+			w.Write(batch)
+			if len(feed.batches) > 0 {
+				continue // More is waiting; write it in the same flush.
+			}
+			if err := w.Flush(); err != nil {
+				return
+			}
+		case <-feed.dropped:
+			s.db.logger.Warn("replica dropped: too far behind", "id", sess.id)
+			return
+		case <-gone:
+			return
+		case <-s.db.stop:
+			return
+		}
+	}
+}
+
+// isSync reports whether a command is SYNC from a client that may start
+// replicating: authenticated with @admin access, and neither subscribed nor
+// inside MULTI. handle answers the others, with NOPERM for users without
+// @admin.
+func (sess *session) isSync(args []string) bool {
+	return strings.EqualFold(args[0], "SYNC") && sess.authed && sess.user.check("SYNC", nil) == nil &&
+		!sess.multi && len(sess.subs) == 0
+}
+
+// cmdCheckSync asks the replicas to verify their data against the primary's
+// and replies with how many were asked.
+func cmdCheckSync(db *DataBase, args []string) any {
+	return db.CheckReplicas()
+}
+
+// cmdReplicaOf handles REPLICAOF host port, and REPLICAOF NO ONE to stop
+// replicating.
+func cmdReplicaOf(db *DataBase, args []string) any {
+	addr := net.JoinHostPort(args[0], args[1])
+	if strings.EqualFold(args[0], "NO") && strings.EqualFold(args[1], "ONE") {
+		addr = ""
+	}
+	if err := db.ReplicaOf(addr); err != nil {
+		return err
+	}
+	return simpleString("OK")
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// errAutoIDOnly refuses XADD with an explicit ID, since XAdd always picks
+// the ID itself.
+var errAutoIDOnly = errors.New("ERR only auto-generated IDs (*) are supported")
+
+// cmdXAdd handles XADD key * field value [field value ...] and replies with
+// the new entry's ID.
+func cmdXAdd(db *DataBase, args []string) any {
+	if args[1] != "*" {
+		return errAutoIDOnly
+	}
+	if len(args)%2 != 0 {
+		return fmt.Errorf("wrong number of arguments for 'xadd' command") // A field without a value.
+	}
+	fields := make(map[string]any, (len(args)-2)/2)
+	for i := 2; i < len(args); i += 2 {
+		fields[args[i]] = args[i+1]
+	}
+	id, err := db.XAdd(args[0], fields)
+	if err != nil {
+		return err
+	}
+	return id
+}
+
+// cmdXRange handles XRANGE key start end [COUNT count].
+func cmdXRange(db *DataBase, args []string) any {
+	count := -1
+	if len(args) == 5 && strings.EqualFold(args[3], "COUNT") {
+		n, err := strconv.Atoi(args[4])
+		if err != nil {
+			return ErrNotInteger
+		}
+		count = n
+	} else if len(args) != 3 {
+		return errSyntax
+	}
+	entries, err := db.XRange(args[0], args[1], args[2])
+	if err != nil {
+		return err
+	}
+	if count >= 0 && len(entries) > count {
+		entries = entries[:count]
+	}
+	return entriesReply(entries)
+}
+
+// xreadArgs are the parsed arguments of XREAD or XREADGROUP.
+type xreadArgs struct {
+	group, consumer string
+	count           int
+	block           time.Duration // How long to wait; 0 is forever, and negative without BLOCK.
+	noAck           bool
+	keys            []string          // The streams, in the order given.
+	ids             map[string]string // The ID given for each of them.
+}
+
+// parseXRead parses [GROUP group consumer] [COUNT count] [BLOCK ms]
+// [NOACK] STREAMS key [key ...] id [id ...], with GROUP required and NOACK
+// allowed only for XREADGROUP.
+func parseXRead(name string, args []string) (xreadArgs, error) {
+	a := xreadArgs{block: -1}
+	if name == "XREADGROUP" {
+		if len(args) < 3 || !strings.EqualFold(args[0], "GROUP") {
+			return a, errSyntax
+		}
+		a.group, a.consumer, args = args[1], args[2], args[3:]
+	}
+	for len(args) > 0 && !strings.EqualFold(args[0], "STREAMS") {
+		switch opt := strings.ToUpper(args[0]); {
+		case (opt == "COUNT" || opt == "BLOCK") && len(args) > 1:
+			n, err := strconv.Atoi(args[1])
+			if err != nil {
+				return a, ErrNotInteger
+			}
+			if opt == "COUNT" {
+				a.count = n
+			} else if n < 0 {
+				return a, errors.New("ERR timeout is negative")
+			} else {
+				a.block = time.Duration(n) * time.Millisecond
+			}
+			args = args[2:]
+		case opt == "NOACK" && name == "XREADGROUP":
+			a.noAck, args = true, args[1:]
+		default:
+			return a, errSyntax
+		}
+	}
+	if len(args) < 3 || len(args)%2 == 0 {
+		if len(args) == 0 {
+			return a, errSyntax // No STREAMS.
+		}
+		return a, fmt.Errorf("Unbalanced '%s' list of streams: for each stream key an ID or '$' must be specified.", strings.ToLower(name))
+	}
+	streams := args[1:]
+	a.keys, a.ids = streams[:len(streams)/2], make(map[string]string, len(streams)/2)
+	for i, key := range a.keys {
+		a.ids[key] = streams[len(a.keys)+i]
+	}
+	return a, nil
+}
+
+// cmdXRead handles XREAD. Run from the dispatch table it never blocks, as
+// inside MULTI in Redis; Server.streamRead handles BLOCK for clients.
+func cmdXRead(db *DataBase, args []string) any {
+	a, err := parseXRead("XREAD", args)
+	if err != nil {
+		return err
+	}
+	return xread(context.Background(), db, "XREAD", a, false)
+}
+
+// cmdXReadGroup handles XREADGROUP, never blocking, like cmdXRead.
+func cmdXReadGroup(db *DataBase, args []string) any {
+	a, err := parseXRead("XREADGROUP", args)
+	if err != nil {
+		return err
+	}
+	return xread(context.Background(), db, "XREADGROUP", a, false)
+}
+
+// streamRead runs XREAD or XREADGROUP for a client. With BLOCK it waits
+// for entries outside execMu, so a client blocked for long does not hold up
+// EXEC, and replies null if the timeout passes or the server closes first.
+func (s *Server) streamRead(sess *session, name string, args []string) any {
+	a, err := parseXRead(name, args[1:])
+	if err != nil || a.block < 0 {
+		return s.dispatch(sess, args) // Replies with the error, or reads without blocking.
+	}
+	ctx := s.stopped
+	if a.block > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.block)
+		defer cancel()
+	}
+	return xread(ctx, sess.db, name, a, true)
+}
+
+// xread runs a parsed XREAD or XREADGROUP and builds its reply: a pair of
+// key and entries for each stream with entries, or null if there are none.
+func xread(ctx context.Context, db *DataBase, name string, a xreadArgs, block bool) any {
+	var read map[string][]StreamEntry
+	var err error
+	if name == "XREADGROUP" {
+		read, err = db.XReadGroup(ctx, a.group, a.consumer, a.count, block, a.noAck, a.ids)
+	} else {
+		read, err = db.XRead(ctx, a.count, block, a.ids)
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) || (err == nil && len(read) == 0) {
+		return nullArray{}
+	}
+	if err != nil {
+		return err
+	}
+	reply := []any{}
+	for _, key := range a.keys {
+		if entries, ok := read[key]; ok {
+			reply = append(reply, []any{key, entriesReply(entries)})
+			delete(read, key) // A key given twice is replied to once.
+		}
+	}
+	return reply
+}
+
+// cmdXGroup handles XGROUP CREATE key group id [MKSTREAM].
+func cmdXGroup(db *DataBase, args []string) any {
+	if !strings.EqualFold(args[0], "CREATE") {
+		return fmt.Errorf("unknown subcommand '%s'", args[0])
+	}
+	if len(args) < 4 || len(args) > 5 || (len(args) == 5 && !strings.EqualFold(args[4], "MKSTREAM")) {
+		return errSyntax
+	}
+	if err := db.XGroupCreate(args[1], args[2], args[3], len(args) == 5); err != nil {
+		return err
+	}
+	return simpleString("OK")
+}
+
+// cmdXAck handles XACK key group id [id ...] and replies with how many
+// entries were acknowledged.
+func cmdXAck(db *DataBase, args []string) any {
+	n, err := db.XAck(args[0], args[1], args[2:]...)
+	if err != nil {
+		return err
+	}
+	return n
+}
+
+// entriesReply renders stream entries as Redis does: an array of entries,
+// each its ID and an array of fields and values, sorted by field. An entry
+// without fields, one pending but since removed, has a null in their place.
+func entriesReply(entries []StreamEntry) []any {
+	reply := make([]any, len(entries))
+	for i, e := range entries {
+		if e.Fields == nil {
+			reply[i] = []any{e.ID.String(), nil}
+			continue
+		}
+		fields := make([]any, 0, 2*len(e.Fields))
+		for _, field := range slices.Sorted(maps.Keys(e.Fields)) {
+			fields = append(fields, field, stringReply(e.Fields[field]))
+		}
+		reply[i] = []any{e.ID.String(), fields}
+	}
+	return reply
+}
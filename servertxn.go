@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Transaction replies, worded as Redis words them.
+var (
+	errNestedMulti  = errors.New("ERR MULTI calls can not be nested")
+	errWatchInMulti = errors.New("ERR WATCH inside MULTI is not allowed")
+	errExecAbort    = errors.New("EXECABORT Transaction discarded because of previous errors.")
+)
+
+// transaction handles MULTI, EXEC, DISCARD, WATCH and UNWATCH for a client.
+func (s *Server) transaction(sess *session, name string, args []string) any {
+	switch name {
+	case "WATCH":
+		if len(args) == 0 {
+			return fmt.Errorf("wrong number of arguments for 'watch' command")
+		}
+		if sess.multi {
+			return errWatchInMulti
+		}
+		if sess.tx == nil {
+			sess.tx = sess.db.Multi()
+		}
+		sess.tx.Watch(args...)
+		return simpleString("OK")
+	case "UNWATCH":
+		sess.tx = nil
+		return simpleString("OK")
+	case "MULTI":
+		if sess.multi {
+			return errNestedMulti
+		}
+		sess.multi = true
+		return simpleString("OK")
+	case "DISCARD":
+		if !sess.multi {
+			return errors.New("ERR DISCARD without MULTI")
+		}
+		sess.resetTransaction()
+		return simpleString("OK")
+	}
+	if !sess.multi {
+		return errors.New("ERR EXEC without MULTI")
+	}
+	return s.exec(sess)
+}
+
+// enqueue queues a command inside MULTI. A command that does not exist or
+// has the wrong arity is refused at once and makes EXEC fail, as in Redis.
+func (sess *session) enqueue(args []string) any {
+	if _, _, err := lookupCommand(args); err != nil && !isDBCommand(args[0]) {
+		sess.txErr = true
+		return err
+	}
+	sess.queued = append(sess.queued, args)
+	return simpleString("QUEUED")
+}
+
+// exec runs the commands queued since MULTI with no other client's commands
+// in between, and replies with their replies. It replies null without running
+// anything if a key watched with WATCH has changed since. Writes made
+// directly through the DataBase API, rather than over the server, are not
+// held off while the commands run.
+func (s *Server) exec(sess *session) any {
+	queued, tx, failed := sess.queued, sess.tx, sess.txErr
+	sess.resetTransaction()
+	if failed {
+		return errExecAbort
+	}
+
+	s.execMu.Lock()         // Hold off every other client.
+	defer s.execMu.Unlock() // Release the lock when the function exits.
+	if tx != nil && tx.stale() {
+		return nullArray{} // Aborted: a watched key changed.
+	}
+	replies := make([]any, len(queued))
+	for i, args := range queued {
+		replies[i] = s.run(sess, args)
+	}
+	return replies
+}
+
+// resetTransaction leaves MULTI and forgets the watched keys, as EXEC and
+// DISCARD do.
+func (sess *session) resetTransaction() {
+	sess.multi, sess.queued, sess.txErr, sess.tx = false, nil, false, nil
+}
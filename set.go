@@ -0,0 +1,398 @@
+package main
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Set is the value stored under a key holding a Redis-style set. Members are
+// kept in their string form, as Redis does, so 5 and "5" are the same member.
+type Set map[string]struct{}
+
+func init() {
+	gob.Register(Set{}) // Allow sets to be persisted inside the any-typed map.
+}
+
+// setMember converts a member to the string form used as the set's map key.
+func setMember(member any) string {
+	if s, ok := member.(string); ok {
+		return s // Fast path for the common case.
+	}
+	return fmt.Sprint(member)
+}
+
+// setAt returns the set stored at key, or nil if the key is absent.
+// It returns ErrWrongType if the key holds a non-set value.
+// The caller must hold the lock.
+func (db *DataBase) setAt(key string) (Set, error) {
+	value, exists := db.lookup(key)
+	if !exists {
+		return nil, nil // Absent keys behave like empty sets.
+	}
+	set, ok := value.(Set)
+	if !ok {
+		return nil, ErrWrongType
+	}
+	return set, nil
+}
+
+// SAdd adds members to the set at key, creating it if needed.
+// Returns how many members were not already present.
+func (db *DataBase) SAdd(key string, members ...any) (int, error) {
+	db.lock.Lock()    // Acquire a write lock.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	if db.readOnly {
+		return 0, ErrReadOnly
+	}
+	db.expireIfNeeded(key)
+	if err := db.checkGrowth(); err != nil {
+		return 0, err
+	}
+
+	set, err := db.setAt(key)
+	if err != nil {
+		return 0, err
+	}
+	if set == nil {
+		set = make(Set, len(members)) // First member creates the set.
+		db.data.set(key, set)
+	}
+	db.cow(key) // Keep a running BGSave's view intact.
+	added := 0
+	for _, member := range members {
+		m := setMember(member)
+		if _, ok := set[m]; !ok {
+			set[m] = struct{}{}
+			added++
+		}
+	}
+	if added > 0 {
+		db.touch(key)
+	}
+	return added, nil
+}
+
+// SRem removes members from the set at key and returns how many were
+// present. Removing the last member deletes the key.
+func (db *DataBase) SRem(key string, members ...any) (int, error) {
+	db.lock.Lock()    // Acquire a write lock.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	if db.readOnly {
+		return 0, ErrReadOnly
+	}
+	db.expireIfNeeded(key)
+
+	set, err := db.setAt(key)
+	if err != nil || set == nil {
+		return 0, err
+	}
+	db.cow(key) // Keep a running BGSave's view intact.
+	removed := 0
+	for _, member := range members {
+		m := setMember(member)
+		if _, ok := set[m]; ok {
+			delete(set, m)
+			removed++
+		}
+	}
+	if len(set) == 0 {
+		db.removeKey(key) // Redis removes empty sets.
+	} else if removed > 0 {
+		db.touch(key)
+	}
+	return removed, nil
+}
+
+// SIsMember reports whether member belongs to the set at key.
+func (db *DataBase) SIsMember(key string, member any) (bool, error) {
+	db.lock.RLock()         // Acquire a read lock.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+
+	set, err := db.setAt(key)
+	if err != nil {
+		return false, err
+	}
+	_, ok := set[setMember(member)]
+	return ok, nil
+}
+
+// SCard returns the number of members in the set at key, or 0 if the key
+// does not exist.
+func (db *DataBase) SCard(key string) (int, error) {
+	db.lock.RLock()         // Acquire a read lock.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+
+	set, err := db.setAt(key)
+	if err != nil {
+		return 0, err
+	}
+	return len(set), nil
+}
+
+// ErrNegativeLimit is returned by SInterCard for a negative limit.
+var ErrNegativeLimit = errors.New("ERR LIMIT can't be negative")
+
+// SInterCard returns the number of members common to the sets at keys
+// without building the intersection, like Redis SINTERCARD. It walks the
+// smallest set and probes the others, and with a positive limit stops
+// counting once limit is reached, so the result is at most limit. A missing
+// key is an empty set, making the result 0. Every key is type-checked, so a
+// non-set key returns ErrWrongType even if the count is already known.
+func (db *DataBase) SInterCard(limit int, keys ...string) (int, error) {
+	if limit < 0 {
+		return 0, ErrNegativeLimit
+	}
+	db.lock.RLock()         // Acquire a read lock.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+
+	sets, err := db.setsAt(keys)
+	if err != nil {
+		return 0, err
+	}
+	if len(sets) == 0 {
+		return 0, nil
+	}
+	sort.Slice(sets, func(i, j int) bool { return len(sets[i]) < len(sets[j]) })
+	count := 0
+	for m := range sets[0] {
+		if !inAll(m, sets[1:]) {
+			continue
+		}
+		count++
+		if count == limit {
+			break // The caller only needs to know it reaches limit.
+		}
+	}
+	return count, nil
+}
+
+// SUnion returns the members of any of the sets at keys, sorted, like Redis
+// SUNION. Missing keys are empty sets.
+func (db *DataBase) SUnion(keys ...string) ([]string, error) {
+	db.lock.RLock()         // Acquire a read lock.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+
+	sets, err := db.setsAt(keys)
+	if err != nil {
+		return nil, err
+	}
+	union := make(Set)
+	for _, set := range sets {
+		for m := range set {
+			union[m] = struct{}{}
+		}
+	}
+	return sortedMembers(union), nil
+}
+
+// SInter returns the members common to all the sets at keys, sorted, like
+// Redis SINTER. A missing key is an empty set, making the result empty.
+func (db *DataBase) SInter(keys ...string) ([]string, error) {
+	db.lock.RLock()         // Acquire a read lock.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+
+	sets, err := db.setsAt(keys)
+	if err != nil || len(sets) == 0 {
+		return []string{}, err
+	}
+	sort.Slice(sets, func(i, j int) bool { return len(sets[i]) < len(sets[j]) })
+	inter := make(Set)
+	for m := range sets[0] { // Walk the smallest set and probe the others.
+		if inAll(m, sets[1:]) {
+			inter[m] = struct{}{}
+		}
+	}
+	return sortedMembers(inter), nil
+}
+
+// SDiff returns the members of the set at the first key that are in none
+// of the sets at the other keys, sorted, like Redis SDIFF.
+func (db *DataBase) SDiff(keys ...string) ([]string, error) {
+	db.lock.RLock()         // Acquire a read lock.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+
+	sets, err := db.setsAt(keys)
+	if err != nil || len(sets) == 0 {
+		return []string{}, err
+	}
+	diff := make(Set)
+	for m := range sets[0] {
+		if !inAny(m, sets[1:]) {
+			diff[m] = struct{}{}
+		}
+	}
+	return sortedMembers(diff), nil
+}
+
+// setsAt returns the sets at keys, in order, with nil for missing keys. It
+// returns ErrWrongType if any key holds a non-set value. The caller must
+// hold the lock.
+func (db *DataBase) setsAt(keys []string) ([]Set, error) {
+	sets := make([]Set, len(keys))
+	for i, key := range keys {
+		set, err := db.setAt(key)
+		if err != nil {
+			return nil, err
+		}
+		sets[i] = set
+	}
+	return sets, nil
+}
+
+// inAny reports whether member belongs to at least one of the sets.
+func inAny(member string, sets []Set) bool {
+	for _, set := range sets {
+		if _, ok := set[member]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// inAll reports whether member belongs to every set.
+func inAll(member string, sets []Set) bool {
+	for _, set := range sets {
+		if _, ok := set[member]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// SMembers returns the members of the set at key, sorted.
+func (db *DataBase) SMembers(key string) ([]string, error) {
+	db.lock.RLock()         // Acquire a read lock.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+
+	set, err := db.setAt(key)
+	if err != nil {
+		return nil, err
+	}
+	members := make([]string, 0, len(set))
+	for m := range set {
+		members = append(members, m)
+	}
+	sort.Strings(members) // Map order is random; give callers a stable view.
+	return members, nil
+}
+
+// sortedMembers returns a set's members in lexical order, giving random
+// picks a deterministic base so seeded generators are reproducible.
+func sortedMembers(set Set) []string {
+	members := make([]string, 0, len(set))
+	for m := range set {
+		members = append(members, m)
+	}
+	sort.Strings(members)
+	return members
+}
+
+// SRandMember returns random members of the set at key without removing
+// them. A positive count returns up to count distinct members, so asking for
+// more than the set holds returns the whole set in random order. A negative
+// count returns exactly -count members that may repeat, as in Redis. Use
+// WithRandSeed for reproducible picks.
+func (db *DataBase) SRandMember(key string, count int) ([]any, error) {
+	db.lock.RLock()         // Acquire a read lock.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+
+	set, err := db.setAt(key)
+	if err != nil || len(set) == 0 || count == 0 {
+		return []any{}, err
+	}
+	members := sortedMembers(set)
+	if count < 0 {
+		picks := make([]any, -count)
+		for i := range picks {
+			picks[i] = members[db.rand.intN(len(members))] // Independent draws may repeat.
+		}
+		return picks, nil
+	}
+	order := db.rand.perm(len(members))
+	picks := make([]any, min(count, len(members)))
+	for i := range picks {
+		picks[i] = members[order[i]]
+	}
+	return picks, nil
+}
+
+// SPop removes and returns up to count distinct random members of the set
+// at key, deleting the key once it is empty. Use WithRandSeed for
+// reproducible picks.
+func (db *DataBase) SPop(key string, count int) ([]any, error) {
+	db.lock.Lock()    // Acquire a write lock.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	if db.readOnly {
+		return nil, ErrReadOnly
+	}
+	db.expireIfNeeded(key)
+
+	set, err := db.setAt(key)
+	if err != nil || len(set) == 0 || count <= 0 {
+		return []any{}, err
+	}
+	members := sortedMembers(set)
+	order := db.rand.perm(len(members))
+	picks := make([]any, min(count, len(members)))
+	db.cow(key) // Keep a running BGSave's view intact.
+	for i := range picks {
+		m := members[order[i]]
+		picks[i] = m
+		delete(set, m)
+	}
+	if len(set) == 0 {
+		db.removeKey(key) // Redis removes empty sets.
+	} else {
+		db.touch(key)
+	}
+	return picks, nil
+}
+
+// SMove atomically moves member from the set at src to the set at dst,
+// creating dst if it does not exist. It returns false if member was not in
+// src. Both keys are checked for the set type before anything changes, and
+// the whole move happens under one write lock, so no reader can observe the
+// member in both sets or in neither.
+func (db *DataBase) SMove(src, dst string, member any) (bool, error) {
+	db.lock.Lock()    // Acquire a write lock for the whole move.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	if db.readOnly {
+		return false, ErrReadOnly
+	}
+	db.expireIfNeeded(src)
+	db.expireIfNeeded(dst)
+
+	from, err := db.setAt(src)
+	if err != nil {
+		return false, err
+	}
+	to, err := db.setAt(dst)
+	if err != nil {
+		return false, err // Fail before touching src.
+	}
+	m := setMember(member)
+	if _, ok := from[m]; !ok {
+		return false, nil // Nothing to move.
+	}
+	if src == dst {
+		return true, nil // Moving within one set is a no-op.
+	}
+
+	db.cow(src) // Keep a running BGSave's view of both sets intact.
+	db.cow(dst)
+	delete(from, m)
+	if len(from) == 0 {
+		db.removeKey(src) // Redis removes empty sets.
+	} else {
+		db.touch(src)
+	}
+	if to == nil {
+		to = make(Set)
+		db.data.set(dst, to)
+	}
+	to[m] = struct{}{}
+	db.touch(dst)
+	return true, nil
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestSMoveNeverTorn(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	db.SAdd("a", "m", "anchor")
+	db.SAdd("b", "anchor") // Keeps b alive while m is in a.
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := range 2000 {
+			src, dst := "a", "b"
+			if i%2 == 1 {
+				src, dst = dst, src
+			}
+			if moved, err := db.SMove(src, dst, "m"); !moved || err != nil {
+				t.Errorf("SMove(%s, %s) = %v, %v", src, dst, moved, err)
+				break
+			}
+		}
+		close(done)
+	}()
+	for {
+		select {
+		case <-done:
+			wg.Wait()
+			if ok, _ := db.SIsMember("a", "m"); !ok {
+				t.Error("m is not back in a after an even number of moves")
+			}
+			return
+		default:
+		}
+		union, _ := db.SUnion("a", "b") // Each reads both sets under one lock.
+		inter, _ := db.SInter("a", "b")
+		if !slices.Contains(union, "m") {
+			t.Fatal("m was in neither set")
+		}
+		if slices.Contains(inter, "m") {
+			t.Fatal("m was in both sets")
+		}
+	}
+}
+
+func TestSMove(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	db.SAdd("src", "x")
+	if moved, err := db.SMove("src", "dst", "missing"); moved || err != nil {
+		t.Errorf("SMove of a missing member = %v, %v", moved, err)
+	}
+	if moved, err := db.SMove("src", "dst", "x"); !moved || err != nil {
+		t.Fatalf("SMove = %v, %v", moved, err)
+	}
+	if _, ok := db.Get("src"); ok {
+		t.Error("the emptied source set was kept")
+	}
+	if members, _ := db.SMembers("dst"); !slices.Equal(members, []string{"x"}) {
+		t.Errorf("dst = %q, want [x]", members)
+	}
+	db.Set("str", "v")
+	if _, err := db.SMove("dst", "str", "x"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("SMove into a string: %v, want ErrWrongType", err)
+	}
+	if ok, _ := db.SIsMember("dst", "x"); !ok {
+		t.Error("the refused SMove removed the member from its source")
+	}
+}
+
+func TestSRandMemberAndSPop(t *testing.T) {
+	newDB := func() *DataBase {
+		db := NewDataBase(WithRandSeed(7))
+		db.SAdd("s", "a", "b", "c", "d")
+		return db
+	}
+	db, twin := newDB(), newDB()
+	defer db.Close()
+	defer twin.Close()
+
+	all, err := db.SRandMember("s", 10) // More than the set holds.
+	if err != nil || len(all) != 4 {
+		t.Fatalf("SRandMember(10) = %v, %v; want all 4 members", all, err)
+	}
+	got := make([]string, len(all))
+	for i, m := range all {
+		got[i] = m.(string)
+	}
+	slices.Sort(got)
+	if !slices.Equal(got, []string{"a", "b", "c", "d"}) {
+		t.Errorf("SRandMember(10) = %q, want each member once", got)
+	}
+	if repeats, _ := db.SRandMember("s", -10); len(repeats) != 10 {
+		t.Errorf("SRandMember(-10) returned %d members, want 10", len(repeats))
+	}
+	if n, _ := db.SCard("s"); n != 4 {
+		t.Errorf("SRandMember removed members: %d left", n)
+	}
+	twin.SRandMember("s", 10)
+	twin.SRandMember("s", -10)
+
+	popped, _ := db.SPop("s", 3)
+	if twinPopped, _ := twin.SPop("s", 3); !slices.Equal(popped, twinPopped) {
+		t.Errorf("equal seeds popped %v and %v", popped, twinPopped)
+	}
+	if rest, _ := db.SPop("s", 10); len(rest) != 1 {
+		t.Errorf("SPop(10) of the last member = %v, want one", rest)
+	}
+	if _, ok := db.Get("s"); ok {
+		t.Error("the emptied set was kept")
+	}
+	if picks, err := db.SRandMember("missing", 3); err != nil || len(picks) != 0 {
+		t.Errorf("SRandMember of a missing key = %v, %v", picks, err)
+	}
+}
+
+func TestSCard(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	db.SAdd("set", "a", "b", "a")
+	if n, err := db.SCard("set"); err != nil || n != 2 {
+		t.Errorf("SCard = %d, %v; want 2", n, err)
+	}
+	if n, err := db.SCard("missing"); err != nil || n != 0 {
+		t.Errorf("SCard of a missing key = %d, %v; want 0", n, err)
+	}
+	db.RPush("list", "a")
+	if _, err := db.SCard("list"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("SCard of a list: %v, want ErrWrongType", err)
+	}
+}
+
+func TestSInterCard(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	var evens, threes, small []any
+	for i := range 100_000 {
+		if i%2 == 0 {
+			evens = append(evens, strconv.Itoa(i))
+		}
+		if i%3 == 0 {
+			threes = append(threes, strconv.Itoa(i))
+		}
+	}
+	for i := range 60 {
+		small = append(small, strconv.Itoa(i)) // 10 multiples of six.
+	}
+	db.SAdd("evens", evens...)
+	db.SAdd("threes", threes...)
+	db.SAdd("small", small...)
+
+	for _, tc := range []struct {
+		limit int
+		keys  []string
+		want  int
+	}{
+		{0, []string{"evens", "threes"}, 16_667}, // Multiples of six below 100,000.
+		{0, []string{"evens", "threes", "small"}, 10},
+		{0, []string{"evens"}, 50_000},
+		{100, []string{"evens", "threes"}, 100}, // Stops at the limit.
+		{10, []string{"evens", "threes", "small"}, 10},
+		{11, []string{"evens", "threes", "small"}, 10}, // A limit past the count changes nothing.
+		{0, []string{"evens", "missing"}, 0},
+	} {
+		if n, err := db.SInterCard(tc.limit, tc.keys...); err != nil || n != tc.want {
+			t.Errorf("SInterCard(%d, %q) = %d, %v; want %d", tc.limit, tc.keys, n, err, tc.want)
+		}
+	}
+
+	db.Set("str", "x")
+	if _, err := db.SInterCard(0, "missing", "str"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("SInterCard with a string key: %v, want ErrWrongType", err)
+	}
+	if _, err := db.SInterCard(-1, "evens"); !errors.Is(err, ErrNegativeLimit) {
+		t.Errorf("SInterCard with a negative limit: %v, want ErrNegativeLimit", err)
+	}
+}
+
+func TestSRemAndSetAlgebra(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	db.SAdd("a", "1", "2", "3", "4")
+	db.SAdd("b", "3", "4", "5")
+	db.SAdd("c", "4", "6")
+
+	for _, tc := range []struct {
+		name string
+		op   func(keys ...string) ([]string, error)
+		keys []string
+		want []string
+	}{
+		{"SUnion", db.SUnion, []string{"a", "b", "c"}, []string{"1", "2", "3", "4", "5", "6"}},
+		{"SUnion with a missing key", db.SUnion, []string{"b", "missing"}, []string{"3", "4", "5"}},
+		{"SInter", db.SInter, []string{"a", "b", "c"}, []string{"4"}},
+		{"SInter of two", db.SInter, []string{"a", "b"}, []string{"3", "4"}},
+		{"SInter with a missing key", db.SInter, []string{"a", "missing"}, nil},
+		{"SDiff", db.SDiff, []string{"a", "b", "c"}, []string{"1", "2"}},
+		{"SDiff of one", db.SDiff, []string{"c"}, []string{"4", "6"}},
+		{"SDiff of a missing key", db.SDiff, []string{"missing", "a"}, nil},
+	} {
+		if got, err := tc.op(tc.keys...); err != nil || !slices.Equal(got, tc.want) {
+			t.Errorf("%s(%q) = %q, %v; want %q", tc.name, tc.keys, got, err, tc.want)
+		}
+	}
+
+	if n, err := db.SRem("a", "1", "missing", "1", 2); n != 2 || err != nil {
+		t.Errorf("SRem = %d, %v; want 2: members count by their string form", n, err)
+	}
+	if got, _ := db.SMembers("a"); len(got) != 2 {
+		t.Errorf("set after SRem = %q, want 3 and 4", got)
+	}
+	db.SRem("a", "3", "4")
+	if _, ok := db.Get("a"); ok {
+		t.Error("the emptied set survived SRem")
+	}
+	if n, err := db.SRem("a", "x"); n != 0 || err != nil {
+		t.Errorf("SRem on a missing key = %d, %v; want 0", n, err)
+	}
+
+	db.Set("str", "v")
+	for name, op := range map[string]func(keys ...string) ([]string, error){"SUnion": db.SUnion, "SInter": db.SInter, "SDiff": db.SDiff} {
+		if _, err := op("b", "str"); !errors.Is(err, ErrWrongType) {
+			t.Errorf("%s with a string: %v, want ErrWrongType", name, err)
+		}
+	}
+	if _, err := db.SRem("str", "v"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("SRem on a string: %v, want ErrWrongType", err)
+	}
+}
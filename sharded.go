@@ -0,0 +1,262 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"hash/maphash"
+	"io"
+	"slices"
+	"time"
+)
+
+// Sharded is one keyspace split into a fixed number of shards, each a full
+// DataBase with its own lock, so writes to keys in different shards do not
+// wait for each other and Set and Get scale across cores where a single
+// DataBase serializes every write. A key's shard is picked by hashing it,
+// or only its hash tag if it has one (see keySlot), so keys sharing a tag,
+// such as "{user:1}:name" and "{user:1}:mail", always share a shard.
+//
+// Sharded covers the plain key commands. Anything that needs one lock over
+// several keys, such as Multi, Eval, Rename or the list and set moves, runs
+// on Shard(key) with keys that share a hash tag, as Redis Cluster requires
+// of multi-key commands. Options apply to each shard alone: a memory
+// budget, for one, is a budget per shard. As with Databases, the shards
+// share their Pub/Sub channels.
+type Sharded struct {
+	shards []*DataBase
+	seed   maphash.Seed // Seeds the hash that picks a key's shard.
+}
+
+// NewSharded returns an empty keyspace of n shards, at least one, each
+// created by NewDataBase with opts.
+func NewSharded(n int, opts ...Option) *Sharded {
+	s := &Sharded{shards: make([]*DataBase, max(n, 1)), seed: maphash.MakeSeed()}
+	for i := range s.shards {
+		s.shards[i] = NewDataBase(opts...)
+		s.shards[i].pubsub = s.shards[0].pubsub // One set of channels for all.
+	}
+	return s
+}
+
+// Len returns the number of shards.
+func (s *Sharded) Len() int {
+	return len(s.shards)
+}
+
+// shardIndex returns the index of key's shard. It hashes with maphash
+// rather than the CRC-16 of keySlot, which would cost more than the rest
+// of a Get; placement only has to be stable for the life of the shards.
+func (s *Sharded) shardIndex(key string) int {
+	return int(maphash.String(s.seed, hashTag(key)) % uint64(len(s.shards)))
+}
+
+// Shard returns the shard that holds key, for commands Sharded does not
+// cover itself.
+func (s *Sharded) Shard(key string) *DataBase {
+	return s.shards[s.shardIndex(key)]
+}
+
+// Get returns the value of key, as DataBase.Get does.
+func (s *Sharded) Get(key string) (any, bool) {
+	return s.Shard(key).Get(key)
+}
+
+// Set stores value under key, as DataBase.Set does.
+func (s *Sharded) Set(key string, value any) error {
+	return s.Shard(key).Set(key, value)
+}
+
+// SetWithTTL stores value under key with a TTL, as DataBase.SetWithTTL
+// does.
+func (s *Sharded) SetWithTTL(key string, value any, ttl time.Duration) error {
+	return s.Shard(key).SetWithTTL(key, value, ttl)
+}
+
+// Delete removes key and reports whether it existed, as DataBase.Delete
+// does.
+func (s *Sharded) Delete(key string) bool {
+	return s.Shard(key).Delete(key)
+}
+
+// Exists returns how many of keys exist, counting a key named twice twice,
+// as DataBase.Exists does. Each shard is read under its own lock, so unlike
+// DataBase.Exists the count is not of one instant when the keys span
+// shards.
+func (s *Sharded) Exists(keys ...string) int {
+	n := 0
+	for i, group := range s.groupKeys(keys) {
+		if len(group) > 0 {
+			n += s.shards[i].Exists(group...)
+		}
+	}
+	return n
+}
+
+// groupKeys splits keys by shard, keeping their order within each.
+func (s *Sharded) groupKeys(keys []string) [][]string {
+	groups := make([][]string, len(s.shards))
+	for _, key := range keys {
+		i := s.shardIndex(key)
+		groups[i] = append(groups[i], key)
+	}
+	return groups
+}
+
+// MGet returns the values of keys in order, with nil for each key that
+// does not exist, as DataBase.MGet does. The shards the keys fall in are
+// read-locked together, in index order, so the values are a consistent
+// view across shards too.
+func (s *Sharded) MGet(keys ...string) []any {
+	groups := s.groupKeys(keys)
+	for i, group := range groups {
+		if len(group) > 0 {
+			s.shards[i].lock.RLock() // Lock in index order.
+		}
+	}
+	values := make([]any, len(keys))
+	found := make([]bool, len(keys))
+	for i, key := range keys {
+		db := s.Shard(key)
+		value, exists := db.data.get(key)
+		if !exists || db.isExpired(key, db.clock.Now()) {
+			continue // Expired keys read as missing; the sweeper removes them.
+		}
+		db.accessed(key)
+		values[i], found[i] = value, true
+	}
+	for i, group := range groups {
+		if len(group) > 0 {
+			s.shards[i].lock.RUnlock() // Release the read lock.
+		}
+	}
+	for i, ok := range found {
+		s.Shard(keys[i]).recordRead(ok)
+	}
+	return values
+}
+
+// MSet stores every pair, as DataBase.MSet does, and is as atomic when the
+// keys span shards: the shards they fall in are write-locked together, in
+// index order, and every shard's batch is checked before any is written,
+// so a refused pair leaves every shard unchanged. It returns ErrReadOnly
+// if any of those shards is read-only.
+func (s *Sharded) MSet(pairs map[string]any) error {
+	batches := make([]map[string]any, len(s.shards))
+	for key, value := range pairs {
+		i := s.shardIndex(key)
+		if batches[i] == nil {
+			batches[i] = make(map[string]any)
+		}
+		batches[i][key] = value
+	}
+	for i, batch := range batches {
+		if batch != nil {
+			s.shards[i].lock.Lock() // Lock in index order.
+			defer s.shards[i].unlock()
+		}
+	}
+	for i, batch := range batches {
+		if batch != nil && s.shards[i].readOnly {
+			return ErrReadOnly
+		}
+	}
+	for i, batch := range batches {
+		if batch == nil {
+			continue
+		}
+		if err := s.shards[i].msetCheck(batch); err != nil {
+			return err
+		}
+	}
+	for i, batch := range batches {
+		if batch != nil {
+			s.shards[i].msetApply(batch)
+		}
+	}
+	return nil
+}
+
+// SetDefaultTTL sets the default TTL of every shard, as
+// DataBase.SetDefaultTTL does.
+func (s *Sharded) SetDefaultTTL(ttl time.Duration) {
+	for _, db := range s.shards {
+		db.SetDefaultTTL(ttl)
+	}
+}
+
+// SetReadOnly makes every shard read-only or writable again, as
+// DataBase.SetReadOnly does.
+func (s *Sharded) SetReadOnly(readOnly bool) {
+	for _, db := range s.shards {
+		db.SetReadOnly(readOnly)
+	}
+}
+
+// Keys returns the live keys matching the glob pattern across every shard,
+// sorted, as DataBase.Keys does. Each shard is walked under its own read
+// lock in turn, so only one shard's writers are held off at a time.
+func (s *Sharded) Keys(pattern string) []string {
+	var keys []string
+	for _, db := range s.shards {
+		keys = append(keys, db.Keys(pattern)...)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// FlushAll deletes every key in every shard and returns how many live keys
+// were removed, as DataBase.FlushAll does.
+func (s *Sharded) FlushAll() int {
+	n := 0
+	for _, db := range s.shards {
+		n += db.FlushAll()
+	}
+	return n
+}
+
+// Archive writes every shard to w as one keyspace in the format of
+// DataBase.Archive, so the archive can be restored into a DataBase, or
+// into a Sharded with a different number of shards. Each shard is read
+// under its own lock in turn, so unlike DataBase.Archive the archive is
+// not of one instant.
+func (s *Sharded) Archive(w io.Writer) error {
+	return writeArchive(w, s.shards, false)
+}
+
+// Restore merges the keys of an archive into their shards, as
+// DataBase.Restore does into a single database, whatever the number of
+// shards the archive was written with. Nothing is restored if the archive
+// is corrupt; shards that are read-only keep their keys and the error is
+// returned once the others are restored.
+func (s *Sharded) Restore(r io.Reader) error {
+	loaded, err := readArchive(r)
+	if err != nil {
+		return err
+	}
+	batches := make([]map[string]snapshotEntry, len(s.shards))
+	for key, entry := range loaded[0] {
+		i := s.shardIndex(key)
+		if batches[i] == nil {
+			batches[i] = make(map[string]snapshotEntry)
+		}
+		batches[i][key] = entry
+	}
+	var errs []error
+	for i, batch := range batches {
+		if batch == nil {
+			continue
+		}
+		if err := s.shards[i].merge(batch); err != nil {
+			errs = append(errs, fmt.Errorf("archive: shard %d: %w", i, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close closes every shard.
+func (s *Sharded) Close() error {
+	for _, db := range s.shards {
+		db.Close()
+	}
+	return nil
+}
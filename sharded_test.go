@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"maps"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestShardedRoutesKeys(t *testing.T) {
+	s := NewSharded(8)
+	defer s.Close()
+	for i := range 100 {
+		s.Set(fmt.Sprintf("key%d", i), i)
+	}
+	used := 0
+	for _, db := range s.shards {
+		if n := len(db.Keys("*")); n > 0 {
+			used++
+		}
+	}
+	if used < 2 {
+		t.Errorf("100 keys fell in %d of 8 shards", used)
+	}
+	for i := range 100 {
+		key := fmt.Sprintf("key%d", i)
+		if value, ok := s.Shard(key).Get(key); !ok || value != i {
+			t.Fatalf("Shard(%s).Get = %v, %v; want %d", key, value, ok, i)
+		}
+	}
+	if got := len(s.Keys("*")); got != 100 {
+		t.Errorf("Keys = %d keys, want 100", got)
+	}
+	if s.Shard("{user:1}:name") != s.Shard("{user:1}:mail") {
+		t.Error("keys with the same hash tag are in different shards")
+	}
+	if n := s.Exists("key1", "key2", "key1", "missing"); n != 3 {
+		t.Errorf("Exists = %d, want 3", n)
+	}
+	if !s.Delete("key1") || s.Delete("key1") {
+		t.Error("Delete did not report the key existing exactly once")
+	}
+	if n := s.FlushAll(); n != 99 {
+		t.Errorf("FlushAll = %d, want 99", n)
+	}
+	one := NewSharded(0)
+	defer one.Close()
+	if one.Len() != 1 {
+		t.Error("NewSharded(0) has no shard")
+	}
+}
+
+func TestShardedMSetAtomic(t *testing.T) {
+	s := NewSharded(4)
+	defer s.Close()
+	for _, db := range s.shards {
+		db.SetPrefixPolicy("num:", Policy{Types: []string{"int"}})
+	}
+	pairs := map[string]any{}
+	for i := range 20 {
+		pairs[fmt.Sprintf("k%d", i)] = i
+	}
+	if err := s.MSet(pairs); err != nil {
+		t.Fatal(err)
+	}
+	keys := slices.Sorted(maps.Keys(pairs))
+	for i, value := range s.MGet(append(keys, "missing")...) {
+		if i == len(keys) {
+			if value != nil {
+				t.Errorf("MGet(missing) = %v, want nil", value)
+			}
+		} else if value != pairs[keys[i]] {
+			t.Errorf("MGet(%s) = %v, want %v", keys[i], value, pairs[keys[i]])
+		}
+	}
+
+	pairs["k0"], pairs["num:1"] = "changed", "not a number"
+	var policy *PolicyError
+	if err := s.MSet(pairs); !errors.As(err, &policy) {
+		t.Fatalf("MSet with a bad pair: %v, want a *PolicyError", err)
+	}
+	if value, _ := s.Get("k0"); value != 0 {
+		t.Errorf("k0 = %v after the refused MSet, want 0", value)
+	}
+
+	s.Shard("k0").SetReadOnly(true)
+	delete(pairs, "num:1")
+	if err := s.MSet(pairs); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("MSet with a read-only shard: %v, want ErrReadOnly", err)
+	}
+}
+
+func TestShardedArchive(t *testing.T) {
+	s := NewSharded(4)
+	defer s.Close()
+	for i := range 50 {
+		s.Set(fmt.Sprintf("key%d", i), int64(i))
+	}
+	var buf bytes.Buffer
+	if err := s.Archive(&buf); err != nil {
+		t.Fatal(err)
+	}
+	archive := buf.Bytes()
+
+	other := NewSharded(3) // A different shard count routes keys afresh.
+	defer other.Close()
+	if err := other.Restore(bytes.NewReader(archive)); err != nil {
+		t.Fatal(err)
+	}
+	db := NewDataBase()
+	defer db.Close()
+	if err := db.Restore(bytes.NewReader(archive)); err != nil {
+		t.Fatal(err)
+	}
+	for i := range 50 {
+		key := fmt.Sprintf("key%d", i)
+		if value, ok := other.Shard(key).Get(key); !ok || value != int64(i) {
+			t.Errorf("restored Sharded: %s = %v, %v", key, value, ok)
+		}
+		if value, ok := db.Get(key); !ok || value != int64(i) {
+			t.Errorf("restored DataBase: %s = %v, %v", key, value, ok)
+		}
+	}
+}
+
+func TestShardedConcurrentWrites(t *testing.T) {
+	s := NewSharded(8)
+	defer s.Close()
+	var wg sync.WaitGroup
+	for w := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 500 {
+				key := fmt.Sprintf("w%d:%d", w, i)
+				s.Set(key, i)
+				s.MSet(map[string]any{key + "a": i, key + "b": i})
+				s.MGet(key, key+"a", key+"b")
+			}
+		}()
+	}
+	wg.Wait()
+	if got := len(s.Keys("*")); got != 8*500*3 {
+		t.Errorf("Keys = %d keys, want %d", got, 8*500*3)
+	}
+}
+
+// benchmarkStore runs a parallel mix of Set and Get on 10,000 keys, one op
+// in writeEvery a write. A single DataBase serializes the writes
+// on one lock; a Sharded takes only the lock of the key's shard, so it
+// pulls ahead as GOMAXPROCS grows (run with -cpu 1,4,8). On one core
+// the two are close, Sharded paying only for the routing.
+func benchmarkStore(b *testing.B, set func(string, any) error, get func(string) (any, bool), writeEvery int) {
+	keys := make([]string, 10_000)
+	for i := range keys {
+		keys[i] = "key:" + strconv.Itoa(i)
+		set(keys[i], i)
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := rand.IntN(len(keys)) // Each goroutine starts on its own key.
+		for pb.Next() {
+			key := keys[i%len(keys)]
+			if i%writeEvery == 0 {
+				set(key, i)
+			} else {
+				get(key)
+			}
+			i++
+		}
+	})
+}
+
+func BenchmarkParallelSet(b *testing.B) {
+	b.Run("single", func(b *testing.B) {
+		db := NewDataBase()
+		defer db.Close()
+		benchmarkStore(b, db.Set, db.Get, 1)
+	})
+	b.Run("sharded16", func(b *testing.B) {
+		s := NewSharded(16)
+		defer s.Close()
+		benchmarkStore(b, s.Set, s.Get, 1)
+	})
+}
+
+func BenchmarkParallelMixed(b *testing.B) {
+	b.Run("single", func(b *testing.B) {
+		db := NewDataBase()
+		defer db.Close()
+		benchmarkStore(b, db.Set, db.Get, 10)
+	})
+	b.Run("sharded16", func(b *testing.B) {
+		s := NewSharded(16)
+		defer s.Close()
+		benchmarkStore(b, s.Set, s.Get, 10)
+	})
+}
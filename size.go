@@ -0,0 +1,71 @@
+package main
+
+import "reflect"
+
+// valueSize estimates the payload size of a value in bytes: the length of
+// strings and byte slices, the width of numbers, and the recursive sum of
+// the elements (and keys) of containers. It ignores Go's per-object
+// overheads, so it is a lower bound useful for limits, not an exact count.
+func valueSize(value any) int {
+	switch v := value.(type) {
+	case nil:
+		return 0
+	case string:
+		return len(v)
+	case []byte:
+		return len(v)
+	case *compressedValue:
+		return len(v.data) // What it costs while compressed.
+	case Set:
+		n := 0
+		for m := range v {
+			n += len(m)
+		}
+		return n
+	case *ZSet:
+		n := 0
+		for m := range v.all() {
+			n += len(m.Member) + 8 // Member plus its float64 score.
+		}
+		return n
+	}
+	return reflectSize(reflect.ValueOf(value))
+}
+
+// reflectSize implements valueSize for arbitrary values.
+func reflectSize(v reflect.Value) int {
+	switch v.Kind() {
+	case reflect.String:
+		return v.Len()
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return v.Len() // Byte slices and arrays count their length.
+		}
+		n := 0
+		for i := 0; i < v.Len(); i++ {
+			n += reflectSize(v.Index(i))
+		}
+		return n
+	case reflect.Map:
+		n := 0
+		iter := v.MapRange()
+		for iter.Next() {
+			n += reflectSize(iter.Key()) + reflectSize(iter.Value())
+		}
+		return n
+	case reflect.Interface, reflect.Pointer:
+		if v.IsNil() {
+			return 0
+		}
+		return reflectSize(v.Elem())
+	case reflect.Struct:
+		n := 0
+		for i := 0; i < v.NumField(); i++ {
+			n += reflectSize(v.Field(i))
+		}
+		return n
+	case reflect.Invalid:
+		return 0
+	}
+	return int(v.Type().Size()) // Numbers, bools and other fixed-size values.
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// ClusterSlots is the number of hash slots keys are spread over, as in
+// Redis Cluster.
+const ClusterSlots = 16384
+
+// crc16 computes the CRC-16/XMODEM checksum Redis Cluster uses for slots
+// (polynomial 0x1021, initial value 0).
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for bit := 0; bit < 8; bit++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// keySlot maps a key to its hash slot. If the key contains a hash tag, a
+// non-empty substring between the first '{' and the next '}', only the tag
+// is hashed, which lets related keys such as "{user:1}:name" and
+// "{user:1}:mail" share a slot.
+func keySlot(key string) int {
+	return int(crc16(hashTag(key))) % ClusterSlots
+}
+
+// hashTag returns the part of key that is hashed to place it: its hash tag
+// if it has one, or else the whole key.
+func hashTag(key string) string {
+	if open := strings.IndexByte(key, '{'); open >= 0 {
+		if end := strings.IndexByte(key[open+1:], '}'); end > 0 {
+			return key[open+1 : open+1+end]
+		}
+	}
+	return key
+}
+
+// KeySlot returns the Redis Cluster hash slot of key, in [0, ClusterSlots),
+// honouring hash tags exactly as Redis CLUSTER KEYSLOT does. The key need not
+// exist.
+func (db *DataBase) KeySlot(key string) int {
+	return keySlot(key)
+}
+
+// SlotKeys returns, in sorted order, the live keys that hash to slot. It
+// examines every key, so it is meant for resharding tools rather than for
+// the request path. Slots outside [0, ClusterSlots) hold no keys.
+func (db *DataBase) SlotKeys(slot int) []string {
+	db.lock.RLock()         // Acquire a read lock.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+
+	var keys []string
+	now := db.clock.Now()
+	for key := range db.data.all() {
+		if keySlot(key) == slot && !db.isExpired(key, now) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
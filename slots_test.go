@@ -0,0 +1,51 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestKeySlot(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	for key, want := range map[string]int{
+		"foo":       12182, // Values from Redis CLUSTER KEYSLOT.
+		"bar":       5061,
+		"hello":     866,
+		"somekey":   11058,
+		"123456789": 0x31C3 % ClusterSlots, // The CRC-16/XMODEM check value.
+		"":          0,
+	} {
+		if got := db.KeySlot(key); got != want {
+			t.Errorf("KeySlot(%q) = %d, want %d", key, got, want)
+		}
+	}
+
+	for _, tc := range []struct{ key, hashed string }{
+		{"{user1000}.following", "user1000"},
+		{"{user1000}.followers", "user1000"},
+		{"foo{}{bar}", "foo{}{bar}"},   // An empty tag hashes the whole key.
+		{"foo{{bar}}zap", "{bar"},      // The tag ends at the first '}'.
+		{"foo{bar}{zap}", "bar"},       // Only the first tag counts.
+		{"no}tag{here", "no}tag{here"}, // A '}' before the '{' is not a tag.
+	} {
+		if got, want := db.KeySlot(tc.key), db.KeySlot(tc.hashed); got != want {
+			t.Errorf("KeySlot(%q) = %d, want the slot of %q, %d", tc.key, got, tc.hashed, want)
+		}
+	}
+}
+
+func TestSlotKeys(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	for _, key := range []string{"{user:1}:name", "{user:1}:mail", "user:1", "{user:2}:name"} {
+		db.Set(key, 1)
+	}
+	slot := db.KeySlot("user:1")
+	if got, want := db.SlotKeys(slot), []string{"user:1", "{user:1}:mail", "{user:1}:name"}; !slices.Equal(got, want) {
+		t.Errorf("SlotKeys(%d) = %q, want %q", slot, got, want)
+	}
+	if got := db.SlotKeys(ClusterSlots); len(got) != 0 {
+		t.Errorf("SlotKeys(ClusterSlots) = %q, want none", got)
+	}
+}
@@ -0,0 +1,479 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StartupConfig holds everything needed to run a database and its server
+// without code changes: the runtime Config plus the settings that only
+// take effect at startup. ParseConfigFile reads one from a redis.conf-style
+// file, and NewDataBaseWithConfig starts a database from it.
+type StartupConfig struct {
+	Config // Settings that Reconfigure can change later.
+
+	Addr     string    // Address the server listens on, e.g. ":6379"; empty for no server.
+	Password string    // Required with AUTH when set, as ServerConfig.Password.
+	Users    []ACLUser // Named users with restricted access, as ServerConfig.Users.
+
+	SnapshotFile string     // Snapshot loaded at startup and written by automatic saves.
+	Save         []SaveRule // When to save automatically, as SaveRules; none turns saving off.
+
+	AppendOnly  bool        // Log every change to AppendFile, replaying it at startup.
+	AppendFile  string      // The append-only file.
+	AppendFsync FsyncPolicy // When the append-only file is synced to disk.
+
+	AtRest AtRestConfig // Compression and encryption of both files, as WithAtRest.
+
+	LogLevel slog.Level // Least severe level logged to standard error.
+
+	TLS            *tls.Config // Server TLS, as ServerConfig.TLS; nil for plain TCP.
+	ReplicationTLS *tls.Config // TLS to the primary, as WithReplicationTLS; nil for plain TCP.
+}
+
+// DefaultStartupConfig returns the settings a configuration file starts
+// from, which mirror the defaults of Redis where it has them: the standard
+// port, a dump.rdb-style snapshot saved after an hour and one change, five
+// minutes and 100 changes or a minute and 10000 changes, no append-only
+// file, and notice-level logging.
+func DefaultStartupConfig() StartupConfig {
+	return StartupConfig{
+		Config:       Config{EvictionPolicy: NoEviction, SweepInterval: defaultSweepInterval},
+		Addr:         ":6379",
+		SnapshotFile: "dump.gob",
+		Save: []SaveRule{
+			{After: time.Hour, Changes: 1},
+			{After: 5 * time.Minute, Changes: 100},
+			{After: time.Minute, Changes: 10000},
+		},
+		AppendFile:  "appendonly.aof",
+		AppendFsync: FsyncEverySec,
+		LogLevel:    slog.LevelInfo,
+	}
+}
+
+// ParseConfigFile reads a configuration file on top of
+// DefaultStartupConfig; see ParseConfig for the syntax.
+func ParseConfigFile(path string) (StartupConfig, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return StartupConfig{}, err
+	}
+	defer f.Close() // Ensure the file is closed after reading.
+	return ParseConfig(f)
+}
+
+// ParseConfig reads configuration directives on top of
+// DefaultStartupConfig, one per line in the syntax of redis.conf: a name
+// and its arguments separated by spaces, with quotes around arguments
+// containing spaces, and # starting a comment line. The directives are:
+//
+//	bind host              port n                requirepass password
+//	maxmemory 100mb        maxmemory-policy p    hz n
+//	default-ttl seconds    dbfilename file       save seconds changes [seconds changes ...]
+//	dir path               appendonly yes|no     appendfilename file
+//	appendfsync always|everysec|no               loglevel debug|verbose|notice|warning
+//	user name [on] >password [~pattern ...] [+command ...] [+@category ...] [allkeys] [allcommands]
+//	tls-cert-file file     tls-key-file file     tls-ca-cert-file file
+//	tls-auth-clients yes|no|optional             tls-replication yes|no
+//	file-compression gzip|no                     encryption-key-file file
+//
+// The save directives of a file replace the default rules and add up, as
+// in Redis, and save "" turns automatic saving off. dir is joined to the
+// snapshot and append-only file names given by relative paths. Otherwise a
+// later directive overrides an earlier one. An unknown directive or malformed argument is
+// reported with its line number in an error wrapping ErrInvalidConfig.
+// The TLS certificates are read once the whole file has been, and client
+// certificates are verified against tls-ca-cert-file unless
+// tls-auth-clients says otherwise, as in Redis. encryption-key-file names
+// a file holding the AES key of AtRest in hexadecimal, 32, 48 or 64 digits
+// on one line; it is read when the directive is.
+func ParseConfig(r io.Reader) (StartupConfig, error) {
+	cfg := DefaultStartupConfig()
+	st := configState{port: "6379"}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		fields, ok := configFields(line)
+		if !ok {
+			return StartupConfig{}, fmt.Errorf("%w: line %d: unbalanced quotes", ErrInvalidConfig, n)
+		}
+		name, args := strings.ToLower(fields[0]), fields[1:]
+		if err := cfg.apply(name, args, &st); err != nil {
+			return StartupConfig{}, fmt.Errorf("%w: line %d: %s: %v", ErrInvalidConfig, n, name, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return StartupConfig{}, err
+	}
+	cfg.Addr = net.JoinHostPort(st.host, st.port)
+	if st.dir != "" {
+		for _, name := range []*string{&cfg.SnapshotFile, &cfg.AppendFile} {
+			if !filepath.IsAbs(*name) {
+				*name = filepath.Join(st.dir, *name)
+			}
+		}
+	}
+	if err := cfg.loadTLS(st); err != nil {
+		return StartupConfig{}, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+	return cfg, nil
+}
+
+// configState gathers the directives that combine with others, for
+// ParseConfig to apply once the whole file is read.
+type configState struct {
+	host, port, dir string
+	saveSeen        bool // A save directive replaced the default rules.
+
+	tlsCert, tlsKey, tlsCA string // Files named by tls-cert-file, tls-key-file and tls-ca-cert-file.
+	tlsAuthClients         string // yes, no or optional.
+	tlsReplication         bool
+}
+
+// loadTLS reads the certificates the tls-* directives name and builds the
+// server's TLS configuration and, with tls-replication yes, the
+// replication link's, which presents the same certificate to the primary
+// and trusts the same authorities.
+func (cfg *StartupConfig) loadTLS(st configState) error {
+	if st.tlsCert == "" && st.tlsKey == "" {
+		if st.tlsCA != "" || st.tlsReplication {
+			return errors.New("tls directives need tls-cert-file and tls-key-file")
+		}
+		return nil
+	}
+	cert, err := tls.LoadX509KeyPair(st.tlsCert, st.tlsKey)
+	if err != nil {
+		return err
+	}
+	var pool *x509.CertPool // Nil trusts the system's authorities.
+	if st.tlsCA != "" {
+		pem, err := os.ReadFile(st.tlsCA)
+		if err != nil {
+			return err
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates in %s", st.tlsCA)
+		}
+	}
+	clientAuth := map[string]tls.ClientAuthType{
+		"": tls.RequireAndVerifyClientCert, "yes": tls.RequireAndVerifyClientCert, // Redis verifies by default.
+		"optional": tls.VerifyClientCertIfGiven, "no": tls.NoClientCert,
+	}[st.tlsAuthClients]
+	cfg.TLS = &tls.Config{Certificates: []tls.Certificate{cert}, ClientCAs: pool, ClientAuth: clientAuth, MinVersion: tls.VersionTLS12}
+	if st.tlsReplication {
+		cfg.ReplicationTLS = &tls.Config{Certificates: []tls.Certificate{cert}, RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+	return nil
+}
+
+// errConfigArgs reports a directive given the wrong number of arguments.
+var errConfigArgs = errors.New("wrong number of arguments")
+
+// apply sets the field a directive names. Directives that combine with
+// others, such as bind and port, are gathered in st instead.
+func (cfg *StartupConfig) apply(name string, args []string, st *configState) error {
+	if name == "save" {
+		return cfg.applySave(args, st)
+	}
+	if name == "user" {
+		user, err := parseACLRules(args)
+		if err != nil {
+			return err
+		}
+		cfg.Users = append(cfg.Users, user)
+		return nil
+	}
+	if len(args) != 1 {
+		return errConfigArgs
+	}
+	value := args[0]
+	switch name {
+	case "bind":
+		st.host = value
+	case "port":
+		if n, err := strconv.Atoi(value); err != nil || n < 0 || n > 65535 {
+			return fmt.Errorf("invalid port %q", value)
+		}
+		st.port = value
+	case "requirepass":
+		cfg.Password = value
+	case "dir":
+		st.dir = value
+	case "tls-cert-file":
+		st.tlsCert = value
+	case "tls-key-file":
+		st.tlsKey = value
+	case "tls-ca-cert-file":
+		st.tlsCA = value
+	case "tls-auth-clients":
+		switch v := strings.ToLower(value); v {
+		case "yes", "no", "optional":
+			st.tlsAuthClients = v
+		default:
+			return fmt.Errorf("expected yes, no or optional, got %q", value)
+		}
+	case "tls-replication":
+		on, err := parseYesNo(value)
+		if err != nil {
+			return err
+		}
+		st.tlsReplication = on
+	case "dbfilename":
+		cfg.SnapshotFile = value
+	case "appendfilename":
+		cfg.AppendFile = value
+	case "appendonly":
+		on, err := parseYesNo(value)
+		if err != nil {
+			return err
+		}
+		cfg.AppendOnly = on
+	case "appendfsync":
+		policy, ok := map[string]FsyncPolicy{"always": FsyncAlways, "everysec": FsyncEverySec, "no": FsyncNo}[strings.ToLower(value)]
+		if !ok {
+			return fmt.Errorf("unknown fsync policy %q", value)
+		}
+		cfg.AppendFsync = policy
+	case "file-compression":
+		compression, ok := map[string]Compression{"gzip": Gzip, "no": NoCompression}[strings.ToLower(value)]
+		if !ok {
+			return fmt.Errorf("expected gzip or no, got %q", value)
+		}
+		cfg.AtRest.Compression = compression
+	case "encryption-key-file":
+		key, err := readKeyFile(value)
+		if err != nil {
+			return err
+		}
+		cfg.AtRest.Key = key
+	case "loglevel":
+		level, ok := logLevels[strings.ToLower(value)]
+		if !ok {
+			return fmt.Errorf("unknown log level %q", value)
+		}
+		cfg.LogLevel = level
+	default:
+		param, ok := configParams[name] // The settings CONFIG SET also knows.
+		if !ok {
+			return errors.New("unknown directive")
+		}
+		if !param.set(&cfg.Config, value) {
+			return fmt.Errorf("invalid value %q", value)
+		}
+	}
+	return nil
+}
+
+// applySave adds the rules of a save directive, given as pairs of seconds
+// and changes, replacing the defaults on the first; save "" clears them.
+func (cfg *StartupConfig) applySave(args []string, st *configState) error {
+	if !st.saveSeen {
+		st.saveSeen = true
+		cfg.Save = nil // The file's rules replace the defaults.
+	}
+	if len(args) == 1 && args[0] == "" {
+		cfg.Save = nil // save "" disables saving.
+		return nil
+	}
+	if len(args) == 0 || len(args)%2 != 0 {
+		return errConfigArgs
+	}
+	for i := 0; i < len(args); i += 2 {
+		secs, err1 := strconv.Atoi(args[i])
+		changes, err2 := strconv.Atoi(args[i+1])
+		if err1 != nil || err2 != nil || secs < 0 || changes <= 0 {
+			return fmt.Errorf("invalid save rule %q %q", args[i], args[i+1])
+		}
+		cfg.Save = append(cfg.Save, SaveRule{After: time.Duration(secs) * time.Second, Changes: changes})
+	}
+	return nil
+}
+
+// readKeyFile reads the hexadecimal key named by encryption-key-file.
+func readKeyFile(path string) ([]byte, error) {
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(text)))
+	if err != nil {
+		return nil, fmt.Errorf("%s: key is not hexadecimal", path)
+	}
+	return key, nil
+}
+
+// parseYesNo parses the argument of a yes-or-no directive.
+func parseYesNo(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "yes":
+		return true, nil
+	case "no":
+		return false, nil
+	}
+	return false, fmt.Errorf("expected yes or no, got %q", value)
+}
+
+// parseACLRules reads a user directive's name and rules, in the syntax of
+// Redis ACL SETUSER, limited to granting: a password by >password, key
+// patterns by ~pattern or allkeys, and commands by +name, +@category or
+// allcommands. on is accepted and changes nothing.
+func parseACLRules(args []string) (ACLUser, error) {
+	if len(args) < 2 {
+		return ACLUser{}, errConfigArgs
+	}
+	user := ACLUser{Name: args[0]}
+	if user.Name == "default" {
+		return ACLUser{}, errors.New("the default user is configured with requirepass")
+	}
+	for _, rule := range args[1:] {
+		switch {
+		case rule == "on":
+		case rule == "allkeys":
+			user.Keys = append(user.Keys, "*")
+		case rule == "allcommands":
+			user.Commands = append(user.Commands, "@all")
+		case strings.HasPrefix(rule, ">"):
+			user.Password = rule[1:]
+		case strings.HasPrefix(rule, "~"):
+			user.Keys = append(user.Keys, rule[1:])
+		case strings.HasPrefix(rule, "+"):
+			user.Commands = append(user.Commands, rule[1:])
+		default:
+			return ACLUser{}, fmt.Errorf("unsupported ACL rule %q", rule)
+		}
+	}
+	if user.Password == "" {
+		return ACLUser{}, fmt.Errorf("user %q has no >password", user.Name)
+	}
+	return user, nil
+}
+
+// logLevels maps the Redis log levels, and the slog ones, to slog levels.
+var logLevels = map[string]slog.Level{
+	"debug": slog.LevelDebug, "verbose": slog.LevelDebug,
+	"notice": slog.LevelInfo, "info": slog.LevelInfo,
+	"warning": slog.LevelWarn, "warn": slog.LevelWarn,
+	"error": slog.LevelError,
+}
+
+// configFields splits a directive into words at spaces, treating text in
+// double or single quotes as one word; \" and \\ are escapes inside
+// double quotes. It reports false for an unclosed quote.
+func configFields(line string) ([]string, bool) {
+	var fields []string
+	for i := 0; i < len(line); {
+		if line[i] == ' ' || line[i] == '\t' {
+			i++
+			continue
+		}
+		var word strings.Builder
+		for i < len(line) && line[i] != ' ' && line[i] != '\t' {
+			quote := line[i]
+			if quote != '"' && quote != '\'' {
+				word.WriteByte(quote)
+				i++
+				continue
+			}
+			for i++; i < len(line) && line[i] != quote; i++ {
+				if quote == '"' && line[i] == '\\' && i+1 < len(line) {
+					i++ // Keep the escaped byte.
+				}
+				word.WriteByte(line[i])
+			}
+			if i == len(line) {
+				return nil, false
+			}
+			i++ // The closing quote.
+		}
+		fields = append(fields, word.String())
+	}
+	return fields, true
+}
+
+// NewDataBaseWithConfig starts a database as cfg describes: logging to
+// standard error at cfg.LogLevel, with the runtime settings applied,
+// the snapshot loaded if it exists, the append-only file replayed and
+// enabled if cfg.AppendOnly, and automatic saving to the snapshot by the
+// rules in cfg.Save. opts are applied after the options cfg
+// implies, so a WithLogger among them takes precedence. It does not start
+// the server; pass cfg.ServerConfig() to NewServer for that. On error,
+// nothing is left running.
+func NewDataBaseWithConfig(cfg StartupConfig, opts ...Option) (*DataBase, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: cfg.LogLevel}))
+	base := []Option{WithLogger(logger), WithSweepInterval(cfg.SweepInterval),
+		WithReplicationTLS(cfg.ReplicationTLS), WithAtRest(cfg.AtRest)}
+	db := NewDataBase(append(base, opts...)...)
+	if err := db.startFromConfig(cfg); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// startFromConfig applies the settings of a new database's StartupConfig.
+func (db *DataBase) startFromConfig(cfg StartupConfig) error {
+	if err := db.Reconfigure(cfg.Config); err != nil {
+		return err
+	}
+	if cfg.SnapshotFile != "" {
+		switch err := db.load(context.Background(), cfg.SnapshotFile, nil); {
+		case err == nil:
+			db.logger.Info("snapshot loaded", "file", cfg.SnapshotFile)
+		case !errors.Is(err, fs.ErrNotExist):
+			return err // A missing snapshot is a fresh start; a broken one is not.
+		}
+	}
+	if cfg.AppendOnly {
+		if err := db.EnableAOF(cfg.AppendFile, cfg.AppendFsync); err != nil {
+			return err // The log, replayed on top, holds the newest writes.
+		}
+	}
+	db.SaveRules(cfg.SnapshotFile, cfg.Save...)
+	return nil
+}
+
+// validate checks a StartupConfig for NewDataBaseWithConfig.
+func (cfg StartupConfig) validate() error {
+	if err := cfg.Config.validate(); err != nil {
+		return err
+	}
+	if err := cfg.AtRest.Validate(); err != nil {
+		return err
+	}
+	switch {
+	case len(cfg.Save) > 0 && cfg.SnapshotFile == "":
+		return fmt.Errorf("%w: saving is on but no snapshot file is set", ErrInvalidConfig)
+	case cfg.AppendOnly && cfg.AppendFile == "":
+		return fmt.Errorf("%w: appendonly is on but no append-only file is set", ErrInvalidConfig)
+	case cfg.AppendFsync < FsyncEverySec || cfg.AppendFsync > FsyncNo:
+		return fmt.Errorf("%w: unknown fsync policy %d", ErrInvalidConfig, int(cfg.AppendFsync))
+	}
+	return nil
+}
+
+// ServerConfig returns the server settings of cfg, for NewServer.
+func (cfg StartupConfig) ServerConfig() ServerConfig {
+	return ServerConfig{Addr: cfg.Addr, Password: cfg.Password, Users: cfg.Users, TLS: cfg.TLS}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseConfig(t *testing.T) {
+	cfg, err := ParseConfig(strings.NewReader(`
+# A comment, then blank lines.
+
+bind 127.0.0.1
+port 7000
+requirepass "pass word"
+maxmemory 100mb
+maxmemory-policy allkeys-lru
+hz 20
+default-ttl 60
+dir /var/data
+dbfilename snap.gob
+appendonly yes
+appendfilename /abs/log.aof
+appendfsync always
+loglevel warning
+save 900 1
+save 60 1000 30 5000
+user app on >secret ~app:* +@read +set
+`))
+	if err != nil {
+		t.Fatalf("ParseConfig: %v", err)
+	}
+	want := DefaultStartupConfig()
+	want.Config = Config{MaxMemory: 100 << 20, EvictionPolicy: AllKeysLRU, SweepInterval: 50 * time.Millisecond, DefaultTTL: time.Minute}
+	want.Addr = "127.0.0.1:7000"
+	want.Password = "pass word"
+	want.SnapshotFile = filepath.Join("/var/data", "snap.gob")
+	want.AppendOnly = true
+	want.AppendFile = "/abs/log.aof" // Absolute, so dir leaves it alone.
+	want.AppendFsync = FsyncAlways
+	want.LogLevel = slog.LevelWarn
+	want.Save = []SaveRule{{After: 900 * time.Second, Changes: 1}, {After: time.Minute, Changes: 1000}, {After: 30 * time.Second, Changes: 5000}}
+	want.Users = []ACLUser{{Name: "app", Password: "secret", Keys: []string{"app:*"}, Commands: []string{"@read", "set"}}}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("ParseConfig =\n%+v\nwant\n%+v", cfg, want)
+	}
+
+	empty, err := ParseConfig(strings.NewReader(""))
+	if err != nil || !reflect.DeepEqual(empty, DefaultStartupConfig()) {
+		t.Errorf("ParseConfig of an empty file = %+v, %v; want the defaults", empty, err)
+	}
+}
+
+func TestParseConfigOverrides(t *testing.T) {
+	cfg, err := ParseConfig(strings.NewReader(`
+port 7000
+port 7001
+maxmemory 1mb
+maxmemory 2mb
+loglevel debug
+loglevel notice
+save 60 1
+save ""
+`))
+	if err != nil {
+		t.Fatalf("ParseConfig: %v", err)
+	}
+	if cfg.Addr != ":7001" {
+		t.Errorf("Addr = %q, want the later port", cfg.Addr)
+	}
+	if cfg.MaxMemory != 2<<20 {
+		t.Errorf("MaxMemory = %d, want the later 2mb", cfg.MaxMemory)
+	}
+	if cfg.LogLevel != slog.LevelInfo {
+		t.Errorf("LogLevel = %v, want the later notice", cfg.LogLevel)
+	}
+	if cfg.Save != nil {
+		t.Errorf("Save = %v, want none after save \"\"", cfg.Save)
+	}
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name, file, want string
+	}{
+		{"unknown directive", "port 6380\nno-such-thing yes", "line 2: no-such-thing: unknown directive"},
+		{"bad port", "port 70000", "invalid port"},
+		{"bad memory", "maxmemory lots", `invalid value "lots"`},
+		{"bad policy", "maxmemory-policy sometimes", "invalid value"},
+		{"bad hz", "hz 0", "invalid value"},
+		{"bad yes or no", "appendonly maybe", "expected yes or no"},
+		{"bad fsync", "appendfsync sometimes", "unknown fsync policy"},
+		{"bad log level", "loglevel loud", "unknown log level"},
+		{"odd save", "save 60", "wrong number of arguments"},
+		{"bad save", "save 60 zero", "invalid save rule"},
+		{"missing argument", "requirepass", "wrong number of arguments"},
+		{"extra argument", "dbfilename a b", "wrong number of arguments"},
+		{"unbalanced quotes", `requirepass "open`, "line 1: unbalanced quotes"},
+		{"user without password", "user app ~* +@all", "no >password"},
+		{"default user", "user default >pw", "requirepass"},
+		{"bad ACL rule", "user app >pw -get", "unsupported ACL rule"},
+		{"tls without a certificate", "tls-replication yes", "need tls-cert-file"},
+		{"encryption key missing", "encryption-key-file /no/such/key", "no such file"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParseConfig(strings.NewReader(tc.file))
+			if !errors.Is(err, ErrInvalidConfig) || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("ParseConfig(%q) = %v, want an ErrInvalidConfig containing %q", tc.file, err, tc.want)
+			}
+		})
+	}
+	if _, err := ParseConfigFile(filepath.Join(t.TempDir(), "missing.conf")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("ParseConfigFile of a missing file: %v, want ErrNotExist", err)
+	}
+}
+
+func TestNewDataBaseWithConfig(t *testing.T) {
+	dir := t.TempDir()
+	snapshot := filepath.Join(dir, "dump.gob")
+	seed := NewDataBase()
+	seed.Set("seeded", "yes")
+	if err := seed.Persist(snapshot); err != nil {
+		t.Fatalf("Persist: %v", err)
+	}
+	seed.Close()
+
+	path := filepath.Join(dir, "redis.conf")
+	conf := "dir " + dir + "\nmaxmemory 1mb\ndefault-ttl 30\nappendonly yes\nsave 3600 1\n"
+	if err := os.WriteFile(path, []byte(conf), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := ParseConfigFile(path)
+	if err != nil {
+		t.Fatalf("ParseConfigFile: %v", err)
+	}
+	var log lockedBuffer
+	db, err := NewDataBaseWithConfig(cfg, WithLogger(slog.New(slog.NewTextHandler(&log, nil))))
+	if err != nil {
+		t.Fatalf("NewDataBaseWithConfig: %v", err)
+	}
+	defer db.Close()
+	if value, _ := db.Get("seeded"); value != "yes" {
+		t.Errorf("seeded = %v, want the snapshot loaded", value)
+	}
+	if got := db.Config(); got.MaxMemory != 1<<20 || got.DefaultTTL != 30*time.Second {
+		t.Errorf("Config = %+v, want the file's maxmemory and default-ttl", got)
+	}
+	if !strings.Contains(log.String(), "snapshot loaded") {
+		t.Errorf("log = %q, want the startup logged to the WithLogger given, which overrides the config's", log.String())
+	}
+	if _, err := os.Stat(filepath.Join(dir, "appendonly.aof")); err != nil {
+		t.Errorf("append-only file: %v, want it created inside dir", err)
+	}
+
+	broken := DefaultStartupConfig()
+	broken.SnapshotFile = ""
+	if _, err := NewDataBaseWithConfig(broken); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("NewDataBaseWithConfig with save rules and no snapshot: %v, want ErrInvalidConfig", err)
+	}
+	if cfg := cfg.ServerConfig(); cfg.Addr != ":6379" {
+		t.Errorf("ServerConfig().Addr = %q, want the default", cfg.Addr)
+	}
+}
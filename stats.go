@@ -0,0 +1,45 @@
+package main
+
+import "expvar"
+
+// Stats is a point-in-time summary of the database's activity counters.
+type Stats struct {
+	Hits      uint64 // Get, GetCopy and GetString calls that found their key.
+	Misses    uint64 // Such calls that did not.
+	Keys      int    // Keys currently stored, including expired ones not yet removed.
+	Evictions uint64 // Keys evicted to stay under the memory budget (see SetMaxMemory).
+}
+
+// Stats returns the current activity counters.
+func (db *DataBase) Stats() Stats {
+	db.lock.RLock()         // Acquire a read lock.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+	return Stats{
+		Hits:      db.hits.Load(),
+		Misses:    db.misses.Load(),
+		Keys:      db.data.len(),
+		Evictions: db.evictions,
+	}
+}
+
+// recordRead counts a key read as a hit or a miss.
+func (db *DataBase) recordRead(found bool) {
+	if found {
+		db.hits.Add(1)
+	} else {
+		db.misses.Add(1)
+	}
+}
+
+// PublishExpvar registers the Stats counters as expvar variables named
+// prefix followed by "hits", "misses", "keys" and "evictions", so they are
+// served at /debug/vars by any HTTP server using the default mux. Each
+// variable is read when expvar is queried, so it always shows the live
+// value. Like expvar.Publish, it panics if a name is already registered, so
+// use a distinct prefix per database, such as "cache.".
+func (db *DataBase) PublishExpvar(prefix string) {
+	expvar.Publish(prefix+"hits", expvar.Func(func() any { return db.Stats().Hits }))
+	expvar.Publish(prefix+"misses", expvar.Func(func() any { return db.Stats().Misses }))
+	expvar.Publish(prefix+"keys", expvar.Func(func() any { return db.Stats().Keys }))
+	expvar.Publish(prefix+"evictions", expvar.Func(func() any { return db.Stats().Evictions }))
+}
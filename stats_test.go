@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+// expvarRuns numbers the prefixes of TestPublishExpvar, as expvar names
+// can be published only once and -count may run it again.
+var expvarRuns atomic.Int32
+
+func TestPublishExpvar(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	prefix := "test" + strconv.Itoa(int(expvarRuns.Add(1))) + "."
+	db.PublishExpvar(prefix)
+	db.Set("a", 1)
+	db.Set("b", 2)
+	db.Get("a")
+	db.Get("a")
+	db.Get("missing")
+
+	for name, want := range map[string]string{"hits": "2", "misses": "1", "keys": "2", "evictions": "0"} {
+		v := expvar.Get(prefix + name)
+		if v == nil {
+			t.Fatalf("%s%s is not published", prefix, name)
+		}
+		if got := v.String(); got != want {
+			t.Errorf("%s%s = %s, want %s", prefix, name, got, want)
+		}
+	}
+
+	db.Get("b") // The variables are live.
+	db.Delete("a")
+	rec := httptest.NewRecorder()
+	expvar.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/vars", nil))
+	var vars map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &vars); err != nil {
+		t.Fatal(err)
+	}
+	if vars[prefix+"hits"] != 3.0 || vars[prefix+"keys"] != 1.0 {
+		t.Errorf("/debug/vars shows hits %v and keys %v, want 3 and 1", vars[prefix+"hits"], vars[prefix+"keys"])
+	}
+}
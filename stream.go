@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// StreamID identifies a stream entry: the millisecond it was added and a
+// sequence number within that millisecond, written "ms-seq" as in Redis.
+type StreamID struct {
+	Ms  uint64
+	Seq uint64
+}
+
+// String formats the ID as "ms-seq".
+func (id StreamID) String() string {
+	return fmt.Sprintf("%d-%d", id.Ms, id.Seq)
+}
+
+// less orders IDs by time, then by sequence.
+func (id StreamID) less(other StreamID) bool {
+	return id.Ms < other.Ms || (id.Ms == other.Ms && id.Seq < other.Seq)
+}
+
+// StreamEntry is one record of a stream.
+type StreamEntry struct {
+	ID     StreamID
+	Fields map[string]any
+}
+
+// Stream is the value stored under a key holding an append-only log, kept
+// as a slice of entries in ID order.
+type Stream struct {
+	Entries []StreamEntry
+	LastID  StreamID                // The highest ID ever added, kept even if entries go.
+	Groups  map[string]*StreamGroup // Consumer groups by name; nil if none (see XGroupCreate).
+}
+
+func init() {
+	gob.Register(&Stream{}) // Allow streams to be persisted inside the any-typed map.
+}
+
+// ErrNoFields is returned by XAdd for an entry without fields, which Redis
+// does not allow.
+var ErrNoFields = errors.New("ERR wrong number of arguments for 'xadd' command")
+
+// ErrInvalidStreamID is returned for a malformed stream ID or range bound.
+var ErrInvalidStreamID = errors.New("ERR Invalid stream ID specified as stream command argument")
+
+// deepCopy returns an independent copy, used by GetCopy.
+func (s *Stream) deepCopy() any {
+	c := &Stream{Entries: make([]StreamEntry, len(s.Entries)), LastID: s.LastID}
+	for i, e := range s.Entries {
+		c.Entries[i] = StreamEntry{e.ID, deepCopy(e.Fields).(map[string]any)}
+	}
+	if s.Groups != nil {
+		c.Groups = make(map[string]*StreamGroup, len(s.Groups))
+		for name, g := range s.Groups {
+			c.Groups[name] = &StreamGroup{LastDelivered: g.LastDelivered, Pending: slices.Clone(g.Pending)}
+		}
+	}
+	return c
+}
+
+// streamAt returns the stream stored at key, or nil if the key is absent.
+// It returns ErrWrongType if the key holds a different kind of value.
+// The caller must hold the lock.
+func (db *DataBase) streamAt(key string) (*Stream, error) {
+	value, exists := db.lookup(key)
+	if !exists {
+		return nil, nil
+	}
+	s, ok := value.(*Stream)
+	if !ok {
+		return nil, ErrWrongType
+	}
+	return s, nil
+}
+
+// XAdd appends an entry with the given fields to the stream at key,
+// creating the stream if needed, and returns the entry's ID. IDs are taken
+// from the clock in milliseconds, with a sequence number to tell apart
+// entries added in the same millisecond, and always increase, even if the
+// clock steps backwards. The fields are copied.
+func (db *DataBase) XAdd(key string, fields map[string]any) (string, error) {
+	if len(fields) == 0 {
+		return "", ErrNoFields
+	}
+	db.lock.Lock()    // Acquire a write lock.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	if db.readOnly {
+		return "", ErrReadOnly
+	}
+	db.expireIfNeeded(key)
+	if err := db.checkGrowth(); err != nil {
+		return "", err
+	}
+
+	s, err := db.streamAt(key)
+	if err != nil {
+		return "", err
+	}
+	if s == nil {
+		s = &Stream{} // The first entry creates the stream.
+		db.data.set(key, s)
+	}
+	db.cow(key) // Keep a running BGSave's view intact.
+
+	id := StreamID{Ms: uint64(db.clock.Now().UnixMilli())}
+	if !s.LastID.less(id) {
+		id = StreamID{s.LastID.Ms, s.LastID.Seq + 1} // Same or earlier millisecond.
+	}
+	s.Entries = append(s.Entries, StreamEntry{id, maps.Clone(fields)})
+	s.LastID = id
+	db.touch(key)
+	return id.String(), nil
+}
+
+// XRange returns the entries of the stream at key whose IDs lie between
+// start and end, inclusive, in ID order. Bounds are IDs of the form "ms-seq",
+// or just "ms" to cover all of a millisecond, and "-" and "+" stand for the
+// lowest and highest possible IDs. A missing key yields no entries. The
+// entries returned are copies.
+func (db *DataBase) XRange(key, start, end string) ([]StreamEntry, error) {
+	lo, err := parseStreamBound(start, false)
+	if err != nil {
+		return nil, err
+	}
+	hi, err := parseStreamBound(end, true)
+	if err != nil {
+		return nil, err
+	}
+
+	db.lock.RLock()         // Acquire a read lock.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+
+	s, err := db.streamAt(key)
+	if err != nil || s == nil {
+		return []StreamEntry{}, err
+	}
+	first := sort.Search(len(s.Entries), func(i int) bool { return !s.Entries[i].ID.less(lo) })
+	out := []StreamEntry{}
+	for _, e := range s.Entries[first:] {
+		if hi.less(e.ID) {
+			break
+		}
+		out = append(out, StreamEntry{e.ID, maps.Clone(e.Fields)})
+	}
+	return out, nil
+}
+
+// parseStreamBound parses an XRange bound. A bare millisecond stands for its
+// first sequence number at the start of a range and its last at the end.
+func parseStreamBound(s string, isEnd bool) (StreamID, error) {
+	switch s {
+	case "-":
+		return StreamID{}, nil
+	case "+":
+		return StreamID{math.MaxUint64, math.MaxUint64}, nil
+	}
+	msPart, seqPart, hasSeq := strings.Cut(s, "-")
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return StreamID{}, ErrInvalidStreamID
+	}
+	if !hasSeq {
+		if isEnd {
+			return StreamID{ms, math.MaxUint64}, nil
+		}
+		return StreamID{ms, 0}, nil
+	}
+	seq, err := strconv.ParseUint(seqPart, 10, 64)
+	if err != nil {
+		return StreamID{}, ErrInvalidStreamID
+	}
+	return StreamID{ms, seq}, nil
+}
+
+// XRead returns the entries added to each stream after the ID given for it
+// in streams, which maps keys to IDs, at most count per stream if count is
+// positive. The ID "$" stands for the stream's last ID, so only entries
+// added from now on are returned. Streams without new entries, including
+// missing keys, are left out of the result.
+//
+// If block is set and no stream has new entries, XRead waits until one
+// does or ctx is done, in which case it returns ctx's error. Without block,
+// an empty result is returned at once. The entries returned are copies.
+func (db *DataBase) XRead(ctx context.Context, count int, block bool, streams map[string]string) (map[string][]StreamEntry, error) {
+	after, err := db.streamPositions(streams)
+	if err != nil {
+		return nil, err
+	}
+	return db.awaitStreams(ctx, block, slices.Collect(maps.Keys(after)), func() (map[string][]StreamEntry, error) {
+		db.lock.RLock()         // Acquire a read lock.
+		defer db.lock.RUnlock() // Release the lock when the function exits.
+		out := make(map[string][]StreamEntry)
+		for key, id := range after {
+			s, err := db.streamAt(key)
+			if err != nil {
+				return nil, err
+			}
+			if s == nil {
+				continue
+			}
+			if entries := s.after(id, count); len(entries) > 0 {
+				out[key] = entries
+			}
+		}
+		return out, nil
+	})
+}
+
+// streamPositions parses the IDs of an XRead call, taking "$" as the
+// stream's last ID at the time of the call.
+func (db *DataBase) streamPositions(streams map[string]string) (map[string]StreamID, error) {
+	db.lock.RLock()         // Acquire a read lock.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+	after := make(map[string]StreamID, len(streams))
+	for key, id := range streams {
+		if id != "$" {
+			parsed, err := parseStreamBound(id, false)
+			if err != nil {
+				return nil, err
+			}
+			after[key] = parsed
+			continue
+		}
+		s, err := db.streamAt(key)
+		if err != nil {
+			return nil, err
+		}
+		if s != nil {
+			after[key] = s.LastID
+		} else {
+			after[key] = StreamID{} // A stream created later starts after 0-0.
+		}
+	}
+	return after, nil
+}
+
+// after returns copies of the entries with IDs above id, at most count of
+// them if count is positive.
+func (s *Stream) after(id StreamID, count int) []StreamEntry {
+	first := sort.Search(len(s.Entries), func(i int) bool { return id.less(s.Entries[i].ID) })
+	rest := s.Entries[first:]
+	if count > 0 && len(rest) > count {
+		rest = rest[:count]
+	}
+	out := make([]StreamEntry, len(rest))
+	for i, e := range rest {
+		out[i] = StreamEntry{e.ID, maps.Clone(e.Fields)}
+	}
+	return out
+}
+
+// awaitStreams calls read until it returns entries or an error, or, unless
+// block is set, just once. Between calls it waits for a write to one of
+// keys or for ctx to be done. It registers for the wake-up before the
+// first call, so an entry added in between is not missed.
+func (db *DataBase) awaitStreams(ctx context.Context, block bool, keys []string, read func() (map[string][]StreamEntry, error)) (map[string][]StreamEntry, error) {
+	if !block {
+		return read()
+	}
+	wake := db.waits.add(keys)
+	defer db.waits.remove(wake, keys)
+	for {
+		out, err := read()
+		if err != nil || len(out) > 0 {
+			return out, err
+		}
+		select {
+		case <-wake:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestXAddIDsIncrease(t *testing.T) {
+	clock := NewFakeClock(time.UnixMilli(1_000))
+	db := NewDataBase(WithClock(clock))
+	defer db.Close()
+	var ids []string
+	add := func() {
+		t.Helper()
+		id, err := db.XAdd("log", map[string]any{"n": len(ids)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	add()
+	add() // The same millisecond.
+	clock.Advance(time.Millisecond)
+	add()
+	clock.Advance(-time.Second) // The clock steps backwards.
+	add()
+	if want := []string{"1000-0", "1000-1", "1001-0", "1001-1"}; !slices.Equal(ids, want) {
+		t.Errorf("XAdd IDs = %q, want %q", ids, want)
+	}
+
+	if _, err := db.XAdd("log", nil); !errors.Is(err, ErrNoFields) {
+		t.Errorf("XAdd without fields: %v, want ErrNoFields", err)
+	}
+	db.Set("str", "x")
+	if _, err := db.XAdd("str", map[string]any{"a": 1}); !errors.Is(err, ErrWrongType) {
+		t.Errorf("XAdd to a string: %v, want ErrWrongType", err)
+	}
+	if _, err := db.XRange("str", "-", "+"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("XRange of a string: %v, want ErrWrongType", err)
+	}
+}
+
+func TestXRangeBounds(t *testing.T) {
+	clock := NewFakeClock(time.UnixMilli(1_000))
+	db := NewDataBase(WithClock(clock))
+	defer db.Close()
+	for i := range 3 {
+		db.XAdd("log", map[string]any{"n": i}) // 1000-0, 1000-1, 1000-2
+	}
+	clock.Advance(time.Millisecond)
+	db.XAdd("log", map[string]any{"n": 3}) // 1001-0
+
+	for _, tc := range []struct {
+		start, end string
+		want       []string
+	}{
+		{"-", "+", []string{"1000-0", "1000-1", "1000-2", "1001-0"}},
+		{"1000-1", "+", []string{"1000-1", "1000-2", "1001-0"}},
+		{"-", "1000-1", []string{"1000-0", "1000-1"}},
+		{"1000", "1000", []string{"1000-0", "1000-1", "1000-2"}}, // A bare millisecond covers all of it.
+		{"1001", "+", []string{"1001-0"}},
+		{"1000-2", "1000-2", []string{"1000-2"}},
+		{"1002", "+", []string{}},
+		{"+", "-", []string{}},
+	} {
+		entries, err := db.XRange("log", tc.start, tc.end)
+		if err != nil {
+			t.Fatalf("XRange(%s, %s): %v", tc.start, tc.end, err)
+		}
+		got := []string{}
+		for _, e := range entries {
+			got = append(got, e.ID.String())
+		}
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("XRange(%s, %s) = %q, want %q", tc.start, tc.end, got, tc.want)
+		}
+	}
+
+	entries, _ := db.XRange("log", "-", "-")
+	if len(entries) != 0 {
+		t.Errorf("XRange(-, -) = %v, want none", entries)
+	}
+	entries, _ = db.XRange("log", "1001-0", "+")
+	entries[0].Fields["n"] = "changed" // Entries returned are copies.
+	if again, _ := db.XRange("log", "1001-0", "+"); again[0].Fields["n"] != 3 {
+		t.Error("changing an entry XRange returned changed the stream")
+	}
+	if _, err := db.XRange("log", "abc", "+"); !errors.Is(err, ErrInvalidStreamID) {
+		t.Errorf("XRange with a bad bound: %v, want ErrInvalidStreamID", err)
+	}
+	if entries, err := db.XRange("missing", "-", "+"); err != nil || len(entries) != 0 {
+		t.Errorf("XRange of a missing key = %v, %v; want none", entries, err)
+	}
+}
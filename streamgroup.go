@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"time"
+)
+
+// StreamGroup is a consumer group of a stream: a cursor shared by its
+// consumers, so each entry is delivered to only one of them, and the
+// entries delivered but not yet acknowledged with XAck.
+type StreamGroup struct {
+	LastDelivered StreamID        // The highest ID delivered to any consumer.
+	Pending       []StreamPending // Unacknowledged deliveries, in ID order.
+}
+
+// StreamPending is a delivered entry awaiting acknowledgement.
+type StreamPending struct {
+	ID        StreamID
+	Consumer  string    // Who it was delivered to.
+	Delivered time.Time // When.
+}
+
+// Consumer group errors, worded as Redis words them.
+var (
+	ErrGroupExists = errors.New("BUSYGROUP Consumer Group name already exists")
+	ErrNoStream    = errors.New("ERR The XGROUP subcommand requires the key to exist. Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.")
+)
+
+// noGroupError reports a missing stream or group to XReadGroup.
+func noGroupError(key, group string) error {
+	return fmt.Errorf("NOGROUP No such key '%s' or consumer group '%s' in XREADGROUP with GROUP option", key, group)
+}
+
+// XGroupCreate creates the consumer group named group on the stream at key,
+// delivering the entries after start first: "$" for only those added from
+// now on, "0" for the whole stream. With mkStream a missing key becomes an
+// empty stream; otherwise it is ErrNoStream. A group that already exists is
+// ErrGroupExists.
+func (db *DataBase) XGroupCreate(key, group, start string, mkStream bool) error {
+	db.lock.Lock()    // Acquire a write lock.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	if db.readOnly {
+		return ErrReadOnly
+	}
+	db.expireIfNeeded(key)
+
+	s, err := db.streamAt(key)
+	if err != nil {
+		return err
+	}
+	if s == nil {
+		if !mkStream {
+			return ErrNoStream
+		}
+		if err := db.checkGrowth(); err != nil {
+			return err
+		}
+		s = &Stream{}
+		db.data.set(key, s)
+	}
+	if _, ok := s.Groups[group]; ok {
+		return ErrGroupExists
+	}
+	from := s.LastID
+	if start != "$" {
+		if from, err = parseStreamBound(start, false); err != nil {
+			return err
+		}
+	}
+	db.cow(key) // Keep a running BGSave's view intact.
+	if s.Groups == nil {
+		s.Groups = make(map[string]*StreamGroup)
+	}
+	s.Groups[group] = &StreamGroup{LastDelivered: from}
+	db.touch(key)
+	return nil
+}
+
+// XReadGroup reads the streams in streams, which maps keys to IDs, as
+// consumer of the consumer group named group, which must exist on every one
+// of them. The ID ">" asks for entries never delivered to the group, at most
+// count per stream if count is positive; they are added to the group's
+// pending entries, unless noAck is set, until acknowledged with XAck. Any
+// other ID asks for the consumer's own pending entries after it, so "0"
+// re-reads everything delivered to it but not acknowledged, as a consumer
+// restarting after a crash would. Pending entries since removed from the
+// stream are returned without fields.
+//
+// Streams read with ">" are left out of the result when nothing new is
+// available; if that is true of all of them and block is set, XReadGroup
+// waits until an entry is added or ctx is done, in which case it returns
+// ctx's error. The entries returned are copies.
+func (db *DataBase) XReadGroup(ctx context.Context, group, consumer string, count int, block, noAck bool, streams map[string]string) (map[string][]StreamEntry, error) {
+	history := make(map[string]StreamID, len(streams))
+	for key, id := range streams {
+		if id == ">" {
+			continue
+		}
+		parsed, err := parseStreamBound(id, false)
+		if err != nil {
+			return nil, err
+		}
+		history[key] = parsed
+	}
+	block = block && len(history) == 0 // Pending entries are all there is; waiting adds none.
+	return db.awaitStreams(ctx, block, slices.Collect(maps.Keys(streams)), func() (map[string][]StreamEntry, error) {
+		db.lock.Lock()    // Acquire a write lock.
+		defer db.unlock() // Release the lock and run expiry callbacks.
+		out := make(map[string][]StreamEntry)
+		for key := range streams {
+			db.expireIfNeeded(key)
+			s, err := db.streamAt(key)
+			if err != nil {
+				return nil, err
+			}
+			if s == nil || s.Groups[group] == nil {
+				return nil, noGroupError(key, group)
+			}
+			if after, ok := history[key]; ok {
+				out[key] = s.pendingOf(s.Groups[group], consumer, after, count)
+				continue
+			}
+			if db.readOnly {
+				return nil, ErrReadOnly // Delivery updates the group.
+			}
+			entries := s.after(s.Groups[group].LastDelivered, count)
+			if len(entries) == 0 {
+				continue
+			}
+			db.cow(key) // Keep a running BGSave's view intact.
+			g := s.Groups[group]
+			g.LastDelivered = entries[len(entries)-1].ID
+			if !noAck {
+				now := db.clock.Now()
+				for _, e := range entries {
+					g.Pending = append(g.Pending, StreamPending{e.ID, consumer, now})
+				}
+			}
+			db.touch(key)
+			out[key] = entries
+		}
+		return out, nil
+	})
+}
+
+// pendingOf returns copies of the entries pending for consumer in g with
+// IDs above after, at most count of them if count is positive.
+func (s *Stream) pendingOf(g *StreamGroup, consumer string, after StreamID, count int) []StreamEntry {
+	out := []StreamEntry{}
+	for _, p := range g.Pending {
+		if p.Consumer != consumer || !after.less(p.ID) {
+			continue
+		}
+		if count > 0 && len(out) == count {
+			break
+		}
+		e := StreamEntry{ID: p.ID}
+		i := sort.Search(len(s.Entries), func(i int) bool { return !s.Entries[i].ID.less(p.ID) })
+		if i < len(s.Entries) && s.Entries[i].ID == p.ID {
+			e.Fields = maps.Clone(s.Entries[i].Fields)
+		}
+		out = append(out, e)
+	}
+	return out
+}
+
+// XAck acknowledges entries delivered to the consumer group named group on
+// the stream at key, removing them from its pending entries, and returns how
+// many were pending. A missing key or group acknowledges nothing.
+func (db *DataBase) XAck(key, group string, ids ...string) (int, error) {
+	parsed := make([]StreamID, len(ids))
+	for i, id := range ids {
+		var err error
+		if parsed[i], err = parseStreamBound(id, false); err != nil {
+			return 0, err
+		}
+	}
+
+	db.lock.Lock()    // Acquire a write lock.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	if db.readOnly {
+		return 0, ErrReadOnly
+	}
+	db.expireIfNeeded(key)
+	s, err := db.streamAt(key)
+	if err != nil || s == nil || s.Groups[group] == nil {
+		return 0, err
+	}
+	db.cow(key) // Keep a running BGSave's view intact.
+	g := s.Groups[group]
+	before := len(g.Pending)
+	g.Pending = slices.DeleteFunc(g.Pending, func(p StreamPending) bool { return slices.Contains(parsed, p.ID) })
+	acked := before - len(g.Pending)
+	if acked > 0 {
+		db.touch(key)
+	}
+	return acked, nil
+}
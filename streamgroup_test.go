@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// groupIDs returns the IDs of the entries XReadGroup gave for key.
+func groupIDs(read map[string][]StreamEntry, key string) []string {
+	var ids []string
+	for _, e := range read[key] {
+		ids = append(ids, e.ID.String())
+	}
+	return ids
+}
+
+// pendingIDs returns the IDs pending for group on the stream at key.
+func pendingIDs(t *testing.T, db *DataBase, key, group string) []string {
+	t.Helper()
+	value, _ := db.Get(key)
+	var ids []string
+	for _, p := range value.(*Stream).Groups[group].Pending {
+		ids = append(ids, p.ID.String()+"@"+p.Consumer)
+	}
+	return ids
+}
+
+func TestXGroupCreate(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	if err := db.XGroupCreate("s", "g", "$", false); !errors.Is(err, ErrNoStream) {
+		t.Errorf("XGroupCreate on a missing key: %v, want ErrNoStream", err)
+	}
+	if err := db.XGroupCreate("s", "g", "$", true); err != nil {
+		t.Fatalf("XGroupCreate with MKSTREAM: %v", err)
+	}
+	if err := db.XGroupCreate("s", "g", "0", false); !errors.Is(err, ErrGroupExists) {
+		t.Errorf("XGroupCreate of an existing group: %v, want ErrGroupExists", err)
+	}
+	if err := db.XGroupCreate("s", "h", "not-an-id", false); err == nil {
+		t.Error("XGroupCreate with a malformed start ID succeeded")
+	}
+	db.Set("str", "v")
+	if err := db.XGroupCreate("str", "g", "$", false); !errors.Is(err, ErrWrongType) {
+		t.Errorf("XGroupCreate on a string: %v, want ErrWrongType", err)
+	}
+	ctx := context.Background()
+	if _, err := db.XReadGroup(ctx, "nope", "c", 0, false, false, map[string]string{"s": ">"}); err == nil || !strings.HasPrefix(err.Error(), "NOGROUP") {
+		t.Errorf("XReadGroup of a missing group: %v, want NOGROUP", err)
+	}
+
+	// "$" skips what is already there; "0" delivers it.
+	first, _ := db.XAdd("s", map[string]any{"n": 1})
+	db.XGroupCreate("s", "late", "$", false)
+	db.XGroupCreate("s", "all", "0", false)
+	if read, _ := db.XReadGroup(ctx, "late", "c", 0, false, false, map[string]string{"s": ">"}); len(read) != 0 {
+		t.Errorf("group created at $ read %v, want nothing", read)
+	}
+	if read, _ := db.XReadGroup(ctx, "all", "c", 0, false, false, map[string]string{"s": ">"}); !reflect.DeepEqual(groupIDs(read, "s"), []string{first}) {
+		t.Errorf("group created at 0 read %v, want %s", read, first)
+	}
+}
+
+func TestXReadGroupPendingAndAck(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	ctx := context.Background()
+	var ids []string
+	for i := range 4 {
+		id, _ := db.XAdd("s", map[string]any{"n": i})
+		ids = append(ids, id)
+	}
+	db.XGroupCreate("s", "g", "0", false)
+
+	// Each new entry goes to one consumer only.
+	a, _ := db.XReadGroup(ctx, "g", "alice", 2, false, false, map[string]string{"s": ">"})
+	b, _ := db.XReadGroup(ctx, "g", "bob", 0, false, false, map[string]string{"s": ">"})
+	if got := groupIDs(a, "s"); !reflect.DeepEqual(got, ids[:2]) {
+		t.Errorf("alice read %v, want %v", got, ids[:2])
+	}
+	if got := groupIDs(b, "s"); !reflect.DeepEqual(got, ids[2:]) {
+		t.Errorf("bob read %v, want %v", got, ids[2:])
+	}
+	if read, _ := db.XReadGroup(ctx, "g", "carol", 0, false, false, map[string]string{"s": ">"}); len(read) != 0 {
+		t.Errorf("carol read %v once everything was delivered, want nothing", read)
+	}
+	want := []string{ids[0] + "@alice", ids[1] + "@alice", ids[2] + "@bob", ids[3] + "@bob"}
+	if got := pendingIDs(t, db, "s", "g"); !reflect.DeepEqual(got, want) {
+		t.Errorf("pending = %v, want %v", got, want)
+	}
+
+	// A restarted consumer re-reads its own unacknowledged entries from 0.
+	history, _ := db.XReadGroup(ctx, "g", "alice", 0, false, false, map[string]string{"s": "0"})
+	if got := groupIDs(history, "s"); !reflect.DeepEqual(got, ids[:2]) {
+		t.Errorf("alice's redelivery = %v, want %v", got, ids[:2])
+	}
+	if fields := history["s"][0].Fields; !reflect.DeepEqual(fields, map[string]any{"n": 0}) {
+		t.Errorf("redelivered fields = %v, want n=0", fields)
+	}
+	if after, _ := db.XReadGroup(ctx, "g", "alice", 0, false, false, map[string]string{"s": ids[0]}); !reflect.DeepEqual(groupIDs(after, "s"), ids[1:2]) {
+		t.Errorf("alice's pending after %s = %v, want %v", ids[0], groupIDs(after, "s"), ids[1:2])
+	}
+
+	if n, err := db.XAck("s", "g", ids[0], ids[2], ids[0], "9-9"); n != 2 || err != nil {
+		t.Errorf("XAck = %d, %v; want the 2 pending entries", n, err)
+	}
+	if n, _ := db.XAck("s", "g", ids[0]); n != 0 {
+		t.Errorf("XAck of an acknowledged entry = %d, want 0", n)
+	}
+	if got := pendingIDs(t, db, "s", "g"); !reflect.DeepEqual(got, []string{ids[1] + "@alice", ids[3] + "@bob"}) {
+		t.Errorf("pending after XAck = %v", got)
+	}
+	history, _ = db.XReadGroup(ctx, "g", "alice", 0, false, false, map[string]string{"s": "0"})
+	if got := groupIDs(history, "s"); !reflect.DeepEqual(got, ids[1:2]) {
+		t.Errorf("alice's redelivery after XAck = %v, want %v", got, ids[1:2])
+	}
+	if n, err := db.XAck("missing", "g", ids[0]); n != 0 || err != nil {
+		t.Errorf("XAck on a missing key = %d, %v; want 0", n, err)
+	}
+	if _, err := db.XAck("s", "g", "bad"); err == nil {
+		t.Error("XAck of a malformed ID succeeded")
+	}
+
+	next, _ := db.XAdd("s", map[string]any{"n": 4})
+	read, _ := db.XReadGroup(ctx, "g", "dave", 0, false, true, map[string]string{"s": ">"})
+	if got := groupIDs(read, "s"); !reflect.DeepEqual(got, []string{next}) {
+		t.Errorf("NOACK read %v, want %s", got, next)
+	}
+	if got := pendingIDs(t, db, "s", "g"); len(got) != 2 {
+		t.Errorf("pending after a NOACK read = %v, want it unchanged", got)
+	}
+}
+
+func TestXReadGroupBlocks(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	db.XGroupCreate("s", "g", "$", true)
+	got := make(chan map[string][]StreamEntry, 1)
+	go func() {
+		read, err := db.XReadGroup(context.Background(), "g", "c", 0, true, false, map[string]string{"s": ">"})
+		if err != nil {
+			t.Errorf("XReadGroup: %v", err)
+		}
+		got <- read
+	}()
+	time.Sleep(20 * time.Millisecond) // Let the reader block.
+	id, _ := db.XAdd("s", map[string]any{"n": 1})
+	select {
+	case read := <-got:
+		if ids := groupIDs(read, "s"); !reflect.DeepEqual(ids, []string{id}) {
+			t.Errorf("blocked XReadGroup woke with %v, want %s", ids, id)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("XReadGroup did not wake for a new entry")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := db.XReadGroup(ctx, "g", "c", 0, true, false, map[string]string{"s": ">"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("XReadGroup past its deadline: %v, want DeadlineExceeded", err)
+	}
+}
+
+func TestServerConsumerGroups(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	c := dial(t, startServer(t, db, ServerConfig{}))
+	if reply := c.do(t, "XGROUP", "CREATE", "s", "g", "$", "MKSTREAM"); reply != "OK" {
+		t.Fatalf("XGROUP CREATE = %v, want OK", reply)
+	}
+	if reply, ok := c.do(t, "XGROUP", "CREATE", "s", "g", "$").(error); !ok || !strings.HasPrefix(reply.Error(), "BUSYGROUP") {
+		t.Errorf("XGROUP CREATE again = %v, want BUSYGROUP", reply)
+	}
+	id := c.do(t, "XADD", "s", "*", "f", "v").(string)
+	want := []any{[]any{"s", []any{[]any{id, []any{"f", "v"}}}}}
+	if reply := c.do(t, "XREADGROUP", "GROUP", "g", "c", "COUNT", "10", "STREAMS", "s", ">"); !reflect.DeepEqual(reply, want) {
+		t.Errorf("XREADGROUP = %v, want %v", reply, want)
+	}
+	if reply := c.do(t, "XREADGROUP", "GROUP", "g", "c", "BLOCK", "20", "STREAMS", "s", ">"); reply != nil {
+		t.Errorf("XREADGROUP BLOCK with nothing new = %v, want null", reply)
+	}
+	if reply := c.do(t, "XREADGROUP", "GROUP", "g", "c", "STREAMS", "s", "0"); !reflect.DeepEqual(reply, want) {
+		t.Errorf("XREADGROUP of the pending entries = %v, want %v", reply, want)
+	}
+	if reply := c.do(t, "XACK", "s", "g", id); reply != int64(1) {
+		t.Errorf("XACK = %v, want 1", reply)
+	}
+	if reply := c.do(t, "XREADGROUP", "GROUP", "g", "c", "STREAMS", "s", "0"); !reflect.DeepEqual(reply, []any{[]any{"s", []any{}}}) {
+		t.Errorf("XREADGROUP of the pending entries after XACK = %v, want none", reply)
+	}
+	if reply, ok := c.do(t, "XREADGROUP", "GROUP", "g", "c", "STREAMS", "s", "t", "0").(error); !ok || !strings.Contains(reply.Error(), "Unbalanced") {
+		t.Errorf("XREADGROUP with two keys and one ID = %v, want an unbalanced-list error", reply)
+	}
+	if reply, ok := c.do(t, "XGROUP", "DESTROY", "s", "g").(error); !ok || !strings.Contains(reply.Error(), "unknown subcommand") {
+		t.Errorf("XGROUP DESTROY = %v, want an unknown-subcommand error", reply)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import "io"
+
+// ReadRangeTo writes length bytes of the string or []byte value at key,
+// starting at byte offset start, straight to w and returns the number of
+// bytes written. A negative start counts from the end of the value, as in
+// Redis GETRANGE, and a negative length reads through to the end. The range
+// is clipped to the value, so reading past the end writes fewer bytes, and a
+// missing key writes nothing. Other value types return ErrWrongType.
+//
+// The range is written from the stored value itself under the read lock,
+// without copying it first, which suits serving byte ranges of large blobs.
+// Writers to slow destinations hold up writers to the store for as long as
+// the write takes, and w must not retain the slice it is given.
+func (db *DataBase) ReadRangeTo(key string, w io.Writer, start, length int) (int, error) {
+	db.lock.RLock()         // Acquire a read lock for the duration of the write.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+
+	value, exists := db.lookup(key)
+	if !exists {
+		return 0, nil
+	}
+	switch v := value.(type) {
+	case string:
+		lo, hi := byteRange(start, length, len(v))
+		return io.WriteString(w, v[lo:hi]) // Substrings share the stored bytes.
+	case []byte:
+		lo, hi := byteRange(start, length, len(v))
+		return w.Write(v[lo:hi])
+	}
+	return 0, ErrWrongType
+}
+
+// byteRange clips a start offset and length to a value of n bytes, returning
+// a half-open [lo, hi) range. A negative start counts from the end and a
+// negative length extends to the end.
+func byteRange(start, length, n int) (lo, hi int) {
+	if start < 0 {
+		start = max(n+start, 0)
+	}
+	lo = min(start, n)
+	if length < 0 || length > n-lo {
+		return lo, n
+	}
+	return lo, lo + length
+}
+
+// SetString stores a string value, like Set with a string argument but
+// skipping the latency and HotKeys accounting Set performs, for hot
+// string-to-string workloads. The value is still boxed into the
+// store's interface-typed map, which costs one small allocation, and prefix
+// policies and the default TTL apply exactly as for Set, so the two are
+// interchangeable. It returns a *PolicyError if the value violates the key's
+// prefix policy, and ErrOOM as Set does.
+func (db *DataBase) SetString(key, value string) error {
+	db.injectLatency()
+	db.lock.Lock()    // Acquire a write lock.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	if db.readOnly {
+		return ErrReadOnly
+	}
+	var boxed any = value // Box once rather than at every call below.
+	if len(db.policies) > 0 {
+		if err := db.checkPolicy(key, boxed); err != nil {
+			return err
+		}
+	}
+	if err := db.checkOOM(key, boxed); err != nil {
+		return err
+	}
+	db.setLocked(key, boxed)
+	if db.defaultTTL > 0 {
+		db.expires.set(key, db.clock.Now().Add(db.defaultTTL))
+	}
+	return nil
+}
+
+// GetString returns the string stored at key. It reports false if the key
+// is missing, expired, or holds any other type, including []byte, so it
+// never allocates a conversion. Values written by Set are visible to it.
+func (db *DataBase) GetString(key string) (string, bool) {
+	db.injectLatency()
+	db.lock.RLock()         // Acquire a read lock.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+	value, exists := db.data.get(key)
+	if !exists || db.isExpired(key, db.clock.Now()) {
+		db.recordRead(false)
+		return "", false // Lazy removal is left to the write paths and the sweeper.
+	}
+	db.recordRead(true) // A value of another type still counts as a hit.
+	s, ok := value.(string)
+	if ok {
+		db.accessed(key)
+	}
+	return s, ok
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// naiveRange is GETRANGE written the obvious way, by slicing a copy.
+func naiveRange(s string, start, length int) string {
+	if start < 0 {
+		start += len(s)
+		if start < 0 {
+			start = 0
+		}
+	}
+	if start >= len(s) {
+		return ""
+	}
+	s = s[start:]
+	if length >= 0 && length < len(s) {
+		s = s[:length]
+	}
+	return s
+}
+
+func TestReadRangeToMatchesSubstring(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	value := strings.Repeat("0123456789abcdef", 64)
+	db.Set("str", value)
+	db.Set("bytes", []byte(value))
+	for _, start := range []int{0, 1, 15, 500, 1023, 1024, 5000, -1, -16, -1024, -5000} {
+		for _, length := range []int{-1, 0, 1, 7, 100, 1024, 5000} {
+			want := naiveRange(value, start, length)
+			for _, key := range []string{"str", "bytes"} {
+				var buf bytes.Buffer
+				n, err := db.ReadRangeTo(key, &buf, start, length)
+				if err != nil || n != len(want) || buf.String() != want {
+					t.Fatalf("ReadRangeTo(%s, %d, %d) = %d bytes %q, %v; want %q", key, start, length, n, buf.String(), err, want)
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if n, err := db.ReadRangeTo("missing", &buf, 0, -1); n != 0 || err != nil {
+		t.Errorf("ReadRangeTo of a missing key = %d, %v", n, err)
+	}
+	db.RPush("list", "x")
+	if _, err := db.ReadRangeTo("list", &buf, 0, -1); !errors.Is(err, ErrWrongType) {
+		t.Errorf("ReadRangeTo of a list: %v, want ErrWrongType", err)
+	}
+}
+
+func TestStringFastPath(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	db.SetString("a", "1")
+	if value, ok := db.Get("a"); !ok || value != "1" {
+		t.Errorf("Get of a SetString = %v, %v; want 1", value, ok)
+	}
+	db.Set("b", "2")
+	if s, ok := db.GetString("b"); !ok || s != "2" {
+		t.Errorf("GetString of a Set = %q, %v; want 2", s, ok)
+	}
+	db.Set("n", 3)
+	db.Set("raw", []byte("4"))
+	for _, key := range []string{"n", "raw", "missing"} {
+		if s, ok := db.GetString(key); ok {
+			t.Errorf("GetString(%s) = %q, want ok=false", key, s)
+		}
+	}
+}
+
+// BenchmarkStringSet and BenchmarkStringGet compare the string fast path
+// with the generic Set and Get on a warm key, reporting allocations. The
+// value is built at run time, as a real one would be: boxing a constant
+// costs nothing, which would flatter Set.
+func BenchmarkStringSet(b *testing.B) {
+	value := strings.Repeat("v", 16)
+	b.Run("Set", func(b *testing.B) {
+		db := NewDataBase()
+		defer db.Close()
+		b.ReportAllocs()
+		for range b.N {
+			db.Set("key", value)
+		}
+	})
+	b.Run("SetString", func(b *testing.B) {
+		db := NewDataBase()
+		defer db.Close()
+		b.ReportAllocs()
+		for range b.N {
+			db.SetString("key", value)
+		}
+	})
+}
+
+func BenchmarkStringGet(b *testing.B) {
+	b.Run("Get", func(b *testing.B) {
+		db := NewDataBase()
+		defer db.Close()
+		db.Set("key", "value")
+		b.ReportAllocs()
+		for range b.N {
+			if value, _ := db.Get("key"); value.(string) == "" {
+				b.Fatal("empty value")
+			}
+		}
+	})
+	b.Run("GetString", func(b *testing.B) {
+		db := NewDataBase()
+		defer db.Close()
+		db.Set("key", "value")
+		b.ReportAllocs()
+		for range b.N {
+			if s, _ := db.GetString("key"); s == "" {
+				b.Fatal("empty value")
+			}
+		}
+	})
+}
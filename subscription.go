@@ -0,0 +1,154 @@
+package main
+
+import "sync"
+
+// Subscription gathers any number of channel and pattern subscriptions into
+// one stream of messages, so a caller following several channels reads a
+// single Go channel rather than one per Subscribe call. Messages from exact
+// channels arrive with an empty Pattern. Each subscription has its own
+// subscriberBuffer, as with Subscribe, and a reader that falls behind misses
+// messages rather than stalling Publish. A Subscription is safe for
+// concurrent use.
+type Subscription struct {
+	db       *DataBase
+	messages chan PMessage
+	mu       sync.Mutex
+	channels map[string]func() // Cancel funcs of exact subscriptions.
+	patterns map[string]func() // Cancel funcs of pattern subscriptions.
+	closed   bool
+	wg       sync.WaitGroup // Running forwarders.
+}
+
+// NewSubscription returns a Subscription to the given channels; more
+// channels and patterns can be added later. Close it when done to release
+// its subscriptions.
+func (db *DataBase) NewSubscription(channels ...string) *Subscription {
+	sub := &Subscription{
+		db:       db,
+		messages: make(chan PMessage, subscriberBuffer),
+		channels: make(map[string]func()),
+		patterns: make(map[string]func()),
+	}
+	sub.Subscribe(channels...)
+	return sub
+}
+
+// Messages returns the channel on which messages are delivered. It is
+// closed by Close.
+func (sub *Subscription) Messages() <-chan PMessage {
+	return sub.messages
+}
+
+// Subscribe adds channels to the subscription. Channels already subscribed
+// to are left as they are, so no message is delivered twice.
+func (sub *Subscription) Subscribe(channels ...string) {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	for _, channel := range channels {
+		if sub.closed || sub.channels[channel] != nil {
+			continue
+		}
+		msgs, cancel := sub.db.Subscribe(channel)
+		sub.channels[channel] = sub.forward(cancel, func(yield func(PMessage) bool) {
+			for msg := range msgs {
+				if !yield(PMessage{Channel: channel, Payload: msg}) {
+					return
+				}
+			}
+		})
+	}
+}
+
+// PSubscribe adds glob patterns to the subscription, with the syntax of
+// DataBase.PSubscribe.
+func (sub *Subscription) PSubscribe(patterns ...string) {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	for _, pattern := range patterns {
+		if sub.closed || sub.patterns[pattern] != nil {
+			continue
+		}
+		msgs, cancel := sub.db.PSubscribe(pattern)
+		sub.patterns[pattern] = sub.forward(cancel, func(yield func(PMessage) bool) {
+			for msg := range msgs {
+				if !yield(msg) {
+					return
+				}
+			}
+		})
+	}
+}
+
+// Unsubscribe removes channels from the subscription; without arguments it
+// removes every channel, leaving the patterns.
+func (sub *Subscription) Unsubscribe(channels ...string) {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	drop(sub.channels, channels)
+}
+
+// PUnsubscribe removes patterns from the subscription; without arguments it
+// removes every pattern, leaving the channels.
+func (sub *Subscription) PUnsubscribe(patterns ...string) {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	drop(sub.patterns, patterns)
+}
+
+// Close cancels every channel and pattern subscription and then closes the
+// Messages channel, discarding any messages not yet read. Closing twice is
+// harmless.
+func (sub *Subscription) Close() {
+	sub.mu.Lock()
+	if sub.closed {
+		sub.mu.Unlock()
+		return
+	}
+	sub.closed = true
+	drop(sub.channels, nil)
+	drop(sub.patterns, nil)
+	sub.mu.Unlock()
+	sub.wg.Wait()       // Forwarders stop once their source is cancelled.
+	close(sub.messages) // No forwarder can send any more.
+}
+
+// forward starts a goroutine that copies the messages of one underlying
+// subscription into sub.messages, and returns the func that cancels it.
+// The caller must hold sub.mu.
+func (sub *Subscription) forward(cancel func(), source func(yield func(PMessage) bool)) func() {
+	stop := make(chan struct{})
+	sub.wg.Add(1)
+	go func() {
+		defer sub.wg.Done()
+		source(func(msg PMessage) bool {
+			select {
+			case sub.messages <- msg:
+				return true
+			case <-stop:
+				return false // Unsubscribed while waiting for the reader.
+			}
+		})
+	}()
+	return func() {
+		close(stop)
+		cancel() // Closes the source, ending the forwarder.
+	}
+}
+
+// drop cancels and forgets the named subscriptions, or all of them if names
+// is empty.
+func drop(subs map[string]func(), names []string) {
+	if len(names) == 0 {
+		for name, cancel := range subs {
+			cancel()
+			delete(subs, name)
+		}
+		return
+	}
+	for _, name := range names {
+		if cancel, ok := subs[name]; ok {
+			cancel()
+			delete(subs, name)
+		}
+	}
+}
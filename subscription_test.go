@@ -0,0 +1,139 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// next takes one message from sub, failing the test if none comes.
+func next(t *testing.T, sub *Subscription) PMessage {
+	t.Helper()
+	select {
+	case msg := <-sub.Messages():
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message arrived")
+		return PMessage{}
+	}
+}
+
+// quiet fails the test if sub delivers a message soon.
+func quiet(t *testing.T, sub *Subscription) {
+	t.Helper()
+	select {
+	case msg := <-sub.Messages():
+		t.Errorf("unexpected message %+v", msg)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestSubscriptionChannelsAndPatterns(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	sub := db.NewSubscription("news")
+	defer sub.Close()
+	sub.PSubscribe("log.*")
+	sub.Subscribe("news") // Already subscribed: still one delivery.
+
+	if n := db.Publish("news", "a"); n != 1 {
+		t.Errorf("Publish(news) = %d, want 1", n)
+	}
+	if msg := next(t, sub); msg != (PMessage{Channel: "news", Payload: "a"}) {
+		t.Errorf("got %+v, want a on news without a pattern", msg)
+	}
+	db.Publish("log.error", "b")
+	if msg := next(t, sub); msg != (PMessage{Pattern: "log.*", Channel: "log.error", Payload: "b"}) {
+		t.Errorf("got %+v, want b on log.error through log.*", msg)
+	}
+	db.Publish("elsewhere", "c")
+	quiet(t, sub)
+
+	sub.Subscribe("log.error") // Now matched both ways: delivered once for each.
+	if n := db.Publish("log.error", "d"); n != 2 {
+		t.Errorf("Publish to a channel subscribed and matched = %d, want 2", n)
+	}
+	patterns := map[string]bool{}
+	for range 2 {
+		msg := next(t, sub)
+		patterns[msg.Pattern] = true
+	}
+	if !patterns[""] || !patterns["log.*"] {
+		t.Errorf("deliveries came through %v, want the channel and the pattern", patterns)
+	}
+}
+
+func TestSubscriptionUnsubscribe(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	sub := db.NewSubscription("a", "b")
+	defer sub.Close()
+	sub.PSubscribe("p.*", "q.*")
+
+	sub.Unsubscribe("a", "missing")
+	if n := db.Publish("a", 1); n != 0 {
+		t.Errorf("Publish(a) after Unsubscribe = %d, want 0", n)
+	}
+	db.Publish("b", 2)
+	if msg := next(t, sub); msg.Channel != "b" {
+		t.Errorf("got %+v, want the message on b", msg)
+	}
+	sub.PUnsubscribe("p.*")
+	if n := db.Publish("p.x", 3); n != 0 {
+		t.Errorf("Publish(p.x) after PUnsubscribe = %d, want 0", n)
+	}
+
+	sub.Unsubscribe() // Every channel, but not the patterns.
+	if n := db.Publish("b", 4); n != 0 {
+		t.Errorf("Publish(b) after Unsubscribe() = %d, want 0", n)
+	}
+	db.Publish("q.x", 5)
+	if msg := next(t, sub); msg.Pattern != "q.*" || msg.Payload != 5 {
+		t.Errorf("got %+v, want 5 through q.*", msg)
+	}
+	sub.PUnsubscribe()
+	if n := db.Publish("q.x", 6); n != 0 {
+		t.Errorf("Publish(q.x) after PUnsubscribe() = %d, want 0", n)
+	}
+	quiet(t, sub)
+}
+
+func TestSubscriptionOrder(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	sub := db.NewSubscription("ch")
+	defer sub.Close()
+	sub.PSubscribe("pat.*")
+	const n = 50 // Within subscriberBuffer, so nothing is dropped.
+	for i := range n {
+		db.Publish("ch", i)
+		db.Publish("pat.x", i)
+	}
+	// Each subscription delivers in publish order; the two interleave.
+	nextOf := map[string]int{}
+	for range 2 * n {
+		msg := next(t, sub)
+		if want := nextOf[msg.Pattern]; msg.Payload != want {
+			t.Fatalf("got %v through %q, want %d", msg.Payload, msg.Pattern, want)
+		}
+		nextOf[msg.Pattern]++
+	}
+}
+
+func TestSubscriptionClose(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	sub := db.NewSubscription("ch")
+	sub.PSubscribe("*")
+	db.Publish("ch", "unread") // Left in the buffer.
+	sub.Close()
+	for range sub.Messages() {
+	} // Ends only if Close closed the channel.
+	if n := db.Publish("ch", "after"); n != 0 {
+		t.Errorf("Publish after Close = %d, want 0", n)
+	}
+	sub.Subscribe("other") // Ignored once closed.
+	if n := db.Publish("other", "x"); n != 0 {
+		t.Errorf("Publish to a channel subscribed after Close = %d, want 0", n)
+	}
+	sub.Close() // Closing twice is harmless.
+}
@@ -0,0 +1,115 @@
+package main
+
+import "time"
+
+// defaultSweepInterval is how often the background sweeper runs by default.
+const defaultSweepInterval = 100 * time.Millisecond
+
+// minSweepWait is the shortest the sweeper sleeps between runs, so keys
+// expiring microseconds apart are removed together rather than one wakeup
+// each.
+const minSweepWait = time.Millisecond
+
+// startSweeper launches the background goroutine that actively removes
+// expired data. It sleeps until the earliest key deadline, or for the sweep
+// interval if that comes first, which also bounds how late expiry runs
+// under a fake clock and how often hash field TTLs are checked. It stops
+// when Close is called.
+func (db *DataBase) startSweeper() {
+	interval := db.sweepInterval // Later changes arrive through sweepReset.
+	kick := db.expires.kick
+	db.spawn(func() {
+		timer := time.NewTimer(interval)
+		defer timer.Stop()
+		for {
+			select {
+			case <-timer.C:
+				db.sweep() // Remove whatever has expired since the last run.
+			case <-kick: // A new earliest deadline.
+			case <-db.sweepReset: // Reconfigure changed the interval.
+			case <-db.stop:
+				return // Close was called.
+			}
+			timer.Stop()
+			timer.Reset(db.sweepWait())
+		}
+	})
+}
+
+// sweepWait returns how long the sweeper should sleep before its next run.
+func (db *DataBase) sweepWait() time.Duration {
+	db.lock.RLock()         // Acquire a read lock.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+	wait := db.sweepInterval
+	if next, ok := db.expires.next(); ok {
+		wait = min(wait, next.Sub(db.clock.Now()))
+	}
+	return max(wait, minSweepWait)
+}
+
+// sweep removes expired keys and every expired hash field.
+func (db *DataBase) sweep() {
+	db.lock.Lock()    // Acquire a write lock to delete expired data.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+
+	now := db.clock.Now()
+	keys := db.activeExpire(now)
+	fields := 0
+	for key, deadlines := range db.fieldExpires {
+		hash, _ := db.data.value(key).(Hash)
+		db.cow(key) // Fields are deleted in place.
+		removed := 0
+		for field, deadline := range deadlines {
+			if now.Before(deadline) {
+				continue // Still alive.
+			}
+			delete(hash, field)
+			delete(deadlines, field)
+			removed++
+		}
+		fields += removed
+		if len(deadlines) == 0 {
+			delete(db.fieldExpires, key) // No more tracked fields for this key.
+		}
+		if hash != nil && len(hash) == 0 {
+			db.removeKey(key) // An emptied hash disappears, as in Redis.
+		} else if hash != nil && removed > 0 {
+			db.touch(key) // Expired fields changed the hash.
+		}
+	}
+	if keys > 0 || fields > 0 {
+		db.logger.Debug("sweeper run", "expired_keys", keys, "expired_fields", fields)
+	}
+}
+
+// Close stops the background goroutines owned by the database and waits for
+// them to exit. It is safe to call more than once.
+func (db *DataBase) Close() error {
+	db.closeOnce.Do(func() {
+		close(db.stop) // Signal every background goroutine.
+	})
+	db.wg.Wait() // Wait until they have all returned.
+	db.closeAOF()
+	return nil
+}
+
+// spawn runs fn on a background goroutine owned by the database, so that
+// Close waits for it and ActiveGoroutines counts it. fn must return once
+// db.stop is closed.
+func (db *DataBase) spawn(fn func()) {
+	db.wg.Add(1)
+	db.goroutines.Add(1)
+	go func() {
+		defer db.wg.Done()
+		defer db.goroutines.Add(-1)
+		fn()
+	}()
+}
+
+// ActiveGoroutines returns how many background goroutines the database is
+// running: the sweeper, the lazy freer and, when in use, the SaveEvery
+// saver, the async write applier, a BGSave or a compaction. It drops to zero
+// once Close returns, which lets tests check that nothing leaked.
+func (db *DataBase) ActiveGoroutines() int {
+	return int(db.goroutines.Load())
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+)
+
+func TestCloseStopsGoroutines(t *testing.T) {
+	baseline := runtime.NumGoroutine()
+	dir := t.TempDir()
+	for i := range 50 {
+		db := NewDataBase(WithAsyncWrites(8))
+		fileName := filepath.Join(dir, strconv.Itoa(i)+".gob")
+		db.SaveEvery(1000, fileName)
+		db.SetAsync("k", i)
+		db.RPush("list", 1, 2, 3)
+		db.Unlink("list") // Hands the value to the lazy freer.
+		done := db.BGSave(fileName)
+		if n := db.ActiveGoroutines(); n < 4 {
+			t.Fatalf("ActiveGoroutines = %d, want the sweeper, freer, saver and applier at least", n)
+		}
+		db.Close()
+		<-done
+		if n := db.ActiveGoroutines(); n != 0 {
+			t.Fatalf("ActiveGoroutines after Close = %d, want 0", n)
+		}
+	}
+	waitFor(t, "the goroutine count to return to its baseline", func() bool {
+		return runtime.NumGoroutine() <= baseline
+	})
+}
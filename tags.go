@@ -0,0 +1,100 @@
+package main
+
+import (
+	"maps"
+	"slices"
+)
+
+// Tag attaches tags to key, for deleting a group of related keys together
+// with DeleteByTag, such as every cache entry built from one record. It
+// reports false, tagging nothing, if the key does not exist or the
+// database is read-only. Tags belong to the key until it is deleted,
+// expires or is evicted, and overwriting its value keeps them; Rename
+// and SwapDB drop them with the old place. They are not saved in snapshots.
+func (db *DataBase) Tag(key string, tags ...string) bool {
+	db.lock.Lock()    // Acquire a write lock.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	if db.readOnly {
+		return false
+	}
+	db.expireIfNeeded(key)
+	if !db.data.has(key) {
+		return false
+	}
+	if db.tagKeys == nil {
+		db.tagKeys = make(map[string]map[string]struct{})
+		db.keyTags = make(map[string]map[string]struct{})
+	}
+	for _, tag := range tags {
+		if db.tagKeys[tag] == nil {
+			db.tagKeys[tag] = make(map[string]struct{})
+		}
+		db.tagKeys[tag][key] = struct{}{}
+		if db.keyTags[key] == nil {
+			db.keyTags[key] = make(map[string]struct{})
+		}
+		db.keyTags[key][tag] = struct{}{}
+	}
+	return true
+}
+
+// Tags returns the tags of key, sorted, or none if the key does not exist.
+func (db *DataBase) Tags(key string) []string {
+	db.lock.RLock()         // Acquire a read lock.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+	if db.isExpired(key, db.clock.Now()) {
+		return nil
+	}
+	return slices.Sorted(maps.Keys(db.keyTags[key]))
+}
+
+// DeleteByTag deletes every key tagged with tag under one write lock and
+// returns how many live keys were removed. It deletes nothing while the
+// database is read-only. DeleteByTagDryRun shows what would go first.
+func (db *DataBase) DeleteByTag(tag string) int {
+	db.lock.Lock()    // Acquire a write lock.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	if db.readOnly {
+		return 0
+	}
+	keys := db.taggedKeys(tag) // Collect first: removal edits tagKeys.
+	for _, key := range keys {
+		db.removeKey(key)
+	}
+	return len(keys)
+}
+
+// DeleteByTagDryRun returns the keys DeleteByTag would delete right now,
+// sorted, leaving the store unchanged.
+func (db *DataBase) DeleteByTagDryRun(tag string) []string {
+	db.lock.RLock()         // Acquire a read lock.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+	keys := db.taggedKeys(tag)
+	slices.Sort(keys)
+	return keys
+}
+
+// taggedKeys returns the unexpired keys tagged with tag. The caller must
+// hold the lock.
+func (db *DataBase) taggedKeys(tag string) []string {
+	now := db.clock.Now()
+	var keys []string
+	for key := range db.tagKeys[tag] {
+		if !db.isExpired(key, now) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// untag forgets the tags of a key being removed. The caller must hold the
+// write lock.
+func (db *DataBase) untag(key string) {
+	for tag := range db.keyTags[key] {
+		delete(db.tagKeys[tag], key)
+		if len(db.tagKeys[tag]) == 0 {
+			delete(db.tagKeys, tag)
+		}
+	}
+	delete(db.keyTags, key)
+}
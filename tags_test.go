@@ -0,0 +1,95 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestDeleteByTagDryRun(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	for _, key := range []string{"user:1", "user:2", "post:1", "other"} {
+		db.Set(key, "v")
+	}
+	db.Tag("user:2", "users")
+	db.Tag("user:1", "users", "cache")
+	db.Tag("post:1", "cache")
+
+	if got := db.DeleteByTagDryRun("users"); !slices.Equal(got, []string{"user:1", "user:2"}) {
+		t.Errorf("DeleteByTagDryRun(users) = %v, want [user:1 user:2]", got)
+	}
+	if got := db.DeleteByTagDryRun("none"); len(got) != 0 {
+		t.Errorf("DeleteByTagDryRun(none) = %v, want none", got)
+	}
+	if keys := db.Keys("*"); len(keys) != 4 {
+		t.Errorf("keys after the dry run = %v, want all 4", keys)
+	}
+	if n := db.FlushAllDryRun(); n != 4 {
+		t.Errorf("FlushAllDryRun = %d, want 4", n)
+	}
+	if got := db.Tags("user:1"); !slices.Equal(got, []string{"cache", "users"}) {
+		t.Errorf("Tags(user:1) = %v, want [cache users]", got)
+	}
+
+	if n := db.DeleteByTag("users"); n != 2 {
+		t.Errorf("DeleteByTag(users) = %d, want 2", n)
+	}
+	for key, want := range map[string]bool{"user:1": false, "user:2": false, "post:1": true, "other": true} {
+		if _, ok := db.Get(key); ok != want {
+			t.Errorf("%s exists = %v after DeleteByTag, want %v", key, ok, want)
+		}
+	}
+	if got := db.DeleteByTagDryRun("cache"); !slices.Equal(got, []string{"post:1"}) {
+		t.Errorf("DeleteByTagDryRun(cache) = %v, want [post:1]: deleted keys leave their other tags", got)
+	}
+	if db.Tag("missing", "cache") {
+		t.Error("Tag of a missing key succeeded")
+	}
+}
+
+func TestTagsFollowTheKey(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1_000_000, 0))
+	db := NewDataBase(WithClock(clock))
+	defer db.Close()
+	db.Set("a", 1)
+	db.Set("b", 2)
+	if err := db.SetWithTTL("c", 3, time.Second); err != nil {
+		t.Fatalf("SetWithTTL: %v", err)
+	}
+	db.Tag("a", "t")
+	db.Tag("b", "t")
+	db.Tag("c", "t")
+
+	db.Delete("a")
+	db.Set("a", 1) // A new key of the same name starts untagged.
+	clock.Advance(2 * time.Second)
+	if got := db.DeleteByTagDryRun("t"); !slices.Equal(got, []string{"b"}) {
+		t.Errorf("DeleteByTagDryRun = %v, want [b]: deleted and expired keys drop out", got)
+	}
+	if got := db.Tags("c"); len(got) != 0 {
+		t.Errorf("Tags of an expired key = %v, want none", got)
+	}
+	db.Set("b", "overwritten")
+	if got := db.Tags("b"); !slices.Equal(got, []string{"t"}) {
+		t.Errorf("Tags after overwriting = %v, want [t]", got)
+	}
+	if err := db.Rename("b", "renamed"); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+	if got := db.DeleteByTagDryRun("t"); len(got) != 0 {
+		t.Errorf("DeleteByTagDryRun after Rename = %v, want none", got)
+	}
+
+	db.Tag("a", "t")
+	db.SetReadOnly(true)
+	if db.Tag("renamed", "t") {
+		t.Error("Tag on a read-only database succeeded")
+	}
+	if n := db.DeleteByTag("t"); n != 0 {
+		t.Errorf("DeleteByTag on a read-only database = %d, want 0", n)
+	}
+	if _, ok := db.Get("a"); !ok {
+		t.Error("DeleteByTag deleted a key while read-only")
+	}
+}
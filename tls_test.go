@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testPKI is a certificate authority with a server and a client
+// certificate it signed.
+type testPKI struct {
+	pool           *x509.CertPool
+	caPEM          []byte
+	server, client tls.Certificate
+	serverPEM      [2][]byte // Certificate and key, PEM-encoded.
+}
+
+// newTestPKI creates a fresh authority and its two leaf certificates.
+func newTestPKI(t *testing.T) *testPKI {
+	t.Helper()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, _ := x509.ParseCertificate(caDER)
+	p := &testPKI{pool: x509.NewCertPool(), caPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})}
+	p.pool.AddCert(ca)
+
+	leaf := func(serial int64, usage x509.ExtKeyUsage) (tls.Certificate, [2][]byte) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: "127.0.0.1"},
+			IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		}, ca, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyDER, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pems := [2][]byte{
+			pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+			pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+		}
+		cert, err := tls.X509KeyPair(pems[0], pems[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert, pems
+	}
+	p.server, p.serverPEM = leaf(2, x509.ExtKeyUsageServerAuth)
+	p.client, _ = leaf(3, x509.ExtKeyUsageClientAuth)
+	return p
+}
+
+// serverTLS returns the server side of mutual TLS.
+func (p *testPKI) serverTLS() *tls.Config {
+	return &tls.Config{Certificates: []tls.Certificate{p.server}, ClientCAs: p.pool, ClientAuth: tls.RequireAndVerifyClientCert}
+}
+
+// clientTLS returns a client configuration trusting the authority,
+// presenting the client certificate if withCert is set.
+func (p *testPKI) clientTLS(withCert bool) *tls.Config {
+	cfg := &tls.Config{RootCAs: p.pool}
+	if withCert {
+		cfg.Certificates = []tls.Certificate{p.client}
+	}
+	return cfg
+}
+
+func TestServerTLS(t *testing.T) {
+	pki := newTestPKI(t)
+	db := NewDataBase()
+	defer db.Close()
+	addr := startServer(t, db, ServerConfig{TLS: pki.serverTLS()})
+
+	conn, err := tls.Dial("tcp", addr, pki.clientTLS(true))
+	if err != nil {
+		t.Fatalf("dial with a client certificate: %v", err)
+	}
+	defer conn.Close()
+	c := &respClient{conn: conn, r: bufio.NewReader(conn)}
+	if reply := c.do(t, "SET", "k", "v"); reply != "OK" {
+		t.Errorf("SET over TLS = %v, want OK", reply)
+	}
+	if reply := c.do(t, "GET", "k"); reply != "v" {
+		t.Errorf("GET over TLS = %v, want v", reply)
+	}
+
+	// The handshake of a client without a certificate fails on its first
+	// read, since TLS 1.3 client authentication completes after Dial.
+	bare, err := tls.Dial("tcp", addr, pki.clientTLS(false))
+	if err == nil {
+		defer bare.Close()
+		bare.SetDeadline(time.Now().Add(5 * time.Second))
+		bare.Write([]byte("PING\r\n"))
+		_, err = bare.Read(make([]byte, 16))
+	}
+	if err == nil {
+		t.Error("a client without a certificate was served")
+	}
+
+	plain := dial(t, addr)
+	plain.conn.SetDeadline(time.Now().Add(5 * time.Second))
+	plain.send(t, "PING")
+	if _, err := readReply(plain.r); err == nil {
+		t.Error("a plain TCP client was served by a TLS server")
+	}
+}
+
+func TestReplicaOfOverTLS(t *testing.T) {
+	pki := newTestPKI(t)
+	primary := NewDataBase()
+	defer primary.Close()
+	primary.Set("k", "v")
+	addr := startServer(t, primary, ServerConfig{TLS: pki.serverTLS()})
+
+	replica := NewDataBase(WithReplicationTLS(pki.clientTLS(true)))
+	defer replica.Close()
+	if err := replica.ReplicaOf(addr); err != nil {
+		t.Fatal(err)
+	}
+	defer replica.ReplicaOf("")
+	primary.Set("after", "w")
+	waitFor(t, "the replica to sync over TLS", func() bool {
+		return replica.Exists("k", "after") == 2
+	})
+
+	plain := NewDataBase()
+	defer plain.Close()
+	if err := plain.ReplicaOf(addr); err == nil { // TCP connects; the sync cannot start.
+		time.Sleep(100 * time.Millisecond)
+		if _, inSync := plain.ReplicationLag(); inSync || plain.Exists("k") != 0 {
+			t.Error("a replica without TLS synced from a TLS primary")
+		}
+		plain.ReplicaOf("")
+	}
+}
+
+func TestParseConfigTLS(t *testing.T) {
+	pki := newTestPKI(t)
+	dir := t.TempDir()
+	files := map[string][]byte{"server.crt": pki.serverPEM[0], "server.key": pki.serverPEM[1], "ca.crt": pki.caPEM, "empty.crt": nil}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	base := "tls-cert-file " + filepath.Join(dir, "server.crt") + "\ntls-key-file " + filepath.Join(dir, "server.key") + "\n"
+	ca := "tls-ca-cert-file " + filepath.Join(dir, "ca.crt") + "\n"
+
+	for _, tc := range []struct {
+		name, config string
+		auth         tls.ClientAuthType
+		replication  bool
+	}{
+		{"defaults to verifying clients", base + ca, tls.RequireAndVerifyClientCert, false},
+		{"optional client certificates", base + ca + "tls-auth-clients optional\n", tls.VerifyClientCertIfGiven, false},
+		{"no client certificates", base + "tls-auth-clients no\n", tls.NoClientCert, false},
+		{"replication", base + ca + "tls-replication yes\n", tls.RequireAndVerifyClientCert, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, err := ParseConfig(strings.NewReader(tc.config))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.TLS == nil || cfg.TLS.ClientAuth != tc.auth || len(cfg.TLS.Certificates) != 1 {
+				t.Fatalf("TLS = %+v, want the certificate and client auth %v", cfg.TLS, tc.auth)
+			}
+			if (cfg.ReplicationTLS != nil) != tc.replication {
+				t.Errorf("ReplicationTLS = %v, want it set: %v", cfg.ReplicationTLS, tc.replication)
+			}
+		})
+	}
+
+	if cfg, err := ParseConfig(strings.NewReader("port 7000\n")); err != nil || cfg.TLS != nil {
+		t.Errorf("a config without tls directives gave TLS %v, %v; want none", cfg.TLS, err)
+	}
+	for name, config := range map[string]string{
+		"ca without a certificate": ca,
+		"missing key file":         "tls-cert-file " + filepath.Join(dir, "server.crt") + "\ntls-key-file " + filepath.Join(dir, "nope.key") + "\n",
+		"ca file without PEM":      base + "tls-ca-cert-file " + filepath.Join(dir, "empty.crt") + "\n",
+		"bad tls-auth-clients":     base + "tls-auth-clients maybe\n",
+	} {
+		if _, err := ParseConfig(strings.NewReader(config)); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("%s: ParseConfig error = %v, want ErrInvalidConfig", name, err)
+		}
+	}
+}
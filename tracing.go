@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// Tracer starts spans. It mirrors the small part of the OpenTelemetry
+// trace.Tracer API the server needs; OTelTracer adapts an OpenTelemetry
+// TracerProvider to it.
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a unit of traced work, as in OpenTelemetry's trace.Span.
+type Span interface {
+	SetAttribute(key string, value any)
+	End()
+}
+
+// SpanContext identifies a remote parent span, as carried by the W3C
+// traceparent header.
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Sampled bool
+}
+
+// spanContextKey keys the remote parent stored by ExtractTraceParent.
+type spanContextKey struct{}
+
+// ExtractTraceParent returns ctx carrying the remote parent span described
+// by the W3C traceparent header in h, so spans started from it join the
+// caller's trace. Tracers retrieve it with RemoteSpanContext. A missing or
+// malformed header leaves ctx unchanged.
+func ExtractTraceParent(ctx context.Context, h http.Header) context.Context {
+	sc, ok := parseTraceParent(h.Get("traceparent"))
+	if !ok {
+		return ctx
+	}
+	return context.WithValue(ctx, spanContextKey{}, sc)
+}
+
+// RemoteSpanContext returns the remote parent stored by ExtractTraceParent.
+func RemoteSpanContext(ctx context.Context) (SpanContext, bool) {
+	sc, ok := ctx.Value(spanContextKey{}).(SpanContext)
+	return sc, ok
+}
+
+// parseTraceParent parses "version-traceid-spanid-flags", rejecting the
+// all-zero IDs that the specification declares invalid.
+func parseTraceParent(v string) (SpanContext, bool) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(v), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return sc, false
+	}
+	var flags [1]byte
+	if !decodeHex(sc.TraceID[:], parts[1]) || !decodeHex(sc.SpanID[:], parts[2]) || !decodeHex(flags[:], parts[3]) {
+		return sc, false
+	}
+	if sc.TraceID == [16]byte{} || sc.SpanID == [8]byte{} {
+		return sc, false
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc, true
+}
+
+// decodeHex fills dst from s, which must be exactly len(dst) bytes of hex.
+func decodeHex(dst []byte, s string) bool {
+	if len(s) != hex.EncodedLen(len(dst)) {
+		return false
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err == nil
+}
+
+// traceCommand runs a command inside a span named after it, e.g.
+// "redis.GET", recording the key it targets and whether it failed.
+func (s *Server) traceCommand(db *DataBase, name string, cmd command, params []string) any {
+	_, span := s.cfg.Tracer.Start(context.Background(), "redis."+name)
+	defer span.End()
+	if cmd.keyed && len(params) > 0 {
+		span.SetAttribute("db.key", params[0])
+	}
+	reply := cmd.run(db, params)
+	if err, ok := reply.(error); ok {
+		span.SetAttribute("status", "error")
+		span.SetAttribute("error", err.Error())
+	} else {
+		span.SetAttribute("status", "ok")
+	}
+	return reply
+}
+
+// WithTracer makes GetCtx and SetCtx record a span for each call, started
+// from the context passed to them, and HTTPHandler one for each request.
+func WithTracer(t Tracer) Option {
+	return func(db *DataBase) {
+		db.tracer = t
+	}
+}
+
+// noopSpan stands in for a span when no tracer is configured.
+type noopSpan struct{}
+
+// SetAttribute implements Span.
+func (noopSpan) SetAttribute(string, any) {}
+
+// End implements Span.
+func (noopSpan) End() {}
+
+// startSpan starts a span for a database call on key, or returns ctx and a
+// no-op span if tracing is off.
+func (db *DataBase) startSpan(ctx context.Context, name, key string) (context.Context, Span) {
+	if db.tracer == nil {
+		return ctx, noopSpan{}
+	}
+	ctx, span := db.tracer.Start(ctx, name)
+	span.SetAttribute("db.key", key)
+	return ctx, span
+}
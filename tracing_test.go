@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+)
+
+// recordingTracer keeps every span it starts, for tests.
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []*recordedSpan
+}
+
+// recordedSpan is a span started by recordingTracer.
+type recordedSpan struct {
+	name   string
+	parent SpanContext // Zero unless the context carried a remote parent.
+	attrs  map[string]any
+	ended  bool
+}
+
+// Start implements Tracer.
+func (t *recordingTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	span := &recordedSpan{name: name, attrs: make(map[string]any)}
+	span.parent, _ = RemoteSpanContext(ctx)
+	t.spans = append(t.spans, span)
+	return ctx, span
+}
+
+// SetAttribute implements Span.
+func (s *recordedSpan) SetAttribute(key string, value any) { s.attrs[key] = value }
+
+// End implements Span.
+func (s *recordedSpan) End() { s.ended = true }
+
+func TestServerTracesCommands(t *testing.T) {
+	tracer := &recordingTracer{}
+	db := NewDataBase()
+	defer db.Close()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(db, ServerConfig{Tracer: tracer})
+	go s.Serve(ln)
+	c := dial(t, ln.Addr().String())
+	c.do(t, "SET", "user:1", "ada")
+	c.do(t, "GET", "user:1")
+	db.RPush("list", "a")
+	c.do(t, "GET", "list") // Not a string.
+	c.do(t, "PING")
+	s.Close() // Waits for the connection, so the spans are complete.
+
+	if len(tracer.spans) != 4 {
+		t.Fatalf("recorded %d spans, want one per command", len(tracer.spans))
+	}
+	for i, want := range []struct{ name, key, status string }{
+		{"redis.SET", "user:1", "ok"},
+		{"redis.GET", "user:1", "ok"},
+		{"redis.GET", "list", "error"},
+		{"redis.PING", "", "ok"},
+	} {
+		span := tracer.spans[i]
+		key, _ := span.attrs["db.key"].(string)
+		if span.name != want.name || key != want.key || span.attrs["status"] != want.status || !span.ended {
+			t.Errorf("span %d = %+v, want %s on %q with status %s", i, span, want.name, want.key, want.status)
+		}
+	}
+	if _, ok := tracer.spans[2].attrs["error"]; !ok {
+		t.Error("the failed command's span has no error attribute")
+	}
+}
+
+func TestParseTraceParent(t *testing.T) {
+	sc, ok := parseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if !ok || !sc.Sampled || sc.TraceID[0] != 0x4b || sc.SpanID[7] != 0xb7 {
+		t.Errorf("parseTraceParent = %+v, %v", sc, ok)
+	}
+	for _, bad := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",    // No flags.
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", // Invalid version.
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01", // Zero trace ID.
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", // Zero span ID.
+		"00-4bf92f3577b34da6a3ce929d0e0e47-00f067aa0ba902b7-01",   // Short trace ID.
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902bz-01", // Not hex.
+	} {
+		if _, ok := parseTraceParent(bad); ok {
+			t.Errorf("parseTraceParent(%q) succeeded", bad)
+		}
+	}
+}
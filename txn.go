@@ -0,0 +1,227 @@
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrTxnAborted is returned by Exec when a watched key changed after it was
+// watched, in which case none of the queued commands ran.
+var ErrTxnAborted = errors.New("transaction aborted: a watched key changed")
+
+// ErrExecInScript is returned by Exec on the Txn of an Eval script.
+var ErrExecInScript = errors.New("ERR EXEC is not allowed from scripts")
+
+// Txn is a transaction, the Go counterpart of Redis MULTI/EXEC. Commands
+// queued with its methods run together in Exec, under one write lock, so no
+// other writer can interleave with them; until then the methods return zero
+// values, and Exec returns the real results. Watch adds optimistic locking:
+// if a watched key is written by anyone else before Exec, the transaction is
+// aborted instead, which gives check-and-set without holding a lock while
+// the caller decides what to write.
+//
+// The Txn given to an Eval script instead runs each command at once, under
+// the write lock Eval holds, and returns its result; Watch, Unwatch and
+// Discard do nothing there. A Txn is not safe for concurrent use.
+type Txn struct {
+	db      *DataBase
+	script  bool              // Run by Eval: commands run at once.
+	watched map[string]uint64 // Watched keys and their versions at Watch time.
+	since   uint64            // The database's writeSeq at the first Watch.
+	ops     []func() any      // Queued commands; run under the write lock.
+}
+
+// Multi starts a transaction with nothing queued or watched.
+func (db *DataBase) Multi() *Txn {
+	return &Txn{db: db}
+}
+
+// Watch makes Exec abort if any of keys is written, created, deleted or
+// expires before it runs. Changes are detected through the keys' versions
+// (see GetWithVersion), so writing back an unchanged value still counts.
+// Keys watched again keep the version from their first Watch.
+func (tx *Txn) Watch(keys ...string) {
+	if tx.script {
+		return // Nothing else can write while the script holds the lock.
+	}
+	db := tx.db
+	db.lock.Lock()    // Expired keys are removed first.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	if tx.watched == nil {
+		tx.watched = make(map[string]uint64, len(keys))
+		tx.since = db.writeSeq
+	}
+	for _, key := range keys {
+		if _, ok := tx.watched[key]; ok {
+			continue
+		}
+		db.expireIfNeeded(key) // So that Exec does not see the expiry as a change.
+		tx.watched[key] = db.versionOf(key)
+	}
+}
+
+// Unwatch forgets every watched key, so Exec no longer checks them.
+func (tx *Txn) Unwatch() {
+	if tx.script {
+		return
+	}
+	tx.watched = nil
+}
+
+// Get reads key like Get. Queued, its result is the value, or nil if the key
+// is missing.
+func (tx *Txn) Get(key string) (any, bool) {
+	if tx.script {
+		return tx.db.lookup(key)
+	}
+	tx.queue(func() any {
+		value, _ := tx.db.lookup(key)
+		return value
+	})
+	return nil, false
+}
+
+// Set writes key like Set. Queued, its result is nil or the error.
+func (tx *Txn) Set(key string, value any) error {
+	set := func() error {
+		if tx.db.readOnly {
+			return ErrReadOnly // Only a script can get here while read-only.
+		}
+		return tx.db.setChecked(key, value)
+	}
+	if tx.script {
+		return set()
+	}
+	tx.queue(func() any {
+		if err := set(); err != nil {
+			return err
+		}
+		return nil
+	})
+	return nil
+}
+
+// Delete deletes key like Delete. Queued, its result reports whether the
+// key existed.
+func (tx *Txn) Delete(key string) bool {
+	del := func() bool { return !tx.db.readOnly && tx.db.delLocked(key) }
+	if tx.script {
+		return del()
+	}
+	tx.queue(func() any { return del() })
+	return false
+}
+
+// IncrBy increments key like IncrBy. Queued, its result is the new value as
+// an int64, or the error.
+func (tx *Txn) IncrBy(key string, delta int64) (int64, error) {
+	incr := func() (int64, error) {
+		if tx.db.readOnly {
+			return 0, ErrReadOnly
+		}
+		return tx.db.incrByLocked(key, delta)
+	}
+	if tx.script {
+		return incr()
+	}
+	tx.queue(func() any {
+		n, err := incr()
+		if err != nil {
+			return err
+		}
+		return n
+	})
+	return 0, nil
+}
+
+// Expire sets key's TTL like Expire. Queued, its result reports whether the
+// key existed.
+func (tx *Txn) Expire(key string, ttl time.Duration) bool {
+	expire := func() bool {
+		return !tx.db.readOnly && tx.db.expireAtLocked(key, tx.db.clock.Now().Add(ttl))
+	}
+	if tx.script {
+		return expire()
+	}
+	tx.queue(func() any { return expire() })
+	return false
+}
+
+// TTL reads key's remaining lifetime like TTL. Queued, its result is the
+// time.Duration.
+func (tx *Txn) TTL(key string) time.Duration {
+	if tx.script {
+		return tx.db.ttlLocked(key, tx.db.clock.Now())
+	}
+	tx.queue(func() any { return tx.db.ttlLocked(key, tx.db.clock.Now()) })
+	return 0
+}
+
+// queue adds a command to run in Exec.
+func (tx *Txn) queue(op func() any) {
+	tx.ops = append(tx.ops, op)
+}
+
+// Discard drops the queued commands and the watched keys.
+func (tx *Txn) Discard() {
+	if tx.script {
+		return
+	}
+	tx.ops = nil
+	tx.watched = nil
+}
+
+// Exec runs the queued commands in order under one write lock and returns
+// their results, one per command. As in Redis, a command that fails does
+// not roll back the others; its error is its result. If a watched key
+// changed, nothing runs and ErrTxnAborted is returned; while the database
+// is read-only (see Drain), nothing runs and ErrReadOnly is returned.
+// Either way, and on success, the transaction is reset and may be reused.
+// Inside an Eval script, where commands have already run, Exec returns
+// ErrExecInScript.
+func (tx *Txn) Exec() ([]any, error) {
+	if tx.script {
+		return nil, ErrExecInScript // The lock is held; there is nothing queued.
+	}
+	db := tx.db
+	ops, watched, since := tx.ops, tx.watched, tx.since
+	tx.Discard()
+
+	db.lock.Lock()    // One lock for the check and every command.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	if db.readOnly {
+		return nil, ErrReadOnly
+	}
+	if db.watchedChanged(watched, since) {
+		return nil, ErrTxnAborted
+	}
+	results := make([]any, len(ops))
+	for i, op := range ops {
+		results[i] = op()
+	}
+	return results, nil
+}
+
+// stale reports whether a watched key has changed since Watch, for callers
+// that run the transaction's commands themselves, like the RESP server.
+func (tx *Txn) stale() bool {
+	tx.db.lock.Lock()    // Expired keys may be removed.
+	defer tx.db.unlock() // Release the lock and run expiry callbacks.
+	return tx.db.watchedChanged(tx.watched, tx.since)
+}
+
+// watchedChanged reports whether any watched key has a version other than
+// the one recorded, removing expired keys first so that an expiry counts as
+// a change. Keys deleted both then and now count as changed if tombstones
+// were dropped since the Watch at since, which may have lost a deletion in
+// between. The caller must hold the write lock.
+func (db *DataBase) watchedChanged(watched map[string]uint64, since uint64) bool {
+	for key, version := range watched {
+		db.expireIfNeeded(key)
+		current := db.versionOf(key)
+		if current != version || current == 0 && db.tombstoneFloor > since {
+			return true
+		}
+	}
+	return false
+}
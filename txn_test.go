@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestTxnWatchAbortsOnConcurrentWrite(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	db.Set("balance", int64(100))
+
+	tx := db.Multi()
+	tx.Watch("balance")
+	value, _ := db.Get("balance")
+	tx.Set("balance", value.(int64)-30)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		db.Set("balance", int64(50)) // Another client writes in between.
+	}()
+	<-done
+
+	if _, err := tx.Exec(); !errors.Is(err, ErrTxnAborted) {
+		t.Fatalf("Exec after a concurrent write: %v, want ErrTxnAborted", err)
+	}
+	if value, _ := db.Get("balance"); value != int64(50) {
+		t.Errorf("balance = %v, want the concurrent write's 50", value)
+	}
+
+	tx.Watch("balance") // Retry: nothing changes this time.
+	tx.Set("balance", int64(20))
+	if _, err := tx.Exec(); err != nil {
+		t.Fatalf("Exec of the retry: %v", err)
+	}
+	if value, _ := db.Get("balance"); value != int64(20) {
+		t.Errorf("balance = %v, want 20", value)
+	}
+}
+
+func TestTxnWatchMissingKeyCreatedAndDeleted(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	tx := db.Multi()
+	tx.Watch("lock")
+	db.Set("lock", "other")
+	db.Delete("lock")
+	tx.Set("lock", "mine")
+	if _, err := tx.Exec(); !errors.Is(err, ErrTxnAborted) {
+		t.Errorf("Exec after the key was created and deleted: %v, want ErrTxnAborted", err)
+	}
+
+	tx.Watch("lock")
+	db.Set("unrelated", 1)
+	db.Delete("unrelated")
+	tx.Set("lock", "mine")
+	if _, err := tx.Exec(); err != nil {
+		t.Errorf("Exec after writes to other keys only: %v", err)
+	}
+}
+
+func TestTxnWatchAfterTombstonesDropped(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	tx := db.Multi()
+	tx.Watch("lock")
+	db.Set("lock", "other")
+	db.Delete("lock")
+	for i := range minTombstones + 1 { // Enough deletions to drop every tombstone.
+		key := fmt.Sprintf("churn%d", i)
+		db.Set(key, i)
+		db.Delete(key)
+	}
+	if _, ok := db.tombstones["lock"]; ok {
+		t.Fatal("tombstones were not dropped")
+	}
+	tx.Set("lock", "mine")
+	if _, err := tx.Exec(); !errors.Is(err, ErrTxnAborted) {
+		t.Errorf("Exec once the tombstone was dropped: %v, want ErrTxnAborted", err)
+	}
+}
+
+func TestTxnExecRunsQueuedCommands(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	db.Set("word", "abc")
+
+	tx := db.Multi()
+	tx.Set("n", int64(1))
+	tx.IncrBy("n", 41)
+	tx.IncrBy("word", 1) // Fails, but does not roll back the others.
+	tx.Get("n")
+	tx.Delete("word")
+	if value, ok := db.Get("n"); ok {
+		t.Fatalf("n = %v before Exec, want nothing applied yet", value)
+	}
+	results, err := tx.Exec()
+	if err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+	if len(results) != 5 || results[0] != nil || results[1] != int64(42) || results[3] != int64(42) || results[4] != true {
+		t.Errorf("Exec results = %v, want [<nil> 42 error 42 true]", results)
+	}
+	if err, ok := results[2].(error); !ok || !errors.Is(err, ErrNotInteger) {
+		t.Errorf("result of INCRBY on a string = %v, want ErrNotInteger", results[2])
+	}
+	if results, err := tx.Exec(); err != nil || len(results) != 0 {
+		t.Errorf("second Exec = %v, %v; want the transaction reset", results, err)
+	}
+
+	tx.Set("n", int64(0))
+	tx.Watch("n")
+	tx.Discard()
+	db.Set("n", int64(7)) // No longer watched.
+	if results, err := tx.Exec(); err != nil || len(results) != 0 {
+		t.Errorf("Exec after Discard = %v, %v; want nothing run", results, err)
+	}
+	if value, _ := db.Get("n"); value != int64(7) {
+		t.Errorf("n = %v, want 7: Discard dropped the queued Set", value)
+	}
+
+	db.SetReadOnly(true)
+	tx.Set("n", int64(0))
+	if _, err := tx.Exec(); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Exec while read-only: %v, want ErrReadOnly", err)
+	}
+}
+
+func TestServerMultiExecWatch(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	addr := startServer(t, db, ServerConfig{})
+	c, other := dial(t, addr), dial(t, addr)
+
+	for _, step := range []struct {
+		args []string
+		want any
+	}{
+		{[]string{"MULTI"}, "OK"},
+		{[]string{"SET", "n", "1"}, "QUEUED"},
+		{[]string{"INCRBY", "n", "9"}, "QUEUED"},
+	} {
+		if reply := c.do(t, step.args...); reply != step.want {
+			t.Fatalf("%q = %v, want %v", step.args, reply, step.want)
+		}
+	}
+	if reply := other.do(t, "GET", "n"); reply != nil {
+		t.Errorf("GET n before EXEC = %v, want nil", reply)
+	}
+	if reply := c.do(t, "EXEC"); fmt.Sprint(reply) != "[OK 10]" {
+		t.Errorf("EXEC = %v, want [OK 10]", reply)
+	}
+
+	c.do(t, "WATCH", "n")
+	other.do(t, "SET", "n", "20") // Changes the watched key.
+	c.do(t, "MULTI")
+	c.do(t, "SET", "n", "30")
+	if reply := c.do(t, "EXEC"); reply != nil {
+		t.Errorf("EXEC after a watched key changed = %v, want a null reply", reply)
+	}
+	if reply := other.do(t, "GET", "n"); reply != "20" {
+		t.Errorf("GET n = %v, want the other client's 20", reply)
+	}
+
+	for _, tc := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"EXEC"}, "ERR EXEC without MULTI"},
+		{[]string{"DISCARD"}, "ERR DISCARD without MULTI"},
+	} {
+		if reply, ok := c.do(t, tc.args...).(error); !ok || reply.Error() != tc.want {
+			t.Errorf("%q = %v, want %s", tc.args, reply, tc.want)
+		}
+	}
+	c.do(t, "MULTI")
+	if reply, ok := c.do(t, "WATCH", "n").(error); !ok || reply.Error() != errWatchInMulti.Error() {
+		t.Errorf("WATCH inside MULTI = %v, want %v", reply, errWatchInMulti)
+	}
+	c.do(t, "NOSUCHCOMMAND")
+	if reply, ok := c.do(t, "EXEC").(error); !ok || reply.Error() != errExecAbort.Error() {
+		t.Errorf("EXEC after a bad command = %v, want %v", reply, errExecAbort)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import "time"
+
+// TypedView is a view of a DataBase holding values of type T, returned by
+// Typed. It reads and writes the same keyspace as the database, so the two
+// can be mixed freely; the view only saves callers the type assertion.
+type TypedView[T any] struct {
+	db *DataBase
+}
+
+// Typed returns a view of db for keys whose values all have type T:
+//
+//	users := Typed[User](db)
+//	users.Set("user:1", User{Name: "ann"})
+//	u, ok := users.Get("user:1") // u is a User.
+//
+// Values are matched exactly, by Go's type assertion: a view of string
+// does not see []byte values, and a view of int does not see int64.
+func Typed[T any](db *DataBase) TypedView[T] {
+	return TypedView[T]{db}
+}
+
+// Get returns the value at key. It reports false if the key is missing or
+// holds a value of another type. As with DataBase.Get, containers alias the
+// store and must not be modified.
+func (v TypedView[T]) Get(key string) (T, bool) {
+	return GetAs[T](v.db, key)
+}
+
+// Set stores value at key, as DataBase.Set does.
+func (v TypedView[T]) Set(key string, value T) error {
+	return v.db.Set(key, value)
+}
+
+// SetWithTTL stores value at key with a time to live, as
+// DataBase.SetWithTTL does.
+func (v TypedView[T]) SetWithTTL(key string, value T, ttl time.Duration) error {
+	return v.db.SetWithTTL(key, value, ttl)
+}
+
+// Delete removes key, whatever type its value has, and reports whether it
+// existed.
+func (v TypedView[T]) Delete(key string) bool {
+	return v.db.Delete(key)
+}
+
+// GetAs returns the value at key in db as a T, reporting false if the key
+// is missing or holds a value of another type, where a bare type assertion
+// on the result of Get would panic.
+func GetAs[T any](db *DataBase, key string) (T, bool) {
+	value, ok := db.Get(key)
+	if !ok {
+		var zero T
+		return zero, false
+	}
+	t, ok := value.(T)
+	return t, ok
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// account is a value type for the typed view tests.
+type account struct {
+	Owner   string
+	Balance int
+}
+
+func TestTypedRoundTrip(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	accounts := Typed[account](db)
+	if err := accounts.Set("acct:1", account{"ada", 10}); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if got, ok := accounts.Get("acct:1"); !ok || got != (account{"ada", 10}) {
+		t.Errorf("Get = %+v, %v; want ada's account", got, ok)
+	}
+	if got, ok := GetAs[account](db, "acct:1"); !ok || got.Owner != "ada" {
+		t.Errorf("GetAs = %+v, %v; want ada's account", got, ok)
+	}
+	if raw, _ := db.Get("acct:1"); raw != (account{"ada", 10}) {
+		t.Errorf("the database sees %#v, want the same value", raw)
+	}
+
+	if err := accounts.SetWithTTL("acct:2", account{"bob", 5}, time.Minute); err != nil {
+		t.Fatalf("SetWithTTL: %v", err)
+	}
+	if ttl := db.TTL("acct:2"); ttl <= 0 || ttl > time.Minute {
+		t.Errorf("TTL = %v, want up to a minute", ttl)
+	}
+	if !accounts.Delete("acct:2") || accounts.Delete("acct:2") {
+		t.Error("Delete did not report the key once")
+	}
+	if got, ok := accounts.Get("acct:2"); ok || got != (account{}) {
+		t.Errorf("Get of a deleted key = %+v, %v; want the zero value", got, ok)
+	}
+
+	pointers := Typed[*account](db)
+	pointers.Set("ptr", &account{"cy", 1})
+	if got, ok := pointers.Get("ptr"); !ok || got.Owner != "cy" {
+		t.Errorf("pointer view Get = %+v, %v", got, ok)
+	}
+}
+
+func TestTypedWrongType(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	db.Set("int", 1)
+	db.Set("string", "s")
+	db.Set("bytes", []byte("s"))
+	db.RPush("list", "x")
+
+	for key, ok := range map[string]bool{"int": true, "string": false, "list": false, "missing": false} {
+		if got, found := GetAs[int](db, key); found != ok || (!ok && got != 0) {
+			t.Errorf("GetAs[int](%s) = %v, %v; want found %v", key, got, found, ok)
+		}
+	}
+	if _, ok := GetAs[int64](db, "int"); ok {
+		t.Error("GetAs[int64] matched an int: types are matched exactly")
+	}
+	if _, ok := Typed[string](db).Get("bytes"); ok {
+		t.Error("a string view saw a []byte value")
+	}
+	if got, ok := GetAs[List](db, "list"); !ok || len(got) != 1 {
+		t.Errorf("GetAs[List] = %v, %v; want the list", got, ok)
+	}
+	if _, ok := GetAs[any](db, "string"); !ok {
+		t.Error("GetAs[any] missed a present key")
+	}
+
+	// A view may overwrite a key of another type, as Set does.
+	Typed[account](db).Set("string", account{"dee", 0})
+	if _, ok := GetAs[string](db, "string"); ok {
+		t.Error("the old string survived a typed Set")
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+// minTombstones is how many tombstones are kept, at the least, before they
+// are dropped; beyond it they may take as many entries as there are keys.
+const minTombstones = 1024
+
+// touch records a write to key by giving it the next version number. The
+// counter is shared by all keys, so a key that is deleted and recreated never
+// reuses an old version. The caller must hold the write lock.
+func (db *DataBase) touch(key string) {
+	db.writeSeq++
+	db.versions[key] = db.writeSeq
+	delete(db.tombstones, key) // The live version supersedes it.
+	db.accessed(key)
+	db.changed()
+	db.trackSize(key)
+	db.recordChange(key, false)
+	db.logChange(key)
+	db.notify.send(key, EventSet)
+	db.waits.wake(key)
+}
+
+// bury records the deletion of key as a version of its own, a tombstone, so
+// that a key watched while missing that is created and deleted again before
+// Exec is still seen to have changed. Once tombstones outnumber both
+// minTombstones and the keys, they are all dropped to bound their memory,
+// and tombstoneFloor tells Watch that it can no longer rule out such a
+// change. The caller must hold the write lock.
+func (db *DataBase) bury(key string) {
+	delete(db.versions, key) // A recreated key starts from a fresh version.
+	db.writeSeq++
+	db.tombstones[key] = db.writeSeq
+	if len(db.tombstones) > max(minTombstones, db.data.len()) {
+		clear(db.tombstones)
+		db.tombstoneFloor = db.writeSeq
+	}
+}
+
+// versionOf returns the version of key, or of its deletion if it was
+// deleted, or 0. The caller must hold the lock.
+func (db *DataBase) versionOf(key string) uint64 {
+	if version, ok := db.versions[key]; ok {
+		return version
+	}
+	return db.tombstones[key]
+}
+
+// GetWithVersion returns the value at key together with its version, a
+// token that changes on every write to the key, including in-place updates
+// such as HSet or RPush and TTL changes. Pass the version to SetIfVersion to
+// write back only if nobody else has written in between. Missing keys report
+// version 0.
+func (db *DataBase) GetWithVersion(key string) (value any, version uint64, ok bool) {
+	db.lock.RLock()         // Acquire a read lock.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+	value, ok = db.lookup(key)
+	if !ok {
+		return nil, 0, false
+	}
+	return value, db.versions[key], true
+}
+
+// SetIfVersion stores value at key only if the key's current version equals
+// expected, as returned by GetWithVersion; an expected version of 0 requires
+// the key not to exist. This gives optimistic concurrency without comparing
+// possibly large values. It returns false, writing nothing, on a version
+// mismatch, a prefix policy violation or a full NoEviction memory budget.
+func (db *DataBase) SetIfVersion(key string, value any, expected uint64) bool {
+	db.lock.Lock()    // One lock for the check and the write.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	if db.readOnly {
+		return false
+	}
+	db.expireIfNeeded(key)
+
+	if db.versions[key] != expected {
+		return false // Someone else wrote since the caller read.
+	}
+	if db.checkPolicy(key, value) != nil || db.checkOOM(key, value) != nil {
+		return false
+	}
+	db.setLocked(key, value)
+	return true
+}
@@ -0,0 +1,47 @@
+package main
+
+import "testing"
+
+func TestSetIfVersionRejectsStale(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	if !db.SetIfVersion("k", "first", 0) {
+		t.Fatal("SetIfVersion(0) of a missing key failed")
+	}
+	if db.SetIfVersion("k", "again", 0) {
+		t.Error("SetIfVersion(0) overwrote an existing key")
+	}
+	value, v1, ok := db.GetWithVersion("k")
+	if !ok || value != "first" || v1 == 0 {
+		t.Fatalf("GetWithVersion = %v, %d, %v", value, v1, ok)
+	}
+
+	db.Set("k", "other writer") // Someone writes after our read.
+	if db.SetIfVersion("k", "mine", v1) {
+		t.Error("a stale version was accepted")
+	}
+	if value, _ := db.Get("k"); value != "other writer" {
+		t.Errorf("k = %v, want the other writer's value", value)
+	}
+
+	_, v2, _ := db.GetWithVersion("k")
+	if v2 == v1 {
+		t.Fatal("the version did not change on Set")
+	}
+	if !db.SetIfVersion("k", "mine", v2) {
+		t.Error("the current version was refused")
+	}
+	if db.SetIfVersion("k", "replay", v2) {
+		t.Error("the same version was accepted twice")
+	}
+
+	db.RPush("list", "a")
+	_, before, _ := db.GetWithVersion("list")
+	db.RPush("list", "b") // In-place updates change the version too.
+	if _, after, _ := db.GetWithVersion("list"); after == before {
+		t.Error("RPush did not change the version")
+	}
+	if _, v, ok := db.GetWithVersion("missing"); ok || v != 0 {
+		t.Errorf("GetWithVersion of a missing key = %d, %v", v, ok)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"slices"
+	"sync"
+)
+
+// Snapshot is the frozen state of the database handed to a View callback.
+// It is safe for concurrent use.
+type Snapshot struct {
+	mu      sync.Mutex
+	entries map[string]any  // Every live value at the time of the View.
+	private map[string]bool // Entries already replaced by a private copy.
+}
+
+// View calls fn with a consistent, read-only snapshot of the database, for
+// reports that read many keys and must not see a mix of states. Taking the
+// snapshot holds the write lock only while references to the values are
+// captured, in the manner of BGSave; afterwards writers carry on unblocked
+// and nothing they do is visible in the snapshot. A collection is copied at
+// most once per View, either when a writer first updates it in place or
+// when fn first reads it, so fn may also modify what Get returns without
+// affecting the store. Keys that expire after the snapshot was taken stay
+// in it. The snapshot must not be used after fn returns.
+func (db *DataBase) View(fn func(v *Snapshot)) {
+	view := &Snapshot{private: make(map[string]bool)}
+	db.lock.Lock() // Writers wait only while the references are captured.
+	now := db.clock.Now()
+	view.entries = make(map[string]any, db.data.len())
+	for key, value := range db.data.all() {
+		if !db.isExpired(key, now) {
+			view.entries[key] = value
+		}
+	}
+	if db.views == nil {
+		db.views = make(map[*Snapshot]struct{})
+	}
+	db.views[view] = struct{}{}
+	db.lock.Unlock()
+
+	defer func() {
+		db.lock.Lock() // Stop copy-on-write for this view.
+		delete(db.views, view)
+		db.lock.Unlock()
+	}()
+	fn(view)
+}
+
+// Get returns the value key held when the snapshot was taken.
+func (v *Snapshot) Get(key string) (any, bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	value, ok := v.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if !v.private[key] {
+		value = deepCopy(value) // The store may still change the original in place.
+		v.entries[key] = value
+		v.private[key] = true
+	}
+	return value, true
+}
+
+// Keys returns every key in the snapshot, sorted.
+func (v *Snapshot) Keys() []string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	keys := make([]string, 0, len(v.entries))
+	for key := range v.entries {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// Len returns the number of keys in the snapshot.
+func (v *Snapshot) Len() int {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return len(v.entries)
+}
+
+// preserve gives the snapshot a private copy of key before a writer updates
+// the shared value in place. The caller must hold the database write lock.
+func (v *Snapshot) preserve(key string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if value, ok := v.entries[key]; ok && !v.private[key] {
+		v.entries[key] = deepCopy(value)
+		v.private[key] = true
+	}
+}
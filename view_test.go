@@ -0,0 +1,76 @@
+package main
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestViewIsStable(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1_000_000, 0))
+	db := NewDataBase(WithClock(clock))
+	defer db.Close()
+	db.Set("total", int64(100))
+	db.Set("gone", "x")
+	db.RPush("orders", "a", "b")
+	db.HSet("user:1", "name", "ada")
+	db.SAdd("tags", "red")
+	db.SetWithTTL("short", "v", time.Second)
+
+	db.View(func(v *Snapshot) {
+		if items, _ := v.Get("orders"); !reflect.DeepEqual(items, List{"a", "b"}) {
+			t.Errorf("orders before any write = %v", items)
+		}
+		done := make(chan struct{})
+		go func() { // Writers must not wait for the view to end.
+			defer close(done)
+			db.Incr("total")
+			db.Delete("gone")
+			db.RPush("orders", "c") // Updated in place, read already.
+			db.HSet("user:1", "name", "bob")
+			db.SAdd("tags", "blue") // Updated in place, not read yet.
+			db.Set("new", "v")
+			clock.Advance(time.Hour)
+			db.sweep()
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("writers blocked during a View")
+		}
+
+		for key, want := range map[string]any{
+			"total":  int64(100),
+			"gone":   "x",
+			"orders": List{"a", "b"},
+			"user:1": Hash{"name": "ada"},
+			"tags":   Set{"red": {}},
+			"short":  "v",
+		} {
+			if got, ok := v.Get(key); !ok || !reflect.DeepEqual(got, want) {
+				t.Errorf("view %s = %v, %v; want %v", key, got, ok, want)
+			}
+		}
+		if _, ok := v.Get("new"); ok {
+			t.Error("the view sees a key written after it was taken")
+		}
+		want := []string{"gone", "orders", "short", "tags", "total", "user:1"}
+		if keys := v.Keys(); !slices.Equal(keys, want) || v.Len() != len(want) {
+			t.Errorf("view Keys = %q, Len = %d; want %q", keys, v.Len(), want)
+		}
+
+		hash, _ := v.Get("user:1")
+		hash.(Hash)["name"] = "cy" // The view's copy is its own.
+	})
+
+	if name, _, _ := db.HGet("user:1", "name"); name != "bob" {
+		t.Errorf("store user:1 name = %v, want bob", name)
+	}
+	if items, _ := db.LRange("orders", 0, -1); len(items) != 3 {
+		t.Errorf("store orders = %v, want the push kept", items)
+	}
+	if keys := db.Keys("*"); !slices.Equal(keys, []string{"new", "orders", "tags", "total", "user:1"}) {
+		t.Errorf("store keys after the View = %q", keys)
+	}
+}
@@ -0,0 +1,506 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"hash/maphash"
+	"iter"
+	"math"
+)
+
+// ErrNaNScore is returned by ZAdd and ZIncrBy for a score that is not a
+// number, which would have no place in the order.
+var ErrNaNScore = errors.New("ERR resulting score is not a number (NaN)")
+
+// ZSet is the value stored under a key holding a Redis-style sorted set.
+// Members are ordered by ascending score, ties broken by member name.
+// It is stored by pointer; use the DataBase Z* methods to work with it.
+//
+// As in Redis, the order is kept in a skip list whose links record how many
+// members they skip, so adding, removing and ranking a member, and finding
+// the start of a rank or score range, take O(log n) on average.
+type ZSet struct {
+	scores map[string]float64 // Member to score, for O(1) lookups.
+	head   *zskipNode         // Sentinel before the first member, with every level.
+	level  int                // Levels in use, at least 1.
+	length int
+}
+
+// ZMember pairs a sorted-set member with its score.
+type ZMember struct {
+	Member string
+	Score  float64
+}
+
+// zskipMaxLevel bounds the levels of a node, enough for 4^32 members.
+const zskipMaxLevel = 32
+
+// zskipNode is a skip list node: a member with a link per level.
+type zskipNode struct {
+	ZMember
+	next []zskipLink
+}
+
+// zskipLink is a forward link of a skip list node, with its span: the
+// number of members it moves past, counting the one it reaches. A link to
+// nothing spans the members left after its node.
+type zskipLink struct {
+	node *zskipNode
+	span int
+}
+
+// zskipSeed seeds the hash that picks node levels.
+var zskipSeed = maphash.MakeSeed()
+
+func init() {
+	gob.Register(&ZSet{}) // Allow sorted sets to be persisted inside the any-typed map.
+}
+
+// newZSet returns an empty sorted set.
+func newZSet() *ZSet {
+	return &ZSet{
+		scores: make(map[string]float64),
+		head:   &zskipNode{next: make([]zskipLink, zskipMaxLevel)},
+		level:  1,
+	}
+}
+
+// zskipLevel picks the level of member's node: each level above the first
+// with probability 1/4, as in Redis. It is drawn from a hash of the member,
+// seeded per process so clients cannot pick members that unbalance it, which
+// makes the shape of a list depend only on its members and so lets
+// reflect.DeepEqual compare sorted sets by content.
+func zskipLevel(member string) int {
+	h := maphash.String(zskipSeed, member)
+	level := 1
+	for level < zskipMaxLevel && h&3 == 0 {
+		level++
+		h >>= 2
+	}
+	return level
+}
+
+// less orders entries by score, then lexicographically by member.
+func (a ZMember) less(b ZMember) bool {
+	if a.Score != b.Score {
+		return a.Score < b.Score
+	}
+	return a.Member < b.Member
+}
+
+// Len returns the number of members.
+func (z *ZSet) Len() int {
+	return z.length
+}
+
+// add sets member's score, repositioning it if it already existed.
+// Returns true if the member is new.
+func (z *ZSet) add(member string, score float64) bool {
+	old, exists := z.scores[member]
+	if exists {
+		if old == score {
+			return false // Already in the right place.
+		}
+		z.unlink(ZMember{member, old})
+	}
+	z.insert(ZMember{member, score})
+	z.scores[member] = score
+	return !exists
+}
+
+// remove deletes member, returning false if it was absent.
+func (z *ZSet) remove(member string) bool {
+	score, ok := z.scores[member]
+	if !ok {
+		return false
+	}
+	z.unlink(ZMember{member, score})
+	delete(z.scores, member)
+	return true
+}
+
+// insert links a node for e, which must not be in the list.
+func (z *ZSet) insert(e ZMember) {
+	var update [zskipMaxLevel]*zskipNode // Last node before e on each level.
+	var rank [zskipMaxLevel]int          // Members up to and including update's node.
+	x := z.head
+	for i := z.level - 1; i >= 0; i-- {
+		if i < z.level-1 {
+			rank[i] = rank[i+1]
+		}
+		for x.next[i].node != nil && x.next[i].node.less(e) {
+			rank[i] += x.next[i].span
+			x = x.next[i].node
+		}
+		update[i] = x
+	}
+	level := zskipLevel(e.Member)
+	for ; z.level < level; z.level++ {
+		update[z.level] = z.head
+		z.head.next[z.level].span = z.length // A link to nothing spans every member.
+	}
+	n := &zskipNode{ZMember: e, next: make([]zskipLink, level)}
+	for i := range level {
+		n.next[i].node = update[i].next[i].node
+		n.next[i].span = update[i].next[i].span - (rank[0] - rank[i])
+		update[i].next[i] = zskipLink{n, rank[0] - rank[i] + 1}
+	}
+	for i := level; i < z.level; i++ {
+		update[i].next[i].span++ // These links now pass over n too.
+	}
+	z.length++
+}
+
+// unlink removes the node for e, which must be in the list.
+func (z *ZSet) unlink(e ZMember) {
+	var update [zskipMaxLevel]*zskipNode
+	x := z.head
+	for i := z.level - 1; i >= 0; i-- {
+		for x.next[i].node != nil && x.next[i].node.less(e) {
+			x = x.next[i].node
+		}
+		update[i] = x
+	}
+	n := x.next[0].node
+	for i := range z.level {
+		if update[i].next[i].node == n {
+			update[i].next[i] = zskipLink{n.next[i].node, update[i].next[i].span + n.next[i].span - 1}
+		} else {
+			update[i].next[i].span--
+		}
+	}
+	for z.level > 1 && z.head.next[z.level-1].node == nil {
+		z.level--
+		z.head.next[z.level] = zskipLink{} // Unused levels stay zero, for DeepEqual.
+	}
+	z.length--
+}
+
+// count returns how many members before returns true for, which must hold
+// for a prefix of the members in rank order.
+func (z *ZSet) count(before func(ZMember) bool) int {
+	n := 0
+	x := z.head
+	for i := z.level - 1; i >= 0; i-- {
+		for x.next[i].node != nil && before(x.next[i].node.ZMember) {
+			n += x.next[i].span
+			x = x.next[i].node
+		}
+	}
+	return n
+}
+
+// at returns the node at the zero-based rank, or nil past the end.
+func (z *ZSet) at(rank int) *zskipNode {
+	passed := 0
+	x := z.head
+	for i := z.level - 1; i >= 0; i-- {
+		for x.next[i].node != nil && passed+x.next[i].span <= rank+1 {
+			passed += x.next[i].span
+			x = x.next[i].node
+		}
+		if passed == rank+1 {
+			return x
+		}
+	}
+	return nil
+}
+
+// slice returns the members ranked in the half-open range [lo, hi).
+func (z *ZSet) slice(lo, hi int) []ZMember {
+	if lo >= hi {
+		return nil
+	}
+	members := make([]ZMember, 0, hi-lo)
+	for n := z.at(lo); n != nil && len(members) < hi-lo; n = n.next[0].node {
+		members = append(members, n.ZMember)
+	}
+	return members
+}
+
+// all yields the members in rank order. The set must not change meanwhile.
+func (z *ZSet) all() iter.Seq[ZMember] {
+	return func(yield func(ZMember) bool) {
+		for n := z.head.next[0].node; n != nil; n = n.next[0].node {
+			if !yield(n.ZMember) {
+				return
+			}
+		}
+	}
+}
+
+// members returns the members in rank order.
+func (z *ZSet) members() []ZMember {
+	return z.slice(0, z.length)
+}
+
+// rank returns member's zero-based ascending position.
+func (z *ZSet) rank(member string) (int, bool) {
+	score, ok := z.scores[member]
+	if !ok {
+		return 0, false
+	}
+	e := ZMember{member, score}
+	return z.count(func(m ZMember) bool { return m.less(e) }), true
+}
+
+// deepCopy returns an independent copy, used by GetCopy.
+func (z *ZSet) deepCopy() any {
+	c := newZSet()
+	for m := range z.all() {
+		c.add(m.Member, m.Score)
+	}
+	return c
+}
+
+// GobEncode encodes the members in rank order.
+func (z *ZSet) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(z.members())
+	return buf.Bytes(), err
+}
+
+// GobDecode rebuilds the set from the members written by GobEncode.
+func (z *ZSet) GobDecode(data []byte) error {
+	var members []ZMember
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&members); err != nil {
+		return err
+	}
+	*z = *newZSet()
+	for _, m := range members {
+		z.add(m.Member, m.Score)
+	}
+	return nil
+}
+
+// zsetAt returns the sorted set stored at key, or nil if the key is absent.
+// It returns ErrWrongType if the key holds a different kind of value.
+// The caller must hold the lock.
+func (db *DataBase) zsetAt(key string) (*ZSet, error) {
+	value, exists := db.lookup(key)
+	if !exists {
+		return nil, nil // Absent keys behave like empty sorted sets.
+	}
+	z, ok := value.(*ZSet)
+	if !ok {
+		return nil, ErrWrongType
+	}
+	return z, nil
+}
+
+// zsetForWrite returns the sorted set at key, creating it if absent.
+// The caller must hold the write lock.
+func (db *DataBase) zsetForWrite(key string) (*ZSet, error) {
+	db.expireIfNeeded(key)
+	z, err := db.zsetAt(key)
+	if err != nil || z != nil {
+		db.cow(key) // The caller updates the set in place.
+		return z, err
+	}
+	z = newZSet()
+	db.data.set(key, z)
+	return z, nil
+}
+
+// ZAdd sets the scores of the given members, creating the sorted set if
+// needed. Returns the number of members that were newly added. A NaN score
+// is refused with ErrNaNScore, and then no member is added.
+func (db *DataBase) ZAdd(key string, members ...ZMember) (int, error) {
+	for _, m := range members {
+		if math.IsNaN(m.Score) {
+			return 0, ErrNaNScore
+		}
+	}
+	db.lock.Lock()    // Acquire a write lock.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	if db.readOnly {
+		return 0, ErrReadOnly
+	}
+	if err := db.checkGrowth(); err != nil {
+		return 0, err
+	}
+
+	z, err := db.zsetForWrite(key)
+	if err != nil {
+		return 0, err
+	}
+	added := 0
+	for _, m := range members {
+		if z.add(m.Member, m.Score) {
+			added++
+		}
+	}
+	if z.Len() == 0 {
+		db.removeKey(key) // ZAdd with no members must not leave an empty set behind.
+	} else {
+		db.touch(key)
+	}
+	return added, nil
+}
+
+// ZRem removes the given members from the sorted set at key and returns how
+// many were present. Removing every member deletes the key.
+func (db *DataBase) ZRem(key string, members ...string) (int, error) {
+	db.lock.Lock()    // Acquire a write lock.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	if db.readOnly {
+		return 0, ErrReadOnly
+	}
+	db.expireIfNeeded(key)
+
+	z, err := db.zsetAt(key)
+	if err != nil || z == nil {
+		return 0, err
+	}
+	db.cow(key) // The set is updated in place.
+	removed := 0
+	for _, member := range members {
+		if z.remove(member) {
+			removed++
+		}
+	}
+	if z.Len() == 0 {
+		db.removeKey(key)
+	} else if removed > 0 {
+		db.touch(key)
+	}
+	return removed, nil
+}
+
+// ZScore returns the score of member in the sorted set at key.
+func (db *DataBase) ZScore(key, member string) (float64, bool, error) {
+	db.lock.RLock()         // Acquire a read lock.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+
+	z, err := db.zsetAt(key)
+	if err != nil || z == nil {
+		return 0, false, err
+	}
+	score, ok := z.scores[member]
+	return score, ok, nil
+}
+
+// ZIncrBy adds delta to member's score, creating the member (with score
+// delta) and the sorted set as needed, and returns the new score. The member
+// is repositioned immediately, so ranks and range queries stay correct. An
+// increment that would make the score NaN, such as -Inf added to +Inf, is
+// refused with ErrNaNScore and changes nothing.
+func (db *DataBase) ZIncrBy(key string, delta float64, member string) (float64, error) {
+	db.lock.Lock()    // Acquire a write lock for the read-modify-write.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	if db.readOnly {
+		return 0, ErrReadOnly
+	}
+	if err := db.checkGrowth(); err != nil {
+		return 0, err
+	}
+
+	db.expireIfNeeded(key)
+	z, err := db.zsetAt(key)
+	if err != nil {
+		return 0, err
+	}
+	var score float64 // Missing members start at zero.
+	if z != nil {
+		score = z.scores[member]
+	}
+	if score += delta; math.IsNaN(score) {
+		return 0, ErrNaNScore // Checked before zsetForWrite creates the set.
+	}
+	if z, err = db.zsetForWrite(key); err != nil {
+		return 0, err
+	}
+	z.add(member, score)
+	db.touch(key)
+	return score, nil
+}
+
+// ZRank returns the zero-based rank of member, ordered by ascending score.
+// It reports false if the key or member does not exist, or if the key holds
+// a different kind of value.
+func (db *DataBase) ZRank(key, member string) (int, bool) {
+	db.lock.RLock()         // Acquire a read lock.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+
+	z, err := db.zsetAt(key)
+	if err != nil || z == nil {
+		return 0, false
+	}
+	return z.rank(member)
+}
+
+// ZRange returns the members ranked between start and stop, inclusive, in
+// ascending score order. Negative indexes count from the highest rank.
+func (db *DataBase) ZRange(key string, start, stop int) ([]ZMember, error) {
+	db.lock.RLock()         // Acquire a read lock.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+
+	z, err := db.zsetAt(key)
+	if err != nil || z == nil {
+		return nil, err
+	}
+	lo, hi := listRange(start, stop, z.Len())
+	return z.slice(lo, hi), nil
+}
+
+// scoreRange returns the half-open [lo, hi) range of ranks holding the
+// members scored between min and max, inclusive.
+func (z *ZSet) scoreRange(min, max float64) (lo, hi int) {
+	lo = z.count(func(m ZMember) bool { return m.Score < min })
+	hi = z.count(func(m ZMember) bool { return m.Score <= max })
+	if hi < lo {
+		return lo, lo // min > max selects nothing.
+	}
+	return lo, hi
+}
+
+// ZRangeByScore returns the members whose scores lie between min and max,
+// inclusive, in ascending score order, like Redis ZRANGEBYSCORE. Use
+// math.Inf for an unbounded end.
+func (db *DataBase) ZRangeByScore(key string, min, max float64) ([]string, error) {
+	db.lock.RLock()         // Acquire a read lock.
+	defer db.lock.RUnlock() // Release the lock when the function exits.
+
+	z, err := db.zsetAt(key)
+	if err != nil || z == nil {
+		return nil, err
+	}
+	lo, hi := z.scoreRange(min, max)
+	members := make([]string, hi-lo)
+	for i, m := range z.slice(lo, hi) {
+		members[i] = m.Member
+	}
+	return members, nil
+}
+
+// ZRemRangeByScore removes the members whose scores lie between min and
+// max, inclusive, like Redis ZREMRANGEBYSCORE, and returns how many were
+// removed. Removing every member deletes the key.
+func (db *DataBase) ZRemRangeByScore(key string, min, max float64) (int, error) {
+	db.lock.Lock()    // Acquire a write lock.
+	defer db.unlock() // Release the lock and run expiry callbacks.
+	if db.readOnly {
+		return 0, ErrReadOnly
+	}
+	db.expireIfNeeded(key)
+
+	z, err := db.zsetAt(key)
+	if err != nil || z == nil {
+		return 0, err
+	}
+	lo, hi := z.scoreRange(min, max)
+	if lo == hi {
+		return 0, nil // Nothing in range.
+	}
+	db.cow(key) // The set is updated in place.
+	for _, m := range z.slice(lo, hi) {
+		z.remove(m.Member)
+	}
+	if z.Len() == 0 {
+		db.removeKey(key)
+	} else {
+		db.touch(key)
+	}
+	return hi - lo, nil
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"reflect"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestZIncrByMovesRank(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	db.ZAdd("board", ZMember{"ada", 10}, ZMember{"bob", 20}, ZMember{"cy", 30})
+	if rank, ok := db.ZRank("board", "ada"); !ok || rank != 0 {
+		t.Fatalf("ZRank(ada) = %d, %v; want 0", rank, ok)
+	}
+
+	score, err := db.ZIncrBy("board", 25, "ada")
+	if err != nil || score != 35 {
+		t.Fatalf("ZIncrBy = %v, %v; want 35", score, err)
+	}
+	if rank, _ := db.ZRank("board", "ada"); rank != 2 {
+		t.Errorf("ZRank(ada) after the bump = %d, want 2", rank)
+	}
+	if rank, _ := db.ZRank("board", "bob"); rank != 0 {
+		t.Errorf("ZRank(bob) = %d, want 0", rank)
+	}
+	members, _ := db.ZRange("board", 0, -1)
+	want := []ZMember{{"bob", 20}, {"cy", 30}, {"ada", 35}}
+	if len(members) != len(want) {
+		t.Fatalf("ZRange = %v, want %v", members, want)
+	}
+	for i := range want {
+		if members[i] != want[i] {
+			t.Errorf("ZRange[%d] = %v, want %v", i, members[i], want[i])
+		}
+	}
+
+	if score, err := db.ZIncrBy("board", 5, "new"); err != nil || score != 5 {
+		t.Errorf("ZIncrBy of a new member = %v, %v; want 5", score, err)
+	}
+	if _, ok := db.ZRank("board", "missing"); ok {
+		t.Error("ZRank of a missing member reported ok")
+	}
+}
+
+func TestZSetRejectsNaN(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	if _, err := db.ZAdd("z", ZMember{"a", 1}, ZMember{"b", math.NaN()}); !errors.Is(err, ErrNaNScore) {
+		t.Errorf("ZAdd of NaN: %v, want ErrNaNScore", err)
+	}
+	if _, ok := db.Get("z"); ok {
+		t.Error("ZAdd of NaN created the key")
+	}
+	if _, err := db.ZIncrBy("z", math.NaN(), "a"); !errors.Is(err, ErrNaNScore) {
+		t.Errorf("ZIncrBy by NaN: %v, want ErrNaNScore", err)
+	}
+	if _, ok := db.Get("z"); ok {
+		t.Error("ZIncrBy by NaN created the key")
+	}
+
+	db.ZAdd("z", ZMember{"inf", math.Inf(1)})
+	if _, err := db.ZIncrBy("z", math.Inf(-1), "inf"); !errors.Is(err, ErrNaNScore) {
+		t.Errorf("ZIncrBy of +Inf by -Inf: %v, want ErrNaNScore", err)
+	}
+	if score, _, _ := db.ZScore("z", "inf"); !math.IsInf(score, 1) {
+		t.Errorf("score after the refused ZIncrBy = %v, want +Inf", score)
+	}
+}
+
+// checkZSet compares z with want, the members in rank order, through every
+// way of reading it.
+func checkZSet(t *testing.T, z *ZSet, want []ZMember) {
+	t.Helper()
+	if z.Len() != len(want) {
+		t.Fatalf("Len = %d, want %d", z.Len(), len(want))
+	}
+	if got := z.members(); !slices.Equal(got, want) {
+		t.Fatalf("members = %v, want %v", got, want)
+	}
+	for i, m := range want {
+		if rank, ok := z.rank(m.Member); !ok || rank != i {
+			t.Fatalf("rank(%s) = %d, %v; want %d", m.Member, rank, ok, i)
+		}
+		if n := z.at(i); n == nil || n.ZMember != m {
+			t.Fatalf("at(%d) = %v, want %v", i, n, m)
+		}
+	}
+	if n := z.at(len(want)); n != nil {
+		t.Fatalf("at(%d) past the end = %v", len(want), n.ZMember)
+	}
+}
+
+func TestZSetSkipList(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	z := newZSet()
+	scores := make(map[string]float64)
+	for i := range 5000 {
+		member := fmt.Sprintf("m%d", rng.IntN(500))
+		if rng.IntN(3) == 0 {
+			z.remove(member)
+			delete(scores, member)
+		} else {
+			score := float64(rng.IntN(100)) // Many ties, ordered by member.
+			z.add(member, score)
+			scores[member] = score
+		}
+		if i%500 == 0 || i == 4999 {
+			want := make([]ZMember, 0, len(scores))
+			for member, score := range scores {
+				want = append(want, ZMember{member, score})
+			}
+			slices.SortFunc(want, func(a, b ZMember) int {
+				if a.less(b) {
+					return -1
+				}
+				return 1
+			})
+			checkZSet(t, z, want)
+
+			lo, hi := z.scoreRange(10, 20)
+			var inRange []ZMember
+			for _, m := range want {
+				if m.Score >= 10 && m.Score <= 20 {
+					inRange = append(inRange, m)
+				}
+			}
+			if got := z.slice(lo, hi); !slices.Equal(got, inRange) {
+				t.Fatalf("scoreRange(10, 20) = %v, want %v", got, inRange)
+			}
+		}
+	}
+}
+
+func TestZSetDeepEqualIgnoresHistory(t *testing.T) {
+	a, b := newZSet(), newZSet()
+	for i := range 200 {
+		a.add(fmt.Sprintf("m%d", i), float64(i))
+	}
+	for i := 399; i >= 0; i-- {
+		b.add(fmt.Sprintf("m%d", i), float64(i%7))
+	}
+	for i := 200; i < 400; i++ {
+		b.remove(fmt.Sprintf("m%d", i))
+	}
+	for i := range 200 {
+		b.add(fmt.Sprintf("m%d", i), float64(i))
+	}
+	if !reflect.DeepEqual(a, b) {
+		t.Error("sorted sets with equal members are not DeepEqual")
+	}
+	if !reflect.DeepEqual(a, a.deepCopy()) {
+		t.Error("deepCopy is not DeepEqual to the original")
+	}
+}
+
+func TestZRangeByScoreBounds(t *testing.T) {
+	db := NewDataBase()
+	defer db.Close()
+	db.ZAdd("ts", ZMember{"a", 1}, ZMember{"b", 2}, ZMember{"c", 3}, ZMember{"d", 4})
+	for _, tc := range []struct {
+		min, max float64
+		want     []string
+	}{
+		{2, 3, []string{"b", "c"}}, // Both ends are inclusive.
+		{math.Inf(-1), 2, []string{"a", "b"}},
+		{3, math.Inf(1), []string{"c", "d"}},
+		{math.Inf(-1), math.Inf(1), []string{"a", "b", "c", "d"}},
+		{5, 9, []string{}},
+		{3, 2, []string{}},
+	} {
+		got, err := db.ZRangeByScore("ts", tc.min, tc.max)
+		if err != nil || !slices.Equal(got, tc.want) {
+			t.Errorf("ZRangeByScore(%v, %v) = %q, %v; want %q", tc.min, tc.max, got, err, tc.want)
+		}
+	}
+
+	n, err := db.ZRemRangeByScore("ts", math.Inf(-1), 2)
+	if err != nil || n != 2 {
+		t.Fatalf("ZRemRangeByScore(-inf, 2) = %d, %v; want 2", n, err)
+	}
+	if got, _ := db.ZRangeByScore("ts", math.Inf(-1), math.Inf(1)); !slices.Equal(got, []string{"c", "d"}) {
+		t.Errorf("after ZRemRangeByScore: %q, want [c d]", got)
+	}
+	if n, _ := db.ZRemRangeByScore("ts", 3, math.Inf(1)); n != 2 {
+		t.Errorf("ZRemRangeByScore(3, +inf) = %d, want 2", n)
+	}
+	if _, ok := db.Get("ts"); ok {
+		t.Error("removing every member left the key behind")
+	}
+
+	db.Set("str", "x")
+	if _, err := db.ZRangeByScore("str", 0, 1); !errors.Is(err, ErrWrongType) {
+		t.Errorf("ZRangeByScore of a string: %v, want ErrWrongType", err)
+	}
+	if _, err := db.ZRemRangeByScore("str", 0, 1); !errors.Is(err, ErrWrongType) {
+		t.Errorf("ZRemRangeByScore of a string: %v, want ErrWrongType", err)
+	}
+}
+
+// BenchmarkZAdd adds members with random scores to a sorted set of a
+// million, which is O(log n) per member with the skip list.
+func BenchmarkZAdd(b *testing.B) {
+	z := newZSet()
+	rng := rand.New(rand.NewPCG(1, 2))
+	for i := range 1_000_000 {
+		z.add(strconv.Itoa(i), rng.Float64())
+	}
+	b.ResetTimer()
+	for i := range b.N {
+		z.add(strconv.Itoa(i%1_000_000), rng.Float64())
+	}
+}
+
+// BenchmarkZRank ranks members of a sorted set of a million.
+func BenchmarkZRank(b *testing.B) {
+	z := newZSet()
+	for i := range 1_000_000 {
+		z.add(strconv.Itoa(i), float64(i))
+	}
+	b.ResetTimer()
+	for i := range b.N {
+		z.rank(strconv.Itoa(i % 1_000_000))
+	}
+}